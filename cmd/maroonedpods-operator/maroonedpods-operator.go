@@ -3,8 +3,11 @@ package main
 import (
 	"flag"
 	"fmt"
+	promv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	configv1 "github.com/openshift/api/config/v1"
 	"go.uber.org/zap/zapcore"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
 	controller "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator"
 	"maroonedpods.io/maroonedpods/pkg/util"
 	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
@@ -33,6 +36,10 @@ func init() {
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == controller.CheckCertsCommand {
+		os.Exit(controller.RunCheckCerts(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
 	verbose := defVerbose
 	// visit actual flags passed in and if passed check -v and set verbose
 	if verboseEnvVarVal := os.Getenv("VERBOSITY"); verboseEnvVarVal != "" {
@@ -71,6 +78,10 @@ func main() {
 		LeaderElectionNamespace:    namespace,
 		LeaderElectionID:           "maroonedpods-operator-leader-election-helper",
 		LeaderElectionResourceLock: "leases",
+		// ready once the server has a serving certificate, see the certificates readiness check
+		HealthProbeBindAddress: fmt.Sprintf(":%d", util.OperatorHealthProbePort),
+		// controller.Add serves the metrics over TLS with the rotated metrics certificate
+		MetricsBindAddress: "0",
 	}
 
 	// Create a new Manager to provide shared dependencies and start components
@@ -91,6 +102,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := promv1.AddToScheme(mgr.GetScheme()); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	if err := configv1.AddToScheme(mgr.GetScheme()); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
+	if err := apiregistrationv1.AddToScheme(mgr.GetScheme()); err != nil {
+		log.Error(err, "")
+		os.Exit(1)
+	}
+
 	// Setup the controller
 	if err := controller.Add(mgr); err != nil {
 		log.Error(err, "")
@@ -3,21 +3,27 @@ package main
 import (
 	"context"
 	"github.com/pkg/errors"
-	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"maroonedpods.io/maroonedpods/pkg/maroonedpods-server"
-	"maroonedpods.io/maroonedpods/pkg/certificates/bootstrap"
 	"maroonedpods.io/maroonedpods/pkg/client"
-	"maroonedpods.io/maroonedpods/pkg/informers"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/certwatcher"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
 	"os"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"time"
 )
 
 func main() {
 	defer klog.Flush()
 	maroonedpodsNS := util.GetNamespace()
 
+	featureGates, err := featuregate.FromEnv()
+	if err != nil {
+		klog.Fatalf("Invalid feature gates: %v\n", err)
+	}
+	klog.Infof("Enabled feature gates: %v", featureGates.List())
+
 	maroonedpodsCli, err := client.GetMaroonedPodsClient()
 	if err != nil {
 		klog.Error(err.Error())
@@ -26,29 +32,30 @@ func main() {
 	ctx := signals.SetupSignalHandler()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	stop := ctx.Done()
-
-	secretInformer := informers.GetSecretInformer(maroonedpodsCli, maroonedpodsNS)
-	go secretInformer.Run(stop)
-	if !cache.WaitForCacheSync(stop, secretInformer.HasSynced) {
-		os.Exit(1)
-	}
 
-	secretCertManager := bootstrap.NewFallbackCertificateManager(
-		bootstrap.NewSecretCertificateManager(
-			util.SecretResourceName,
-			maroonedpodsNS,
-			secretInformer.GetStore(),
-		),
-	)
+	certWatcher := certwatcher.New(maroonedpodsCli, certwatcher.Options{
+		Namespace:           maroonedpodsNS,
+		SecretName:          util.SecretResourceName,
+		BundleConfigMapName: util.SignerBundleResourceName,
+	})
+	go func() {
+		if err := certWatcher.Start(ctx); err != nil {
+			klog.Fatalf("Certificate watcher failed: %v\n", errors.WithStack(err))
+		}
+	}()
 
-	secretCertManager.Start()
-	defer secretCertManager.Stop()
+	certExpiryThreshold := maroonedpods_server.DefaultCertExpiryThreshold
+	if val := os.Getenv(util.CertExpiryThresholdEnv); val != "" {
+		if certExpiryThreshold, err = time.ParseDuration(val); err != nil {
+			klog.Fatalf("Invalid %s %q: %v\n", util.CertExpiryThresholdEnv, val, err)
+		}
+	}
 
 	maroonedpodsServer, err := maroonedpods_server.MaroonedPodsServer(maroonedpodsNS,
 		util.DefaultHost,
 		util.DefaultPort,
-		secretCertManager,
+		certWatcher,
+		certExpiryThreshold,
 		maroonedpodsCli,
 	)
 	if err != nil {
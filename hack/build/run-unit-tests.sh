@@ -23,6 +23,6 @@ source hack/build/common.sh
 parseTestOpts "${@}"
 export GO111MODULE=off
 export KUBEBUILDER_CONTROLPLANE_START_TIMEOUT=120s
-test_command="env OPERATOR_DIR=${MAROONEDPODS_DIR} ginkgo -v -coverprofile=.coverprofile ${pkgs} ${test_args:+-args $test_args}"
+test_command="env OPERATOR_DIR=${MAROONEDPODS_DIR} ginkgo -v -race -coverprofile=.coverprofile ${pkgs} ${test_args:+-args $test_args}"
 echo "${test_command}"
 ${test_command}
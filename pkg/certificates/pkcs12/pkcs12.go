@@ -0,0 +1,43 @@
+// Package pkcs12 writes PKCS#12 (RFC 7292) keystores and trust stores for consumers that
+// can't load PEM, e.g. Java clients. It wraps software.sslmate.com/src/go-pkcs12, the keys are
+// encrypted with AES-256 and PBKDF2 and the keystores are authenticated with HMAC-SHA-256.
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+
+	gopkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrIncorrectPassword is returned by Decode when the MAC of the keystore doesn't match the password
+var ErrIncorrectPassword = gopkcs12.ErrIncorrectPassword
+
+// Encode creates a keystore holding the private key and its certificate chain, the
+// certificate of the key first, protected by the password.
+func Encode(key crypto.PrivateKey, certs []*x509.Certificate, password string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("pkcs12: a keystore needs the certificate of the key")
+	}
+	return gopkcs12.Modern.Encode(key, certs[0], certs[1:], password)
+}
+
+// EncodeTrustStore creates a keystore holding only trusted certificates, e.g. a CA bundle
+func EncodeTrustStore(certs []*x509.Certificate, password string) ([]byte, error) {
+	return gopkcs12.Modern.EncodeTrustStore(certs, password)
+}
+
+// DecodeTrustStore returns the certificates of a keystore written by EncodeTrustStore
+func DecodeTrustStore(data []byte, password string) ([]*x509.Certificate, error) {
+	return gopkcs12.DecodeTrustStore(data, password)
+}
+
+// Decode returns the private key and the certificates of a keystore written by Encode
+func Decode(data []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, cert, caCerts, err := gopkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, append([]*x509.Certificate{cert}, caCerts...), nil
+}
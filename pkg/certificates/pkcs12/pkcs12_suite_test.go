@@ -0,0 +1,13 @@
+package pkcs12_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPKCS12(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "PKCS12 Suite")
+}
@@ -0,0 +1,105 @@
+package pkcs12_test
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/pkcs12"
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple"
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple/cert"
+)
+
+var _ = Describe("PKCS#12", func() {
+	var (
+		ca     *triple.KeyPair
+		server *triple.KeyPair
+	)
+
+	BeforeEach(func() {
+		var err error
+		ca, err = triple.NewCA("maroonedpods.io", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		server, err = triple.NewServerKeyPair(ca, "server", "server", "maroonedpods", "cluster.local", nil, nil, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should round trip the key and the chain", func() {
+		keystore, err := pkcs12.Encode(server.Key, []*x509.Certificate{server.Cert, ca.Cert}, "secret")
+		Expect(err).ToNot(HaveOccurred())
+
+		key, certs, err := pkcs12.Decode(keystore, "secret")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.Key.Equal(key)).To(BeTrue())
+		Expect(certs).To(HaveLen(2))
+		Expect(certs[0].Equal(server.Cert)).To(BeTrue())
+		Expect(certs[1].Equal(ca.Cert)).To(BeTrue())
+	})
+
+	It("should support RSA keys", func() {
+		key, err := cert.NewRSAPrivateKey()
+		Expect(err).ToNot(HaveOccurred())
+		leaf, err := cert.NewSignedCert(cert.Config{CommonName: "client", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, key, ca.Cert, ca.Key, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+
+		keystore, err := pkcs12.Encode(key, []*x509.Certificate{leaf}, "")
+		Expect(err).ToNot(HaveOccurred())
+
+		decodedKey, certs, err := pkcs12.Decode(keystore, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key.Equal(decodedKey)).To(BeTrue())
+		Expect(certs).To(HaveLen(1))
+		Expect(certs[0].Equal(leaf)).To(BeTrue())
+	})
+
+	It("should encrypt the key with AES-256", func() {
+		keystore, err := pkcs12.Encode(server.Key, []*x509.Certificate{server.Cert}, "secret")
+		Expect(err).ToNot(HaveOccurred())
+
+		aes256CBC, err := asn1.Marshal(asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bytes.Contains(keystore, aes256CBC)).To(BeTrue())
+	})
+
+	It("should reject a wrong password", func() {
+		keystore, err := pkcs12.Encode(server.Key, []*x509.Certificate{server.Cert}, "secret")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, err = pkcs12.Decode(keystore, "other")
+		Expect(err).To(MatchError(pkcs12.ErrIncorrectPassword))
+	})
+
+	It("should require a certificate", func() {
+		_, err := pkcs12.Encode(server.Key, nil, "secret")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should round trip a trust store", func() {
+		other, err := triple.NewCA("other.maroonedpods.io", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+
+		truststore, err := pkcs12.EncodeTrustStore([]*x509.Certificate{ca.Cert, other.Cert}, "changeit")
+		Expect(err).ToNot(HaveOccurred())
+
+		certs, err := pkcs12.DecodeTrustStore(truststore, "changeit")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs).To(HaveLen(2))
+		Expect(certs[0].Equal(ca.Cert)).To(BeTrue())
+		Expect(certs[1].Equal(other.Cert)).To(BeTrue())
+
+		_, err = pkcs12.DecodeTrustStore(truststore, "other")
+		Expect(err).To(MatchError(pkcs12.ErrIncorrectPassword))
+	})
+
+	It("should not decode a keystore as trust store", func() {
+		keystore, err := pkcs12.Encode(server.Key, []*x509.Certificate{server.Cert}, "secret")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = pkcs12.DecodeTrustStore(keystore, "secret")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,119 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// absentNamespaceOf returns the namespace the API refused to create an object in because it doesn't
+// exist, false if the error isn't about a missing namespace
+func absentNamespaceOf(err error) (string, bool) {
+	if !errors.IsNotFound(err) {
+		return "", false
+	}
+	var status errors.APIStatus
+	if !goerrors.As(err, &status) {
+		return "", false
+	}
+	details := status.Status().Details
+	if details == nil || details.Kind != "namespaces" || details.Name == "" {
+		return "", false
+	}
+	return details.Name, true
+}
+
+// suspensionReason is why the definitions with objects in the namespace are not synced
+func suspensionReason(namespace string) string {
+	return fmt.Sprintf("suspended, namespace %s is absent", namespace)
+}
+
+// skipAbsentNamespace tells if the sync of the definition failed because one of its namespaces was
+// deleted and records it as suspended. The definitions of those namespaces are suspended until the
+// namespaces are recreated.
+func (cm *certManager) skipAbsentNamespace(cd mpcerts.CertificateDefinition, err error) bool {
+	namespace, ok := absentNamespaceOf(err)
+	if !ok {
+		return false
+	}
+	cm.recordSuspension(cd, namespace)
+	if cm.absentNamespaces == nil {
+		cm.absentNamespaces = sets.NewString()
+	}
+	if cm.absentNamespaces.Has(namespace) {
+		return true
+	}
+	cm.absentNamespaces.Insert(namespace)
+
+	// the factory can't stop the informers of a single namespace, the listers are dropped and the
+	// informers are reused once the namespace is recreated
+	key := clusterNamespace{namespace: namespace}
+	if _, ok := cm.listers()[key]; ok {
+		cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+			delete(listerMap, key)
+		})
+	}
+	log.Info("The namespace doesn't exist, suspending its certificates", "namespace", namespace)
+	cm.eventRecorder.Warningf("CertificatesSuspended", "Suspending the certificates in namespace %s, it doesn't exist", namespace)
+	return true
+}
+
+// absentNamespaceOfDefinition returns the absent namespace the definition has objects in, empty if none
+func (cm *certManager) absentNamespaceOfDefinition(cd mpcerts.CertificateDefinition) string {
+	for _, ns := range namespacesOf(cd) {
+		if cm.absentNamespaces.Has(ns) {
+			return ns
+		}
+	}
+	return ""
+}
+
+// inAbsentNamespace tells if the definition has objects in a namespace that was deleted
+func (cm *certManager) inAbsentNamespace(cd mpcerts.CertificateDefinition) bool {
+	return cm.absentNamespaceOfDefinition(cd) != ""
+}
+
+// refreshAbsentNamespaces resumes the certificates of the absent namespaces that were recreated
+func (cm *certManager) refreshAbsentNamespaces() {
+	for _, ns := range cm.absentNamespaces.List() {
+		namespace, err := cm.k8sClient.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+		case err != nil:
+			// keep it suspended, the next sync checks again
+			log.Error(err, "Failed to get the absent namespace", "namespace", ns)
+		case namespace.Status.Phase != corev1.NamespaceTerminating:
+			log.Info("The namespace was recreated, resuming its certificates", "namespace", ns)
+			cm.absentNamespaces.Delete(ns)
+			key := clusterNamespace{namespace: ns}
+			if _, ok := cm.listers()[key]; !ok && sets.NewString(cm.namespaces...).Has(ns) {
+				cm.updateListers(func(listerMap map[clusterNamespace]*certListers, informers v1helpers.KubeInformersForNamespaces) {
+					listerMap[key] = newListers(informers, ns)
+				})
+			}
+			cm.eventRecorder.Eventf("CertificatesResumed", "Resuming the certificates in namespace %s, it was recreated", ns)
+		}
+	}
+}
+
+// recordSuspension records the objects of the definition as suspended instead of failed
+func (cm *certManager) recordSuspension(cd mpcerts.CertificateDefinition, namespace string) {
+	cm.statusLock.Lock()
+	defer cm.statusLock.Unlock()
+	if cm.suspensions == nil {
+		cm.suspensions = make(map[string]string)
+	}
+	for _, object := range managedObjectsOf(cd) {
+		key := syncKey(object.Ref)
+		cm.suspensions[key] = suspensionReason(namespace)
+		delete(cm.syncResults, key)
+	}
+}
@@ -0,0 +1,174 @@
+package certmanager
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("absent namespace tests", func() {
+	const (
+		namespace = "maroonedpods"
+		workloads = "workloads"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		return append(certs, cert.CertificateDefinition{
+			SignerSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-signer"}},
+			SignerConfig:        certs[0].SignerConfig,
+			CertBundleConfigmap: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-bundle"}},
+			TargetSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-cert"}},
+			TargetConfig:        certs[0].TargetConfig,
+			TargetService:       &[]string{"workload"}[0],
+		})
+	}
+
+	newNamespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		}
+	}
+
+	// deletes the namespace with its objects, the way the namespace controller does
+	deleteNamespace := func() {
+		secrets, err := client.CoreV1().Secrets(workloads).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		for _, secret := range secrets.Items {
+			Expect(client.CoreV1().Secrets(workloads).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})).To(Succeed())
+		}
+		configMaps, err := client.CoreV1().ConfigMaps(workloads).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		for _, configMap := range configMaps.Items {
+			Expect(client.CoreV1().ConfigMaps(workloads).Delete(context.TODO(), configMap.Name, metav1.DeleteOptions{})).To(Succeed())
+		}
+		Expect(client.CoreV1().Namespaces().Delete(context.TODO(), workloads, metav1.DeleteOptions{})).To(Succeed())
+
+		Eventually(func() bool {
+			_, err := cm.listers()[clusterNamespace{namespace: workloads}].secretLister.Secrets(workloads).Get("workload-signer")
+			return errors.IsNotFound(err)
+		}).Should(BeTrue())
+	}
+
+	targetExists := func() bool {
+		_, err := client.CoreV1().Secrets(workloads).Get(context.TODO(), "workload-cert", metav1.GetOptions{})
+		return err == nil
+	}
+
+	events := func(reason string) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == reason {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	workloadTarget := func() ManagedCert {
+		managed, _ := cm.ListManagedCertificates(context.TODO())
+		for _, m := range managed {
+			if m.Ref.Kind == "Secret" && m.Ref.Name == "workload-cert" {
+				return m
+			}
+		}
+		Fail("the workload target is not listed")
+		return ManagedCert{}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(newNamespace(namespace), newNamespace(workloads))
+		// the API refuses to create objects in a namespace that doesn't exist
+		client.PrependReactor("create", "*", func(action testingclient.Action) (bool, runtime.Object, error) {
+			ns := action.GetNamespace()
+			if ns == "" {
+				return false, nil, nil
+			}
+			if _, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("namespaces"), "", ns); errors.IsNotFound(err) {
+				return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, ns)
+			}
+			return false, nil, nil
+		})
+		addApplyReactor(client)
+		allowAccessReviews(client)
+		cm = newCertManager(client, nil, namespace, workloads)
+		cm.extClient = extfake.NewSimpleClientset()
+		cm.client = crfake.NewClientBuilder().Build()
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should suspend the definitions of a deleted namespace and resume them once it is recreated", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(targetExists()).To(BeTrue())
+		Expect(workloadTarget().LastSyncSucceeded).To(BeTrue())
+
+		deleteNamespace()
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(cm.SyncStatus().SuspendedNamespaces).To(Equal([]string{workloads}))
+		Expect(cm.listers()).ToNot(HaveKey(clusterNamespace{namespace: workloads}))
+		Expect(cm.listers()).To(HaveKey(clusterNamespace{namespace: namespace}))
+		target := workloadTarget()
+		Expect(target.Suspended).To(Equal(suspensionReason(workloads)))
+		Expect(target.LastSyncError).To(BeEmpty())
+		Expect(target.Error).To(BeEmpty())
+		Expect(cm.NextRefreshIn()).To(BeNumerically(">", 0))
+
+		// no more attempts while it is absent
+		client.ClearActions()
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		for _, action := range client.Actions() {
+			Expect(action.GetNamespace()).ToNot(Equal(workloads), "%s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+		Eventually(func() int {
+			return events("CertificatesSuspended")
+		}).Should(Equal(1))
+
+		_, err := client.CoreV1().Namespaces().Create(context.TODO(), newNamespace(workloads), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(targetExists()).To(BeTrue())
+		Expect(cm.SyncStatus().SuspendedNamespaces).To(BeEmpty())
+		Expect(cm.listers()).To(HaveKey(clusterNamespace{namespace: workloads}))
+		target = workloadTarget()
+		Expect(target.Suspended).To(BeEmpty())
+		Expect(target.LastSyncSucceeded).To(BeTrue())
+		Eventually(func() int {
+			return events("CertificatesResumed")
+		}).Should(Equal(1))
+	})
+
+	It("should still fail for objects that aren't found", func() {
+		Expect(absentNamespaceOf(errors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "workload-cert"))).To(BeEmpty())
+		ns, ok := absentNamespaceOf(errors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, workloads))
+		Expect(ok).To(BeTrue())
+		Expect(ns).To(Equal(workloads))
+	})
+})
@@ -0,0 +1,62 @@
+package certmanager
+
+import (
+	"crypto/tls"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// legacyAnnotations maps the annotation keys written by releases from before the maroonpods
+// rename to the current ones
+var legacyAnnotations = map[string]string{
+	"operator.maroonpods.io/certConfig": annCertConfig,
+}
+
+func hasLegacyAnnotations(secret *corev1.Secret) bool {
+	for legacy := range legacyAnnotations {
+		if _, ok := secret.Annotations[legacy]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// adoptLegacySecret translates the legacy annotations of the secret and records the cert config
+// of a secret holding a valid key pair but no cert config, so upgrading from an older release
+// doesn't rotate every certificate at once. It returns whether the secret was adopted.
+func adoptLegacySecret(secret *corev1.Secret, configString string) bool {
+	adopted := false
+	for legacy, current := range legacyAnnotations {
+		value, ok := secret.Annotations[legacy]
+		if !ok {
+			continue
+		}
+		delete(secret.Annotations, legacy)
+		if _, ok := secret.Annotations[current]; !ok {
+			secret.Annotations[current] = value
+		}
+		adopted = true
+	}
+
+	if _, ok := secret.Annotations[annCertConfig]; !ok && hasValidKeyPair(secret) {
+		secret.Annotations[annCertConfig] = configString
+		adopted = true
+	}
+
+	return adopted
+}
+
+func hasValidKeyPair(secret *corev1.Secret) bool {
+	_, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	return err == nil
+}
+
+// reportAdoptions summarizes the secrets and bundles adopted during the sync
+func (cm *certManager) reportAdoptions() {
+	if cm.adopted == 0 {
+		return
+	}
+	log.Info("Adopted certificate secrets of a previous operator version or installation", "count", cm.adopted)
+	cm.eventRecorder.Eventf("CertificatesAdopted", "Adopted %d certificate secrets of a previous operator version or installation", cm.adopted)
+	cm.adopted = 0
+}
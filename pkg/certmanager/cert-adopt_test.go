@@ -0,0 +1,134 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("legacy secret adoption tests", func() {
+	const (
+		namespace        = "maroonedpods"
+		signerName       = "maroonedpods-server"
+		legacyCertConfig = "operator.maroonpods.io/certConfig"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// rewrites the annotations of the secret the way an older release left them
+	makeLegacy := func(name string, legacyKey bool) *corev1.Secret {
+		secret := getSecret(name)
+		if legacyKey {
+			secret.Annotations[legacyCertConfig] = secret.Annotations[annCertConfig]
+		}
+		delete(secret.Annotations, annCertConfig)
+		secret, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		return secret
+	}
+
+	adoptionEvents := func() []string {
+		var messages []string
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if event := create.GetObject().(*corev1.Event); event.Reason == "CertificatesAdopted" {
+					messages = append(messages, event.Message)
+				}
+			}
+		}
+		return messages
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should adopt legacy secrets without rotating them", func() {
+		signer := makeLegacy(signerName, false)
+		target := makeLegacy(util.SecretResourceName, true)
+		client.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		for _, before := range []*corev1.Secret{signer, target} {
+			after := getSecret(before.Name)
+			Expect(after.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+			Expect(after.Annotations).To(HaveKey(annCertConfig))
+			Expect(after.Annotations).ToNot(HaveKey(legacyCertConfig))
+		}
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(toSerializedCertConfig(24*time.Hour, 12*time.Hour)))
+		Expect(adoptionEvents()).To(ConsistOf(ContainSubstring("Adopted 2 certificate secrets")))
+
+		// nothing left to adopt
+		waitForSecretInLister(cm, getSecret(util.SecretResourceName))
+		client.ClearActions()
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(adoptionEvents()).To(BeEmpty())
+	})
+
+	It("should still rotate adopted secrets when the config changes", func() {
+		target := makeLegacy(util.SecretResourceName, true)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		waitForSecretInLister(cm, getSecret(util.SecretResourceName))
+
+		lifetime, renewBefore := 26*time.Hour, 13*time.Hour
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{
+			Namespace:         namespace,
+			TargetDuration:    &lifetime,
+			TargetRenewBefore: &renewBefore,
+		}))).To(Succeed())
+
+		Expect(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey]).ToNot(Equal(target.Data[corev1.TLSCertKey]))
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(toSerializedCertConfig(26*time.Hour, 13*time.Hour)))
+	})
+
+	It("should rotate a legacy secret whose config differs from the current one", func() {
+		target := getSecret(util.SecretResourceName)
+		target.Annotations[legacyCertConfig] = `{"lifetime":"48h0m0s","refresh":"24h0m0s"}`
+		delete(target.Annotations, annCertConfig)
+		target, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), target, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, target)
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey]).ToNot(Equal(target.Data[corev1.TLSCertKey]))
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(toSerializedCertConfig(24*time.Hour, 12*time.Hour)))
+	})
+})
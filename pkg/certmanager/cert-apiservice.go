@@ -0,0 +1,56 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// checkAPIServices fails for a definition with APIServices without a client, their CA bundles couldn't
+// be updated
+func (cm *certManager) checkAPIServices(cd mpcerts.CertificateDefinition) error {
+	if cm.client != nil || len(cd.APIServices) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: APIServices %v but there is no client", mpcerts.ErrInvalidDefinition, cd.APIServices)
+}
+
+// getAPIService returns the APIService, nil until it is registered
+func (cm *certManager) getAPIService(name string) (*apiregistrationv1.APIService, error) {
+	if cm.client == nil {
+		return nil, fmt.Errorf("no client to get the APIService %s", name)
+	}
+	apiService := &apiregistrationv1.APIService{}
+	if err := cm.client.Get(context.TODO(), client.ObjectKey{Name: name}, apiService); err != nil {
+		// the APIService is only registered once its server is deployed
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return apiService, nil
+}
+
+// updateAPIServiceCABundle patches the caBundle of the APIService unless it is up to date
+func (cm *certManager) updateAPIServiceCABundle(name string, caBundle []byte) error {
+	current, err := cm.getAPIService(name)
+	if err != nil || current == nil {
+		return err
+	}
+	if caBundleUpToDate(current.Spec.CABundle, caBundle) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	updated.Spec.CABundle = caBundle
+	if err := cm.client.Patch(context.TODO(), updated, client.MergeFrom(current)); err != nil {
+		return err
+	}
+	log.Info("Updated the CA bundle of the APIService", "apiService", name)
+	return nil
+}
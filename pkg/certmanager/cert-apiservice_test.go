@@ -0,0 +1,171 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// patchCountingClient counts the patches of the client and fails them with err if set
+type patchCountingClient struct {
+	crclient.Client
+	patches int
+	err     error
+}
+
+func (c *patchCountingClient) Patch(ctx context.Context, obj crclient.Object, patch crclient.Patch, opts ...crclient.PatchOption) error {
+	c.patches++
+	if c.err != nil {
+		return c.err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+var _ = Describe("APIService CA bundle propagation tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		apiService = "v1alpha1.metrics.maroonedpods.io"
+	)
+
+	var (
+		client   *fake.Clientset
+		crClient *patchCountingClient
+		cm       *certManager
+		cancel   context.CancelFunc
+		certs    []cert.CertificateDefinition
+	)
+
+	start := func(objs ...crclient.Object) {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(apiregistrationv1.AddToScheme(s)).To(Succeed())
+		crClient = &patchCountingClient{Client: crfake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build()}
+
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.client = crClient
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	newAPIService := func(caBundle []byte) *apiregistrationv1.APIService {
+		return &apiregistrationv1.APIService{
+			ObjectMeta: metav1.ObjectMeta{Name: apiService},
+			Spec: apiregistrationv1.APIServiceSpec{
+				Group:                "metrics.maroonedpods.io",
+				Version:              "v1alpha1",
+				CABundle:             caBundle,
+				GroupPriorityMinimum: 1000,
+				VersionPriority:      15,
+			},
+		}
+	}
+
+	getCABundle := func() []byte {
+		current := &apiregistrationv1.APIService{}
+		Expect(crClient.Get(context.TODO(), crclient.ObjectKey{Name: apiService}, current)).To(Succeed())
+		return current.Spec.CABundle
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	getBundle := func() []byte {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cert.CABundleConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return []byte(configMap.Data[selfManagedBundleKey])
+	}
+
+	BeforeEach(func() {
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].APIServices = []string{apiService}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should set the rotated bundle on the APIService", func() {
+		start(newAPIService([]byte("stale")))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(getCABundle()).To(Equal(getBundle()))
+		Expect(crClient.patches).To(Equal(1))
+		waitForSecretInLister(cm, getSecret(cert.ServerSignerSecretName))
+
+		// the CA rotates
+		certs[0].SignerConfig.Lifetime *= 2
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		bundle := getBundle()
+		Expect(getCABundle()).To(Equal(bundle))
+		Expect(crClient.patches).To(Equal(2))
+	})
+
+	It("should not patch an up to date APIService", func() {
+		start(newAPIService([]byte("stale")))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		waitForSecretInLister(cm, getSecret(cert.ServerSignerSecretName))
+		waitForSecretInLister(cm, getSecret(cert.ServerCertSecretName))
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(crClient.patches).To(Equal(1))
+	})
+
+	It("should tolerate a missing APIService", func() {
+		start()
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(crClient.patches).To(BeZero())
+	})
+
+	It("should report propagation failures", func() {
+		start(newAPIService(nil))
+		crClient.err = fmt.Errorf("denied")
+
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(MatchError(ContainSubstring("apiservice " + apiService)))
+		Expect(getBundle()).ToNot(BeEmpty())
+		Eventually(func() bool {
+			for _, action := range client.Actions() {
+				if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" &&
+					create.GetObject().(*corev1.Event).Reason == "CABundlePropagationFailed" {
+					return true
+				}
+			}
+			return false
+		}).Should(BeTrue())
+	})
+
+	It("should reject APIServices without a client", func() {
+		start()
+		cm.client = nil
+
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(MatchError(cert.ErrInvalidDefinition))
+		Expect(err).To(MatchError(ContainSubstring("no client")))
+		_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue(), "the definition is synced")
+	})
+
+	It("should reject APIServices in the guest cluster", func() {
+		certs[0].ConsumerCluster = cert.GuestCluster
+		Expect(certs[0].Validate()).To(MatchError(ContainSubstring("APIServices")))
+	})
+})
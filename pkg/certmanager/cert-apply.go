@@ -0,0 +1,345 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// certFieldManager is the field manager of the server-side applies of the certificate manager
+	certFieldManager = "maroonedpods-cert-manager"
+)
+
+// ownedAnnotations and ownedLabels are the metadata keys only the certificate manager writes, the
+// applies claim them and nothing else of the metadata
+var (
+	ownedAnnotations = []string{annCertConfig, annKeystoreSource, annCustomKeys, annTruststoreSource, annBundleCopies, annBundleCopyOf}
+	ownedLabels      = []string{labelPreserved}
+)
+
+func init() {
+	for legacy := range legacyAnnotations {
+		ownedAnnotations = append(ownedAnnotations, legacy)
+	}
+	sort.Strings(ownedAnnotations)
+	ownedLabels = append(ownedLabels, definitionLabels...)
+	sort.Strings(ownedLabels)
+}
+
+// ownedFields are the fields of an object the certificate manager applies
+type ownedFields struct {
+	annotations map[string]string
+	labels      map[string]string
+	data        map[string][]byte
+	binaryData  map[string][]byte
+	// field paths of the apply, in the format of the conflict causes
+	paths sets.String
+	// JSON pointers of the owned fields the updated object drops
+	removed []string
+}
+
+func newOwnedFields() *ownedFields {
+	return &ownedFields{
+		annotations: map[string]string{},
+		labels:      map[string]string{},
+		data:        map[string][]byte{},
+		binaryData:  map[string][]byte{},
+		paths:       sets.NewString(),
+	}
+}
+
+func (f *ownedFields) addStrings(field, pointer string, keys []string, current, updated map[string]string, into map[string]string) {
+	for _, key := range keys {
+		if value, ok := updated[key]; ok {
+			into[key] = value
+			f.paths.Insert(field + "." + key)
+		} else if _, ok := current[key]; ok {
+			f.removed = append(f.removed, pointer+"/"+escapeJSONPointer(key))
+		}
+	}
+}
+
+func (f *ownedFields) addBytes(field, pointer string, keys []string, current, updated map[string][]byte, into map[string][]byte) {
+	for _, key := range keys {
+		if value, ok := updated[key]; ok {
+			into[key] = value
+			f.paths.Insert(field + "." + key)
+		} else if _, ok := current[key]; ok {
+			f.removed = append(f.removed, pointer+"/"+escapeJSONPointer(key))
+		}
+	}
+}
+
+func (f *ownedFields) addMetadata(current, updated metav1.Object) {
+	f.addStrings(".metadata.annotations", "/metadata/annotations", ownedAnnotations, current.GetAnnotations(), updated.GetAnnotations(), f.annotations)
+	f.addStrings(".metadata.labels", "/metadata/labels", ownedLabels, current.GetLabels(), updated.GetLabels(), f.labels)
+}
+
+// ownedSecretDataKeys returns the data keys the certificate manager derives from the key pair
+func ownedSecretDataKeys(secrets ...*corev1.Secret) []string {
+	keys := sets.NewString(keystoreKey, keystorePasswordKey, combinedPEMKey)
+	for _, secret := range secrets {
+		if custom := secret.Annotations[annCustomKeys]; custom != "" {
+			keys.Insert(strings.Split(custom, ",")...)
+		}
+	}
+	// written by library-go
+	keys.Delete(corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	return keys.List()
+}
+
+// ownedConfigMapDataKeys returns the additional bundle keys the certificate manager publishes
+func ownedConfigMapDataKeys(configMaps ...*corev1.ConfigMap) []string {
+	keys := sets.NewString()
+	for _, configMap := range configMaps {
+		var copies bundleCopiesState
+		if ann := configMap.Annotations[annBundleCopies]; ann != "" && json.Unmarshal([]byte(ann), &copies) == nil && copies.Key != "" {
+			keys.Insert(copies.Key)
+		}
+	}
+	// written by library-go
+	keys.Delete(selfManagedBundleKey)
+	return keys.List()
+}
+
+// applySecret applies the fields of updated the certificate manager owns: its annotations, labels and
+// derived data keys. Fields of other writers are neither sent nor clobbered, changes of updated outside
+// the owned fields are ignored. Owned fields updated drops are removed, also when a full update of a
+// previous release still co-owns them.
+func (cm *certManager) applySecret(ctx context.Context, current, updated *corev1.Secret) (*corev1.Secret, error) {
+	fields := newOwnedFields()
+	fields.addMetadata(current, updated)
+	fields.addBytes(".data", "/data", ownedSecretDataKeys(current, updated), current.Data, updated.Data, fields.data)
+
+	if !ownedSecretFieldsChanged(current, fields) {
+		return current, nil
+	}
+
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(current.Namespace)
+	config := applycorev1.Secret(current.Name, current.Namespace).
+		WithAnnotations(fields.annotations).
+		WithLabels(fields.labels).
+		WithData(fields.data)
+
+	var result *corev1.Secret
+	err := applyWithForceRetry("secret", current.Namespace+"/"+current.Name, fields.paths, func(force bool) error {
+		var err error
+		result, err = client.Apply(ctx, config, metav1.ApplyOptions{FieldManager: certFieldManager, Force: force})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leftovers := leftoverPointers(result, fields.removed)
+	if len(leftovers) == 0 {
+		return result, nil
+	}
+	patch, err := removePatch(leftovers)
+	if err != nil {
+		return nil, err
+	}
+	return client.Patch(ctx, current.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: certFieldManager})
+}
+
+func ownedSecretFieldsChanged(current *corev1.Secret, fields *ownedFields) bool {
+	if len(fields.removed) > 0 {
+		return true
+	}
+	for key, value := range fields.annotations {
+		if current.Annotations[key] != value {
+			return true
+		}
+	}
+	for key, value := range fields.labels {
+		if current.Labels[key] != value {
+			return true
+		}
+	}
+	for key, value := range fields.data {
+		if !equality.Semantic.DeepEqual(current.Data[key], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyConfigMap is the applySecret of configmaps in the cluster, dataKeys are the data keys the
+// certificate manager owns on top of the additional bundle key
+func (cm *certManager) applyConfigMap(cluster mpcerts.Cluster, current, updated *corev1.ConfigMap, dataKeys ...string) (*corev1.ConfigMap, error) {
+	fields := newOwnedFields()
+	fields.addMetadata(current, updated)
+	keys := sets.NewString(dataKeys...).Insert(ownedConfigMapDataKeys(current, updated)...)
+	fields.addStrings(".data", "/data", keys.List(), current.Data, updated.Data, map[string]string{})
+	fields.addBytes(".binaryData", "/binaryData", []string{truststoreKey}, current.BinaryData, updated.BinaryData, fields.binaryData)
+
+	data := map[string]string{}
+	for _, key := range keys.List() {
+		if value, ok := updated.Data[key]; ok {
+			data[key] = value
+		}
+	}
+
+	if !ownedConfigMapFieldsChanged(current, fields, data) {
+		return current, nil
+	}
+
+	client := cm.coreClient(cluster).ConfigMaps(current.Namespace)
+	config := applycorev1.ConfigMap(current.Name, current.Namespace).
+		WithAnnotations(fields.annotations).
+		WithLabels(fields.labels).
+		WithData(data).
+		WithBinaryData(fields.binaryData)
+
+	var result *corev1.ConfigMap
+	err := applyWithForceRetry("configmap", current.Namespace+"/"+current.Name, fields.paths, func(force bool) error {
+		var err error
+		result, err = client.Apply(context.TODO(), config, metav1.ApplyOptions{FieldManager: certFieldManager, Force: force})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leftovers := leftoverPointers(result, fields.removed)
+	if len(leftovers) == 0 {
+		return result, nil
+	}
+	patch, err := removePatch(leftovers)
+	if err != nil {
+		return nil, err
+	}
+	return client.Patch(context.TODO(), current.Name, types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: certFieldManager})
+}
+
+func ownedConfigMapFieldsChanged(current *corev1.ConfigMap, fields *ownedFields, data map[string]string) bool {
+	if len(fields.removed) > 0 {
+		return true
+	}
+	for key, value := range fields.annotations {
+		if current.Annotations[key] != value {
+			return true
+		}
+	}
+	for key, value := range fields.labels {
+		if current.Labels[key] != value {
+			return true
+		}
+	}
+	for key, value := range data {
+		if current.Data[key] != value {
+			return true
+		}
+	}
+	for key, value := range fields.binaryData {
+		if !equality.Semantic.DeepEqual(current.BinaryData[key], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyWithForceRetry applies without force first, a conflict is forced only when every conflicting
+// field is one the apply sends, those are owned by the certificate manager. Other conflicts are
+// returned.
+func applyWithForceRetry(kind, name string, paths sets.String, apply func(force bool) error) error {
+	err := apply(false)
+	if err == nil || !errors.IsConflict(err) {
+		return err
+	}
+
+	fields, owned := conflictingFields(err, paths)
+	if !owned {
+		return err
+	}
+
+	log.Info("Forcing the apply of fields owned by the certificate manager", kind, name, "fields", fields)
+	return apply(true)
+}
+
+// conflictingFields returns the fields of the field manager conflicts of err and whether all of them are in paths
+func conflictingFields(err error, paths sets.String) ([]string, bool) {
+	status, ok := err.(errors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return nil, false
+	}
+
+	var fields []string
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		if !paths.Has(cause.Field) {
+			return nil, false
+		}
+		fields = append(fields, cause.Field)
+	}
+	return fields, len(fields) > 0
+}
+
+// leftoverPointers returns the JSON pointers the object still has
+func leftoverPointers(obj interface{}, pointers []string) []string {
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	var content interface{}
+	raw, err := json.Marshal(obj)
+	if err != nil || json.Unmarshal(raw, &content) != nil {
+		return pointers
+	}
+
+	var leftovers []string
+	for _, pointer := range pointers {
+		if hasJSONPointer(content, pointer) {
+			leftovers = append(leftovers, pointer)
+		}
+	}
+	return leftovers
+}
+
+func hasJSONPointer(content interface{}, pointer string) bool {
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		object, ok := content.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if content, ok = object[unescapeJSONPointer(token)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func removePatch(pointers []string) ([]byte, error) {
+	var ops []map[string]interface{}
+	for _, pointer := range pointers {
+		ops = append(ops, map[string]interface{}{"op": "remove", "path": pointer})
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the removal of %v: %w", pointers, err)
+	}
+	return patch, nil
+}
+
+func escapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
@@ -0,0 +1,279 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+type fakeClientset interface {
+	PrependReactor(verb, resource string, reaction testingclient.ReactionFunc)
+	Tracker() testingclient.ObjectTracker
+}
+
+// addApplyReactor makes the server-side applies of a fake clientset drop the map keys the previous
+// apply sent and this one doesn't, unless someone else changed them since. The object tracker
+// merges applies like strategic merge patches but never removes anything.
+func addApplyReactor(client interface{}) {
+	f, ok := client.(fakeClientset)
+	if !ok {
+		return
+	}
+
+	var lock sync.Mutex
+	applied := map[string]map[string]interface{}{}
+	f.PrependReactor("patch", "*", func(action testingclient.Action) (bool, runtime.Object, error) {
+		patchAction, ok := action.(testingclient.PatchActionImpl)
+		if !ok || patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		var patch map[string]interface{}
+		if err := json.Unmarshal(patchAction.GetPatch(), &patch); err != nil {
+			return true, nil, err
+		}
+		sent := map[string]interface{}{}
+		collectLeaves(nil, patch, sent)
+
+		obj, err := f.Tracker().Get(patchAction.GetResource(), patchAction.GetNamespace(), patchAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		var current map[string]interface{}
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return true, nil, err
+		}
+
+		key := patchAction.GetResource().String() + "/" + patchAction.GetNamespace() + "/" + patchAction.GetName()
+		for path, value := range applied[key] {
+			if _, ok := sent[path]; ok {
+				continue
+			}
+			segments := strings.Split(path, "\x00")
+			if reflect.DeepEqual(lookupLeaf(current, segments), value) {
+				setLeaf(patch, segments, nil)
+			}
+		}
+
+		modified, err := json.Marshal(patch)
+		if err != nil {
+			return true, nil, err
+		}
+		patchAction.Patch = modified
+		handled, result, err := testingclient.ObjectReaction(f.Tracker())(patchAction)
+		if err == nil {
+			applied[key] = sent
+		}
+		return handled, result, err
+	})
+}
+
+// collectLeaves collects the values of the nested maps by path, lists aren't descended into
+func collectLeaves(prefix []string, obj map[string]interface{}, into map[string]interface{}) {
+	for k, v := range obj {
+		path := append(append([]string{}, prefix...), k)
+		if m, ok := v.(map[string]interface{}); ok {
+			collectLeaves(path, m, into)
+			continue
+		}
+		if _, ok := v.([]interface{}); ok {
+			continue
+		}
+		into[strings.Join(path, "\x00")] = v
+	}
+}
+
+func lookupLeaf(obj map[string]interface{}, segments []string) interface{} {
+	var current interface{} = obj
+	for _, segment := range segments {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[segment]
+	}
+	return current
+}
+
+func setLeaf(obj map[string]interface{}, segments []string, value interface{}) {
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := obj[segment].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			obj[segment] = next
+		}
+		obj = next
+	}
+	obj[segments[len(segments)-1]] = value
+}
+
+var _ = Describe("server-side apply tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		foreignAnn = "example.com/note"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// another writer annotates the secret with a full update
+	annotate := func(name string) {
+		secret := getSecret(name)
+		secret.Annotations[foreignAnn] = "keep me"
+		secret.Data["example.pem"] = []byte("foreign")
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	appliedPatches := func() []string {
+		var patches []string
+		for _, action := range client.Actions() {
+			if patch, ok := action.(testingclient.PatchActionImpl); ok && patch.GetPatchType() == types.ApplyPatchType {
+				patches = append(patches, string(patch.GetPatch()))
+			}
+		}
+		return patches
+	}
+
+	It("should keep the annotations of concurrent writers", func() {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		target := certs[0].TargetSecret.Name
+		annotate(target)
+		waitForSecretInLister(cm, getSecret(target))
+		client.ClearActions()
+
+		certs[0].TargetConfig.Lifetime = 12 * time.Hour
+		certs[0].TargetConfig.Refresh = 6 * time.Hour
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		secret := getSecret(target)
+		Expect(secret.Annotations[annCertConfig]).To(Equal(toSerializedCertConfig(12*time.Hour, 6*time.Hour)))
+		Expect(secret.Annotations).To(HaveKeyWithValue(foreignAnn, "keep me"))
+		Expect(secret.Data).To(HaveKeyWithValue("example.pem", []byte("foreign")))
+		// the applies don't even carry the fields of the other writer
+		Expect(appliedPatches()).ToNot(BeEmpty())
+		for _, patch := range appliedPatches() {
+			Expect(patch).ToNot(ContainSubstring(foreignAnn))
+			Expect(patch).ToNot(ContainSubstring("example.pem"))
+		}
+	})
+
+	It("should remove the owned fields it no longer applies and leave the others", func() {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].OutputFormats = []cert.OutputFormat{cert.OutputFormatCombinedPEM}
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		target := certs[0].TargetSecret.Name
+		Expect(getSecret(target).Data).To(HaveKey(combinedPEMKey))
+		annotate(target)
+		waitForSecretInLister(cm, getSecret(target))
+
+		certs[0].OutputFormats = nil
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		secret := getSecret(target)
+		Expect(secret.Data).ToNot(HaveKey(combinedPEMKey))
+		Expect(secret.Data).To(HaveKey("example.pem"))
+		Expect(secret.Annotations).To(HaveKey(foreignAnn))
+	})
+
+	Context("conflicts", func() {
+		var (
+			current *corev1.Secret
+			applies int
+		)
+
+		conflictOn := func(field string) {
+			client.PrependReactor("patch", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+				if action.(testingclient.PatchActionImpl).GetPatchType() != types.ApplyPatchType {
+					return false, nil, nil
+				}
+				applies++
+				if applies > 1 {
+					return false, nil, nil
+				}
+				return true, nil, errors.NewApplyConflict([]metav1.StatusCause{{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Field:   field,
+					Message: `conflict with "kubectl-edit"`,
+				}}, "Apply failed with 1 conflict")
+			})
+		}
+
+		BeforeEach(func() {
+			applies = 0
+			var err error
+			current, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "target", Annotations: map[string]string{annCertConfig: "old"}},
+			}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		updated := func() *corev1.Secret {
+			updated := current.DeepCopy()
+			updated.Annotations[annCertConfig] = "new"
+			return updated
+		}
+
+		It("should force the apply of owned fields", func() {
+			conflictOn(".metadata.annotations." + annCertConfig)
+
+			Expect(cm.applySecret(context.TODO(), current, updated())).To(HaveField("Annotations", HaveKeyWithValue(annCertConfig, "new")))
+			Expect(applies).To(Equal(2))
+		})
+
+		It("should not force conflicts on fields it doesn't apply", func() {
+			conflictOn(".metadata.annotations." + foreignAnn)
+
+			_, err := cm.applySecret(context.TODO(), current, updated())
+			Expect(errors.IsConflict(err)).To(BeTrue())
+			Expect(applies).To(Equal(1))
+			Expect(getSecret("target").Annotations[annCertConfig]).To(Equal("old"))
+		})
+	})
+})
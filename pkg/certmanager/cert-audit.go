@@ -0,0 +1,297 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// CertCheck is the audit of an object of a certificate definition
+type CertCheck struct {
+	Ref  corev1.ObjectReference `json:"ref"`
+	Role ManagedCertRole        `json:"role"`
+	// of the certificate, the newest CA for a bundle
+	IssuerCN string       `json:"issuerCN,omitempty"`
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// whether the target, or the signer without a target, chains to the bundle, unset when the chain
+	// isn't checked
+	ChainsToBundle *bool `json:"chainsToBundle,omitempty"`
+	// why the checks of the object failed, empty when they passed
+	Problems []string `json:"problems,omitempty"`
+}
+
+// CertAudit is the report of the check-certs command
+type CertAudit struct {
+	Checks []CertCheck `json:"checks"`
+}
+
+// Failed reports whether a check of the audit failed
+func (a *CertAudit) Failed() bool {
+	for _, check := range a.Checks {
+		if len(check.Problems) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable writes the audit as a table, one object per line
+func (a *CertAudit) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "OBJECT\tROLE\tISSUER\tEXPIRES\tCHAIN\tSTATUS")
+	for _, check := range a.Checks {
+		object := check.Ref.Kind + "/" + check.Ref.Name
+		if check.Ref.Namespace != "" {
+			object = check.Ref.Kind + "/" + check.Ref.Namespace + "/" + check.Ref.Name
+		}
+		expires, chain, status := "-", "-", "OK"
+		if check.NotAfter != nil {
+			expires = check.NotAfter.UTC().Format(time.RFC3339)
+		}
+		if check.ChainsToBundle != nil {
+			chain = fmt.Sprint(*check.ChainsToBundle)
+		}
+		if len(check.Problems) > 0 {
+			status = strings.Join(check.Problems, "; ")
+		}
+		issuer := check.IssuerCN
+		if issuer == "" {
+			issuer = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", object, check.Role, issuer, expires, chain, status)
+	}
+	return w.Flush()
+}
+
+// certAuditor checks the objects of the definitions with the checks of the cert manager, read through a
+// reader of a cluster or of a dump
+type certAuditor struct {
+	reader     client.Reader
+	now        time.Time
+	parseCache *certParseCache
+}
+
+// AuditCertificates audits the certificates of the definitions as of now: their expiry, whether they
+// chain to the published bundle, whether the caBundle of the consumers is the bundle and whether the
+// config annotations match the definitions. The objects of the guest cluster are not audited.
+func AuditCertificates(ctx context.Context, reader client.Reader, certs []mpcerts.CertificateDefinition, now time.Time) (*CertAudit, error) {
+	a := &certAuditor{reader: reader, now: now, parseCache: newCertParseCache()}
+	audit := &CertAudit{}
+	for _, cd := range certs {
+		checks, err := a.auditDefinition(ctx, cd)
+		if err != nil {
+			return nil, err
+		}
+		audit.Checks = append(audit.Checks, checks...)
+	}
+	return audit, nil
+}
+
+func (a *certAuditor) auditDefinition(ctx context.Context, cd mpcerts.CertificateDefinition) ([]CertCheck, error) {
+	var checks []CertCheck
+	parsed := map[ManagedCertRole]*parsedCerts{}
+	// the index of the check of the object the chain is reported on
+	chainCheck := -1
+	for _, object := range managedObjectsOf(cd) {
+		if object.Cluster == mpcerts.GuestCluster {
+			continue
+		}
+		check := CertCheck{Ref: object.Ref, Role: object.Role}
+		certs, err := a.inspect(ctx, cd, &check)
+		if err != nil {
+			return nil, err
+		}
+		parsed[object.Role] = certs
+		if object.Role != ManagedCertRoleBundle && (chainCheck < 0 || object.Role == ManagedCertRoleTarget) {
+			chainCheck = len(checks)
+		}
+		checks = append(checks, check)
+	}
+
+	signer, target, bundle := parsed[ManagedCertRoleSigner], parsed[ManagedCertRoleTarget], parsed[ManagedCertRoleBundle]
+	if bundle == nil {
+		return checks, nil
+	}
+	// the chains of the built-in signer, the way verifyChains checks them
+	if signer != nil && (target != nil || cd.TargetSecret == nil) && chainCheck >= 0 {
+		problem := chainProblemOf(signer.certs[0], bundle.certs, target, nil)
+		chains := problem == nil
+		checks[chainCheck].ChainsToBundle = &chains
+		if problem != nil {
+			checks[chainCheck].Problems = append(checks[chainCheck].Problems, problem.String())
+		}
+	}
+
+	if cd.ConsumerCluster == mpcerts.GuestCluster {
+		return checks, nil
+	}
+	caBundle, err := crypto.EncodeCertificates(bundle.certs...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cd.MutatingWebhookConfigurations {
+		check, err := a.auditWebhookConfiguration(ctx, name, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		if check != nil {
+			checks = append(checks, *check)
+		}
+	}
+	for _, name := range cd.ConversionCRDs {
+		check, err := a.auditConversionCRD(ctx, name, caBundle)
+		if err != nil {
+			return nil, err
+		}
+		if check != nil {
+			checks = append(checks, *check)
+		}
+	}
+	return checks, nil
+}
+
+// inspect reads and checks a signer, target or bundle, it returns its certificates if they parse
+func (a *certAuditor) inspect(ctx context.Context, cd mpcerts.CertificateDefinition, check *CertCheck) (*parsedCerts, error) {
+	key := client.ObjectKey{Namespace: check.Ref.Namespace, Name: check.Ref.Name}
+	if check.Role == ManagedCertRoleBundle {
+		configMap := &corev1.ConfigMap{}
+		if err := a.reader.Get(ctx, key, configMap); err != nil {
+			if errors.IsNotFound(err) {
+				check.Problems = append(check.Problems, "not found")
+				return nil, nil
+			}
+			return nil, err
+		}
+		parsed, err := a.parseCache.parseCerts(configMap, selfManagedBundleKey)
+		if err != nil {
+			check.Problems = append(check.Problems, fmt.Sprintf("the bundle can't be parsed: %v", err))
+			return nil, nil
+		}
+		newest := newestCert(parsed.certs)
+		check.IssuerCN = newest.Issuer.CommonName
+		check.NotAfter = &metav1.Time{Time: newest.NotAfter}
+		valid := false
+		for _, ca := range parsed.certs {
+			valid = valid || a.now.Before(ca.NotAfter)
+		}
+		if !valid {
+			check.Problems = append(check.Problems, "every CA of the bundle expired")
+		}
+		return parsed, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := a.reader.Get(ctx, key, secret); err != nil {
+		if errors.IsNotFound(err) {
+			check.Problems = append(check.Problems, "not found")
+			return nil, nil
+		}
+		return nil, err
+	}
+	parsed, err := a.parseCache.parseCerts(secret, corev1.TLSCertKey)
+	if err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("the certificate can't be parsed: %v", err))
+		return nil, nil
+	}
+	check.IssuerCN = parsed.certs[0].Issuer.CommonName
+	check.NotAfter = &metav1.Time{Time: parsed.notAfter}
+	if !a.now.Before(parsed.notAfter) {
+		check.Problems = append(check.Problems, fmt.Sprintf("expired at %s", parsed.notAfter.UTC().Format(time.RFC3339)))
+	}
+
+	// the certificates of an issuer or of the user don't carry the config of the definition
+	if cd.Issuer == nil && !cd.External {
+		scc := newSerializedCertConfig(cd.SignerConfig)
+		if check.Role == ManagedCertRoleTarget {
+			scc = targetCertConfig(cd)
+		}
+		problem, err := certConfigProblem(secret, scc)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			check.Problems = append(check.Problems, problem)
+		}
+	}
+	return parsed, nil
+}
+
+// certConfigProblem returns why the config annotation of the secret doesn't match the config, a secret
+// without the annotation is adopted by the next sync
+func certConfigProblem(secret *corev1.Secret, scc *serializedCertConfig) (string, error) {
+	annotation, ok := secret.Annotations[annCertConfig]
+	if !ok {
+		return "", nil
+	}
+	desired, err := json.Marshal(scc)
+	if err != nil {
+		return "", err
+	}
+	// compared the way ensureCertConfig does
+	current, err := canonicalCertConfig(annotation)
+	if err != nil {
+		return fmt.Sprintf("the %s annotation is invalid: %v", annCertConfig, err), nil
+	}
+	if current != string(desired) {
+		return fmt.Sprintf("the %s annotation %s doesn't match the definition %s", annCertConfig, annotation, desired), nil
+	}
+	return "", nil
+}
+
+func (a *certAuditor) auditWebhookConfiguration(ctx context.Context, name string, caBundle []byte) (*CertCheck, error) {
+	config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := a.reader.Get(ctx, client.ObjectKey{Name: name}, config); err != nil {
+		// the webhook is only created once the controller is ready
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	check := &CertCheck{
+		Ref:  corev1.ObjectReference{Kind: "MutatingWebhookConfiguration", Name: name},
+		Role: ManagedCertRoleConsumer,
+	}
+	for _, webhook := range config.Webhooks {
+		if !caBundleUpToDate(webhook.ClientConfig.CABundle, caBundle) {
+			check.Problems = append(check.Problems, fmt.Sprintf("the caBundle of webhook %s doesn't match the bundle", webhook.Name))
+		}
+	}
+	return check, nil
+}
+
+func (a *certAuditor) auditConversionCRD(ctx context.Context, name string, caBundle []byte) (*CertCheck, error) {
+	crd := &extv1.CustomResourceDefinition{}
+	if err := a.reader.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	conversion := crd.Spec.Conversion
+	if conversion == nil || conversion.Strategy != extv1.WebhookConverter ||
+		conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+		return nil, nil
+	}
+	check := &CertCheck{
+		Ref:  corev1.ObjectReference{Kind: "CustomResourceDefinition", Name: name},
+		Role: ManagedCertRoleConsumer,
+	}
+	if !caBundleUpToDate(conversion.Webhook.ClientConfig.CABundle, caBundle) {
+		check.Problems = append(check.Problems, "the caBundle of the conversion webhook doesn't match the bundle")
+	}
+	return check, nil
+}
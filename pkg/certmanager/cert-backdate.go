@@ -0,0 +1,106 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// backdatingSecretsGetter re-signs the certificates library-go issues through it with their NotBefore
+// moved backdate into the past. library-go hardcodes the NotBefore of the signer and the target, and
+// sets its annotations from the certificate, so the certificate is re-signed before the write and the
+// annotations are left alone: the refresh and expiry keep following the actual issuance.
+type backdatingSecretsGetter struct {
+	corev1client.SecretsGetter
+	backdate time.Duration
+	// the signer of the target, nil for the self-signed signer
+	signer *crypto.CA
+}
+
+// backdatingClient returns the client as is without a backdate
+func backdatingClient(client corev1client.SecretsGetter, backdate time.Duration, signer *crypto.CA) corev1client.SecretsGetter {
+	if backdate <= 0 {
+		return client
+	}
+	return &backdatingSecretsGetter{SecretsGetter: client, backdate: backdate, signer: signer}
+}
+
+func (g *backdatingSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &backdatingSecrets{
+		SecretInterface: g.SecretsGetter.Secrets(namespace),
+		getter:          g,
+	}
+}
+
+type backdatingSecrets struct {
+	corev1client.SecretInterface
+	getter *backdatingSecretsGetter
+}
+
+func (s *backdatingSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	secret, err := s.getter.backdated(secret)
+	if err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Create(ctx, secret, opts)
+}
+
+func (s *backdatingSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	secret, err := s.getter.backdated(secret)
+	if err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Update(ctx, secret, opts)
+}
+
+// backdated returns a copy of the secret with its certificate re-signed with the backdated NotBefore,
+// the secret itself unless library-go just issued the certificate, i.e. its NotBefore is still the
+// one of the annotation
+func (g *backdatingSecretsGetter) backdated(secret *corev1.Secret) (*corev1.Secret, error) {
+	certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil || len(certs) == 0 {
+		return secret, nil
+	}
+	leaf := certs[0]
+	notBefore, err := time.Parse(time.RFC3339, secret.Annotations[certrotation.CertificateNotBeforeAnnotation])
+	if err != nil || !notBefore.Equal(leaf.NotBefore) {
+		return secret, nil
+	}
+
+	signer := g.signer
+	if signer == nil {
+		if signer, err = crypto.GetCAFromBytes(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+			return nil, err
+		}
+	}
+
+	template := *leaf
+	template.NotBefore = leaf.NotBefore.Add(-g.backdate)
+	parent := signer.Config.Certs[0]
+	if g.signer == nil {
+		parent = &template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, leaf.PublicKey, signer.Config.Key)
+	if err != nil {
+		return nil, err
+	}
+	backdated, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := crypto.EncodeCertificates(append([]*x509.Certificate{backdated}, certs[1:]...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[corev1.TLSCertKey] = certPEM
+	return secret, nil
+}
@@ -0,0 +1,121 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate backdating", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+		backdate   = 10 * time.Minute
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	backdatedCerts := func(backdate time.Duration) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].SignerConfig.Backdate = backdate
+			certs[i].TargetConfig.Backdate = backdate
+		}
+		return certs
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	certOf := func(secret *corev1.Secret) *x509.Certificate {
+		certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certs[0]
+	}
+
+	annotatedTime := func(secret *corev1.Secret, annotation string) time.Time {
+		t, err := time.Parse(time.RFC3339, secret.Annotations[annotation])
+		Expect(err).ToNot(HaveOccurred())
+		return t
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should move the NotBefore of the signer and the target into the past", func() {
+		Expect(cm.Sync(context.TODO(), backdatedCerts(backdate))).To(Succeed())
+
+		for _, name := range []string{signerName, util.SecretResourceName} {
+			secret := getSecret(name)
+			c := certOf(secret)
+			// the annotations keep the actual issuance the refresh follows
+			Expect(c.NotBefore).To(BeTemporally("==", annotatedTime(secret, certrotation.CertificateNotBeforeAnnotation).Add(-backdate)))
+			Expect(c.NotAfter).To(BeTemporally("==", annotatedTime(secret, certrotation.CertificateNotAfterAnnotation)))
+			Expect(c.NotBefore).To(BeTemporally("<", time.Now().Add(-backdate+time.Minute)))
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(certOf(getSecret(signerName)))
+		_, err := certOf(getSecret(util.SecretResourceName)).Verify(x509.VerifyOptions{
+			Roots:       roots,
+			CurrentTime: time.Now().Add(-backdate + time.Minute),
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should not re-sign a certificate it didn't just issue", func() {
+		Expect(cm.Sync(context.TODO(), backdatedCerts(backdate))).To(Succeed())
+		before := certOf(getSecret(util.SecretResourceName))
+
+		Expect(cm.Sync(context.TODO(), backdatedCerts(backdate))).To(Succeed())
+		Expect(certOf(getSecret(util.SecretResourceName)).Equal(before)).To(BeTrue())
+	})
+
+	It("should re-issue the certificates when the backdate changes", func() {
+		Expect(cm.Sync(context.TODO(), backdatedCerts(0))).To(Succeed())
+		signer, target := getSecret(signerName), getSecret(util.SecretResourceName)
+		Expect(signer.Annotations[annCertConfig]).ToNot(ContainSubstring("backdate"))
+		Expect(certOf(target).NotBefore).To(BeTemporally("==", annotatedTime(target, certrotation.CertificateNotBeforeAnnotation)))
+
+		Expect(cm.Sync(context.TODO(), backdatedCerts(backdate))).To(Succeed())
+		for _, previous := range []*corev1.Secret{signer, target} {
+			secret := getSecret(previous.Name)
+			Expect(certOf(secret).SerialNumber).ToNot(Equal(certOf(previous).SerialNumber))
+			Expect(secret.Annotations[annCertConfig]).To(ContainSubstring(`"backdate":"` + cert.FormatDuration(backdate) + `"`))
+			Expect(certOf(secret).NotBefore).To(BeTemporally("==", annotatedTime(secret, certrotation.CertificateNotBeforeAnnotation).Add(-backdate)))
+		}
+	})
+
+	It("should refuse a backdate longer than the maximum", func() {
+		Expect(cm.Sync(context.TODO(), backdatedCerts(cert.MaxBackdate+time.Second))).To(MatchError(cert.ErrInvalidDefinition))
+		Expect(cm.Sync(context.TODO(), backdatedCerts(-time.Second))).To(MatchError(cert.ErrInvalidDefinition))
+	})
+})
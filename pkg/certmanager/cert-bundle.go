@@ -0,0 +1,462 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	applyadmissionregistrationv1 "k8s.io/client-go/applyconfigurations/admissionregistration/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// selfManagedBundleKey is the configmap key the self managed signer publishes its CA bundle into
+	selfManagedBundleKey = mpcerts.CABundleKey
+
+	// annBundleCopies records the additional key and copies of the bundle, so they can be
+	// cleaned up once they are removed from the definition
+	annBundleCopies = "operator.maroonedpods.io/bundleCopies"
+	// annBundleCopyOf marks the configmaps the operator created as copy of a bundle
+	annBundleCopyOf = "operator.maroonedpods.io/bundleCopyOf"
+)
+
+type bundleCopiesState struct {
+	Key    string   `json:"key,omitempty"`
+	Copies []string `json:"copies,omitempty"`
+}
+
+// propagateBundle writes the CA bundle of the definition into the objects trusting it, so they
+// don't have to wait for the next full reconcile after a CA rotation
+func (cm *certManager) propagateBundle(ctx context.Context, cd mpcerts.CertificateDefinition, bundle []*x509.Certificate) error {
+	if len(bundle) == 0 {
+		return nil
+	}
+
+	caBundle, err := crypto.EncodeCertificates(bundle...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if cd.CertBundleConfigmap != nil {
+		errs = append(errs, cm.retryPropagation(cd.BundleCluster, "the configmap copies of "+cd.CertBundleConfigmap.Name, func() error {
+			return cm.syncBundleCopies(cd)
+		}))
+	}
+
+	for _, name := range cd.MutatingWebhookConfigurations {
+		errs = append(errs, cm.retryPropagation(cd.ConsumerCluster, "mutatingwebhookconfiguration "+name, func() error {
+			return cm.updateMutatingWebhookCABundle(cd.ConsumerCluster, name, caBundle)
+		}))
+	}
+
+	for _, name := range cd.ConversionCRDs {
+		errs = append(errs, cm.retryPropagation(cd.ConsumerCluster, "customresourcedefinition "+name, func() error {
+			return cm.updateConversionCABundle(cd.ConsumerCluster, name, caBundle)
+		}))
+	}
+
+	for _, name := range cd.APIServices {
+		errs = append(errs, cm.retryPropagation(mpcerts.ManagementCluster, "apiservice "+name, func() error {
+			return cm.updateAPIServiceCABundle(name, caBundle)
+		}))
+	}
+
+	if cd.PublishClusterTrustBundle {
+		errs = append(errs, cm.retryPropagation(cd.BundleCluster, "clustertrustbundle "+clusterTrustBundleName(cd), func() error {
+			return cm.publishClusterTrustBundle(cd, bundle)
+		}))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// ensureCAInBundle makes sure the bundle configmap contains the certificate of the CA, library-go
+// decides from the lister copy, which may not have seen an edit removing it yet. The CA is appended,
+// the other entries of the bundle, e.g. CAs added by users, are left alone. It returns the bundle.
+func (cm *certManager) ensureCAInBundle(ctx context.Context, cluster mpcerts.Cluster, namespace, name string, ca *crypto.CA) ([]*x509.Certificate, error) {
+	configMap, err := cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := cm.parseCerts(configMap, selfManagedBundleKey)
+	if err != nil {
+		return nil, err
+	}
+	if containsCert(parsed.certs, ca.Config.Certs[0]) {
+		return parsed.certs, nil
+	}
+
+	caPEM, err := crypto.EncodeCertificates(ca.Config.Certs[0])
+	if err != nil {
+		return nil, err
+	}
+	caBundle := configMap.Data[selfManagedBundleKey]
+	if caBundle != "" && caBundle[len(caBundle)-1] != '\n' {
+		caBundle += "\n"
+	}
+	configMap = configMap.DeepCopy()
+	configMap.Data[selfManagedBundleKey] = caBundle + string(caPEM)
+	if _, err := cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+
+	log.Info("Restored the current CA in the bundle", "configmap", name, "namespace", namespace)
+	cm.recorder(cluster).Warningf("CABundleRepaired", "The current CA was missing from configmap %s/%s, restored it", namespace, name)
+	certBundleRepairs.WithLabelValues(namespace, name).Inc()
+	return append(parsed.certs, ca.Config.Certs[0]), nil
+}
+
+func (cm *certManager) retryPropagation(cluster mpcerts.Cluster, target string, update func() error) error {
+	if err := retry.OnError(retry.DefaultBackoff, isRetriableBundleError, update); err != nil {
+		cm.recorder(cluster).Warningf("CABundlePropagationFailed", "Failed to update the CA bundle of %s: %v", target, err)
+		return fmt.Errorf("failed to update the CA bundle of %s: %w", target, err)
+	}
+	return nil
+}
+
+// syncBundleCopies publishes the bundle under the additional key of the definition and copies it
+// into the extra configmaps, what was published for a previous definition is cleaned up
+func (cm *certManager) syncBundleCopies(cd mpcerts.CertificateDefinition) error {
+	bundleConfigMap := cd.CertBundleConfigmap
+	client := cm.kubeClient(cd.BundleCluster).CoreV1().ConfigMaps(bundleConfigMap.Namespace)
+
+	replicas, err := cm.bundleReplicas(cd)
+	if err != nil {
+		return err
+	}
+	copies := append(append([]types.NamespacedName{}, cd.BundleCopies...), replicas...)
+
+	desired := bundleCopiesState{Key: cd.BundleAdditionalKey}
+	for _, nn := range copies {
+		desired.Copies = append(desired.Copies, nn.String())
+	}
+
+	if desired.Key == "" && len(desired.Copies) == 0 {
+		// nothing to clean up either, avoid the uncached read
+		if listers, ok := cm.listers()[clusterNamespace{cluster: cd.BundleCluster, namespace: bundleConfigMap.Namespace}]; ok {
+			cached, err := listers.configMapLister.ConfigMaps(bundleConfigMap.Namespace).Get(bundleConfigMap.Name)
+			if err == nil && cached.Annotations[annBundleCopies] == "" {
+				return nil
+			}
+		}
+	}
+
+	// read the latest bundle so the copies are identical to it
+	primary, err := client.Get(context.TODO(), bundleConfigMap.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	caBundle, ok := primary.Data[selfManagedBundleKey]
+	if !ok {
+		return nil
+	}
+
+	var previous bundleCopiesState
+	if ann := primary.Annotations[annBundleCopies]; ann != "" {
+		if err := json.Unmarshal([]byte(ann), &previous); err != nil {
+			log.Info("Ignoring invalid bundle copies annotation", "configmap", bundleConfigMap.Name, "error", err.Error())
+		}
+	}
+
+	owner := types.NamespacedName{Namespace: primary.Namespace, Name: primary.Name}.String()
+	for _, nn := range cd.BundleCopies {
+		if err := cm.ensureBundleCopy(cd.BundleCluster, nn, owner, caBundle, desired.Key, previous.Key); err != nil {
+			return err
+		}
+	}
+	for _, nn := range replicas {
+		err := cm.ensureBundleCopy(cd.BundleCluster, nn, owner, caBundle, desired.Key, previous.Key)
+		if isGoneError(err) {
+			// the namespace is gone or being deleted, it takes the replica with it
+			log.V(1).Info("Skipping the bundle replica of a missing namespace", "namespace", nn.Namespace)
+			desired.Copies = removeString(desired.Copies, nn.String())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, copy := range previous.Copies {
+		if containsString(desired.Copies, copy) {
+			continue
+		}
+		if err := cm.removeBundleCopy(cd.BundleCluster, copy, owner, previous.Key); err != nil {
+			return err
+		}
+	}
+
+	updated := primary.DeepCopy()
+	if previous.Key != "" && previous.Key != desired.Key && previous.Key != selfManagedBundleKey {
+		delete(updated.Data, previous.Key)
+	}
+	if desired.Key != "" {
+		updated.Data[desired.Key] = caBundle
+	}
+	if desired.Key == "" && len(desired.Copies) == 0 {
+		delete(updated.Annotations, annBundleCopies)
+	} else {
+		stateBytes, err := json.Marshal(desired)
+		if err != nil {
+			return err
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annBundleCopies] = string(stateBytes)
+	}
+
+	if !configMapChanged(primary, updated) {
+		return nil
+	}
+
+	_, err = cm.applyConfigMap(cd.BundleCluster, primary, updated)
+	return err
+}
+
+func (cm *certManager) ensureBundleCopy(cluster mpcerts.Cluster, nn types.NamespacedName, owner, caBundle, key, previousKey string) error {
+	client := cm.kubeClient(cluster).CoreV1().ConfigMaps(nn.Namespace)
+	copy, err := client.Get(context.TODO(), nn.Name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		copy = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   nn.Namespace,
+				Name:        nn.Name,
+				Labels:      util.ResourceBuilder.WithCommonLabels(nil),
+				Annotations: map[string]string{annBundleCopyOf: owner},
+			},
+			Data: map[string]string{selfManagedBundleKey: caBundle},
+		}
+		if key != "" {
+			copy.Data[key] = caBundle
+		}
+
+		_, err = client.Create(context.TODO(), copy, metav1.CreateOptions{})
+		return err
+	}
+
+	updated := copy.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string]string{}
+	}
+	if previousKey != "" && previousKey != key && previousKey != selfManagedBundleKey {
+		delete(updated.Data, previousKey)
+	}
+	updated.Data[selfManagedBundleKey] = caBundle
+	if key != "" {
+		updated.Data[key] = caBundle
+	}
+
+	if !configMapChanged(copy, updated) {
+		return nil
+	}
+
+	// the copy may be a configmap of someone else, only the bundle keys are applied
+	_, err = cm.applyConfigMap(cluster, copy, updated, selfManagedBundleKey, key, previousKey)
+	return err
+}
+
+// removeBundleCopy deletes a copy created by the operator, a configmap that existed before only
+// loses the bundle keys
+func (cm *certManager) removeBundleCopy(cluster mpcerts.Cluster, name, owner, key string) error {
+	namespace, name, err := toolscache.SplitMetaNamespaceKey(name)
+	if err != nil {
+		return err
+	}
+
+	client := cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace)
+	copy, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if copy.Annotations[annBundleCopyOf] == owner {
+		if err := client.Delete(context.TODO(), name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	updated := copy.DeepCopy()
+	delete(updated.Data, selfManagedBundleKey)
+	if key != "" {
+		delete(updated.Data, key)
+	}
+	if !configMapChanged(copy, updated) {
+		return nil
+	}
+
+	_, err = cm.applyConfigMap(cluster, copy, updated, selfManagedBundleKey, key)
+	return err
+}
+
+// bundleReplicas returns the copies of the bundle in the replica namespaces of the definition, named
+// as the bundle. The selector is evaluated against the namespaces as they are now.
+func (cm *certManager) bundleReplicas(cd mpcerts.CertificateDefinition) ([]types.NamespacedName, error) {
+	namespaces := sets.NewString(cd.BundleReplicaNamespaces...)
+	if cd.BundleReplicaNamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(cd.BundleReplicaNamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		list, err := cm.kubeClient(cd.BundleCluster).CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the bundle replica namespaces: %w", err)
+		}
+		for _, namespace := range list.Items {
+			if namespace.Status.Phase != corev1.NamespaceTerminating {
+				namespaces.Insert(namespace.Name)
+			}
+		}
+	}
+	namespaces.Delete(cd.CertBundleConfigmap.Namespace)
+
+	var replicas []types.NamespacedName
+	for _, namespace := range namespaces.List() {
+		replicas = append(replicas, types.NamespacedName{Namespace: namespace, Name: cd.CertBundleConfigmap.Name})
+	}
+	return replicas, nil
+}
+
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// updateConversionCABundle applies only the caBundle of the conversion webhook, CRD updates are expensive
+// so nothing is sent when it is up to date or the CRD doesn't use a conversion webhook
+func (cm *certManager) updateConversionCABundle(cluster mpcerts.Cluster, name string, caBundle []byte) error {
+	extClient := cm.apiextClient(cluster)
+	if extClient == nil {
+		return fmt.Errorf("no apiextensions client to update the conversion webhook of CRD %s", name)
+	}
+	client := extClient.ApiextensionsV1().CustomResourceDefinitions()
+	crd, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	conversion := crd.Spec.Conversion
+	if conversion == nil || conversion.Strategy != extv1.WebhookConverter ||
+		conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+		return nil
+	}
+
+	if caBundleUpToDate(conversion.Webhook.ClientConfig.CABundle, caBundle) {
+		return nil
+	}
+
+	// there is no apply configuration of CRDs, a strategy changed in the meantime fails the validation
+	patch, err := json.Marshal(map[string]interface{}{
+		"apiVersion": extv1.SchemeGroupVersion.String(),
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"conversion": map[string]interface{}{
+				"webhook": map[string]interface{}{
+					"clientConfig": map[string]interface{}{"caBundle": caBundle},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	paths := sets.NewString(".spec.conversion.webhook.clientConfig.caBundle")
+	return applyWithForceRetry("customresourcedefinition", name, paths, func(force bool) error {
+		_, err := client.Patch(context.TODO(), name, types.ApplyPatchType, patch, metav1.PatchOptions{FieldManager: certFieldManager, Force: &force})
+		return err
+	})
+}
+
+func (cm *certManager) updateMutatingWebhookCABundle(cluster mpcerts.Cluster, name string, caBundle []byte) error {
+	client := cm.kubeClient(cluster).AdmissionregistrationV1().MutatingWebhookConfigurations()
+	config, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		// the webhook is only created once the controller is ready
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	changed := false
+	apply := applyadmissionregistrationv1.MutatingWebhookConfiguration(name)
+	paths := sets.NewString()
+	for _, webhook := range config.Webhooks {
+		if !caBundleUpToDate(webhook.ClientConfig.CABundle, caBundle) {
+			changed = true
+		}
+		// every webhook is applied, a webhook left out would lose its caBundle once it is owned
+		apply.WithWebhooks(applyadmissionregistrationv1.MutatingWebhook().
+			WithName(webhook.Name).
+			WithClientConfig(applyadmissionregistrationv1.WebhookClientConfig().WithCABundle(caBundle...)))
+		paths.Insert(fmt.Sprintf(".webhooks[name=%q].clientConfig.caBundle", webhook.Name))
+	}
+	if !changed {
+		return nil
+	}
+
+	return applyWithForceRetry("mutatingwebhookconfiguration", name, paths, func(force bool) error {
+		_, err := client.Apply(context.TODO(), apply, metav1.ApplyOptions{FieldManager: certFieldManager, Force: force})
+		return err
+	})
+}
+
+// caBundleUpToDate reports whether the caBundle of a consumer is the bundle, a consumer is updated
+// unless it is byte for byte and check-certs reports the others
+func caBundleUpToDate(current, caBundle []byte) bool {
+	return bytes.Equal(current, caBundle)
+}
+
+func isRetriableBundleError(err error) bool {
+	return errors.IsConflict(err) ||
+		errors.IsServerTimeout(err) ||
+		errors.IsTimeout(err) ||
+		errors.IsTooManyRequests(err) ||
+		errors.IsInternalError(err)
+}
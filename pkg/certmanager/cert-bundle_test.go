@@ -0,0 +1,487 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	dto "github.com/prometheus/client_model/go"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("CA bundle propagation tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newMutatingWebhookConfiguration := func() *admissionregistrationv1.MutatingWebhookConfiguration {
+		return &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{
+				{Name: "first.maroonedpods.io", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: []byte("stale")}},
+				{Name: "second.maroonedpods.io"},
+			},
+		}
+	}
+
+	getBundle := func() []byte {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "maroonedpods-server-signer-bundle", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return []byte(configMap.Data["ca-bundle.crt"])
+	}
+
+	start := func(objs ...runtime.Object) {
+		client = fake.NewSimpleClientset(objs...)
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	}
+
+	// waits for the informers to catch up with the signer and the target before syncing again,
+	// a signer missing from the lister is issued again
+	waitForCerts := func(certs []cert.CertificateDefinition) {
+		for _, cd := range certs {
+			for _, c := range managedCertsOf(cd) {
+				secret, err := client.CoreV1().Secrets(c.secret.Namespace).Get(context.TODO(), c.secret.Name, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+		}
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should update every webhook of the mutating configuration", func() {
+		start(newMutatingWebhookConfiguration())
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+
+		config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), cluster.MutatingWebhookConfigurationName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		bundle := getBundle()
+		Expect(bundle).ToNot(BeEmpty())
+		Expect(config.Webhooks).To(HaveLen(2))
+		for _, webhook := range config.Webhooks {
+			Expect(webhook.ClientConfig.CABundle).To(Equal(bundle))
+		}
+	})
+
+	It("should tolerate a missing mutating configuration", func() {
+		start()
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+	})
+
+	It("should retry conflicts", func() {
+		start(newMutatingWebhookConfiguration())
+		conflicts := 2
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(testingclient.Action) (bool, runtime.Object, error) {
+			if conflicts == 0 {
+				return false, nil, nil
+			}
+			conflicts--
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "mutatingwebhookconfigurations"}, cluster.MutatingWebhookConfigurationName, nil)
+		})
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		Expect(conflicts).To(BeZero())
+	})
+
+	It("should report propagation failures", func() {
+		start(newMutatingWebhookConfiguration())
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(testingclient.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "mutatingwebhookconfigurations"}, cluster.MutatingWebhookConfigurationName, nil)
+		})
+
+		err := cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(cluster.MutatingWebhookConfigurationName))
+
+		// the certificates are still issued
+		Expect(getBundle()).ToNot(BeEmpty())
+	})
+
+	Context("conversion webhooks", func() {
+		var extClient *extfake.Clientset
+
+		newCRD := func(conversion *extv1.CustomResourceConversion) *extv1.CustomResourceDefinition {
+			return &extv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: util.MaroonedPodsCRDName},
+				Spec: extv1.CustomResourceDefinitionSpec{
+					Conversion: conversion,
+				},
+			}
+		}
+
+		webhookConversion := func(caBundle []byte) *extv1.CustomResourceConversion {
+			return &extv1.CustomResourceConversion{
+				Strategy: extv1.WebhookConverter,
+				Webhook: &extv1.WebhookConversion{
+					ClientConfig:             &extv1.WebhookClientConfig{CABundle: caBundle},
+					ConversionReviewVersions: []string{"v1"},
+				},
+			}
+		}
+
+		startWithCRDs := func(objs ...runtime.Object) {
+			start()
+			extClient = extfake.NewSimpleClientset(objs...)
+			cm.(*certManager).extClient = extClient
+		}
+
+		getCRD := func() *extv1.CustomResourceDefinition {
+			crd, err := extClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), util.MaroonedPodsCRDName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return crd
+		}
+
+		countPatches := func() int {
+			patches := 0
+			for _, action := range extClient.Actions() {
+				if action.GetVerb() == "patch" {
+					patches++
+				}
+			}
+			return patches
+		}
+
+		It("should set the rotated bundle on the conversion webhook", func() {
+			startWithCRDs(newCRD(webhookConversion([]byte("stale"))))
+
+			Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+
+			crd := getCRD()
+			Expect(crd.Spec.Conversion.Webhook.ClientConfig.CABundle).To(Equal(getBundle()))
+			Expect(crd.Spec.Conversion.Webhook.ConversionReviewVersions).To(Equal([]string{"v1"}))
+			Expect(countPatches()).To(Equal(1))
+		})
+
+		It("should not patch an up to date CRD", func() {
+			startWithCRDs(newCRD(webhookConversion([]byte("stale"))))
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			waitForCerts(certs)
+
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			Expect(countPatches()).To(Equal(1))
+		})
+
+		It("should tolerate CRDs without conversion webhook", func() {
+			startWithCRDs(newCRD(&extv1.CustomResourceConversion{Strategy: extv1.NoneConverter}))
+
+			Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+			Expect(countPatches()).To(BeZero())
+			Expect(getCRD().Spec.Conversion.Webhook).To(BeNil())
+		})
+
+		It("should tolerate a missing CRD", func() {
+			startWithCRDs()
+
+			Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+			Expect(countPatches()).To(BeZero())
+		})
+	})
+
+	Context("bundle copies", func() {
+		const (
+			bundleName = "maroonedpods-server-signer-bundle"
+			otherNS    = "consumer"
+		)
+
+		copyName := types.NamespacedName{Namespace: otherNS, Name: "maroonedpods-ca"}
+
+		newCerts := func(key string, copies ...types.NamespacedName) []cert.CertificateDefinition {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			for i := range certs {
+				if certs[i].CertBundleConfigmap != nil && certs[i].CertBundleConfigmap.Name == bundleName {
+					certs[i].BundleAdditionalKey = key
+					certs[i].BundleCopies = copies
+				}
+			}
+			return certs
+		}
+
+		getConfigMap := func(nn types.NamespacedName) (*corev1.ConfigMap, error) {
+			return client.CoreV1().ConfigMaps(nn.Namespace).Get(context.TODO(), nn.Name, metav1.GetOptions{})
+		}
+
+		It("should keep the additional key identical to the bundle across rotations", func() {
+			start()
+			certs := newCerts("service-ca.crt")
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+			bundle := getBundle()
+			configMap, err := getConfigMap(types.NamespacedName{Namespace: namespace, Name: bundleName})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data["service-ca.crt"]).To(Equal(string(bundle)))
+
+			// force a new CA
+			Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), certs[0].SignerSecret.Name, metav1.DeleteOptions{})).To(Succeed())
+			Eventually(func() bool {
+				_, err := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}].secretLister.Secrets(namespace).Get(certs[0].SignerSecret.Name)
+				return errors.IsNotFound(err)
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+			configMap, err = getConfigMap(types.NamespacedName{Namespace: namespace, Name: bundleName})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data["ca-bundle.crt"]).ToNot(Equal(string(bundle)))
+			Expect(configMap.Data["service-ca.crt"]).To(Equal(configMap.Data["ca-bundle.crt"]))
+		})
+
+		It("should copy the bundle into other configmaps", func() {
+			start()
+			Expect(cm.Sync(context.TODO(), newCerts("service-ca.crt", copyName))).To(Succeed())
+
+			copy, err := getConfigMap(copyName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(copy.Data).To(HaveKeyWithValue("ca-bundle.crt", string(getBundle())))
+			Expect(copy.Data).To(HaveKeyWithValue("service-ca.crt", string(getBundle())))
+		})
+
+		It("should not touch up to date copies", func() {
+			start()
+			certs := newCerts("", copyName)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			waitForCerts(certs)
+
+			client.ClearActions()
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			for _, action := range client.Actions() {
+				if action.GetResource().Resource == "configmaps" {
+					Expect(action.GetVerb()).To(Equal("get"))
+				}
+			}
+		})
+
+		It("should clean up when the options are removed", func() {
+			existingName := types.NamespacedName{Namespace: otherNS, Name: "existing"}
+			start(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: existingName.Namespace, Name: existingName.Name},
+				Data:       map[string]string{"other": "data"},
+			})
+			Expect(cm.Sync(context.TODO(), newCerts("service-ca.crt", copyName, existingName))).To(Succeed())
+			// the cleanup is skipped while the lister doesn't know about the copies
+			Eventually(func() bool {
+				cached, err := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(bundleName)
+				return err == nil && cached.Annotations[annBundleCopies] != ""
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+
+			Expect(cm.Sync(context.TODO(), newCerts(""))).To(Succeed())
+
+			_, err := getConfigMap(copyName)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			existing, err := getConfigMap(existingName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(existing.Data).To(Equal(map[string]string{"other": "data"}))
+
+			configMap, err := getConfigMap(types.NamespacedName{Namespace: namespace, Name: bundleName})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Data).ToNot(HaveKey("service-ca.crt"))
+			Expect(configMap.Data).To(HaveKey("ca-bundle.crt"))
+			Expect(configMap.Annotations).ToNot(HaveKey(annBundleCopies))
+		})
+
+		Context("replica namespaces", func() {
+			selector := &metav1.LabelSelector{MatchLabels: map[string]string{"maroonedpods.io/ca-bundle": "true"}}
+
+			newNamespace := func(name string, selected bool) *corev1.Namespace {
+				namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}}}
+				if selected {
+					namespace.Labels["maroonedpods.io/ca-bundle"] = "true"
+				}
+				return namespace
+			}
+
+			withReplicas := func(namespaces []string, selector *metav1.LabelSelector) []cert.CertificateDefinition {
+				certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{
+					Namespace:                      namespace,
+					BundleReplicaNamespaces:        namespaces,
+					BundleReplicaNamespaceSelector: selector,
+				})
+				Expect(certs[0].BundleReplicaNamespaceSelector).To(BeIdenticalTo(selector))
+				return certs
+			}
+
+			replica := func(namespace string) types.NamespacedName {
+				return types.NamespacedName{Namespace: namespace, Name: bundleName}
+			}
+
+			waitForCopiesInLister := func() {
+				Eventually(func() bool {
+					cached, err := cm.(*certManager).listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(bundleName)
+					return err == nil && cached.Annotations[annBundleCopies] != ""
+				}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+			}
+
+			It("should replicate the bundle into the listed and selected namespaces", func() {
+				start(newNamespace("selected", true), newNamespace("ignored", false))
+				Expect(cm.Sync(context.TODO(), withReplicas([]string{otherNS}, selector))).To(Succeed())
+
+				for _, ns := range []string{otherNS, "selected"} {
+					copy, err := getConfigMap(replica(ns))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(copy.Data).To(HaveKeyWithValue("ca-bundle.crt", string(getBundle())))
+					for key, value := range util.ResourceBuilder.WithCommonLabels(nil) {
+						Expect(copy.Labels).To(HaveKeyWithValue(key, value))
+					}
+				}
+				_, err := getConfigMap(replica("ignored"))
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			})
+
+			It("should propagate a rotated CA to the replicas", func() {
+				start(newNamespace("selected", true))
+				certs := withReplicas(nil, selector)
+				Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+				bundle := getBundle()
+
+				Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), certs[0].SignerSecret.Name, metav1.DeleteOptions{})).To(Succeed())
+				Eventually(func() bool {
+					_, err := cm.(*certManager).listers()[clusterNamespace{namespace: namespace}].secretLister.Secrets(namespace).Get(certs[0].SignerSecret.Name)
+					return errors.IsNotFound(err)
+				}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+				Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+				Expect(getBundle()).ToNot(Equal(bundle))
+				copy, err := getConfigMap(replica("selected"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(copy.Data["ca-bundle.crt"]).To(Equal(string(getBundle())))
+			})
+
+			It("should remove the replicas of the namespaces dropped from the selection", func() {
+				start(newNamespace("selected", true))
+				Expect(cm.Sync(context.TODO(), withReplicas([]string{otherNS}, selector))).To(Succeed())
+				waitForCopiesInLister()
+
+				ns, err := client.CoreV1().Namespaces().Get(context.TODO(), "selected", metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				delete(ns.Labels, "maroonedpods.io/ca-bundle")
+				_, err = client.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(cm.Sync(context.TODO(), withReplicas([]string{otherNS}, selector))).To(Succeed())
+
+				_, err = getConfigMap(replica("selected"))
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+				_, err = getConfigMap(replica(otherNS))
+				Expect(err).ToNot(HaveOccurred())
+
+				waitForCopiesInLister()
+				Expect(cm.Sync(context.TODO(), withReplicas(nil, nil))).To(Succeed())
+				_, err = getConfigMap(replica(otherNS))
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Context("current CA", func() {
+		const signerName = "maroonedpods-server"
+
+		var userCAPEM []byte
+
+		getSignerCA := func() *crypto.CA {
+			signer, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), signerName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			ca, err := crypto.GetCAFromBytes(signer.Data[corev1.TLSCertKey], signer.Data[corev1.TLSPrivateKeyKey])
+			Expect(err).ToNot(HaveOccurred())
+			return ca
+		}
+
+		// leaves only a CA added by a user in the bundle
+		removeCurrentCA := func() {
+			configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			configMap.Data[selfManagedBundleKey] = string(userCAPEM)
+			_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		repairs := func() float64 {
+			var m dto.Metric
+			Expect(certBundleRepairs.WithLabelValues(namespace, util.SignerBundleResourceName).Write(&m)).To(Succeed())
+			return m.GetCounter().GetValue()
+		}
+
+		repairEvents := func() int {
+			count := 0
+			for _, action := range client.Actions() {
+				if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+					if create.GetObject().(*corev1.Event).Reason == "CABundleRepaired" {
+						count++
+					}
+				}
+			}
+			return count
+		}
+
+		BeforeEach(func() {
+			userCA, err := crypto.MakeSelfSignedCAConfigForDuration("user-added", time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			userCAPEM, _, err = userCA.GetPEMBytes()
+			Expect(err).ToNot(HaveOccurred())
+
+			start()
+			Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		})
+
+		It("should restore the current CA removed between syncs", func() {
+			removeCurrentCA()
+
+			Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+
+			bundle := getBundle()
+			Expect(bytes.HasPrefix(bundle, userCAPEM)).To(BeTrue())
+			certs, err := crypto.CertsFromPEM(bundle)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+			Expect(containsCert(certs, getSignerCA().Config.Certs[0])).To(BeTrue())
+		})
+
+		It("should append the current CA the lister doesn't know is missing", func() {
+			ca := getSignerCA()
+			previousRepairs := repairs()
+			removeCurrentCA()
+
+			certs, err := cm.(*certManager).ensureCAInBundle(context.TODO(), cert.ManagementCluster, namespace, util.SignerBundleResourceName, ca)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(certs).To(HaveLen(2))
+			caPEM, err := crypto.EncodeCertificates(ca.Config.Certs[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(getBundle())).To(Equal(string(userCAPEM) + string(caPEM)))
+			Expect(repairs()).To(Equal(previousRepairs + 1))
+			Expect(repairEvents()).To(Equal(1))
+
+			// up to date
+			_, err = cm.(*certManager).ensureCAInBundle(context.TODO(), cert.ManagementCluster, namespace, util.SignerBundleResourceName, ca)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repairs()).To(Equal(previousRepairs + 1))
+			Expect(repairEvents()).To(Equal(1))
+		})
+	})
+})
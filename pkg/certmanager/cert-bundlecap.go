@@ -0,0 +1,138 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"sort"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// capBundle returns the CAs of the bundle to keep under the cap, in the order of the bundle. The
+// current signer and the CAs that signed one of the unexpired targets are always kept, the
+// remaining room goes to the most recent of the other CAs. A bundle under the cap is kept as is.
+func capBundle(bundle []*x509.Certificate, maxCAs int, current *x509.Certificate, targets []*x509.Certificate, now time.Time) []*x509.Certificate {
+	if maxCAs <= 0 || len(bundle) <= maxCAs {
+		return bundle
+	}
+
+	protected := make([]bool, len(bundle))
+	room := maxCAs
+	for i, ca := range bundle {
+		if ca.Equal(current) || signsUnexpired(ca, targets, now) {
+			protected[i] = true
+			room--
+		}
+	}
+
+	var others []int
+	for i := range bundle {
+		if !protected[i] {
+			others = append(others, i)
+		}
+	}
+	sort.SliceStable(others, func(a, b int) bool {
+		return bundle[others[a]].NotBefore.After(bundle[others[b]].NotBefore)
+	})
+	for _, i := range others {
+		if room <= 0 {
+			break
+		}
+		protected[i] = true
+		room--
+	}
+
+	var kept []*x509.Certificate
+	for i, ca := range bundle {
+		if protected[i] {
+			kept = append(kept, ca)
+		}
+	}
+	return kept
+}
+
+func signsUnexpired(ca *x509.Certificate, targets []*x509.Certificate, now time.Time) bool {
+	for _, target := range targets {
+		if now.Before(target.NotAfter) && target.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleTargets returns the leaves of the targets trusting the bundle of the definition, of every
+// definition of the last sync sharing it
+func (cm *certManager) bundleTargets(cd mpcerts.CertificateDefinition) []*x509.Certificate {
+	definitions := []mpcerts.CertificateDefinition{cd}
+	for _, synced := range cm.lastSyncedCerts() {
+		if synced.CertBundleConfigmap != nil && synced.BundleCluster == cd.BundleCluster &&
+			synced.CertBundleConfigmap.Namespace == cd.CertBundleConfigmap.Namespace &&
+			synced.CertBundleConfigmap.Name == cd.CertBundleConfigmap.Name {
+			definitions = append(definitions, synced)
+		}
+	}
+
+	var targets []*x509.Certificate
+	for _, d := range definitions {
+		if d.TargetSecret == nil {
+			continue
+		}
+		listers, ok := cm.listers()[clusterNamespace{namespace: d.TargetSecret.Namespace}]
+		if !ok {
+			continue
+		}
+		secret, err := listers.secretLister.Secrets(d.TargetSecret.Namespace).Get(d.TargetSecret.Name)
+		if err != nil {
+			continue
+		}
+		if parsed, err := cm.parseCerts(secret, corev1.TLSCertKey); err == nil {
+			targets = append(targets, parsed.certs[0])
+		}
+	}
+	return targets
+}
+
+// enforceMaxBundleCAs drops the CAs of the bundle beyond the MaxBundleCAs of the definition and
+// returns the bundle
+func (cm *certManager) enforceMaxBundleCAs(cd mpcerts.CertificateDefinition, ca *crypto.CA, bundle []*x509.Certificate) ([]*x509.Certificate, error) {
+	if cd.MaxBundleCAs <= 0 || len(bundle) <= cd.MaxBundleCAs {
+		return bundle, nil
+	}
+
+	client := cm.kubeClient(cd.BundleCluster).CoreV1()
+	configMap, err := client.ConfigMaps(cd.CertBundleConfigmap.Namespace).Get(context.TODO(), cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the certificates merged from kube-root-ca.crt don't count and are kept
+	own, kubeRoot := splitKubeRootCAs(bundle, kubeRootCAsOf(configMap))
+	if len(own) <= cd.MaxBundleCAs {
+		return bundle, nil
+	}
+
+	kept := capBundle(own, cd.MaxBundleCAs, ca.Config.Certs[0], cm.bundleTargets(cd), cm.clock.Now())
+	if len(kept) == len(own) {
+		return bundle, nil
+	}
+	if len(kept) > cd.MaxBundleCAs {
+		log.Info("The CAs in use exceed the cap of the bundle", "configmap", cd.CertBundleConfigmap.Name, "namespace", cd.CertBundleConfigmap.Namespace, "max", cd.MaxBundleCAs, "kept", len(kept))
+	}
+
+	kept = append(kept, kubeRoot...)
+	caBundle, err := crypto.EncodeCertificates(kept...)
+	if err != nil {
+		return nil, err
+	}
+	configMap = configMap.DeepCopy()
+	configMap.Data[selfManagedBundleKey] = string(caBundle)
+	if _, err := client.ConfigMaps(configMap.Namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	log.Info("Dropped the oldest CAs of the bundle", "configmap", configMap.Name, "namespace", configMap.Namespace, "dropped", len(bundle)-len(kept))
+	return kept, nil
+}
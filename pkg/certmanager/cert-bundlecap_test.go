@@ -0,0 +1,216 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// testCA is a CA with a fixed validity window, for the bundle decisions
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var testSerial int64
+
+func newTestCert(name string, notBefore, notAfter time.Time, isCA bool, parent *testCA) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	testSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	Expect(err).ToNot(HaveOccurred())
+	c, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	return &testCA{cert: c, key: key}
+}
+
+func newTestCA(notBefore, notAfter time.Time) *testCA {
+	return newTestCert("ca", notBefore, notAfter, true, nil)
+}
+
+var _ = Describe("bundle cap tests", func() {
+	const namespace = "maroonedpods"
+
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// CAs of overlapping validity windows, issued a day apart, ca0 being the oldest
+	var cas []*testCA
+	newCAs := func(n int) []*x509.Certificate {
+		cas = nil
+		var certs []*x509.Certificate
+		for i := 0; i < n; i++ {
+			notBefore := now.Add(time.Duration(i-n) * day)
+			ca := newTestCA(notBefore, notBefore.Add(10*day))
+			cas = append(cas, ca)
+			certs = append(certs, ca.cert)
+		}
+		return certs
+	}
+
+	targetOf := func(ca *testCA, notAfter time.Time) *x509.Certificate {
+		return newTestCert("target", ca.cert.NotBefore, notAfter, false, ca).cert
+	}
+
+	Context("decisions", func() {
+		It("should keep a bundle under the cap", func() {
+			bundle := newCAs(3)
+			Expect(capBundle(bundle, 3, bundle[2], nil, now)).To(Equal(bundle))
+			Expect(capBundle(bundle, 5, bundle[2], nil, now)).To(Equal(bundle))
+		})
+
+		It("should keep every CA without a cap", func() {
+			bundle := newCAs(10)
+			Expect(capBundle(bundle, 0, bundle[9], nil, now)).To(Equal(bundle))
+		})
+
+		It("should drop the oldest CAs beyond the cap", func() {
+			bundle := newCAs(5)
+			Expect(capBundle(bundle, 3, bundle[4], nil, now)).To(Equal(bundle[2:]))
+		})
+
+		It("should keep the order of the bundle", func() {
+			bundle := newCAs(4)
+			shuffled := []*x509.Certificate{bundle[3], bundle[0], bundle[2], bundle[1]}
+			Expect(capBundle(shuffled, 2, bundle[3], nil, now)).To(Equal([]*x509.Certificate{bundle[3], bundle[2]}))
+		})
+
+		It("should never drop the current signer", func() {
+			bundle := newCAs(5)
+			// e.g. CAs added by users are more recent than the signer
+			Expect(capBundle(bundle, 2, bundle[0], nil, now)).To(Equal([]*x509.Certificate{bundle[0], bundle[4]}))
+		})
+
+		It("should keep the CA of an unexpired target", func() {
+			bundle := newCAs(5)
+			targets := []*x509.Certificate{targetOf(cas[1], now.Add(day))}
+			Expect(capBundle(bundle, 3, bundle[4], targets, now)).To(Equal([]*x509.Certificate{bundle[1], bundle[3], bundle[4]}))
+		})
+
+		It("should drop the CA of an expired target", func() {
+			bundle := newCAs(5)
+			targets := []*x509.Certificate{targetOf(cas[1], now.Add(-time.Hour))}
+			Expect(capBundle(bundle, 3, bundle[4], targets, now)).To(Equal(bundle[2:]))
+		})
+
+		It("should exceed the cap rather than dropping CAs in use", func() {
+			bundle := newCAs(4)
+			targets := []*x509.Certificate{targetOf(cas[0], now.Add(day)), targetOf(cas[1], now.Add(day))}
+			Expect(capBundle(bundle, 2, bundle[3], targets, now)).To(Equal([]*x509.Certificate{bundle[0], bundle[1], bundle[3]}))
+		})
+	})
+
+	Context("sync", func() {
+		var (
+			client *fake.Clientset
+			cm     CertManager
+			cancel context.CancelFunc
+		)
+
+		newCerts := func(maxCAs int) []cert.CertificateDefinition {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			certs[0].MaxBundleCAs = maxCAs
+			return certs
+		}
+
+		getBundle := func() *corev1.ConfigMap {
+			configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return configMap
+		}
+
+		bundleCerts := func() []*x509.Certificate {
+			certs, err := crypto.CertsFromPEM([]byte(getBundle().Data[selfManagedBundleKey]))
+			Expect(err).ToNot(HaveOccurred())
+			return certs
+		}
+
+		// adds previous CAs to the bundle, as left behind by rotations
+		addCAs := func(n int) {
+			configMap := getBundle()
+			for i := 0; i < n; i++ {
+				ca, err := crypto.MakeSelfSignedCAConfigForDuration("previous", time.Hour)
+				Expect(err).ToNot(HaveOccurred())
+				caPEM, _, err := ca.GetPEMBytes()
+				Expect(err).ToNot(HaveOccurred())
+				configMap.Data[selfManagedBundleKey] += string(caPEM)
+			}
+			configMap, err := client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() bool {
+				cached, err := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(configMap.Name)
+				return err == nil && equality.Semantic.DeepEqual(cached.Data, configMap.Data)
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+		}
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+			Expect(cm.Sync(context.TODO(), newCerts(2))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should cap the bundle and keep the signer", func() {
+			addCAs(3)
+			Expect(cm.Sync(context.TODO(), newCerts(2))).To(Succeed())
+
+			certs := bundleCerts()
+			Expect(certs).To(HaveLen(2))
+			signer, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), "maroonedpods-server", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			signerCerts, err := crypto.CertsFromPEM(signer.Data[corev1.TLSCertKey])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(containsCert(certs, signerCerts[0])).To(BeTrue())
+		})
+
+		It("should not write a bundle under the cap", func() {
+			addCAs(1)
+			before := getBundle()
+			Expect(cm.Sync(context.TODO(), newCerts(2))).To(Succeed())
+			Expect(getBundle().Data).To(Equal(before.Data))
+		})
+
+		It("should not cap the bundle by default", func() {
+			addCAs(3)
+			Expect(cm.Sync(context.TODO(), newCerts(0))).To(Succeed())
+			Expect(bundleCerts()).To(HaveLen(4))
+		})
+	})
+})
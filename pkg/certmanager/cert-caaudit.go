@@ -0,0 +1,190 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// CAAuditConfigMapName is the configmap of the install namespace the CAs generated by the signers are
+	// recorded in, the oldest first
+	CAAuditConfigMapName = "maroonedpods-ca-audit"
+	caAuditKey           = "audit.json"
+
+	// defaultMaxCAAuditEntries bounds the audit, the oldest entries are truncated beyond it
+	defaultMaxCAAuditEntries = 100
+)
+
+// CAGenerationRecord is a CA generated by a signer
+type CAGenerationRecord struct {
+	Time metav1.Time `json:"time"`
+	// namespace/name of the signer secret
+	Signer string `json:"signer"`
+	// sha256 of the DER certificate, in hex
+	Fingerprint string      `json:"fingerprint"`
+	Serial      string      `json:"serial"`
+	NotBefore   metav1.Time `json:"notBefore"`
+	NotAfter    metav1.Time `json:"notAfter"`
+	// the rotation reason, see annLastRotationReason
+	Reason string `json:"reason"`
+}
+
+// caAuditRecord is the content of the audit configmap
+type caAuditRecord struct {
+	// the number of the oldest entries that were truncated
+	TruncatedEntries int                  `json:"truncatedEntries,omitempty"`
+	Entries          []CAGenerationRecord `json:"entries"`
+}
+
+// caAuditWriter appends the CAs to the audit configmap in the background, the writes retry on
+// conflicts and their errors are only logged, they never block or fail a sync
+type caAuditWriter struct {
+	client     kubernetes.Interface
+	namespace  string
+	maxEntries int
+
+	// serializes the flushes, the entries are appended in the order they were generated
+	writeLock sync.Mutex
+	// guards pending
+	pendingLock sync.Mutex
+	pending     []CAGenerationRecord
+}
+
+func newCAAuditWriter(client kubernetes.Interface, namespace string) *caAuditWriter {
+	return &caAuditWriter{client: client, namespace: namespace, maxEntries: defaultMaxCAAuditEntries}
+}
+
+// auditCA records the CA of the signer secret the rotation wrote, the writes of targets are ignored
+func (cm *certManager) auditCA(secret *corev1.Secret, reason string) {
+	w := cm.caAuditWriter
+	if w == nil {
+		return
+	}
+	certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil || len(certs) == 0 || !certs[0].IsCA {
+		return
+	}
+	ca := certs[0]
+	w.append(CAGenerationRecord{
+		Time:        metav1.Time{Time: cm.clock.Now()},
+		Signer:      secret.Namespace + "/" + secret.Name,
+		Fingerprint: certFingerprint(ca),
+		Serial:      ca.SerialNumber.String(),
+		NotBefore:   metav1.Time{Time: ca.NotBefore},
+		NotAfter:    metav1.Time{Time: ca.NotAfter},
+		Reason:      reason,
+	})
+}
+
+func (w *caAuditWriter) append(entry CAGenerationRecord) {
+	w.pendingLock.Lock()
+	w.pending = append(w.pending, entry)
+	w.pendingLock.Unlock()
+	go w.flush()
+}
+
+// flush writes the pending entries, they are kept for the next flush when the write fails
+func (w *caAuditWriter) flush() {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+
+	w.pendingLock.Lock()
+	entries := w.pending
+	w.pending = nil
+	w.pendingLock.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return w.write(entries)
+	})
+	if err == nil {
+		return
+	}
+	log.Error(err, "Failed to append to the CA audit", "configMap", CAAuditConfigMapName)
+	w.pendingLock.Lock()
+	w.pending = append(entries, w.pending...)
+	if len(w.pending) > w.maxEntries {
+		w.pending = w.pending[len(w.pending)-w.maxEntries:]
+	}
+	w.pendingLock.Unlock()
+}
+
+func (w *caAuditWriter) write(entries []CAGenerationRecord) error {
+	configMaps := w.client.CoreV1().ConfigMaps(w.namespace)
+	current, err := configMaps.Get(context.TODO(), CAAuditConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		data, err := w.marshal(&caAuditRecord{}, entries)
+		if err != nil {
+			return err
+		}
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CAAuditConfigMapName,
+				Namespace: w.namespace,
+				Labels:    util.ResourceBuilder.WithCommonLabels(nil),
+			},
+			Data: map[string]string{caAuditKey: data},
+		}, metav1.CreateOptions{})
+		// created by a concurrent writer, retried as a conflict
+		if errors.IsAlreadyExists(err) {
+			return errors.NewConflict(corev1.Resource("configmaps"), CAAuditConfigMapName, err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	record := &caAuditRecord{}
+	if err := json.Unmarshal([]byte(current.Data[caAuditKey]), record); err != nil {
+		log.Info("Restarting the unreadable CA audit", "configMap", CAAuditConfigMapName, "error", err.Error())
+		record = &caAuditRecord{}
+	}
+	data, err := w.marshal(record, entries)
+	if err != nil {
+		return err
+	}
+	updated := current.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string]string{}
+	}
+	updated.Data[caAuditKey] = data
+	_, err = configMaps.Update(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
+
+// marshal appends the entries to the record and truncates its oldest entries beyond the bound
+func (w *caAuditWriter) marshal(record *caAuditRecord, entries []CAGenerationRecord) (string, error) {
+	record.Entries = append(record.Entries, entries...)
+	if excess := len(record.Entries) - w.maxEntries; excess > 0 {
+		record.Entries = append([]CAGenerationRecord(nil), record.Entries[excess:]...)
+		record.TruncatedEntries += excess
+	}
+	data, err := json.Marshal(record)
+	return string(data), err
+}
+
+// deleteCAAudit deletes the audit configmap, the CAs it is about are gone
+func (cm *certManager) deleteCAAudit() error {
+	w := cm.caAuditWriter
+	if w == nil {
+		return nil
+	}
+	err := w.client.CoreV1().ConfigMaps(w.namespace).Delete(context.TODO(), CAAuditConfigMapName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("CA audit tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// syncs and waits for the listers
+	sync := func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, c := range managedCertsOf(certs[0]) {
+			waitForSecretInLister(cm, getSecret(c.secret.Name))
+		}
+	}
+
+	// the persisted audit of the signer of the first definition
+	audit := func() (*caAuditRecord, error) {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), CAAuditConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		record := &caAuditRecord{}
+		if err := json.Unmarshal([]byte(configMap.Data[caAuditKey]), record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+
+	reasonsOf := func(record *caAuditRecord) []string {
+		var reasons []string
+		for _, entry := range record.Entries {
+			if entry.Signer == namespace+"/"+certs[0].SignerSecret.Name {
+				reasons = append(reasons, entry.Reason)
+			}
+		}
+		return reasons
+	}
+
+	// issues the signer, then rotates it for a config change and by force
+	rotateThrice := func() {
+		sync()
+		clock.Step(time.Hour)
+		certs[0].SignerConfig.Lifetime *= 2
+		sync()
+		clock.Step(time.Hour)
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.caAuditWriter = newCAAuditWriter(client, namespace)
+		clock = clocktesting.NewFakeClock(time.Now().Truncate(time.Second))
+		cm.clock = clock
+		// a single signer
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})[:1]
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should append an entry for every CA of the signer, in order", func() {
+		start := clock.Now()
+		rotateThrice()
+
+		var record *caAuditRecord
+		Eventually(func(g Gomega) {
+			var err error
+			record, err = audit()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(record.Entries).To(HaveLen(3))
+		}).Should(Succeed())
+		Expect(reasonsOf(record)).To(Equal([]string{rotationReasonIssued, rotationReasonConfigChange, rotationReasonForced}))
+		Expect(record.TruncatedEntries).To(BeZero())
+
+		for i, entry := range record.Entries {
+			Expect(entry.Time.Time).To(BeTemporally("==", start.Add(time.Duration(i)*time.Hour)))
+			Expect(entry.NotAfter.Time).To(BeTemporally(">", entry.NotBefore.Time))
+			Expect(entry.Serial).ToNot(BeEmpty())
+			if i > 0 {
+				Expect(entry.Fingerprint).ToNot(Equal(record.Entries[i-1].Fingerprint))
+			}
+		}
+		// the last entry is the current CA
+		ca, err := crypto.CertsFromPEM(getSecret(certs[0].SignerSecret.Name).Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(record.Entries[2].Fingerprint).To(Equal(certFingerprint(ca[0])))
+		Expect(record.Entries[2].Serial).To(Equal(ca[0].SerialNumber.String()))
+	})
+
+	It("should truncate the oldest entries beyond the bound", func() {
+		cm.caAuditWriter.maxEntries = 2
+		rotateThrice()
+
+		Eventually(func(g Gomega) {
+			record, err := audit()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(record.TruncatedEntries).To(Equal(1))
+			g.Expect(reasonsOf(record)).To(Equal([]string{rotationReasonConfigChange, rotationReasonForced}))
+		}).Should(Succeed())
+	})
+
+	It("should retry the conflicts", func() {
+		sync()
+		Eventually(audit).ShouldNot(BeNil())
+
+		conflicts := 2
+		client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			object := action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap)
+			if object.Name != CAAuditConfigMapName || conflicts == 0 {
+				return false, nil, nil
+			}
+			conflicts--
+			return true, nil, apierrors.NewConflict(corev1.Resource("configmaps"), object.Name, errors.New("modified"))
+		})
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			record, err := audit()
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(reasonsOf(record)).To(Equal([]string{rotationReasonIssued, rotationReasonForced}))
+		}).Should(Succeed())
+	})
+
+	It("should not fail the sync when the audit can't be written", func() {
+		client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			object := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap)
+			if object.Name != CAAuditConfigMapName {
+				return false, nil, nil
+			}
+			return true, nil, errors.New("the API server is unavailable")
+		})
+		sync()
+
+		// kept for the next write
+		Eventually(func() int {
+			cm.caAuditWriter.pendingLock.Lock()
+			defer cm.caAuditWriter.pendingLock.Unlock()
+			return len(cm.caAuditWriter.pending)
+		}).Should(Equal(1))
+		_, err := audit()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,165 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// annCanaryOf is the namespace/name of the signer secret a canary secret is issued by
+	annCanaryOf = "operator.maroonedpods.io/canary-of"
+	// canarySecretSuffix is appended to the name of the signer for its canary secret
+	canarySecretSuffix = "-canary"
+	// canaryLifetime is the lifetime of the canary certificates, they are thrown away
+	canaryLifetime = 10 * time.Minute
+)
+
+// canaryResult is the outcome of the last canary run
+type canaryResult struct {
+	time time.Time
+	err  error
+}
+
+// RunCanary issues a short-lived certificate from every built-in signer of the definitions with the CA
+// as it is, writes it into the canary secret of the signer and verifies it against the CA bundle, so a
+// cert manager that can't rotate anymore is detected before the certificates expire. It runs at most
+// once per interval and returns the error of the last run.
+func (cm *certManager) RunCanary(certs []mpcerts.CertificateDefinition, interval time.Duration) error {
+	if !cm.started() {
+		return ErrNotStarted
+	}
+	if last := cm.lastCanary; last != nil && cm.clock.Since(last.time) < interval {
+		return last.err
+	}
+
+	var errs []error
+	signers := sets.NewString()
+	for _, cd := range certs {
+		if cd.Issuer != nil || cd.External || cd.SignerSecret == nil || cd.CertBundleConfigmap == nil || cd.Validate() != nil ||
+			cd.BundleCluster != mpcerts.ManagementCluster || cm.inTerminatingNamespace(cd) || cm.inAbsentNamespace(cd) {
+			continue
+		}
+		key := cd.SignerSecret.Namespace + "/" + cd.SignerSecret.Name
+		if signers.Has(key) {
+			continue
+		}
+		signers.Insert(key)
+
+		if err := cm.checkCanary(cd); err != nil {
+			certCanaryHealthy.WithLabelValues(cd.SignerSecret.Namespace, cd.SignerSecret.Name).Set(0)
+			cm.eventRecorder.Warningf("CertCanaryFailed", "The canary certificate of signer %s failed, the certificates may not rotate: %v", key, err)
+			errs = append(errs, fmt.Errorf("canary of signer %s: %w", key, err))
+			continue
+		}
+		certCanaryHealthy.WithLabelValues(cd.SignerSecret.Namespace, cd.SignerSecret.Name).Set(1)
+	}
+
+	cm.lastCanary = &canaryResult{time: cm.clock.Now(), err: utilerrors.NewAggregate(errs)}
+	return cm.lastCanary.err
+}
+
+// checkCanary issues the canary certificate of the signer of the definition, writes it and verifies
+// what was written against the CA bundle
+func (cm *certManager) checkCanary(cd mpcerts.CertificateDefinition) error {
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.SignerSecret.Namespace})
+	if err != nil {
+		return err
+	}
+	signer, err := listers.secretLister.Secrets(cd.SignerSecret.Namespace).Get(cd.SignerSecret.Name)
+	if err != nil {
+		return err
+	}
+	if signer, err = cm.withStoredKeyPair(signerRef(cd), signer); err != nil {
+		return err
+	}
+	ca, err := crypto.GetCAFromBytes(signer.Data[corev1.TLSCertKey], signer.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("the signer can't be used: %w", err)
+	}
+
+	name := cd.SignerSecret.Name + canarySecretSuffix
+	hostname := fmt.Sprintf("%s.%s.svc", name, cd.SignerSecret.Namespace)
+	canary, err := ca.MakeServerCertForDuration(sets.NewString(hostname), canaryLifetime)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	certPEM, keyPEM, err := canary.GetPEMBytes()
+	if err != nil {
+		return err
+	}
+
+	secret, err := cm.writeCanary(cd.SignerSecret, name, certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to write the canary secret: %w", err)
+	}
+
+	if listers.configMapLister == nil {
+		return fmt.Errorf("the bundle is not synced yet")
+	}
+	bundle, err := listers.configMapLister.ConfigMaps(cd.CertBundleConfigmap.Namespace).Get(cd.CertBundleConfigmap.Name)
+	if err != nil {
+		return err
+	}
+	roots, err := cm.parseCerts(bundle, selfManagedBundleKey)
+	if err != nil {
+		return fmt.Errorf("the CA bundle can't be parsed: %w", err)
+	}
+	written, err := cm.parseCerts(secret, corev1.TLSCertKey)
+	if err != nil {
+		return fmt.Errorf("the canary secret can't be parsed: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	for _, root := range roots.certs {
+		pool.AddCert(root)
+	}
+	if _, err := written.certs[0].Verify(x509.VerifyOptions{
+		DNSName:     hostname,
+		Roots:       pool,
+		CurrentTime: cm.clock.Now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("the canary doesn't verify against the CA bundle: %w", err)
+	}
+	return nil
+}
+
+// writeCanary writes the canary key pair into its secret next to the signer, the same way the
+// certificates are written
+func (cm *certManager) writeCanary(signer *corev1.Secret, name string, certPEM, keyPEM []byte) (*corev1.Secret, error) {
+	client := cm.k8sClient.CoreV1().Secrets(signer.Namespace)
+	data := map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+
+	secret, err := client.Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return client.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   signer.Namespace,
+				Labels:      util.ResourceBuilder.WithCommonLabels(nil),
+				Annotations: map[string]string{annCanaryOf: signer.Namespace + "/" + signer.Name},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: data,
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data = data
+	return client.Update(context.TODO(), secret, metav1.UpdateOptions{})
+}
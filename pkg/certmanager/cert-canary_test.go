@@ -0,0 +1,140 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("signing canary tests", func() {
+	const (
+		namespace = "maroonedpods"
+		signer    = "maroonedpods-server"
+		interval  = time.Minute
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	healthyGauge := func() float64 {
+		var m dto.Metric
+		Expect(certCanaryHealthy.WithLabelValues(namespace, signer).Write(&m)).To(Succeed())
+		return m.GetGauge().GetValue()
+	}
+
+	events := func(reason string) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == reason {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	// makes the secrets read-only, as a revoked RBAC rule or an admission webhook would
+	readOnlySecrets := func() {
+		for _, verb := range []string{"create", "update", "patch"} {
+			client.PrependReactor(verb, "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", nil)
+			})
+		}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should issue a canary verifying against the bundle", func() {
+		signerSecret := getSecret(signer)
+		Expect(cm.RunCanary(newCerts(), interval)).To(Succeed())
+		Expect(healthyGauge()).To(Equal(float64(1)))
+
+		canary := getSecret(signer + canarySecretSuffix)
+		Expect(canary.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(isManagedSecret(canary)).To(BeTrue())
+		certs, err := crypto.CertsFromPEM(canary.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs[0].NotAfter.Sub(certs[0].NotBefore)).To(BeNumerically("<=", canaryLifetime))
+
+		// the CA is not touched
+		Expect(getSecret(signer).Data).To(Equal(signerSecret.Data))
+		checkCerts(client, namespace, true)
+	})
+
+	It("should flag the signer once the secrets can't be written", func() {
+		Expect(cm.RunCanary(newCerts(), interval)).To(Succeed())
+		readOnlySecrets()
+
+		clock.Step(interval)
+		err := cm.RunCanary(newCerts(), interval)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(signer))
+		Expect(healthyGauge()).To(BeZero())
+		Expect(events("CertCanaryFailed")).To(Equal(1))
+	})
+
+	It("should run once per interval", func() {
+		Expect(cm.RunCanary(newCerts(), interval)).To(Succeed())
+		readOnlySecrets()
+
+		// the result of the last run is returned until the interval passed
+		clock.Step(interval / 2)
+		Expect(cm.RunCanary(newCerts(), interval)).To(Succeed())
+		Expect(healthyGauge()).To(Equal(float64(1)))
+
+		clock.Step(interval / 2)
+		Expect(cm.RunCanary(newCerts(), interval)).ToNot(Succeed())
+		Expect(cm.RunCanary(newCerts(), interval)).ToNot(Succeed())
+		Expect(events("CertCanaryFailed")).To(Equal(1))
+	})
+
+	It("should be deleted with the certificates", func() {
+		Expect(cm.RunCanary(newCerts(), interval)).To(Succeed())
+		Expect(cm.Cleanup()).To(Succeed())
+		_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), signer+canarySecretSuffix, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,254 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	certManagerGroup      = "cert-manager.io"
+	defaultCertIssuerKind = "Issuer"
+	certManagerCAKey      = "ca.crt"
+	// set by cert-manager on the secrets it issues
+	certManagerCertificateNameAnnotation = "cert-manager.io/certificate-name"
+)
+
+var certificateGVK = schema.GroupVersionKind{Group: certManagerGroup, Version: "v1", Kind: "Certificate"}
+
+// CertManagerUnavailableError is returned when a cert-manager.io issuer is configured
+// but the cert-manager CRDs are not installed in the cluster
+type CertManagerUnavailableError struct {
+	GVK schema.GroupVersionKind
+}
+
+func (e *CertManagerUnavailableError) Error() string {
+	return fmt.Sprintf("cert-manager.io issuer configured but %s is not available in the cluster", e.GVK.String())
+}
+
+// certManagerBackend requests the target certificates from cert-manager.io and publishes
+// the CA of the issuer in the bundle configmap
+type certManagerBackend struct {
+	cm *certManager
+}
+
+func (b *certManagerBackend) issue(ctx context.Context, cd mpcerts.CertificateDefinition) ([]*x509.Certificate, error) {
+	if cd.TargetSecret == nil {
+		return nil, nil
+	}
+
+	available, err := b.cm.kindAvailable(certificateGVK)
+	if err != nil {
+		return nil, err
+	}
+	if !available {
+		return nil, &CertManagerUnavailableError{GVK: certificateGVK}
+	}
+
+	if err := b.ensureCertificate(cd); err != nil {
+		return nil, err
+	}
+
+	if cd.CertBundleConfigmap == nil {
+		return nil, nil
+	}
+
+	return b.ensureCertBundle(ctx, cd)
+}
+
+// release deletes the Certificate of a definition that went back to the built-in signer,
+// otherwise cert-manager keeps overwriting the target secret. The Certificate is only looked up
+// while the cached target secret is missing or was issued by cert-manager.
+func (b *certManagerBackend) release(cd mpcerts.CertificateDefinition) error {
+	if cd.TargetSecret == nil {
+		return nil
+	}
+
+	listers, err := b.cm.listersFor(clusterNamespace{namespace: cd.TargetSecret.Namespace})
+	if err != nil {
+		return err
+	}
+	secret, err := listers.secretLister.Secrets(cd.TargetSecret.Namespace).Get(cd.TargetSecret.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && secret.Annotations[certManagerCertificateNameAnnotation] == "" {
+		return nil
+	}
+
+	available, err := b.cm.kindAvailable(certificateGVK)
+	if err != nil || !available {
+		return err
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	if err := b.cm.client.Get(context.TODO(), client.ObjectKeyFromObject(cd.TargetSecret), certificate); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	spec, _, _ := unstructured.NestedMap(certificate.Object, "spec")
+	if spec["secretName"] != cd.TargetSecret.Name {
+		return nil
+	}
+
+	log.Info("Deleting cert-manager certificate, target is managed by the operator again", "certificate", client.ObjectKeyFromObject(certificate))
+	if err := b.cm.client.Delete(context.TODO(), certificate); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (b *certManagerBackend) ensureCertificate(cd mpcerts.CertificateDefinition) error {
+	desired := newCertificate(cd)
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(certificateGVK)
+	if err := b.cm.client.Get(context.TODO(), client.ObjectKeyFromObject(desired), current); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		return b.cm.client.Create(context.TODO(), desired)
+	}
+
+	desiredSpec := desired.Object["spec"].(map[string]interface{})
+	currentSpec, _, err := unstructured.NestedMap(current.Object, "spec")
+	if err != nil {
+		return err
+	}
+
+	// only compare what we set, cert-manager may default the rest
+	changed := false
+	for k, v := range desiredSpec {
+		if !equality.Semantic.DeepEqual(currentSpec[k], v) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if currentSpec == nil {
+		currentSpec = map[string]interface{}{}
+	}
+	for k, v := range desiredSpec {
+		currentSpec[k] = v
+	}
+	if err := unstructured.SetNestedMap(current.Object, currentSpec, "spec"); err != nil {
+		return err
+	}
+
+	return b.cm.client.Update(context.TODO(), current)
+}
+
+func (b *certManagerBackend) ensureCertBundle(ctx context.Context, cd mpcerts.CertificateDefinition) ([]*x509.Certificate, error) {
+	secret := &corev1.Secret{}
+	if err := b.cm.client.Get(ctx, client.ObjectKeyFromObject(cd.TargetSecret), secret); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Waiting for cert-manager to issue the certificate", "secret", client.ObjectKeyFromObject(cd.TargetSecret))
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	caBytes := secret.Data[certManagerCAKey]
+	if len(caBytes) == 0 {
+		log.Info("Issuer does not provide a CA certificate, not updating the bundle", "secret", client.ObjectKeyFromObject(secret))
+		return nil, nil
+	}
+
+	certs, err := crypto.CertsFromPEM(caBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s in secret %s/%s: %w", certManagerCAKey, secret.Namespace, secret.Name, err)
+	}
+
+	return b.cm.ensureCertBundle(ctx, cd, &crypto.CA{Config: &crypto.TLSCertificateConfig{Certs: certs}})
+}
+
+// newCertificate creates the cert-manager.io Certificate requesting the target of the definition
+func newCertificate(cd mpcerts.CertificateDefinition) *unstructured.Unstructured {
+	issuerKind := cd.Issuer.Kind
+	if issuerKind == "" {
+		issuerKind = defaultCertIssuerKind
+	}
+	issuerGroup := cd.Issuer.Group
+	if issuerGroup == "" {
+		issuerGroup = certManagerGroup
+	}
+
+	spec := map[string]interface{}{
+		"secretName":  cd.TargetSecret.Name,
+		"duration":    cd.TargetConfig.Lifetime.String(),
+		"renewBefore": (cd.TargetConfig.Lifetime - cd.TargetConfig.Refresh).String(),
+		"issuerRef": map[string]interface{}{
+			"name":  cd.Issuer.Name,
+			"kind":  issuerKind,
+			"group": issuerGroup,
+		},
+		"privateKey": map[string]interface{}{
+			"rotationPolicy": "Always",
+		},
+	}
+
+	if cd.PrivateKey != nil {
+		privateKey := spec["privateKey"].(map[string]interface{})
+		privateKey["algorithm"] = string(cd.PrivateKey.Algorithm)
+		if cd.PrivateKey.Size > 0 {
+			privateKey["size"] = int64(cd.PrivateKey.Size)
+		}
+	}
+
+	if cd.TargetService != nil {
+		spec["dnsNames"] = []interface{}{
+			*cd.TargetService,
+			fmt.Sprintf("%s.%s", *cd.TargetService, cd.TargetSecret.Namespace),
+			fmt.Sprintf("%s.%s.svc", *cd.TargetService, cd.TargetSecret.Namespace),
+		}
+		for _, san := range cd.TargetExtraSANs {
+			spec["dnsNames"] = append(spec["dnsNames"].([]interface{}), san)
+		}
+		spec["usages"] = []interface{}{"digital signature", "key encipherment", "server auth"}
+	} else if cd.TargetUser != nil {
+		spec["commonName"] = *cd.TargetUser
+		if len(cd.TargetGroups) > 0 {
+			organizations := make([]interface{}, 0, len(cd.TargetGroups))
+			for _, group := range cd.TargetGroups {
+				organizations = append(organizations, group)
+			}
+			spec["subject"] = map[string]interface{}{"organizations": organizations}
+		}
+		spec["usages"] = []interface{}{"digital signature", "key encipherment", "client auth"}
+	}
+
+	switch cd.ExtendedKeyUsages {
+	case mpcerts.ExtendedKeyUsagesServer:
+		spec["usages"] = []interface{}{"digital signature", "key encipherment", "server auth"}
+	case mpcerts.ExtendedKeyUsagesClient:
+		spec["usages"] = []interface{}{"digital signature", "key encipherment", "client auth"}
+	case mpcerts.ExtendedKeyUsagesBoth:
+		spec["usages"] = []interface{}{"digital signature", "key encipherment", "server auth", "client auth"}
+	}
+
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetNamespace(cd.TargetSecret.Namespace)
+	certificate.SetName(cd.TargetSecret.Name)
+	certificate.SetLabels(cd.TargetSecret.Labels)
+
+	return certificate
+}
@@ -0,0 +1,206 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// certificateGetCountingClient counts the gets of cert-manager.io Certificates
+type certificateGetCountingClient struct {
+	client.Client
+	gets int
+}
+
+func (c *certificateGetCountingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if obj.GetObjectKind().GroupVersionKind() == certificateGVK {
+		c.gets++
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+var _ = Describe("cert-manager backend tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		kubeClient *fake.Clientset
+		crClient   client.Client
+		cm         *certManager
+		cancel     context.CancelFunc
+		args       *cert.FactoryArgs
+	)
+
+	newScheme := func() *runtime.Scheme {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		s.AddKnownTypeWithName(certificateGVK, &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(certificateGVK.GroupVersion().WithKind("CertificateList"), &unstructured.UnstructuredList{})
+		return s
+	}
+
+	newMapper := func(withCertManager bool) meta.RESTMapper {
+		mapper := meta.NewDefaultRESTMapper(nil)
+		if withCertManager {
+			mapper.Add(certificateGVK, meta.RESTScopeNamespace)
+		}
+		return mapper
+	}
+
+	startCertManager := func(withCertManager bool) {
+		kubeClient = fake.NewSimpleClientset()
+		crClient = crfake.NewClientBuilder().WithScheme(newScheme()).WithRESTMapper(newMapper(withCertManager)).Build()
+		cm = newCertManagerForTest(kubeClient, namespace).(*certManager)
+		cm.client = crClient
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	getCertificate := func(name string) (*unstructured.Unstructured, error) {
+		certificate := &unstructured.Unstructured{}
+		certificate.SetGroupVersionKind(certificateGVK)
+		err := crClient.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, certificate)
+		return certificate, err
+	}
+
+	BeforeEach(func() {
+		args = &cert.FactoryArgs{
+			Namespace: namespace,
+			Issuer:    &cert.IssuerReference{Name: "vault", Kind: "ClusterIssuer"},
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should fail with a typed error when cert-manager is not installed", func() {
+		startCertManager(false)
+
+		err := cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(args))
+		var unavailableErr *CertManagerUnavailableError
+		Expect(goerrors.As(err, &unavailableErr)).To(BeTrue())
+	})
+
+	It("should request the targets from the issuer", func() {
+		startCertManager(true)
+
+		certs := cert.CreateCertificateDefinitions(args)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		certificate, err := getCertificate(certs[0].TargetSecret.Name)
+		Expect(err).ToNot(HaveOccurred())
+		spec := certificate.Object["spec"].(map[string]interface{})
+		Expect(spec).To(HaveKeyWithValue("secretName", certs[0].TargetSecret.Name))
+		Expect(spec).To(HaveKeyWithValue("duration", "24h0m0s"))
+		Expect(spec).To(HaveKeyWithValue("renewBefore", "12h0m0s"))
+		Expect(spec["issuerRef"]).To(Equal(map[string]interface{}{
+			"name":  "vault",
+			"kind":  "ClusterIssuer",
+			"group": certManagerGroup,
+		}))
+		Expect(spec["dnsNames"]).To(ContainElement("maroonedpods-server.maroonedpods.svc"))
+
+		// the built-in signer is not used
+		_, err = kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), certs[0].SignerSecret.Name, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should update the certificate when the issuer changes", func() {
+		startCertManager(true)
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(args))).To(Succeed())
+
+		args.Issuer = &cert.IssuerReference{Name: "other"}
+		certs := cert.CreateCertificateDefinitions(args)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		certificate, err := getCertificate(certs[0].TargetSecret.Name)
+		Expect(err).ToNot(HaveOccurred())
+		issuerRef, _, _ := unstructured.NestedStringMap(certificate.Object, "spec", "issuerRef")
+		Expect(issuerRef).To(HaveKeyWithValue("name", "other"))
+		Expect(issuerRef).To(HaveKeyWithValue("kind", defaultCertIssuerKind))
+	})
+
+	It("should publish the issuer CA in the bundle", func() {
+		startCertManager(true)
+		certs := cert.CreateCertificateDefinitions(args)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		ca, err := crypto.MakeSelfSignedCAConfigForDuration("vault", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		caBytes, _, err := ca.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+
+		// what cert-manager would write
+		Expect(crClient.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: certs[0].TargetSecret.Name},
+			Data:       map[string][]byte{certManagerCAKey: caBytes},
+		})).To(Succeed())
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		bundle, err := kubeClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), certs[0].CertBundleConfigmap.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		bundleCerts, err := crypto.CertsFromPEM([]byte(bundle.Data["ca-bundle.crt"]))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bundleCerts).To(HaveLen(1))
+		Expect(bundleCerts[0].Equal(ca.Certs[0])).To(BeTrue())
+	})
+
+	It("should delete the certificate when going back to the built-in signer", func() {
+		startCertManager(true)
+		certs := cert.CreateCertificateDefinitions(args)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+
+		_, err := getCertificate(certs[0].TargetSecret.Name)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		_, err = kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), certs[0].SignerSecret.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should only look up the certificate of a target issued by cert-manager", func() {
+		startCertManager(true)
+		counting := &certificateGetCountingClient{Client: crClient}
+		cm.client = counting
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		target, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), certs[0].TargetSecret.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, target)
+
+		gets := counting.gets
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(counting.gets).To(Equal(gets))
+
+		// cert-manager took over the target
+		Expect(crClient.Create(context.TODO(), newCertificate(cert.CreateCertificateDefinitions(args)[0]))).To(Succeed())
+		target.Annotations[certManagerCertificateNameAnnotation] = target.Name
+		target, err = kubeClient.CoreV1().Secrets(namespace).Update(context.TODO(), target, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, target)
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		_, err = getCertificate(certs[0].TargetSecret.Name)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,177 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// maxChainHealings is the number of consecutive syncs the broken chain of a definition is healed,
+// after that it is only reported so a healing that doesn't fix it doesn't rotate on every sync
+const maxChainHealings = 2
+
+// chainProblem is why the chain of a definition doesn't verify
+type chainProblem struct {
+	// the bundle doesn't contain the current signer
+	signerNotInBundle bool
+	// the target doesn't verify against the bundle
+	targetErr error
+}
+
+func (p *chainProblem) String() string {
+	if p.signerNotInBundle {
+		return "the CA bundle doesn't contain the current signer"
+	}
+	return fmt.Sprintf("the target doesn't verify against the CA bundle: %v", p.targetErr)
+}
+
+// chainSecretOf is the secret the chain of the definition is reported for
+func chainSecretOf(cd mpcerts.CertificateDefinition) *corev1.Secret {
+	if cd.TargetSecret != nil {
+		return cd.TargetSecret
+	}
+	return cd.SignerSecret
+}
+
+// verifyChains checks that the bundle of every definition of the built-in signer contains the current
+// signer and that the target verifies against the bundle. A broken chain is healed by re-issuing the
+// target and the bundle, up to maxChainHealings consecutive syncs.
+func (cm *certManager) verifyChains(ctx context.Context, certs []mpcerts.CertificateDefinition) error {
+	var errs []error
+	for _, cd := range certs {
+		if cd.Issuer != nil || cd.External || cd.SignerSecret == nil || cd.CertBundleConfigmap == nil || cd.Validate() != nil ||
+			cm.inTerminatingNamespace(cd) || cm.inAbsentNamespace(cd) {
+			continue
+		}
+		secret := chainSecretOf(cd)
+		key := secret.Namespace + "/" + secret.Name
+
+		problem, err := cm.verifyChain(cd)
+		// healing re-issues the paused certificates
+		if err == nil && problem != nil && !cm.chainPaused(cd) {
+			problem, err = cm.healChain(ctx, cd, key, problem)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to verify the certificate chain of %s: %w", key, err))
+			continue
+		}
+
+		if problem == nil {
+			delete(cm.chainHealings, key)
+			certChainBroken.WithLabelValues(secret.Namespace, secret.Name).Set(0)
+			continue
+		}
+		certChainBroken.WithLabelValues(secret.Namespace, secret.Name).Set(1)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (cm *certManager) healChain(ctx context.Context, cd mpcerts.CertificateDefinition, key string, problem *chainProblem) (*chainProblem, error) {
+	if cm.chainHealings[key] >= maxChainHealings {
+		log.Info("The certificate chain is still broken, not healing it again", "secret", key, "problem", problem.String())
+		return problem, nil
+	}
+	if cm.chainHealings == nil {
+		cm.chainHealings = make(map[string]int)
+	}
+	cm.chainHealings[key]++
+
+	log.Info("The certificate chain is broken, healing it", "secret", key, "problem", problem.String())
+	cm.eventRecorder.Warningf("CertificateChainBroken", "The certificate chain of %s is broken, re-issuing it: %s", key, problem)
+	if problem.targetErr != nil {
+		cm.forceRotation(cd.TargetSecret, rotationReasonChainBroken)
+	}
+	// library-go adds the current signer to the bundle if it is missing
+	bundle, err := cm.issue(ctx, cd)
+	if err != nil {
+		return nil, err
+	}
+	cm.clearRotationReasons(cd)
+	if err := cm.propagateBundle(ctx, cd, bundle); err != nil {
+		return nil, err
+	}
+
+	return cm.verifyChain(cd)
+}
+
+// verifyChain returns why the chain of the definition is broken, nil if it isn't. It reads from
+// the API rather than the listers, which may not have seen the writes of the sync yet.
+func (cm *certManager) verifyChain(cd mpcerts.CertificateDefinition) (*chainProblem, error) {
+	signer, err := cm.k8sClient.CoreV1().Secrets(cd.SignerSecret.Namespace).Get(context.TODO(), cd.SignerSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	parsedSigner, err := cm.parseCerts(signer, corev1.TLSCertKey)
+	if err != nil {
+		return nil, err
+	}
+
+	configMap, err := cm.kubeClient(cd.BundleCluster).CoreV1().ConfigMaps(cd.CertBundleConfigmap.Namespace).Get(context.TODO(), cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	parsedBundle, err := cm.parseCerts(configMap, selfManagedBundleKey)
+	if err != nil {
+		return nil, err
+	}
+	signerCert, bundle := parsedSigner.certs[0], parsedBundle.certs
+	if problem := chainProblemOf(signerCert, bundle, nil, nil); problem != nil || cd.TargetSecret == nil {
+		return problem, nil
+	}
+
+	target, err := cm.k8sClient.CoreV1().Secrets(cd.TargetSecret.Namespace).Get(context.TODO(), cd.TargetSecret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	parsedTarget, err := cm.parseCerts(target, corev1.TLSCertKey)
+	return chainProblemOf(signerCert, bundle, parsedTarget, err), nil
+}
+
+// chainProblemOf returns why the signer and the target, if any, don't chain to the bundle, nil if they
+// do. check-certs audits the chains with it as well.
+func chainProblemOf(signer *x509.Certificate, bundle []*x509.Certificate, target *parsedCerts, targetErr error) *chainProblem {
+	if !containsCert(bundle, signer) {
+		return &chainProblem{signerNotInBundle: true}
+	}
+	if targetErr != nil {
+		return &chainProblem{targetErr: targetErr}
+	}
+	if target == nil {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	for _, c := range bundle {
+		roots.AddCert(c)
+	}
+	// as of its issuance, the expiry of the target is the business of its rotation
+	_, err := target.certs[0].Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: target.notBefore,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return &chainProblem{targetErr: err}
+	}
+	return nil
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
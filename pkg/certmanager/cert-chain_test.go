@@ -0,0 +1,234 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate chain tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	brokenGauge := func() float64 {
+		var m dto.Metric
+		Expect(certChainBroken.WithLabelValues(namespace, util.SecretResourceName).Write(&m)).To(Succeed())
+		return m.GetGauge().GetValue()
+	}
+
+	chainRotations := func() float64 {
+		var m dto.Metric
+		Expect(certRotations.WithLabelValues(namespace, util.SecretResourceName, rotationReasonChainBroken).Write(&m)).To(Succeed())
+		return m.GetCounter().GetValue()
+	}
+
+	// a serving certificate of a CA that isn't in the bundle, e.g. the signer of a sync that failed
+	// to publish it
+	fabricateTarget := func() (certPEM, keyPEM []byte) {
+		now := time.Now()
+		ca, err := certtest.NewCA("lost-signer", now, now.Add(48*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		server, err := certtest.NewServingCert(ca, []string{"maroonedpods-server.maroonedpods.svc"}, now, now.Add(24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		certPEM, keyPEM, err = server.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		return certPEM, keyPEM
+	}
+
+	// replaces the certificate of the target, library-go still sees the issuer annotation of the
+	// current signer and doesn't rotate it
+	breakTarget := func() {
+		certPEM, keyPEM := fabricateTarget()
+		target := getSecret(util.SecretResourceName)
+		target.Data[corev1.TLSCertKey] = certPEM
+		target.Data[corev1.TLSPrivateKeyKey] = keyPEM
+		target, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), target, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, target)
+	}
+
+	expectVerifies := func() {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))).To(BeTrue())
+		certs, err := crypto.CertsFromPEM(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certs[0].Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should verify the issued chains", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(brokenGauge()).To(BeZero())
+		expectVerifies()
+	})
+
+	It("should keep a fabricated chain until the target enters its refresh window", func() {
+		now := time.Now()
+		cd := newCerts()[0]
+		ca, err := certtest.NewCA("aged", now.Add(-12*time.Hour), now.Add(36*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		server, err := certtest.NewServingCert(ca, []string{"maroonedpods-server.maroonedpods.svc"}, now.Add(-time.Hour), now.Add(23*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		signer, err := certtest.WriteSigner(context.TODO(), client, cd, ca)
+		Expect(err).ToNot(HaveOccurred())
+		bundle, err := certtest.WriteBundle(context.TODO(), client, cd, ca)
+		Expect(err).ToNot(HaveOccurred())
+		target, err := certtest.WriteTarget(context.TODO(), client, cd, server)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, signer)
+		waitForSecretInLister(cm, target)
+		Eventually(func() map[string]string {
+			configMap, _ := cm.(*certManager).listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(bundle.Name)
+			if configMap == nil {
+				return nil
+			}
+			return configMap.Data
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(bundle.Data))
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(getSecret(signerName).Data).To(Equal(signer.Data))
+		Expect(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey]).To(Equal(target.Data[corev1.TLSCertKey]))
+		expectVerifies()
+
+		target, err = certtest.IntoRefreshWindow(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: util.SecretResourceName}, cd.TargetConfig)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, target)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey]).ToNot(Equal(target.Data[corev1.TLSCertKey]))
+		Expect(getSecret(signerName).Data).To(Equal(signer.Data))
+		expectVerifies()
+	})
+
+	It("should re-issue a target that doesn't verify against the bundle", func() {
+		rotations := chainRotations()
+		breakTarget()
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		expectVerifies()
+		Expect(brokenGauge()).To(BeZero())
+		Expect(chainRotations()).To(Equal(rotations + 1))
+		Expect(getSecret(util.SecretResourceName).Annotations[annLastRotationReason]).To(Equal(rotationReasonChainBroken))
+
+		// healed for good
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(chainRotations()).To(Equal(rotations + 1))
+	})
+
+	It("should re-publish a bundle without the current signer", func() {
+		signer := getSecret(signerName)
+		other, err := certtest.NewCA("other", time.Now(), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+
+		problem, err := cm.(*certManager).verifyChain(newCerts()[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(problem).To(BeNil())
+
+		_, err = certtest.WriteBundle(context.TODO(), client, newCerts()[0], other)
+		Expect(err).ToNot(HaveOccurred())
+		problem, err = cm.(*certManager).verifyChain(newCerts()[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(problem.signerNotInBundle).To(BeTrue())
+
+		Eventually(func() error {
+			return cm.Sync(context.TODO(), newCerts())
+		}, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+		expectVerifies()
+		Expect(brokenGauge()).To(BeZero())
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(configMap.Data[selfManagedBundleKey]).To(ContainSubstring(string(signer.Data[corev1.TLSCertKey])))
+	})
+
+	It("should audit a bundle without the current signer the way it verifies it", func() {
+		other, err := certtest.NewCA("other", time.Now(), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		bundle, err := certtest.WriteBundle(context.TODO(), client, newCerts()[0], other)
+		Expect(err).ToNot(HaveOccurred())
+		problem, err := cm.(*certManager).verifyChain(newCerts()[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(problem).ToNot(BeNil())
+
+		reader := crfake.NewClientBuilder().WithObjects(getSecret(signerName), getSecret(util.SecretResourceName), bundle).Build()
+		audit, err := AuditCertificates(context.TODO(), reader, newCerts()[:1], time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		var target *CertCheck
+		for i := range audit.Checks {
+			if audit.Checks[i].Ref.Kind == "Secret" && audit.Checks[i].Ref.Name == util.SecretResourceName {
+				target = &audit.Checks[i]
+			}
+		}
+		Expect(target).ToNot(BeNil())
+		Expect(target.ChainsToBundle).To(Equal(&[]bool{false}[0]))
+		Expect(target.Problems).To(ConsistOf(problem.String()))
+	})
+
+	It("should stop healing a chain the healing doesn't fix", func() {
+		rotations := chainRotations()
+		// something keeps writing back the certificate of the lost signer
+		certPEM, keyPEM := fabricateTarget()
+		client.PrependReactor("update", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if secret := action.(testingclient.UpdateAction).GetObject().(*corev1.Secret); secret.Name == util.SecretResourceName {
+				secret.Data[corev1.TLSCertKey] = certPEM
+				secret.Data[corev1.TLSPrivateKeyKey] = keyPEM
+			}
+			return false, nil, nil
+		})
+		breakTarget()
+
+		for i := 0; i < maxChainHealings+2; i++ {
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+			Expect(brokenGauge()).To(Equal(float64(1)))
+		}
+		Expect(chainRotations()).To(Equal(rotations + maxChainHealings))
+	})
+})
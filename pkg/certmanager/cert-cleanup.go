@@ -0,0 +1,136 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// Cleanup deletes the certificate secrets and CA bundles labeled as managed by the operator in every
+// managed namespace of both clusters, the copies of the bundles, the ClusterTrustBundles and the sync history included. It carries on
+// after failures so a retry only has to deal with what is left.
+func (cm *certManager) Cleanup() error {
+	var errs []error
+	for _, cn := range cm.clusterNamespaces() {
+		objects, err := cm.listManagedCertObjects(cn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i := range objects.configMaps {
+			if err := cm.deleteBundle(cn.cluster, &objects.configMaps[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for i := range objects.secrets {
+			if err := cm.deleteCertSecret(cn.cluster, &objects.secrets[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if err := cm.pruneClusterTrustBundles(nil); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cm.deleteHistory(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cm.deleteCAAudit(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cm.deleteCertState(); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// managedCertObjects are the certificate secrets and CA bundles labeled as managed by the operator
+type managedCertObjects struct {
+	secrets    []corev1.Secret
+	configMaps []corev1.ConfigMap
+}
+
+func (cm *certManager) listManagedCertObjects(cn clusterNamespace) (*managedCertObjects, error) {
+	selector := labels.SelectorFromSet(util.ResourceBuilder.WithCommonLabels(nil)).String()
+	objects := &managedCertObjects{}
+	client := cm.kubeClient(cn.cluster).CoreV1()
+
+	configMaps, err := client.ConfigMaps(cn.namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		if isGoneError(err) {
+			return objects, nil
+		}
+		return nil, err
+	}
+	for _, configMap := range configMaps.Items {
+		if _, ok := configMap.Data[selfManagedBundleKey]; ok {
+			objects.configMaps = append(objects.configMaps, configMap)
+		}
+	}
+
+	secrets, err := client.Secrets(cn.namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		if isGoneError(err) {
+			return objects, nil
+		}
+		return nil, err
+	}
+	for _, secret := range secrets.Items {
+		if isManagedSecret(&secret) {
+			objects.secrets = append(objects.secrets, secret)
+		}
+	}
+
+	return objects, nil
+}
+
+// deleteBundle deletes the CA bundle after its copies, they are only recorded on the bundle
+func (cm *certManager) deleteBundle(cluster mpcerts.Cluster, configMap *corev1.ConfigMap) error {
+	var copies bundleCopiesState
+	if ann := configMap.Annotations[annBundleCopies]; ann != "" {
+		if err := json.Unmarshal([]byte(ann), &copies); err != nil {
+			log.Info("Ignoring invalid bundle copies annotation", "configmap", configMap.Name, "error", err.Error())
+		}
+	}
+
+	owner := types.NamespacedName{Namespace: configMap.Namespace, Name: configMap.Name}.String()
+	var errs []error
+	for _, copy := range copies.Copies {
+		if err := cm.removeBundleCopy(cluster, copy, owner, copies.Key); err != nil && !isGoneError(err) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	log.Info("Deleting CA bundle", "configmap", configMap.Name, "namespace", configMap.Namespace)
+	err := cm.kubeClient(cluster).CoreV1().ConfigMaps(configMap.Namespace).Delete(context.TODO(), configMap.Name, metav1.DeleteOptions{})
+	if err != nil && !isGoneError(err) {
+		return err
+	}
+	return nil
+}
+
+func (cm *certManager) deleteCertSecret(cluster mpcerts.Cluster, secret *corev1.Secret) error {
+	log.Info("Deleting certificate secret", "secret", secret.Name, "namespace", secret.Namespace)
+	err := cm.kubeClient(cluster).CoreV1().Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+	if err != nil && !isGoneError(err) {
+		return err
+	}
+	return nil
+}
+
+// isGoneError returns whether the object or its namespace is already gone or being deleted,
+// the namespace controller removes whatever is left in a terminating namespace
+func isGoneError(err error) bool {
+	return errors.IsNotFound(err) || errors.HasStatusCause(err, corev1.NamespaceTerminatingCause)
+}
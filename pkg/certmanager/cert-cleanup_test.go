@@ -0,0 +1,153 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate cleanup tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		otherNS    = "consumer"
+		signerName = "maroonedpods-server"
+		bundleName = "maroonedpods-server-signer-bundle"
+	)
+
+	var (
+		k8sClient *fake.Clientset
+		cm        CertManager
+		cancel    context.CancelFunc
+	)
+
+	copyName := types.NamespacedName{Namespace: otherNS, Name: "maroonedpods-ca"}
+
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].BundleCopies = []types.NamespacedName{copyName}
+		return certs
+	}
+
+	exists := func(resource, ns, name string) bool {
+		var err error
+		switch resource {
+		case "secrets":
+			_, err = k8sClient.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		case "configmaps":
+			_, err = k8sClient.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).ToNot(HaveOccurred())
+		return true
+	}
+
+	BeforeEach(func() {
+		k8sClient = fake.NewSimpleClientset(
+			// labeled like the certificates but not one of them
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: namespace,
+					Name:      "other",
+					Labels:    util.ResourceBuilder.WithCommonLabels(nil),
+				},
+				Data: map[string][]byte{"password": []byte("hunter2")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "unlabeled"},
+			},
+		)
+		cm = newCertManagerForTest(k8sClient, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(exists("configmaps", copyName.Namespace, copyName.Name)).To(BeTrue())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should delete every certificate and bundle of the operator", func() {
+		Expect(cm.Cleanup()).To(Succeed())
+
+		Expect(exists("secrets", namespace, signerName)).To(BeFalse())
+		Expect(exists("secrets", namespace, util.SecretResourceName)).To(BeFalse())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeFalse())
+		Expect(exists("configmaps", copyName.Namespace, copyName.Name)).To(BeFalse())
+
+		Expect(exists("secrets", namespace, "other")).To(BeTrue())
+		Expect(exists("secrets", namespace, "unlabeled")).To(BeTrue())
+	})
+
+	It("should carry on after a failure and finish on retry", func() {
+		failures := 1
+		k8sClient.PrependReactor("delete", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.(testingclient.DeleteAction).GetName() != util.SecretResourceName || failures == 0 {
+				return false, nil, nil
+			}
+			failures--
+			return true, nil, fmt.Errorf("etcdserver: request timed out")
+		})
+
+		err := cm.Cleanup()
+		Expect(err).To(MatchError(ContainSubstring("request timed out")))
+		Expect(exists("secrets", namespace, util.SecretResourceName)).To(BeTrue())
+		Expect(exists("secrets", namespace, signerName)).To(BeFalse())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeFalse())
+
+		Expect(cm.Cleanup()).To(Succeed())
+		Expect(exists("secrets", namespace, util.SecretResourceName)).To(BeFalse())
+	})
+
+	It("should keep the bundle when one of its copies can't be removed", func() {
+		failures := 1
+		k8sClient.PrependReactor("delete", "configmaps", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.GetNamespace() != otherNS || failures == 0 {
+				return false, nil, nil
+			}
+			failures--
+			return true, nil, fmt.Errorf("etcdserver: request timed out")
+		})
+
+		Expect(cm.Cleanup()).ToNot(Succeed())
+		// still lists the copies for the retry
+		Expect(exists("configmaps", namespace, bundleName)).To(BeTrue())
+
+		Expect(cm.Cleanup()).To(Succeed())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeFalse())
+		Expect(exists("configmaps", copyName.Namespace, copyName.Name)).To(BeFalse())
+	})
+
+	It("should tolerate terminating namespaces", func() {
+		k8sClient.PrependReactor("delete", "configmaps", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.GetNamespace() != otherNS {
+				return false, nil, nil
+			}
+			err := errors.NewForbidden(corev1.Resource("configmaps"), copyName.Name, fmt.Errorf("namespace %s is being terminated", otherNS))
+			err.ErrStatus.Details.Causes = []metav1.StatusCause{{Type: corev1.NamespaceTerminatingCause}}
+			return true, nil, err
+		})
+		Expect(k8sClient.CoreV1().Secrets(namespace).Delete(context.TODO(), signerName, metav1.DeleteOptions{})).To(Succeed())
+
+		Expect(cm.Cleanup()).To(Succeed())
+		Expect(exists("secrets", namespace, util.SecretResourceName)).To(BeFalse())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeFalse())
+	})
+})
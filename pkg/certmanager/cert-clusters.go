@@ -0,0 +1,122 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// clusterNamespace is a namespace of the management or the guest cluster
+type clusterNamespace struct {
+	cluster   mpcerts.Cluster
+	namespace string
+}
+
+// guestClient is the access to the hosted cluster of a hosted control plane topology, where the
+// bundles and their consumers of some definitions live
+type guestClient struct {
+	namespaces    []string
+	k8sClient     kubernetes.Interface
+	extClient     apiextensionsclient.Interface
+	informers     v1helpers.KubeInformersForNamespaces
+	eventRecorder events.Recorder
+}
+
+func newGuestClient(client kubernetes.Interface, extClient apiextensionsclient.Interface, namespaces ...string) *guestClient {
+	// the operator has no pod in the guest cluster to refer to
+	eventRecorder := events.NewRecorder(client.CoreV1().Events(namespaces[0]), namespaces[0], nil)
+	return &guestClient{
+		namespaces:    namespaces,
+		k8sClient:     client,
+		extClient:     extClient,
+		informers:     v1helpers.NewKubeInformersForNamespaces(client, namespaces...),
+		eventRecorder: eventRecorder,
+	}
+}
+
+// NewHostedCertManager creates a certificate manager/refresher for a hosted control plane topology,
+// the objects of the definitions in the guest cluster are managed with the guest config in the
+// guest namespaces
+func NewHostedCertManager(mgr manager.Manager, guestConfig *rest.Config, guestNamespaces []string, installNamespace string, additionalNamespaces ...string) (CertManager, error) {
+	if len(guestNamespaces) == 0 {
+		return nil, fmt.Errorf("no namespace of the guest cluster")
+	}
+
+	guestK8sClient, err := kubernetes.NewForConfig(guestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	guestExtClient, err := apiextensionsclient.NewForConfig(guestConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cm, err := NewCertManager(mgr, installNamespace, additionalNamespaces...)
+	if err != nil {
+		return nil, err
+	}
+	cm.(*certManager).guest = newGuestClient(guestK8sClient, guestExtClient, guestNamespaces...)
+
+	return cm, nil
+}
+
+// startGuest starts the informers of the guest cluster and adds its listers to listerMap
+func (cm *certManager) startGuest(ctx context.Context, listerMap map[clusterNamespace]*certListers) error {
+	if cm.guest == nil {
+		return nil
+	}
+	return startListers(ctx, cm.guest.informers, mpcerts.GuestCluster, cm.guest.namespaces, listerMap, cm.informerHandler())
+}
+
+// clusterNamespaces returns the managed namespaces of every cluster
+func (cm *certManager) clusterNamespaces() []clusterNamespace {
+	var namespaces []clusterNamespace
+	for _, ns := range cm.namespaces {
+		namespaces = append(namespaces, clusterNamespace{namespace: ns})
+	}
+	if cm.guest != nil {
+		for _, ns := range cm.guest.namespaces {
+			namespaces = append(namespaces, clusterNamespace{cluster: mpcerts.GuestCluster, namespace: ns})
+		}
+	}
+	return namespaces
+}
+
+// checkClusters fails for a definition with objects in the guest cluster without a guest client
+func (cm *certManager) checkClusters(cd mpcerts.CertificateDefinition) error {
+	if cm.guest != nil || (cd.BundleCluster == mpcerts.ManagementCluster && cd.ConsumerCluster == mpcerts.ManagementCluster) {
+		return nil
+	}
+	return fmt.Errorf("%w: objects in the guest cluster but there is no guest client", mpcerts.ErrInvalidDefinition)
+}
+
+func (cm *certManager) kubeClient(cluster mpcerts.Cluster) kubernetes.Interface {
+	if cluster == mpcerts.GuestCluster && cm.guest != nil {
+		return cm.guest.k8sClient
+	}
+	return cm.k8sClient
+}
+
+func (cm *certManager) apiextClient(cluster mpcerts.Cluster) apiextensionsclient.Interface {
+	if cluster == mpcerts.GuestCluster && cm.guest != nil {
+		return cm.guest.extClient
+	}
+	return cm.extClient
+}
+
+// recorder returns the event recorder of the cluster, events are recorded next to the objects
+func (cm *certManager) recorder(cluster mpcerts.Cluster) events.Recorder {
+	if cluster == mpcerts.GuestCluster && cm.guest != nil {
+		return cm.guest.eventRecorder
+	}
+	return cm.eventRecorder
+}
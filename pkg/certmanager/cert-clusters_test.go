@@ -0,0 +1,111 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+)
+
+var _ = Describe("hosted control plane tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client      *fake.Clientset
+		guestClient *fake.Clientset
+		cm          *certManager
+		cancel      context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].BundleCluster = cert.GuestCluster
+		certs[0].ConsumerCluster = cert.GuestCluster
+		certs[0].MutatingWebhookConfigurations = []string{cluster.MutatingWebhookConfigurationName}
+		return certs
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		guestClient = fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "first.maroonedpods.io"}},
+		})
+		addApplyReactor(guestClient)
+		allowAccessReviews(guestClient)
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.guest = newGuestClient(guestClient, extfake.NewSimpleClientset(), namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should write the bundle and its consumers in the guest cluster", func() {
+		certs := newCerts()
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		checkSecret(client, namespace, certs[0].SignerSecret.Name, true)
+		checkSecret(client, namespace, certs[0].TargetSecret.Name, true)
+		checkSecret(guestClient, namespace, certs[0].SignerSecret.Name, false)
+		checkSecret(guestClient, namespace, certs[0].TargetSecret.Name, false)
+
+		bundle, err := guestClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), certs[0].CertBundleConfigmap.Name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bundle.Data[selfManagedBundleKey]).ToNot(BeEmpty())
+		_, err = client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), certs[0].CertBundleConfigmap.Name, metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+
+		config, err := guestClient.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), cluster.MutatingWebhookConfigurationName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(config.Webhooks[0].ClientConfig.CABundle)).To(Equal(bundle.Data[selfManagedBundleKey]))
+	})
+
+	It("should keep the objects of the other definitions in the management cluster", func() {
+		certs := newCerts()
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		for _, cd := range certs[1:] {
+			if cd.CertBundleConfigmap == nil {
+				continue
+			}
+			_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = guestClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+			Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("should clean up the bundle in the guest cluster", func() {
+		certs := newCerts()
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		Expect(cm.Cleanup()).To(Succeed())
+
+		_, err := guestClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), certs[0].CertBundleConfigmap.Name, metav1.GetOptions{})
+		Expect(k8serrors.IsNotFound(err)).To(BeTrue())
+		checkSecret(client, namespace, certs[0].SignerSecret.Name, false)
+	})
+
+	It("should fail the definitions in the guest cluster without a guest client", func() {
+		cm.guest = nil
+
+		err := cm.Sync(context.TODO(), newCerts())
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, cert.ErrInvalidDefinition)).To(BeTrue())
+	})
+})
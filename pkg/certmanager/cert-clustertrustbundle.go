@@ -0,0 +1,157 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// annClusterTrustBundleOf marks the ClusterTrustBundles the operator publishes with the namespace/name
+// of their signer
+const annClusterTrustBundleOf = "operator.maroonedpods.io/clusterTrustBundleOf"
+
+var clusterTrustBundleGVK = schema.GroupVersionKind{Group: "certificates.k8s.io", Version: "v1alpha1", Kind: "ClusterTrustBundle"}
+
+// clusterTrustBundleOwner is the namespace/name of the signer of the definition, or of its bundle
+// without a signer
+func clusterTrustBundleOwner(cd mpcerts.CertificateDefinition) (string, string) {
+	if cd.SignerSecret != nil {
+		return cd.SignerSecret.Namespace, cd.SignerSecret.Name
+	}
+	return cd.CertBundleConfigmap.Namespace, cd.CertBundleConfigmap.Name
+}
+
+// clusterTrustBundleName is the name of the ClusterTrustBundle of the definition, it is cluster scoped
+// so the name has the namespace of the signer
+func clusterTrustBundleName(cd mpcerts.CertificateDefinition) string {
+	namespace, name := clusterTrustBundleOwner(cd)
+	return namespace + "." + name
+}
+
+// clusterTrustBundlesAvailable reports whether the API server serves the ClusterTrustBundles
+func (cm *certManager) clusterTrustBundlesAvailable() (bool, error) {
+	return cm.kindAvailable(clusterTrustBundleGVK)
+}
+
+// publishClusterTrustBundle writes the still valid CAs of the bundle into the ClusterTrustBundle of the
+// definition, it does nothing on clusters without the API
+func (cm *certManager) publishClusterTrustBundle(cd mpcerts.CertificateDefinition, bundle []*x509.Certificate) error {
+	available, err := cm.clusterTrustBundlesAvailable()
+	if err != nil || !available {
+		return err
+	}
+
+	now := cm.clock.Now()
+	var valid []*x509.Certificate
+	for _, ca := range bundle {
+		if now.Before(ca.NotAfter) {
+			valid = append(valid, ca)
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	trustBundle, err := crypto.EncodeCertificates(valid...)
+	if err != nil {
+		return err
+	}
+
+	name := clusterTrustBundleName(cd)
+	namespace, signer := clusterTrustBundleOwner(cd)
+	owner := namespace + "/" + signer
+	labels := util.ResourceBuilder.WithCommonLabels(nil)
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(clusterTrustBundleGVK)
+	if err := cm.client.Get(context.TODO(), client.ObjectKey{Name: name}, current); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		desired := &unstructured.Unstructured{}
+		desired.SetGroupVersionKind(clusterTrustBundleGVK)
+		desired.SetName(name)
+		desired.SetLabels(labels)
+		desired.SetAnnotations(map[string]string{annClusterTrustBundleOf: owner})
+		if err := unstructured.SetNestedField(desired.Object, string(trustBundle), "spec", "trustBundle"); err != nil {
+			return err
+		}
+		if err := cm.client.Create(context.TODO(), desired); err != nil {
+			return err
+		}
+		log.Info("Published the CA bundle as ClusterTrustBundle", "clusterTrustBundle", name, "signer", owner)
+		return nil
+	}
+
+	currentBundle, _, _ := unstructured.NestedString(current.Object, "spec", "trustBundle")
+	if currentBundle == string(trustBundle) && current.GetAnnotations()[annClusterTrustBundleOf] == owner &&
+		ownedInSync(current.GetLabels(), definitionLabels, labels) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	updated.SetLabels(mergeOwned(current.GetLabels(), definitionLabels, labels))
+	annotations := updated.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annClusterTrustBundleOf] = owner
+	updated.SetAnnotations(annotations)
+	if err := unstructured.SetNestedField(updated.Object, string(trustBundle), "spec", "trustBundle"); err != nil {
+		return err
+	}
+	if err := cm.client.Update(context.TODO(), updated); err != nil {
+		return err
+	}
+	log.Info("Updated the CAs of the ClusterTrustBundle", "clusterTrustBundle", name, "signer", owner)
+	return nil
+}
+
+// pruneClusterTrustBundles deletes the ClusterTrustBundles of the signers of the managed namespaces the
+// definitions don't publish anymore, the ones of other installs are left alone
+func (cm *certManager) pruneClusterTrustBundles(certs []mpcerts.CertificateDefinition) error {
+	available, err := cm.clusterTrustBundlesAvailable()
+	if err != nil || !available {
+		return err
+	}
+
+	desired := sets.NewString()
+	for _, cd := range certs {
+		if cd.PublishClusterTrustBundle {
+			desired.Insert(clusterTrustBundleName(cd))
+		}
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(clusterTrustBundleGVK.GroupVersion().WithKind("ClusterTrustBundleList"))
+	if err := cm.client.List(context.TODO(), list, client.MatchingLabels(util.ResourceBuilder.WithCommonLabels(nil))); err != nil {
+		return err
+	}
+
+	managed := sets.NewString(cm.namespaces...)
+	var errs []error
+	for i := range list.Items {
+		bundle := &list.Items[i]
+		owner := bundle.GetAnnotations()[annClusterTrustBundleOf]
+		namespace, _, err := toolscache.SplitMetaNamespaceKey(owner)
+		if owner == "" || err != nil || !managed.Has(namespace) || desired.Has(bundle.GetName()) {
+			continue
+		}
+		if err := cm.client.Delete(context.TODO(), bundle); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("Deleted the ClusterTrustBundle of a signer that isn't published anymore", "clusterTrustBundle", bundle.GetName(), "signer", owner)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,189 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("ClusterTrustBundle tests", func() {
+	const (
+		namespace = "maroonedpods"
+		name      = "maroonedpods.maroonedpods-server"
+	)
+
+	var (
+		kubeClient *fake.Clientset
+		crClient   client.Client
+		cm         *certManager
+		cancel     context.CancelFunc
+	)
+
+	startCertManager := func(withClusterTrustBundles bool, objects ...client.Object) {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		s.AddKnownTypeWithName(clusterTrustBundleGVK, &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(clusterTrustBundleGVK.GroupVersion().WithKind("ClusterTrustBundleList"), &unstructured.UnstructuredList{})
+		mapper := meta.NewDefaultRESTMapper(nil)
+		if withClusterTrustBundles {
+			mapper.Add(clusterTrustBundleGVK, meta.RESTScopeRoot)
+		}
+
+		kubeClient = fake.NewSimpleClientset()
+		crClient = crfake.NewClientBuilder().WithScheme(s).WithRESTMapper(mapper).WithObjects(objects...).Build()
+		cm = newCertManagerForTest(kubeClient, namespace).(*certManager)
+		cm.client = crClient
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newCerts := func(publish bool) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].PublishClusterTrustBundle = publish
+		return certs
+	}
+
+	newClusterTrustBundle := func(name, owner string) *unstructured.Unstructured {
+		bundle := &unstructured.Unstructured{}
+		bundle.SetGroupVersionKind(clusterTrustBundleGVK)
+		bundle.SetName(name)
+		bundle.SetLabels(util.ResourceBuilder.WithCommonLabels(nil))
+		bundle.SetAnnotations(map[string]string{annClusterTrustBundleOf: owner})
+		Expect(unstructured.SetNestedField(bundle.Object, "", "spec", "trustBundle")).To(Succeed())
+		return bundle
+	}
+
+	getClusterTrustBundle := func(name string) (*unstructured.Unstructured, error) {
+		bundle := &unstructured.Unstructured{}
+		bundle.SetGroupVersionKind(clusterTrustBundleGVK)
+		err := crClient.Get(context.TODO(), client.ObjectKey{Name: name}, bundle)
+		return bundle, err
+	}
+
+	trustBundleOf := func(name string) string {
+		bundle, err := getClusterTrustBundle(name)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		trustBundle, _, err := unstructured.NestedString(bundle.Object, "spec", "trustBundle")
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return trustBundle
+	}
+
+	signerCA := func() string {
+		signer, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerSignerSecretName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return string(signer.Data[corev1.TLSCertKey])
+	}
+
+	It("should publish the CA of the signer", func() {
+		startCertManager(true)
+
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		Expect(trustBundleOf(name)).To(Equal(signerCA()))
+		bundle, err := getClusterTrustBundle(name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bundle.GetLabels()).To(Equal(util.ResourceBuilder.WithCommonLabels(nil)))
+		Expect(bundle.GetAnnotations()).To(HaveKeyWithValue(annClusterTrustBundleOf, namespace+"/"+cert.ServerSignerSecretName))
+	})
+
+	It("should keep the previous CA of a rotated signer", func() {
+		startCertManager(true)
+		certs := newCerts(true)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		previous := signerCA()
+
+		signer, err := certtest.IntoRefreshWindow(context.TODO(), kubeClient, types.NamespacedName{Namespace: namespace, Name: cert.ServerSignerSecretName}, certs[0].SignerConfig)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, signer)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		current := signerCA()
+		Expect(current).ToNot(Equal(previous))
+		cas, err := crypto.CertsFromPEM([]byte(trustBundleOf(name)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cas).To(HaveLen(2))
+		Expect(trustBundleOf(name)).To(ContainSubstring(previous))
+		Expect(trustBundleOf(name)).To(ContainSubstring(current))
+	})
+
+	It("should leave the expired CAs out", func() {
+		startCertManager(true)
+		valid, err := certtest.NewCA("valid", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		expired, err := certtest.NewCA("expired", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cm.publishClusterTrustBundle(newCerts(true)[0], append(expired.Config.Certs, valid.Config.Certs...))).To(Succeed())
+
+		validPEM, err := crypto.EncodeCertificates(valid.Config.Certs...)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trustBundleOf(name)).To(Equal(string(validPEM)))
+	})
+
+	It("should delete the bundle once it isn't published anymore", func() {
+		other := newClusterTrustBundle("other.maroonedpods-server", "other/maroonedpods-server")
+		startCertManager(true, other)
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		_, err := getClusterTrustBundle(name)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+
+		_, err = getClusterTrustBundle(name)
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+		// of another install
+		_, err = getClusterTrustBundle(other.GetName())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should delete the bundle on cleanup", func() {
+		startCertManager(true)
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		Expect(cm.Cleanup()).To(Succeed())
+
+		_, err := getClusterTrustBundle(name)
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+	})
+
+	It("should skip the bundle without the API", func() {
+		startCertManager(false)
+
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		Expect(cm.Cleanup()).To(Succeed())
+
+		_, err := getClusterTrustBundle(name)
+		Expect(err).To(HaveOccurred())
+		checkConfigMap(kubeClient, namespace, cert.CABundleConfigMapName, false)
+	})
+
+	It("should reject a bundle of another cluster", func() {
+		certs := newCerts(true)
+		certs[0].BundleCluster = cert.GuestCluster
+		Expect(certs[0].Validate()).To(MatchError(cert.ErrInvalidDefinition))
+	})
+})
@@ -0,0 +1,126 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("cert config annotation repair tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// sets the cert config annotation of the target as if it was edited by hand
+	editCertConfig := func(annotation string) {
+		secret := getSecret()
+		secret.Annotations[annCertConfig] = annotation
+		secret, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+	}
+
+	repairEvents := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == "CertConfigRepaired" {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	DescribeTable("should overwrite a corrupted annotation without rotating", func(annotation string) {
+		notBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		canonical := getSecret().Annotations[annCertConfig]
+		editCertConfig(annotation)
+
+		// certificates issued within the same second have the same NotBefore
+		time.Sleep(time.Second)
+		for i := 0; i < 3; i++ {
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		}
+
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(notBefore))
+		Expect(getSecret().Annotations[annCertConfig]).To(Equal(canonical))
+		Expect(repairEvents()).To(Equal(1))
+	},
+		Entry("garbage JSON", `{"lifetime":`),
+		Entry("not an object", `"24h"`),
+		Entry("a missing refresh", `{"lifetime":"24h0m0s"}`),
+		Entry("an unparseable duration", `{"lifetime":"a day","refresh":"12h0m0s"}`),
+		Entry("a negative duration", `{"lifetime":"-24h0m0s","refresh":"12h0m0s"}`),
+		Entry("a refresh after the lifetime", `{"lifetime":"1h0m0s","refresh":"12h0m0s"}`),
+	)
+
+	It("should not rotate for a differently ordered and spelled equal annotation", func() {
+		notBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		editCertConfig(`{"refresh":"12h","lifetime":"1d"}`)
+
+		time.Sleep(time.Second)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(notBefore))
+		Expect(repairEvents()).To(BeZero())
+	})
+
+	It("should rotate for a valid different annotation", func() {
+		notBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		editCertConfig(toSerializedCertConfig(48*time.Hour, 24*time.Hour))
+
+		time.Sleep(time.Second)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(BeTemporally(">", notBefore))
+		Expect(getSecret().Annotations[annCertConfig]).To(Equal(toSerializedCertConfig(24*time.Hour, 12*time.Hour)))
+		Expect(repairEvents()).To(BeZero())
+	})
+
+	It("should warn again for another corruption", func() {
+		editCertConfig(`garbage`)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		editCertConfig(`more garbage`)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(repairEvents()).To(Equal(2))
+	})
+})
@@ -0,0 +1,291 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// consumerDiscoveryInterval is the minimum time between two discoveries of the consumers
+const consumerDiscoveryInterval = 5 * time.Minute
+
+// CertConsumerReference is how a consumer references a managed object
+type CertConsumerReference string
+
+const (
+	// CertConsumerVolume is a secret or configMap volume
+	CertConsumerVolume CertConsumerReference = "Volume"
+	// CertConsumerProjectedVolume is a source of a projected volume
+	CertConsumerProjectedVolume CertConsumerReference = "ProjectedVolume"
+	// CertConsumerEnv is an envFrom or a valueFrom of a container
+	CertConsumerEnv CertConsumerReference = "Env"
+)
+
+// CertConsumer is a workload, or a pod without one, referencing a managed object
+type CertConsumer struct {
+	Kind      string                  `json:"kind"`
+	Namespace string                  `json:"namespace"`
+	Name      string                  `json:"name"`
+	Via       []CertConsumerReference `json:"via"`
+}
+
+func (c CertConsumer) String() string {
+	return c.Kind + " " + c.Namespace + "/" + c.Name
+}
+
+// consumerDiscovery is the outcome of the last discovery, guarded by statusLock
+type consumerDiscovery struct {
+	lastRun time.Time
+	// consumers by syncKey of the signers, targets and bundles
+	consumers map[string][]CertConsumer
+	// why workloads of a namespace couldn't be listed, e.g. RBAC denies it, by namespace
+	errors map[string]string
+}
+
+// discoverConsumersOf tells whether a definition asks for the discovery of its consumers
+func discoverConsumersOf(certs []mpcerts.CertificateDefinition) bool {
+	for _, cd := range certs {
+		if cd.DiscoverConsumers {
+			return true
+		}
+	}
+	return false
+}
+
+// discoverConsumers finds the workloads and standalone pods referencing the managed objects of the
+// definitions asking for it, at most once per consumerDiscoveryInterval. The workloads are listed in
+// pages from the namespaces of the objects only, they can't reference objects of other namespaces.
+// A namespace whose workloads can't be listed is reported and skipped, it never fails the sync.
+func (cm *certManager) discoverConsumers(certs []mpcerts.CertificateDefinition) {
+	if !discoverConsumersOf(certs) {
+		cm.statusLock.Lock()
+		cm.consumerDiscovery = consumerDiscovery{}
+		cm.statusLock.Unlock()
+		return
+	}
+
+	now := cm.clock.Now()
+	cm.statusLock.RLock()
+	lastRun := cm.consumerDiscovery.lastRun
+	cm.statusLock.RUnlock()
+	if !lastRun.IsZero() && now.Sub(lastRun) < consumerDiscoveryInterval {
+		return
+	}
+
+	// the objects by namespace and name, the management cluster only
+	objects := map[string]map[string][]corev1.ObjectReference{}
+	for _, cd := range certs {
+		if !cd.DiscoverConsumers {
+			continue
+		}
+		for _, object := range managedObjectsOf(cd) {
+			if object.Cluster != mpcerts.ManagementCluster {
+				continue
+			}
+			if objects[object.Ref.Namespace] == nil {
+				objects[object.Ref.Namespace] = map[string][]corev1.ObjectReference{}
+			}
+			objects[object.Ref.Namespace][object.Ref.Name] = append(objects[object.Ref.Namespace][object.Ref.Name], object.Ref)
+		}
+	}
+
+	discovery := consumerDiscovery{lastRun: now, consumers: map[string][]CertConsumer{}, errors: map[string]string{}}
+	for namespace, names := range objects {
+		if err := cm.discoverNamespaceConsumers(namespace, names, discovery.consumers); err != nil {
+			log.Info("Failed to discover the consumers of the certificates", "namespace", namespace, "error", err.Error())
+			discovery.errors[namespace] = err.Error()
+		}
+	}
+	for key := range discovery.consumers {
+		sort.Slice(discovery.consumers[key], func(i, j int) bool {
+			return discovery.consumers[key][i].String() < discovery.consumers[key][j].String()
+		})
+	}
+
+	cm.statusLock.Lock()
+	cm.consumerDiscovery = discovery
+	cm.statusLock.Unlock()
+}
+
+// discoverNamespaceConsumers adds the consumers of the objects of the namespace, the kinds that
+// can be listed are kept when another one can't
+func (cm *certManager) discoverNamespaceConsumers(namespace string, names map[string][]corev1.ObjectReference, consumers map[string][]CertConsumer) error {
+	apps := cm.k8sClient.AppsV1()
+	core := cm.k8sClient.CoreV1()
+	lists := []struct {
+		resource string
+		list     func(metav1.ListOptions) (runtime.Object, error)
+	}{
+		{"deployments", func(opts metav1.ListOptions) (runtime.Object, error) {
+			return apps.Deployments(namespace).List(context.TODO(), opts)
+		}},
+		{"daemonsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+			return apps.DaemonSets(namespace).List(context.TODO(), opts)
+		}},
+		{"statefulsets", func(opts metav1.ListOptions) (runtime.Object, error) {
+			return apps.StatefulSets(namespace).List(context.TODO(), opts)
+		}},
+		{"pods", func(opts metav1.ListOptions) (runtime.Object, error) {
+			return core.Pods(namespace).List(context.TODO(), opts)
+		}},
+	}
+
+	var failed []string
+	for _, l := range lists {
+		err := pager.New(pager.SimplePageFunc(l.list)).EachListItem(context.TODO(), metav1.ListOptions{}, func(obj runtime.Object) error {
+			kind, meta, spec := podSpecOf(obj)
+			if spec == nil {
+				return nil
+			}
+			for name, via := range referencedObjects(spec) {
+				for _, ref := range names[name.name] {
+					if ref.Kind != name.kind {
+						continue
+					}
+					key := syncKey(ref)
+					consumers[key] = append(consumers[key], CertConsumer{Kind: kind, Namespace: meta.Namespace, Name: meta.Name, Via: via})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if errors.IsForbidden(err) {
+				failed = append(failed, fmt.Sprintf("listing %s is forbidden", l.resource))
+				continue
+			}
+			failed = append(failed, fmt.Sprintf("listing %s failed: %v", l.resource, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// podSpecOf returns the pod template of a workload, or the spec of a pod no controller owns, nil
+// for a pod of a workload, which is reported instead
+func podSpecOf(obj runtime.Object) (string, *metav1.ObjectMeta, *corev1.PodSpec) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return "Deployment", &o.ObjectMeta, &o.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		return "DaemonSet", &o.ObjectMeta, &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		return "StatefulSet", &o.ObjectMeta, &o.Spec.Template.Spec
+	case *corev1.Pod:
+		if metav1.GetControllerOf(o) != nil {
+			return "", nil, nil
+		}
+		return "Pod", &o.ObjectMeta, &o.Spec
+	}
+	return "", nil, nil
+}
+
+// objectName is a secret or a configmap a pod spec references
+type objectName struct {
+	kind string
+	name string
+}
+
+// referencedObjects returns the secrets and configmaps the pod spec references and how
+func referencedObjects(spec *corev1.PodSpec) map[objectName][]CertConsumerReference {
+	refs := map[objectName][]CertConsumerReference{}
+	add := func(kind, name string, via CertConsumerReference) {
+		if name == "" {
+			return
+		}
+		key := objectName{kind: kind, name: name}
+		for _, v := range refs[key] {
+			if v == via {
+				return
+			}
+		}
+		refs[key] = append(refs[key], via)
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			add("Secret", volume.Secret.SecretName, CertConsumerVolume)
+		}
+		if volume.ConfigMap != nil {
+			add("ConfigMap", volume.ConfigMap.Name, CertConsumerVolume)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					add("Secret", source.Secret.Name, CertConsumerProjectedVolume)
+				}
+				if source.ConfigMap != nil {
+					add("ConfigMap", source.ConfigMap.Name, CertConsumerProjectedVolume)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				add("Secret", envFrom.SecretRef.Name, CertConsumerEnv)
+			}
+			if envFrom.ConfigMapRef != nil {
+				add("ConfigMap", envFrom.ConfigMapRef.Name, CertConsumerEnv)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				add("Secret", env.ValueFrom.SecretKeyRef.Name, CertConsumerEnv)
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				add("ConfigMap", env.ValueFrom.ConfigMapKeyRef.Name, CertConsumerEnv)
+			}
+		}
+	}
+	return refs
+}
+
+// consumersOf returns the consumers of the object and why they couldn't be discovered, both empty
+// when the discovery is disabled
+func (cm *certManager) consumersOf(ref corev1.ObjectReference) ([]CertConsumer, string) {
+	cm.statusLock.RLock()
+	defer cm.statusLock.RUnlock()
+	return cm.consumerDiscovery.consumers[syncKey(ref)], cm.consumerDiscovery.errors[ref.Namespace]
+}
+
+// reportRotationConsumers emits an event listing the consumers of the objects of a definition that
+// just rotated, before the rollouts of its deployments
+func (cm *certManager) reportRotationConsumers(cd mpcerts.CertificateDefinition) {
+	if !cd.DiscoverConsumers {
+		return
+	}
+	var consumers []string
+	seen := map[string]bool{}
+	for _, object := range managedObjectsOf(cd) {
+		found, _ := cm.consumersOf(object.Ref)
+		for _, consumer := range found {
+			if !seen[consumer.String()] {
+				seen[consumer.String()] = true
+				consumers = append(consumers, consumer.String())
+			}
+		}
+	}
+	if len(consumers) == 0 {
+		return
+	}
+	sort.Strings(consumers)
+	cm.eventRecorder.Eventf("CertificateConsumers", "Rotated certificate %s, its consumers are %s", cd.Name(), strings.Join(consumers, ", "))
+}
@@ -0,0 +1,239 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate consumers tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		bundleName = "maroonedpods-server-signer-bundle"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		certs  []cert.CertificateDefinition
+		cancel context.CancelFunc
+	)
+
+	isController := true
+
+	podSpec := func(mutate func(*corev1.PodSpec)) corev1.PodTemplateSpec {
+		template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "c"}}}}
+		mutate(&template.Spec)
+		return template
+	}
+
+	create := func(objects ...runtime.Object) {
+		for _, obj := range objects {
+			Expect(client.Tracker().Add(obj)).To(Succeed())
+		}
+	}
+
+	managedObject := func(kind, name string) ManagedCert {
+		managed, _ := cm.ListManagedCertificates(context.TODO())
+		for _, m := range managed {
+			if m.Ref.Kind == kind && m.Ref.Name == name {
+				return m
+			}
+		}
+		Fail("no managed object " + kind + " " + name)
+		return ManagedCert{}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].DiscoverConsumers = true
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should find the volume, projected volume and env references", func() {
+		create(
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server"},
+				Spec: appsv1.DeploymentSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+					spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+					}}}
+				})},
+			},
+			&appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "agent"},
+				Spec: appsv1.DaemonSetSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+					spec.Volumes = []corev1.Volume{{Name: "trust", VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+							{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: bundleName}}},
+							{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: util.SecretResourceName}}},
+						}},
+					}}}
+				})},
+			},
+			&appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "client"},
+				Spec: appsv1.StatefulSetSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+					spec.InitContainers = []corev1.Container{{Name: "init", EnvFrom: []corev1.EnvFromSource{{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: bundleName}},
+					}}}}
+					spec.Containers[0].Env = []corev1.EnvVar{{Name: "CA", ValueFrom: &corev1.EnvVarSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: bundleName}, Key: "ca-bundle.crt"},
+					}}}
+				})},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "debug"},
+				Spec: podSpec(func(spec *corev1.PodSpec) {
+					spec.Containers[0].Env = []corev1.EnvVar{{Name: "CERT", ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: util.SecretResourceName}, Key: "tls.crt"},
+					}}}
+				}).Spec,
+			},
+			// reported through its deployment
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server-abc-xyz", OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "server-abc", Controller: &isController,
+				}}},
+				Spec: podSpec(func(spec *corev1.PodSpec) {
+					spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+					}}}
+				}).Spec,
+			},
+			// other namespaces can't reference them
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "server"},
+				Spec: appsv1.DeploymentSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+					spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+					}}}
+				})},
+			},
+		)
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		target := managedObject("Secret", util.SecretResourceName)
+		Expect(target.ConsumersError).To(BeEmpty())
+		Expect(target.Consumers).To(Equal([]CertConsumer{
+			{Kind: "DaemonSet", Namespace: namespace, Name: "agent", Via: []CertConsumerReference{CertConsumerProjectedVolume}},
+			{Kind: "Deployment", Namespace: namespace, Name: "server", Via: []CertConsumerReference{CertConsumerVolume}},
+			{Kind: "Pod", Namespace: namespace, Name: "debug", Via: []CertConsumerReference{CertConsumerEnv}},
+		}))
+
+		bundle := managedObject("ConfigMap", bundleName)
+		Expect(bundle.Consumers).To(Equal([]CertConsumer{
+			{Kind: "DaemonSet", Namespace: namespace, Name: "agent", Via: []CertConsumerReference{CertConsumerProjectedVolume}},
+			{Kind: "StatefulSet", Namespace: namespace, Name: "client", Via: []CertConsumerReference{CertConsumerEnv}},
+		}))
+
+		Expect(managedObject("Secret", "maroonedpods-server").Consumers).To(BeEmpty())
+	})
+
+	It("should name the consumers when the certificate rotates", func() {
+		create(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server"},
+			Spec: appsv1.DeploymentSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+				spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+				}}}
+			})},
+		})
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		Eventually(func() []string {
+			events, err := client.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			var messages []string
+			for _, event := range events.Items {
+				if event.Reason == "CertificateConsumers" {
+					messages = append(messages, event.Message)
+				}
+			}
+			return messages
+		}).Should(ConsistOf(ContainSubstring("Deployment " + namespace + "/server")))
+	})
+
+	It("should rediscover once per interval", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(managedObject("Secret", util.SecretResourceName).Consumers).To(BeEmpty())
+
+		create(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server"},
+			Spec: appsv1.DeploymentSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+				spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+				}}}
+			})},
+		})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(managedObject("Secret", util.SecretResourceName).Consumers).To(BeEmpty())
+
+		clock.Step(consumerDiscoveryInterval)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(managedObject("Secret", util.SecretResourceName).Consumers).To(HaveLen(1))
+	})
+
+	It("should degrade gracefully when RBAC denies listing workloads", func() {
+		create(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "server"},
+			Spec: appsv1.DeploymentSpec{Template: podSpec(func(spec *corev1.PodSpec) {
+				spec.Volumes = []corev1.Volume{{Name: "tls", VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{SecretName: util.SecretResourceName},
+				}}}
+			})},
+		})
+		client.PrependReactor("list", "daemonsets", func(testingclient.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "daemonsets"}, "", nil)
+		})
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		target := managedObject("Secret", util.SecretResourceName)
+		Expect(target.ConsumersError).To(Equal("listing daemonsets is forbidden"))
+		// the kinds that can be listed are still reported
+		Expect(target.Consumers).To(ConsistOf(HaveField("Name", "server")))
+	})
+
+	It("should not list workloads unless a definition asks for it", func() {
+		for i := range certs {
+			certs[i].DiscoverConsumers = false
+		}
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		for _, action := range client.Actions() {
+			Expect(action.GetResource().Resource).ToNot(BeElementOf("deployments", "daemonsets", "statefulsets", "pods"))
+		}
+	})
+})
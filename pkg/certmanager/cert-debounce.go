@@ -0,0 +1,158 @@
+package certmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// defaultSyncDebounce is how long the outcome of a successful sync is reused for the same definitions
+// while none of their objects changed
+const defaultSyncDebounce = 30 * time.Second
+
+// syncDebounce parses the debounce window of the value of the env variable, 0 disables the debounce
+func syncDebounce(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultSyncDebounce, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if window < 0 {
+		return 0, fmt.Errorf("the debounce window %s is negative", value)
+	}
+	return window, nil
+}
+
+// debounceState is what a successful sync was based on
+type debounceState struct {
+	hash string
+	// objectEvents when the sync started
+	events uint64
+	at     time.Time
+}
+
+// definitionsHash returns a stable hash of the definitions
+func definitionsHash(certs []mpcerts.CertificateDefinition) (string, error) {
+	data, err := json.Marshal(certs)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// watchedKeysOf returns the kind/namespace/name of the objects a sync of the definition reads from the
+// listers
+func watchedKeysOf(cd mpcerts.CertificateDefinition) []string {
+	var keys []string
+	for _, secret := range []*corev1.Secret{cd.SignerSecret, cd.TargetSecret, cd.SplitKeySecret} {
+		if secret != nil {
+			keys = append(keys, "Secret/"+secret.Namespace+"/"+secret.Name)
+		}
+	}
+	if cd.KeystorePasswordSecret != nil && cd.TargetSecret != nil {
+		keys = append(keys, "Secret/"+cd.TargetSecret.Namespace+"/"+cd.KeystorePasswordSecret.Name)
+	}
+	if cd.EmitKubeconfig != nil && cd.EmitKubeconfig.CAConfigMap != nil && cd.TargetSecret != nil {
+		keys = append(keys, "ConfigMap/"+cd.TargetSecret.Namespace+"/"+cd.EmitKubeconfig.CAConfigMap.Name)
+	}
+	if bundle := cd.CertBundleConfigmap; bundle != nil {
+		keys = append(keys, "ConfigMap/"+bundle.Namespace+"/"+bundle.Name)
+		if cd.IncludeKubeRootCA {
+			keys = append(keys, "ConfigMap/"+bundle.Namespace+"/"+kubeRootCAConfigMap)
+		}
+		if cd.TrustBundle != nil {
+			keys = append(keys, "ConfigMap/"+bundle.Namespace+"/"+cd.TrustBundle.Source)
+		}
+	}
+	return keys
+}
+
+// informerHandler counts the events of the objects of the last definitions and evicts the deleted
+// objects from the parse cache
+func (cm *certManager) informerHandler() toolscache.ResourceEventHandler {
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc: cm.countObjectEvent,
+		UpdateFunc: func(_, obj interface{}) {
+			cm.countObjectEvent(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			cm.parseCache.forget(obj)
+			cm.countObjectEvent(obj)
+		},
+	}
+}
+
+func (cm *certManager) countObjectEvent(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	kind := "Secret"
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		kind = "ConfigMap"
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	// every object counts until the first sync
+	watched, _ := cm.watchedKeys.Load().(sets.String)
+	if watched == nil || watched.Has(kind+"/"+accessor.GetNamespace()+"/"+accessor.GetName()) {
+		cm.objectEvents.Add(1)
+	}
+}
+
+// debounced tells whether the sync of the definitions of the hash can be skipped: the last sync of the
+// same definitions succeeded within the window, none of their objects changed since and no
+// certificate is due for rotation or forced to rotate. Otherwise it returns the state to record once
+// the sync succeeded.
+func (cm *certManager) debounced(hash string) (bool, *debounceState) {
+	state := &debounceState{hash: hash, events: cm.objectEvents.Load(), at: cm.clock.Now()}
+
+	cm.debounceLock.Lock()
+	defer cm.debounceLock.Unlock()
+	last := cm.lastSync
+	if cm.syncDebounce <= 0 || hash == "" || last == nil || len(cm.forcedRotations) > 0 {
+		return false, state
+	}
+	elapsed := state.at.Sub(last.at)
+	if last.hash != hash || last.events != state.events || elapsed >= cm.syncDebounce || elapsed >= cm.nextRefresh {
+		return false, state
+	}
+	return true, nil
+}
+
+// recordDebounce records the state of a sync, a failed sync isn't reused
+func (cm *certManager) recordDebounce(certs []mpcerts.CertificateDefinition, state *debounceState, err error) {
+	watched := sets.NewString()
+	for _, cd := range certs {
+		watched.Insert(watchedKeysOf(cd)...)
+	}
+	cm.watchedKeys.Store(watched)
+
+	cm.debounceLock.Lock()
+	defer cm.debounceLock.Unlock()
+	if err != nil {
+		cm.lastSync = nil
+		return
+	}
+	cm.lastSync = state
+}
+
+// resetDebounce makes the next sync run
+func (cm *certManager) resetDebounce() {
+	cm.debounceLock.Lock()
+	defer cm.debounceLock.Unlock()
+	cm.lastSync = nil
+}
@@ -0,0 +1,182 @@
+package certmanager
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// countingSecretLister counts the reads of the secret lister
+type countingSecretLister struct {
+	listerscorev1.SecretLister
+	reads *atomic.Int32
+}
+
+func (l *countingSecretLister) List(selector labels.Selector) ([]*corev1.Secret, error) {
+	l.reads.Add(1)
+	return l.SecretLister.List(selector)
+}
+
+func (l *countingSecretLister) Secrets(namespace string) listerscorev1.SecretNamespaceLister {
+	l.reads.Add(1)
+	return l.SecretLister.Secrets(namespace)
+}
+
+// countingConfigMapLister counts the reads of the configmap lister
+type countingConfigMapLister struct {
+	listerscorev1.ConfigMapLister
+	reads *atomic.Int32
+}
+
+func (l *countingConfigMapLister) List(selector labels.Selector) ([]*corev1.ConfigMap, error) {
+	l.reads.Add(1)
+	return l.ConfigMapLister.List(selector)
+}
+
+func (l *countingConfigMapLister) ConfigMaps(namespace string) listerscorev1.ConfigMapNamespaceLister {
+	l.reads.Add(1)
+	return l.ConfigMapLister.ConfigMaps(namespace)
+}
+
+var _ = Describe("sync debounce tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		certs  []cert.CertificateDefinition
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.syncDebounce = defaultSyncDebounce
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	apiCalls := func(certs []cert.CertificateDefinition) int {
+		before := len(client.Actions())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		return len(client.Actions()) - before
+	}
+
+	// syncs until the informers delivered the writes of the syncs and a sync is skipped
+	settle := func() {
+		Eventually(func() int {
+			return apiCalls(certs)
+		}, 10*time.Second, 200*time.Millisecond).Should(BeZero())
+	}
+
+	It("should do no lister or API work within the window", func() {
+		settle()
+
+		var reads atomic.Int32
+		cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+			for key, listers := range listerMap {
+				counting := &certListers{secretLister: &countingSecretLister{SecretLister: listers.secretLister, reads: &reads}}
+				if listers.configMapLister != nil {
+					counting.configMapLister = &countingConfigMapLister{ConfigMapLister: listers.configMapLister, reads: &reads}
+				}
+				listerMap[key] = counting
+			}
+		})
+		Expect(apiCalls(certs)).To(BeZero())
+		Expect(reads.Load()).To(BeZero())
+	})
+
+	It("should sync again once a managed secret changed", func() {
+		settle()
+
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		secret.Annotations["edited"] = "true"
+		secret, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+
+		Expect(apiCalls(certs)).ToNot(BeZero())
+	})
+
+	It("should sync changed definitions", func() {
+		settle()
+
+		changed := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		changed[0].TargetExtraSANs = []string{"maroonedpods.example.com"}
+		Expect(apiCalls(changed)).ToNot(BeZero())
+	})
+
+	It("should not debounce forced rotations", func() {
+		settle()
+
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+		Expect(apiCalls(certs)).ToNot(BeZero())
+	})
+
+	It("should sync again after the window", func() {
+		settle()
+
+		clock.Step(defaultSyncDebounce)
+		Expect(apiCalls(certs)).ToNot(BeZero())
+	})
+
+	It("should not debounce when disabled", func() {
+		settle()
+
+		cm.syncDebounce = 0
+		Expect(apiCalls(certs)).ToNot(BeZero())
+	})
+
+	It("should hash equal definitions equally", func() {
+		hash, err := definitionsHash(certs)
+		Expect(err).ToNot(HaveOccurred())
+		again, err := definitionsHash(cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(Equal(hash))
+
+		certs[0].TargetConfig.Refresh -= time.Minute
+		changed, err := definitionsHash(certs)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).ToNot(Equal(hash))
+	})
+
+	DescribeTable("should parse the window", func(value string, expected time.Duration, valid bool) {
+		window, err := syncDebounce(value)
+		if !valid {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(window).To(Equal(expected))
+	},
+		Entry("by default", "", defaultSyncDebounce, true),
+		Entry("disabled", "0", time.Duration(0), true),
+		Entry("a duration", "2m", 2*time.Minute, true),
+		Entry("negative", "-1s", time.Duration(0), false),
+		Entry("invalid", "soon", time.Duration(0), false),
+	)
+})
@@ -0,0 +1,216 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	combinedPEMKey = "tls-combined.pem"
+
+	// annCustomKeys lists the custom data keys written into the target secret, so they are
+	// removed when the override is renamed or removed
+	annCustomKeys = "operator.maroonedpods.io/customKeys"
+)
+
+// derivedKeysSecretsGetter sets the keys derived from tls.crt/tls.key in the same request that
+// rotates them, so consumers never see a derived key that doesn't match the key pair
+type derivedKeysSecretsGetter struct {
+	corev1client.SecretsGetter
+	setDerivedKeys func(secret *corev1.Secret) error
+}
+
+func (g *derivedKeysSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &derivedKeysSecrets{
+		SecretInterface: g.SecretsGetter.Secrets(namespace),
+		setDerivedKeys:  g.setDerivedKeys,
+	}
+}
+
+type derivedKeysSecrets struct {
+	corev1client.SecretInterface
+	setDerivedKeys func(secret *corev1.Secret) error
+}
+
+func (s *derivedKeysSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	secret = secret.DeepCopy()
+	if err := s.setDerivedKeys(secret); err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Create(ctx, secret, opts)
+}
+
+func (s *derivedKeysSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	secret = secret.DeepCopy()
+	if err := s.setDerivedKeys(secret); err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Update(ctx, secret, opts)
+}
+
+// targetSecretsClient is the client the target rotation writes through
+func (cm *certManager) targetSecretsClient(cd mpcerts.CertificateDefinition) corev1client.SecretsGetter {
+	return &derivedKeysSecretsGetter{
+		SecretsGetter: cm.splitKeyClient(cd, cm.coreClient(mpcerts.ManagementCluster)),
+		setDerivedKeys: func(secret *corev1.Secret) error {
+			return cm.setDerivedKeys(cd, secret)
+		},
+	}
+}
+
+func (cm *certManager) setDerivedKeys(cd mpcerts.CertificateDefinition, secret *corev1.Secret) error {
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+
+	if err := cm.setKeystore(cd, secret); err != nil {
+		return err
+	}
+
+	if err := setCombinedPEM(cd, secret); err != nil {
+		return err
+	}
+
+	if err := cm.setKubeconfig(cd, secret); err != nil {
+		return err
+	}
+
+	setCustomKeys(cd, secret)
+	return nil
+}
+
+// ensureDerivedKeys updates the derived keys of a target that was not rotated, e.g. when an
+// output format was turned on or off
+func (cm *certManager) ensureDerivedKeys(ctx context.Context, cd mpcerts.CertificateDefinition) error {
+	if len(cd.OutputFormats) == 0 && cd.CertKeyName == "" && cd.KeyKeyName == "" && cd.EmitKubeconfig == nil {
+		listers, err := cm.listersFor(clusterNamespace{namespace: cd.TargetSecret.Namespace})
+		if err != nil {
+			return err
+		}
+		cached, err := listers.secretLister.Secrets(cd.TargetSecret.Namespace).Get(cd.TargetSecret.Name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if !hasDerivedKeys(cached) {
+			return nil
+		}
+	}
+
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(cd.TargetSecret.Namespace)
+	// the target may just have been rotated, don't wait for the lister
+	secret, err := client.Get(ctx, cd.TargetSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	secretCpy := secret.DeepCopy()
+	if err := cm.setDerivedKeys(cd, secretCpy); err != nil {
+		return err
+	}
+
+	if !secretChanged(secret, secretCpy) {
+		return nil
+	}
+
+	log.Info("Updating derived keys of target secret", "secret", secret.Name, "namespace", secret.Namespace)
+	_, err = cm.applySecret(ctx, secret, secretCpy)
+	return err
+}
+
+func hasDerivedKeys(secret *corev1.Secret) bool {
+	if _, ok := secret.Annotations[annKeystoreSource]; ok {
+		return true
+	}
+	if _, ok := secret.Annotations[annCustomKeys]; ok {
+		return true
+	}
+	if _, ok := secret.Data[kubeconfigKey]; ok {
+		return true
+	}
+	_, ok := secret.Data[combinedPEMKey]
+	return ok
+}
+
+// setCombinedPEM sets the key followed by the leaf, and the chain if requested, in the target secret
+func setCombinedPEM(cd mpcerts.CertificateDefinition, secret *corev1.Secret) error {
+	if !cd.HasOutputFormat(mpcerts.OutputFormatCombinedPEM) {
+		delete(secret.Data, combinedPEMKey)
+		return nil
+	}
+
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil
+	}
+
+	if !cd.CombinedPEMWithChain {
+		certs, err := crypto.CertsFromPEM(certPEM)
+		if err != nil {
+			return err
+		}
+		if certPEM, err = crypto.EncodeCertificates(certs[0]); err != nil {
+			return err
+		}
+	}
+
+	var combined bytes.Buffer
+	combined.Write(keyPEM)
+	if !bytes.HasSuffix(keyPEM, []byte("\n")) {
+		combined.WriteByte('\n')
+	}
+	combined.Write(certPEM)
+
+	secret.Data[combinedPEMKey] = combined.Bytes()
+	return nil
+}
+
+// setCustomKeys mirrors tls.crt/tls.key into the custom data keys of the target
+func setCustomKeys(cd mpcerts.CertificateDefinition, secret *corev1.Secret) {
+	custom := map[string]string{}
+	if cd.CertKeyName != "" && cd.CertKeyName != corev1.TLSCertKey {
+		custom[cd.CertKeyName] = corev1.TLSCertKey
+	}
+	if cd.KeyKeyName != "" && cd.KeyKeyName != corev1.TLSPrivateKeyKey {
+		custom[cd.KeyKeyName] = corev1.TLSPrivateKeyKey
+	}
+
+	if previous, ok := secret.Annotations[annCustomKeys]; ok {
+		for _, key := range strings.Split(previous, ",") {
+			if _, ok := custom[key]; !ok && key != corev1.TLSCertKey && key != corev1.TLSPrivateKeyKey {
+				delete(secret.Data, key)
+			}
+		}
+		delete(secret.Annotations, annCustomKeys)
+	}
+
+	if len(custom) == 0 {
+		return
+	}
+
+	var keys []string
+	for key, source := range custom {
+		if value, ok := secret.Data[source]; ok {
+			secret.Data[key] = value
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annCustomKeys] = strings.Join(keys, ",")
+}
@@ -0,0 +1,236 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("derived keys tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(withChain bool, formats ...cert.OutputFormat) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].OutputFormats = formats
+			certs[i].CombinedPEMWithChain = withChain
+		}
+		return certs
+	}
+
+	getTarget := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	expectCombinedPEM := func(secret *corev1.Secret) tls.Certificate {
+		combined := secret.Data[combinedPEMKey]
+		Expect(combined).ToNot(BeEmpty())
+
+		// fails if the key doesn't match the leaf
+		pair, err := tls.X509KeyPair(combined, combined)
+		Expect(err).ToNot(HaveOccurred())
+
+		certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pair.Certificate[0]).To(Equal(certs[0].Raw))
+		return pair
+	}
+
+	forceRotation := func() {
+		expired := getTarget()
+		expired.Annotations[certrotation.CertificateNotAfterAnnotation] = time.Now().Format(time.RFC3339)
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), expired, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, expired)
+		client.ClearActions()
+	}
+
+	countTargetUpdates := func() int {
+		updates := 0
+		for _, action := range client.Actions() {
+			if update, ok := action.(testingclient.UpdateAction); ok && action.GetResource().Resource == "secrets" {
+				if update.GetObject().(*corev1.Secret).Name == util.SecretResourceName {
+					updates++
+				}
+			}
+		}
+		return updates
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should keep the combined PEM matching over consecutive rotations", func() {
+		certs := newCerts(false, cert.OutputFormatCombinedPEM)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		pair := expectCombinedPEM(getTarget())
+		Expect(pair.Certificate).To(HaveLen(1))
+		previous := getTarget().Data[corev1.TLSCertKey]
+
+		for i := 0; i < 2; i++ {
+			forceRotation()
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+			secret := getTarget()
+			Expect(secret.Data[corev1.TLSCertKey]).ToNot(Equal(previous))
+			expectCombinedPEM(secret)
+			// written together with the rotated key pair
+			Expect(countTargetUpdates()).To(Equal(1))
+			previous = secret.Data[corev1.TLSCertKey]
+		}
+	})
+
+	It("should append the chain when requested", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(true, cert.OutputFormatCombinedPEM))).To(Succeed())
+
+		secret := getTarget()
+		certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(expectCombinedPEM(secret).Certificate).To(HaveLen(len(certs)))
+	})
+
+	It("should add the combined PEM to an existing target", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		before := getTarget()
+		Expect(before.Data).ToNot(HaveKey(combinedPEMKey))
+		waitForSecretInLister(cm, before)
+
+		Expect(cm.Sync(context.TODO(), newCerts(false, cert.OutputFormatCombinedPEM))).To(Succeed())
+
+		after := getTarget()
+		Expect(after.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+		expectCombinedPEM(after)
+	})
+
+	It("should remove the combined PEM when turned off", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false, cert.OutputFormatCombinedPEM))).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data).ToNot(HaveKey(combinedPEMKey))
+		Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+	})
+
+	Context("custom key names", func() {
+		newCustomCerts := func(certKeyName, keyKeyName string) []cert.CertificateDefinition {
+			certs := newCerts(false)
+			for i := range certs {
+				certs[i].CertKeyName = certKeyName
+				certs[i].KeyKeyName = keyKeyName
+			}
+			return certs
+		}
+
+		expectCustomKeys := func(secret *corev1.Secret) {
+			Expect(secret.Data["server.crt"]).To(Equal(secret.Data[corev1.TLSCertKey]))
+			Expect(secret.Data["server.key"]).To(Equal(secret.Data[corev1.TLSPrivateKeyKey]))
+			Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+			Expect(secret.Data[corev1.TLSPrivateKeyKey]).ToNot(BeEmpty())
+		}
+
+		It("should keep the custom keys in sync over consecutive rotations", func() {
+			certs := newCustomCerts("server.crt", "server.key")
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			expectCustomKeys(getTarget())
+			previous := getTarget().Data[corev1.TLSCertKey]
+
+			for i := 0; i < 2; i++ {
+				forceRotation()
+				Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+				secret := getTarget()
+				Expect(secret.Data[corev1.TLSCertKey]).ToNot(Equal(previous))
+				expectCustomKeys(secret)
+				Expect(countTargetUpdates()).To(Equal(1))
+				previous = secret.Data[corev1.TLSCertKey]
+			}
+		})
+
+		It("should not write the custom keys again on repeated syncs", func() {
+			certs := newCustomCerts("server.crt", "server.key")
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			before := getTarget()
+			waitForSecretInLister(cm, before)
+			client.ClearActions()
+
+			for i := 0; i < 3; i++ {
+				Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			}
+
+			Expect(countTargetUpdates()).To(BeZero())
+			after := getTarget()
+			Expect(after.Data).To(HaveLen(len(before.Data)))
+			Expect(after.Annotations[annCustomKeys]).To(Equal("server.crt,server.key"))
+			expectCustomKeys(after)
+		})
+
+		It("should add the custom keys to an existing target", func() {
+			Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+			before := getTarget()
+			waitForSecretInLister(cm, before)
+
+			Expect(cm.Sync(context.TODO(), newCustomCerts("server.crt", "server.key"))).To(Succeed())
+
+			after := getTarget()
+			Expect(after.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+			expectCustomKeys(after)
+		})
+
+		It("should remove the custom keys when the override is removed", func() {
+			Expect(cm.Sync(context.TODO(), newCustomCerts("server.crt", "server.key"))).To(Succeed())
+			waitForSecretInLister(cm, getTarget())
+
+			Expect(cm.Sync(context.TODO(), newCustomCerts("", ""))).To(Succeed())
+
+			secret := getTarget()
+			Expect(secret.Data).ToNot(HaveKey("server.crt"))
+			Expect(secret.Data).ToNot(HaveKey("server.key"))
+			Expect(secret.Annotations).ToNot(HaveKey(annCustomKeys))
+			Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+		})
+
+		It("should remove the previous custom key when it is renamed", func() {
+			Expect(cm.Sync(context.TODO(), newCustomCerts("server.crt", ""))).To(Succeed())
+			waitForSecretInLister(cm, getTarget())
+
+			Expect(cm.Sync(context.TODO(), newCustomCerts("cert.pem", ""))).To(Succeed())
+
+			secret := getTarget()
+			Expect(secret.Data).ToNot(HaveKey("server.crt"))
+			Expect(secret.Data["cert.pem"]).To(Equal(secret.Data[corev1.TLSCertKey]))
+		})
+	})
+})
@@ -0,0 +1,121 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate duration tests", func() {
+	const namespace = "maroonedpods"
+
+	DescribeTable("should parse", func(s string, expected time.Duration) {
+		d, err := cert.ParseDuration(s)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(d).To(Equal(expected))
+
+		// the canonical representation parses to the same duration
+		roundTrip, err := cert.ParseDuration(cert.FormatDuration(d))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(roundTrip).To(Equal(d))
+	},
+		Entry("Go syntax", "8760h", 8760*time.Hour),
+		Entry("Go syntax with minutes", "1h30m", 90*time.Minute),
+		Entry("canonical", "48h0m0s", 48*time.Hour),
+		Entry("zero", "0", time.Duration(0)),
+		Entry("days", "1d", 24*time.Hour),
+		Entry("fractional days", "1.5d", 36*time.Hour),
+		Entry("years", "1y", 365*24*time.Hour),
+		Entry("years and days", "1y30d", 395*24*time.Hour),
+		Entry("days and hours", "2d12h", 60*time.Hour),
+	)
+
+	DescribeTable("should reject", func(s string) {
+		_, err := cert.ParseDuration(s)
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("empty", ""),
+		Entry("no unit", "365"),
+		Entry("unknown unit", "1w"),
+		Entry("no number", "d"),
+		Entry("a trailing number", "1d12"),
+		Entry("a space", "1d 12h"),
+		Entry("an overflow", "300y"),
+		Entry("an overflow of the sum", "290y290y"),
+	)
+
+	DescribeTable("should format equivalent spellings the same", func(a, b string) {
+		da, err := cert.ParseDuration(a)
+		Expect(err).ToNot(HaveOccurred())
+		db, err := cert.ParseDuration(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.FormatDuration(da)).To(Equal(cert.FormatDuration(db)))
+	},
+		Entry("a day", "24h", "1d"),
+		Entry("a year", "8760h", "1y"),
+		Entry("a year in days", "365d", "1y"),
+		Entry("hours and minutes", "90m", "1h30m"),
+	)
+
+	Context("in the CR", func() {
+		It("should return the duration", func() {
+			parsed, err := cert.ParseCertDuration("ca.duration", &metav1.Duration{Duration: cert.Year})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*parsed).To(Equal(cert.Year))
+
+			parsed, err = cert.ParseCertDuration("ca.duration", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(BeNil())
+		})
+
+		DescribeTable("should reject", func(value time.Duration) {
+			_, err := cert.ParseCertDuration("server.renewBefore", &metav1.Duration{Duration: value})
+			Expect(err).To(MatchError(ContainSubstring("certConfig.server.renewBefore")))
+		},
+			Entry("zero", time.Duration(0)),
+			Entry("negative", -24*time.Hour),
+		)
+	})
+
+	It("should not rotate for an equivalent spelling of the config", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+		certsFor := func(signerDuration, targetDuration string) []cert.CertificateDefinition {
+			args := &cert.FactoryArgs{Namespace: namespace}
+			signer, err := cert.ParseDuration(signerDuration)
+			Expect(err).ToNot(HaveOccurred())
+			target, err := cert.ParseDuration(targetDuration)
+			Expect(err).ToNot(HaveOccurred())
+			args.SignerDuration, err = cert.ParseCertDuration("ca.duration", &metav1.Duration{Duration: signer})
+			Expect(err).ToNot(HaveOccurred())
+			args.TargetDuration, err = cert.ParseCertDuration("server.duration", &metav1.Duration{Duration: target})
+			Expect(err).ToNot(HaveOccurred())
+			return cert.CreateCertificateDefinitions(args)
+		}
+
+		Expect(cm.Sync(context.TODO(), certsFor("2d", "24h"))).To(Succeed())
+		signerNotBefore := getCertNotBefore(client, namespace, "maroonedpods-server")
+		targetNotBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		targetConfig := getCertConfigAnno(client, namespace, util.SecretResourceName)
+		Expect(targetConfig).To(ContainSubstring(`"lifetime":"24h0m0s"`))
+
+		// certificates issued within the same second have the same NotBefore
+		time.Sleep(time.Second)
+		Expect(cm.Sync(context.TODO(), certsFor("48h", "1d"))).To(Succeed())
+		Expect(getCertNotBefore(client, namespace, "maroonedpods-server")).To(Equal(signerNotBefore))
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(targetNotBefore))
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(targetConfig))
+	})
+})
@@ -0,0 +1,74 @@
+package certmanager
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+func extKeyUsagesFor(extKeyUsages mpcerts.ExtendedKeyUsages) ([]x509.ExtKeyUsage, error) {
+	switch extKeyUsages {
+	case mpcerts.ExtendedKeyUsagesServer:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil
+	case mpcerts.ExtendedKeyUsagesClient:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil
+	case mpcerts.ExtendedKeyUsagesBoth:
+		return []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, nil
+	}
+	return nil, fmt.Errorf("unknown extended key usages %q", extKeyUsages)
+}
+
+// setExtKeyUsages overrides the extended key usages of a serving certificate before it is signed
+func setExtKeyUsages(extKeyUsages mpcerts.ExtendedKeyUsages) crypto.CertificateExtensionFunc {
+	return func(template *x509.Certificate) error {
+		if extKeyUsages == "" {
+			return nil
+		}
+		usages, err := extKeyUsagesFor(extKeyUsages)
+		if err != nil {
+			return err
+		}
+		template.ExtKeyUsage = usages
+		return nil
+	}
+}
+
+// extKeyUsagesRotation re-signs the leaf of the wrapped creator with the requested extended key usages
+type extKeyUsagesRotation struct {
+	certrotation.TargetCertCreator
+	extKeyUsages mpcerts.ExtendedKeyUsages
+}
+
+func (r *extKeyUsagesRotation) NewCertificate(signer *crypto.CA, validity time.Duration) (*crypto.TLSCertificateConfig, error) {
+	usages, err := extKeyUsagesFor(r.extKeyUsages)
+	if err != nil {
+		return nil, err
+	}
+
+	certKeyPair, err := r.TargetCertCreator.NewCertificate(signer, validity)
+	if err != nil {
+		return nil, err
+	}
+
+	template := certKeyPair.Certs[0]
+	template.ExtKeyUsage = usages
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.Config.Certs[0], template.PublicKey, signer.Config.Key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto.TLSCertificateConfig{
+		Certs: append([]*x509.Certificate{leaf}, certKeyPair.Certs[1:]...),
+		Key:   certKeyPair.Key,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("extended key usage tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(extKeyUsages cert.ExtendedKeyUsages) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].ExtendedKeyUsages = extKeyUsages
+		}
+		return certs
+	}
+
+	newClientCerts := func(extKeyUsages cert.ExtendedKeyUsages) []cert.CertificateDefinition {
+		certs := newCerts(extKeyUsages)
+		certs[0].TargetService = nil
+		certs[0].TargetUser = &[]string{"maroonedpods-controller"}[0]
+		return certs
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	getLeaf := func() *x509.Certificate {
+		certs, err := crypto.CertsFromPEM(getSecret(util.SecretResourceName).Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certs[0]
+	}
+
+	verify := func(leaf *x509.Certificate, usage x509.ExtKeyUsage) error {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "maroonedpods-server-signer-bundle", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM([]byte(configMap.Data["ca-bundle.crt"]))).To(BeTrue())
+		_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}})
+		return err
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should issue serving certificates for servers only by default", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(""))).To(Succeed())
+
+		Expect(getLeaf().ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth))
+	})
+
+	It("should issue serving certificates usable as client", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(cert.ExtendedKeyUsagesBoth))).To(Succeed())
+
+		leaf := getLeaf()
+		Expect(leaf.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+		Expect(leaf.DNSNames).To(ContainElement("maroonedpods-server.maroonedpods.svc"))
+		Expect(verify(leaf, x509.ExtKeyUsageServerAuth)).To(Succeed())
+		Expect(verify(leaf, x509.ExtKeyUsageClientAuth)).To(Succeed())
+	})
+
+	It("should issue client certificates usable as server", func() {
+		Expect(cm.Sync(context.TODO(), newClientCerts(cert.ExtendedKeyUsagesBoth))).To(Succeed())
+
+		leaf := getLeaf()
+		Expect(leaf.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+		Expect(leaf.Subject.CommonName).To(Equal("maroonedpods-controller"))
+		Expect(verify(leaf, x509.ExtKeyUsageServerAuth)).To(Succeed())
+		Expect(verify(leaf, x509.ExtKeyUsageClientAuth)).To(Succeed())
+	})
+
+	It("should issue client certificates for clients only by default", func() {
+		Expect(cm.Sync(context.TODO(), newClientCerts(""))).To(Succeed())
+
+		Expect(getLeaf().ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageClientAuth))
+	})
+
+	It("should re-issue the target when the extended key usages change", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(""))).To(Succeed())
+		before := getSecret(util.SecretResourceName)
+		waitForSecretInLister(cm, before)
+
+		Expect(cm.Sync(context.TODO(), newCerts(cert.ExtendedKeyUsagesBoth))).To(Succeed())
+
+		after := getSecret(util.SecretResourceName)
+		Expect(after.Data[corev1.TLSCertKey]).ToNot(Equal(before.Data[corev1.TLSCertKey]))
+		Expect(after.Annotations[annCertConfig]).To(ContainSubstring(`"extendedKeyUsages":"both"`))
+		Expect(getLeaf().ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+	})
+
+	It("should reject unknown extended key usages", func() {
+		Expect(cm.Sync(context.TODO(), newCerts("peer"))).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,97 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/events"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// operatorDeploymentLabels select the Deployment of the operator in the install namespace
+var operatorDeploymentLabels = labels.Set{"name": "maroonedpods-operator"}
+
+// eventReference returns the object the events of the cert manager are reported on: the controller of
+// the operator pod, else the operator Deployment, else the MaroonedPods CR, else the install namespace.
+// The pod is not found when the operator runs outside of the cluster, e.g. in development.
+func eventReference(ctx context.Context, k8sClient kubernetes.Interface, crReader client.Reader, namespace string) *corev1.ObjectReference {
+	// falls back to the namespace on errors
+	namespaceRef, err := events.GetControllerReferenceForCurrentPod(ctx, k8sClient, namespace, nil)
+	if err == nil {
+		log.Info("Reporting the certificate events on the controller of the operator pod", "kind", namespaceRef.Kind, "name", namespaceRef.Name)
+		return namespaceRef
+	}
+	log.V(1).Info("Unable to get the controller of the operator pod", "error", err.Error())
+
+	ref, err := operatorDeploymentReference(ctx, k8sClient, namespace)
+	if err == nil {
+		log.Info("Reporting the certificate events on the operator Deployment", "name", ref.Name)
+		return ref
+	}
+	log.V(1).Info("Unable to get the operator Deployment", "error", err.Error())
+
+	ref, err = maroonedPodsReference(ctx, crReader, namespace)
+	if err == nil {
+		log.Info("Reporting the certificate events on the MaroonedPods CR", "name", ref.Name)
+		return ref
+	}
+	log.V(1).Info("Unable to get the MaroonedPods CR", "error", err.Error())
+
+	log.Info("Reporting the certificate events on the namespace", "namespace", namespace)
+	if namespaceRef == nil {
+		namespaceRef = &corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Namespace: namespace, Name: namespace}
+	}
+	return namespaceRef
+}
+
+func operatorDeploymentReference(ctx context.Context, k8sClient kubernetes.Interface, namespace string) (*corev1.ObjectReference, error) {
+	deployments, err := k8sClient.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: operatorDeploymentLabels.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(deployments.Items) != 1 {
+		return nil, fmt.Errorf("%d Deployments labeled %s in %s", len(deployments.Items), operatorDeploymentLabels, namespace)
+	}
+	deployment := deployments.Items[0]
+	return &corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Namespace:  deployment.Namespace,
+		Name:       deployment.Name,
+		UID:        deployment.UID,
+	}, nil
+}
+
+// maroonedPodsReference refers to the active CR. It is given the namespace of the events, the apiserver
+// rejects events of a namespace about a cluster scoped object.
+func maroonedPodsReference(ctx context.Context, crReader client.Reader, namespace string) (*corev1.ObjectReference, error) {
+	if crReader == nil {
+		return nil, fmt.Errorf("no client to read the MaroonedPods CR with")
+	}
+	crs := &v1alpha1.MaroonedPodsList{}
+	if err := crReader.List(ctx, crs); err != nil {
+		return nil, err
+	}
+	for _, cr := range crs.Items {
+		if cr.Status.Phase == sdkapi.PhaseError {
+			continue
+		}
+		return &corev1.ObjectReference{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "MaroonedPods",
+			Namespace:  namespace,
+			Name:       cr.Name,
+			UID:        cr.UID,
+		}, nil
+	}
+	return nil, fmt.Errorf("no active MaroonedPods CR")
+}
@@ -0,0 +1,125 @@
+package certmanager
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("cert manager events tests", func() {
+	const namespace = "maroonedpods"
+
+	isController := true
+	operatorDeployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Namespace: namespace,
+		Name:      "maroonedpods-operator",
+		UID:       types.UID("deployment-uid"),
+		Labels:    operatorDeploymentLabels,
+	}}
+
+	newCRReader := func(crs ...client.Object) client.Reader {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(s)).To(Succeed())
+		return crfake.NewClientBuilder().WithScheme(s).WithObjects(crs...).Build()
+	}
+
+	// involvedObject emits an event with the cert manager and returns the object it was reported on
+	involvedObject := func(k8sClient *fake.Clientset, crReader client.Reader) corev1.ObjectReference {
+		cm := newCertManager(k8sClient, crReader, namespace)
+		cm.eventRecorder.Event("Test", "test event")
+
+		events, err := k8sClient.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events.Items).To(HaveLen(1))
+		return events.Items[0].InvolvedObject
+	}
+
+	BeforeEach(func() {
+		podName, set := os.LookupEnv("POD_NAME")
+		Expect(os.Unsetenv("POD_NAME")).To(Succeed())
+		DeferCleanup(func() {
+			if set {
+				Expect(os.Setenv("POD_NAME", podName)).To(Succeed())
+			}
+		})
+	})
+
+	It("should report on the controller of the operator pod", func() {
+		Expect(os.Setenv("POD_NAME", "maroonedpods-operator-abc-xyz")).To(Succeed())
+		DeferCleanup(os.Unsetenv, "POD_NAME")
+		replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "maroonedpods-operator-abc",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "Deployment", Name: operatorDeployment.Name, UID: operatorDeployment.UID, Controller: &isController,
+			}},
+		}}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "maroonedpods-operator-abc-xyz",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "ReplicaSet", Name: replicaSet.Name, Controller: &isController,
+			}},
+		}}
+
+		ref := involvedObject(fake.NewSimpleClientset(pod, replicaSet, operatorDeployment.DeepCopy()), nil)
+		Expect(ref.Kind).To(Equal("Deployment"))
+		Expect(ref.Name).To(Equal(operatorDeployment.Name))
+		Expect(ref.Namespace).To(Equal(namespace))
+		Expect(ref.UID).To(Equal(operatorDeployment.UID))
+	})
+
+	It("should report on the operator Deployment outside of a pod", func() {
+		ref := involvedObject(fake.NewSimpleClientset(operatorDeployment.DeepCopy()), nil)
+		Expect(ref.APIVersion).To(Equal("apps/v1"))
+		Expect(ref.Kind).To(Equal("Deployment"))
+		Expect(ref.Name).To(Equal(operatorDeployment.Name))
+		Expect(ref.Namespace).To(Equal(namespace))
+		Expect(ref.UID).To(Equal(operatorDeployment.UID))
+	})
+
+	It("should report on the MaroonedPods CR without the operator Deployment", func() {
+		unrelated := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "unrelated"}}
+		failed := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "failed"}}
+		failed.Status.Phase = sdkapi.PhaseError
+		active := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods", UID: types.UID("cr-uid")}}
+
+		ref := involvedObject(fake.NewSimpleClientset(unrelated), newCRReader(failed, active))
+		Expect(ref.APIVersion).To(Equal(v1alpha1.SchemeGroupVersion.String()))
+		Expect(ref.Kind).To(Equal("MaroonedPods"))
+		Expect(ref.Name).To(Equal(active.Name))
+		Expect(ref.UID).To(Equal(active.UID))
+		// the events are created in the install namespace
+		Expect(ref.Namespace).To(Equal(namespace))
+	})
+
+	It("should report on the namespace as the last resort", func() {
+		ref := involvedObject(fake.NewSimpleClientset(), newCRReader())
+		Expect(ref.Kind).To(Equal("Namespace"))
+		Expect(ref.Name).To(Equal(namespace))
+		Expect(ref.Namespace).To(Equal(namespace))
+	})
+
+	It("should not pick a Deployment when several carry the label", func() {
+		other := operatorDeployment.DeepCopy()
+		other.Name = "maroonedpods-operator-old"
+		ref := involvedObject(fake.NewSimpleClientset(operatorDeployment.DeepCopy(), other), nil)
+		Expect(ref.Kind).To(Equal("Namespace"))
+	})
+})
@@ -0,0 +1,220 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// externalCAKey is the key of a provided target secret holding the CA issuing the certificate
+const externalCAKey = "ca.crt"
+
+// ExternalCheck is a check of a provided certificate, named after its failure
+type ExternalCheck string
+
+const (
+	// ExternalCheckMissing fails for a missing secret or key of the secret
+	ExternalCheckMissing ExternalCheck = "Missing"
+	// ExternalCheckParse fails for a certificate that doesn't parse
+	ExternalCheckParse ExternalCheck = "Unparsable"
+	// ExternalCheckExpiry fails for a certificate that is not valid yet or anymore
+	ExternalCheckExpiry ExternalCheck = "Expired"
+	// ExternalCheckSAN fails for a certificate that doesn't cover the hostnames of its service
+	ExternalCheckSAN ExternalCheck = "SANMismatch"
+	// ExternalCheckKeyMismatch fails for a key that doesn't belong to the certificate
+	ExternalCheckKeyMismatch ExternalCheck = "KeyMismatch"
+	// ExternalCheckChain fails for a certificate that doesn't verify against its CA
+	ExternalCheckChain ExternalCheck = "ChainInvalid"
+	// ExternalCheckFIPS fails for a certificate with parameters FIPS mode doesn't accept
+	ExternalCheckFIPS ExternalCheck = "FIPSNonCompliant"
+)
+
+// ExternalCertificateProblem is a failed check of a provided certificate
+type ExternalCertificateProblem struct {
+	Check   ExternalCheck
+	Message string
+}
+
+// ExternalCertificateError is returned for a provided certificate that can't be used, with the
+// problem of every check it failed
+type ExternalCertificateError struct {
+	Secret   types.NamespacedName
+	Problems []ExternalCertificateProblem
+}
+
+func (e *ExternalCertificateError) Error() string {
+	return fmt.Sprintf("the provided certificate in secret %s can't be used: %s", e.Secret, problemMessages(e.Problems))
+}
+
+func problemMessages(problems []ExternalCertificateProblem) string {
+	messages := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		messages = append(messages, problem.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// externalBackend validates the target certificates provided by the user and publishes the CA
+// issuing them in the bundle configmap, it never generates key material
+type externalBackend struct {
+	cm *certManager
+}
+
+func (b *externalBackend) issue(ctx context.Context, cd mpcerts.CertificateDefinition) ([]*x509.Certificate, error) {
+	if cd.TargetSecret == nil {
+		return nil, nil
+	}
+
+	name := types.NamespacedName{Namespace: cd.TargetSecret.Namespace, Name: cd.TargetSecret.Name}
+	listers, err := b.cm.listersFor(clusterNamespace{namespace: name.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	secret, err := listers.secretLister.Secrets(name.Namespace).Get(name.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var cas []*x509.Certificate
+	var leaf *x509.Certificate
+	var problems []ExternalCertificateProblem
+	if secret == nil {
+		problems = []ExternalCertificateProblem{{Check: ExternalCheckMissing, Message: "the secret does not exist"}}
+	} else {
+		var hostnames []string
+		if cd.TargetService != nil {
+			hostnames = append(targetHostnames(*cd.TargetService, name.Namespace), cd.TargetExtraSANs...)
+		}
+		leaf, cas, problems = b.cm.validateExternalCert(secret, hostnames, b.cm.clock.Now())
+		if cd.FIPS && leaf != nil {
+			for _, problem := range fipsProblems(parametersOf(leaf)) {
+				problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckFIPS, Message: "the certificate is not FIPS compliant: " + problem})
+			}
+		}
+	}
+	b.cm.reportExternalValidation(name, leaf, problems)
+	if len(problems) > 0 {
+		return nil, &ExternalCertificateError{Secret: name, Problems: problems}
+	}
+
+	if cd.CertBundleConfigmap == nil {
+		return nil, nil
+	}
+	return b.cm.ensureCertBundle(ctx, cd, &crypto.CA{Config: &crypto.TLSCertificateConfig{Certs: cas}})
+}
+
+// reportExternalValidation sets the gauges of the provided certificate and emits an event per failed
+// check when the outcome of the validation changes, and once it recovers
+func (cm *certManager) reportExternalValidation(name types.NamespacedName, leaf *x509.Certificate, problems []ExternalCertificateProblem) {
+	expiration := 0.0
+	if leaf != nil {
+		expiration = float64(leaf.NotAfter.Unix())
+	}
+	externalCertExpiration.WithLabelValues(name.Namespace, name.Name).Set(expiration)
+	valid := 0.0
+	if len(problems) == 0 {
+		valid = 1
+	}
+	externalCertValid.WithLabelValues(name.Namespace, name.Name).Set(valid)
+
+	if cm.externalProblems == nil {
+		cm.externalProblems = make(map[string]string)
+	}
+	key := name.String()
+	current := problemMessages(problems)
+	last, validated := cm.externalProblems[key]
+	cm.externalProblems[key] = current
+	if validated && last == current {
+		return
+	}
+
+	if len(problems) == 0 {
+		if validated {
+			cm.eventRecorder.Eventf("ExternalCertificateValid", "The provided certificate in secret %s is valid again", key)
+		}
+		return
+	}
+	for _, problem := range problems {
+		cm.eventRecorder.Warningf("ExternalCertificate"+string(problem.Check), "The provided certificate in secret %s can't be used: %s", key, problem.Message)
+	}
+}
+
+// validateExternalCert checks the provided certificate of the secret is valid now, covers the hostnames,
+// matches its key and verifies against the CAs of ca.crt. It returns the certificate and the CAs when
+// they parse.
+func (cm *certManager) validateExternalCert(secret *corev1.Secret, hostnames []string, now time.Time) (*x509.Certificate, []*x509.Certificate, []ExternalCertificateProblem) {
+	var problems []ExternalCertificateProblem
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, externalCAKey} {
+		if len(secret.Data[key]) == 0 {
+			problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckMissing, Message: fmt.Sprintf("%s is missing", key)})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, nil, problems
+	}
+	parsed, err := cm.parseCerts(secret, corev1.TLSCertKey)
+	if err != nil {
+		return nil, nil, []ExternalCertificateProblem{{Check: ExternalCheckParse, Message: fmt.Sprintf("%s does not parse: %v", corev1.TLSCertKey, err)}}
+	}
+	certs, leaf := parsed.certs, parsed.certs[0]
+	parsedCAs, err := cm.parseCerts(secret, externalCAKey)
+	if err != nil {
+		return leaf, nil, []ExternalCertificateProblem{{Check: ExternalCheckParse, Message: fmt.Sprintf("%s does not parse: %v", externalCAKey, err)}}
+	}
+	cas := parsedCAs.certs
+
+	if now.Before(leaf.NotBefore) {
+		problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckExpiry,
+			Message: fmt.Sprintf("the certificate is not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))})
+	}
+	if now.After(leaf.NotAfter) {
+		problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckExpiry,
+			Message: fmt.Sprintf("the certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))})
+	}
+
+	var uncovered []string
+	for _, hostname := range hostnames {
+		if leaf.VerifyHostname(hostname) != nil {
+			uncovered = append(uncovered, hostname)
+		}
+	}
+	if len(uncovered) > 0 {
+		problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckSAN,
+			Message: fmt.Sprintf("the SANs of the certificate don't cover %s", strings.Join(uncovered, ", "))})
+	}
+
+	if _, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckKeyMismatch,
+			Message: fmt.Sprintf("%s does not match the certificate: %v", corev1.TLSPrivateKeyKey, err)})
+	}
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	// the validity is reported above
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		problems = append(problems, ExternalCertificateProblem{Check: ExternalCheckChain,
+			Message: fmt.Sprintf("the certificate does not verify against %s: %v", externalCAKey, err)})
+	}
+
+	return leaf, cas, problems
+}
@@ -0,0 +1,254 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("external certificate tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		ca     *crypto.CA
+	)
+
+	newCerts := func(external bool) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].External = external
+		return certs
+	}
+
+	provide := func(hostnames []string, notBefore, notAfter time.Time) *corev1.Secret {
+		server, err := certtest.NewServingCert(ca, hostnames, notBefore, notAfter)
+		Expect(err).ToNot(HaveOccurred())
+		secret, err := certtest.WriteProvided(context.TODO(), client, newCerts(true)[0], server, ca)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		return secret
+	}
+
+	provideValid := func() *corev1.Secret {
+		return provide(targetHostnames("maroonedpods-server", namespace), time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	}
+
+	externalError := func(err error) *ExternalCertificateError {
+		var externalErr *ExternalCertificateError
+		Expect(goerrors.As(err, &externalErr)).To(BeTrue(), "unexpected error %v", err)
+		Expect(externalErr.Secret.Name).To(Equal(util.SecretResourceName))
+		return externalErr
+	}
+
+	externalProblems := func(err error) []string {
+		var messages []string
+		for _, problem := range externalError(err).Problems {
+			messages = append(messages, problem.Message)
+		}
+		return messages
+	}
+
+	externalChecks := func(err error) []ExternalCheck {
+		var checks []ExternalCheck
+		for _, problem := range externalError(err).Problems {
+			checks = append(checks, problem.Check)
+		}
+		return checks
+	}
+
+	getBundle := func() string {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return configMap.Data[selfManagedBundleKey]
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		var err error
+		ca, err = certtest.NewCA("corporate-pki", time.Now().Add(-time.Hour), time.Now().Add(365*24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should publish the CA of a valid certificate without issuing anything", func() {
+		provided := provideValid()
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		caPEM, err := crypto.EncodeCertificates(ca.Config.Certs...)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getBundle()).To(ContainSubstring(string(caPEM)))
+
+		target, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target.Data).To(Equal(provided.Data))
+		_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), signerName, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should report a missing secret", func() {
+		err := cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalProblems(err)).To(Equal([]string{"the secret does not exist"}))
+	})
+
+	It("should report the missing keys", func() {
+		secret, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.SecretResourceName},
+			Data:       map[string][]byte{corev1.TLSCertKey: []byte("cert")},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+
+		err = cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalProblems(err)).To(Equal([]string{"tls.key is missing", "ca.crt is missing"}))
+	})
+
+	It("should report an expired certificate", func() {
+		provide(targetHostnames("maroonedpods-server", namespace), time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+
+		err := cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalChecks(err)).To(Equal([]ExternalCheck{ExternalCheckExpiry}))
+		problems := externalProblems(err)
+		Expect(problems[0]).To(HavePrefix("the certificate expired at"))
+		Expect(err.Error()).To(ContainSubstring(problems[0]))
+	})
+
+	It("should report the SANs the certificate doesn't cover", func() {
+		provide([]string{"maroonedpods-server", "maroonedpods.example.com"}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+
+		err := cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalProblems(err)).To(Equal([]string{
+			"the SANs of the certificate don't cover maroonedpods-server.maroonedpods, maroonedpods-server.maroonedpods.svc",
+		}))
+
+		certs := newCerts(true)
+		certs[0].TargetExtraSANs = []string{"maroonedpods.example.com"}
+		Expect(externalProblems(cm.Sync(context.TODO(), certs))).To(HaveLen(1))
+	})
+
+	It("should report a key of another certificate and a certificate of another CA", func() {
+		provided := provideValid()
+		other, err := certtest.NewCA("other", time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		otherServer, err := certtest.NewServingCert(other, targetHostnames("maroonedpods-server", namespace), time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		otherCert, otherKey, err := otherServer.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+
+		provided.Data[corev1.TLSPrivateKeyKey] = otherKey
+		provided, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), provided, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, provided)
+		err = cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalChecks(err)).To(Equal([]ExternalCheck{ExternalCheckKeyMismatch}))
+		Expect(externalProblems(err)[0]).To(HavePrefix("tls.key does not match the certificate"))
+
+		provided.Data[corev1.TLSCertKey] = otherCert
+		provided, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), provided, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, provided)
+		err = cm.Sync(context.TODO(), newCerts(true))
+		Expect(externalChecks(err)).To(Equal([]ExternalCheck{ExternalCheckChain}))
+		Expect(externalProblems(err)[0]).To(HavePrefix("the certificate does not verify against ca.crt"))
+	})
+
+	It("should keep the signer of the operator across a switch of the mode", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		signerNotBefore := getCertNotBefore(client, namespace, signerName)
+
+		provideValid()
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		Expect(cm.PruneOrphans(newCerts(true), false)).To(Succeed())
+		signer, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), signerName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(getCertNotBefore(client, namespace, signerName)).To(Equal(signerNotBefore))
+
+		// the provided certificate is replaced by one of the signer
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		Expect(getCertNotBefore(client, namespace, signerName)).To(Equal(signerNotBefore))
+		target, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM(target.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		signerCerts, err := crypto.CertsFromPEM(signer.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs[0].Issuer.CommonName).To(Equal(signerCerts[0].Subject.CommonName))
+	})
+
+	Context("continuous validation", func() {
+		validGauge := func() float64 {
+			var m dto.Metric
+			Expect(externalCertValid.WithLabelValues(namespace, util.SecretResourceName).Write(&m)).To(Succeed())
+			return m.GetGauge().GetValue()
+		}
+
+		expirationGauge := func() float64 {
+			var m dto.Metric
+			Expect(externalCertExpiration.WithLabelValues(namespace, util.SecretResourceName).Write(&m)).To(Succeed())
+			return m.GetGauge().GetValue()
+		}
+
+		eventCount := func(reason string) int {
+			count := 0
+			for _, action := range client.Actions() {
+				if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+					if create.GetObject().(*corev1.Event).Reason == reason {
+						count++
+					}
+				}
+			}
+			return count
+		}
+
+		It("should follow the provided certificate from valid to broken to valid", func() {
+			provided := provideValid()
+			Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+			Expect(validGauge()).To(Equal(float64(1)))
+			leaf, err := crypto.CertsFromPEM(provided.Data[corev1.TLSCertKey])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expirationGauge()).To(Equal(float64(leaf[0].NotAfter.Unix())))
+
+			// the PKI team rotates it to a certificate of another service
+			provide([]string{"other.example.com"}, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+			Expect(externalChecks(cm.Sync(context.TODO(), newCerts(true)))).To(Equal([]ExternalCheck{ExternalCheckSAN}))
+			Expect(validGauge()).To(BeZero())
+			Expect(eventCount("ExternalCertificateSANMismatch")).To(Equal(1))
+
+			// reported once
+			Expect(cm.Sync(context.TODO(), newCerts(true))).To(HaveOccurred())
+			Expect(eventCount("ExternalCertificateSANMismatch")).To(Equal(1))
+
+			provideValid()
+			Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+			Expect(validGauge()).To(Equal(float64(1)))
+			Expect(eventCount("ExternalCertificateValid")).To(Equal(1))
+		})
+	})
+})
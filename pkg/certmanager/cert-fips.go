@@ -0,0 +1,174 @@
+package certmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// the certificate was issued with parameters FIPS mode doesn't accept
+	rotationReasonFIPS = "FIPSNonCompliant"
+
+	fipsMinRSAKeySize = 2048
+)
+
+var (
+	// ErrFIPSNonCompliant is wrapped by FIPSComplianceError
+	ErrFIPSNonCompliant = goerrors.New("not FIPS compliant")
+
+	// builtinIssuanceParameters are the parameters library-go issues the built-in certificates with
+	builtinIssuanceParameters = certParameters{PublicKeyAlgorithm: x509.RSA, KeySize: 2048, SignatureAlgorithm: x509.SHA256WithRSA}
+
+	fipsECDSACurveSizes = map[int]bool{256: true, 384: true, 521: true}
+
+	fipsSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+		x509.SHA256WithRSA:    true,
+		x509.SHA384WithRSA:    true,
+		x509.SHA512WithRSA:    true,
+		x509.SHA256WithRSAPSS: true,
+		x509.SHA384WithRSAPSS: true,
+		x509.SHA512WithRSAPSS: true,
+		x509.ECDSAWithSHA256:  true,
+		x509.ECDSAWithSHA384:  true,
+		x509.ECDSAWithSHA512:  true,
+	}
+)
+
+// FIPSComplianceError is returned for a definition requesting parameters FIPS mode doesn't accept,
+// it is never issued
+type FIPSComplianceError struct {
+	Definition string
+	Problems   []string
+}
+
+func (e *FIPSComplianceError) Error() string {
+	return fmt.Sprintf("certificate definition %s is %s: %s", e.Definition, ErrFIPSNonCompliant, strings.Join(e.Problems, "; "))
+}
+
+func (e *FIPSComplianceError) Unwrap() error {
+	return ErrFIPSNonCompliant
+}
+
+// certParameters are the key and signature parameters of a certificate
+type certParameters struct {
+	PublicKeyAlgorithm x509.PublicKeyAlgorithm
+	// bits of an RSA modulus or of an ECDSA curve
+	KeySize int
+	// unknown when the issuer decides
+	SignatureAlgorithm x509.SignatureAlgorithm
+}
+
+// fipsProblems returns why the parameters aren't FIPS-acceptable, none if they are. Only RSA keys of
+// fipsMinRSAKeySize bits or more, ECDSA keys on P-256, P-384 or P-521 and RSA or ECDSA signatures with
+// SHA-256 or stronger are.
+func fipsProblems(p certParameters) []string {
+	var problems []string
+	switch p.PublicKeyAlgorithm {
+	case x509.RSA:
+		if p.KeySize < fipsMinRSAKeySize {
+			problems = append(problems, fmt.Sprintf("RSA key of %d bits, at least %d are required", p.KeySize, fipsMinRSAKeySize))
+		}
+	case x509.ECDSA:
+		if !fipsECDSACurveSizes[p.KeySize] {
+			problems = append(problems, fmt.Sprintf("ECDSA key on a %d-bit curve, P-256, P-384 or P-521 is required", p.KeySize))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s keys are not approved", p.PublicKeyAlgorithm))
+	}
+	if p.SignatureAlgorithm != x509.UnknownSignatureAlgorithm && !fipsSignatureAlgorithms[p.SignatureAlgorithm] {
+		problems = append(problems, fmt.Sprintf("%s signatures are not approved", p.SignatureAlgorithm))
+	}
+	return problems
+}
+
+// parametersOf returns the parameters the certificate was issued with
+func parametersOf(c *x509.Certificate) certParameters {
+	p := certParameters{PublicKeyAlgorithm: c.PublicKeyAlgorithm, SignatureAlgorithm: c.SignatureAlgorithm}
+	switch key := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		p.KeySize = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		p.KeySize = key.Curve.Params().BitSize
+	}
+	return p
+}
+
+// issuanceParameters returns the parameters the certificates of the definition are issued with,
+// the signature of a cert-manager.io issuer is up to the issuer
+func issuanceParameters(cd mpcerts.CertificateDefinition) certParameters {
+	if cd.Issuer == nil {
+		return builtinIssuanceParameters
+	}
+	// the cert-manager.io defaults
+	p := certParameters{PublicKeyAlgorithm: x509.RSA, KeySize: 2048}
+	if cd.PrivateKey == nil {
+		return p
+	}
+	switch cd.PrivateKey.Algorithm {
+	case mpcerts.PrivateKeyAlgorithmECDSA:
+		p = certParameters{PublicKeyAlgorithm: x509.ECDSA, KeySize: 256}
+	case mpcerts.PrivateKeyAlgorithmEd25519:
+		return certParameters{PublicKeyAlgorithm: x509.Ed25519}
+	}
+	if cd.PrivateKey.Size > 0 {
+		p.KeySize = cd.PrivateKey.Size
+	}
+	return p
+}
+
+// checkFIPSCompliance refuses a FIPS definition requesting parameters or outputs FIPS mode doesn't
+// accept, provided certificates are validated with the others
+func checkFIPSCompliance(cd mpcerts.CertificateDefinition) error {
+	if !cd.FIPS {
+		return nil
+	}
+	problems := fipsOutputProblems(cd)
+	if !cd.External {
+		problems = append(problems, fipsProblems(issuanceParameters(cd))...)
+	}
+	if len(problems) > 0 {
+		return &FIPSComplianceError{Definition: cd.Name(), Problems: problems}
+	}
+	return nil
+}
+
+// fipsOutputProblems returns the outputs of the definition FIPS mode doesn't accept. The MAC keys of the PKCS#12
+// keystores and truststores are derived with the PKCS#12 KDF FIPS mode doesn't approve, whatever their encryption.
+func fipsOutputProblems(cd mpcerts.CertificateDefinition) []string {
+	var problems []string
+	if cd.HasOutputFormat(mpcerts.OutputFormatPKCS12) {
+		problems = append(problems, "PKCS#12 keystores are not approved")
+	}
+	if cd.HasBundleOutputFormat(mpcerts.OutputFormatPKCS12) {
+		problems = append(problems, "PKCS#12 truststores are not approved")
+	}
+	return problems
+}
+
+// forceFIPSReissue rotates a certificate of a FIPS definition that was issued with parameters FIPS
+// mode doesn't accept, e.g. before FIPS mode was enabled. It returns whether it did.
+func (cm *certManager) forceFIPSReissue(cd mpcerts.CertificateDefinition, secret *corev1.Secret) bool {
+	if !cd.FIPS {
+		return false
+	}
+	// not issued yet
+	parsed, err := cm.parseCerts(secret, corev1.TLSCertKey)
+	if err != nil {
+		return false
+	}
+	problems := fipsProblems(parametersOf(parsed.certs[0]))
+	if len(problems) == 0 {
+		return false
+	}
+	log.Info("Re-issuing the certificate, it is not FIPS compliant", "secret", secret.Name, "namespace", secret.Namespace, "problems", strings.Join(problems, "; "))
+	cm.forceRotation(secret, rotationReasonFIPS)
+	return true
+}
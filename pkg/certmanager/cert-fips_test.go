@@ -0,0 +1,207 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("FIPS compliance", func() {
+	DescribeTable("should check the parameters", func(p certParameters, compliant bool) {
+		if compliant {
+			Expect(fipsProblems(p)).To(BeEmpty())
+		} else {
+			Expect(fipsProblems(p)).ToNot(BeEmpty())
+		}
+	},
+		Entry("RSA 1024", certParameters{x509.RSA, 1024, x509.SHA256WithRSA}, false),
+		Entry("RSA 2047", certParameters{x509.RSA, 2047, x509.SHA256WithRSA}, false),
+		Entry("RSA 2048", certParameters{x509.RSA, 2048, x509.SHA256WithRSA}, true),
+		Entry("RSA 3072 with SHA-384", certParameters{x509.RSA, 3072, x509.SHA384WithRSA}, true),
+		Entry("RSA 4096 with SHA-512", certParameters{x509.RSA, 4096, x509.SHA512WithRSA}, true),
+		Entry("RSA 2048 with PSS", certParameters{x509.RSA, 2048, x509.SHA256WithRSAPSS}, true),
+		Entry("RSA 2048 with SHA-1", certParameters{x509.RSA, 2048, x509.SHA1WithRSA}, false),
+		Entry("RSA 2048 with MD5", certParameters{x509.RSA, 2048, x509.MD5WithRSA}, false),
+		Entry("RSA 2048 signed by the issuer", certParameters{x509.RSA, 2048, x509.UnknownSignatureAlgorithm}, true),
+		Entry("ECDSA P-224", certParameters{x509.ECDSA, 224, x509.ECDSAWithSHA256}, false),
+		Entry("ECDSA P-256", certParameters{x509.ECDSA, 256, x509.ECDSAWithSHA256}, true),
+		Entry("ECDSA P-384", certParameters{x509.ECDSA, 384, x509.ECDSAWithSHA384}, true),
+		Entry("ECDSA P-521", certParameters{x509.ECDSA, 521, x509.ECDSAWithSHA512}, true),
+		Entry("ECDSA P-256 with SHA-1", certParameters{x509.ECDSA, 256, x509.ECDSAWithSHA1}, false),
+		Entry("Ed25519", certParameters{x509.Ed25519, 0, x509.PureEd25519}, false),
+		Entry("DSA", certParameters{x509.DSA, 2048, x509.DSAWithSHA256}, false),
+	)
+
+	DescribeTable("should check the parameters a definition requests", func(privateKey *cert.PrivateKeyParameters, issuer, compliant bool, outputs ...func(*cert.CertificateDefinition)) {
+		cd := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: "maroonedpods"})[0]
+		cd.FIPS = true
+		if issuer {
+			cd.Issuer = &cert.IssuerReference{Name: "issuer"}
+		}
+		cd.PrivateKey = privateKey
+		for _, output := range outputs {
+			output(&cd)
+		}
+
+		err := checkFIPSCompliance(cd)
+		if compliant {
+			Expect(err).ToNot(HaveOccurred())
+			return
+		}
+		Expect(err).To(MatchError(ErrFIPSNonCompliant))
+		var fipsErr *FIPSComplianceError
+		Expect(err).To(BeAssignableToTypeOf(fipsErr))
+	},
+		Entry("built-in signer", nil, false, true),
+		Entry("issuer default", nil, true, true),
+		Entry("issuer RSA 1024", &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmRSA, Size: 1024}, true, false),
+		Entry("issuer RSA 4096", &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmRSA, Size: 4096}, true, true),
+		Entry("issuer ECDSA default", &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmECDSA}, true, true),
+		Entry("issuer ECDSA 384", &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmECDSA, Size: 384}, true, true),
+		Entry("issuer Ed25519", &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmEd25519}, true, false),
+		Entry("PKCS#12 keystore", nil, false, false, func(cd *cert.CertificateDefinition) {
+			cd.OutputFormats = []cert.OutputFormat{cert.OutputFormatPKCS12}
+		}),
+		Entry("PKCS#12 truststore", nil, false, false, func(cd *cert.CertificateDefinition) {
+			cd.BundleOutputFormats = []cert.OutputFormat{cert.OutputFormatPKCS12}
+		}),
+		Entry("PKCS#12 keystore of a provided certificate", nil, false, false, func(cd *cert.CertificateDefinition) {
+			cd.External = true
+			cd.OutputFormats = []cert.OutputFormat{cert.OutputFormatPKCS12}
+		}),
+		Entry("combined PEM", nil, false, true, func(cd *cert.CertificateDefinition) {
+			cd.OutputFormats = []cert.OutputFormat{cert.OutputFormatCombinedPEM}
+		}),
+	)
+
+	It("should only refuse definitions in FIPS mode", func() {
+		cd := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: "maroonedpods"})[0]
+		cd.Issuer = &cert.IssuerReference{Name: "issuer"}
+		cd.PrivateKey = &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmEd25519}
+		Expect(checkFIPSCompliance(cd)).To(Succeed())
+	})
+
+	Context("sync", func() {
+		const namespace = "maroonedpods"
+
+		var (
+			client *fake.Clientset
+			cm     *certManager
+			cancel context.CancelFunc
+		)
+
+		fipsCerts := func(fips bool) []cert.CertificateDefinition {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			for i := range certs {
+				certs[i].FIPS = fips
+			}
+			return certs
+		}
+
+		getTarget := func() *corev1.Secret {
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return secret
+		}
+
+		targetCert := func() *x509.Certificate {
+			certs, err := crypto.CertsFromPEM(getTarget().Data[corev1.TLSCertKey])
+			Expect(err).ToNot(HaveOccurred())
+			return certs[0]
+		}
+
+		// replaces the target with one the signer issued with an RSA 1024 key, as before FIPS mode
+		weakenTarget := func() {
+			signer, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), "maroonedpods-server", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			ca, err := crypto.GetCAFromBytes(signer.Data[corev1.TLSCertKey], signer.Data[corev1.TLSPrivateKeyKey])
+			Expect(err).ToNot(HaveOccurred())
+
+			key, err := rsa.GenerateKey(rand.Reader, 1024)
+			Expect(err).ToNot(HaveOccurred())
+			current := targetCert()
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(42),
+				Subject:      pkix.Name{CommonName: current.Subject.CommonName},
+				DNSNames:     current.DNSNames,
+				NotBefore:    current.NotBefore,
+				NotAfter:     current.NotAfter,
+				KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, ca.Config.Certs[0], &key.PublicKey, ca.Config.Key)
+			Expect(err).ToNot(HaveOccurred())
+			weak, err := x509.ParseCertificate(der)
+			Expect(err).ToNot(HaveOccurred())
+			certPEM, keyPEM, err := (&crypto.TLSCertificateConfig{Certs: []*x509.Certificate{weak}, Key: key}).GetPEMBytes()
+			Expect(err).ToNot(HaveOccurred())
+
+			target := getTarget()
+			target.Data[corev1.TLSCertKey] = certPEM
+			target.Data[corev1.TLSPrivateKeyKey] = keyPEM
+			target, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), target, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, target)
+		}
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace).(*certManager)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.Start(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should issue compliant certificates", func() {
+			Expect(cm.Sync(context.TODO(), fipsCerts(true))).To(Succeed())
+			Expect(fipsProblems(parametersOf(targetCert()))).To(BeEmpty())
+		})
+
+		It("should refuse a non-compliant definition without issuing it", func() {
+			certs := fipsCerts(true)
+			certs[0].Issuer = &cert.IssuerReference{Name: "issuer"}
+			certs[0].PrivateKey = &cert.PrivateKeyParameters{Algorithm: cert.PrivateKeyAlgorithmRSA, Size: 1024}
+
+			err := cm.Sync(context.TODO(), certs)
+			Expect(err).To(MatchError(ErrFIPSNonCompliant))
+			Expect(err.Error()).To(ContainSubstring("RSA key of 1024 bits"))
+			for _, name := range []string{"maroonedpods-server", util.SecretResourceName} {
+				_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			}
+		})
+
+		It("should re-issue a certificate issued before FIPS mode", func() {
+			Expect(cm.Sync(context.TODO(), fipsCerts(false))).To(Succeed())
+			weakenTarget()
+
+			Expect(cm.Sync(context.TODO(), fipsCerts(false))).To(Succeed())
+			Expect(targetCert().SerialNumber.Int64()).To(Equal(int64(42)))
+
+			Expect(cm.Sync(context.TODO(), fipsCerts(true))).To(Succeed())
+			reissued := targetCert()
+			Expect(reissued.SerialNumber.Int64()).ToNot(Equal(int64(42)))
+			Expect(fipsProblems(parametersOf(reissued))).To(BeEmpty())
+			Expect(getTarget().Annotations).To(HaveKeyWithValue(annLastRotationReason, rotationReasonFIPS))
+		})
+	})
+})
@@ -0,0 +1,262 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// CertHistoryConfigMapName is the configmap of the install namespace the sync history of the definitions
+	// is persisted in, so it makes it into the must-gathers across restarts of the operator
+	CertHistoryConfigMapName = "maroonedpods-cert-history"
+	certHistoryKey           = "history.json"
+
+	// maxHistoryErrors is the number of errors kept by definition
+	maxHistoryErrors = 5
+	// defaultHistoryPersistInterval is the minimum time between two writes of the history configmap
+	defaultHistoryPersistInterval = 5 * time.Minute
+)
+
+// CertSyncError is a failed sync of a definition
+type CertSyncError struct {
+	Time  metav1.Time `json:"time"`
+	Error string      `json:"error"`
+}
+
+// CertSyncHistory is the recent sync history of a definition
+type CertSyncHistory struct {
+	LastSuccessTime  *metav1.Time `json:"lastSuccessTime,omitempty"`
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+	// the last maxHistoryErrors errors, the oldest first
+	Errors []CertSyncError `json:"errors,omitempty"`
+}
+
+// certHistorySummary is the content of the history configmap
+type certHistorySummary struct {
+	UpdateTime metav1.Time `json:"updateTime"`
+	// by historyKey of the definitions
+	Definitions map[string]*CertSyncHistory `json:"definitions"`
+}
+
+// historyKey identifies a definition in the history by its target, else its signer, else its bundle
+func historyKey(cd mpcerts.CertificateDefinition) string {
+	switch {
+	case cd.TargetSecret != nil:
+		return syncKey(secretRef(cd.TargetSecret))
+	case cd.SignerSecret != nil:
+		return syncKey(secretRef(cd.SignerSecret))
+	case cd.CertBundleConfigmap != nil:
+		return syncKey(corev1.ObjectReference{Kind: "ConfigMap", Namespace: cd.CertBundleConfigmap.Namespace, Name: cd.CertBundleConfigmap.Name})
+	}
+	return ""
+}
+
+func (h *CertSyncHistory) addError(syncErr CertSyncError) {
+	h.Errors = append(h.Errors, syncErr)
+	if len(h.Errors) > maxHistoryErrors {
+		h.Errors = append([]CertSyncError(nil), h.Errors[len(h.Errors)-maxHistoryErrors:]...)
+	}
+}
+
+// mergeOlder adds the history persisted by a previous operator
+func (h *CertSyncHistory) mergeOlder(older *CertSyncHistory) {
+	if h.LastSuccessTime == nil {
+		h.LastSuccessTime = older.LastSuccessTime
+	}
+	if h.LastRotationTime == nil {
+		h.LastRotationTime = older.LastRotationTime
+	}
+	errs := append(append([]CertSyncError(nil), older.Errors...), h.Errors...)
+	h.Errors = nil
+	for _, syncErr := range errs {
+		h.addError(syncErr)
+	}
+}
+
+func (h *CertSyncHistory) copy() *CertSyncHistory {
+	c := *h
+	c.Errors = append([]CertSyncError(nil), h.Errors...)
+	return &c
+}
+
+// recordHistory adds the outcome of the sync of the definition to its history, statusLock is held
+func (cm *certManager) recordHistory(cd mpcerts.CertificateDefinition, err error, rotated bool) {
+	if cm.history == nil {
+		cm.history = make(map[string]*CertSyncHistory)
+	}
+	key := historyKey(cd)
+	history, ok := cm.history[key]
+	if !ok {
+		history = &CertSyncHistory{}
+		cm.history[key] = history
+	}
+
+	now := metav1.Time{Time: cm.clock.Now()}
+	if rotated {
+		history.LastRotationTime = &now
+	}
+	if err != nil {
+		history.addError(CertSyncError{Time: now, Error: err.Error()})
+		return
+	}
+	history.LastSuccessTime = &now
+}
+
+// pruneHistory drops the history of the definitions that aren't synced anymore, statusLock is held
+func (cm *certManager) pruneHistory(certs []mpcerts.CertificateDefinition) {
+	keys := make(map[string]bool, len(certs))
+	for _, cd := range certs {
+		keys[historyKey(cd)] = true
+	}
+	for key := range cm.history {
+		if !keys[key] {
+			delete(cm.history, key)
+		}
+	}
+}
+
+// definitionHistory returns a copy of the history of the definition, nil until it is synced
+func (cm *certManager) definitionHistory(cd mpcerts.CertificateDefinition) *CertSyncHistory {
+	cm.statusLock.RLock()
+	defer cm.statusLock.RUnlock()
+	if history, ok := cm.history[historyKey(cd)]; ok {
+		return history.copy()
+	}
+	return nil
+}
+
+// certHistoryWriter persists the history into the history configmap, at most once per interval
+type certHistoryWriter struct {
+	client    kubernetes.Interface
+	namespace string
+	interval  time.Duration
+	// of the last write attempt, successful or not
+	lastWrite time.Time
+	// whether the history persisted by a previous operator was merged in
+	loaded bool
+}
+
+func newCertHistoryWriter(client kubernetes.Interface, namespace string) *certHistoryWriter {
+	return &certHistoryWriter{client: client, namespace: namespace, interval: defaultHistoryPersistInterval}
+}
+
+// persistHistory writes the history unless it was written within the interval. It only logs its
+// errors, the history is best effort and never fails a sync.
+func (cm *certManager) persistHistory() {
+	w := cm.historyWriter
+	if w == nil {
+		return
+	}
+	now := cm.clock.Now()
+	if !w.lastWrite.IsZero() && now.Sub(w.lastWrite) < w.interval {
+		return
+	}
+	w.lastWrite = now
+
+	if err := cm.loadHistory(); err != nil {
+		log.Error(err, "Failed to read the persisted certificate sync history", "configMap", CertHistoryConfigMapName)
+		return
+	}
+
+	cm.statusLock.RLock()
+	summary := certHistorySummary{UpdateTime: metav1.Time{Time: now}, Definitions: make(map[string]*CertSyncHistory, len(cm.history))}
+	for key, history := range cm.history {
+		summary.Definitions[key] = history.copy()
+	}
+	cm.statusLock.RUnlock()
+
+	if err := w.write(summary); err != nil {
+		log.Error(err, "Failed to persist the certificate sync history", "configMap", CertHistoryConfigMapName)
+	}
+}
+
+// loadHistory merges the history persisted by a previous operator into the one of the syncs, once
+func (cm *certManager) loadHistory() error {
+	w := cm.historyWriter
+	if w.loaded {
+		return nil
+	}
+	configMap, err := w.client.CoreV1().ConfigMaps(w.namespace).Get(context.TODO(), CertHistoryConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		w.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.loaded = true
+
+	persisted := &certHistorySummary{}
+	if err := json.Unmarshal([]byte(configMap.Data[certHistoryKey]), persisted); err != nil {
+		log.Info("Ignoring the unreadable persisted certificate sync history", "configMap", CertHistoryConfigMapName, "error", err.Error())
+		return nil
+	}
+
+	cm.statusLock.Lock()
+	defer cm.statusLock.Unlock()
+	if cm.history == nil {
+		cm.history = make(map[string]*CertSyncHistory)
+	}
+	for key, older := range persisted.Definitions {
+		if older == nil {
+			continue
+		}
+		if history, ok := cm.history[key]; ok {
+			history.mergeOlder(older)
+			continue
+		}
+		cm.history[key] = older
+	}
+	return nil
+}
+
+func (w *certHistoryWriter) write(summary certHistorySummary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	configMaps := w.client.CoreV1().ConfigMaps(w.namespace)
+	current, err := configMaps.Get(context.TODO(), CertHistoryConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CertHistoryConfigMapName,
+				Namespace: w.namespace,
+				Labels:    util.ResourceBuilder.WithCommonLabels(nil),
+			},
+			Data: map[string]string{certHistoryKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	updated := current.DeepCopy()
+	updated.Data = map[string]string{certHistoryKey: string(data)}
+	_, err = configMaps.Update(context.TODO(), updated, metav1.UpdateOptions{})
+	return err
+}
+
+// deleteHistory deletes the history configmap, the certificates it is about are gone
+func (cm *certManager) deleteHistory() error {
+	w := cm.historyWriter
+	if w == nil {
+		return nil
+	}
+	err := w.client.CoreV1().ConfigMaps(w.namespace).Delete(context.TODO(), CertHistoryConfigMapName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/pointer"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("cert sync history tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		cm            *certManager
+		historyClient *fake.Clientset
+		clock         *clocktesting.FakeClock
+		certs         []cert.CertificateDefinition
+		cancel        context.CancelFunc
+	)
+
+	// number of create and update calls of the history configmap
+	writes := func() int {
+		count := 0
+		for _, action := range historyClient.Actions() {
+			if action.GetResource().Resource == "configmaps" && (action.GetVerb() == "create" || action.GetVerb() == "update") {
+				count++
+			}
+		}
+		return count
+	}
+
+	persisted := func() *certHistorySummary {
+		configMap, err := historyClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), CertHistoryConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		summary := &certHistorySummary{}
+		Expect(json.Unmarshal([]byte(configMap.Data[certHistoryKey]), summary)).To(Succeed())
+		return summary
+	}
+
+	BeforeEach(func() {
+		cm = newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		historyClient = fake.NewSimpleClientset()
+		cm.historyWriter = newCertHistoryWriter(historyClient, namespace)
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should keep the last errors of a definition", func() {
+		for i := 0; i < 8; i++ {
+			cm.recordSync(certs[0], fmt.Errorf("error %d", i), false)
+		}
+
+		history := cm.definitionHistory(certs[0])
+		Expect(history.Errors).To(HaveLen(maxHistoryErrors))
+		Expect(history.Errors[0].Error).To(Equal("error 3"))
+		Expect(history.Errors[maxHistoryErrors-1].Error).To(Equal("error 7"))
+		Expect(history.LastSuccessTime).To(BeNil())
+
+		cm.recordSync(certs[0], nil, true)
+
+		history = cm.definitionHistory(certs[0])
+		Expect(history.Errors).To(HaveLen(maxHistoryErrors))
+		Expect(history.LastSuccessTime.Time).To(Equal(clock.Now()))
+		Expect(history.LastRotationTime.Time).To(Equal(clock.Now()))
+	})
+
+	It("should list the history of the synced definitions", func() {
+		broken := cert.CertificateDefinition{
+			TargetSecret:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "broken"}},
+			TargetService:     pointer.String("broken"),
+			ExtendedKeyUsages: "bogus",
+		}
+		Expect(cm.Sync(context.TODO(), append(certs, broken))).ToNot(Succeed())
+
+		managed, _ := cm.ListManagedCertificates(context.TODO())
+		for _, m := range managed {
+			Expect(m.History).ToNot(BeNil())
+			if m.Ref.Name == "broken" {
+				Expect(m.History.LastSuccessTime).To(BeNil())
+				Expect(m.History.Errors).To(ConsistOf(HaveField("Error", ContainSubstring("unknown extended key usages"))))
+				continue
+			}
+			// issued by the sync
+			Expect(m.History.LastSuccessTime).ToNot(BeNil())
+			Expect(m.History.LastRotationTime).ToNot(BeNil())
+			Expect(m.History.Errors).To(BeEmpty())
+		}
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(cm.definitionHistory(broken)).To(BeNil())
+	})
+
+	It("should persist the history at most once per interval", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(writes()).To(Equal(1))
+		Expect(persisted().Definitions).To(HaveKey(historyKey(certs[0])))
+
+		cm.recordSync(certs[0], errors.New("boom"), false)
+		cm.persistHistory()
+		Expect(writes()).To(Equal(1))
+
+		clock.Step(defaultHistoryPersistInterval)
+		cm.persistHistory()
+		Expect(writes()).To(Equal(2))
+		Expect(persisted().Definitions[historyKey(certs[0])].Errors).To(ConsistOf(HaveField("Error", "boom")))
+	})
+
+	It("should not fail the sync when the history can't be persisted", func() {
+		historyClient.PrependReactor("*", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("apiserver unavailable")
+		})
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(cm.SyncStatus().LastSyncError).To(BeEmpty())
+		attempts := len(historyClient.Actions())
+		Expect(attempts).ToNot(BeZero())
+
+		// the failed write isn't retried before the interval
+		cm.persistHistory()
+		Expect(historyClient.Actions()).To(HaveLen(attempts))
+	})
+
+	It("should merge the history persisted before a restart", func() {
+		before := metav1.NewTime(clock.Now().Add(-time.Hour).Truncate(time.Second))
+		data, err := json.Marshal(certHistorySummary{Definitions: map[string]*CertSyncHistory{
+			historyKey(certs[0]): {
+				LastSuccessTime: &before,
+				Errors:          []CertSyncError{{Time: before, Error: "before the restart"}},
+			},
+		}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = historyClient.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: CertHistoryConfigMapName},
+			Data:       map[string]string{certHistoryKey: string(data)},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		cm.recordSync(certs[0], errors.New("after the restart"), false)
+		cm.persistHistory()
+
+		history := cm.definitionHistory(certs[0])
+		Expect(history.LastSuccessTime.Time).To(BeTemporally("==", before.Time))
+		Expect(history.Errors).To(HaveLen(2))
+		Expect(history.Errors[0].Error).To(Equal("before the restart"))
+		Expect(history.Errors[1].Error).To(Equal("after the restart"))
+		Expect(persisted().Definitions[historyKey(certs[0])].Errors).To(HaveLen(2))
+	})
+})
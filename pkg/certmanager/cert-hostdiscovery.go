@@ -0,0 +1,154 @@
+package certmanager
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var routeGVK = schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "Route"}
+
+// servingHostnames returns the SANs of the serving certificate of the definition: the names of the
+// service, the extra SANs, the hosts of its routes and ingresses and, to correct them, of its webhooks
+func (cm *certManager) servingHostnames(cd mpcerts.CertificateDefinition, namespace string) ([]string, error) {
+	hostnames := append(targetHostnames(*cd.TargetService, namespace), cd.TargetExtraSANs...)
+	discovered, err := cm.discoveredHosts(cd, namespace)
+	if err != nil {
+		return nil, err
+	}
+	hostnames = append(hostnames, discovered...)
+	if !cd.CorrectWebhookSANs {
+		return hostnames, nil
+	}
+	webhookHosts, err := cm.webhookHosts(cd)
+	if err != nil {
+		return nil, err
+	}
+	known := sets.NewString(hostnames...)
+	for _, host := range webhookHosts {
+		if !known.Has(host) {
+			hostnames = append(hostnames, host)
+		}
+	}
+	return hostnames, nil
+}
+
+// discoveredHosts returns the sorted hosts of the routes and ingresses of the definition
+func (cm *certManager) discoveredHosts(cd mpcerts.CertificateDefinition, namespace string) ([]string, error) {
+	hosts := sets.NewString()
+	ingresses := cd.DiscoverIngressHosts
+	if cd.DiscoverRouteHosts != nil {
+		available, err := cm.kindAvailable(routeGVK)
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			routeHosts, err := cm.routeHosts(namespace, cd.DiscoverRouteHosts)
+			if err != nil {
+				return nil, err
+			}
+			hosts.Insert(routeHosts...)
+		} else if ingresses == nil {
+			// vanilla Kubernetes exposes the server with an ingress instead
+			ingresses = cd.DiscoverRouteHosts
+		}
+	}
+	if ingresses != nil {
+		ingressHosts, err := cm.ingressHosts(namespace, ingresses)
+		if err != nil {
+			return nil, err
+		}
+		hosts.Insert(ingressHosts...)
+	}
+	hosts.Delete("")
+	return hosts.List(), nil
+}
+
+// routeHosts returns the requested and the admitted hosts of the routes, a missing route has none
+func (cm *certManager) routeHosts(namespace string, discovery *mpcerts.HostDiscovery) ([]string, error) {
+	var routes []unstructured.Unstructured
+	if discovery.Name != "" {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(routeGVK)
+		if err := cm.client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: discovery.Name}, route); err != nil {
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		routes = append(routes, *route)
+	} else {
+		selector, err := metav1.LabelSelectorAsSelector(discovery.Selector)
+		if err != nil {
+			return nil, err
+		}
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(routeGVK.GroupVersion().WithKind("RouteList"))
+		if err := cm.client.List(context.TODO(), list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		routes = list.Items
+	}
+
+	var hosts []string
+	for _, route := range routes {
+		if host, _, _ := unstructured.NestedString(route.Object, "spec", "host"); host != "" {
+			hosts = append(hosts, host)
+		}
+		// the router generates the host of a route that doesn't request one
+		admitted, _, _ := unstructured.NestedSlice(route.Object, "status", "ingress")
+		for _, ingress := range admitted {
+			if ingress, ok := ingress.(map[string]interface{}); ok {
+				if host, _, _ := unstructured.NestedString(ingress, "host"); host != "" {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// ingressHosts returns the hosts of the rules and the TLS sections of the ingresses, a missing ingress
+// has none
+func (cm *certManager) ingressHosts(namespace string, discovery *mpcerts.HostDiscovery) ([]string, error) {
+	var ingresses []networkingv1.Ingress
+	if discovery.Name != "" {
+		ingress, err := cm.k8sClient.NetworkingV1().Ingresses(namespace).Get(context.TODO(), discovery.Name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		ingresses = append(ingresses, *ingress)
+	} else {
+		selector, err := metav1.LabelSelectorAsSelector(discovery.Selector)
+		if err != nil {
+			return nil, err
+		}
+		list, err := cm.k8sClient.NetworkingV1().Ingresses(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		ingresses = list.Items
+	}
+
+	var hosts []string
+	for _, ingress := range ingresses {
+		for _, rule := range ingress.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+		for _, tls := range ingress.Spec.TLS {
+			hosts = append(hosts, tls.Hosts...)
+		}
+	}
+	return hosts, nil
+}
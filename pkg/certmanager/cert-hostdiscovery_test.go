@@ -0,0 +1,195 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("serving certificate host discovery tests", func() {
+	const (
+		namespace = "maroonedpods"
+		name      = "maroonedpods-server"
+	)
+
+	var (
+		kubeClient *fake.Clientset
+		crClient   client.Client
+		cm         *certManager
+		cancel     context.CancelFunc
+	)
+
+	startCertManager := func(withRoutes bool) {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		s.AddKnownTypeWithName(routeGVK, &unstructured.Unstructured{})
+		s.AddKnownTypeWithName(routeGVK.GroupVersion().WithKind("RouteList"), &unstructured.UnstructuredList{})
+		mapper := meta.NewDefaultRESTMapper(nil)
+		if withRoutes {
+			mapper.Add(routeGVK, meta.RESTScopeNamespace)
+		}
+
+		kubeClient = fake.NewSimpleClientset()
+		crClient = crfake.NewClientBuilder().WithScheme(s).WithRESTMapper(mapper).Build()
+		cm = newCertManagerForTest(kubeClient, namespace).(*certManager)
+		cm.client = crClient
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newCerts := func(routes, ingresses *cert.HostDiscovery) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].DiscoverRouteHosts = routes
+		certs[0].DiscoverIngressHosts = ingresses
+		Expect(certs[0].Validate()).To(Succeed())
+		return certs
+	}
+
+	newRoute := func(host string, labels map[string]string) *unstructured.Unstructured {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(routeGVK)
+		route.SetNamespace(namespace)
+		route.SetName(name)
+		route.SetLabels(labels)
+		if host != "" {
+			Expect(unstructured.SetNestedField(route.Object, host, "spec", "host")).To(Succeed())
+		}
+		return route
+	}
+
+	newIngress := func(name, host string, labels map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{{Host: host}},
+				TLS:   []networkingv1.IngressTLS{{Hosts: []string{host}}},
+			},
+		}
+	}
+
+	getLeaf := func() *x509.Certificate {
+		secret, err := kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certs[0]
+	}
+
+	serviceHostnames := targetHostnames(cert.ServerServiceName, namespace)
+
+	It("should add the hosts of the route", func() {
+		startCertManager(true)
+		route := newRoute("maroonedpods.apps.example.com", nil)
+		Expect(unstructured.SetNestedSlice(route.Object, []interface{}{
+			map[string]interface{}{"host": "maroonedpods.apps.example.com"},
+			map[string]interface{}{"host": "maroonedpods.apps.internal.example.com"},
+		}, "status", "ingress")).To(Succeed())
+		Expect(crClient.Create(context.TODO(), route)).To(Succeed())
+
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.HostDiscovery{Name: name}, nil))).To(Succeed())
+
+		Expect(getLeaf().DNSNames).To(ConsistOf(append(serviceHostnames,
+			"maroonedpods.apps.example.com", "maroonedpods.apps.internal.example.com")))
+	})
+
+	It("should re-issue the certificate when the host of the route changes", func() {
+		startCertManager(true)
+		route := newRoute("maroonedpods.apps.example.com", map[string]string{"app": "maroonedpods"})
+		Expect(crClient.Create(context.TODO(), route)).To(Succeed())
+		certs := newCerts(&cert.HostDiscovery{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "maroonedpods"}}}, nil)
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		issued := getLeaf()
+		Expect(issued.DNSNames).To(ContainElement("maroonedpods.apps.example.com"))
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(getLeaf().SerialNumber).To(Equal(issued.SerialNumber))
+
+		Expect(unstructured.SetNestedField(route.Object, "maroonedpods.apps.new.example.com", "spec", "host")).To(Succeed())
+		Expect(crClient.Update(context.TODO(), route)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		leaf := getLeaf()
+		Expect(leaf.SerialNumber).ToNot(Equal(issued.SerialNumber))
+		Expect(leaf.DNSNames).To(ContainElement("maroonedpods.apps.new.example.com"))
+		Expect(leaf.DNSNames).ToNot(ContainElement("maroonedpods.apps.example.com"))
+	})
+
+	It("should add the hosts of the ingresses", func() {
+		startCertManager(true)
+		labels := map[string]string{"app": "maroonedpods"}
+		_, err := kubeClient.NetworkingV1().Ingresses(namespace).Create(context.TODO(), newIngress("public", "maroonedpods.example.com", labels), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = kubeClient.NetworkingV1().Ingresses(namespace).Create(context.TODO(), newIngress("other", "other.example.com", nil), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cm.Sync(context.TODO(), newCerts(nil, &cert.HostDiscovery{Selector: &metav1.LabelSelector{MatchLabels: labels}}))).To(Succeed())
+
+		Expect(getLeaf().DNSNames).To(ConsistOf(append(serviceHostnames, "maroonedpods.example.com")))
+	})
+
+	It("should look the routes up as ingresses without the route API", func() {
+		startCertManager(false)
+		_, err := kubeClient.NetworkingV1().Ingresses(namespace).Create(context.TODO(), newIngress(name, "maroonedpods.example.com", nil), metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.HostDiscovery{Name: name}, nil))).To(Succeed())
+
+		Expect(getLeaf().DNSNames).To(ConsistOf(append(serviceHostnames, "maroonedpods.example.com")))
+	})
+
+	It("should only issue for the service without routes and ingresses", func() {
+		startCertManager(false)
+
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.HostDiscovery{Name: name}, &cert.HostDiscovery{Name: name}))).To(Succeed())
+
+		Expect(getLeaf().DNSNames).To(ConsistOf(serviceHostnames))
+	})
+
+	DescribeTable("should reject invalid discoveries", func(mutate func(*cert.CertificateDefinition)) {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		mutate(&certs[0])
+		Expect(certs[0].Validate()).To(MatchError(cert.ErrInvalidDefinition))
+	},
+		Entry("without name and selector", func(cd *cert.CertificateDefinition) {
+			cd.DiscoverRouteHosts = &cert.HostDiscovery{}
+		}),
+		Entry("with name and selector", func(cd *cert.CertificateDefinition) {
+			cd.DiscoverIngressHosts = &cert.HostDiscovery{Name: name, Selector: &metav1.LabelSelector{}}
+		}),
+		Entry("for a client certificate", func(cd *cert.CertificateDefinition) {
+			cd.TargetService = nil
+			cd.TargetUser = &[]string{"maroonedpods-controller"}[0]
+			cd.DiscoverRouteHosts = &cert.HostDiscovery{Name: name}
+		}),
+		Entry("with an invalid selector", func(cd *cert.CertificateDefinition) {
+			cd.DiscoverIngressHosts = &cert.HostDiscovery{Selector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Near"}},
+			}}
+		}),
+	)
+})
@@ -0,0 +1,129 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("configmap informer tests", func() {
+	const (
+		namespace = "maroonedpods"
+		workloads = "workloads"
+		seeded    = 500
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	start := func(ctx context.Context) {
+		var objects []runtime.Object
+		for i := 0; i < seeded; i++ {
+			objects = append(objects, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: fmt.Sprintf("unrelated-%d", i)},
+				Data:       map[string]string{"data": "value"},
+			})
+		}
+		client = fake.NewSimpleClientset(objects...)
+		addApplyReactor(client)
+		allowAccessReviews(client)
+		cm = newCertManager(client, nil, namespace, workloads)
+		cm.extClient = extfake.NewSimpleClientset()
+		cm.client = crfake.NewClientBuilder().Build()
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	// an informer lists once before it watches
+	configMapLists := func(ns string) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetResource().Resource == "configmaps" && action.GetNamespace() == ns && action.GetVerb() == "list" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// the configmaps held by the informer caches of the cert manager
+	cachedConfigMaps := func() int {
+		count := 0
+		for _, listers := range cm.listers() {
+			if listers.configMapLister == nil {
+				continue
+			}
+			cached, err := listers.configMapLister.List(labels.Everything())
+			Expect(err).ToNot(HaveOccurred())
+			count += len(cached)
+		}
+		return count
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should only cache the configmaps of the namespaces with bundles", func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		start(ctx)
+		Expect(cachedConfigMaps()).To(BeZero())
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		Expect(cm.listers()[clusterNamespace{namespace: namespace}].configMapLister).ToNot(BeNil())
+		Expect(cm.listers()[clusterNamespace{namespace: workloads}].configMapLister).To(BeNil())
+		Expect(configMapLists(workloads)).To(BeZero())
+		// the configmaps of the install namespace instead of the seeded configmaps of the workloads
+		installed, err := client.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cachedConfigMaps()).To(Equal(len(installed.Items)))
+	})
+
+	It("should start the informer of a namespace a later definition has a bundle in", func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		start(ctx)
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		Expect(configMapLists(workloads)).To(BeZero())
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: workloads}))).To(Succeed())
+		Expect(cm.listers()[clusterNamespace{namespace: workloads}].configMapLister).ToNot(BeNil())
+		Expect(configMapLists(workloads)).To(Equal(1))
+		Expect(cachedConfigMaps()).To(BeNumerically(">", seeded))
+
+		// started once
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: workloads}))).To(Succeed())
+		Expect(configMapLists(workloads)).To(Equal(1))
+	})
+
+	It("should fail the sync when the informer of a bundle namespace can't sync", func() {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+		start(ctx)
+		client.PrependReactor("list", "configmaps", func(action testingclient.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("configmaps are forbidden")
+		})
+
+		err := cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue(), err.Error())
+		Expect(cm.listers()[clusterNamespace{namespace: namespace}].configMapLister).To(BeNil())
+		checkSecret(client, namespace, "maroonedpods-server", false)
+	})
+})
@@ -0,0 +1,257 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// ManagedCertRole is the part an object plays in a certificate definition
+type ManagedCertRole string
+
+const (
+	// ManagedCertRoleSigner is the secret of the CA signing the target
+	ManagedCertRoleSigner ManagedCertRole = "Signer"
+	// ManagedCertRoleTarget is the secret of the serving or client certificate
+	ManagedCertRoleTarget ManagedCertRole = "Target"
+	// ManagedCertRoleBundle is the configmap of the CAs the consumers of the target trust
+	ManagedCertRoleBundle ManagedCertRole = "Bundle"
+	// ManagedCertRoleConsumer is an object trusting the bundle through its caBundle, e.g. a webhook
+	// configuration, only check-certs reports it
+	ManagedCertRoleConsumer ManagedCertRole = "Consumer"
+)
+
+// ManagedCert is the state of an object of the cert manager, for support bundles
+type ManagedCert struct {
+	Ref  corev1.ObjectReference `json:"ref"`
+	Role ManagedCertRole        `json:"role"`
+	// of the object in a hosted control plane topology, empty for the management cluster
+	Cluster mpcerts.Cluster `json:"cluster,omitempty"`
+	// of the certificate, the newest CA for a bundle
+	IssuerCN  string       `json:"issuerCN,omitempty"`
+	Serial    string       `json:"serial,omitempty"`
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter  *metav1.Time `json:"notAfter,omitempty"`
+	// number of CAs in a bundle
+	BundleSize int `json:"bundleSize,omitempty"`
+	// from the rotation annotations of the secrets
+	LastRotationTime   *metav1.Time `json:"lastRotationTime,omitempty"`
+	LastRotationReason string       `json:"lastRotationReason,omitempty"`
+	// whether the last Sync of the definition of the object succeeded, false until it is synced
+	LastSyncSucceeded bool   `json:"lastSyncSucceeded"`
+	LastSyncError     string `json:"lastSyncError,omitempty"`
+	// why the sync of the definition of the object is suspended, e.g. its namespace is absent
+	Suspended string `json:"suspended,omitempty"`
+	// recent syncs of the definition of the object, shared by its signer, target and bundle
+	History *CertSyncHistory `json:"history,omitempty"`
+	// workloads referencing the object, with the CertConsumerDiscovery feature gate
+	Consumers []CertConsumer `json:"consumers,omitempty"`
+	// why the workloads of the namespace of the object couldn't all be listed
+	ConsumersError string `json:"consumersError,omitempty"`
+	// why the object couldn't be inspected, e.g. it doesn't exist yet
+	Error string `json:"error,omitempty"`
+}
+
+// managedObjectsOf returns the references of the signer, target and bundle of the definition,
+// the signer isn't used with a cert-manager.io issuer or external certificates
+func managedObjectsOf(cd mpcerts.CertificateDefinition) []ManagedCert {
+	var objects []ManagedCert
+	if cd.SignerSecret != nil && cd.Issuer == nil && !cd.External {
+		objects = append(objects, ManagedCert{Ref: secretRef(cd.SignerSecret), Role: ManagedCertRoleSigner})
+	}
+	if cd.TargetSecret != nil {
+		objects = append(objects, ManagedCert{Ref: secretRef(cd.TargetSecret), Role: ManagedCertRoleTarget})
+	}
+	if cd.CertBundleConfigmap != nil {
+		objects = append(objects, ManagedCert{
+			Ref:     corev1.ObjectReference{Kind: "ConfigMap", Namespace: cd.CertBundleConfigmap.Namespace, Name: cd.CertBundleConfigmap.Name},
+			Role:    ManagedCertRoleBundle,
+			Cluster: cd.BundleCluster,
+		})
+	}
+	return objects
+}
+
+func secretRef(secret *corev1.Secret) corev1.ObjectReference {
+	return corev1.ObjectReference{Kind: "Secret", Namespace: secret.Namespace, Name: secret.Name}
+}
+
+func syncKey(ref corev1.ObjectReference) string {
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// CertSyncStatus is the outcome of the last Sync of the cert manager
+type CertSyncStatus struct {
+	LastSyncTime  *metav1.Time `json:"lastSyncTime,omitempty"`
+	LastSyncError string       `json:"lastSyncError,omitempty"`
+	// nil until a sync succeeded
+	LastSuccessfulSyncTime *metav1.Time `json:"lastSuccessfulSyncTime,omitempty"`
+	// the verbs and resources the operator isn't allowed by namespace, its certificates are skipped
+	MissingPermissions map[string][]string `json:"missingPermissions,omitempty"`
+	// the namespaces that don't exist anymore, their certificates are suspended until they are recreated
+	SuspendedNamespaces []string `json:"suspendedNamespaces,omitempty"`
+}
+
+// SyncStatus returns the outcome of the last sync
+func (cm *certManager) SyncStatus() CertSyncStatus {
+	cm.statusLock.RLock()
+	defer cm.statusLock.RUnlock()
+	return cm.syncStatus
+}
+
+func (cm *certManager) recordSyncStatus(certs []mpcerts.CertificateDefinition, err error) {
+	cm.statusLock.Lock()
+	defer cm.statusLock.Unlock()
+	cm.certs = certs
+	cm.pruneHistory(certs)
+	now := &metav1.Time{Time: cm.clock.Now()}
+	cm.syncStatus.LastSyncTime = now
+	cm.syncStatus.MissingPermissions = cm.missingPermissions()
+	cm.syncStatus.SuspendedNamespaces = cm.absentNamespaces.List()
+	cm.syncStatus.LastSyncError = ""
+	if err != nil {
+		cm.syncStatus.LastSyncError = err.Error()
+		return
+	}
+	cm.syncStatus.LastSuccessfulSyncTime = now
+}
+
+// lastSyncedCerts returns the definitions of the last sync
+func (cm *certManager) lastSyncedCerts() []mpcerts.CertificateDefinition {
+	cm.statusLock.RLock()
+	defer cm.statusLock.RUnlock()
+	return cm.certs
+}
+
+// recordSync keeps the outcome of the last sync of the objects of the definition and adds it to its history
+func (cm *certManager) recordSync(cd mpcerts.CertificateDefinition, err error, rotated bool) {
+	cm.statusLock.Lock()
+	defer cm.statusLock.Unlock()
+	if cm.syncResults == nil {
+		cm.syncResults = make(map[string]error)
+	}
+	for _, object := range managedObjectsOf(cd) {
+		cm.syncResults[syncKey(object.Ref)] = err
+		delete(cm.suspensions, syncKey(object.Ref))
+	}
+	cm.recordHistory(cd, err, rotated)
+}
+
+// ListManagedCertificates returns the state of every signer, target and bundle of the last sync,
+// read from the listers. Objects that can't be inspected are listed with their error and the
+// errors are returned as well, the list is complete nonetheless.
+func (cm *certManager) ListManagedCertificates(ctx context.Context) ([]ManagedCert, error) {
+	var managed []ManagedCert
+	var errs []error
+	for _, cd := range cm.lastSyncedCerts() {
+		history := cm.definitionHistory(cd)
+		for _, object := range managedObjectsOf(cd) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			cm.statusLock.RLock()
+			syncErr, synced := cm.syncResults[syncKey(object.Ref)]
+			suspended := cm.suspensions[syncKey(object.Ref)]
+			cm.statusLock.RUnlock()
+			// not an error, there is nothing to inspect until the namespace is recreated
+			if suspended != "" {
+				object.Suspended = suspended
+				object.History = history
+				managed = append(managed, object)
+				continue
+			}
+			object.LastSyncSucceeded = synced && syncErr == nil
+			if syncErr != nil {
+				object.LastSyncError = syncErr.Error()
+			} else if !synced {
+				object.LastSyncError = "not synced yet"
+			}
+			object.History = history
+			object.Consumers, object.ConsumersError = cm.consumersOf(object.Ref)
+
+			if err := cm.inspect(&object); err != nil {
+				object.Error = err.Error()
+				errs = append(errs, fmt.Errorf("%s %s/%s: %w", object.Ref.Kind, object.Ref.Namespace, object.Ref.Name, err))
+			}
+			managed = append(managed, object)
+		}
+	}
+	return managed, utilerrors.NewAggregate(errs)
+}
+
+func (cm *certManager) inspect(object *ManagedCert) error {
+	listers, err := cm.listersFor(clusterNamespace{cluster: object.Cluster, namespace: object.Ref.Namespace})
+	if err != nil {
+		return err
+	}
+
+	var parsed *parsedCerts
+	var parseErr error
+	if object.Role == ManagedCertRoleBundle {
+		if listers.configMapLister == nil {
+			return fmt.Errorf("bundle is not synced yet")
+		}
+		configMap, err := listers.configMapLister.ConfigMaps(object.Ref.Namespace).Get(object.Ref.Name)
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("bundle is not published yet")
+		}
+		if err != nil {
+			return err
+		}
+		object.Ref.UID = configMap.UID
+		object.Ref.ResourceVersion = configMap.ResourceVersion
+		parsed, parseErr = cm.parseCerts(configMap, selfManagedBundleKey)
+	} else {
+		secret, err := listers.secretLister.Secrets(object.Ref.Namespace).Get(object.Ref.Name)
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("certificate is not issued yet")
+		}
+		if err != nil {
+			return err
+		}
+		object.Ref.UID = secret.UID
+		object.Ref.ResourceVersion = secret.ResourceVersion
+		object.LastRotationReason = secret.Annotations[annLastRotationReason]
+		if rotation, err := time.Parse(time.RFC3339, secret.Annotations[annLastRotationTime]); err == nil {
+			object.LastRotationTime = &metav1.Time{Time: rotation}
+		}
+		parsed, parseErr = cm.parseCerts(secret, corev1.TLSCertKey)
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("certificate can't be parsed")
+	}
+	if object.Role == ManagedCertRoleBundle {
+		c := newestCert(parsed.certs)
+		object.BundleSize = len(parsed.certs)
+		object.IssuerCN = c.Issuer.CommonName
+		object.Serial = c.SerialNumber.String()
+		object.NotBefore = &metav1.Time{Time: c.NotBefore}
+		object.NotAfter = &metav1.Time{Time: c.NotAfter}
+		return nil
+	}
+	object.IssuerCN = parsed.certs[0].Issuer.CommonName
+	object.Serial = parsed.serial
+	object.NotBefore = &metav1.Time{Time: parsed.notBefore}
+	object.NotAfter = &metav1.Time{Time: parsed.notAfter}
+	return nil
+}
+
+func newestCert(certs []*x509.Certificate) *x509.Certificate {
+	newest := certs[0]
+	for _, c := range certs[1:] {
+		if c.NotBefore.After(newest.NotBefore) {
+			newest = c
+		}
+	}
+	return newest
+}
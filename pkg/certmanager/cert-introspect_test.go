@@ -0,0 +1,133 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("managed certificates listing tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	find := func(managed []ManagedCert, kind, name string) ManagedCert {
+		for _, m := range managed {
+			if m.Ref.Kind == kind && m.Ref.Name == name {
+				return m
+			}
+		}
+		Fail("no managed object " + kind + " " + name)
+		return ManagedCert{}
+	}
+
+	BeforeEach(func() {
+		cm = newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should list healthy and failed certificates", func() {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs = append(certs, cert.CertificateDefinition{
+			TargetSecret:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "broken"}},
+			TargetService:     pointer.String("broken"),
+			ExtendedKeyUsages: "bogus",
+		})
+		Expect(cm.Sync(context.TODO(), certs)).ToNot(Succeed())
+
+		var managed []ManagedCert
+		Eventually(func() string {
+			managed, _ = cm.ListManagedCertificates(context.TODO())
+			return find(managed, "Secret", util.SecretResourceName).Serial
+		}, 5*time.Second, 100*time.Millisecond).ShouldNot(BeEmpty())
+		Expect(managed).To(HaveLen(4))
+
+		signer := find(managed, "Secret", "maroonedpods-server")
+		Expect(signer.Role).To(Equal(ManagedCertRoleSigner))
+		Expect(signer.LastSyncSucceeded).To(BeTrue())
+		Expect(signer.LastRotationReason).To(Equal(rotationReasonIssued))
+		Expect(signer.LastRotationTime).ToNot(BeNil())
+
+		target := find(managed, "Secret", util.SecretResourceName)
+		Expect(target.Role).To(Equal(ManagedCertRoleTarget))
+		Expect(target.IssuerCN).To(Equal(signer.IssuerCN))
+		Expect(target.NotAfter.Time).To(BeTemporally(">", time.Now()))
+		Expect(target.NotBefore.Time).To(BeTemporally("<", target.NotAfter.Time))
+		Expect(target.LastSyncSucceeded).To(BeTrue())
+		Expect(target.Error).To(BeEmpty())
+
+		bundle := find(managed, "ConfigMap", "maroonedpods-server-signer-bundle")
+		Expect(bundle.Role).To(Equal(ManagedCertRoleBundle))
+		Expect(bundle.BundleSize).To(Equal(1))
+		Expect(bundle.Serial).To(Equal(signer.Serial))
+		Expect(bundle.LastSyncSucceeded).To(BeTrue())
+
+		broken := find(managed, "Secret", "broken")
+		Expect(broken.LastSyncSucceeded).To(BeFalse())
+		Expect(broken.LastSyncError).To(ContainSubstring("unknown extended key usages"))
+		Expect(broken.Error).To(ContainSubstring("not issued yet"))
+		Expect(broken.Serial).To(BeEmpty())
+	})
+
+	It("should report the definitions that weren't synced yet", func() {
+		cm.certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		managed, err := cm.ListManagedCertificates(context.TODO())
+		Expect(err).To(HaveOccurred())
+		Expect(managed).To(HaveLen(3))
+		for _, m := range managed {
+			Expect(m.LastSyncSucceeded).To(BeFalse())
+			Expect(m.LastSyncError).To(Equal("not synced yet"))
+			Expect(m.Error).ToNot(BeEmpty())
+		}
+	})
+
+	It("should dump to JSON", func() {
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		var managed []ManagedCert
+		Eventually(func() error {
+			var err error
+			managed, err = cm.ListManagedCertificates(context.TODO())
+			return err
+		}, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+
+		bs, err := json.Marshal(managed)
+		Expect(err).ToNot(HaveOccurred())
+		var dumped []map[string]interface{}
+		Expect(json.Unmarshal(bs, &dumped)).To(Succeed())
+		Expect(dumped).To(HaveLen(3))
+		Expect(dumped[0]).To(HaveKey("ref"))
+		Expect(dumped[0]).To(HaveKeyWithValue("lastSyncSucceeded", true))
+		Expect(dumped[0]).To(HaveKey("notAfter"))
+		Expect(dumped[0]).ToNot(HaveKey("error"))
+	})
+
+	It("should stop on a cancelled context", func() {
+		cm.certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		ctx, cancelList := context.WithCancel(context.Background())
+		cancelList()
+
+		_, err := cm.ListManagedCertificates(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,66 @@
+package certmanager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// defaultRotationJitter is the percentage of the refresh the rotations are spread over, either way
+	defaultRotationJitter = 10
+	// maxRotationJitter keeps the earliest refresh at half of the configured one
+	maxRotationJitter = 50
+)
+
+// rotationJitter parses the jitter percentage of the value of the env variable, 0 disables the jitter
+func rotationJitter(value string) (int, error) {
+	if value == "" {
+		return defaultRotationJitter, nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil {
+		return 0, err
+	}
+	if percent < 0 || percent > maxRotationJitter {
+		return 0, fmt.Errorf("the rotation jitter %s is not between 0 and %d%%", value, maxRotationJitter)
+	}
+	return percent, nil
+}
+
+// jitteredRefresh shifts the refresh of the certificate of the secret by up to percent of it either way,
+// so the certificates issued together don't all rotate in the same sync. The shift is derived from the
+// namespace/name of the secret, it stays the same across restarts. A later refresh is kept before the
+// 80% of the lifetime library-go refreshes at anyway.
+func jitteredRefresh(secret *corev1.Secret, config mpcerts.CertificateConfig, percent int) time.Duration {
+	if percent == 0 || config.Refresh <= 0 {
+		return config.Refresh
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(secret.Namespace + "/" + secret.Name))
+	// spread evenly over [-1, 1]
+	position := float64(hash.Sum64()%2001)/1000 - 1
+	offset := time.Duration(position * float64(config.Refresh) * float64(percent) / 100).Truncate(time.Second)
+
+	refresh := config.Refresh + offset
+	if latest := config.Lifetime - config.Lifetime/5; offset > 0 && refresh > latest {
+		refresh = latest
+		if refresh < config.Refresh {
+			refresh = config.Refresh
+		}
+	}
+	return refresh
+}
+
+// jittered returns the config of the certificate of the secret with the refresh it is rotated at
+func (cm *certManager) jittered(secret *corev1.Secret, config mpcerts.CertificateConfig) mpcerts.CertificateConfig {
+	config.Refresh = jitteredRefresh(secret, config, cm.rotationJitter)
+	return config
+}
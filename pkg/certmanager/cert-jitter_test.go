@@ -0,0 +1,212 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+)
+
+var _ = Describe("rotation jitter tests", func() {
+	const (
+		namespace   = "maroonedpods"
+		definitions = 10
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		now    time.Time
+		config = cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour}
+	)
+
+	newSecret := func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	start := func(secrets ...*corev1.Secret) *certManager {
+		for _, secret := range secrets {
+			_, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		cm.rotationJitter = defaultRotationJitter
+		cm.clock = clocktesting.NewFakeClock(now)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		return cm
+	}
+
+	// definitions of targets issued together now
+	createdTogether := func() ([]*corev1.Secret, []cert.CertificateDefinition) {
+		var secrets []*corev1.Secret
+		var certs []cert.CertificateDefinition
+		for i := 0; i < definitions; i++ {
+			secret := newSecret(fmt.Sprintf("target-%d", i))
+			certs = append(certs, cert.CertificateDefinition{TargetSecret: secret.DeepCopy(), TargetConfig: config})
+			secret.Annotations = map[string]string{
+				certrotation.CertificateNotBeforeAnnotation: now.Format(time.RFC3339),
+				certrotation.CertificateNotAfterAnnotation:  now.Add(config.Lifetime).Format(time.RFC3339),
+			}
+			secrets = append(secrets, secret)
+		}
+		return secrets, certs
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		now = time.Now().Truncate(time.Second)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should stagger the rotations of definitions created together", func() {
+		secrets, certs := createdTogether()
+		cm = start(secrets...)
+		cm.certs = certs
+
+		rotations, err := cm.NextRotations(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rotations).To(HaveLen(definitions))
+
+		distinct := map[time.Time]bool{}
+		for _, rotation := range rotations {
+			Expect(rotation).To(BeTemporally("~", now.Add(config.Refresh), config.Refresh/10))
+			distinct[rotation] = true
+		}
+		Expect(len(distinct)).To(BeNumerically(">", definitions/2))
+
+		// only some of them are due at the refresh
+		clock := cm.clock.(*clocktesting.FakeClock)
+		clock.SetTime(now.Add(config.Refresh))
+		due := 0
+		for _, rotation := range rotations {
+			if !rotation.After(clock.Now()) {
+				due++
+			}
+		}
+		Expect(due).To(BeNumerically(">", 0))
+		Expect(due).To(BeNumerically("<", definitions))
+		Expect(cm.nextRefreshIn(certs)).To(BeZero())
+
+		// none before the earliest
+		earliest := now.Add(config.Lifetime)
+		for _, rotation := range rotations {
+			if rotation.Before(earliest) {
+				earliest = rotation
+			}
+		}
+		clock.SetTime(earliest.Add(-time.Minute))
+		Expect(cm.nextRefreshIn(certs)).To(Equal(time.Minute))
+	})
+
+	It("should keep the rotations after a restart", func() {
+		secrets, certs := createdTogether()
+		cm = start(secrets...)
+		cm.certs = certs
+		rotations, err := cm.NextRotations(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+
+		restarted := start()
+		restarted.certs = certs
+		Expect(restarted.NextRotations(context.TODO())).To(Equal(rotations))
+	})
+
+	It("should rotate a signer at its jittered refresh", func() {
+		cm = start()
+		signerConfig := cert.CertificateConfig{Lifetime: 48 * time.Hour, Refresh: 24 * time.Hour}
+		var certs []cert.CertificateDefinition
+		for i := 0; i < definitions; i++ {
+			certs = append(certs, cert.CertificateDefinition{SignerSecret: newSecret(fmt.Sprintf("signer-%d", i)), SignerConfig: signerConfig})
+		}
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		earliest, latest := certs[0].SignerSecret, certs[0].SignerSecret
+		for _, cd := range certs {
+			refresh := jitteredRefresh(cd.SignerSecret, signerConfig, cm.rotationJitter)
+			if refresh < jitteredRefresh(earliest, signerConfig, cm.rotationJitter) {
+				earliest = cd.SignerSecret
+			}
+			if refresh > jitteredRefresh(latest, signerConfig, cm.rotationJitter) {
+				latest = cd.SignerSecret
+			}
+		}
+		Expect(jitteredRefresh(earliest, signerConfig, cm.rotationJitter)).To(BeNumerically("<", signerConfig.Refresh-time.Minute))
+		Expect(jitteredRefresh(latest, signerConfig, cm.rotationJitter)).To(BeNumerically(">", signerConfig.Refresh+time.Minute))
+
+		// issued exactly the refresh ago
+		issued := map[string][]byte{}
+		for _, signer := range []*corev1.Secret{earliest, latest} {
+			notBefore := time.Now().Add(-signerConfig.Refresh)
+			aged, err := certtest.SetValidity(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: signer.Name}, notBefore, notBefore.Add(signerConfig.Lifetime))
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, aged)
+			issued[signer.Name] = aged.Data[corev1.TLSCertKey]
+		}
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		getCert := func(name string) []byte {
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return secret.Data[corev1.TLSCertKey]
+		}
+		Expect(getCert(earliest.Name)).ToNot(Equal(issued[earliest.Name]))
+		Expect(getCert(latest.Name)).To(Equal(issued[latest.Name]))
+	})
+
+	It("should spread the refresh over the window", func() {
+		for i := 0; i < 100; i++ {
+			secret := newSecret(fmt.Sprintf("target-%d", i))
+			refresh := jitteredRefresh(secret, config, 25)
+			Expect(refresh).To(BeNumerically(">=", config.Refresh*3/4))
+			Expect(refresh).To(BeNumerically("<=", config.Refresh*5/4))
+			Expect(jitteredRefresh(secret.DeepCopy(), config, 25)).To(Equal(refresh))
+			Expect(jitteredRefresh(secret, config, 0)).To(Equal(config.Refresh))
+		}
+	})
+
+	It("should never refresh later than 80% of the lifetime", func() {
+		late := cert.CertificateConfig{Lifetime: 10 * time.Hour, Refresh: 8 * time.Hour}
+		for i := 0; i < 100; i++ {
+			refresh := jitteredRefresh(newSecret(fmt.Sprintf("target-%d", i)), late, maxRotationJitter)
+			Expect(refresh).To(BeNumerically(">=", 4*time.Hour))
+			Expect(refresh).To(BeNumerically("<=", 8*time.Hour))
+		}
+	})
+
+	DescribeTable("should parse the jitter", func(value string, expected int, valid bool) {
+		jitter, err := rotationJitter(value)
+		if !valid {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(jitter).To(Equal(expected))
+	},
+		Entry("by default", "", defaultRotationJitter, true),
+		Entry("disabled", "0", 0, true),
+		Entry("a percentage", "20%", 20, true),
+		Entry("a number", "5", 5, true),
+		Entry("too wide", "60", 0, false),
+		Entry("negative", "-5", 0, false),
+		Entry("invalid", "some", 0, false),
+	)
+})
@@ -0,0 +1,200 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/keyutil"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/pkcs12"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	keystoreKey         = "keystore.p12"
+	keystorePasswordKey = "keystore-password"
+
+	truststoreKey = "truststore.p12"
+	// truststorePassword protects the integrity of the truststore only, it holds public certificates
+	// so the well known password of the Java truststores is used
+	truststorePassword = "changeit"
+
+	// annKeystoreSource is the hash of the PEM material the keystore was generated from
+	annKeystoreSource = "operator.maroonedpods.io/keystoreSource"
+	// annTruststoreSource is the hash of the PEM bundle the truststore was generated from
+	annTruststoreSource = "operator.maroonedpods.io/truststoreSource"
+
+	generatedPasswordLength = 24
+)
+
+// setKeystore sets the pkcs12 keystore of the target key/cert in the target secret, it is
+// regenerated whenever the PEM material or the password changes
+func (cm *certManager) setKeystore(cd mpcerts.CertificateDefinition, secret *corev1.Secret) error {
+	if !cd.HasOutputFormat(mpcerts.OutputFormatPKCS12) {
+		if _, ok := secret.Annotations[annKeystoreSource]; ok {
+			delete(secret.Annotations, annKeystoreSource)
+			delete(secret.Data, keystoreKey)
+			delete(secret.Data, keystorePasswordKey)
+		}
+		return nil
+	}
+
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil
+	}
+
+	password, err := cm.keystorePassword(cd, secret)
+	if err != nil {
+		return err
+	}
+
+	source := keystoreSource(certPEM, keyPEM)
+	if secret.Annotations[annKeystoreSource] == source &&
+		string(secret.Data[keystorePasswordKey]) == password &&
+		len(secret.Data[keystoreKey]) > 0 {
+		return nil
+	}
+
+	certs, err := crypto.CertsFromPEM(certPEM)
+	if err != nil {
+		return err
+	}
+	key, err := keyutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	keystore, err := pkcs12.Encode(key, certs, password)
+	if err != nil {
+		return err
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annKeystoreSource] = source
+	secret.Data[keystoreKey] = keystore
+	secret.Data[keystorePasswordKey] = []byte(password)
+
+	return nil
+}
+
+// keystorePassword returns the password supplied by the user, the one generated before or a new one
+func (cm *certManager) keystorePassword(cd mpcerts.CertificateDefinition, secret *corev1.Secret) (string, error) {
+	if ref := cd.KeystorePasswordSecret; ref != nil {
+		listers, err := cm.listersFor(clusterNamespace{namespace: secret.Namespace})
+		if err != nil {
+			return "", err
+		}
+		passwordSecret, err := listers.secretLister.Secrets(secret.Namespace).Get(ref.Name)
+		if err != nil {
+			return "", fmt.Errorf("failed to get keystore password secret %s/%s: %w", secret.Namespace, ref.Name, err)
+		}
+		password, ok := passwordSecret.Data[ref.Key]
+		if !ok || len(password) == 0 {
+			return "", fmt.Errorf("keystore password secret %s/%s has no key %s", secret.Namespace, ref.Name, ref.Key)
+		}
+		return string(password), nil
+	}
+
+	if password := secret.Data[keystorePasswordKey]; len(password) > 0 {
+		return string(password), nil
+	}
+
+	b := make([]byte, generatedPasswordLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ensureTruststore writes the pkcs12 truststore of the CA bundle into the bundle configmap, it is
+// regenerated only when the PEM bundle changes so CAs pruned from it also leave the truststore
+func (cm *certManager) ensureTruststore(ctx context.Context, cd mpcerts.CertificateDefinition) error {
+	configMap := cd.CertBundleConfigmap
+	listers, err := cm.listersFor(clusterNamespace{cluster: cd.BundleCluster, namespace: configMap.Namespace})
+	if err != nil {
+		return err
+	}
+
+	requested := cd.HasBundleOutputFormat(mpcerts.OutputFormatPKCS12)
+	if !requested {
+		cached, err := listers.configMapLister.ConfigMaps(configMap.Namespace).Get(configMap.Name)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if _, ok := cached.Annotations[annTruststoreSource]; !ok {
+			return nil
+		}
+	}
+
+	client := cm.kubeClient(cd.BundleCluster).CoreV1().ConfigMaps(configMap.Namespace)
+	// the bundle may just have been updated, don't wait for the lister
+	current, err := client.Get(ctx, configMap.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	updated := current.DeepCopy()
+	if !requested {
+		delete(updated.Annotations, annTruststoreSource)
+		delete(updated.BinaryData, truststoreKey)
+	} else {
+		bundlePEM := []byte(current.Data[selfManagedBundleKey])
+		if len(bundlePEM) == 0 {
+			return nil
+		}
+
+		source := keystoreSource(bundlePEM)
+		if current.Annotations[annTruststoreSource] == source && len(current.BinaryData[truststoreKey]) > 0 {
+			return nil
+		}
+
+		parsed, err := cm.parseCerts(current, selfManagedBundleKey)
+		if err != nil {
+			return err
+		}
+		truststore, err := pkcs12.EncodeTrustStore(parsed.certs, truststorePassword)
+		if err != nil {
+			return err
+		}
+
+		if updated.Annotations == nil {
+			updated.Annotations = make(map[string]string)
+		}
+		if updated.BinaryData == nil {
+			updated.BinaryData = make(map[string][]byte)
+		}
+		updated.Annotations[annTruststoreSource] = source
+		updated.BinaryData[truststoreKey] = truststore
+		log.Info("Updating pkcs12 truststore", "configmap", configMap.Name, "namespace", configMap.Namespace)
+	}
+
+	// the lister may still have the truststore of a configmap that already lost it
+	if !configMapChanged(current, updated) {
+		return nil
+	}
+
+	_, err = cm.applyConfigMap(cd.BundleCluster, current, updated)
+	return err
+}
+
+func keystoreSource(pems ...[]byte) string {
+	h := sha256.New()
+	for _, pem := range pems {
+		h.Write(pem)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
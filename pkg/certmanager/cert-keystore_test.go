@@ -0,0 +1,292 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/pkcs12"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("pkcs12 keystore tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	start := func(objs ...runtime.Object) {
+		client = fake.NewSimpleClientset(objs...)
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	}
+
+	newCerts := func(passwordSecret *corev1.SecretKeySelector, formats ...cert.OutputFormat) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].OutputFormats = formats
+			certs[i].KeystorePasswordSecret = passwordSecret
+		}
+		return certs
+	}
+
+	getTarget := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	expectKeystore := func(secret *corev1.Secret, password string) {
+		key, certs, err := pkcs12.Decode(secret.Data[keystoreKey], password)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key).ToNot(BeNil())
+
+		pemCerts, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs).To(HaveLen(len(pemCerts)))
+		Expect(certs[0].Equal(pemCerts[0])).To(BeTrue())
+	}
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should write a keystore matching tls.crt", func() {
+		start()
+		Expect(cm.Sync(context.TODO(), newCerts(nil, cert.OutputFormatPKCS12))).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data[keystorePasswordKey]).ToNot(BeEmpty())
+		expectKeystore(secret, string(secret.Data[keystorePasswordKey]))
+	})
+
+	It("should regenerate the keystore with the same password on rotation", func() {
+		start()
+		certs := newCerts(nil, cert.OutputFormatPKCS12)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		before := getTarget()
+
+		// force the rotation of the target
+		expired := before.DeepCopy()
+		expired.Annotations[certrotation.CertificateNotAfterAnnotation] = time.Now().Format(time.RFC3339)
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), expired, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, expired)
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		after := getTarget()
+		Expect(after.Data[corev1.TLSCertKey]).ToNot(Equal(before.Data[corev1.TLSCertKey]))
+		Expect(after.Data[keystoreKey]).ToNot(Equal(before.Data[keystoreKey]))
+		Expect(after.Data[keystorePasswordKey]).To(Equal(before.Data[keystorePasswordKey]))
+		expectKeystore(after, string(after.Data[keystorePasswordKey]))
+	})
+
+	It("should not rewrite an up to date keystore", func() {
+		start()
+		certs := newCerts(nil, cert.OutputFormatPKCS12)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+
+		client.ClearActions()
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, action := range client.Actions() {
+			if action.GetResource().Resource == "secrets" {
+				Expect(action.GetVerb()).To(Equal("get"))
+			}
+		}
+	})
+
+	It("should use the password of the referenced secret", func() {
+		start(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "keystore-password"},
+			Data:       map[string][]byte{"password": []byte("changeit")},
+		})
+		ref := &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "keystore-password"},
+			Key:                  "password",
+		}
+		Expect(cm.Sync(context.TODO(), newCerts(ref, cert.OutputFormatPKCS12))).To(Succeed())
+
+		secret := getTarget()
+		Expect(string(secret.Data[keystorePasswordKey])).To(Equal("changeit"))
+		expectKeystore(secret, "changeit")
+	})
+
+	It("should fail when the referenced password secret is missing", func() {
+		start()
+		ref := &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+			Key:                  "password",
+		}
+		Expect(cm.Sync(context.TODO(), newCerts(ref, cert.OutputFormatPKCS12))).ToNot(Succeed())
+	})
+
+	It("should remove the keystore when the format is not requested anymore", func() {
+		start()
+		Expect(cm.Sync(context.TODO(), newCerts(nil, cert.OutputFormatPKCS12))).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+
+		Expect(cm.Sync(context.TODO(), newCerts(nil))).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data).ToNot(HaveKey(keystoreKey))
+		Expect(secret.Data).ToNot(HaveKey(keystorePasswordKey))
+		Expect(secret.Annotations).ToNot(HaveKey(annKeystoreSource))
+		Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+	})
+
+	Context("truststore", func() {
+		const bundleName = "maroonedpods-server-signer-bundle"
+
+		newBundleCerts := func(formats ...cert.OutputFormat) []cert.CertificateDefinition {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			for i := range certs {
+				certs[i].BundleOutputFormats = formats
+			}
+			return certs
+		}
+
+		getBundle := func() *corev1.ConfigMap {
+			configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), bundleName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			return configMap
+		}
+
+		fingerprints := func(certs []*x509.Certificate) []string {
+			var result []string
+			for _, c := range certs {
+				sum := sha256.Sum256(c.Raw)
+				result = append(result, hex.EncodeToString(sum[:]))
+			}
+			return result
+		}
+
+		expectTruststore := func(configMap *corev1.ConfigMap) []*x509.Certificate {
+			truststoreCerts, err := pkcs12.DecodeTrustStore(configMap.BinaryData[truststoreKey], truststorePassword)
+			Expect(err).ToNot(HaveOccurred())
+			pemCerts, err := crypto.CertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fingerprints(truststoreCerts)).To(ConsistOf(fingerprints(pemCerts)))
+			return pemCerts
+		}
+
+		waitForConfigMapLister := func(expected *corev1.ConfigMap) {
+			Eventually(func() bool {
+				configMap, err := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(expected.Name)
+				if err != nil {
+					return false
+				}
+				return equality.Semantic.DeepEqual(configMap.Data, expected.Data) &&
+					equality.Semantic.DeepEqual(configMap.Annotations, expected.Annotations)
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+		}
+
+		// a signer missing from the lister is issued again, wait for it as well before syncing again
+		waitForListers := func(certs []cert.CertificateDefinition) {
+			waitForConfigMapLister(getBundle())
+			for _, c := range managedCertsOf(certs[0]) {
+				secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), c.secret.Name, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+		}
+
+		It("should match the PEM bundle across a CA rotation", func() {
+			start()
+			certs := newBundleCerts(cert.OutputFormatPKCS12)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			Expect(expectTruststore(getBundle())).To(HaveLen(1))
+
+			// force a new CA
+			Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), certs[0].SignerSecret.Name, metav1.DeleteOptions{})).To(Succeed())
+			Eventually(func() bool {
+				_, err := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}].secretLister.Secrets(namespace).Get(certs[0].SignerSecret.Name)
+				return errors.IsNotFound(err)
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+			waitForConfigMapLister(getBundle())
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+			Expect(expectTruststore(getBundle())).To(HaveLen(2))
+		})
+
+		It("should drop CAs pruned from the PEM bundle", func() {
+			start()
+			certs := newBundleCerts(cert.OutputFormatPKCS12)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			current := getBundle()
+
+			// what the pruning of an expired CA leaves behind
+			other, err := crypto.MakeSelfSignedCAConfigForDuration("expired", time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			otherPEM, _, err := other.GetPEMBytes()
+			Expect(err).ToNot(HaveOccurred())
+			withOther := current.DeepCopy()
+			withOther.Data[selfManagedBundleKey] += string(otherPEM)
+			_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), withOther, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForConfigMapLister(withOther)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			Expect(expectTruststore(getBundle())).To(HaveLen(2))
+
+			pruned := getBundle()
+			pruned.Data[selfManagedBundleKey] = current.Data[selfManagedBundleKey]
+			_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), pruned, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForConfigMapLister(pruned)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+			Expect(expectTruststore(getBundle())).To(HaveLen(1))
+		})
+
+		It("should not rewrite an up to date truststore", func() {
+			start()
+			certs := newBundleCerts(cert.OutputFormatPKCS12)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			waitForListers(certs)
+
+			client.ClearActions()
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			for _, action := range client.Actions() {
+				if action.GetResource().Resource == "configmaps" {
+					Expect(action.GetVerb()).To(Equal("get"))
+				}
+			}
+		})
+
+		It("should remove the truststore when the format is not requested anymore", func() {
+			start()
+			certs := newBundleCerts(cert.OutputFormatPKCS12)
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			waitForListers(certs)
+
+			Expect(cm.Sync(context.TODO(), newBundleCerts())).To(Succeed())
+
+			configMap := getBundle()
+			Expect(configMap.BinaryData).ToNot(HaveKey(truststoreKey))
+			Expect(configMap.Annotations).ToNot(HaveKey(annTruststoreSource))
+			Expect(configMap.Data[selfManagedBundleKey]).ToNot(BeEmpty())
+		})
+	})
+})
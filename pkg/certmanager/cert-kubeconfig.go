@@ -0,0 +1,92 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	kubeconfigKey = "kubeconfig"
+	// kubeconfigCluster names the cluster and the context of the kubeconfig
+	kubeconfigCluster = "maroonedpods"
+)
+
+// setKubeconfig sets the kubeconfig authenticating with the key pair of the target secret
+func (cm *certManager) setKubeconfig(cd mpcerts.CertificateDefinition, secret *corev1.Secret) error {
+	if cd.EmitKubeconfig == nil {
+		delete(secret.Data, kubeconfigKey)
+		return nil
+	}
+
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil
+	}
+
+	caPEM, err := cm.kubeconfigCA(cd)
+	if err != nil {
+		return err
+	}
+
+	kubeconfig, err := buildKubeconfig(*cd.TargetUser, cd.EmitKubeconfig.Server, caPEM, certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	secret.Data[kubeconfigKey] = kubeconfig
+	return nil
+}
+
+// kubeconfigCA reads the CA of the server, the bundle may just have been updated so it isn't read
+// from the lister
+func (cm *certManager) kubeconfigCA(cd mpcerts.CertificateDefinition) ([]byte, error) {
+	cluster, namespace, name, key := mpcerts.ManagementCluster, cd.TargetSecret.Namespace, "", selfManagedBundleKey
+	if source := cd.EmitKubeconfig.CAConfigMap; source != nil {
+		name = source.Name
+		if source.Key != "" {
+			key = source.Key
+		}
+	} else {
+		cluster, namespace, name = cd.BundleCluster, cd.CertBundleConfigmap.Namespace, cd.CertBundleConfigmap.Name
+	}
+
+	configMap, err := cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	caPEM := configMap.Data[key]
+	if caPEM == "" {
+		return nil, fmt.Errorf("configmap %s/%s has no CA under %s", namespace, name, key)
+	}
+	return []byte(caPEM), nil
+}
+
+// buildKubeconfig returns the serialized kubeconfig of the user, it is validated the way clients
+// loading it validate it
+func buildKubeconfig(user, server string, caPEM, certPEM, keyPEM []byte) ([]byte, error) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters[kubeconfigCluster] = &clientcmdapi.Cluster{
+		Server:                   server,
+		CertificateAuthorityData: caPEM,
+	}
+	config.AuthInfos[user] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: certPEM,
+		ClientKeyData:         keyPEM,
+	}
+	config.Contexts[kubeconfigCluster] = &clientcmdapi.Context{
+		Cluster:  kubeconfigCluster,
+		AuthInfo: user,
+	}
+	config.CurrentContext = kubeconfigCluster
+
+	if err := clientcmd.Validate(*config); err != nil {
+		return nil, err
+	}
+	return clientcmd.Write(*config)
+}
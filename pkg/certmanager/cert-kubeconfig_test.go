@@ -0,0 +1,190 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("kubeconfig tests", func() {
+	const (
+		namespace = "maroonedpods"
+		user      = "maroonedpods-controller"
+		server    = "https://api.example.com:6443"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(options *cert.KubeconfigOptions) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].TargetService = nil
+		certs[0].TargetUser = &[]string{user}[0]
+		certs[0].EmitKubeconfig = options
+		return certs
+	}
+
+	getTarget := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	bundleCA := func() string {
+		bundle, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cert.CABundleConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return bundle.Data[selfManagedBundleKey]
+	}
+
+	// loads the kubeconfig the way clients do
+	loadKubeconfig := func(secret *corev1.Secret) *rest.Config {
+		Expect(secret.Data).To(HaveKey(kubeconfigKey))
+		config, err := clientcmd.Load(secret.Data[kubeconfigKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientcmd.Validate(*config)).To(Succeed())
+		restConfig, err := clientcmd.NewDefaultClientConfig(*config, nil).ClientConfig()
+		Expect(err).ToNot(HaveOccurred())
+		return restConfig
+	}
+
+	expectIdentity := func(secret *corev1.Secret, restConfig *rest.Config) {
+		Expect(restConfig.CertData).To(Equal(secret.Data[corev1.TLSCertKey]))
+		Expect(restConfig.KeyData).To(Equal(secret.Data[corev1.TLSPrivateKeyKey]))
+		certs, err := crypto.CertsFromPEM(restConfig.CertData)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs[0].Subject.CommonName).To(Equal(user))
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should write a kubeconfig with the client certificate and the CA bundle", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.KubeconfigOptions{Server: server}))).To(Succeed())
+
+		secret := getTarget()
+		restConfig := loadKubeconfig(secret)
+		Expect(restConfig.Host).To(Equal(server))
+		Expect(string(restConfig.CAData)).To(Equal(bundleCA()))
+		expectIdentity(secret, restConfig)
+	})
+
+	It("should read the CA from the CAConfigMap", func() {
+		const serverCA = "server-ca"
+		ca, err := crypto.MakeSelfSignedCAConfig("server-ca", 1)
+		Expect(err).ToNot(HaveOccurred())
+		caPEM, err := crypto.EncodeCertificates(ca.Certs...)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.CoreV1().ConfigMaps(namespace).Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: serverCA},
+			Data:       map[string]string{"ca.crt": string(caPEM)},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		source := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: serverCA}, Key: "ca.crt"}
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.KubeconfigOptions{Server: server, CAConfigMap: source}))).To(Succeed())
+
+		Expect(loadKubeconfig(getTarget()).CAData).To(Equal(caPEM))
+	})
+
+	It("should follow the rotations of the client certificate", func() {
+		certs := newCerts(&cert.KubeconfigOptions{Server: server})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		previous := getTarget()
+
+		expired := previous.DeepCopy()
+		expired.Annotations[certrotation.CertificateNotAfterAnnotation] = time.Now().Format(time.RFC3339)
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), expired, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, expired)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data[corev1.TLSCertKey]).ToNot(Equal(previous.Data[corev1.TLSCertKey]))
+		expectIdentity(secret, loadKubeconfig(secret))
+	})
+
+	It("should update the server without rotating the certificate", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.KubeconfigOptions{Server: server}))).To(Succeed())
+		before := getTarget()
+		waitForSecretInLister(cm, before)
+
+		const moved = "https://api.moved.example.com:6443"
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.KubeconfigOptions{Server: moved}))).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+		restConfig := loadKubeconfig(secret)
+		Expect(restConfig.Host).To(Equal(moved))
+		expectIdentity(secret, restConfig)
+	})
+
+	It("should remove the kubeconfig once disabled", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.KubeconfigOptions{Server: server}))).To(Succeed())
+		before := getTarget()
+		Expect(before.Data).To(HaveKey(kubeconfigKey))
+		waitForSecretInLister(cm, before)
+
+		Expect(cm.Sync(context.TODO(), newCerts(nil))).To(Succeed())
+
+		secret := getTarget()
+		Expect(secret.Data).ToNot(HaveKey(kubeconfigKey))
+		Expect(secret.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+	})
+
+	DescribeTable("should validate the kubeconfig options", func(modify func(cd *cert.CertificateDefinition), valid bool) {
+		cd := newCerts(&cert.KubeconfigOptions{Server: server})[0]
+		modify(&cd)
+		if valid {
+			Expect(cd.Validate()).To(Succeed())
+		} else {
+			Expect(cd.Validate()).To(MatchError(cert.ErrInvalidDefinition))
+		}
+	},
+		Entry("a client certificate", func(cd *cert.CertificateDefinition) {}, true),
+		Entry("a serving certificate", func(cd *cert.CertificateDefinition) {
+			cd.TargetUser = nil
+			cd.TargetService = &[]string{"maroonedpods-server"}[0]
+		}, false),
+		Entry("without a server", func(cd *cert.CertificateDefinition) {
+			cd.EmitKubeconfig.Server = ""
+		}, false),
+		Entry("a plain http server", func(cd *cert.CertificateDefinition) {
+			cd.EmitKubeconfig.Server = "http://api.example.com"
+		}, false),
+		Entry("without a CA", func(cd *cert.CertificateDefinition) {
+			cd.CertBundleConfigmap = nil
+		}, false),
+		Entry("with a split key", func(cd *cert.CertificateDefinition) {
+			cd.SplitKeySecret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "key"}}
+		}, false),
+		Entry("with an External target", func(cd *cert.CertificateDefinition) {
+			cd.External = true
+		}, false),
+	)
+})
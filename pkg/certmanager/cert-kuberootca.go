@@ -0,0 +1,142 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// kubeRootCAConfigMap holds the cluster root CA in every namespace
+	kubeRootCAConfigMap = mpcerts.KubeRootCAConfigMapName
+	kubeRootCAKey       = "ca.crt"
+
+	// annKubeRootCAs records the fingerprints of the certificates of the bundle merged from
+	// kube-root-ca.crt, they are not CAs of the operator
+	annKubeRootCAs = "operator.maroonedpods.io/kubeRootCAs"
+)
+
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// kubeRootCAsOf returns the fingerprints of the certificates the bundle configmap got from kube-root-ca.crt
+func kubeRootCAsOf(configMap *corev1.ConfigMap) sets.String {
+	var fingerprints []string
+	if ann := configMap.Annotations[annKubeRootCAs]; ann != "" {
+		if err := json.Unmarshal([]byte(ann), &fingerprints); err != nil {
+			log.Info("Ignoring invalid kube root CAs annotation", "configmap", configMap.Name, "error", err.Error())
+		}
+	}
+	return sets.NewString(fingerprints...)
+}
+
+// splitKubeRootCAs separates the certificates of the bundle merged from kube-root-ca.crt from the others
+func splitKubeRootCAs(bundle []*x509.Certificate, kubeRootCAs sets.String) (own, kubeRoot []*x509.Certificate) {
+	for _, cert := range bundle {
+		if kubeRootCAs.Has(certFingerprint(cert)) {
+			kubeRoot = append(kubeRoot, cert)
+		} else {
+			own = append(own, cert)
+		}
+	}
+	return own, kubeRoot
+}
+
+// syncKubeRootCA merges the certificates of kube-root-ca.crt of the bundle namespace into the bundle
+// of a definition with IncludeKubeRootCA, after the other CAs and without duplicates. The merged
+// certificates are recorded, so they follow kube-root-ca.crt and are removed with the option.
+// It returns the bundle.
+func (cm *certManager) syncKubeRootCA(cd mpcerts.CertificateDefinition, bundle []*x509.Certificate) ([]*x509.Certificate, error) {
+	bundleConfigMap := cd.CertBundleConfigmap
+	listers, err := cm.listersFor(clusterNamespace{cluster: cd.BundleCluster, namespace: bundleConfigMap.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	if !cd.IncludeKubeRootCA {
+		// nothing to clean up either, avoid the uncached read
+		cached, err := listers.configMapLister.ConfigMaps(bundleConfigMap.Namespace).Get(bundleConfigMap.Name)
+		if err == nil && cached.Annotations[annKubeRootCAs] == "" {
+			return bundle, nil
+		}
+	}
+
+	var desired []*x509.Certificate
+	if cd.IncludeKubeRootCA {
+		kubeRoot, err := listers.configMapLister.ConfigMaps(bundleConfigMap.Namespace).Get(kubeRootCAConfigMap)
+		switch {
+		case errors.IsNotFound(err):
+			log.Info("No cluster root CA to merge into the bundle", "configmap", kubeRootCAConfigMap, "namespace", bundleConfigMap.Namespace)
+		case err != nil:
+			return nil, err
+		case kubeRoot.Data[kubeRootCAKey] != "":
+			parsed, err := cm.parseCerts(kubeRoot, kubeRootCAKey)
+			if err != nil {
+				log.Info("Ignoring the unparsable cluster root CA", "namespace", bundleConfigMap.Namespace, "error", err.Error())
+			} else {
+				desired = parsed.certs
+			}
+		}
+	}
+
+	configMaps := cm.kubeClient(cd.BundleCluster).CoreV1().ConfigMaps(bundleConfigMap.Namespace)
+	configMap, err := configMaps.Get(context.TODO(), bundleConfigMap.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := cm.parseCerts(configMap, selfManagedBundleKey)
+	if err != nil {
+		return nil, err
+	}
+	current := parsed.certs
+
+	merged, _ := splitKubeRootCAs(current, kubeRootCAsOf(configMap))
+	var fingerprints []string
+	for _, cert := range desired {
+		// an identical certificate of the bundle is not ours to track
+		if containsCert(merged, cert) {
+			continue
+		}
+		merged = append(merged, cert)
+		fingerprints = append(fingerprints, certFingerprint(cert))
+	}
+
+	updated := configMap.DeepCopy()
+	if len(fingerprints) == 0 {
+		delete(updated.Annotations, annKubeRootCAs)
+	} else {
+		annotation, err := json.Marshal(fingerprints)
+		if err != nil {
+			return nil, err
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annKubeRootCAs] = string(annotation)
+	}
+	caBundle, err := crypto.EncodeCertificates(merged...)
+	if err != nil {
+		return nil, err
+	}
+	updated.Data[selfManagedBundleKey] = string(caBundle)
+
+	if !configMapChanged(configMap, updated) {
+		return current, nil
+	}
+	if _, err := configMaps.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		return nil, err
+	}
+	log.Info("Merged the cluster root CA into the bundle", "configmap", bundleConfigMap.Name, "namespace", bundleConfigMap.Namespace, "kubeRootCAs", len(fingerprints))
+	return merged, nil
+}
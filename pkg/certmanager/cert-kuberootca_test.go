@@ -0,0 +1,156 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("cluster root CA merge tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(include bool) []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace, IncludeKubeRootCA: include})
+	}
+
+	newRootCA := func(name string) *x509.Certificate {
+		ca, err := certtest.NewCA(name, time.Now(), time.Now().Add(24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		return ca.Config.Certs[0]
+	}
+
+	// writes kube-root-ca.crt as kube-controller-manager does
+	writeKubeRootCA := func(certs ...*x509.Certificate) {
+		pem, err := crypto.EncodeCertificates(certs...)
+		Expect(err).ToNot(HaveOccurred())
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: kubeRootCAConfigMap},
+			Data:       map[string]string{kubeRootCAKey: string(pem)},
+		}
+		_, err = client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), kubeRootCAConfigMap, metav1.GetOptions{})
+		if err == nil {
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		} else {
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() map[string]string {
+			cached, _ := cm.listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(kubeRootCAConfigMap)
+			if cached == nil {
+				return nil
+			}
+			return cached.Data
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(configMap.Data))
+	}
+
+	getBundle := func() []*x509.Certificate {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))
+		Expect(err).ToNot(HaveOccurred())
+		return certs
+	}
+
+	getSignerCert := func() *x509.Certificate {
+		signer, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), signerName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM(signer.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certs[0]
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		// kube-root-ca.crt is written before the first sync starts the configmap informer
+		Expect(cm.startConfigMapLister(newCerts(true)[0])).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should merge the cluster root CA after the CAs of the operator", func() {
+		root := newRootCA("kube-root")
+		writeKubeRootCA(root)
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		bundle := getBundle()
+		Expect(bundle).To(HaveLen(2))
+		Expect(bundle[0].Equal(getSignerCert())).To(BeTrue())
+		Expect(bundle[1].Equal(root)).To(BeTrue())
+
+		// already merged
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		Expect(getBundle()).To(HaveLen(2))
+	})
+
+	It("should not duplicate a certificate the bundle already has", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		signer := getSignerCert()
+		root := newRootCA("kube-root")
+		writeKubeRootCA(signer, root)
+
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		bundle := getBundle()
+		Expect(bundle).To(HaveLen(2))
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kubeRootCAsOf(configMap).List()).To(Equal([]string{certFingerprint(root)}))
+	})
+
+	It("should follow a rotated cluster root CA and drop it with the option", func() {
+		old := newRootCA("kube-root-old")
+		writeKubeRootCA(old)
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		rotated := newRootCA("kube-root-new")
+		writeKubeRootCA(rotated)
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		bundle := getBundle()
+		Expect(bundle).To(HaveLen(2))
+		Expect(containsCert(bundle, old)).To(BeFalse())
+		Expect(containsCert(bundle, rotated)).To(BeTrue())
+
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		bundle = getBundle()
+		Expect(bundle).To(HaveLen(1))
+		Expect(bundle[0].Equal(getSignerCert())).To(BeTrue())
+	})
+
+	It("should not count the cluster root CAs against the cap", func() {
+		writeKubeRootCA(newRootCA("kube-root-1"), newRootCA("kube-root-2"))
+		certs := newCerts(true)
+		certs[0].MaxBundleCAs = 1
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		bundle := getBundle()
+		Expect(bundle).To(HaveLen(3))
+		Expect(bundle[0].Equal(getSignerCert())).To(BeTrue())
+	})
+})
@@ -0,0 +1,83 @@
+package certmanager
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// definitionLabels are the label keys of the definitions, the certificate manager creates its objects
+// with them and keeps them set. The labels of other writers, e.g. backup selectors, are left alone.
+var definitionLabels = func() []string {
+	var keys []string
+	for key := range util.ResourceBuilder.WithCommonLabels(nil) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}()
+
+// mergeOwned returns a copy of current with the owned keys set to their value in desired, or dropped
+// if desired doesn't have them. The other keys are kept as they are.
+func mergeOwned(current map[string]string, owned []string, desired map[string]string) map[string]string {
+	merged := make(map[string]string, len(current))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for _, key := range owned {
+		if value, ok := desired[key]; ok {
+			merged[key] = value
+		} else {
+			delete(merged, key)
+		}
+	}
+	return merged
+}
+
+// ownedInSync reports whether the owned keys of current have their value in desired
+func ownedInSync(current map[string]string, owned []string, desired map[string]string) bool {
+	for _, key := range owned {
+		value, ok := desired[key]
+		currentValue, currentOk := current[key]
+		if ok != currentOk || value != currentValue {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureSecretLabels sets the labels of the definition on the secret
+func (cm *certManager) ensureSecretLabels(ctx context.Context, secret, template *corev1.Secret) (*corev1.Secret, error) {
+	if ownedInSync(secret.Labels, definitionLabels, template.Labels) {
+		return secret, nil
+	}
+	updated := secret.DeepCopy()
+	updated.Labels = mergeOwned(secret.Labels, definitionLabels, template.Labels)
+	return cm.applySecret(ctx, secret, updated)
+}
+
+// ensureConfigMapLabels sets the labels of the definition on the configmap in the cluster
+func (cm *certManager) ensureConfigMapLabels(ctx context.Context, cluster mpcerts.Cluster, template *corev1.ConfigMap) error {
+	configMap, err := cm.listers()[clusterNamespace{cluster: cluster, namespace: template.Namespace}].configMapLister.ConfigMaps(template.Namespace).Get(template.Name)
+	if err == nil && ownedInSync(configMap.Labels, definitionLabels, template.Labels) {
+		return nil
+	}
+
+	// the lister copy can be older than the update of library-go
+	configMap, err = cm.coreClient(cluster).ConfigMaps(template.Namespace).Get(ctx, template.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if ownedInSync(configMap.Labels, definitionLabels, template.Labels) {
+		return nil
+	}
+	updated := configMap.DeepCopy()
+	updated.Labels = mergeOwned(configMap.Labels, definitionLabels, template.Labels)
+	_, err = cm.applyConfigMap(cluster, configMap, updated)
+	return err
+}
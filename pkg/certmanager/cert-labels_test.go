@@ -0,0 +1,137 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("managed labels tests", func() {
+	const namespace = "maroonedpods"
+
+	owned := []string{"ours", "also-ours"}
+
+	DescribeTable("should merge the owned keys only", func(current, desired, expected map[string]string) {
+		before := map[string]string{}
+		for key, value := range current {
+			before[key] = value
+		}
+		Expect(mergeOwned(current, owned, desired)).To(Equal(expected))
+		Expect(ownedInSync(expected, owned, desired)).To(BeTrue())
+		// the current labels are not modified
+		Expect(current).To(HaveLen(len(before)))
+		for key, value := range before {
+			Expect(current).To(HaveKeyWithValue(key, value))
+		}
+	},
+		Entry("adds the missing keys",
+			nil,
+			map[string]string{"ours": "a", "also-ours": "b"},
+			map[string]string{"ours": "a", "also-ours": "b"}),
+		Entry("keeps the foreign keys",
+			map[string]string{"velero.io/backup": "daily", "argocd.argoproj.io/instance": "infra", "ours": "a"},
+			map[string]string{"ours": "a", "also-ours": "b"},
+			map[string]string{"velero.io/backup": "daily", "argocd.argoproj.io/instance": "infra", "ours": "a", "also-ours": "b"}),
+		Entry("overwrites a conflicting value of an owned key",
+			map[string]string{"ours": "edited", "foreign": "x"},
+			map[string]string{"ours": "a"},
+			map[string]string{"ours": "a", "foreign": "x"}),
+		Entry("removes an owned key the desired labels don't have",
+			map[string]string{"ours": "a", "also-ours": "b", "foreign": "x"},
+			map[string]string{"ours": "a"},
+			map[string]string{"ours": "a", "foreign": "x"}),
+		Entry("ignores the desired keys it doesn't own",
+			map[string]string{"foreign": "x"},
+			map[string]string{"ours": "a", "foreign": "y", "other": "z"},
+			map[string]string{"ours": "a", "foreign": "x"}),
+	)
+
+	Context("with the cert manager", func() {
+		var (
+			client *fake.Clientset
+			cm     *certManager
+			cancel context.CancelFunc
+		)
+
+		newCerts := func() []cert.CertificateDefinition {
+			return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		}
+
+		// edits the labels of the objects as cluster tooling and hand edits do
+		editLabels := func(secret *corev1.Secret, configMap *corev1.ConfigMap) {
+			var err error
+			secret, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			listers := cm.listerMap[clusterNamespace{namespace: namespace}]
+			Eventually(func() map[string]string {
+				current, _ := listers.secretLister.Secrets(namespace).Get(secret.Name)
+				if current == nil {
+					return nil
+				}
+				return current.Labels
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal(secret.Labels))
+			Eventually(func() map[string]string {
+				current, _ := listers.configMapLister.ConfigMaps(namespace).Get(configMap.Name)
+				if current == nil {
+					return nil
+				}
+				return current.Labels
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal(configMap.Labels))
+		}
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace).(*certManager)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.Start(ctx)).To(Succeed())
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should restore its labels and keep the foreign ones", func() {
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "maroonedpods-server-signer-bundle", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			secret.Labels["velero.io/exclude-from-backup"] = "false"
+			secret.Labels[util.AppKubernetesManagedByLabel] = "helm"
+			delete(secret.Labels, util.MaroonedPodsLabel)
+			configMap.Labels["cost-center"] = "platform"
+			configMap.Labels[util.AppKubernetesComponentLabel] = "edited"
+			editLabels(secret, configMap)
+
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+			secret, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(secret.Labels).To(HaveKeyWithValue("velero.io/exclude-from-backup", "false"))
+			for key, value := range util.ResourceBuilder.WithCommonLabels(nil) {
+				Expect(secret.Labels).To(HaveKeyWithValue(key, value))
+			}
+
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "maroonedpods-server-signer-bundle", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configMap.Labels).To(HaveKeyWithValue("cost-center", "platform"))
+			for key, value := range util.ResourceBuilder.WithCommonLabels(nil) {
+				Expect(configMap.Labels).To(HaveKeyWithValue(key, value))
+			}
+		})
+
+	})
+})
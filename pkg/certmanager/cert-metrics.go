@@ -0,0 +1,92 @@
+package certmanager
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	certExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_certificate_expiration_timestamp_seconds",
+		Help: "Unix time the certificate expires at",
+	}, []string{"namespace", "secret"})
+
+	certRotationStuck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_certificate_rotation_stuck",
+		Help: "1 if the certificate is inside its refresh window and the last rotation attempt failed",
+	}, []string{"namespace", "secret"})
+
+	certNextRotation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_certificate_next_rotation_timestamp_seconds",
+		Help: "Unix time the certificate is projected to be rotated at, 0 if it is missing or can't be parsed",
+	}, []string{"namespace", "secret"})
+
+	certRotations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "maroonedpods_certificate_rotations_total",
+		Help: "Number of rotations of the certificate by reason",
+	}, []string{"namespace", "secret", "reason"})
+
+	certBundleRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "maroonedpods_certificate_bundle_repairs_total",
+		Help: "Number of times the current CA was missing from the bundle configmap and restored",
+	}, []string{"namespace", "configmap"})
+
+	certChainBroken = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_certificate_chain_broken",
+		Help: "1 if the certificate doesn't verify against its CA bundle or the bundle lacks the current signer, after healing",
+	}, []string{"namespace", "secret"})
+
+	certCanaryHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_cert_canary_healthy",
+		Help: "1 if the last canary certificate of the signer was issued, written and verified against its CA bundle",
+	}, []string{"namespace", "signer"})
+
+	externalCertValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_external_certificate_valid",
+		Help: "1 if the provided certificate passed the last validation",
+	}, []string{"namespace", "secret"})
+
+	externalCertExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "maroonedpods_external_certificate_expiration_timestamp_seconds",
+		Help: "Unix time the provided certificate expires at, 0 if it is missing or can't be parsed",
+	}, []string{"namespace", "secret"})
+
+	certSyncErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "maroonedpods_certificate_sync_errors_total",
+		Help: "Number of certificate syncs that failed",
+	})
+
+	certSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "maroonedpods_cert_sync_total",
+		Help: "Number of certificate syncs by result, success or error",
+	}, []string{"result"})
+
+	certSyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "maroonedpods_cert_sync_duration_seconds",
+		Help:    "Duration of the certificate syncs, failed or not",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+)
+
+const (
+	syncResultSuccess = "success"
+	syncResultError   = "error"
+)
+
+func init() {
+	metrics.Registry.MustRegister(certExpiration, certRotationStuck, certNextRotation, certRotations, certBundleRepairs, certChainBroken, certSyncErrors,
+		certSyncs, certSyncDuration, certCanaryHealthy, externalCertValid, externalCertExpiration)
+}
+
+// observeSync records the outcome and the duration of a certificate sync
+func observeSync(start time.Time, err error) {
+	certSyncDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		certSyncErrors.Inc()
+		certSyncs.WithLabelValues(syncResultError).Inc()
+		return
+	}
+	certSyncs.WithLabelValues(syncResultSuccess).Inc()
+}
@@ -0,0 +1,85 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("certificate sync metrics tests", func() {
+	const namespace = "maroonedpods"
+
+	histogramCount := func(observer prometheus.Observer) uint64 {
+		var m dto.Metric
+		ExpectWithOffset(1, observer.(prometheus.Metric).Write(&m)).To(Succeed())
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	counterValue := func(counter prometheus.Counter) float64 {
+		var m dto.Metric
+		ExpectWithOffset(1, counter.Write(&m)).To(Succeed())
+		return m.GetCounter().GetValue()
+	}
+
+	var (
+		client     *fake.Clientset
+		cm         CertManager
+		cancel     context.CancelFunc
+		failWrites bool
+	)
+
+	BeforeEach(func() {
+		failWrites = false
+		client = fake.NewSimpleClientset()
+		client.PrependReactor("*", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if failWrites && action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+				return true, nil, fmt.Errorf("admission webhook denied the request")
+			}
+			return false, nil, nil
+		})
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should observe the duration and the outcome of the syncs", func() {
+		durations := histogramCount(certSyncDuration)
+		successes := counterValue(certSyncs.WithLabelValues(syncResultSuccess))
+		failures := counterValue(certSyncs.WithLabelValues(syncResultError))
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+
+		Expect(histogramCount(certSyncDuration)).To(Equal(durations + 1))
+		Expect(counterValue(certSyncs.WithLabelValues(syncResultSuccess))).To(Equal(successes + 1))
+		Expect(counterValue(certSyncs.WithLabelValues(syncResultError))).To(Equal(failures))
+	})
+
+	It("should count a failed sync as an error", func() {
+		failWrites = true
+		durations := histogramCount(certSyncDuration)
+		failures := counterValue(certSyncs.WithLabelValues(syncResultError))
+		errors := counterValue(certSyncErrors)
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).ToNot(Succeed())
+
+		Expect(histogramCount(certSyncDuration)).To(Equal(durations + 1))
+		Expect(counterValue(certSyncs.WithLabelValues(syncResultError))).To(Equal(failures + 1))
+		Expect(counterValue(certSyncErrors)).To(Equal(errors + 1))
+	})
+})
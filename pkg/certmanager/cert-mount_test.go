@@ -0,0 +1,84 @@
+package certmanager
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("server cert mount tests", func() {
+	const namespace = "maroonedpods"
+
+	findDeployment := func(name string) *appsv1.Deployment {
+		resources, err := mpnamespaced.CreateAllResources(&mpnamespaced.FactoryArgs{Namespace: namespace})
+		Expect(err).ToNot(HaveOccurred())
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok && deployment.Name == name {
+				return deployment
+			}
+		}
+		Fail("no deployment " + name)
+		return nil
+	}
+
+	certVolumeOf := func(deployment *appsv1.Deployment, secretName string) *corev1.Volume {
+		for i, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.Secret != nil && volume.Secret.SecretName == secretName {
+				return &deployment.Spec.Template.Spec.Volumes[i]
+			}
+		}
+		return nil
+	}
+
+	It("should use the server certificate of the definitions", func() {
+		serverCert := cert.ServerCertificateDefinition()
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(certs[0].TargetSecret.Name).To(Equal(serverCert.TargetSecret.Name))
+		Expect(certs[0].TargetService).To(Equal(serverCert.TargetService))
+	})
+
+	It("should mount the target secret in every deployment the definition rolls", func() {
+		serverCert := cert.ServerCertificateDefinition()
+		certFile, keyFile := serverCert.TargetFiles()
+
+		for _, name := range serverCert.RolloutDeployments {
+			deployment := findDeployment(name)
+			volume := certVolumeOf(deployment, serverCert.TargetSecret.Name)
+			Expect(volume).ToNot(BeNil(), "deployment %s doesn't mount %s", name, serverCert.TargetSecret.Name)
+			Expect(volume.Secret.Items).To(ConsistOf(
+				corev1.KeyToPath{Key: certFile, Path: certFile},
+				corev1.KeyToPath{Key: keyFile, Path: keyFile},
+			))
+		}
+	})
+
+	It("should mount the server certificate in the cert dir", func() {
+		serverCert := cert.ServerCertificateDefinition()
+		deployment := findDeployment(util.MaroonedPodsServerResourceName)
+		volume := certVolumeOf(deployment, serverCert.TargetSecret.Name)
+		Expect(volume).ToNot(BeNil())
+
+		container := deployment.Spec.Template.Spec.Containers[0]
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: cert.ServerCertDir,
+			ReadOnly:  true,
+		}))
+	})
+
+	It("should mount the additional keys of the definition", func() {
+		serverCert := cert.ServerCertificateDefinition()
+		serverCert.CertKeyName = "server.crt"
+		serverCert.KeyKeyName = "server.key"
+
+		certFile, keyFile := serverCert.TargetFiles()
+		Expect(certFile).To(Equal("server.crt"))
+		Expect(keyFile).To(Equal("server.key"))
+	})
+})
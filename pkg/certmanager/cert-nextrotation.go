@@ -0,0 +1,59 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// NextRotations returns the projected rotation time of every signer and target certificate of the
+// last sync. Certificates that are missing or can't be parsed get a zero time, the reasons are
+// returned in the error, the map is complete nonetheless.
+func (cm *certManager) NextRotations(ctx context.Context) (map[types.NamespacedName]time.Time, error) {
+	rotations := map[types.NamespacedName]time.Time{}
+	var errs []error
+	for _, cd := range cm.lastSyncedCerts() {
+		for _, c := range managedCertsOf(cd) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			key := types.NamespacedName{Namespace: c.secret.Namespace, Name: c.secret.Name}
+			rotation, err := cm.nextRotationOf(c)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+			rotations[key] = rotation
+
+			value := float64(0)
+			if !rotation.IsZero() {
+				value = float64(rotation.Unix())
+			}
+			certNextRotation.WithLabelValues(key.Namespace, key.Name).Set(value)
+		}
+	}
+	return rotations, utilerrors.NewAggregate(errs)
+}
+
+func (cm *certManager) nextRotationOf(c managedCert) (time.Time, error) {
+	listers, err := cm.listersFor(clusterNamespace{namespace: c.secret.Namespace})
+	if err != nil {
+		return time.Time{}, err
+	}
+	secret, err := listers.secretLister.Secrets(c.secret.Namespace).Get(c.secret.Name)
+	if errors.IsNotFound(err) {
+		return time.Time{}, fmt.Errorf("certificate is not issued yet")
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	notBefore, notAfter, ok := cm.certValidity(secret)
+	if !ok {
+		return time.Time{}, fmt.Errorf("certificate can't be parsed")
+	}
+	return refreshTime(cm.jittered(c.secret, c.config), notBefore, notAfter), nil
+}
@@ -0,0 +1,174 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	dto "github.com/prometheus/client_model/go"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("next rotation tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		cm     *certManager
+		cancel context.CancelFunc
+		now    time.Time
+	)
+
+	// issued age ago with the given lifetime
+	newCertSecret := func(name string, age, lifetime time.Duration) *corev1.Secret {
+		notBefore := now.Add(-age)
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Annotations: map[string]string{
+					certrotation.CertificateNotBeforeAnnotation: notBefore.Format(time.RFC3339),
+					certrotation.CertificateNotAfterAnnotation:  notBefore.Add(lifetime).Format(time.RFC3339),
+				},
+			},
+		}
+	}
+
+	start := func(secrets ...*corev1.Secret) {
+		client := fake.NewSimpleClientset()
+		for _, secret := range secrets {
+			_, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	key := func(name string) types.NamespacedName {
+		return types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	gauge := func(name string) float64 {
+		var m dto.Metric
+		Expect(certNextRotation.WithLabelValues(namespace, name).Write(&m)).To(Succeed())
+		return m.GetGauge().GetValue()
+	}
+
+	BeforeEach(func() {
+		now = time.Now().Truncate(time.Second)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should project the rotation of signers and targets of various ages", func() {
+		start(
+			newCertSecret("signer", 10*24*time.Hour, 48*24*time.Hour),
+			newCertSecret("target", time.Hour, 24*time.Hour),
+			newCertSecret("expired", 72*time.Hour, 24*time.Hour),
+		)
+		cm.certs = []cert.CertificateDefinition{
+			{
+				SignerSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "signer"}},
+				SignerConfig: cert.CertificateConfig{Lifetime: 48 * 24 * time.Hour, Refresh: 24 * 24 * time.Hour},
+				TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "target"}},
+				TargetConfig: cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour},
+			},
+			{
+				TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "expired"}},
+				TargetConfig: cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour},
+			},
+		}
+
+		rotations, err := cm.NextRotations(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(rotations).To(HaveLen(3))
+		Expect(rotations[key("signer")]).To(BeTemporally("==", now.Add(14*24*time.Hour)))
+		Expect(rotations[key("target")]).To(BeTemporally("==", now.Add(11*time.Hour)))
+		// overdue, in the past
+		Expect(rotations[key("expired")]).To(BeTemporally("==", now.Add(-60*time.Hour)))
+		Expect(gauge("target")).To(Equal(float64(now.Add(11 * time.Hour).Unix())))
+	})
+
+	It("should read the validity of certificates without annotations from tls.crt", func() {
+		ca, err := crypto.MakeSelfSignedCAConfigForDuration("issued-elsewhere", 10*time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		certPEM, keyPEM, err := ca.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		start(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "external"},
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		})
+		cm.certs = []cert.CertificateDefinition{{
+			TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "external"}},
+			TargetConfig: cert.CertificateConfig{Lifetime: 10 * time.Hour, Refresh: 5 * time.Hour},
+		}}
+
+		rotations, err := cm.NextRotations(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(rotations[key("external")]).To(BeTemporally("==", ca.Certs[0].NotBefore.Add(5*time.Hour)))
+	})
+
+	It("should report a zero time with a reason for missing and unparseable certificates", func() {
+		start(
+			newCertSecret("target", time.Hour, 24*time.Hour),
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "garbage"},
+				Data:       map[string][]byte{corev1.TLSCertKey: []byte("not a certificate")},
+			},
+		)
+		config := cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour}
+		cm.certs = []cert.CertificateDefinition{
+			{
+				SignerSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "missing"}},
+				SignerConfig: config,
+				TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "target"}},
+				TargetConfig: config,
+			},
+			{
+				TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "garbage"}},
+				TargetConfig: config,
+			},
+		}
+
+		rotations, err := cm.NextRotations(context.TODO())
+		Expect(err).To(MatchError(And(
+			ContainSubstring("maroonedpods/missing: certificate is not issued yet"),
+			ContainSubstring("maroonedpods/garbage: certificate can't be parsed"),
+		)))
+
+		Expect(rotations).To(HaveLen(3))
+		Expect(rotations[key("missing")].IsZero()).To(BeTrue())
+		Expect(rotations[key("garbage")].IsZero()).To(BeTrue())
+		Expect(rotations[key("target")]).To(BeTemporally("==", now.Add(11*time.Hour)))
+		Expect(gauge("garbage")).To(BeZero())
+	})
+
+	It("should cover the definitions of the last sync", func() {
+		start()
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		rotations, _ := cm.NextRotations(context.TODO())
+
+		for _, cd := range certs {
+			for _, c := range managedCertsOf(cd) {
+				Expect(rotations).To(HaveKey(key(c.secret.Name)))
+			}
+		}
+	})
+})
@@ -0,0 +1,108 @@
+package certmanager
+
+import (
+	goerrors "errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// ErrConflictingDefinitions is wrapped by ConflictingDefinitionsError
+var ErrConflictingDefinitions = goerrors.New("conflicting certificate definitions")
+
+// ConflictingDefinitionsError is returned for two definitions managing the same secret differently,
+// the sync would flip the secret between them
+type ConflictingDefinitionsError struct {
+	First  string
+	Second string
+	// Secret is the namespace/name of the secret both manage
+	Secret string
+	// Field is what they disagree on
+	Field string
+}
+
+func (e *ConflictingDefinitionsError) Error() string {
+	return fmt.Sprintf("%s: %s and %s manage secret %s with a different %s", ErrConflictingDefinitions, e.First, e.Second, e.Secret, e.Field)
+}
+
+func (e *ConflictingDefinitionsError) Unwrap() error {
+	return ErrConflictingDefinitions
+}
+
+// normalizeDefinitions returns a copy of the definitions sorted by signer, target and bundle, without
+// the structurally equal duplicates, so the sync and the hash of the definitions don't depend on the
+// order of the input. Definitions sharing a signer must agree on the signer and its bundle, a target
+// is managed by one definition only.
+func normalizeDefinitions(certs []mpcerts.CertificateDefinition) ([]mpcerts.CertificateDefinition, error) {
+	sorted := append([]mpcerts.CertificateDefinition(nil), certs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return definitionSortKey(sorted[i]) < definitionSortKey(sorted[j])
+	})
+
+	normalized := make([]mpcerts.CertificateDefinition, 0, len(sorted))
+	signers := map[string]mpcerts.CertificateDefinition{}
+	targets := map[string]mpcerts.CertificateDefinition{}
+next:
+	for _, cd := range sorted {
+		for _, seen := range normalized {
+			if equality.Semantic.DeepEqual(seen, cd) {
+				continue next
+			}
+		}
+		if key := secretKey(cd.SignerSecret); key != "" {
+			if first, ok := signers[key]; ok {
+				if field := signerConflict(first, cd); field != "" {
+					return nil, &ConflictingDefinitionsError{First: first.Name(), Second: cd.Name(), Secret: key, Field: field}
+				}
+			} else {
+				signers[key] = cd
+			}
+		}
+		if key := secretKey(cd.TargetSecret); key != "" {
+			if first, ok := targets[key]; ok {
+				return nil, &ConflictingDefinitionsError{First: first.Name(), Second: cd.Name(), Secret: key, Field: "definition"}
+			}
+			targets[key] = cd
+		}
+		normalized = append(normalized, cd)
+	}
+	return normalized, nil
+}
+
+// signerConflict returns what two definitions sharing a signer disagree on about it, empty if nothing
+func signerConflict(first, second mpcerts.CertificateDefinition) string {
+	switch {
+	case !equality.Semantic.DeepEqual(first.SignerSecret, second.SignerSecret):
+		return "signer secret"
+	case first.SignerConfig != second.SignerConfig:
+		return "signer config"
+	case objectKey(first.CertBundleConfigmap) != objectKey(second.CertBundleConfigmap):
+		return "CA bundle"
+	case first.BundleCluster != second.BundleCluster:
+		return "bundle cluster"
+	}
+	return ""
+}
+
+// definitionSortKey orders the definitions by signer, then target, then bundle
+func definitionSortKey(cd mpcerts.CertificateDefinition) string {
+	return secretKey(cd.SignerSecret) + "\x00" + secretKey(cd.TargetSecret) + "\x00" + objectKey(cd.CertBundleConfigmap)
+}
+
+func secretKey(secret *corev1.Secret) string {
+	if secret == nil {
+		return ""
+	}
+	return secret.Namespace + "/" + secret.Name
+}
+
+func objectKey(configMap *corev1.ConfigMap) string {
+	if configMap == nil {
+		return ""
+	}
+	return configMap.Namespace + "/" + configMap.Name
+}
@@ -0,0 +1,168 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("definition normalization", func() {
+	const namespace = "maroonedpods"
+
+	newCerts := func() []cert.CertificateDefinition {
+		certs, err := cert.NewDefinitionFactory(namespace, cert.WithControllerClientCert(), cert.WithMetricsCerts())
+		Expect(err).ToNot(HaveOccurred())
+		return certs
+	}
+
+	reversed := func(certs []cert.CertificateDefinition) []cert.CertificateDefinition {
+		result := make([]cert.CertificateDefinition, 0, len(certs))
+		for i := len(certs) - 1; i >= 0; i-- {
+			result = append(result, certs[i])
+		}
+		return result
+	}
+
+	It("should not depend on the order of the definitions", func() {
+		certs := newCerts()
+		normalized, err := normalizeDefinitions(certs)
+		Expect(err).ToNot(HaveOccurred())
+		fromReversed, err := normalizeDefinitions(reversed(certs))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fromReversed).To(Equal(normalized))
+
+		hash, err := definitionsHash(normalized)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(definitionsHash(fromReversed)).To(Equal(hash))
+
+		for i := 1; i < len(normalized); i++ {
+			Expect(definitionSortKey(normalized[i-1]) <= definitionSortKey(normalized[i])).To(BeTrue())
+		}
+	})
+
+	It("should drop the equal duplicates", func() {
+		certs := newCerts()
+		// a deep copy, equal but not the same pointers
+		duplicate := newCerts()[0]
+		normalized, err := normalizeDefinitions(append(certs, duplicate))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(normalized).To(HaveLen(len(certs)))
+	})
+
+	It("should reject the definitions sharing a signer with different configs", func() {
+		certs := newCerts()
+		var server, client int
+		for i := range certs {
+			switch certs[i].TargetSecret.Name {
+			case cert.ServerCertSecretName:
+				server = i
+			case cert.ControllerClientCertSecretName:
+				client = i
+			}
+		}
+		certs[client].SignerConfig.Lifetime += time.Hour
+
+		_, err := normalizeDefinitions(certs)
+		Expect(err).To(MatchError(ErrConflictingDefinitions))
+		var conflict *ConflictingDefinitionsError
+		Expect(errors.As(err, &conflict)).To(BeTrue())
+		Expect([]string{conflict.First, conflict.Second}).To(ConsistOf(certs[server].Name(), certs[client].Name()))
+		Expect(conflict.Secret).To(Equal(namespace + "/" + cert.ServerSignerSecretName))
+		Expect(conflict.Field).To(Equal("signer config"))
+	})
+
+	It("should reject two definitions of a target", func() {
+		certs := newCerts()
+		other := newCerts()[0]
+		other.TargetConfig.Lifetime += time.Hour
+
+		_, err := normalizeDefinitions(append(certs, other))
+		Expect(err).To(MatchError(ErrConflictingDefinitions))
+	})
+
+	Context("sync", func() {
+		var (
+			client *fake.Clientset
+			cm     *certManager
+			cancel context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace).(*certManager)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.Start(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		written := func() []string {
+			var written []string
+			for _, action := range client.Actions() {
+				switch action.GetVerb() {
+				case "create", "update", "patch", "delete":
+					written = append(written, action.GetVerb()+" "+action.GetResource().Resource+" "+objectNameOf(action))
+				}
+			}
+			return written
+		}
+
+		writes := func(certs []cert.CertificateDefinition) []string {
+			client.ClearActions()
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			return written()
+		}
+
+		It("should write nothing when the definitions converged, whatever their order", func() {
+			certs := newCerts()
+			// until the informers delivered the writes
+			Eventually(func() []string {
+				return writes(certs)
+			}, 10*time.Second, 200*time.Millisecond).Should(BeEmpty())
+
+			Expect(writes(certs)).To(BeEmpty())
+			Expect(writes(reversed(certs))).To(BeEmpty())
+		})
+
+		It("should fail the sync of conflicting definitions before writing", func() {
+			certs := newCerts()
+			other := newCerts()[0]
+			other.SignerConfig.Refresh += time.Hour
+			other.TargetSecret.Name = "other"
+
+			client.ClearActions()
+			Expect(cm.Sync(context.TODO(), append(certs, other))).To(MatchError(ErrConflictingDefinitions))
+			Expect(written()).To(BeEmpty())
+		})
+	})
+})
+
+// objectNameOf returns the name of the object of an action, if it has one
+func objectNameOf(action k8stesting.Action) string {
+	switch a := action.(type) {
+	case k8stesting.CreateAction:
+		if obj, ok := a.GetObject().(interface{ GetName() string }); ok {
+			return obj.GetName()
+		}
+	case k8stesting.UpdateAction:
+		if obj, ok := a.GetObject().(interface{ GetName() string }); ok {
+			return obj.GetName()
+		}
+	case k8stesting.PatchAction:
+		return a.GetName()
+	case k8stesting.DeleteAction:
+		return a.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package certmanager
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// maxParsedCerts bounds the entries of the parse cache, well above the objects of an install
+const maxParsedCerts = 1024
+
+// parsedCerts are the certificates parsed from a key of a secret or configmap, with the facts of the
+// first one. They are shared between the readers and must not be modified.
+type parsedCerts struct {
+	certs     []*x509.Certificate
+	notBefore time.Time
+	notAfter  time.Time
+	serial    string
+	sans      []string
+	err       error
+}
+
+func newParsedCerts(certs []*x509.Certificate, err error) *parsedCerts {
+	if err == nil && len(certs) == 0 {
+		err = fmt.Errorf("no certificate")
+	}
+	if err != nil {
+		return &parsedCerts{err: err}
+	}
+	leaf := certs[0]
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	return &parsedCerts{
+		// an append of a reader can't write into the shared array
+		certs:     certs[:len(certs):len(certs)],
+		notBefore: leaf.NotBefore,
+		notAfter:  leaf.NotAfter,
+		serial:    leaf.SerialNumber.String(),
+		sans:      sans,
+	}
+}
+
+// parseCacheKey identifies a version of a key of an object. Objects without a UID or resource version,
+// e.g. of the fake clients, are identified by the digest of the data instead.
+type parseCacheKey struct {
+	uid             types.UID
+	resourceVersion string
+	key             string
+}
+
+type parseCacheEntry struct {
+	key    parseCacheKey
+	parsed *parsedCerts
+}
+
+// certParseCache holds the certificates parsed from the secrets and configmaps of the definitions, so a
+// sync only parses the objects that changed since the previous one
+type certParseCache struct {
+	lock    sync.Mutex
+	entries map[parseCacheKey]*list.Element
+	// most recently used first
+	lru *list.List
+	// replaced by the tests to count the parses
+	parse func(pemData []byte) ([]*x509.Certificate, error)
+}
+
+func newCertParseCache() *certParseCache {
+	return &certParseCache{
+		entries: make(map[parseCacheKey]*list.Element),
+		lru:     list.New(),
+		parse:   crypto.CertsFromPEM,
+	}
+}
+
+// get returns the certificates of the data of the key of the object, it has to be the data of the
+// object as it was read
+func (c *certParseCache) get(obj metav1.Object, dataKey string, data []byte) *parsedCerts {
+	key := parseCacheKey{uid: obj.GetUID(), resourceVersion: obj.GetResourceVersion(), key: dataKey}
+	if key.uid == "" || key.resourceVersion == "" {
+		digest := sha256.Sum256(data)
+		key = parseCacheKey{key: hex.EncodeToString(digest[:])}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		return element.Value.(*parseCacheEntry).parsed
+	}
+
+	parsed := newParsedCerts(c.parse(data))
+	if key.uid != "" {
+		// the older versions of the object won't be read again
+		c.removeLocked(func(k parseCacheKey) bool { return k.uid == key.uid && k.resourceVersion != key.resourceVersion })
+	}
+	c.entries[key] = c.lru.PushFront(&parseCacheEntry{key: key, parsed: parsed})
+	for c.lru.Len() > maxParsedCerts {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parseCacheEntry).key)
+	}
+	return parsed
+}
+
+// forget drops the entries of a deleted object, the informers call it on deletions
+func (c *certParseCache) forget(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil || accessor.GetUID() == "" {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.removeLocked(func(k parseCacheKey) bool { return k.uid == accessor.GetUID() })
+}
+
+func (c *certParseCache) removeLocked(matches func(parseCacheKey) bool) {
+	for key, element := range c.entries {
+		if matches(key) {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *certParseCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// parseCerts returns the certificates of the key of a secret or configmap read from the API or the
+// listers, parsed once per version of the object. Every parse of the certificates of the objects of
+// the definitions goes through it.
+func (cm *certManager) parseCerts(obj metav1.Object, key string) (*parsedCerts, error) {
+	return cm.parseCache.parseCerts(obj, key)
+}
+
+func (c *certParseCache) parseCerts(obj metav1.Object, key string) (*parsedCerts, error) {
+	var data []byte
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		data = o.Data[key]
+	case *corev1.ConfigMap:
+		data = []byte(o.Data[key])
+	default:
+		return nil, fmt.Errorf("no certificates in %T", obj)
+	}
+	parsed := c.get(obj, key, data)
+	return parsed, parsed.err
+}
@@ -0,0 +1,171 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate parse cache tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		lock   sync.Mutex
+		parses map[[sha256.Size]byte]int
+	)
+
+	// counts the parses by data
+	countParses := func(cache *certParseCache) {
+		parses = map[[sha256.Size]byte]int{}
+		cache.parse = func(pemData []byte) ([]*x509.Certificate, error) {
+			lock.Lock()
+			parses[sha256.Sum256(pemData)]++
+			lock.Unlock()
+			return crypto.CertsFromPEM(pemData)
+		}
+	}
+
+	totalParses := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		total := 0
+		for _, count := range parses {
+			total += count
+		}
+		return total
+	}
+
+	newSecret := func(uid types.UID, resourceVersion string) *corev1.Secret {
+		ca, err := certtest.NewCA("parsed", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		certPEM, _, err := ca.Config.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "parsed-" + string(uid), UID: uid, ResourceVersion: resourceVersion},
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM},
+		}
+	}
+
+	It("should parse each object version once across syncs", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		countParses(cm.parseCache)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, name := range []string{"maroonedpods-server", util.SecretResourceName} {
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, secret)
+		}
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		_, err := cm.ListManagedCertificates(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		parsed := totalParses()
+		Expect(parsed).ToNot(BeZero())
+
+		for i := 0; i < 3; i++ {
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			_, err := cm.ListManagedCertificates(context.TODO())
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(totalParses()).To(Equal(parsed))
+		for _, count := range parses {
+			Expect(count).To(Equal(1))
+		}
+	})
+
+	It("should parse a new version of an object and drop the older one", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		countParses(cm.parseCache)
+		secret := newSecret("uid", "1")
+
+		first, err := cm.parseCerts(secret, corev1.TLSCertKey)
+		Expect(err).ToNot(HaveOccurred())
+		again, err := cm.parseCerts(secret, corev1.TLSCertKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(first))
+		Expect(totalParses()).To(Equal(1))
+		Expect(first.serial).To(Equal(first.certs[0].SerialNumber.String()))
+		Expect(first.notAfter).To(Equal(first.certs[0].NotAfter))
+
+		secret.ResourceVersion = "2"
+		_, err = cm.parseCerts(secret, corev1.TLSCertKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(totalParses()).To(Equal(2))
+		Expect(cm.parseCache.len()).To(Equal(1))
+	})
+
+	It("should cache a parse error", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		countParses(cm.parseCache)
+		secret := newSecret("uid", "1")
+		secret.Data[corev1.TLSCertKey] = []byte("not a certificate")
+
+		for i := 0; i < 2; i++ {
+			_, err := cm.parseCerts(secret, corev1.TLSCertKey)
+			Expect(err).To(HaveOccurred())
+		}
+		Expect(totalParses()).To(Equal(1))
+	})
+
+	It("should be bounded", func() {
+		cache := newCertParseCache()
+		countParses(cache)
+		secret := newSecret("uid", "1")
+		for i := 0; i < maxParsedCerts+10; i++ {
+			secret.UID = types.UID(fmt.Sprintf("uid-%d", i))
+			Expect(cache.get(secret, corev1.TLSCertKey, secret.Data[corev1.TLSCertKey]).err).ToNot(HaveOccurred())
+		}
+		Expect(cache.len()).To(Equal(maxParsedCerts))
+
+		// the least recently used were evicted
+		secret.UID = "uid-0"
+		cache.get(secret, corev1.TLSCertKey, secret.Data[corev1.TLSCertKey])
+		Expect(totalParses()).To(Equal(maxParsedCerts + 11))
+	})
+
+	It("should forget the objects deleted from the informers", func() {
+		secret := newSecret("uid", "1")
+		client := fake.NewSimpleClientset(secret)
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		cached, err := cm.listers()[clusterNamespace{namespace: namespace}].secretLister.Secrets(namespace).Get(secret.Name)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cm.parseCerts(cached, corev1.TLSCertKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.parseCache.len()).To(Equal(1))
+
+		Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(cm.parseCache.len, 5*time.Second, 100*time.Millisecond).Should(BeZero())
+
+		// a missed deletion is forgotten with the tombstone
+		_, err = cm.parseCerts(secret, corev1.TLSCertKey)
+		Expect(err).ToNot(HaveOccurred())
+		cm.parseCache.forget(toolscache.DeletedFinalStateUnknown{Key: namespace + "/" + secret.Name, Obj: secret})
+		Expect(cm.parseCache.len()).To(BeZero())
+	})
+})
@@ -0,0 +1,99 @@
+package certmanager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annRotationPaused set to true on a managed secret freezes its certificate, e.g. during a maintenance
+	// window. The secret is not written until it is removed, a paused signer also freezes its target.
+	annRotationPaused = "operator.maroonedpods.io/rotation-paused"
+
+	// pausedWarningInterval is how often the warnings about a paused certificate are repeated
+	pausedWarningInterval = time.Hour
+	// pausedExpiringThreshold is the remaining fraction of its lifetime a paused certificate is warned
+	// about as expiring
+	pausedExpiringThreshold = 0.1
+)
+
+func isRotationPaused(secret *corev1.Secret) bool {
+	return secret != nil && secret.Annotations[annRotationPaused] == "true"
+}
+
+// secretPaused reports whether the managed secret of the template is paused
+func (cm *certManager) secretPaused(template *corev1.Secret) bool {
+	listers, ok := cm.listers()[clusterNamespace{namespace: template.Namespace}]
+	if !ok {
+		return false
+	}
+	secret, err := listers.secretLister.Secrets(template.Namespace).Get(template.Name)
+	return err == nil && isRotationPaused(secret)
+}
+
+// signerPaused reports whether the signer secret of the definition is paused
+func (cm *certManager) signerPaused(cd mpcerts.CertificateDefinition) bool {
+	return cd.SignerSecret != nil && cm.secretPaused(cd.SignerSecret)
+}
+
+// chainPaused reports whether the signer or the target of the definition is paused
+func (cm *certManager) chainPaused(cd mpcerts.CertificateDefinition) bool {
+	return cm.signerPaused(cd) || (cd.TargetSecret != nil && cm.secretPaused(cd.TargetSecret))
+}
+
+// pausedSigner returns the CA of the paused signer secret as it is
+func (cm *certManager) pausedSigner(cd mpcerts.CertificateDefinition, secret *corev1.Secret) (*crypto.CA, error) {
+	cm.warnPausedRotation(secret, cd.SignerConfig)
+	stored, err := cm.withStoredKeyPair(signerRef(cd), secret)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := crypto.GetCAFromBytes(stored.Data[corev1.TLSCertKey], stored.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("the rotation of signer secret %s/%s is paused and its CA can't be used: %w", secret.Namespace, secret.Name, err)
+	}
+	return ca, nil
+}
+
+// warnPausedRotation warns that the paused certificate would have been rotated, urgently if it is about
+// to expire. Each warning is repeated every pausedWarningInterval while it applies.
+func (cm *certManager) warnPausedRotation(secret *corev1.Secret, config mpcerts.CertificateConfig) {
+	key := secret.Namespace + "/" + secret.Name
+	notBefore, notAfter, ok := cm.certValidity(secret)
+	remaining, inRefreshWindow := remainingValidity(config, notBefore, notAfter, ok)
+	log.V(1).Info("The rotation of the certificate is paused", "secret", key, "dueForRotation", inRefreshWindow)
+	if !inRefreshWindow {
+		delete(cm.pausedWarnings, key)
+		return
+	}
+
+	reason := "CertRotationPaused"
+	if remaining <= pausedExpiringThreshold {
+		reason = "CertRotationPausedExpiring"
+	}
+	now := cm.clock.Now()
+	if last, ok := cm.pausedWarnings[key]; ok && last.reason == reason && now.Sub(last.time) < pausedWarningInterval {
+		return
+	}
+	if cm.pausedWarnings == nil {
+		cm.pausedWarnings = make(map[string]pausedWarning)
+	}
+	cm.pausedWarnings[key] = pausedWarning{reason: reason, time: now}
+
+	if reason == "CertRotationPausedExpiring" {
+		cm.eventRecorder.Warningf(reason, "The certificate of %s expires at %s but its rotation is paused by %s", key, notAfter.UTC().Format(time.RFC3339), annRotationPaused)
+		return
+	}
+	cm.eventRecorder.Warningf(reason, "The certificate of %s is due for rotation but its rotation is paused by %s", key, annRotationPaused)
+}
+
+// pausedWarning is the last warning about a paused certificate
+type pausedWarning struct {
+	reason string
+	time   time.Time
+}
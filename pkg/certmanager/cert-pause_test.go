@@ -0,0 +1,185 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("paused rotation tests", func() {
+	const (
+		namespace = "maroonedpods"
+		signer    = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	// certificates with a new config, the sync would re-issue them
+	changedCerts := func() []cert.CertificateDefinition {
+		certs := newCerts()
+		certs[0].SignerConfig.Lifetime += time.Hour
+		certs[0].TargetConfig.Lifetime += time.Hour
+		return certs
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	updateSecret := func(secret *corev1.Secret) {
+		secret, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+	}
+
+	setPaused := func(name string, paused bool) {
+		secret := getSecret(name)
+		if paused {
+			secret.Annotations[annRotationPaused] = "true"
+		} else {
+			delete(secret.Annotations, annRotationPaused)
+		}
+		updateSecret(secret)
+	}
+
+	secretWrites := func(name string) []string {
+		var result []string
+		for _, action := range client.Actions() {
+			if action.GetResource().Resource != "secrets" {
+				continue
+			}
+			switch a := action.(type) {
+			case testingclient.UpdateAction:
+				if a.GetObject().(*corev1.Secret).Name == name {
+					result = append(result, action.GetVerb())
+				}
+			case testingclient.PatchAction:
+				if a.GetName() == name {
+					result = append(result, action.GetVerb())
+				}
+			case testingclient.DeleteAction:
+				if a.GetName() == name {
+					result = append(result, action.GetVerb())
+				}
+			}
+		}
+		return result
+	}
+
+	events := func(reason string) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == reason {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	// sets the validity annotations of the target as if it was issued at notBefore
+	setValidity := func(notBefore, notAfter time.Time) {
+		secret, err := certtest.SetValidity(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: util.SecretResourceName}, notBefore, notAfter)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should not write a paused target and rotate it once unpaused", func() {
+		notBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		setPaused(util.SecretResourceName, true)
+
+		// certificates issued within the same second have the same NotBefore
+		time.Sleep(time.Second)
+		client.ClearActions()
+		Expect(cm.Sync(context.TODO(), changedCerts())).To(Succeed())
+		Expect(secretWrites(util.SecretResourceName)).To(BeEmpty())
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(notBefore))
+
+		setPaused(util.SecretResourceName, false)
+		Expect(cm.Sync(context.TODO(), changedCerts())).To(Succeed())
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).ToNot(Equal(notBefore))
+	})
+
+	It("should freeze the target with a paused signer", func() {
+		signerNotBefore := getCertNotBefore(client, namespace, signer)
+		targetNotBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		setPaused(signer, true)
+
+		time.Sleep(time.Second)
+		client.ClearActions()
+		Expect(cm.Sync(context.TODO(), changedCerts())).To(Succeed())
+		Expect(secretWrites(signer)).To(BeEmpty())
+		Expect(secretWrites(util.SecretResourceName)).To(BeEmpty())
+		Expect(getCertNotBefore(client, namespace, signer)).To(Equal(signerNotBefore))
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(targetNotBefore))
+		checkCerts(client, namespace, true)
+	})
+
+	It("should skip the forced rotation of a paused certificate", func() {
+		setPaused(util.SecretResourceName, true)
+		client.ClearActions()
+		Expect(cm.ForceRotate(newCerts()[0])).To(Succeed())
+		Expect(secretWrites(util.SecretResourceName)).To(BeEmpty())
+		Expect(cm.forcedRotations).To(BeEmpty())
+	})
+
+	It("should warn about a paused certificate due for rotation", func() {
+		setPaused(util.SecretResourceName, true)
+		now := time.Now()
+
+		setValidity(now.Add(-16*time.Hour), now.Add(8*time.Hour))
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(events("CertRotationPaused")).To(Equal(1))
+		Expect(events("CertRotationPausedExpiring")).To(BeZero())
+		// repeated every pausedWarningInterval only
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(events("CertRotationPaused")).To(Equal(1))
+
+		setValidity(now.Add(-23*time.Hour), now.Add(time.Hour))
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(events("CertRotationPausedExpiring")).To(Equal(1))
+	})
+
+	It("should not warn about a paused certificate that isn't due", func() {
+		setPaused(util.SecretResourceName, true)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(events("CertRotationPaused")).To(BeZero())
+		Expect(events("CertRotationPausedExpiring")).To(BeZero())
+	})
+})
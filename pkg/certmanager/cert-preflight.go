@@ -0,0 +1,199 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// preflightInterval is how often the permissions of a namespace that passed are checked again
+	preflightInterval = 10 * time.Minute
+	// preflightRetryInterval is how often the permissions of a namespace that failed, or couldn't be
+	// checked, are checked again, so fixing the RBAC heals without a restart
+	preflightRetryInterval = 30 * time.Second
+)
+
+// ErrPreflightFailed is wrapped by PreflightError
+var ErrPreflightFailed = goerrors.New("missing permissions")
+
+// preflightChecks are the verbs on the resources the sync needs in every managed namespace
+var preflightChecks = []struct {
+	verb     string
+	resource string
+}{
+	{"get", "secrets"},
+	{"create", "secrets"},
+	{"update", "secrets"},
+	{"get", "configmaps"},
+	{"create", "configmaps"},
+	{"update", "configmaps"},
+	{"create", "events"},
+}
+
+// PreflightError is returned for a definition with objects in namespaces the operator lacks permissions
+// in, it is skipped until they are granted
+type PreflightError struct {
+	Definition string
+	// Missing are the denied "verb resource" by namespace, prefixed with the cluster for the guest cluster
+	Missing map[string][]string
+}
+
+func (e *PreflightError) Error() string {
+	namespaces := make([]string, 0, len(e.Missing))
+	for namespace := range e.Missing {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	problems := make([]string, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		problems = append(problems, fmt.Sprintf("cannot %s in namespace %s", strings.Join(e.Missing[namespace], ", "), namespace))
+	}
+	return fmt.Sprintf("certificate definition %s is skipped, %s: %s", e.Definition, ErrPreflightFailed, strings.Join(problems, "; "))
+}
+
+func (e *PreflightError) Unwrap() error {
+	return ErrPreflightFailed
+}
+
+// preflightResult is the outcome of the last check of the permissions of a namespace
+type preflightResult struct {
+	checked time.Time
+	// denied "verb resource", empty if everything is allowed
+	missing []string
+	// why the permissions couldn't be checked, the namespace isn't skipped meanwhile
+	err error
+}
+
+func (r preflightResult) due(now time.Time) bool {
+	interval := preflightInterval
+	if len(r.missing) > 0 || r.err != nil {
+		interval = preflightRetryInterval
+	}
+	return now.Sub(r.checked) >= interval
+}
+
+// preflightName names the namespace in the errors, with its cluster for the guest cluster
+func preflightName(key clusterNamespace) string {
+	if key.cluster == mpcerts.ManagementCluster {
+		return key.namespace
+	}
+	return string(key.cluster) + "/" + key.namespace
+}
+
+// preflightNamespacesOf returns the namespaces of the objects of the definition in every cluster
+func preflightNamespacesOf(cd mpcerts.CertificateDefinition) []clusterNamespace {
+	var keys []clusterNamespace
+	for _, ns := range namespacesOf(cd) {
+		keys = append(keys, clusterNamespace{namespace: ns})
+	}
+	if cd.CertBundleConfigmap != nil && cd.BundleCluster != mpcerts.ManagementCluster {
+		keys = append(keys, clusterNamespace{cluster: cd.BundleCluster, namespace: cd.CertBundleConfigmap.Namespace})
+	}
+	return keys
+}
+
+// refreshPreflight checks the permissions of the managed namespaces and of the namespaces of the
+// definitions that were never checked or are due for another check
+func (cm *certManager) refreshPreflight(certs []mpcerts.CertificateDefinition) {
+	keys := cm.clusterNamespaces()
+	for _, cd := range certs {
+		keys = append(keys, preflightNamespacesOf(cd)...)
+	}
+
+	now := cm.clock.Now()
+	for _, key := range keys {
+		cm.preflightLock.Lock()
+		result, ok := cm.preflight[key]
+		cm.preflightLock.Unlock()
+		if ok && !result.due(now) {
+			continue
+		}
+
+		result = cm.runPreflight(key)
+		result.checked = now
+		cm.preflightLock.Lock()
+		if cm.preflight == nil {
+			cm.preflight = map[clusterNamespace]preflightResult{}
+		}
+		cm.preflight[key] = result
+		cm.preflightLock.Unlock()
+	}
+}
+
+// runPreflight asks the API server whether the operator may use the preflightChecks in the namespace
+func (cm *certManager) runPreflight(key clusterNamespace) preflightResult {
+	reviews := cm.kubeClient(key.cluster).AuthorizationV1().SelfSubjectAccessReviews()
+	var result preflightResult
+	for _, check := range preflightChecks {
+		review, err := reviews.Create(context.TODO(), &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: key.namespace,
+					Verb:      check.verb,
+					Resource:  check.resource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			log.Error(err, "Failed to check the permissions of the namespace", "namespace", preflightName(key))
+			return preflightResult{err: err}
+		}
+		if !review.Status.Allowed {
+			result.missing = append(result.missing, check.verb+" "+check.resource)
+		}
+	}
+	if len(result.missing) > 0 {
+		log.Info("The operator lacks permissions in the namespace, its certificates are skipped", "namespace", preflightName(key), "missing", result.missing)
+	}
+	return result
+}
+
+// checkPreflight returns a PreflightError for a definition with objects in namespaces that failed the
+// last preflight
+func (cm *certManager) checkPreflight(cd mpcerts.CertificateDefinition) error {
+	cm.preflightLock.Lock()
+	defer cm.preflightLock.Unlock()
+	missing := map[string][]string{}
+	for _, key := range preflightNamespacesOf(cd) {
+		if result := cm.preflight[key]; len(result.missing) > 0 {
+			missing[preflightName(key)] = result.missing
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &PreflightError{Definition: cd.Name(), Missing: missing}
+}
+
+// missingPermissions returns the denied "verb resource" by preflightName of the namespaces, nil if none
+func (cm *certManager) missingPermissions() map[string][]string {
+	cm.preflightLock.Lock()
+	defer cm.preflightLock.Unlock()
+	var missing map[string][]string
+	for key, result := range cm.preflight {
+		if len(result.missing) == 0 {
+			continue
+		}
+		if missing == nil {
+			missing = map[string][]string{}
+		}
+		missing[preflightName(key)] = result.missing
+	}
+	return missing
+}
+
+// resetPreflight forgets the results, the namespaces are checked again
+func (cm *certManager) resetPreflight() {
+	cm.preflightLock.Lock()
+	defer cm.preflightLock.Unlock()
+	cm.preflight = nil
+}
@@ -0,0 +1,172 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// addAccessReviewReactor answers the SelfSubjectAccessReviews of a fake clientset with allowed, the
+// fake would deny them all
+func addAccessReviewReactor(client interface{}, allowed func(attributes *authorizationv1.ResourceAttributes) (bool, error)) {
+	f, ok := client.(fakeClientset)
+	if !ok {
+		return
+	}
+	f.PrependReactor("create", "selfsubjectaccessreviews", func(action testingclient.Action) (bool, runtime.Object, error) {
+		review := action.(testingclient.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		allow, err := allowed(review.Spec.ResourceAttributes)
+		if err != nil {
+			return true, nil, err
+		}
+		review.Status.Allowed = allow
+		return true, review, nil
+	})
+}
+
+// allowAccessReviews allows everything the cert manager checks before syncing
+func allowAccessReviews(client interface{}) {
+	addAccessReviewReactor(client, func(*authorizationv1.ResourceAttributes) (bool, error) {
+		return true, nil
+	})
+}
+
+var _ = Describe("RBAC preflight", func() {
+	const (
+		namespace = "maroonedpods"
+		workloads = "workloads"
+		target    = "workload-cert"
+	)
+
+	var (
+		client    *fake.Clientset
+		cm        *certManager
+		clock     *clocktesting.FakeClock
+		cancel    context.CancelFunc
+		denied    map[string]sets.String
+		reviewErr error
+	)
+
+	// the server certificate and a client certificate of the same signer in the workloads namespace
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		workload := certs[0]
+		workload.TargetSecret = certs[0].TargetSecret.DeepCopy()
+		workload.TargetSecret.Namespace = workloads
+		workload.TargetSecret.Name = target
+		workload.TargetService = nil
+		workload.TargetUser = &[]string{"workload"}[0]
+		workload.ExtendedKeyUsages = cert.ExtendedKeyUsagesClient
+		workload.RolloutDeployments = nil
+		return append(certs, workload)
+	}
+
+	targetExists := func() bool {
+		_, err := client.CoreV1().Secrets(workloads).Get(context.TODO(), target, metav1.GetOptions{})
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		denied = map[string]sets.String{}
+		reviewErr = nil
+		client = fake.NewSimpleClientset()
+		addApplyReactor(client)
+		addAccessReviewReactor(client, func(attributes *authorizationv1.ResourceAttributes) (bool, error) {
+			if reviewErr != nil {
+				return false, reviewErr
+			}
+			return !denied[attributes.Namespace].Has(attributes.Verb + " " + attributes.Resource), nil
+		})
+		cm = newCertManager(client, nil, namespace, workloads)
+		cm.extClient = extfake.NewSimpleClientset()
+		cm.client = crfake.NewClientBuilder().Build()
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+	})
+
+	JustBeforeEach(func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	Context("with missing permissions in a namespace", func() {
+		BeforeEach(func() {
+			denied[workloads] = sets.NewString("update secrets", "create events")
+		})
+
+		It("should skip the definitions of the namespace and name the missing permissions", func() {
+			err := cm.Sync(context.TODO(), newCerts())
+			Expect(err).To(MatchError(ErrPreflightFailed))
+			Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("cannot update secrets, create events in namespace %s", workloads)))
+			Expect(err.Error()).To(ContainSubstring(workloads + "/" + target))
+
+			var preflightErr *PreflightError
+			Expect(errors.As(cm.checkPreflight(newCerts()[1]), &preflightErr)).To(BeTrue())
+			Expect(preflightErr.Missing).To(Equal(map[string][]string{workloads: {"update secrets", "create events"}}))
+
+			// the definitions of the other namespaces are synced
+			_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targetExists()).To(BeFalse())
+			Expect(cm.SyncStatus().MissingPermissions).To(Equal(map[string][]string{workloads: {"update secrets", "create events"}}))
+		})
+
+		It("should heal once the permissions are granted", func() {
+			Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ErrPreflightFailed))
+
+			delete(denied, workloads)
+			// not checked again before the retry interval
+			Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ErrPreflightFailed))
+
+			clock.Step(preflightRetryInterval)
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+			Expect(targetExists()).To(BeTrue())
+			Expect(cm.SyncStatus().MissingPermissions).To(BeEmpty())
+		})
+	})
+
+	It("should check the namespaces again when permissions are revoked", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		denied[namespace] = sets.NewString("create configmaps")
+		clock.Step(preflightInterval - time.Second)
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		clock.Step(time.Second)
+		err := cm.Sync(context.TODO(), newCerts())
+		Expect(err).To(MatchError(ErrPreflightFailed))
+		Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("cannot create configmaps in namespace %s", namespace)))
+	})
+
+	Context("when the permissions can't be checked", func() {
+		BeforeEach(func() {
+			reviewErr = errors.New("the API server is unavailable")
+		})
+
+		It("should not skip the definitions", func() {
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+			Expect(targetExists()).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,186 @@
+package certmanager
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// labelPreserved marks the certificates kept by the uninstall of a previous installation,
+	// the next install adopts them
+	labelPreserved = "operator.maroonedpods.io/preserved"
+)
+
+// Preserve keeps the certificates managed by the operator on uninstall: they lose the owner references
+// to the CR, so the garbage collector leaves them alone, and are labeled as preserved
+func (cm *certManager) Preserve() error {
+	var errs []error
+	for _, cn := range cm.clusterNamespaces() {
+		client := cm.kubeClient(cn.cluster).CoreV1()
+		objects, err := cm.listManagedCertObjects(cn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i := range objects.configMaps {
+			configMap := objects.configMaps[i].DeepCopy()
+			if !markPreserved(configMap) {
+				continue
+			}
+			log.Info("Preserving CA bundle", "configmap", configMap.Name, "namespace", configMap.Namespace)
+			if _, err := client.ConfigMaps(cn.namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil && !isGoneError(err) {
+				errs = append(errs, err)
+			}
+		}
+		for i := range objects.secrets {
+			secret := objects.secrets[i].DeepCopy()
+			if !markPreserved(secret) {
+				continue
+			}
+			log.Info("Preserving certificate secret", "secret", secret.Name, "namespace", secret.Namespace)
+			if _, err := client.Secrets(cn.namespace).Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil && !isGoneError(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// markPreserved labels the object as preserved and drops its owner references to the CR,
+// it returns whether the object changed
+func markPreserved(obj metav1.Object) bool {
+	changed := false
+
+	var ownerRefs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Kind == "MaroonedPods" {
+			changed = true
+			continue
+		}
+		ownerRefs = append(ownerRefs, ref)
+	}
+	obj.SetOwnerReferences(ownerRefs)
+
+	if _, ok := obj.GetLabels()[labelPreserved]; !ok {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[labelPreserved] = ""
+		obj.SetLabels(labels)
+		changed = true
+	}
+
+	return changed
+}
+
+func isPreserved(obj metav1.Object) bool {
+	_, ok := obj.GetLabels()[labelPreserved]
+	return ok
+}
+
+// adoptPreservedSecret takes over a secret preserved by a previous installation, the certificate is
+// kept even if the cert config changed, it is refreshed once it is due under the new one. It returns
+// whether the secret was adopted.
+func adoptPreservedSecret(secret *corev1.Secret, configString string) bool {
+	if !isPreserved(secret) {
+		return false
+	}
+	delete(secret.Labels, labelPreserved)
+	secret.Annotations[annCertConfig] = configString
+	return true
+}
+
+// adoptPreservedBundle takes over a CA bundle preserved by a previous installation, so the CAs
+// trusted by the clients of the previous installation are kept
+func (cm *certManager) adoptPreservedBundle(cluster mpcerts.Cluster, namespace, name string) error {
+	configMap, err := cm.listers()[clusterNamespace{cluster: cluster, namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(name)
+	if err != nil || !isPreserved(configMap) {
+		return nil
+	}
+
+	// the lister copy can be older than the update of library-go
+	configMap, err = cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !isPreserved(configMap) {
+		return nil
+	}
+	updated := configMap.DeepCopy()
+	delete(updated.Labels, labelPreserved)
+	if _, err := cm.applyConfigMap(cluster, configMap, updated); err != nil {
+		return err
+	}
+	cm.adopted++
+	return nil
+}
+
+// PruneOrphans deletes the preserved certificates of a previous installation none of the definitions
+// adopted, unless the current installation is asked to preserve the certificates as well
+func (cm *certManager) PruneOrphans(certs []mpcerts.CertificateDefinition, preserve bool) error {
+	desired := map[types.NamespacedName]bool{}
+	for _, cd := range certs {
+		for _, obj := range []metav1.Object{cd.SignerSecret, cd.TargetSecret, cd.SplitKeySecret, cd.CertBundleConfigmap} {
+			if obj != nil && !isNilObject(obj) {
+				desired[types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}] = true
+			}
+		}
+	}
+
+	var errs []error
+	for _, cn := range cm.clusterNamespaces() {
+		objects, err := cm.listManagedCertObjects(cn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for i := range objects.configMaps {
+			configMap := &objects.configMaps[i]
+			if !isOrphan(configMap, desired, preserve) {
+				continue
+			}
+			if err := cm.deleteBundle(cn.cluster, configMap); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		for i := range objects.secrets {
+			secret := &objects.secrets[i]
+			if !isOrphan(secret, desired, preserve) {
+				continue
+			}
+			if err := cm.deleteCertSecret(cn.cluster, secret); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func isOrphan(obj metav1.Object, desired map[types.NamespacedName]bool, preserve bool) bool {
+	if !isPreserved(obj) || desired[types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}] {
+		return false
+	}
+	if preserve {
+		log.V(1).Info("Keeping preserved certificate object", "name", obj.GetName(), "namespace", obj.GetNamespace())
+		return false
+	}
+	return true
+}
+
+// isNilObject catches the typed nil pointers of the definition
+func isNilObject(obj metav1.Object) bool {
+	switch o := obj.(type) {
+	case *corev1.Secret:
+		return o == nil
+	case *corev1.ConfigMap:
+		return o == nil
+	}
+	return false
+}
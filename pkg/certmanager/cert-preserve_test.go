@@ -0,0 +1,184 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("certificate preservation tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+		bundleName = "maroonedpods-server-signer-bundle"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	start := func() {
+		cm = newCertManagerForTest(client, namespace)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	}
+
+	// what the uninstall leaves behind, the next install starts with fresh informers
+	reinstall := func() {
+		Expect(cm.Preserve()).To(Succeed())
+		cancel()
+		start()
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	getBundle := func() *corev1.ConfigMap {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), bundleName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return configMap
+	}
+
+	adoptionEvents := func() []string {
+		var messages []string
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if event := create.GetObject().(*corev1.Event); event.Reason == "CertificatesAdopted" {
+					messages = append(messages, event.Message)
+				}
+			}
+		}
+		return messages
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		start()
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should label the certificates and drop their owner references to the CR", func() {
+		// the way the operator sdk creates them
+		signer := getSecret(signerName)
+		signer.OwnerReferences = []metav1.OwnerReference{{APIVersion: "maroonedpods.io/v1alpha1", Kind: "MaroonedPods", Name: "maroonedpods", UID: "1234"}}
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), signer, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cm.Preserve()).To(Succeed())
+
+		for _, name := range []string{signerName, util.SecretResourceName} {
+			secret := getSecret(name)
+			Expect(secret.Labels).To(HaveKey(labelPreserved))
+			Expect(secret.OwnerReferences).To(BeEmpty())
+		}
+		Expect(getBundle().Labels).To(HaveKey(labelPreserved))
+	})
+
+	It("should adopt the preserved certificates on reinstall without issuing a new CA", func() {
+		signer := getSecret(signerName)
+		target := getSecret(util.SecretResourceName)
+		bundle := getBundle()
+		reinstall()
+		client.ClearActions()
+
+		// a different config than the previous installation
+		lifetime, renewBefore := 26*time.Hour, 13*time.Hour
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{
+			Namespace:         namespace,
+			TargetDuration:    &lifetime,
+			TargetRenewBefore: &renewBefore,
+		}))).To(Succeed())
+
+		for _, before := range []*corev1.Secret{signer, target} {
+			after := getSecret(before.Name)
+			Expect(after.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+			Expect(after.Labels).ToNot(HaveKey(labelPreserved))
+		}
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(toSerializedCertConfig(26*time.Hour, 13*time.Hour)))
+		Expect(getBundle().Labels).ToNot(HaveKey(labelPreserved))
+		Expect(getBundle().Data[selfManagedBundleKey]).To(Equal(bundle.Data[selfManagedBundleKey]))
+		Expect(adoptionEvents()).To(ConsistOf(ContainSubstring("Adopted 3 certificate secrets")))
+	})
+
+	Context("orphans", func() {
+		const retiredName = "maroonedpods-retired"
+
+		exists := func(name string) bool {
+			_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return false
+			}
+			Expect(err).ToNot(HaveOccurred())
+			return true
+		}
+
+		BeforeEach(func() {
+			// preserved by a previous installation for a certificate the current one doesn't issue anymore
+			retired := getSecret(signerName).DeepCopy()
+			retired.ObjectMeta = metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        retiredName,
+				Labels:      retired.Labels,
+				Annotations: retired.Annotations,
+			}
+			_, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), retired, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			// labeled like the certificates but never managed by the operator
+			_, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: namespace,
+					Name:      "other",
+					Labels:    util.ResourceBuilder.WithCommonLabels(map[string]string{labelPreserved: ""}),
+				},
+			}, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			reinstall()
+			Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		})
+
+		It("should keep the preserved certificates nobody adopted while preserving", func() {
+			Expect(cm.PruneOrphans(newCerts(), true)).To(Succeed())
+
+			Expect(exists(retiredName)).To(BeTrue())
+			Expect(getSecret(retiredName).Labels).To(HaveKey(labelPreserved))
+		})
+
+		It("should prune the preserved certificates nobody adopted once not preserving anymore", func() {
+			Expect(cm.PruneOrphans(newCerts(), true)).To(Succeed())
+			Expect(cm.PruneOrphans(newCerts(), false)).To(Succeed())
+
+			Expect(exists(retiredName)).To(BeFalse())
+			Expect(exists(signerName)).To(BeTrue())
+			Expect(exists(util.SecretResourceName)).To(BeTrue())
+			Expect(exists("other")).To(BeTrue())
+			_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), bundleName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,165 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// annProxyCAs records the fingerprints of the certificates of the trust bundle merged from the source
+// of the proxy CAs, they are not CAs of the operator
+const annProxyCAs = "operator.maroonedpods.io/proxyCAs"
+
+// syncTrustBundle writes the trust bundle of a definition with a TrustBundle: the CA bundle, then the
+// CAs of the proxy without duplicates. The proxy CAs are recorded, so the CAs of the operator are
+// rebuilt from the bundle as it is pruned while the proxy ones follow their source only. Without a
+// TrustBundle the trust bundle and the source the operator created are removed.
+func (cm *certManager) syncTrustBundle(cd mpcerts.CertificateDefinition, bundle []*x509.Certificate) error {
+	namespace := cd.CertBundleConfigmap.Namespace
+	listers, err := cm.listersFor(clusterNamespace{cluster: cd.BundleCluster, namespace: namespace})
+	if err != nil {
+		return err
+	}
+	trust := cd.TrustBundle
+	if trust == nil {
+		return cm.removeTrustBundle(cd.BundleCluster, namespace, listers, mpcerts.TrustBundleConfigMapName, mpcerts.ProxyTrustedCAConfigMapName)
+	}
+
+	if trust.InjectSource {
+		if err := cm.ensureInjectedSource(cd.BundleCluster, namespace, trust.Source, listers); err != nil {
+			return err
+		}
+	} else if err := cm.removeTrustBundle(cd.BundleCluster, namespace, listers, mpcerts.ProxyTrustedCAConfigMapName); err != nil {
+		return err
+	}
+
+	var proxyCAs []*x509.Certificate
+	source, err := listers.configMapLister.ConfigMaps(namespace).Get(trust.Source)
+	switch {
+	case errors.IsNotFound(err):
+		log.Info("No proxy CAs to merge into the trust bundle", "configmap", trust.Source, "namespace", namespace)
+	case err != nil:
+		return err
+	case source.Data[selfManagedBundleKey] != "":
+		parsed, err := cm.parseCerts(source, selfManagedBundleKey)
+		if err != nil {
+			log.Info("Ignoring the unparsable proxy CAs", "configmap", trust.Source, "namespace", namespace, "error", err.Error())
+		} else {
+			proxyCAs = parsed.certs
+		}
+	}
+
+	merged := append([]*x509.Certificate(nil), bundle...)
+	var fingerprints []string
+	for _, cert := range proxyCAs {
+		// a CA of the operator is not the proxy's to track
+		if containsCert(merged, cert) {
+			continue
+		}
+		merged = append(merged, cert)
+		fingerprints = append(fingerprints, certFingerprint(cert))
+	}
+	caBundle, err := crypto.EncodeCertificates(merged...)
+	if err != nil {
+		return err
+	}
+
+	desired := trust.ConfigMap.DeepCopy()
+	desired.Data = map[string]string{selfManagedBundleKey: string(caBundle)}
+	if len(fingerprints) > 0 {
+		annotation, err := json.Marshal(fingerprints)
+		if err != nil {
+			return err
+		}
+		desired.Annotations = map[string]string{annProxyCAs: string(annotation)}
+	}
+
+	configMaps := cm.kubeClient(cd.BundleCluster).CoreV1().ConfigMaps(namespace)
+	current, err := configMaps.Get(context.TODO(), desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), desired, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	updated := current.DeepCopy()
+	updated.Data = desired.Data
+	for key, value := range desired.Labels {
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		updated.Labels[key] = value
+	}
+	delete(updated.Annotations, annProxyCAs)
+	if value, ok := desired.Annotations[annProxyCAs]; ok {
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annProxyCAs] = value
+	}
+	if !configMapChanged(current, updated) {
+		return nil
+	}
+	if _, err := configMaps.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	log.Info("Updated the trust bundle", "configmap", desired.Name, "namespace", namespace, "proxyCAs", len(fingerprints))
+	return nil
+}
+
+// ensureInjectedSource creates the configmap OpenShift injects the trusted CA bundle into, the
+// injection owns its data
+func (cm *certManager) ensureInjectedSource(cluster mpcerts.Cluster, namespace, name string, listers *certListers) error {
+	if _, err := listers.configMapLister.ConfigMaps(namespace).Get(name); !errors.IsNotFound(err) {
+		return err
+	}
+	labels := util.ResourceBuilder.WithCommonLabels(nil)
+	labels[mpcerts.InjectTrustedCABundleLabel] = "true"
+	_, err := cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Create(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+	}, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// removeTrustBundle deletes the configmaps the operator created for a trust bundle, a configmap of
+// the same name it doesn't manage is left alone
+func (cm *certManager) removeTrustBundle(cluster mpcerts.Cluster, namespace string, listers *certListers, names ...string) error {
+	managed := util.ResourceBuilder.WithCommonLabels(nil)
+	for _, name := range names {
+		cached, err := listers.configMapLister.ConfigMaps(namespace).Get(name)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		owned := true
+		for key, value := range managed {
+			if cached.Labels[key] != value {
+				owned = false
+			}
+		}
+		if !owned {
+			continue
+		}
+		err = cm.kubeClient(cluster).CoreV1().ConfigMaps(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		log.Info("Removed the trust bundle configmap", "configmap", name, "namespace", namespace)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("proxy trust bundle tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		sourceName = "proxy-ca"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(proxyTrust *cert.ProxyTrust) []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace, ProxyTrust: proxyTrust})
+	}
+
+	newProxyCA := func(name string) *x509.Certificate {
+		ca, err := certtest.NewCA(name, time.Now(), time.Now().Add(24*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		return ca.Config.Certs[0]
+	}
+
+	waitForConfigMap := func(name string, data map[string]string) {
+		Eventually(func() map[string]string {
+			cached, _ := cm.listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(name)
+			if cached == nil {
+				return nil
+			}
+			return cached.Data
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(data))
+	}
+
+	writeSource := func(name string, certs ...*x509.Certificate) {
+		pem, err := crypto.EncodeCertificates(certs...)
+		Expect(err).ToNot(HaveOccurred())
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{selfManagedBundleKey: string(pem)},
+		}
+		_, err = client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		} else {
+			configMap, err = client.CoreV1().ConfigMaps(namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+		}
+		Expect(err).ToNot(HaveOccurred())
+		waitForConfigMap(name, configMap.Data)
+	}
+
+	getTrustBundle := func() (*corev1.ConfigMap, []*x509.Certificate) {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cert.TrustBundleConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))
+		Expect(err).ToNot(HaveOccurred())
+		return configMap, certs
+	}
+
+	getBundle := func() []*x509.Certificate {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))
+		Expect(err).ToNot(HaveOccurred())
+		return certs
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		// the source is written before the first sync starts the configmap informer
+		Expect(cm.startConfigMapLister(newCerts(nil)[0])).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should merge the proxy CAs after the CA bundle and leave the bundle alone", func() {
+		proxyCA := newProxyCA("proxy")
+		writeSource(sourceName, proxyCA)
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		bundle := getBundle()
+		Expect(bundle).To(HaveLen(1))
+		configMap, trusted := getTrustBundle()
+		Expect(trusted).To(HaveLen(2))
+		Expect(trusted[0].Equal(bundle[0])).To(BeTrue())
+		Expect(trusted[1].Equal(proxyCA)).To(BeTrue())
+		Expect(configMap.Annotations[annProxyCAs]).To(ContainSubstring(certFingerprint(proxyCA)))
+		Expect(configMap.Labels).To(Equal(util.ResourceBuilder.WithCommonLabels(nil)))
+	})
+
+	It("should follow the updates of the source", func() {
+		writeSource(sourceName, newProxyCA("proxy-1"))
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		rotated := newProxyCA("proxy-2")
+		writeSource(sourceName, rotated)
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		configMap, trusted := getTrustBundle()
+		Expect(trusted).To(HaveLen(2))
+		Expect(trusted[1].Equal(rotated)).To(BeTrue())
+		Expect(configMap.Annotations[annProxyCAs]).To(Equal(`["` + certFingerprint(rotated) + `"]`))
+	})
+
+	It("should keep the CAs of the operator when the source is removed", func() {
+		writeSource(sourceName, newProxyCA("proxy"))
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		Expect(client.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), sourceName, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool {
+			_, err := cm.listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(sourceName)
+			return errors.IsNotFound(err)
+		}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		configMap, trusted := getTrustBundle()
+		bundle := getBundle()
+		Expect(trusted).To(HaveLen(len(bundle)))
+		Expect(trusted[0].Equal(bundle[0])).To(BeTrue())
+		Expect(configMap.Annotations).ToNot(HaveKey(annProxyCAs))
+	})
+
+	It("should not track a proxy CA the bundle already has", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(nil))).To(Succeed())
+		writeSource(sourceName, getBundle()[0])
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{ConfigMapName: sourceName}))).To(Succeed())
+
+		configMap, trusted := getTrustBundle()
+		Expect(trusted).To(HaveLen(1))
+		Expect(configMap.Annotations).ToNot(HaveKey(annProxyCAs))
+	})
+
+	It("should create the source for the OpenShift injection", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{}))).To(Succeed())
+
+		source, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cert.ProxyTrustedCAConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(source.Labels).To(HaveKeyWithValue(cert.InjectTrustedCABundleLabel, "true"))
+		_, trusted := getTrustBundle()
+		Expect(trusted).To(HaveLen(1))
+
+		// as the network operator does
+		proxyCA := newProxyCA("injected")
+		writeSource(cert.ProxyTrustedCAConfigMapName, proxyCA)
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{}))).To(Succeed())
+		_, trusted = getTrustBundle()
+		Expect(trusted).To(HaveLen(2))
+		Expect(trusted[1].Equal(proxyCA)).To(BeTrue())
+	})
+
+	It("should remove the trust bundle and the created source without a proxy trust", func() {
+		writeSource(sourceName, newProxyCA("proxy"))
+		Expect(cm.Sync(context.TODO(), newCerts(&cert.ProxyTrust{}))).To(Succeed())
+		// the removal reads the listers
+		for _, name := range []string{cert.TrustBundleConfigMapName, cert.ProxyTrustedCAConfigMapName} {
+			Eventually(func() error {
+				_, err := cm.listers()[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(name)
+				return err
+			}, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+		}
+
+		Expect(cm.Sync(context.TODO(), newCerts(nil))).To(Succeed())
+
+		for _, name := range []string{cert.TrustBundleConfigMapName, cert.ProxyTrustedCAConfigMapName} {
+			_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+			Expect(errors.IsNotFound(err)).To(BeTrue(), name)
+		}
+		// not the operator's
+		_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), sourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,265 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annCAPublished records on the signer secret the CA that was published into the bundle and its
+	// propagation targets, and when. The targets are only issued by a published CA, the annotation
+	// carries the progress over restarts of the operator.
+	annCAPublished = "operator.maroonedpods.io/caPublished"
+)
+
+// caPublicationError is returned when the CA couldn't be published into the bundle and its propagation
+// targets, the next sync publishes it again
+type caPublicationError struct {
+	Signer string
+	Err    error
+}
+
+func (e *caPublicationError) Error() string {
+	return fmt.Sprintf("failed to publish the CA of signer %s: %v", e.Signer, e.Err)
+}
+
+func (e *caPublicationError) Unwrap() error {
+	return e.Err
+}
+
+type caPublication struct {
+	Fingerprint string    `json:"fingerprint"`
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// publishCA orders the rotation of the CA of the definition in two phases: the CA is published into the
+// bundle and its propagation targets and the writes are confirmed, then, once the CASettleDelay passed,
+// the target may be issued by it. It tells whether the target is ensured now, until then it keeps the
+// certificate of the previous CA, which its verifiers still trust. A failed publication is returned
+// with whether the target is ensured regardless.
+func (cm *certManager) publishCA(ctx context.Context, cd mpcerts.CertificateDefinition, ca *crypto.CA, bundle []*x509.Certificate) (bool, error) {
+	caCert := ca.Config.Certs[0]
+	publication, err := cm.caPublicationOf(ctx, cd, certFingerprint(caCert))
+	if err != nil {
+		return false, err
+	}
+
+	if publication == nil {
+		if err := cm.publishBundle(ctx, cd, caCert, bundle); err != nil {
+			err = &caPublicationError{Signer: secretKey(cd.SignerSecret), Err: err}
+			// a missing target has no verifiers yet
+			if !cm.targetIssuedByOtherCA(cd, caCert) {
+				return true, err
+			}
+			// a certificate of the previous CA isn't kept until it expires
+			if cm.targetDue(cd) {
+				log.Info("Issuing the target before the CA is published, it is due", "target", secretKey(cd.TargetSecret), "error", err.Error())
+				return true, err
+			}
+			return false, err
+		}
+		publication = &caPublication{Fingerprint: certFingerprint(caCert), PublishedAt: cm.clock.Now().UTC()}
+		if err := cm.recordCAPublication(ctx, cd, publication); err != nil {
+			return false, err
+		}
+	}
+
+	key := secretKey(cd.TargetSecret)
+	until := publication.PublishedAt.Add(cd.CASettleDelay)
+	if cd.CASettleDelay <= 0 || !cm.clock.Now().Before(until) || !cm.targetIssuedByOtherCA(cd, caCert) {
+		delete(cm.caSettles, key)
+		return true, nil
+	}
+	if _, ok := cm.caSettles[key]; !ok {
+		log.Info("Waiting for the consumers to pick up the new CA before issuing the target", "target", key, "until", until)
+	}
+	if cm.caSettles == nil {
+		cm.caSettles = make(map[string]time.Time)
+	}
+	cm.caSettles[key] = until
+	return false, nil
+}
+
+// caPublicationOf returns the publication of the CA recorded on the signer secret, nil if the CA with
+// the fingerprint wasn't published yet
+func (cm *certManager) caPublicationOf(ctx context.Context, cd mpcerts.CertificateDefinition, fingerprint string) (*caPublication, error) {
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.SignerSecret.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	secret, err := listers.secretLister.Secrets(cd.SignerSecret.Namespace).Get(cd.SignerSecret.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if publication := parseCAPublication(secret); publication != nil && publication.Fingerprint == fingerprint {
+		return publication, nil
+	}
+
+	// the lister may not have seen the annotation yet
+	secret, err = cm.coreClient(mpcerts.ManagementCluster).Secrets(cd.SignerSecret.Namespace).Get(ctx, cd.SignerSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if publication := parseCAPublication(secret); publication != nil && publication.Fingerprint == fingerprint {
+		return publication, nil
+	}
+	return nil, nil
+}
+
+func parseCAPublication(secret *corev1.Secret) *caPublication {
+	if secret == nil || secret.Annotations[annCAPublished] == "" {
+		return nil
+	}
+	publication := &caPublication{}
+	if err := json.Unmarshal([]byte(secret.Annotations[annCAPublished]), publication); err != nil {
+		log.Info("Ignoring invalid CA publication annotation", "secret", secret.Namespace+"/"+secret.Name, "error", err.Error())
+		return nil
+	}
+	return publication
+}
+
+// recordCAPublication records the publication on the signer secret
+func (cm *certManager) recordCAPublication(ctx context.Context, cd mpcerts.CertificateDefinition, publication *caPublication) error {
+	value, err := json.Marshal(publication)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annCAPublished: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cm.coreClient(mpcerts.ManagementCluster).Secrets(cd.SignerSecret.Namespace).Patch(ctx, cd.SignerSecret.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// publishBundle propagates the bundle and confirms every propagation target trusts the CA
+func (cm *certManager) publishBundle(ctx context.Context, cd mpcerts.CertificateDefinition, caCert *x509.Certificate, bundle []*x509.Certificate) error {
+	if err := cm.propagateBundle(ctx, cd, bundle); err != nil {
+		return err
+	}
+
+	bundleConfigMap := cd.CertBundleConfigmap
+	replicas, err := cm.bundleReplicas(cd)
+	if err != nil {
+		return err
+	}
+	configMaps := append([]types.NamespacedName{{Namespace: bundleConfigMap.Namespace, Name: bundleConfigMap.Name}}, cd.BundleCopies...)
+	for _, nn := range append(configMaps, replicas...) {
+		configMap, err := cm.coreClient(cd.BundleCluster).ConfigMaps(nn.Namespace).Get(ctx, nn.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !pemContainsCert([]byte(configMap.Data[selfManagedBundleKey]), caCert) {
+			return fmt.Errorf("configmap %s doesn't have the CA yet", nn)
+		}
+	}
+
+	for _, name := range cd.MutatingWebhookConfigurations {
+		config, err := cm.kubeClient(cd.ConsumerCluster).AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, webhook := range config.Webhooks {
+			if !pemContainsCert(webhook.ClientConfig.CABundle, caCert) {
+				return fmt.Errorf("webhook %s of mutatingwebhookconfiguration %s doesn't have the CA yet", webhook.Name, name)
+			}
+		}
+	}
+
+	for _, name := range cd.APIServices {
+		apiService, err := cm.getAPIService(name)
+		if err != nil {
+			return err
+		}
+		if apiService != nil && !pemContainsCert(apiService.Spec.CABundle, caCert) {
+			return fmt.Errorf("apiservice %s doesn't have the CA yet", name)
+		}
+	}
+
+	for _, name := range cd.ConversionCRDs {
+		extClient := cm.apiextClient(cd.ConsumerCluster)
+		if extClient == nil {
+			continue
+		}
+		crd, err := extClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		conversion := crd.Spec.Conversion
+		if conversion == nil || conversion.Strategy != extv1.WebhookConverter || conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+			continue
+		}
+		if !pemContainsCert(conversion.Webhook.ClientConfig.CABundle, caCert) {
+			return fmt.Errorf("the conversion webhook of customresourcedefinition %s doesn't have the CA yet", name)
+		}
+	}
+	return nil
+}
+
+// targetIssuedByOtherCA tells if the target has a valid certificate that wasn't issued by the CA, a missing
+// or broken one is issued regardless of the ordering
+func (cm *certManager) targetIssuedByOtherCA(cd mpcerts.CertificateDefinition, caCert *x509.Certificate) bool {
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.TargetSecret.Namespace})
+	if err != nil {
+		return false
+	}
+	secret, err := listers.secretLister.Secrets(cd.TargetSecret.Namespace).Get(cd.TargetSecret.Name)
+	if err != nil || len(secret.Data[corev1.TLSCertKey]) == 0 {
+		return false
+	}
+	certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil || cm.clock.Now().After(certs[0].NotAfter) {
+		return false
+	}
+	return certs[0].CheckSignatureFrom(caCert) != nil
+}
+
+// targetDue tells if the certificate of the target entered its refresh window
+func (cm *certManager) targetDue(cd mpcerts.CertificateDefinition) bool {
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.TargetSecret.Namespace})
+	if err != nil {
+		return false
+	}
+	secret, err := listers.secretLister.Secrets(cd.TargetSecret.Namespace).Get(cd.TargetSecret.Name)
+	if err != nil {
+		return false
+	}
+	notBefore, notAfter, ok := cm.certValidity(secret)
+	if !ok {
+		return true
+	}
+	return !cm.clock.Now().Before(refreshTime(cm.jittered(secret, cd.TargetConfig), notBefore, notAfter))
+}
+
+func pemContainsCert(pem []byte, cert *x509.Certificate) bool {
+	if len(pem) == 0 {
+		return false
+	}
+	certs, err := crypto.CertsFromPEM(pem)
+	if err != nil {
+		return false
+	}
+	return containsCert(certs, cert)
+}
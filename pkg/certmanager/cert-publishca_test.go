@@ -0,0 +1,207 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+)
+
+var _ = Describe("CA publication ordering tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	// starts a certificate manager on the client, as the operator does after a restart
+	start := func() {
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.clock = clock
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	certOf := func(secret *corev1.Secret) *x509.Certificate {
+		certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certs[0]
+	}
+
+	webhookBundle := func() []*x509.Certificate {
+		config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), cluster.MutatingWebhookConfigurationName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		bundle, err := crypto.CertsFromPEM(config.Webhooks[0].ClientConfig.CABundle)
+		Expect(err).ToNot(HaveOccurred())
+		return bundle
+	}
+
+	// syncs and waits for the listers to catch up with the signer and the target
+	sync := func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		waitForSecretInLister(cm, getSecret(cert.ServerSignerSecretName))
+		waitForSecretInLister(cm, getSecret(cert.ServerCertSecretName))
+	}
+
+	// rotates the signer and re-issues the target with the next sync
+	rotate := func() {
+		certs[0].SignerConfig.Lifetime *= 2
+		certs[0].TargetConfig.Lifetime *= 2
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods.maroonedpods.io"}},
+		})
+		clock = clocktesting.NewFakeClock(time.Now())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		start()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should publish the new CA before the target is issued by it", func() {
+		sync()
+		previous := getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]
+
+		// the target as of the publication of the CA to the webhook
+		var targetAtPublication []byte
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(testingclient.Action) (bool, runtime.Object, error) {
+			if targetAtPublication == nil {
+				// the client is locked while reacting
+				obj, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("secrets"), namespace, cert.ServerCertSecretName)
+				Expect(err).ToNot(HaveOccurred())
+				targetAtPublication = obj.(*corev1.Secret).Data[corev1.TLSCertKey]
+			}
+			return false, nil, nil
+		})
+
+		rotate()
+		sync()
+
+		Expect(targetAtPublication).To(Equal(previous))
+		signer := certOf(getSecret(cert.ServerSignerSecretName))
+		Expect(containsCert(webhookBundle(), signer)).To(BeTrue())
+		Expect(certOf(getSecret(cert.ServerCertSecretName)).CheckSignatureFrom(signer)).To(Succeed())
+
+		publication := parseCAPublication(getSecret(cert.ServerSignerSecretName))
+		Expect(publication).ToNot(BeNil())
+		Expect(publication.Fingerprint).To(Equal(certFingerprint(signer)))
+	})
+
+	It("should issue the target after the settle delay, across restarts", func() {
+		certs[0].CASettleDelay = time.Minute
+		// the first target has no verifiers to wait for
+		sync()
+		previous := getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]
+
+		rotate()
+		sync()
+		signer := certOf(getSecret(cert.ServerSignerSecretName))
+		Expect(containsCert(webhookBundle(), signer)).To(BeTrue())
+		Expect(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]).To(Equal(previous))
+		Expect(cm.NextRefreshIn()).To(BeNumerically("<=", time.Minute))
+		annotation := getSecret(cert.ServerSignerSecretName).Annotations[annCAPublished]
+
+		// the restarted operator keeps waiting from the publication on
+		cancel()
+		clock.Step(30 * time.Second)
+		start()
+		sync()
+		Expect(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]).To(Equal(previous))
+		Expect(getSecret(cert.ServerSignerSecretName).Annotations[annCAPublished]).To(Equal(annotation))
+
+		cancel()
+		clock.Step(time.Minute)
+		start()
+		sync()
+		Expect(certOf(getSecret(cert.ServerCertSecretName)).CheckSignatureFrom(signer)).To(Succeed())
+		Expect(cm.caSettles).To(BeEmpty())
+	})
+
+	It("should publish the CA again after a restart before it was recorded", func() {
+		sync()
+		previous := getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]
+
+		// the operator stops between the propagation and the record of the publication
+		client.PrependReactor("patch", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			patch := action.(testingclient.PatchAction)
+			if patch.GetName() != cert.ServerSignerSecretName {
+				return false, nil, nil
+			}
+			var object map[string]map[string]map[string]string
+			if json.Unmarshal(patch.GetPatch(), &object) == nil && object["metadata"]["annotations"][annCAPublished] != "" {
+				cancel()
+				return true, nil, context.Canceled
+			}
+			return false, nil, nil
+		})
+		rotate()
+		Expect(cm.Sync(context.TODO(), certs)).ToNot(Succeed())
+		Expect(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]).To(Equal(previous))
+
+		client.ReactionChain = client.ReactionChain[1:]
+		start()
+		sync()
+		signer := certOf(getSecret(cert.ServerSignerSecretName))
+		Expect(containsCert(webhookBundle(), signer)).To(BeTrue())
+		Expect(parseCAPublication(getSecret(cert.ServerSignerSecretName)).Fingerprint).To(Equal(certFingerprint(signer)))
+		Expect(certOf(getSecret(cert.ServerCertSecretName)).CheckSignatureFrom(signer)).To(Succeed())
+	})
+
+	It("should return a failed publication and issue the target once it is due", func() {
+		sync()
+		previous := getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]
+
+		client.PrependReactor("patch", "mutatingwebhookconfigurations", func(testingclient.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("the webhook configuration is locked")
+		})
+		rotate()
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(MatchError(ContainSubstring("failed to publish the CA of signer")))
+		Expect(err).To(MatchError(ContainSubstring("the webhook configuration is locked")))
+		waitForSecretInLister(cm, getSecret(cert.ServerSignerSecretName))
+		Expect(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]).To(Equal(previous))
+
+		// library-go checks the validity against the wall clock
+		secret, err := certtest.IntoRefreshWindow(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: cert.ServerCertSecretName}, certs[0].TargetConfig)
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		Expect(cm.Sync(context.TODO(), certs)).To(MatchError(ContainSubstring("the webhook configuration is locked")))
+		signer := certOf(getSecret(cert.ServerSignerSecretName))
+		Expect(certOf(getSecret(cert.ServerCertSecretName)).CheckSignatureFrom(signer)).To(Succeed())
+		Expect(parseCAPublication(getSecret(cert.ServerSignerSecretName))).To(BeNil())
+	})
+})
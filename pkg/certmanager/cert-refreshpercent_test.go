@@ -0,0 +1,107 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("refresh percent tests", func() {
+	const namespace = "maroonedpods"
+
+	percentPtr := func(p int32) *int32 {
+		return &p
+	}
+
+	DescribeTable("should resolve the refresh", func(lifetime time.Duration, percent int, expected time.Duration) {
+		config := cert.CertificateConfig{Lifetime: lifetime, RefreshPercent: percent}
+		config.ResolveRefresh()
+		Expect(config.Refresh).To(Equal(expected))
+	},
+		Entry("of a day", 24*time.Hour, 80, 19*time.Hour+12*time.Minute),
+		Entry("truncated to the second", time.Hour+time.Second, 50, 30*time.Minute),
+		Entry("of 90 days", 90*cert.Day, 80, 72*cert.Day),
+		Entry("of a long lifetime", 100*cert.Year, 99, 99*cert.Year),
+		Entry("of the lowest percent", 100*time.Second, 1, time.Second),
+	)
+
+	It("should not override an absolute refresh", func() {
+		config := cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: time.Hour, RefreshPercent: 80}
+		config.ResolveRefresh()
+		Expect(config.Refresh).To(Equal(time.Hour))
+	})
+
+	DescribeTable("should validate the definition", func(config cert.CertificateConfig, expected string) {
+		cd := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})[0]
+		cd.TargetConfig = config
+		err := cd.Validate()
+		if expected == "" {
+			Expect(err).ToNot(HaveOccurred())
+			return
+		}
+		Expect(err).To(MatchError(cert.ErrInvalidDefinition))
+		Expect(err).To(MatchError(ContainSubstring(expected)))
+	},
+		Entry("resolved", cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour, RefreshPercent: 50}, ""),
+		Entry("below the bounds", cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour, RefreshPercent: -1}, "not between 1 and 99"),
+		Entry("above the bounds", cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 24 * time.Hour, RefreshPercent: 100}, "not between 1 and 99"),
+		Entry("unresolved", cert.CertificateConfig{Lifetime: 24 * time.Hour, RefreshPercent: 50}, "not resolved"),
+		Entry("with a different refresh", cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: time.Hour, RefreshPercent: 50}, "mutually exclusive"),
+	)
+
+	Context("in the CR", func() {
+		It("should renew at the remaining percent of the lifetime", func() {
+			defs, err := cert.DefinitionsFromCertConfig(namespace, &v1alpha1.MaroonedPodsCertConfig{
+				CA:     &v1alpha1.CertConfig{RenewBeforePercent: percentPtr(25)},
+				Server: &v1alpha1.CertConfig{Duration: durationPtr("2160h"), RenewBeforePercent: percentPtr(20)},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(defs[0].SignerConfig.RefreshPercent).To(Equal(75))
+			Expect(defs[0].SignerConfig.Refresh).To(Equal(36 * time.Hour))
+			Expect(defs[0].TargetConfig.RefreshPercent).To(Equal(80))
+			Expect(defs[0].TargetConfig.Refresh).To(Equal(72 * cert.Day))
+		})
+
+		DescribeTable("should reject", func(config *v1alpha1.CertConfig, expected string) {
+			_, err := cert.DefinitionsFromCertConfig(namespace, &v1alpha1.MaroonedPodsCertConfig{Server: config})
+			Expect(err).To(MatchError(ContainSubstring(expected)))
+		},
+			Entry("zero", &v1alpha1.CertConfig{RenewBeforePercent: percentPtr(0)}, "certConfig.server.renewBeforePercent"),
+			Entry("100", &v1alpha1.CertConfig{RenewBeforePercent: percentPtr(100)}, "certConfig.server.renewBeforePercent"),
+			Entry("with renewBefore", &v1alpha1.CertConfig{RenewBefore: durationPtr("1h"), RenewBeforePercent: percentPtr(20)}, "mutually exclusive"),
+		)
+	})
+
+	It("should not rotate for a percent equivalent to the refresh", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+		signerNotBefore := getCertNotBefore(client, namespace, "maroonedpods-server")
+		targetNotBefore := getCertNotBefore(client, namespace, util.SecretResourceName)
+		targetConfig := getCertConfigAnno(client, namespace, util.SecretResourceName)
+
+		// certificates issued within the same second have the same NotBefore
+		time.Sleep(time.Second)
+		half := 50
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{
+			Namespace:            namespace,
+			SignerRefreshPercent: &half,
+			TargetRefreshPercent: &half,
+		}))).To(Succeed())
+		Expect(getCertNotBefore(client, namespace, "maroonedpods-server")).To(Equal(signerNotBefore))
+		Expect(getCertNotBefore(client, namespace, util.SecretResourceName)).To(Equal(targetNotBefore))
+		Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(targetConfig))
+	})
+})
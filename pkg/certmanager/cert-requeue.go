@@ -0,0 +1,66 @@
+package certmanager
+
+import (
+	"math"
+	"time"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// noRefreshDue is the hint when there is no certificate to refresh
+const noRefreshDue = time.Duration(math.MaxInt64)
+
+// NextRefreshIn returns how long until the nearest certificate enters its refresh window, as of
+// the last sync. It is zero when a certificate is already due.
+func (cm *certManager) NextRefreshIn() time.Duration {
+	return cm.nextRefresh
+}
+
+// nextRefreshIn computes the time until the nearest certificate of the definitions enters its
+// refresh window, certificates of unknown validity are due
+func (cm *certManager) nextRefreshIn(certs []mpcerts.CertificateDefinition) time.Duration {
+	next := noRefreshDue
+	for _, cd := range certs {
+		// resumed by the sync after its namespace is recreated
+		if cm.inAbsentNamespace(cd) {
+			continue
+		}
+		// the target is issued by the new CA once it settled
+		if until, ok := cm.caSettles[secretKey(cd.TargetSecret)]; ok {
+			in := until.Sub(cm.clock.Now())
+			if in <= 0 {
+				return 0
+			}
+			if in < next {
+				next = in
+			}
+		}
+		for _, c := range managedCertsOf(cd) {
+			notBefore, notAfter, ok := cm.validityOf(c)
+			if !ok {
+				return 0
+			}
+			in := refreshTime(cm.jittered(c.secret, c.config), notBefore, notAfter).Sub(cm.clock.Now())
+			if in <= 0 {
+				return 0
+			}
+			if in < next {
+				next = in
+			}
+		}
+	}
+	return next
+}
+
+// refreshTime returns when library-go starts refreshing the certificate: after the refresh period,
+// at the latest once 80% of the lifetime has elapsed
+func refreshTime(config mpcerts.CertificateConfig, notBefore, notAfter time.Time) time.Time {
+	latest := notAfter.Add(-notAfter.Sub(notBefore) / 5)
+	if config.Refresh <= 0 {
+		return latest
+	}
+	if refresh := notBefore.Add(config.Refresh); refresh.Before(latest) {
+		return refresh
+	}
+	return latest
+}
@@ -0,0 +1,133 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("certificate requeue hint tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		cancel context.CancelFunc
+	)
+
+	// issued age ago with the given lifetime
+	newCertSecret := func(name string, age, lifetime time.Duration) *corev1.Secret {
+		notBefore := clock.Now().Add(-age)
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Annotations: map[string]string{
+					certrotation.CertificateNotBeforeAnnotation: notBefore.Format(time.RFC3339),
+					certrotation.CertificateNotAfterAnnotation:  notBefore.Add(lifetime).Format(time.RFC3339),
+				},
+			},
+		}
+	}
+
+	newDefinition := func(name string, lifetime, refresh time.Duration) cert.CertificateDefinition {
+		return cert.CertificateDefinition{
+			TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}},
+			TargetConfig: cert.CertificateConfig{Lifetime: lifetime, Refresh: refresh},
+		}
+	}
+
+	start := func(secrets ...*corev1.Secret) {
+		client = fake.NewSimpleClientset()
+		for _, secret := range secrets {
+			_, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.clock = clock
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		clock = clocktesting.NewFakeClock(time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC))
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should return the time until the nearest refresh of mixed lifetimes", func() {
+		start(
+			newCertSecret("short", 30*time.Minute, 2*time.Hour),
+			newCertSecret("long", 0, 48*time.Hour),
+		)
+		certs := []cert.CertificateDefinition{
+			newDefinition("long", 48*time.Hour, 24*time.Hour),
+			newDefinition("short", 2*time.Hour, time.Hour),
+		}
+
+		Expect(cm.nextRefreshIn(certs)).To(Equal(30 * time.Minute))
+
+		clock.Step(20 * time.Minute)
+		Expect(cm.nextRefreshIn(certs)).To(Equal(10 * time.Minute))
+		Expect(cm.nextRefreshIn(certs[:1])).To(Equal(24*time.Hour - 20*time.Minute))
+	})
+
+	It("should refresh at 80% of the lifetime at the latest", func() {
+		start(newCertSecret("late", 0, 10*time.Hour))
+
+		Expect(cm.nextRefreshIn([]cert.CertificateDefinition{newDefinition("late", 10*time.Hour, 9*time.Hour)})).To(Equal(8 * time.Hour))
+	})
+
+	It("should return zero when a certificate is due", func() {
+		start(
+			newCertSecret("due", 90*time.Minute, 2*time.Hour),
+			newCertSecret("long", 0, 48*time.Hour),
+		)
+
+		Expect(cm.nextRefreshIn([]cert.CertificateDefinition{
+			newDefinition("long", 48*time.Hour, 24*time.Hour),
+			newDefinition("due", 2*time.Hour, time.Hour),
+		})).To(BeZero())
+	})
+
+	It("should return zero when a certificate is not issued yet", func() {
+		start(newCertSecret("long", 0, 48*time.Hour))
+
+		Expect(cm.nextRefreshIn([]cert.CertificateDefinition{
+			newDefinition("long", 48*time.Hour, 24*time.Hour),
+			newDefinition("missing", 2*time.Hour, time.Hour),
+		})).To(BeZero())
+	})
+
+	It("should keep the hint of the last sync", func() {
+		start()
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		cm.clock = clocktesting.NewFakeClock(time.Now())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, c := range managedCertsOf(certs[0]) {
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), c.secret.Name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, secret)
+		}
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		// the target is refreshed first, after half of its lifetime
+		Expect(cm.NextRefreshIn()).To(BeNumerically("~", 12*time.Hour, time.Minute))
+	})
+})
@@ -0,0 +1,200 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// syncRetryBudget bounds the time a Sync spends waiting to retry transient errors, a flapping API
+	// server fails the sync once it is spent
+	syncRetryBudget = 30 * time.Second
+)
+
+// defaultTransientRetry retries an API call twice, after about 200ms and 400ms
+var defaultTransientRetry = wait.Backoff{
+	Duration: 200 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    3,
+}
+
+// isTransientAPIError reports whether the API call may succeed when retried as is: the API server
+// throttled it, timed out or the connection broke, e.g. during a rollout of the control plane
+func isTransientAPIError(err error) bool {
+	if errors.IsTooManyRequests(err) || errors.IsServerTimeout(err) || errors.IsTimeout(err) {
+		return true
+	}
+	return utilnet.IsProbableEOF(err) || utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) ||
+		utilnet.IsTimeout(err)
+}
+
+// retryBudgetKey is the context key of the retry budget of a Sync
+type retryBudgetKey struct{}
+
+// withRetryBudget starts the retry budget shared by the API calls of a Sync made with the returned
+// context, the returned func ends it
+func withRetryBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	budget, cancel := context.WithTimeout(context.Background(), syncRetryBudget)
+	return context.WithValue(ctx, retryBudgetKey{}, budget), cancel
+}
+
+// retryTransient calls the API through call and retries its transient errors with a jittered
+// exponential backoff, as long as the retry budget of the Sync of the context allows. Other errors
+// are returned at once.
+func (cm *certManager) retryTransient(ctx context.Context, call func() error) error {
+	budget, ok := ctx.Value(retryBudgetKey{}).(context.Context)
+	if !ok {
+		// outside of a Sync, e.g. ForceRotate, the attempts bound the retries
+		budget = context.Background()
+	}
+	backoff := cm.transientRetry
+	for {
+		err := call()
+		if err == nil || !isTransientAPIError(err) || backoff.Steps <= 1 {
+			return err
+		}
+		delay := backoff.Step()
+		if deadline, ok := budget.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		log.V(1).Info("Retrying a transient API error", "error", err.Error(), "after", delay)
+		select {
+		case <-budget.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// coreClient returns the core client of the cluster retrying the transient errors of the secret and
+// configmap calls
+func (cm *certManager) coreClient(cluster mpcerts.Cluster) corev1client.CoreV1Interface {
+	return &transientRetryCoreClient{CoreV1Interface: cm.kubeClient(cluster).CoreV1(), cm: cm}
+}
+
+type transientRetryCoreClient struct {
+	corev1client.CoreV1Interface
+	cm *certManager
+}
+
+func (c *transientRetryCoreClient) Secrets(namespace string) corev1client.SecretInterface {
+	return &transientRetrySecrets{SecretInterface: c.CoreV1Interface.Secrets(namespace), cm: c.cm}
+}
+
+func (c *transientRetryCoreClient) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return &transientRetryConfigMaps{ConfigMapInterface: c.CoreV1Interface.ConfigMaps(namespace), cm: c.cm}
+}
+
+type transientRetrySecrets struct {
+	corev1client.SecretInterface
+	cm *certManager
+}
+
+func (s *transientRetrySecrets) Get(ctx context.Context, name string, opts metav1.GetOptions) (secret *corev1.Secret, err error) {
+	err = s.cm.retryTransient(ctx, func() error {
+		secret, err = s.SecretInterface.Get(ctx, name, opts)
+		return err
+	})
+	return secret, err
+}
+
+func (s *transientRetrySecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (created *corev1.Secret, err error) {
+	err = s.cm.retryTransient(ctx, func() error {
+		created, err = s.SecretInterface.Create(ctx, secret, opts)
+		return err
+	})
+	return created, err
+}
+
+func (s *transientRetrySecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (updated *corev1.Secret, err error) {
+	err = s.cm.retryTransient(ctx, func() error {
+		updated, err = s.SecretInterface.Update(ctx, secret, opts)
+		return err
+	})
+	return updated, err
+}
+
+func (s *transientRetrySecrets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (patched *corev1.Secret, err error) {
+	err = s.cm.retryTransient(ctx, func() error {
+		patched, err = s.SecretInterface.Patch(ctx, name, pt, data, opts, subresources...)
+		return err
+	})
+	return patched, err
+}
+
+func (s *transientRetrySecrets) Apply(ctx context.Context, secret *applycorev1.SecretApplyConfiguration, opts metav1.ApplyOptions) (applied *corev1.Secret, err error) {
+	err = s.cm.retryTransient(ctx, func() error {
+		applied, err = s.SecretInterface.Apply(ctx, secret, opts)
+		return err
+	})
+	return applied, err
+}
+
+func (s *transientRetrySecrets) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return s.cm.retryTransient(ctx, func() error {
+		return s.SecretInterface.Delete(ctx, name, opts)
+	})
+}
+
+type transientRetryConfigMaps struct {
+	corev1client.ConfigMapInterface
+	cm *certManager
+}
+
+func (c *transientRetryConfigMaps) Get(ctx context.Context, name string, opts metav1.GetOptions) (configMap *corev1.ConfigMap, err error) {
+	err = c.cm.retryTransient(ctx, func() error {
+		configMap, err = c.ConfigMapInterface.Get(ctx, name, opts)
+		return err
+	})
+	return configMap, err
+}
+
+func (c *transientRetryConfigMaps) Create(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.CreateOptions) (created *corev1.ConfigMap, err error) {
+	err = c.cm.retryTransient(ctx, func() error {
+		created, err = c.ConfigMapInterface.Create(ctx, configMap, opts)
+		return err
+	})
+	return created, err
+}
+
+func (c *transientRetryConfigMaps) Update(ctx context.Context, configMap *corev1.ConfigMap, opts metav1.UpdateOptions) (updated *corev1.ConfigMap, err error) {
+	err = c.cm.retryTransient(ctx, func() error {
+		updated, err = c.ConfigMapInterface.Update(ctx, configMap, opts)
+		return err
+	})
+	return updated, err
+}
+
+func (c *transientRetryConfigMaps) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (patched *corev1.ConfigMap, err error) {
+	err = c.cm.retryTransient(ctx, func() error {
+		patched, err = c.ConfigMapInterface.Patch(ctx, name, pt, data, opts, subresources...)
+		return err
+	})
+	return patched, err
+}
+
+func (c *transientRetryConfigMaps) Apply(ctx context.Context, configMap *applycorev1.ConfigMapApplyConfiguration, opts metav1.ApplyOptions) (applied *corev1.ConfigMap, err error) {
+	err = c.cm.retryTransient(ctx, func() error {
+		applied, err = c.ConfigMapInterface.Apply(ctx, configMap, opts)
+		return err
+	})
+	return applied, err
+}
+
+func (c *transientRetryConfigMaps) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.cm.retryTransient(ctx, func() error {
+		return c.ConfigMapInterface.Delete(ctx, name, opts)
+	})
+}
@@ -0,0 +1,110 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("transient API error retry tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+		// the creates of the target secret
+		attempts int
+	)
+
+	// fails the first failures creates of the target secret with err
+	failTargetCreates := func(failures int, err error) {
+		client.PrependReactor("create", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.(testingclient.CreateAction).GetObject().(*corev1.Secret).Name != cert.ServerCertSecretName {
+				return false, nil, nil
+			}
+			attempts++
+			if attempts > failures {
+				return false, nil, nil
+			}
+			return true, nil, err
+		})
+	}
+
+	targetExists := func() bool {
+		_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		attempts = 0
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.transientRetry = wait.Backoff{Duration: time.Millisecond, Factor: 2, Jitter: 0.5, Steps: 3}
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should retry the transient errors within the sync", func() {
+		failTargetCreates(2, errors.NewTooManyRequests("slow down", 1))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(attempts).To(Equal(3))
+		Expect(targetExists()).To(BeTrue())
+	})
+
+	It("should retry a broken connection", func() {
+		failTargetCreates(1, &url.Error{Op: "Post", URL: "https://api:6443/api/v1/namespaces/maroonedpods/secrets", Err: io.EOF})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(attempts).To(Equal(2))
+	})
+
+	It("should give up after the attempts", func() {
+		failTargetCreates(5, errors.NewServerTimeout(schema.GroupResource{Resource: "secrets"}, "create", 1))
+		Expect(cm.Sync(context.TODO(), certs)).To(MatchError(ContainSubstring("secrets")))
+		Expect(attempts).To(Equal(3))
+		Expect(targetExists()).To(BeFalse())
+	})
+
+	It("should not retry the other errors", func() {
+		failTargetCreates(5, errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, cert.ServerCertSecretName, fmt.Errorf("denied")))
+		Expect(cm.Sync(context.TODO(), certs)).To(MatchError(ContainSubstring("denied")))
+		Expect(attempts).To(Equal(1))
+	})
+
+	It("should not retry beyond the budget of the sync", func() {
+		cm.transientRetry.Duration = time.Hour
+		ctx, endRetryBudget := withRetryBudget(context.Background())
+		defer endRetryBudget()
+
+		calls := 0
+		err := cm.retryTransient(ctx, func() error {
+			calls++
+			return errors.NewTooManyRequests("slow down", 1)
+		})
+		Expect(errors.IsTooManyRequests(err)).To(BeTrue())
+		Expect(calls).To(Equal(1))
+	})
+})
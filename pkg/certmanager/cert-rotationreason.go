@@ -0,0 +1,208 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annLastRotationTime and annLastRotationReason are stamped on the signer and target secrets
+	// in the same request that rotates them
+	annLastRotationTime   = "operator.maroonedpods.io/last-rotation-time"
+	annLastRotationReason = "operator.maroonedpods.io/last-rotation-reason"
+
+	// the first certificate of the secret
+	rotationReasonIssued = "Issued"
+	// the certificate entered its refresh window
+	rotationReasonRefresh = "ScheduledRefresh"
+	// the config of the definition changed, see ensureCertConfig
+	rotationReasonConfigChange = "ConfigChange"
+	// requested through ForceRotate
+	rotationReasonForced = "ForceRotate"
+	// the secret of a previous operator version or installation was adopted
+	rotationReasonAdopted = "Adopted"
+	// the key pair of the signer was corrupted, see recoverCorruptedSigner
+	rotationReasonSignerRecovered = "SignerRecovered"
+	// the certificate didn't verify against its CA bundle, see verifyChains
+	rotationReasonChainBroken = "ChainBroken"
+)
+
+// rotationRecordingSecretsGetter detects the rotations library-go writes through it by comparing
+// tls.crt with the secret it read before. The rotation is stamped on the secret in the same write,
+// then reported as event and metric.
+type rotationRecordingSecretsGetter struct {
+	corev1client.SecretsGetter
+	cm *certManager
+	// the secrets read through the getter by namespace/name
+	previous map[string]*corev1.Secret
+}
+
+func (cm *certManager) rotationRecordingClient(client corev1client.SecretsGetter) corev1client.SecretsGetter {
+	return &rotationRecordingSecretsGetter{
+		SecretsGetter: client,
+		cm:            cm,
+		previous:      map[string]*corev1.Secret{},
+	}
+}
+
+func (g *rotationRecordingSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &rotationRecordingSecrets{
+		SecretInterface: g.SecretsGetter.Secrets(namespace),
+		getter:          g,
+	}
+}
+
+type rotationRecordingSecrets struct {
+	corev1client.SecretInterface
+	getter *rotationRecordingSecretsGetter
+}
+
+func (s *rotationRecordingSecrets) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+	secret, err := s.SecretInterface.Get(ctx, name, opts)
+	if err == nil {
+		s.getter.previous[secret.Namespace+"/"+secret.Name] = secret
+	}
+	return secret, err
+}
+
+func (s *rotationRecordingSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	secret, reason := s.getter.stamp(secret)
+	created, err := s.SecretInterface.Create(ctx, secret, opts)
+	if err == nil && reason != "" {
+		s.getter.cm.reportRotation(created, reason)
+	}
+	return created, err
+}
+
+func (s *rotationRecordingSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	secret, reason := s.getter.stamp(secret)
+	updated, err := s.SecretInterface.Update(ctx, secret, opts)
+	if err == nil && reason != "" {
+		s.getter.cm.reportRotation(updated, reason)
+	}
+	return updated, err
+}
+
+// stamp returns a copy of the secret with the rotation annotations and the reason of the rotation,
+// the secret itself and no reason when the write doesn't rotate it
+func (g *rotationRecordingSecretsGetter) stamp(secret *corev1.Secret) (*corev1.Secret, string) {
+	key := secret.Namespace + "/" + secret.Name
+	certPEM := secret.Data[corev1.TLSCertKey]
+	if len(certPEM) == 0 {
+		return secret, ""
+	}
+
+	var previousPEM []byte
+	if previous, ok := g.previous[key]; ok {
+		previousPEM = previous.Data[corev1.TLSCertKey]
+	}
+	if bytes.Equal(previousPEM, certPEM) {
+		return secret, ""
+	}
+
+	reason := g.cm.rotationReasons[key]
+	switch {
+	case reason != "":
+	case len(previousPEM) == 0:
+		reason = rotationReasonIssued
+	default:
+		reason = rotationReasonRefresh
+	}
+
+	secret = secret.DeepCopy()
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[annLastRotationTime] = g.cm.clock.Now().UTC().Format(time.RFC3339)
+	secret.Annotations[annLastRotationReason] = reason
+	return secret, reason
+}
+
+func (cm *certManager) reportRotation(secret *corev1.Secret, reason string) {
+	key := secret.Namespace + "/" + secret.Name
+	delete(cm.rotationReasons, key)
+	cm.rotationCount++
+	log.Info("Rotated certificate", "secret", secret.Name, "namespace", secret.Namespace, "reason", reason)
+	cm.eventRecorder.Eventf("CertificateRotated", "Rotated certificate %s: %s", key, reason)
+	certRotations.WithLabelValues(secret.Namespace, secret.Name, reason).Inc()
+	cm.auditCA(secret, reason)
+}
+
+// setRotationReason sets the reason of the next rotation of the secret, kept until it happened
+func (cm *certManager) setRotationReason(secret *corev1.Secret, reason string) {
+	if cm.rotationReasons == nil {
+		cm.rotationReasons = make(map[string]string)
+	}
+	cm.rotationReasons[secret.Namespace+"/"+secret.Name] = reason
+}
+
+// clearRotationReasons drops the reasons of a definition that was issued, an adoption that didn't
+// rotate the secret is not the reason of the next rotation
+func (cm *certManager) clearRotationReasons(cd mpcerts.CertificateDefinition) {
+	for _, c := range managedCertsOf(cd) {
+		delete(cm.rotationReasons, c.secret.Namespace+"/"+c.secret.Name)
+	}
+}
+
+// takeForcedRotation returns the reason ForceRotate or the recovery of a signer forced the
+// rotation of the secret for, once, empty if it isn't forced
+func (cm *certManager) takeForcedRotation(secret *corev1.Secret) string {
+	key := secret.Namespace + "/" + secret.Name
+	reason, ok := cm.forcedRotations[key]
+	if !ok {
+		return ""
+	}
+	delete(cm.forcedRotations, key)
+	return reason
+}
+
+// forceRotation makes the next ensureCertConfig of the secret rotate it for the reason
+func (cm *certManager) forceRotation(secret *corev1.Secret, reason string) {
+	if cm.forcedRotations == nil {
+		cm.forcedRotations = make(map[string]string)
+	}
+	cm.forcedRotations[secret.Namespace+"/"+secret.Name] = reason
+}
+
+// ForceRotate rotates the signer and target of the definition now, regardless of their refresh
+func (cm *certManager) ForceRotate(cd mpcerts.CertificateDefinition) error {
+	if err := cd.Validate(); err != nil {
+		return err
+	}
+	if cd.Issuer != nil {
+		return fmt.Errorf("the certificates are issued by cert-manager.io issuer %s, the operator can't rotate them", cd.Issuer.Name)
+	}
+	if cd.External {
+		return fmt.Errorf("the certificates are provided externally, the operator can't rotate them")
+	}
+	cm.syncLock.Lock()
+	defer cm.syncLock.Unlock()
+
+	// it would be kept for after the pause
+	if cm.chainPaused(cd) {
+		log.Info("Skipping the forced rotation of paused certificates", "certificate", cd.Name())
+		return nil
+	}
+	for _, c := range managedCertsOf(cd) {
+		cm.forceRotation(c.secret, rotationReasonForced)
+	}
+	// the next sync propagates the rotated certificates
+	cm.resetDebounce()
+
+	bundle, err := cm.issue(context.TODO(), cd)
+	cm.recordRotation(cd, err)
+	if err != nil {
+		return err
+	}
+	cm.clearRotationReasons(cd)
+
+	return cm.propagateBundle(context.TODO(), cd, bundle)
+}
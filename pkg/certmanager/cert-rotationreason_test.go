@@ -0,0 +1,151 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("last rotation tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakePassiveClock
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// syncs and waits for the listers
+	sync := func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, c := range managedCertsOf(certs[0]) {
+			waitForSecretInLister(cm, getSecret(c.secret.Name))
+		}
+	}
+
+	expectLastRotation := func(name, reason string, at time.Time) {
+		secret := getSecret(name)
+		Expect(secret.Annotations).To(HaveKeyWithValue(annLastRotationReason, reason))
+		Expect(secret.Annotations).To(HaveKeyWithValue(annLastRotationTime, at.UTC().Format(time.RFC3339)))
+	}
+
+	rotations := func(name, reason string) float64 {
+		var m dto.Metric
+		Expect(certRotations.WithLabelValues(namespace, name, reason).Write(&m)).To(Succeed())
+		return m.GetCounter().GetValue()
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		clock = clocktesting.NewFakePassiveClock(time.Now().Truncate(time.Second))
+		cm.clock = clock
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should stamp the first issuance and leave the annotations alone on no-op syncs", func() {
+		issued := clock.Now()
+		sync()
+		signer, target := certs[0].SignerSecret.Name, certs[0].TargetSecret.Name
+		expectLastRotation(signer, rotationReasonIssued, issued)
+		expectLastRotation(target, rotationReasonIssued, issued)
+
+		clock.SetTime(issued.Add(time.Hour))
+		client.ClearActions()
+		sync()
+
+		expectLastRotation(signer, rotationReasonIssued, issued)
+		expectLastRotation(target, rotationReasonIssued, issued)
+		for _, action := range client.Actions() {
+			Expect(action.GetVerb()).ToNot(BeElementOf("update", "patch"), "%s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	})
+
+	It("should record a rotation forced by a config change", func() {
+		sync()
+		target := certs[0].TargetSecret.Name
+		before := getSecret(target).Data[corev1.TLSCertKey]
+		count := rotations(target, rotationReasonConfigChange)
+
+		clock.SetTime(clock.Now().Add(time.Hour))
+		certs[0].TargetConfig.Lifetime = 12 * time.Hour
+		certs[0].TargetConfig.Refresh = 6 * time.Hour
+		sync()
+
+		Expect(getSecret(target).Data[corev1.TLSCertKey]).ToNot(Equal(before))
+		expectLastRotation(target, rotationReasonConfigChange, clock.Now())
+		Expect(rotations(target, rotationReasonConfigChange)).To(Equal(count + 1))
+		// the signer didn't change
+		Expect(getSecret(certs[0].SignerSecret.Name).Annotations).To(HaveKeyWithValue(annLastRotationReason, rotationReasonIssued))
+	})
+
+	It("should record a forced rotation", func() {
+		sync()
+		signer, target := certs[0].SignerSecret.Name, certs[0].TargetSecret.Name
+		before := getSecret(target).Data[corev1.TLSCertKey]
+		count := rotations(target, rotationReasonForced)
+
+		clock.SetTime(clock.Now().Add(time.Hour))
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+
+		Expect(getSecret(target).Data[corev1.TLSCertKey]).ToNot(Equal(before))
+		expectLastRotation(signer, rotationReasonForced, clock.Now())
+		expectLastRotation(target, rotationReasonForced, clock.Now())
+		Expect(rotations(target, rotationReasonForced)).To(Equal(count + 1))
+
+		// forced only once
+		for _, c := range managedCertsOf(certs[0]) {
+			waitForSecretInLister(cm, getSecret(c.secret.Name))
+		}
+		rotated := getSecret(target).Data[corev1.TLSCertKey]
+		sync()
+		Expect(getSecret(target).Data[corev1.TLSCertKey]).To(Equal(rotated))
+	})
+
+	It("should attribute a later scheduled refresh to the refresh", func() {
+		sync()
+		target := certs[0].TargetSecret.Name
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+		sync()
+
+		// move the target into its refresh window
+		clock.SetTime(clock.Now().Add(time.Hour))
+		Expect(cm.expireCertificate(context.TODO(), getSecret(target))).ToNot(BeNil())
+		waitForSecretInLister(cm, getSecret(target))
+		sync()
+
+		expectLastRotation(target, rotationReasonRefresh, clock.Now())
+	})
+
+	It("should refuse to rotate certificates of cert-manager.io", func() {
+		certs[0].Issuer = &cert.IssuerReference{Name: "vault"}
+
+		Expect(cm.ForceRotate(certs[0])).To(MatchError(ContainSubstring("cert-manager.io issuer vault")))
+	})
+})
@@ -0,0 +1,186 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annTypeMigrationOf marks the backup of a secret migrated to kubernetes.io/tls, it names the secret
+	annTypeMigrationOf = "operator.maroonedpods.io/typeMigrationOf"
+	// typeMigrationSuffix is appended to the name of a migrated secret for its backup
+	typeMigrationSuffix = "-type-migration"
+	// typeMigrationKey is the key of the backup holding the migrated secret
+	typeMigrationKey = "secret"
+)
+
+// newTLSSecretData returns the keys the API server requires in a kubernetes.io/tls secret
+func newTLSSecretData() map[string][]byte {
+	return map[string][]byte{
+		corev1.TLSCertKey:       {},
+		corev1.TLSPrivateKeyKey: {},
+	}
+}
+
+// isManagedSecret returns whether the secret was written by the cert manager
+func isManagedSecret(secret *corev1.Secret) bool {
+	if _, ok := secret.Annotations[annCertConfig]; ok {
+		return true
+	}
+	if _, ok := secret.Annotations[certrotation.CertificateNotAfterAnnotation]; ok {
+		return true
+	}
+	if _, ok := secret.Annotations[annKeySecretOf]; ok {
+		return true
+	}
+	if _, ok := secret.Annotations[annCanaryOf]; ok {
+		return true
+	}
+	return hasLegacyAnnotations(secret)
+}
+
+// ensureSecretType migrates a managed Opaque secret to kubernetes.io/tls, the type is immutable
+// so the secret is recreated with the same data, annotations and labels. The migrated secret is
+// backed up first, a secret lost between the delete and the create is restored from the backup by
+// the next sync.
+func (cm *certManager) ensureSecretType(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	if secret.Type == corev1.SecretTypeTLS {
+		return secret, nil
+	}
+	if secret.Type != corev1.SecretTypeOpaque && secret.Type != "" {
+		return nil, fmt.Errorf("secret %s/%s has type %s, expected %s", secret.Namespace, secret.Name, secret.Type, corev1.SecretTypeTLS)
+	}
+	if !isManagedSecret(secret) {
+		return nil, fmt.Errorf("secret %s/%s of type %s is not managed by the operator, refusing to migrate it to %s", secret.Namespace, secret.Name, secret.Type, corev1.SecretTypeTLS)
+	}
+
+	migrated := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            secret.Name,
+			Namespace:       secret.Namespace,
+			Labels:          secret.Labels,
+			Annotations:     secret.Annotations,
+			OwnerReferences: secret.OwnerReferences,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: newTLSSecretData(),
+	}
+	for key, value := range secret.Data {
+		migrated.Data[key] = value
+	}
+
+	log.Info("Migrating secret to type kubernetes.io/tls", "secret", secret.Name, "namespace", secret.Namespace)
+	if err := cm.backupMigratedSecret(ctx, migrated); err != nil {
+		return nil, fmt.Errorf("failed to back up secret %s/%s before the type migration: %w", secret.Namespace, secret.Name, err)
+	}
+
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(secret.Namespace)
+	// don't delete a secret that changed since it was read
+	preconditions := &metav1.Preconditions{UID: &secret.UID}
+	if secret.ResourceVersion != "" {
+		preconditions.ResourceVersion = &secret.ResourceVersion
+	}
+	if err := client.Delete(ctx, secret.Name, metav1.DeleteOptions{Preconditions: preconditions}); err != nil {
+		return nil, err
+	}
+
+	created, err := cm.createMigratedSecret(ctx, migrated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recreate secret %s/%s after deleting it for the type migration, the next sync restores it: %w", secret.Namespace, secret.Name, err)
+	}
+
+	cm.eventRecorder.Eventf("SecretTypeMigrated", "Recreated secret %s/%s with type %s", secret.Namespace, secret.Name, corev1.SecretTypeTLS)
+	return created, nil
+}
+
+// backupMigratedSecret writes the secret into its backup, an older backup is replaced
+func (cm *certManager) backupMigratedSecret(ctx context.Context, migrated *corev1.Secret) error {
+	data, err := json.Marshal(migrated)
+	if err != nil {
+		return err
+	}
+	backup := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            migrated.Name + typeMigrationSuffix,
+			Namespace:       migrated.Namespace,
+			Annotations:     map[string]string{annTypeMigrationOf: migrated.Name},
+			OwnerReferences: migrated.OwnerReferences,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{typeMigrationKey: data},
+	}
+
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(migrated.Namespace)
+	_, err = client.Create(ctx, backup, metav1.CreateOptions{})
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := client.Get(ctx, backup.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		backup.ResourceVersion = current.ResourceVersion
+		_, err = client.Update(ctx, backup, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// createMigratedSecret creates the migrated secret, retrying the failures, and deletes its backup
+func (cm *certManager) createMigratedSecret(ctx context.Context, migrated *corev1.Secret) (*corev1.Secret, error) {
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(migrated.Namespace)
+	var created *corev1.Secret
+	// a secret created meanwhile isn't overwritten
+	err := retry.OnError(retry.DefaultBackoff, func(err error) bool { return !errors.IsAlreadyExists(err) }, func() (err error) {
+		created, err = client.Create(ctx, migrated, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Delete(ctx, migrated.Name+typeMigrationSuffix, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		log.Info("Failed to delete the backup of the migrated secret", "secret", migrated.Name, "namespace", migrated.Namespace, "error", err.Error())
+	}
+	return created, nil
+}
+
+// restoreMigratedSecret recreates a secret lost in the middle of its type migration from its backup,
+// nil if it has no backup
+func (cm *certManager) restoreMigratedSecret(ctx context.Context, template *corev1.Secret) (*corev1.Secret, error) {
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(template.Namespace)
+	backup, err := client.Get(ctx, template.Name+typeMigrationSuffix, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if backup.Annotations[annTypeMigrationOf] != template.Name {
+		return nil, nil
+	}
+
+	migrated := &corev1.Secret{}
+	if err := json.Unmarshal(backup.Data[typeMigrationKey], migrated); err != nil {
+		log.Info("Ignoring invalid backup of a migrated secret", "secret", backup.Name, "namespace", backup.Namespace, "error", err.Error())
+		return nil, nil
+	}
+	migrated.Name, migrated.Namespace = template.Name, template.Namespace
+
+	log.Info("Restoring the secret lost in its type migration", "secret", template.Name, "namespace", template.Namespace)
+	created, err := cm.createMigratedSecret(ctx, migrated)
+	if err != nil {
+		return nil, err
+	}
+	cm.eventRecorder.Eventf("SecretTypeMigrated", "Restored secret %s/%s with type %s", template.Namespace, template.Name, corev1.SecretTypeTLS)
+	return created, nil
+}
@@ -0,0 +1,225 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("secret type tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// replaces the secret with an Opaque copy, as written by previous versions of the operator
+	makeOpaque := func(name string) *corev1.Secret {
+		secret := getSecret(name)
+		Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})).To(Succeed())
+		opaque := secret.DeepCopy()
+		opaque.Type = corev1.SecretTypeOpaque
+		opaque, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), opaque, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, opaque)
+		// the annotations and the data did not change, wait for the type as well
+		Eventually(func() corev1.SecretType {
+			listers := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}]
+			secret, err := listers.secretLister.Secrets(namespace).Get(name)
+			if err != nil {
+				return ""
+			}
+			return secret.Type
+		}, 5*time.Second, 100*time.Millisecond).Should(Equal(corev1.SecretTypeOpaque))
+		return opaque
+	}
+
+	countActions := func(verb string) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == verb && action.GetResource().Resource == "secrets" {
+				count++
+			}
+		}
+		return count
+	}
+
+	migrationEvents := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == "SecretTypeMigrated" {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	// fails the next creates of the secret, all of them if count is negative
+	failCreates := func(name string, count int) {
+		client.PrependReactor("create", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.(testingclient.CreateAction).GetObject().(*corev1.Secret).Name != name || count == 0 {
+				return false, nil, nil
+			}
+			count--
+			return true, nil, errors.New("etcdserver: request timed out")
+		})
+	}
+
+	expectNoBackups := func(names ...string) {
+		for _, name := range names {
+			_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name+typeMigrationSuffix, metav1.GetOptions{})
+			ExpectWithOffset(1, apierrors.IsNotFound(err)).To(BeTrue(), "backup of %s", name)
+		}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should create the secrets with the tls type", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "secrets" {
+				Expect(create.GetObject().(*corev1.Secret).Type).To(Equal(corev1.SecretTypeTLS))
+			}
+		}
+		Expect(countActions("delete")).To(BeZero())
+		Expect(getSecret(signerName).Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(getSecret(util.SecretResourceName).Type).To(Equal(corev1.SecretTypeTLS))
+	})
+
+	It("should migrate managed Opaque secrets preserving the key pairs", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		signer := makeOpaque(signerName)
+		target := makeOpaque(util.SecretResourceName)
+		client.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		for _, before := range []*corev1.Secret{signer, target} {
+			after := getSecret(before.Name)
+			Expect(after.Type).To(Equal(corev1.SecretTypeTLS))
+			Expect(after.Data[corev1.TLSCertKey]).To(Equal(before.Data[corev1.TLSCertKey]))
+			Expect(after.Data[corev1.TLSPrivateKeyKey]).To(Equal(before.Data[corev1.TLSPrivateKeyKey]))
+			Expect(after.Annotations).To(Equal(before.Annotations))
+			Expect(after.Labels).To(Equal(before.Labels))
+		}
+		// the secrets and their backups
+		Expect(countActions("delete")).To(Equal(4))
+		Expect(migrationEvents()).To(Equal(2))
+		expectNoBackups(signerName, util.SecretResourceName)
+	})
+
+	It("should retry the create of the migrated secret", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		target := makeOpaque(util.SecretResourceName)
+		failCreates(util.SecretResourceName, 1)
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		after := getSecret(util.SecretResourceName)
+		Expect(after.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(after.Data[corev1.TLSPrivateKeyKey]).To(Equal(target.Data[corev1.TLSPrivateKeyKey]))
+		expectNoBackups(util.SecretResourceName)
+	})
+
+	It("should restore a secret whose create failed from its backup", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		target := makeOpaque(util.SecretResourceName)
+		failCreates(util.SecretResourceName, -1)
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ContainSubstring("the next sync restores it")))
+		_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		backup := getSecret(util.SecretResourceName + typeMigrationSuffix)
+		Expect(backup.Annotations[annTypeMigrationOf]).To(Equal(util.SecretResourceName))
+
+		client.ReactionChain = client.ReactionChain[1:]
+		Eventually(func() bool {
+			listers := cm.(*certManager).listerMap[clusterNamespace{namespace: namespace}]
+			_, err := listers.secretLister.Secrets(namespace).Get(util.SecretResourceName)
+			return apierrors.IsNotFound(err)
+		}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		after := getSecret(util.SecretResourceName)
+		Expect(after.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(after.Data[corev1.TLSCertKey]).To(Equal(target.Data[corev1.TLSCertKey]))
+		Expect(after.Data[corev1.TLSPrivateKeyKey]).To(Equal(target.Data[corev1.TLSPrivateKeyKey]))
+		Expect(after.Annotations).To(Equal(target.Annotations))
+		expectNoBackups(util.SecretResourceName)
+	})
+
+	It("should not migrate secrets of the tls type again", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		waitForSecretInLister(cm, getSecret(util.SecretResourceName))
+		client.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(countActions("delete")).To(BeZero())
+		Expect(migrationEvents()).To(BeZero())
+	})
+
+	It("should refuse to touch an unmanaged Opaque secret with the same name", func() {
+		unmanaged := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: util.SecretResourceName, Namespace: namespace},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"password": []byte("hunter2")},
+		}
+		unmanaged, err := client.CoreV1().Secrets(namespace).Create(context.TODO(), unmanaged, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, unmanaged)
+		client.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ContainSubstring("is not managed by the operator")))
+
+		Expect(getSecret(util.SecretResourceName)).To(Equal(unmanaged))
+		Expect(countActions("delete")).To(BeZero())
+		for _, action := range client.Actions() {
+			if update, ok := action.(testingclient.UpdateAction); ok && action.GetResource().Resource == "secrets" {
+				Expect(update.GetObject().(*corev1.Secret).Name).ToNot(Equal(util.SecretResourceName))
+			}
+		}
+	})
+})
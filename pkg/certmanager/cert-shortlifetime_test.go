@@ -0,0 +1,207 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("short lifetime tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		clock  *clocktesting.FakeClock
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	// the lifetimes of the e2e environment
+	signerConfig := cert.CertificateConfig{Lifetime: 10 * time.Minute, Refresh: 8 * time.Minute}
+	targetConfig := cert.CertificateConfig{Lifetime: 5 * time.Minute, Refresh: 4 * time.Minute}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// writes of the sync, the events aren't counted
+	writes := func(sync func()) int {
+		before := len(client.Actions())
+		sync()
+		count := 0
+		for _, action := range client.Actions()[before:] {
+			switch action.GetVerb() {
+			case "create", "update", "patch", "delete":
+				if action.GetResource().Resource != "events" {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	// syncs once the minimum interval elapsed and waits for the listers to catch up with the writes
+	sync := func() {
+		clock.Step(cm.minSyncInterval)
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		waitForSecretInLister(cm, getSecret(cert.ServerSignerSecretName))
+		waitForSecretInLister(cm, getSecret(cert.ServerCertSecretName))
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.syncDebounce = defaultSyncDebounce
+		cm.minSyncInterval = defaultMinSyncInterval
+		clock = clocktesting.NewFakeClock(time.Now())
+		cm.clock = clock
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].SignerConfig = signerConfig
+		certs[0].TargetConfig = targetConfig
+		Expect(certs[0].Validate()).To(Succeed())
+		sync()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should rotate each certificate once per period", func() {
+		for period := 0; period < 3; period++ {
+			// library-go checks the validity against the wall clock
+			for _, aged := range []struct {
+				name   string
+				config cert.CertificateConfig
+			}{{cert.ServerSignerSecretName, signerConfig}, {cert.ServerCertSecretName, targetConfig}} {
+				secret, err := certtest.IntoRefreshWindow(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: aged.name}, aged.config)
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+			signers := map[string]bool{string(getSecret(cert.ServerSignerSecretName).Data[corev1.TLSCertKey]): true}
+			targets := map[string]bool{string(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey]): true}
+
+			var syncWrites []int
+			for i := 0; i < 5; i++ {
+				syncWrites = append(syncWrites, writes(sync))
+				signers[string(getSecret(cert.ServerSignerSecretName).Data[corev1.TLSCertKey])] = true
+				targets[string(getSecret(cert.ServerCertSecretName).Data[corev1.TLSCertKey])] = true
+			}
+			Expect(signers).To(HaveLen(2), "period %d", period)
+			Expect(targets).To(HaveLen(2), "period %d", period)
+			Expect(syncWrites[0]).ToNot(BeZero())
+			// the sync after the rotation may still catch up with the events of its writes
+			Expect(syncWrites[2:]).To(HaveEach(BeZero()), "period %d", period)
+		}
+	})
+
+	It("should hint the refresh of a lifetime shorter than the resync", func() {
+		sync()
+		Expect(cm.NextRefreshIn()).To(BeNumerically("~", targetConfig.Refresh, 30*time.Second))
+	})
+
+	It("should throttle the syncs of changed objects within the minimum interval", func() {
+		sync()
+		secret := getSecret(cert.ServerCertSecretName)
+		secret.Annotations["edited"] = "true"
+		secret, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+
+		before := len(client.Actions())
+		for i := 0; i < 20; i++ {
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		}
+		Expect(client.Actions()[before:]).To(BeEmpty())
+		// the skipped sync is due once the interval elapsed
+		Expect(cm.NextRefreshIn()).To(BeNumerically("<=", defaultMinSyncInterval))
+
+		before = len(client.Actions())
+		sync()
+		Expect(client.Actions()[before:]).ToNot(BeEmpty())
+	})
+
+	It("should not throttle the sync after a forced rotation", func() {
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+		before := len(client.Actions())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(client.Actions()[before:]).ToNot(BeEmpty())
+	})
+
+	It("should not throttle changed definitions", func() {
+		before := len(client.Actions())
+		certs[0].TargetExtraSANs = []string{"maroonedpods.example.com"}
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(client.Actions()[before:]).ToNot(BeEmpty())
+	})
+
+	It("should not throttle when disabled", func() {
+		cm.minSyncInterval = 0
+		cm.syncDebounce = 0
+		before := len(client.Actions())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(client.Actions()[before:]).ToNot(BeEmpty())
+	})
+
+	DescribeTable("should validate the refresh window", func(config cert.CertificateConfig, expected string) {
+		config.ResolveRefresh()
+		cd := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})[0]
+		cd.TargetConfig = config
+		err := cd.Validate()
+		if expected == "" {
+			Expect(err).ToNot(HaveOccurred())
+			return
+		}
+		Expect(err).To(MatchError(cert.ErrInvalidDefinition))
+		Expect(err).To(MatchError(ContainSubstring(expected)))
+	},
+		Entry("of the shortest lifetime", cert.CertificateConfig{Lifetime: cert.MinLifetime, Refresh: 4 * time.Minute}, ""),
+		Entry("of a percent of a short lifetime", cert.CertificateConfig{Lifetime: 10 * time.Minute, RefreshPercent: 50}, ""),
+		Entry("of a lifetime too short", cert.CertificateConfig{Lifetime: 4 * time.Minute, Refresh: 3 * time.Minute}, "shorter than 5m0s"),
+		Entry("larger than the lifetime", cert.CertificateConfig{Lifetime: 10 * time.Minute, Refresh: -time.Minute}, "larger than the Lifetime"),
+		Entry("as large as the lifetime", cert.CertificateConfig{Lifetime: 10 * time.Minute}, "larger than the Lifetime"),
+		Entry("of a small percent of a short lifetime", cert.CertificateConfig{Lifetime: 10 * time.Minute, RefreshPercent: 5}, "rotate continuously"),
+	)
+
+	It("should reject a short lifetime in the CR", func() {
+		percent := int32(99)
+		_, err := cert.DefinitionsFromCertConfig(namespace, &v1alpha1.MaroonedPodsCertConfig{
+			Server: &v1alpha1.CertConfig{Duration: durationPtr("10m"), RenewBeforePercent: &percent},
+		})
+		Expect(err).To(MatchError(ContainSubstring("rotate continuously")))
+	})
+
+	DescribeTable("should parse the minimum sync interval", func(value string, expected time.Duration, valid bool) {
+		interval, err := minSyncInterval(value)
+		if !valid {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(interval).To(Equal(expected))
+	},
+		Entry("by default", "", defaultMinSyncInterval, true),
+		Entry("disabled", "0", time.Duration(0), true),
+		Entry("a duration", "1m", time.Minute, true),
+		Entry("negative", "-1s", time.Duration(0), false),
+		Entry("invalid", "some", time.Duration(0), false),
+	)
+})
@@ -0,0 +1,104 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annRecoverSigner set to true on a signer secret with a corrupted key pair recovers it
+	// right away instead of after signerRecoveryAttempts syncs
+	annRecoverSigner = "operator.maroonedpods.io/recover-signer"
+
+	// signerRecoveryAttempts is the number of consecutive syncs finding the key pair of a signer
+	// corrupted before it is replaced, a single bad read must not replace a healthy CA
+	signerRecoveryAttempts = 3
+
+	// the corrupted key pair of a recovered signer is kept under these keys for forensics
+	backupCertKey = corev1.TLSCertKey + ".bak"
+	backupKeyKey  = corev1.TLSPrivateKeyKey + ".bak"
+)
+
+// signerCorruption returns why the key pair of the signer secret can't be used to sign,
+// nil if it can or library-go didn't issue it yet
+func signerCorruption(secret *corev1.Secret) error {
+	if _, ok := secret.Annotations[certrotation.CertificateNotAfterAnnotation]; !ok {
+		return nil
+	}
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return err
+	}
+	if _, err := crypto.GetCAFromBytes(certPEM, keyPEM); err != nil {
+		return err
+	}
+	return nil
+}
+
+// recoverCorruptedSigner replaces a signer whose key pair can't be parsed or doesn't match, once it
+// was found corrupted in signerRecoveryAttempts consecutive syncs or annRecoverSigner is set. The
+// broken data is moved to the backup keys and the validity annotations are dropped, so library-go
+// issues a fresh CA, and the target is expired to be re-issued by it. The CA bundle gets the new CA
+// on the same sync, the corrupted CA is kept in it until it expires.
+func (cm *certManager) recoverCorruptedSigner(cd mpcerts.CertificateDefinition, secret *corev1.Secret) (*corev1.Secret, error) {
+	key := secret.Namespace + "/" + secret.Name
+	stored, err := cm.withStoredKeyPair(signerRef(cd), secret)
+	if err != nil {
+		return nil, err
+	}
+	corruption := signerCorruption(stored)
+	if corruption == nil {
+		delete(cm.signerCorruptions, key)
+		return secret, nil
+	}
+
+	if cm.signerCorruptions == nil {
+		cm.signerCorruptions = make(map[string]int)
+	}
+	cm.signerCorruptions[key]++
+	attempts := cm.signerCorruptions[key]
+	if attempts < signerRecoveryAttempts && secret.Annotations[annRecoverSigner] != "true" {
+		log.Info("The key pair of the signer secret is corrupted", "secret", secret.Name, "namespace", secret.Namespace, "attempt", attempts, "error", corruption.Error())
+		return nil, fmt.Errorf("key pair of signer secret %s is corrupted, replacing it after %d attempts: %w", key, signerRecoveryAttempts-attempts, corruption)
+	}
+
+	log.Info("Replacing the corrupted signer secret", "secret", secret.Name, "namespace", secret.Namespace, "error", corruption.Error())
+	cm.eventRecorder.Warningf("SignerRecovered", "The key pair of signer secret %s is corrupted, issuing a new CA and keeping the corrupted data under %s and %s: %v", key, backupCertKey, backupKeyKey, corruption)
+
+	updated := secret.DeepCopy()
+	if updated.Data == nil {
+		updated.Data = map[string][]byte{}
+	}
+	updated.Data[backupCertKey] = secret.Data[corev1.TLSCertKey]
+	updated.Data[backupKeyKey] = secret.Data[corev1.TLSPrivateKeyKey]
+	delete(updated.Data, corev1.TLSCertKey)
+	delete(updated.Data, corev1.TLSPrivateKeyKey)
+	delete(updated.Annotations, certrotation.CertificateNotAfterAnnotation)
+	delete(updated.Annotations, certrotation.CertificateNotBeforeAnnotation)
+	delete(updated.Annotations, annRecoverSigner)
+	updated, err = cm.coreClient(mpcerts.ManagementCluster).Secrets(updated.Namespace).Update(context.TODO(), updated, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	delete(cm.signerCorruptions, key)
+	cm.setRotationReason(updated, rotationReasonSignerRecovered)
+
+	cm.expireRecoveredTarget(cd)
+	return updated, nil
+}
+
+// expireRecoveredTarget forces the rotation of the target of a recovered signer, the corrupted CA
+// stays in the bundle so library-go wouldn't re-issue it before its refresh
+func (cm *certManager) expireRecoveredTarget(cd mpcerts.CertificateDefinition) {
+	if cd.TargetSecret != nil {
+		cm.forceRotation(cd.TargetSecret, rotationReasonSignerRecovered)
+	}
+}
@@ -0,0 +1,183 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("signer recovery tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	getSecret := func(name string) *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	updateSigner := func(mutate func(secret *corev1.Secret)) *corev1.Secret {
+		secret := getSecret(signerName)
+		mutate(secret)
+		secret, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		return secret
+	}
+
+	corruptSigner := func() *corev1.Secret {
+		secret, err := certtest.CorruptKey(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: signerName})
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, secret)
+		return secret
+	}
+
+	recoveryEvents := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == "SignerRecovered" {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	bundleSize := func() int {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), util.SignerBundleResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM([]byte(configMap.Data[selfManagedBundleKey]))
+		Expect(err).ToNot(HaveOccurred())
+		return len(certs)
+	}
+
+	// expects the signer to be replaced and the target to be issued by the new signer
+	expectRecovered := func(corrupted *corev1.Secret) {
+		signer := getSecret(signerName)
+		Expect(signer.Data[backupCertKey]).To(Equal(corrupted.Data[corev1.TLSCertKey]))
+		Expect(signer.Data[backupKeyKey]).To(Equal(corrupted.Data[corev1.TLSPrivateKeyKey]))
+		Expect(signer.Annotations).ToNot(HaveKey(annRecoverSigner))
+		ca, err := crypto.GetCAFromBytes(signer.Data[corev1.TLSCertKey], signer.Data[corev1.TLSPrivateKeyKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(signer.Annotations[annLastRotationReason]).To(Equal(rotationReasonSignerRecovered))
+
+		target := getSecret(util.SecretResourceName)
+		Expect(target.Annotations[certrotation.CertificateIssuer]).To(Equal(ca.Config.Certs[0].Subject.CommonName))
+		Expect(target.Annotations[annLastRotationReason]).To(Equal(rotationReasonSignerRecovered))
+		Expect(bundleSize()).To(Equal(2))
+		Expect(recoveryEvents()).To(Equal(1))
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should replace a signer with a truncated key after the retries", func() {
+		corrupted := corruptSigner()
+
+		for i := 1; i < signerRecoveryAttempts; i++ {
+			Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ContainSubstring("corrupted")))
+			Expect(getSecret(signerName).Data).To(Equal(corrupted.Data))
+			Expect(recoveryEvents()).To(BeZero())
+		}
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		expectRecovered(corrupted)
+
+		// the new signer is healthy
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(recoveryEvents()).To(Equal(1))
+	})
+
+	It("should replace a signer whose key doesn't match the certificate", func() {
+		other, err := crypto.MakeSelfSignedCAConfigForDuration("other", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		_, otherKey, err := other.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		corrupted := updateSigner(func(secret *corev1.Secret) {
+			secret.Data[corev1.TLSPrivateKeyKey] = otherKey
+		})
+
+		for i := 1; i < signerRecoveryAttempts; i++ {
+			Expect(cm.Sync(context.TODO(), newCerts())).ToNot(Succeed())
+		}
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		expectRecovered(corrupted)
+	})
+
+	It("should replace a corrupted signer right away with the annotation", func() {
+		corruptSigner()
+		corrupted := updateSigner(func(secret *corev1.Secret) {
+			secret.Annotations[annRecoverSigner] = "true"
+		})
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		expectRecovered(corrupted)
+	})
+
+	It("should not replace a healthy signer with the annotation", func() {
+		healthy := updateSigner(func(secret *corev1.Secret) {
+			secret.Annotations[annRecoverSigner] = "true"
+		})
+
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(getSecret(signerName).Data[corev1.TLSCertKey]).To(Equal(healthy.Data[corev1.TLSCertKey]))
+		Expect(recoveryEvents()).To(BeZero())
+	})
+
+	It("should start over the retries once the signer is healthy again", func() {
+		healthy := getSecret(signerName)
+		corruptSigner()
+		for i := 1; i < signerRecoveryAttempts; i++ {
+			Expect(cm.Sync(context.TODO(), newCerts())).ToNot(Succeed())
+		}
+
+		// restored from a backup, e.g. the corruption was a bad read
+		updateSigner(func(secret *corev1.Secret) {
+			secret.Data = healthy.Data
+		})
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		corruptSigner()
+		Expect(cm.Sync(context.TODO(), newCerts())).ToNot(Succeed())
+		Expect(recoveryEvents()).To(BeZero())
+		Expect(bytes.Equal(getSecret(signerName).Data[corev1.TLSCertKey], healthy.Data[corev1.TLSCertKey])).To(BeTrue())
+	})
+})
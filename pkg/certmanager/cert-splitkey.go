@@ -0,0 +1,256 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annSplitKeySecret names the secret holding the key of a target secret, so the key can be
+	// merged back when the split is turned off
+	annSplitKeySecret = "operator.maroonedpods.io/splitKeySecret"
+	// annKeySecretOf marks the key secrets, it names their target secret
+	annKeySecretOf = "operator.maroonedpods.io/keySecretOf"
+	// labelPrivateKey marks the key secrets, so access to them can be restricted
+	labelPrivateKey = "operator.maroonedpods.io/private-key"
+)
+
+// splitKeySecretsGetter moves the key out of the target secret in the request that rotates it: the key
+// secret gets the new pair first, then the target the certificate, so the key secret never holds a
+// certificate the key doesn't match
+type splitKeySecretsGetter struct {
+	corev1client.SecretsGetter
+	cm *certManager
+	cd mpcerts.CertificateDefinition
+}
+
+func (cm *certManager) splitKeyClient(cd mpcerts.CertificateDefinition, client corev1client.SecretsGetter) corev1client.SecretsGetter {
+	if cd.SplitKeySecret == nil {
+		return client
+	}
+	return &splitKeySecretsGetter{SecretsGetter: client, cm: cm, cd: cd}
+}
+
+func (g *splitKeySecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &splitKeySecrets{
+		SecretInterface: g.SecretsGetter.Secrets(namespace),
+		getter:          g,
+	}
+}
+
+type splitKeySecrets struct {
+	corev1client.SecretInterface
+	getter *splitKeySecretsGetter
+}
+
+func (s *splitKeySecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	secret, err := s.getter.splitKey(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Create(ctx, secret, opts)
+}
+
+func (s *splitKeySecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	secret, err := s.getter.splitKey(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	return s.SecretInterface.Update(ctx, secret, opts)
+}
+
+// splitKey writes the pair of the target into the key secret and returns the target without the key
+func (g *splitKeySecretsGetter) splitKey(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	keyPEM := secret.Data[corev1.TLSPrivateKeyKey]
+	if len(keyPEM) == 0 {
+		return secret, nil
+	}
+
+	if err := g.cm.ensureKeySecret(ctx, g.cd, secret.Data[corev1.TLSCertKey], keyPEM); err != nil {
+		return nil, err
+	}
+
+	secret = secret.DeepCopy()
+	secret.Data[corev1.TLSPrivateKeyKey] = []byte{}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	// a renamed key secret is cleaned up by ensureSplitKey
+	if _, ok := secret.Annotations[annSplitKeySecret]; !ok {
+		secret.Annotations[annSplitKeySecret] = g.cd.SplitKeySecret.Name
+	}
+	return secret, nil
+}
+
+// ensureKeySecret writes the pair into the key secret of the definition
+func (cm *certManager) ensureKeySecret(ctx context.Context, cd mpcerts.CertificateDefinition, certPEM, keyPEM []byte) error {
+	template := cd.SplitKeySecret
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(template.Namespace)
+
+	labels := map[string]string{labelPrivateKey: "true"}
+	for k, v := range template.Labels {
+		labels[k] = v
+	}
+
+	current, err := client.Get(ctx, template.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        template.Name,
+				Labels:      labels,
+				Annotations: map[string]string{annKeySecretOf: cd.TargetSecret.Name},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if current.Type != corev1.SecretTypeTLS {
+		return fmt.Errorf("key secret %s/%s has type %s, expected %s", current.Namespace, current.Name, current.Type, corev1.SecretTypeTLS)
+	}
+	if current.Annotations[annKeySecretOf] != cd.TargetSecret.Name && current.Annotations[annKeySecretOf] != "" {
+		return fmt.Errorf("secret %s/%s holds the key of %s already", current.Namespace, current.Name, current.Annotations[annKeySecretOf])
+	}
+
+	updated := current.DeepCopy()
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	for k, v := range labels {
+		updated.Labels[k] = v
+	}
+	delete(updated.Labels, labelPreserved)
+	updated.Annotations[annKeySecretOf] = cd.TargetSecret.Name
+	updated.Data = map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM}
+
+	if !secretChanged(current, updated) {
+		return nil
+	}
+
+	_, err = client.Update(ctx, updated, metav1.UpdateOptions{})
+	return err
+}
+
+// ensureSplitKey moves the key of a target that was not rotated into the key secret, or back into the
+// target when the split was turned off. A key that is nowhere to be found re-issues the target.
+func (cm *certManager) ensureSplitKey(ctx context.Context, cd mpcerts.CertificateDefinition) error {
+	if cm.splitKeyConverged(cd) {
+		return nil
+	}
+
+	client := cm.coreClient(mpcerts.ManagementCluster).Secrets(cd.TargetSecret.Namespace)
+	// the target may just have been rotated, don't wait for the lister
+	target, err := client.Get(ctx, cd.TargetSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	certPEM := target.Data[corev1.TLSCertKey]
+	if len(certPEM) == 0 {
+		return nil
+	}
+
+	var desired, previous *corev1.Secret
+	if cd.SplitKeySecret != nil {
+		if desired, err = cm.getKeySecret(target.Namespace, cd.SplitKeySecret.Name); err != nil {
+			return err
+		}
+	}
+	if name := target.Annotations[annSplitKeySecret]; name != "" && (desired == nil || name != desired.Name) {
+		if previous, err = cm.getKeySecret(target.Namespace, name); err != nil {
+			return err
+		}
+		// never take or delete a secret that isn't the key secret of the target
+		if previous != nil && previous.Annotations[annKeySecretOf] != target.Name {
+			previous = nil
+		}
+	}
+
+	keyPEM := target.Data[corev1.TLSPrivateKeyKey]
+	for _, keySecret := range []*corev1.Secret{desired, previous} {
+		if len(keyPEM) == 0 && keySecret != nil && bytes.Equal(keySecret.Data[corev1.TLSCertKey], certPEM) {
+			keyPEM = keySecret.Data[corev1.TLSPrivateKeyKey]
+		}
+	}
+	if len(keyPEM) == 0 {
+		log.Info("The key of the target secret is lost, re-issuing it", "secret", target.Name, "namespace", target.Namespace)
+		cm.eventRecorder.Warningf("CertificateKeyLost", "The key of %s/%s is lost, re-issuing the certificate", target.Namespace, target.Name)
+		_, err := cm.expireCertificate(ctx, target)
+		return err
+	}
+
+	updated := target.DeepCopy()
+	if cd.SplitKeySecret != nil {
+		// the key secret first, the target never refers to a key secret without its key
+		if err := cm.ensureKeySecret(ctx, cd, certPEM, keyPEM); err != nil {
+			return err
+		}
+		updated.Data[corev1.TLSPrivateKeyKey] = []byte{}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annSplitKeySecret] = cd.SplitKeySecret.Name
+	} else {
+		updated.Data[corev1.TLSPrivateKeyKey] = keyPEM
+		delete(updated.Annotations, annSplitKeySecret)
+	}
+
+	if secretChanged(target, updated) {
+		log.Info("Moving the key of the target secret", "secret", target.Name, "namespace", target.Namespace, "split", cd.SplitKeySecret != nil)
+		if _, err := client.Update(ctx, updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if previous != nil {
+		if err := client.Delete(ctx, previous.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitKeyConverged checks with the listers whether the key is where the definition wants it
+func (cm *certManager) splitKeyConverged(cd mpcerts.CertificateDefinition) bool {
+	listers, ok := cm.listers()[clusterNamespace{namespace: cd.TargetSecret.Namespace}]
+	if !ok {
+		return false
+	}
+	lister := listers.secretLister.Secrets(cd.TargetSecret.Namespace)
+	target, err := lister.Get(cd.TargetSecret.Name)
+	if err != nil {
+		return false
+	}
+
+	name, split := target.Annotations[annSplitKeySecret]
+	if cd.SplitKeySecret == nil {
+		return !split
+	}
+	if name != cd.SplitKeySecret.Name || len(target.Data[corev1.TLSPrivateKeyKey]) > 0 {
+		return false
+	}
+	keySecret, err := lister.Get(name)
+	return err == nil && !isPreserved(keySecret) && bytes.Equal(keySecret.Data[corev1.TLSCertKey], target.Data[corev1.TLSCertKey])
+}
+
+// getKeySecret returns the key secret, nil if it doesn't exist
+func (cm *certManager) getKeySecret(namespace, name string) (*corev1.Secret, error) {
+	secret, err := cm.coreClient(mpcerts.ManagementCluster).Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return secret, err
+}
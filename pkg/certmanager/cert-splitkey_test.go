@@ -0,0 +1,181 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("split key secret tests", func() {
+	const (
+		namespace = "maroonedpods"
+		keyName   = "maroonedpods-server-key"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(split bool) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		if split {
+			certs[0].SplitKeySecret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: keyName}}
+		}
+		return certs
+	}
+
+	getSecret := func(name string) (*corev1.Secret, error) {
+		return client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+
+	sync := func(certs []cert.CertificateDefinition) {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, name := range []string{certs[0].SignerSecret.Name, certs[0].TargetSecret.Name} {
+			secret, err := getSecret(name)
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, secret)
+		}
+	}
+
+	// the key secret holds a valid pair of the certificate of the target, the target no key
+	expectSplit := func(targetName string) []byte {
+		target, err := getSecret(targetName)
+		Expect(err).ToNot(HaveOccurred())
+		keySecret, err := getSecret(keyName)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(target.Data[corev1.TLSPrivateKeyKey]).To(BeEmpty())
+		Expect(target.Annotations).To(HaveKeyWithValue(annSplitKeySecret, keyName))
+		Expect(keySecret.Data[corev1.TLSCertKey]).To(Equal(target.Data[corev1.TLSCertKey]))
+		_, err = tls.X509KeyPair(keySecret.Data[corev1.TLSCertKey], keySecret.Data[corev1.TLSPrivateKeyKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keySecret.Labels).To(HaveKeyWithValue(labelPrivateKey, "true"))
+		Expect(keySecret.Type).To(Equal(corev1.SecretTypeTLS))
+		return target.Data[corev1.TLSCertKey]
+	}
+
+	// index of the first write of the secret carrying the certificate
+	writeOf := func(name string, certPEM []byte) int {
+		for i, action := range client.Actions() {
+			var obj *corev1.Secret
+			switch a := action.(type) {
+			case testingclient.CreateAction:
+				obj, _ = a.GetObject().(*corev1.Secret)
+			case testingclient.UpdateAction:
+				obj, _ = a.GetObject().(*corev1.Secret)
+			}
+			if obj != nil && obj.Name == name && string(obj.Data[corev1.TLSCertKey]) == string(certPEM) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should keep the pair in lockstep across rotations", func() {
+		certs := newCerts(true)
+		sync(certs)
+		target := certs[0].TargetSecret.Name
+		previous := expectSplit(target)
+
+		for i := 0; i < 2; i++ {
+			client.ClearActions()
+			Expect(cm.ForceRotate(certs[0])).To(Succeed())
+
+			rotated := expectSplit(target)
+			Expect(rotated).ToNot(Equal(previous))
+			// the key secret gets the pair before the target gets the certificate
+			keyWrite, targetWrite := writeOf(keyName, rotated), writeOf(target, rotated)
+			Expect(keyWrite).ToNot(Equal(-1))
+			Expect(targetWrite).To(BeNumerically(">", keyWrite))
+			previous = rotated
+
+			for _, name := range []string{certs[0].SignerSecret.Name, target, keyName} {
+				secret, err := getSecret(name)
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+			sync(certs)
+			Expect(expectSplit(target)).To(Equal(rotated))
+		}
+	})
+
+	It("should split the key of an existing target without rotating it", func() {
+		sync(newCerts(false))
+		target, err := getSecret(newCerts(false)[0].TargetSecret.Name)
+		Expect(err).ToNot(HaveOccurred())
+
+		sync(newCerts(true))
+
+		Expect(expectSplit(target.Name)).To(Equal(target.Data[corev1.TLSCertKey]))
+		keySecret, err := getSecret(keyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(keySecret.Data[corev1.TLSPrivateKeyKey]).To(Equal(target.Data[corev1.TLSPrivateKeyKey]))
+	})
+
+	It("should merge the key back when the split is turned off", func() {
+		certs := newCerts(true)
+		sync(certs)
+		certPEM := expectSplit(certs[0].TargetSecret.Name)
+		keySecret, err := getSecret(keyName)
+		Expect(err).ToNot(HaveOccurred())
+
+		sync(newCerts(false))
+
+		target, err := getSecret(certs[0].TargetSecret.Name)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target.Data[corev1.TLSCertKey]).To(Equal(certPEM))
+		Expect(target.Data[corev1.TLSPrivateKeyKey]).To(Equal(keySecret.Data[corev1.TLSPrivateKeyKey]))
+		Expect(target.Annotations).ToNot(HaveKey(annSplitKeySecret))
+		_, err = getSecret(keyName)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should re-issue a target whose key is lost", func() {
+		certs := newCerts(true)
+		sync(certs)
+		certPEM := expectSplit(certs[0].TargetSecret.Name)
+		Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), keyName, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool {
+			_, err := cm.listerMap[clusterNamespace{namespace: namespace}].secretLister.Secrets(namespace).Get(keyName)
+			return errors.IsNotFound(err)
+		}).Should(BeTrue())
+
+		// expired by the first sync, rotated by the second
+		sync(certs)
+		sync(certs)
+
+		Expect(expectSplit(certs[0].TargetSecret.Name)).ToNot(Equal(certPEM))
+	})
+
+	It("should reject outputs that copy the key into the target", func() {
+		certs := newCerts(true)
+		certs[0].OutputFormats = []cert.OutputFormat{cert.OutputFormatCombinedPEM}
+
+		Expect(certs[0].Validate()).To(MatchError(cert.ErrInvalidDefinition))
+	})
+})
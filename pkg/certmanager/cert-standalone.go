@@ -0,0 +1,101 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// StandaloneCertManager is a CertManager run without a controller-runtime manager
+type StandaloneCertManager interface {
+	CertManager
+	// Start starts the informers of the managed namespaces and returns once their caches synced, Sync
+	// fails with ErrNotStarted before. The informers stop with the context, Start restarts them with
+	// a new one.
+	Start(ctx context.Context) error
+}
+
+// CertManagerOptions configures a StandaloneCertManager, the zero value manages the install
+// namespace only with the defaults of the operator
+type CertManagerOptions struct {
+	// AdditionalNamespaces are managed in addition to the install namespace
+	AdditionalNamespaces []string
+	// ExtClient writes the caBundle of the conversion webhooks, required by definitions with ConversionCRDs
+	ExtClient apiextensionsclient.Interface
+	// Client reads and writes the cert-manager.io Certificates, the ClusterTrustBundles, the APIServices
+	// and the routes, without it they are considered unavailable
+	Client client.Client
+	// CRReader finds the MaroonedPods CR the events are reported on without an operator pod or Deployment
+	CRReader client.Reader
+	// SyncDebounce is how long the outcome of a successful sync is reused, 0 disables the debounce
+	SyncDebounce time.Duration
+	// RotationJitter is the percentage of their refresh the rotations are spread over, 0 disables it
+	RotationJitter int
+	// MinSyncInterval is how long after a successful sync the syncs of the same definitions are skipped,
+	// even if their objects changed or a certificate is due, 0 disables it
+	MinSyncInterval time.Duration
+	// PersistHistory keeps the sync history and the audit of the generated CAs in configmaps of the
+	// install namespace for support bundles
+	PersistHistory bool
+	// PublishCertState publishes the state of the certificates without their key material in a configmap
+	// of the install namespace, for the admins who can't read the secrets
+	PublishCertState bool
+	// Tracer traces the syncs, they aren't traced when nil
+	Tracer trace.Tracer
+	// CertStore holds the private keys, they are in the secrets when nil
+	CertStore CertStore
+}
+
+// NewStandaloneCertManager creates a cert manager for the namespaces with the client, it is started with
+// Start instead of a controller-runtime manager
+func NewStandaloneCertManager(k8sClient kubernetes.Interface, installNamespace string, opts CertManagerOptions) (StandaloneCertManager, error) {
+	if installNamespace == "" {
+		return nil, fmt.Errorf("no install namespace")
+	}
+	if opts.SyncDebounce < 0 {
+		return nil, fmt.Errorf("the debounce window %s is negative", opts.SyncDebounce)
+	}
+	if opts.MinSyncInterval < 0 {
+		return nil, fmt.Errorf("the minimum sync interval %s is negative", opts.MinSyncInterval)
+	}
+	if opts.RotationJitter < 0 || opts.RotationJitter > maxRotationJitter {
+		return nil, fmt.Errorf("the rotation jitter %d%% is not between 0 and %d%%", opts.RotationJitter, maxRotationJitter)
+	}
+
+	cm := newCertManager(k8sClient, opts.CRReader, installNamespace, opts.AdditionalNamespaces...)
+	cm.extClient = opts.ExtClient
+	cm.client = opts.Client
+	cm.syncDebounce = opts.SyncDebounce
+	cm.rotationJitter = opts.RotationJitter
+	cm.minSyncInterval = opts.MinSyncInterval
+	if opts.PersistHistory {
+		cm.historyWriter = newCertHistoryWriter(k8sClient, installNamespace)
+		cm.caAuditWriter = newCAAuditWriter(k8sClient, installNamespace)
+	}
+	if opts.PublishCertState {
+		cm.stateWriter = newCertStateWriter(k8sClient, installNamespace)
+	}
+	if opts.Tracer != nil {
+		cm.tracer = opts.Tracer
+	}
+	if opts.CertStore != nil {
+		cm.certStore = opts.CertStore
+	}
+	return cm, nil
+}
+
+// kindAvailable reports whether the API server serves the kind, it doesn't without a client
+func (cm *certManager) kindAvailable(gvk schema.GroupVersionKind) (bool, error) {
+	if cm.client == nil {
+		return false, nil
+	}
+	return util.IsKindAvailable(cm.client.RESTMapper(), gvk)
+}
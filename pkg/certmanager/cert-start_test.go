@@ -0,0 +1,256 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("cert manager start tests", func() {
+	const namespace = "maroonedpods"
+
+	watches := func(client *fake.Clientset) int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "watch" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// informerGoroutines returns the ids of the goroutines running an informer, the informers of the
+	// previous tests may still be stopping
+	informerGoroutines := func() sets.String {
+		buf := make([]byte, 1<<20)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				buf = buf[:n]
+				break
+			}
+			buf = make([]byte, 2*len(buf))
+		}
+		ids := sets.NewString()
+		for _, stack := range strings.Split(string(buf), "\n\n") {
+			if strings.Contains(stack, "k8s.io/client-go/tools/cache.(*sharedIndexInformer).Run(") {
+				ids.Insert(strings.Fields(stack)[1])
+			}
+		}
+		return ids
+	}
+
+	It("should not start the informers again", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		before := informerGoroutines()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+		// the secrets, the configmaps are watched once a bundle is synced
+		Eventually(func() int { return watches(client) }, 5*time.Second, 100*time.Millisecond).Should(Equal(1))
+		listers := cm.listerMap[clusterNamespace{namespace: namespace}]
+		started := informerGoroutines().Difference(before)
+		Expect(started).To(HaveLen(1))
+
+		Expect(cm.Start(ctx)).To(Succeed())
+		Consistently(func() int { return watches(client) }, time.Second, 100*time.Millisecond).Should(Equal(1))
+		Consistently(func() sets.String { return informerGoroutines().Difference(before) }, time.Second, 100*time.Millisecond).Should(Equal(started))
+		Expect(cm.listerMap[clusterNamespace{namespace: namespace}]).To(BeIdenticalTo(listers))
+
+		cancel()
+		Eventually(func() sets.String { return informerGoroutines().Intersection(started) }, 5*time.Second, 100*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("should sync the caches before returning", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "existing"}}
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "existing"}}
+		cm := newCertManagerForTest(fake.NewSimpleClientset(secret, configMap), namespace).(*certManager)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		listers := cm.listerMap[clusterNamespace{namespace: namespace}]
+		Expect(listers).ToNot(BeNil())
+		_, err := listers.secretLister.Secrets(namespace).Get("existing")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listers.configMapLister).To(BeNil())
+
+		Expect(cm.startConfigMapLister(cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})[0])).To(Succeed())
+		_, err = cm.listerMap[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get("existing")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should fail when the context is done before the caches synced", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(cm.Start(ctx)).To(MatchError("could not sync informer cache"))
+		Expect(cm.listerMap).To(BeEmpty())
+	})
+
+	It("should not sync before the caches synced", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(MatchError(ErrNotStarted))
+	})
+
+	It("should restart the informers with the context of a new term", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		listers := cm.listerMap[clusterNamespace{namespace: namespace}]
+		cancel()
+		Expect(cm.Sync(context.TODO(), certs)).To(MatchError(ErrNotStarted))
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+		Expect(cm.listerMap[clusterNamespace{namespace: namespace}]).ToNot(BeIdenticalTo(listers))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		checkCerts(client, namespace, true)
+	})
+
+	// meant for the race detector
+	It("should sync while it restarts", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				if err := cm.Sync(context.TODO(), certs); err != nil {
+					Expect(errors.Is(err, ErrNotStarted) || errors.Is(err, context.Canceled)).To(BeTrue(), err.Error())
+				}
+			}
+		}()
+
+		cancel()
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+		Eventually(done, 30*time.Second).Should(BeClosed())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+	})
+
+	// meant for the race detector
+	It("should serve the listers while it restarts", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		stop := make(chan struct{})
+		done := make(chan struct{}, 2)
+		read := func(read func() error) {
+			defer GinkgoRecover()
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := read(); err != nil {
+					Expect(errors.Is(err, ErrNotStarted) || errors.Is(err, ErrNamespaceNotSynced) || errors.Is(err, context.Canceled)).To(BeTrue(), err.Error())
+				}
+			}
+		}
+		go read(func() error { return cm.Sync(context.TODO(), certs) })
+		go read(func() error {
+			_, err := cm.listersFor(clusterNamespace{namespace: namespace})
+			return err
+		})
+
+		for i := 0; i < 5; i++ {
+			cancel()
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.Start(ctx)).To(Succeed())
+		}
+		defer cancel()
+		close(stop)
+		Eventually(done, 30*time.Second).Should(Receive())
+		Eventually(done, 30*time.Second).Should(Receive())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+	})
+
+	It("should tell a namespace that is not synced yet from an unmanaged one", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+		key := clusterNamespace{namespace: namespace}
+		listers := cm.listers()[key]
+		cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+			delete(listerMap, key)
+		})
+
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(MatchError(ErrNamespaceNotSynced))
+		Expect(cm.rotationFailures).To(BeEmpty())
+		_, err = cm.listersFor(clusterNamespace{namespace: "unmanaged"})
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrNamespaceNotSynced)).To(BeFalse())
+
+		cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+			listerMap[key] = listers
+		})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+	})
+
+	It("should stop in the middle of a definition and complete it with the next sync", func() {
+		client := fake.NewSimpleClientset()
+		cm := newCertManagerForTest(client, namespace).(*certManager)
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		// the operator loses the leadership while the bundle is written, after the signer
+		client.PrependReactor("*", "configmaps", func(action testingclient.Action) (bool, pkgruntime.Object, error) {
+			if action.GetVerb() != "get" && action.GetVerb() != "list" && action.GetVerb() != "watch" {
+				cancel()
+			}
+			return false, nil, nil
+		})
+
+		err := cm.Sync(context.TODO(), certs)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		checkSecret(client, namespace, "maroonedpods-server", true)
+		checkSecret(client, namespace, util.SecretResourceName, false)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		Expect(cm.Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		checkCerts(client, namespace, true)
+	})
+})
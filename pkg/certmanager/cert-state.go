@@ -0,0 +1,184 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// CertStateConfigMapName is the configmap of the install namespace publishing the state of the managed
+	// certificates, for the admins auditing them who aren't allowed to read the secrets
+	CertStateConfigMapName = "maroonedpods-cert-state"
+	certStateKey           = "state.json"
+)
+
+// CertState is the public information about a managed object, it never has key material or certificates
+type CertState struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Role      ManagedCertRole `json:"role"`
+	// of the object in a hosted control plane topology, empty for the management cluster
+	Cluster mpcerts.Cluster `json:"cluster,omitempty"`
+	// of the certificate, the newest CA for a bundle
+	IssuerCN   string       `json:"issuerCN,omitempty"`
+	Serial     string       `json:"serial,omitempty"`
+	NotBefore  *metav1.Time `json:"notBefore,omitempty"`
+	NotAfter   *metav1.Time `json:"notAfter,omitempty"`
+	BundleSize int          `json:"bundleSize,omitempty"`
+	// of the signer and target certificates
+	LastRotationTime   *metav1.Time `json:"lastRotationTime,omitempty"`
+	LastRotationReason string       `json:"lastRotationReason,omitempty"`
+	NextRotationTime   *metav1.Time `json:"nextRotationTime,omitempty"`
+	// the configured lifetime and refresh of the signer and target certificates
+	Lifetime string `json:"lifetime,omitempty"`
+	Refresh  string `json:"refresh,omitempty"`
+
+	LastSyncSucceeded bool   `json:"lastSyncSucceeded"`
+	Suspended         string `json:"suspended,omitempty"`
+}
+
+// certStateSummary is the content of the state configmap, it has no timestamp of its own so it only
+// changes with the state
+type certStateSummary struct {
+	Certificates []CertState `json:"certificates"`
+}
+
+// certStateWriter publishes the state into the state configmap when it changed
+type certStateWriter struct {
+	client    kubernetes.Interface
+	namespace string
+	// content of the configmap as of the last write, empty until it was read or written
+	last string
+}
+
+func newCertStateWriter(client kubernetes.Interface, namespace string) *certStateWriter {
+	return &certStateWriter{client: client, namespace: namespace}
+}
+
+// certStateOf renders the state of the managed certificates from ListManagedCertificates
+func (cm *certManager) certStateOf(ctx context.Context) (certStateSummary, error) {
+	// the objects that can't be inspected are listed nonetheless, with what is known about them
+	managed, err := cm.ListManagedCertificates(ctx)
+	if err != nil && ctx.Err() != nil {
+		return certStateSummary{}, err
+	}
+	rotations, _ := cm.NextRotations(ctx)
+	configs := map[string]mpcerts.CertificateConfig{}
+	for _, cd := range cm.lastSyncedCerts() {
+		for _, c := range managedCertsOf(cd) {
+			configs[syncKey(secretRef(c.secret))] = c.config
+		}
+	}
+
+	summary := certStateSummary{Certificates: []CertState{}}
+	for _, m := range managed {
+		state := CertState{
+			Kind:               m.Ref.Kind,
+			Namespace:          m.Ref.Namespace,
+			Name:               m.Ref.Name,
+			Role:               m.Role,
+			Cluster:            m.Cluster,
+			IssuerCN:           m.IssuerCN,
+			Serial:             m.Serial,
+			NotBefore:          m.NotBefore,
+			NotAfter:           m.NotAfter,
+			BundleSize:         m.BundleSize,
+			LastRotationTime:   m.LastRotationTime,
+			LastRotationReason: m.LastRotationReason,
+			LastSyncSucceeded:  m.LastSyncSucceeded,
+			Suspended:          m.Suspended,
+		}
+		if rotation := rotations[types.NamespacedName{Namespace: m.Ref.Namespace, Name: m.Ref.Name}]; m.Ref.Kind == "Secret" && !rotation.IsZero() {
+			state.NextRotationTime = &metav1.Time{Time: rotation}
+		}
+		if config, ok := configs[syncKey(m.Ref)]; ok {
+			scc := newSerializedCertConfig(config)
+			state.Lifetime, state.Refresh = scc.Lifetime, scc.Refresh
+		}
+		summary.Certificates = append(summary.Certificates, state)
+	}
+	return summary, nil
+}
+
+// publishCertState writes the state of the managed certificates into the state configmap when it changed.
+// It only logs its errors, the state is informational and never fails a sync.
+func (cm *certManager) publishCertState() {
+	w := cm.stateWriter
+	if w == nil {
+		return
+	}
+	summary, err := cm.certStateOf(context.TODO())
+	if err != nil {
+		log.Error(err, "Failed to render the state of the certificates", "configMap", CertStateConfigMapName)
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		log.Error(err, "Failed to render the state of the certificates", "configMap", CertStateConfigMapName)
+		return
+	}
+	if err := w.write(string(data)); err != nil {
+		log.Error(err, "Failed to publish the state of the certificates", "configMap", CertStateConfigMapName)
+	}
+}
+
+func (w *certStateWriter) write(data string) error {
+	if data == w.last {
+		return nil
+	}
+
+	configMaps := w.client.CoreV1().ConfigMaps(w.namespace)
+	current, err := configMaps.Get(context.TODO(), CertStateConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CertStateConfigMapName,
+				Namespace: w.namespace,
+				Labels:    util.ResourceBuilder.WithCommonLabels(nil),
+			},
+			Data: map[string]string{certStateKey: data},
+		}, metav1.CreateOptions{})
+		if err == nil {
+			w.last = data
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// it may be up to date already, e.g. written before a restart of the operator
+	if current.Data[certStateKey] != data {
+		updated := current.DeepCopy()
+		updated.Data = map[string]string{certStateKey: data}
+		if _, err := configMaps.Update(context.TODO(), updated, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	w.last = data
+	return nil
+}
+
+// deleteCertState deletes the state configmap, the certificates it is about are gone
+func (cm *certManager) deleteCertState() error {
+	w := cm.stateWriter
+	if w == nil {
+		return nil
+	}
+	err := w.client.CoreV1().ConfigMaps(w.namespace).Delete(context.TODO(), CertStateConfigMapName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	w.last = ""
+	return nil
+}
@@ -0,0 +1,135 @@
+package certmanager
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("certificate state publication tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	// the content of the state configmap, checked to have no key material or certificates
+	getState := func() certStateSummary {
+		configMap, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), CertStateConfigMapName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		data := configMap.Data[certStateKey]
+		Expect(data).ToNot(ContainSubstring("-----BEGIN"))
+		Expect(data).ToNot(ContainSubstring("PRIVATE KEY"))
+
+		summary := certStateSummary{}
+		Expect(json.Unmarshal([]byte(data), &summary)).To(Succeed())
+		return summary
+	}
+
+	stateOf := func(summary certStateSummary, kind, name string) CertState {
+		for _, state := range summary.Certificates {
+			if state.Kind == kind && state.Name == name {
+				return state
+			}
+		}
+		Fail(kind + " " + name + " is not published")
+		return CertState{}
+	}
+
+	targetSerial := func() string {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certificates, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return certificates[0].SerialNumber.String()
+	}
+
+	// syncs until the state has the target in the secret, the listers may not have seen it yet
+	syncUntilPublished := func() certStateSummary {
+		serial := targetSerial()
+		Eventually(func() string {
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			return stateOf(getState(), "Secret", cert.ServerCertSecretName).Serial
+		}).Should(Equal(serial))
+		return getState()
+	}
+
+	configMapWrites := func() int {
+		writes := 0
+		for _, action := range client.Actions() {
+			if action.GetResource().Resource == "configmaps" && objectNameOf(action) == CertStateConfigMapName {
+				writes++
+			}
+		}
+		return writes
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.stateWriter = newCertStateWriter(client, namespace)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should publish the state of the certificates and follow a rotation", func() {
+		summary := syncUntilPublished()
+		Expect(summary.Certificates).To(HaveLen(3))
+
+		target := stateOf(summary, "Secret", cert.ServerCertSecretName)
+		Expect(target.Role).To(Equal(ManagedCertRoleTarget))
+		Expect(target.Namespace).To(Equal(namespace))
+		Expect(target.IssuerCN).ToNot(BeEmpty())
+		Expect(target.NotBefore).ToNot(BeNil())
+		Expect(target.NotAfter).ToNot(BeNil())
+		Expect(target.NextRotationTime).ToNot(BeNil())
+		Expect(target.NextRotationTime.Time.Before(target.NotAfter.Time)).To(BeTrue())
+		Expect(target.Lifetime).To(Equal(newSerializedCertConfig(certs[0].TargetConfig).Lifetime))
+		Expect(target.Refresh).To(Equal(newSerializedCertConfig(certs[0].TargetConfig).Refresh))
+		Expect(target.LastSyncSucceeded).To(BeTrue())
+		signer := stateOf(summary, "Secret", cert.ServerSignerSecretName)
+		Expect(signer.Lifetime).To(Equal(newSerializedCertConfig(certs[0].SignerConfig).Lifetime))
+		Expect(stateOf(summary, "ConfigMap", cert.CABundleConfigMapName).BundleSize).To(Equal(1))
+
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+		Expect(targetSerial()).ToNot(Equal(target.Serial))
+		rotated := stateOf(syncUntilPublished(), "Secret", cert.ServerCertSecretName)
+		Expect(rotated.LastRotationReason).To(Equal(rotationReasonForced))
+		Expect(rotated.NotBefore.Time.Before(target.NotBefore.Time)).To(BeFalse())
+	})
+
+	It("should only write the configmap when the state changed", func() {
+		syncUntilPublished()
+		client.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(configMapWrites()).To(BeZero())
+	})
+
+	It("should delete the configmap with the certificates", func() {
+		syncUntilPublished()
+		Expect(cm.Cleanup()).To(Succeed())
+		_, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), CertStateConfigMapName, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,238 @@
+package certmanager
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// KeyPairRole is the role of a key pair in its definition
+type KeyPairRole string
+
+const (
+	// KeyPairRoleSigner is the key pair of the CA signing the target
+	KeyPairRoleSigner KeyPairRole = "signer"
+	// KeyPairRoleTarget is the key pair of the serving or client certificate
+	KeyPairRoleTarget KeyPairRole = "target"
+)
+
+// KeyPairRef identifies a key pair of a definition
+type KeyPairRef struct {
+	Definition mpcerts.CertificateDefinition
+	Role       KeyPairRole
+	// of the secret of the role in the definition, it always holds the certificate
+	Namespace string
+	Name      string
+}
+
+// KeyPair is a PEM encoded certificate and its private key
+type KeyPair struct {
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// CertStore holds the key pairs of the signers and targets. The certificates, the bundles and the rotation
+// annotations are in the cluster whatever the store, it decides where the private keys live. The output
+// formats embedding the key of a target, and the split key, are only written when the key is in its secret.
+type CertStore interface {
+	// GetKeyPair returns the key pair of the ref, secret is the secret of the ref as in the cluster. It
+	// returns nil when the store has no key pair for the certificate of the secret.
+	GetKeyPair(ctx context.Context, ref KeyPairRef, secret *corev1.Secret) (*KeyPair, error)
+	// PutKeyPair stores the key pair of the ref and returns the secret to write, it is not modified
+	PutKeyPair(ctx context.Context, ref KeyPairRef, secret *corev1.Secret, pair *KeyPair) (*corev1.Secret, error)
+}
+
+// WithCertStore keeps the key pairs of the cert manager in the store, they are in the secrets by default
+func WithCertStore(cm CertManager, store CertStore) CertManager {
+	cm.(*certManager).certStore = store
+	return cm
+}
+
+func signerRef(cd mpcerts.CertificateDefinition) KeyPairRef {
+	return KeyPairRef{Definition: cd, Role: KeyPairRoleSigner, Namespace: cd.SignerSecret.Namespace, Name: cd.SignerSecret.Name}
+}
+
+func targetRef(cd mpcerts.CertificateDefinition) KeyPairRef {
+	return KeyPairRef{Definition: cd, Role: KeyPairRoleTarget, Namespace: cd.TargetSecret.Namespace, Name: cd.TargetSecret.Name}
+}
+
+// withStoredKeyPair returns the secret with the key pair of the store, the secret itself when it holds
+// the pair already or the store has none
+func (cm *certManager) withStoredKeyPair(ref KeyPairRef, secret *corev1.Secret) (*corev1.Secret, error) {
+	pair, err := cm.certStore.GetKeyPair(context.TODO(), ref, secret)
+	if err != nil || pair == nil {
+		return secret, err
+	}
+	if bytes.Equal(secret.Data[corev1.TLSCertKey], pair.CertPEM) && bytes.Equal(secret.Data[corev1.TLSPrivateKeyKey], pair.KeyPEM) {
+		return secret, nil
+	}
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.TLSCertKey] = pair.CertPEM
+	secret.Data[corev1.TLSPrivateKeyKey] = pair.KeyPEM
+	return secret, nil
+}
+
+// keyStoreClient puts the key pair the client writes into the secret of the ref into the store, and
+// reads it back with the secret
+func (cm *certManager) keyStoreClient(ref KeyPairRef, client corev1client.SecretsGetter) corev1client.SecretsGetter {
+	return &keyStoreSecretsGetter{SecretsGetter: client, cm: cm, ref: ref}
+}
+
+type keyStoreSecretsGetter struct {
+	corev1client.SecretsGetter
+	cm  *certManager
+	ref KeyPairRef
+}
+
+func (g *keyStoreSecretsGetter) Secrets(namespace string) corev1client.SecretInterface {
+	return &keyStoreSecrets{
+		SecretInterface: g.SecretsGetter.Secrets(namespace),
+		getter:          g,
+		namespace:       namespace,
+	}
+}
+
+type keyStoreSecrets struct {
+	corev1client.SecretInterface
+	getter    *keyStoreSecretsGetter
+	namespace string
+}
+
+func (s *keyStoreSecrets) Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Secret, error) {
+	secret, err := s.SecretInterface.Get(ctx, name, opts)
+	if err != nil || !s.stored(name) {
+		return secret, err
+	}
+	return s.getter.cm.withStoredKeyPair(s.getter.ref, secret)
+}
+
+func (s *keyStoreSecrets) Create(ctx context.Context, secret *corev1.Secret, opts metav1.CreateOptions) (*corev1.Secret, error) {
+	if !s.stored(secret.Name) {
+		return s.SecretInterface.Create(ctx, secret, opts)
+	}
+	toWrite, err := s.put(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.SecretInterface.Create(ctx, toWrite, opts)
+	if err != nil {
+		return nil, err
+	}
+	// library-go signs with what was written
+	return s.getter.cm.withStoredKeyPair(s.getter.ref, created)
+}
+
+func (s *keyStoreSecrets) Update(ctx context.Context, secret *corev1.Secret, opts metav1.UpdateOptions) (*corev1.Secret, error) {
+	if !s.stored(secret.Name) {
+		return s.SecretInterface.Update(ctx, secret, opts)
+	}
+	toWrite, err := s.put(ctx, secret)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.SecretInterface.Update(ctx, toWrite, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.getter.cm.withStoredKeyPair(s.getter.ref, updated)
+}
+
+func (s *keyStoreSecrets) stored(name string) bool {
+	return s.namespace == s.getter.ref.Namespace && name == s.getter.ref.Name
+}
+
+// put stores the key pair of the secret, a secret without a key is written as is
+func (s *keyStoreSecrets) put(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	keyPEM := secret.Data[corev1.TLSPrivateKeyKey]
+	if len(keyPEM) == 0 {
+		return secret, nil
+	}
+	pair := &KeyPair{CertPEM: secret.Data[corev1.TLSCertKey], KeyPEM: keyPEM}
+	return s.getter.cm.certStore.PutKeyPair(ctx, s.getter.ref, secret, pair)
+}
+
+// secretCertStore keeps the key pairs in the secrets of the definitions, it is the default
+type secretCertStore struct{}
+
+func (secretCertStore) GetKeyPair(_ context.Context, _ KeyPairRef, secret *corev1.Secret) (*KeyPair, error) {
+	if len(secret.Data[corev1.TLSCertKey]) == 0 {
+		return nil, nil
+	}
+	return &KeyPair{CertPEM: secret.Data[corev1.TLSCertKey], KeyPEM: secret.Data[corev1.TLSPrivateKeyKey]}, nil
+}
+
+func (secretCertStore) PutKeyPair(_ context.Context, _ KeyPairRef, secret *corev1.Secret, pair *KeyPair) (*corev1.Secret, error) {
+	if bytes.Equal(secret.Data[corev1.TLSCertKey], pair.CertPEM) && bytes.Equal(secret.Data[corev1.TLSPrivateKeyKey], pair.KeyPEM) {
+		return secret, nil
+	}
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.TLSCertKey] = pair.CertPEM
+	secret.Data[corev1.TLSPrivateKeyKey] = pair.KeyPEM
+	return secret, nil
+}
+
+// MemoryCertStore keeps the private keys in memory, the secrets only hold the certificates. The keys are
+// lost with the operator, so the signers are recovered and the targets re-issued after a restart; it is
+// meant for tests and as an example of an external store.
+type MemoryCertStore struct {
+	lock sync.Mutex
+	// by role/namespace/name of the secret
+	pairs map[string]KeyPair
+}
+
+// NewMemoryCertStore returns an empty MemoryCertStore
+func NewMemoryCertStore() *MemoryCertStore {
+	return &MemoryCertStore{pairs: map[string]KeyPair{}}
+}
+
+func memoryStoreKey(ref KeyPairRef) string {
+	return string(ref.Role) + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// GetKeyPair returns the stored pair of the certificate of the secret, the pair of a secret still holding
+// its key until it is rotated or written again
+func (s *MemoryCertStore) GetKeyPair(_ context.Context, ref KeyPairRef, secret *corev1.Secret) (*KeyPair, error) {
+	certPEM := secret.Data[corev1.TLSCertKey]
+	if len(certPEM) == 0 {
+		return nil, nil
+	}
+	if keyPEM := secret.Data[corev1.TLSPrivateKeyKey]; len(keyPEM) > 0 {
+		return &KeyPair{CertPEM: certPEM, KeyPEM: keyPEM}, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pair, ok := s.pairs[memoryStoreKey(ref)]
+	if !ok || !bytes.Equal(pair.CertPEM, certPEM) {
+		return nil, nil
+	}
+	return &KeyPair{CertPEM: pair.CertPEM, KeyPEM: pair.KeyPEM}, nil
+}
+
+// PutKeyPair keeps the pair and returns the secret without the key
+func (s *MemoryCertStore) PutKeyPair(_ context.Context, ref KeyPairRef, secret *corev1.Secret, pair *KeyPair) (*corev1.Secret, error) {
+	s.lock.Lock()
+	s.pairs[memoryStoreKey(ref)] = KeyPair{CertPEM: pair.CertPEM, KeyPEM: pair.KeyPEM}
+	s.lock.Unlock()
+
+	secret = secret.DeepCopy()
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.TLSCertKey] = pair.CertPEM
+	// the key stays, empty, in a kubernetes.io/tls secret
+	secret.Data[corev1.TLSPrivateKeyKey] = []byte{}
+	return secret, nil
+}
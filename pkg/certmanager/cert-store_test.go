@@ -0,0 +1,131 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+)
+
+var _ = Describe("certificate store tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		store  *MemoryCertStore
+		certs  []cert.CertificateDefinition
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		store = NewMemoryCertStore()
+		WithCertStore(cm, store)
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	getSecret := func(secret *corev1.Secret) *corev1.Secret {
+		current, err := client.CoreV1().Secrets(secret.Namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{})
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return current
+	}
+
+	// checks the cluster has the certificate and the store its key
+	checkStored := func(ref KeyPairRef, secret *corev1.Secret) {
+		ExpectWithOffset(1, secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+		ExpectWithOffset(1, secret.Data).To(HaveKeyWithValue(corev1.TLSPrivateKeyKey, BeEmpty()))
+		pair, err := store.GetKeyPair(context.TODO(), ref, secret)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, pair).ToNot(BeNil())
+		_, err = tls.X509KeyPair(pair.CertPEM, pair.KeyPEM)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	}
+
+	It("should keep the keys out of the secrets", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		for _, cd := range certs {
+			checkStored(signerRef(cd), getSecret(cd.SignerSecret))
+			checkStored(targetRef(cd), getSecret(cd.TargetSecret))
+		}
+		checkConfigMap(client, namespace, certs[0].CertBundleConfigmap.Name, true)
+	})
+
+	It("should sign with the stored key of the signer", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		signer := getSecret(certs[0].SignerSecret)
+		target := getSecret(certs[0].TargetSecret)
+		waitForSecretInLister(cm, signer)
+		waitForSecretInLister(cm, target)
+
+		// not mistaken for a corrupted signer
+		for i := 0; i < signerRecoveryAttempts; i++ {
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		}
+		Expect(getSecret(certs[0].SignerSecret).Data).To(Equal(signer.Data))
+
+		Expect(cm.ForceRotate(certs[0])).To(Succeed())
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		rotated := getSecret(certs[0].TargetSecret)
+		Expect(rotated.Data[corev1.TLSCertKey]).ToNot(Equal(target.Data[corev1.TLSCertKey]))
+		checkStored(targetRef(certs[0]), rotated)
+		Expect(getSecret(certs[0].SignerSecret).Data).To(Equal(signer.Data))
+	})
+
+	It("should serve the key of a secret that still holds it", func() {
+		ca, err := certtest.NewCA("in-cluster", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		certPEM, keyPEM, err := ca.Config.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: certs[0].SignerSecret.Name},
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		}
+
+		pair, err := store.GetKeyPair(context.TODO(), signerRef(certs[0]), secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pair).To(Equal(&KeyPair{CertPEM: certPEM, KeyPEM: keyPEM}))
+
+		// the stored key of another certificate isn't served
+		written, err := store.PutKeyPair(context.TODO(), signerRef(certs[0]), secret, pair)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written.Data[corev1.TLSPrivateKeyKey]).To(BeEmpty())
+		Expect(secret.Data[corev1.TLSPrivateKeyKey]).To(Equal(keyPEM))
+		written.Data[corev1.TLSCertKey] = []byte("another certificate")
+		pair, err = store.GetKeyPair(context.TODO(), signerRef(certs[0]), written)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pair).To(BeNil())
+	})
+
+	It("should keep the keys in the secrets by default", func() {
+		cm := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager)
+		Expect(cm.certStore).To(Equal(secretCertStore{}))
+
+		secret := &corev1.Secret{Data: map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")}}
+		stored, err := cm.withStoredKeyPair(signerRef(certs[0]), secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored).To(BeIdenticalTo(secret))
+		written, err := secretCertStore{}.PutKeyPair(context.TODO(), signerRef(certs[0]), secret, &KeyPair{CertPEM: []byte("cert"), KeyPEM: []byte("key")})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written).To(BeIdenticalTo(secret))
+	})
+})
@@ -0,0 +1,145 @@
+package certmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// CertRotationStuckError is returned when certificates are due for rotation but
+// the last rotation attempt of each of them failed
+type CertRotationStuckError struct {
+	// namespace/name of the certificate secrets
+	Certificates []string
+	Err          error
+}
+
+func (e *CertRotationStuckError) Error() string {
+	return fmt.Sprintf("rotation of certificates %s is stuck: %v", strings.Join(e.Certificates, ", "), e.Err)
+}
+
+func (e *CertRotationStuckError) Unwrap() error {
+	return e.Err
+}
+
+type managedCert struct {
+	secret *corev1.Secret
+	config mpcerts.CertificateConfig
+}
+
+func managedCertsOf(cd mpcerts.CertificateDefinition) []managedCert {
+	var certs []managedCert
+	if cd.SignerSecret != nil && !cd.External {
+		certs = append(certs, managedCert{secret: cd.SignerSecret, config: cd.SignerConfig})
+	}
+	if cd.TargetSecret != nil {
+		certs = append(certs, managedCert{secret: cd.TargetSecret, config: cd.TargetConfig})
+	}
+	return certs
+}
+
+// recordRotation keeps the outcome of the last rotation attempt of the certificates of the definition
+func (cm *certManager) recordRotation(cd mpcerts.CertificateDefinition, err error) {
+	if cm.rotationFailures == nil {
+		cm.rotationFailures = make(map[string]error)
+	}
+	for _, c := range managedCertsOf(cd) {
+		key := c.secret.Namespace + "/" + c.secret.Name
+		if err != nil {
+			cm.rotationFailures[key] = err
+		} else {
+			delete(cm.rotationFailures, key)
+		}
+	}
+}
+
+// checkStuckRotations refreshes the expiration and stuck gauges of every managed certificate and returns
+// a CertRotationStuckError wrapping syncErr if any of them is stuck
+func (cm *certManager) checkStuckRotations(certs []mpcerts.CertificateDefinition, syncErr error) error {
+	var stuck []string
+	for _, cd := range certs {
+		for _, c := range managedCertsOf(cd) {
+			key := c.secret.Namespace + "/" + c.secret.Name
+			failure, failed := cm.rotationFailures[key]
+			notBefore, notAfter, ok := cm.validityOf(c)
+			if ok {
+				certExpiration.WithLabelValues(c.secret.Namespace, c.secret.Name).Set(float64(notAfter.Unix()))
+			}
+			remaining, inRefreshWindow := remainingValidity(c.config, notBefore, notAfter, ok)
+			if !failed || !inRefreshWindow {
+				certRotationStuck.WithLabelValues(c.secret.Namespace, c.secret.Name).Set(0)
+				continue
+			}
+
+			certRotationStuck.WithLabelValues(c.secret.Namespace, c.secret.Name).Set(1)
+			log.Error(failure, "Certificate is due for rotation but the rotation keeps failing",
+				"secret", c.secret.Name, "namespace", c.secret.Namespace, "remainingValidity", fmt.Sprintf("%.2f", remaining))
+			stuck = append(stuck, key)
+		}
+	}
+
+	if len(stuck) == 0 {
+		return syncErr
+	}
+
+	sort.Strings(stuck)
+	stuckErr := &CertRotationStuckError{Certificates: stuck, Err: syncErr}
+	cm.eventRecorder.Warningf("CertRotationStuck", "%v", stuckErr)
+	return stuckErr
+}
+
+// validityOf returns the validity of the certificate in the lister
+func (cm *certManager) validityOf(c managedCert) (time.Time, time.Time, bool) {
+	listers, ok := cm.listers()[clusterNamespace{namespace: c.secret.Namespace}]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	secret, err := listers.secretLister.Secrets(c.secret.Namespace).Get(c.secret.Name)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return cm.certValidity(secret)
+}
+
+// remainingValidity returns the remaining validity of the certificate as a fraction of its
+// lifetime and whether it is inside its refresh window
+func remainingValidity(config mpcerts.CertificateConfig, notBefore, notAfter time.Time, ok bool) (float64, bool) {
+	if !ok || !notAfter.After(notBefore) {
+		return 0, false
+	}
+
+	lifetime := notAfter.Sub(notBefore)
+	remaining := float64(time.Until(notAfter)) / float64(lifetime)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// refreshed once the refresh period of the lifetime has elapsed
+	threshold := 1.0
+	if config.Lifetime > 0 {
+		threshold = 1 - float64(config.Refresh)/float64(config.Lifetime)
+	}
+	return remaining, remaining <= threshold
+}
+
+// certValidity reads the validity from the rotation annotations, or from tls.crt for
+// certificates not issued by library-go
+func (cm *certManager) certValidity(secret *corev1.Secret) (time.Time, time.Time, bool) {
+	notBefore, errBefore := time.Parse(time.RFC3339, secret.Annotations[certrotation.CertificateNotBeforeAnnotation])
+	notAfter, errAfter := time.Parse(time.RFC3339, secret.Annotations[certrotation.CertificateNotAfterAnnotation])
+	if errBefore == nil && errAfter == nil {
+		return notBefore, notAfter, true
+	}
+
+	parsed, err := cm.parseCerts(secret, corev1.TLSCertKey)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return parsed.notBefore, parsed.notAfter, true
+}
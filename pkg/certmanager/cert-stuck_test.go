@@ -0,0 +1,137 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("stuck rotation tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client      *fake.Clientset
+		cm          CertManager
+		cancel      context.CancelFunc
+		failUpdates bool
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		return cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	}
+
+	stuckGauge := func(name string) float64 {
+		var m dto.Metric
+		Expect(certRotationStuck.WithLabelValues(namespace, name).Write(&m)).To(Succeed())
+		return m.GetGauge().GetValue()
+	}
+
+	getTarget := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// moves the target close to its expiry
+	ageTarget := func() {
+		aged, err := certtest.SetValidity(context.TODO(), client, types.NamespacedName{Namespace: namespace, Name: util.SecretResourceName},
+			time.Now().Add(-23*time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		waitForSecretInLister(cm, aged)
+	}
+
+	BeforeEach(func() {
+		failUpdates = false
+		client = fake.NewSimpleClientset()
+		client.PrependReactor("*", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if failUpdates && (action.GetVerb() == "update" || action.GetVerb() == "patch") {
+				return true, nil, fmt.Errorf("admission webhook denied the request")
+			}
+			return false, nil, nil
+		})
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should not report healthy certificates as stuck", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		Expect(stuckGauge(util.SecretResourceName)).To(BeZero())
+		Expect(stuckGauge("maroonedpods-server-signer")).To(BeZero())
+	})
+
+	It("should not report a failed rotation outside the refresh window as stuck", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+
+		failUpdates = true
+		certs := newCerts()
+		// re-issued because of the config change, still far from expiry
+		certs[0].TargetConfig.Lifetime = 48 * time.Hour
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(HaveOccurred())
+
+		var stuckErr *CertRotationStuckError
+		Expect(goerrors.As(err, &stuckErr)).To(BeFalse())
+		Expect(stuckGauge(util.SecretResourceName)).To(BeZero())
+	})
+
+	It("should report a failing rotation in the refresh window until it succeeds", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+		ageTarget()
+
+		failUpdates = true
+		client.ClearActions()
+		err := cm.Sync(context.TODO(), newCerts())
+		Expect(err).To(HaveOccurred())
+
+		var stuckErr *CertRotationStuckError
+		Expect(goerrors.As(err, &stuckErr)).To(BeTrue())
+		Expect(stuckErr.Certificates).To(ConsistOf(namespace + "/" + util.SecretResourceName))
+		Expect(stuckErr.Error()).To(ContainSubstring("admission webhook denied the request"))
+		Expect(stuckGauge(util.SecretResourceName)).To(Equal(1.0))
+		Expect(stuckGauge("maroonedpods-server-signer")).To(BeZero())
+
+		var warned bool
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == "CertRotationStuck" {
+					warned = true
+				}
+			}
+		}
+		Expect(warned).To(BeTrue())
+
+		// still stuck on the next attempt
+		Expect(cm.Sync(context.TODO(), newCerts())).ToNot(Succeed())
+		Expect(stuckGauge(util.SecretResourceName)).To(Equal(1.0))
+
+		failUpdates = false
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(stuckGauge(util.SecretResourceName)).To(BeZero())
+	})
+})
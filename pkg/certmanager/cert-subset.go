@@ -0,0 +1,123 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// ErrNoFullSync is returned by SyncSubset until a Sync provided the definitions to select from
+var ErrNoFullSync = goerrors.New("no definitions were synced yet")
+
+// CertSelector selects the definitions of a SyncSubset, a definition matches if any of its fields does
+type CertSelector struct {
+	// the signer secrets of the definitions
+	SignerSecrets []types.NamespacedName
+	// the target secrets of the definitions
+	TargetSecrets []types.NamespacedName
+	// the namespaces of the signer, target or bundle of the definitions
+	Namespaces []string
+}
+
+func (s CertSelector) matches(cd mpcerts.CertificateDefinition) bool {
+	for _, nn := range s.SignerSecrets {
+		if cd.SignerSecret != nil && cd.SignerSecret.Namespace == nn.Namespace && cd.SignerSecret.Name == nn.Name {
+			return true
+		}
+	}
+	for _, nn := range s.TargetSecrets {
+		if cd.TargetSecret != nil && cd.TargetSecret.Namespace == nn.Namespace && cd.TargetSecret.Name == nn.Name {
+			return true
+		}
+	}
+	namespaces := sets.NewString(s.Namespaces...)
+	for _, object := range managedObjectsOf(cd) {
+		if object.Cluster == mpcerts.ManagementCluster && namespaces.Has(object.Ref.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectDefinitions returns the definitions the selector matches, in order
+func (s CertSelector) selectDefinitions(certs []mpcerts.CertificateDefinition) []mpcerts.CertificateDefinition {
+	var selected []mpcerts.CertificateDefinition
+	for _, cd := range certs {
+		if s.matches(cd) {
+			selected = append(selected, cd)
+		}
+	}
+	return selected
+}
+
+// SyncSubset syncs the definitions of the last Sync the selector matches. The state kept for the other
+// definitions is left alone: their results and history, the objects the debounce watches, the consumers
+// discovered and the cluster trust bundles, which only a Sync prunes. The outcome of the last Sync isn't
+// replaced by the one of a subset, a failed subset only drops the debounce of the next Sync.
+func (cm *certManager) SyncSubset(ctx context.Context, selector CertSelector) (err error) {
+	if !cm.started() {
+		return ErrNotStarted
+	}
+	cm.syncLock.Lock()
+	defer cm.syncLock.Unlock()
+	all := cm.lastSyncedCerts()
+	if all == nil {
+		return ErrNoFullSync
+	}
+	certs := selector.selectDefinitions(all)
+	if len(certs) == 0 {
+		log.V(1).Info("No definition matches the selector, nothing to sync", "selector", selector)
+		return nil
+	}
+
+	ctx, span := cm.tracer.Start(ctx, spanSync, trace.WithAttributes(attrDefinitions.Int(len(certs)), attrSubset.Bool(true)))
+	defer func() { endSpan(span, err) }()
+	ctx, endRetryBudget := withRetryBudget(ctx)
+	defer endRetryBudget()
+
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			cm.resetDebounce()
+		}
+		cm.reportAdoptions()
+		cm.nextRefresh = cm.nextRefreshIn(all)
+		cm.recordSubsetStatus()
+		cm.persistHistory()
+		// only for the gauge, the reasons are reported by the sync
+		_, _ = cm.NextRotations(context.TODO())
+		cm.publishCertState()
+		observeSync(start, err)
+	}()
+
+	cm.refreshTerminatingNamespaces()
+	cm.refreshAbsentNamespaces()
+	cm.refreshPreflight(certs)
+
+	errs, err := cm.syncDefinitions(ctx, certs)
+	if err != nil {
+		return err
+	}
+	if err := cm.verifyChains(ctx, certs); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cm.verifyWebhookCerts(certs); err != nil {
+		errs = append(errs, err)
+	}
+	return cm.checkStuckRotations(certs, utilerrors.NewAggregate(errs))
+}
+
+// recordSubsetStatus refreshes the namespaces of the status, its outcome stays the one of the last Sync
+func (cm *certManager) recordSubsetStatus() {
+	cm.statusLock.Lock()
+	defer cm.statusLock.Unlock()
+	cm.syncStatus.MissingPermissions = cm.missingPermissions()
+	cm.syncStatus.SuspendedNamespaces = cm.absentNamespaces.List()
+}
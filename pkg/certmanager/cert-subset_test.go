@@ -0,0 +1,170 @@
+package certmanager
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("subset sync tests", func() {
+	const (
+		namespace = "maroonedpods"
+		workloads = "workloads"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	serverTarget := types.NamespacedName{Namespace: namespace, Name: cert.ServerCertSecretName}
+
+	managedCert := func(ns, name string) ManagedCert {
+		managed, _ := cm.ListManagedCertificates(context.TODO())
+		for _, m := range managed {
+			if m.Ref.Kind == "Secret" && m.Ref.Namespace == ns && m.Ref.Name == name {
+				return m
+			}
+		}
+		Fail("the secret " + ns + "/" + name + " is not listed")
+		return ManagedCert{}
+	}
+
+	// deletes the secret and waits for the listers to see it gone
+	deleteSecret := func(ns, name string) {
+		Expect(client.CoreV1().Secrets(ns).Delete(context.TODO(), name, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() bool {
+			_, err := cm.listers()[clusterNamespace{namespace: ns}].secretLister.Secrets(ns).Get(name)
+			return errors.IsNotFound(err)
+		}).Should(BeTrue())
+	}
+
+	secretExists := func(ns, name string) bool {
+		_, err := client.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		addApplyReactor(client)
+		allowAccessReviews(client)
+		cm = newCertManager(client, nil, namespace, workloads)
+		cm.extClient = extfake.NewSimpleClientset()
+		cm.client = crfake.NewClientBuilder().Build()
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs = append(certs, cert.CertificateDefinition{
+			SignerSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-signer"}},
+			SignerConfig:        certs[0].SignerConfig,
+			CertBundleConfigmap: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-bundle"}},
+			TargetSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: workloads, Name: "workload-cert"}},
+			TargetConfig:        certs[0].TargetConfig,
+			TargetService:       &[]string{"workload"}[0],
+		})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should fail before a sync provided the definitions", func() {
+		Expect(cm.SyncSubset(context.TODO(), CertSelector{TargetSecrets: []types.NamespacedName{serverTarget}})).To(MatchError(ErrNoFullSync))
+	})
+
+	It("should only sync the selected definitions and keep the status of the others", func() {
+		certs[1].ExtendedKeyUsages = "bogus"
+		Expect(cm.Sync(context.TODO(), certs)).ToNot(Succeed())
+		workload := managedCert(workloads, "workload-cert")
+		Expect(workload.LastSyncError).To(ContainSubstring("bogus"))
+		status := cm.SyncStatus()
+
+		deleteSecret(namespace, cert.ServerCertSecretName)
+		client.ClearActions()
+		Expect(cm.SyncSubset(context.TODO(), CertSelector{Namespaces: []string{namespace}})).To(Succeed())
+		Expect(secretExists(namespace, cert.ServerCertSecretName)).To(BeTrue())
+		for _, action := range client.Actions() {
+			Expect(action.GetNamespace()).ToNot(Equal(workloads), "%s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+
+		Expect(managedCert(workloads, "workload-cert")).To(Equal(workload))
+		Expect(managedCert(namespace, cert.ServerCertSecretName).LastSyncSucceeded).To(BeTrue())
+		Expect(cm.SyncStatus()).To(Equal(status))
+		Expect(cm.lastSyncedCerts()).To(HaveLen(2))
+	})
+
+	It("should keep watching the objects of the other definitions for the next sync", func() {
+		cm.syncDebounce = defaultSyncDebounce
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(cm.SyncSubset(context.TODO(), CertSelector{TargetSecrets: []types.NamespacedName{serverTarget}})).To(Succeed())
+
+		deleteSecret(workloads, "workload-cert")
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(secretExists(workloads, "workload-cert")).To(BeTrue())
+	})
+
+	It("should stop with the context", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(cm.SyncSubset(ctx, CertSelector{Namespaces: []string{namespace, workloads}})).To(MatchError(context.Canceled))
+	})
+
+	// the unit tests run with -race, the syncs share the state of the cert manager
+	It("should serialize with the syncs and the forced rotations", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		var wg sync.WaitGroup
+		run := func(f func() error) {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(f()).To(Succeed())
+			}()
+		}
+		for i := 0; i < 3; i++ {
+			run(func() error { return cm.Sync(context.TODO(), certs) })
+			run(func() error { return cm.SyncSubset(context.TODO(), CertSelector{Namespaces: []string{namespace}}) })
+			run(func() error { return cm.ForceRotate(certs[1]) })
+		}
+		wg.Wait()
+
+		Expect(secretExists(namespace, cert.ServerCertSecretName)).To(BeTrue())
+		Expect(secretExists(workloads, "workload-cert")).To(BeTrue())
+	})
+
+	DescribeTable("should select the definitions", func(selector CertSelector, expected ...string) {
+		var targets []string
+		for _, cd := range selector.selectDefinitions(certs) {
+			targets = append(targets, cd.TargetSecret.Name)
+		}
+		if len(expected) == 0 {
+			Expect(targets).To(BeEmpty())
+			return
+		}
+		Expect(targets).To(Equal(expected))
+	},
+		Entry("by signer", CertSelector{SignerSecrets: []types.NamespacedName{{Namespace: workloads, Name: "workload-signer"}}}, "workload-cert"),
+		Entry("by target", CertSelector{TargetSecrets: []types.NamespacedName{serverTarget}}, cert.ServerCertSecretName),
+		Entry("by namespace", CertSelector{Namespaces: []string{workloads}}, "workload-cert"),
+		Entry("by any", CertSelector{TargetSecrets: []types.NamespacedName{serverTarget}, Namespaces: []string{workloads}}, cert.ServerCertSecretName, "workload-cert"),
+		Entry("by name in another namespace", CertSelector{TargetSecrets: []types.NamespacedName{{Namespace: workloads, Name: cert.ServerCertSecretName}}}),
+	)
+})
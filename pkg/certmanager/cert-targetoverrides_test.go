@@ -0,0 +1,143 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("certConfig target override tests", func() {
+	const namespace = "maroonedpods"
+
+	newCertConfig := func(overrides map[v1alpha1.CertTarget]v1alpha1.CertConfig) *v1alpha1.MaroonedPodsCertConfig {
+		return &v1alpha1.MaroonedPodsCertConfig{
+			Server:          &v1alpha1.CertConfig{Duration: durationPtr("36h"), RenewBefore: durationPtr("12h")},
+			TargetOverrides: overrides,
+		}
+	}
+
+	newDefinitions := func(config *v1alpha1.MaroonedPodsCertConfig) ([]cert.CertificateDefinition, error) {
+		return cert.NewDefinitionFactory(namespace, cert.WithCertConfig(config), cert.WithControllerClientCert(), cert.WithMetricsCerts())
+	}
+
+	targetConfigs := func(defs []cert.CertificateDefinition) map[string]cert.CertificateConfig {
+		configs := make(map[string]cert.CertificateConfig)
+		for _, cd := range defs {
+			configs[cd.TargetSecret.Name] = cd.TargetConfig
+		}
+		return configs
+	}
+
+	It("should replace renewBefore and renewBeforePercent of the server together", func() {
+		defs, err := newDefinitions(newCertConfig(map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+			v1alpha1.CertTargetServer: {RenewBeforePercent: &[]int32{25}[0]},
+		}))
+		Expect(err).ToNot(HaveOccurred())
+		configs := targetConfigs(defs)
+		Expect(configs[cert.ServerCertSecretName]).To(Equal(cert.CertificateConfig{Lifetime: 36 * time.Hour, Refresh: 27 * time.Hour, RefreshPercent: 75}))
+		// the others keep the server configuration
+		Expect(configs[cert.ControllerClientCertSecretName]).To(Equal(cert.CertificateConfig{Lifetime: 36 * time.Hour, Refresh: 24 * time.Hour}))
+		Expect(configs[cert.OperatorMetricsCertSecretName]).To(Equal(cert.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour}))
+	})
+
+	DescribeTable("should reject an inconsistent override", func(overrides map[v1alpha1.CertTarget]v1alpha1.CertConfig, expected string) {
+		_, err := newDefinitions(newCertConfig(overrides))
+		Expect(err).To(MatchError(ContainSubstring(expected)))
+		// the webhook of the CR rejects them as well
+		_, err = cert.DefinitionsFromCertConfig(namespace, newCertConfig(overrides))
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("of an unknown target", map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+			"ca": {Duration: durationPtr("6h")},
+		}, "certConfig.targetOverrides.ca: unknown target"),
+		Entry("with the renewBefore of the server", map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+			v1alpha1.CertTargetControllerClient: {Duration: durationPtr("6h")},
+		}, "certConfig.targetOverrides.controller-client: renewBefore has to be shorter than the duration (6h0m0s)"),
+		Entry("with both renewals", map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+			v1alpha1.CertTargetServer: {RenewBefore: durationPtr("2h"), RenewBeforePercent: &[]int32{25}[0]},
+		}, "certConfig.targetOverrides.server: renewBefore and renewBeforePercent are mutually exclusive"),
+		Entry("with a backdate too long", map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+			v1alpha1.CertTargetMetrics: {Backdate: durationPtr("2h")},
+		}, "certConfig.targetOverrides.metrics.backdate"),
+	)
+
+	It("should reject an override shorter than the default refresh", func() {
+		_, err := cert.NewDefinitionFactory(namespace, cert.WithMetricsCerts(), cert.WithCertConfig(&v1alpha1.MaroonedPodsCertConfig{
+			TargetOverrides: map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+				v1alpha1.CertTargetMetrics: {Duration: durationPtr("6h")},
+			},
+		}))
+		Expect(err).To(MatchError(ContainSubstring("certConfig.targetOverrides.metrics: the duration 6h0m0s doesn't leave time to renew")))
+	})
+
+	Context("when syncing", func() {
+		var (
+			client *fake.Clientset
+			cm     *certManager
+			cancel context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace).(*certManager)
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.Start(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		// syncs the definitions of the certConfig and returns the data of the secrets once the listers see them
+		sync := func(config *v1alpha1.MaroonedPodsCertConfig) map[string]map[string][]byte {
+			defs, err := newDefinitions(config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Sync(context.TODO(), defs)).To(Succeed())
+
+			secrets, err := client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			data := make(map[string]map[string][]byte)
+			for i := range secrets.Items {
+				waitForSecretInLister(cm, &secrets.Items[i])
+				data[secrets.Items[i].Name] = secrets.Items[i].Data
+			}
+			return data
+		}
+
+		It("should only refresh the target whose override changed", func() {
+			before := sync(newCertConfig(nil))
+			Expect(before).To(HaveKey(cert.ControllerClientCertSecretName))
+
+			after := sync(newCertConfig(map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+				v1alpha1.CertTargetControllerClient: {Duration: durationPtr("6h"), RenewBefore: durationPtr("2h")},
+			}))
+			Expect(after).To(HaveLen(len(before)))
+			for name, data := range after {
+				if name == cert.ControllerClientCertSecretName {
+					Expect(data).ToNot(Equal(before[name]), name)
+					continue
+				}
+				Expect(data).To(Equal(before[name]), name)
+			}
+
+			secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ControllerClientCertSecretName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(secret.Annotations[annCertConfig]).To(ContainSubstring(`"lifetime":"` + cert.FormatDuration(6*time.Hour) + `"`))
+		})
+	})
+})
+
+func durationPtr(d string) *metav1.Duration {
+	duration, err := time.ParseDuration(d)
+	Expect(err).ToNot(HaveOccurred())
+	return &metav1.Duration{Duration: duration}
+}
@@ -0,0 +1,51 @@
+package certmanager
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// targetHostnames are the SANs of a serving certificate for the service
+func targetHostnames(service, namespace string) []string {
+	return []string{
+		service,
+		fmt.Sprintf("%s.%s", service, namespace),
+		fmt.Sprintf("%s.%s.svc", service, namespace),
+	}
+}
+
+// checkTargetService warns when the service a serving certificate is issued for does not exist,
+// it may still be created later in the same reconcile so this only fails in strict mode
+func (cm *certManager) checkTargetService(cd mpcerts.CertificateDefinition) error {
+	if cd.TargetService == nil {
+		return nil
+	}
+
+	namespace := cd.TargetSecret.Namespace
+	if err := cm.startServiceLister(cd); err != nil {
+		return err
+	}
+	listers, err := cm.listersFor(clusterNamespace{namespace: namespace})
+	if err != nil {
+		return err
+	}
+	_, err = listers.serviceLister.Services(namespace).Get(*cd.TargetService)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	hostnames := targetHostnames(*cd.TargetService, namespace)
+	if cd.StrictTargetService {
+		return fmt.Errorf("target service %s/%s of secret %s does not exist, expected SANs %v", namespace, *cd.TargetService, cd.TargetSecret.Name, hostnames)
+	}
+
+	log.Info("Target service of serving certificate does not exist", "service", *cd.TargetService, "namespace", namespace, "secret", cd.TargetSecret.Name, "hostnames", hostnames)
+	cm.eventRecorder.Warningf("TargetServiceNotFound", "Service %s/%s of the certificate in secret %s does not exist, issuing for %v", namespace, *cd.TargetService, cd.TargetSecret.Name, hostnames)
+	return nil
+}
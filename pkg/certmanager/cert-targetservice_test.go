@@ -0,0 +1,134 @@
+package certmanager
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("target service tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     CertManager
+		cancel context.CancelFunc
+	)
+
+	newCerts := func(strict bool) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		for i := range certs {
+			certs[i].StrictTargetService = strict
+		}
+		return certs
+	}
+
+	createService := func() {
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: util.MaroonedPodsServerResourceName, Namespace: namespace},
+		}
+		_, err := client.CoreV1().Services(namespace).Create(context.TODO(), service, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	warnings := func() []*corev1.Event {
+		var events []*corev1.Event
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if event := create.GetObject().(*corev1.Event); event.Reason == "TargetServiceNotFound" {
+					events = append(events, event)
+				}
+			}
+		}
+		return events
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should warn and still issue the certificate when the service does not exist", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+
+		events := warnings()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(corev1.EventTypeWarning))
+		Expect(events[0].Message).To(ContainSubstring("maroonedpods-server.maroonedpods.svc"))
+
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+	})
+
+	It("should not warn when the service exists", func() {
+		createService()
+
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+
+		Expect(warnings()).To(BeEmpty())
+	})
+
+	It("should fail in strict mode when the service does not exist", func() {
+		err := cm.Sync(context.TODO(), newCerts(true))
+		Expect(err).To(MatchError(ContainSubstring("target service maroonedpods/maroonedpods-server of secret maroonedpods-server-cert does not exist")))
+
+		_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should issue the certificate in strict mode when the service exists", func() {
+		createService()
+
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Data[corev1.TLSCertKey]).ToNot(BeEmpty())
+	})
+
+	It("should read the services from the cache", func() {
+		Expect(cm.Sync(context.TODO(), newCerts(false))).To(Succeed())
+		Expect(warnings()).To(HaveLen(1))
+
+		createService()
+		Eventually(func() error {
+			_, err := cm.(*certManager).listers()[clusterNamespace{namespace: namespace}].serviceLister.Services(namespace).Get(util.MaroonedPodsServerResourceName)
+			return err
+		}).Should(Succeed())
+
+		before := len(client.Actions())
+		Expect(cm.Sync(context.TODO(), newCerts(true))).To(Succeed())
+		for _, action := range client.Actions()[before:] {
+			Expect(action.Matches("get", "services")).To(BeFalse())
+		}
+		Expect(warnings()).To(HaveLen(1))
+	})
+
+	It("should not check client certificates", func() {
+		certs := newCerts(true)
+		certs[0].TargetService = nil
+		certs[0].TargetUser = &[]string{"maroonedpods-controller"}[0]
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(warnings()).To(BeEmpty())
+	})
+})
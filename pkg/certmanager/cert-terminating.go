@@ -0,0 +1,108 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// namespacesOf returns the namespaces of the objects of the definition in the management cluster
+func namespacesOf(cd mpcerts.CertificateDefinition) []string {
+	namespaces := sets.NewString()
+	if cd.SignerSecret != nil {
+		namespaces.Insert(cd.SignerSecret.Namespace)
+	}
+	if cd.CertBundleConfigmap != nil && cd.BundleCluster == mpcerts.ManagementCluster {
+		namespaces.Insert(cd.CertBundleConfigmap.Namespace)
+	}
+	if cd.TargetSecret != nil {
+		namespaces.Insert(cd.TargetSecret.Namespace)
+	}
+	return namespaces.List()
+}
+
+// terminatingNamespaceOf returns the namespace the API refused to create an object in because it
+// is being deleted, false if the error isn't about a terminating namespace
+func terminatingNamespaceOf(err error) (string, bool) {
+	cause, ok := errors.StatusCause(err, corev1.NamespaceTerminatingCause)
+	if !ok {
+		return "", false
+	}
+	var namespace string
+	if _, err := fmt.Sscanf(cause.Message, "namespace %s is being terminated", &namespace); err != nil {
+		return "", true
+	}
+	return namespace, true
+}
+
+// skipTerminatingNamespace tells if the sync of the definition failed because one of its
+// namespaces is being deleted. Those namespaces are skipped until they are gone or active again.
+func (cm *certManager) skipTerminatingNamespace(cd mpcerts.CertificateDefinition, err error) bool {
+	namespace, ok := terminatingNamespaceOf(err)
+	if !ok {
+		return false
+	}
+	namespaces := []string{namespace}
+	if namespace == "" {
+		namespaces = namespacesOf(cd)
+	}
+
+	if cm.terminatingNamespaces == nil {
+		cm.terminatingNamespaces = sets.NewString()
+	}
+	for _, ns := range namespaces {
+		if cm.terminatingNamespaces.Has(ns) {
+			continue
+		}
+		cm.terminatingNamespaces.Insert(ns)
+		log.Info("The namespace is being terminated, skipping its certificates", "namespace", ns)
+		cm.eventRecorder.Eventf("NamespaceTerminating", "Skipping the certificates in namespace %s, it is being terminated", ns)
+	}
+	return true
+}
+
+// inTerminatingNamespace tells if the definition has objects in a namespace being deleted
+func (cm *certManager) inTerminatingNamespace(cd mpcerts.CertificateDefinition) bool {
+	for _, ns := range namespacesOf(cd) {
+		if cm.terminatingNamespaces.Has(ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshTerminatingNamespaces drops the listers of the terminating namespaces that are gone and
+// manages again the ones that are active, e.g. recreated
+func (cm *certManager) refreshTerminatingNamespaces() {
+	for _, ns := range cm.terminatingNamespaces.List() {
+		namespace, err := cm.k8sClient.CoreV1().Namespaces().Get(context.TODO(), ns, metav1.GetOptions{})
+		key := clusterNamespace{namespace: ns}
+		switch {
+		case errors.IsNotFound(err):
+			if _, ok := cm.listers()[key]; ok {
+				log.Info("The namespace is gone, dropping its listers", "namespace", ns)
+				cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+					delete(listerMap, key)
+				})
+			}
+		case err != nil:
+			// keep skipping it, the next sync checks again
+			log.Error(err, "Failed to get the terminating namespace", "namespace", ns)
+		case namespace.Status.Phase != corev1.NamespaceTerminating:
+			log.Info("The namespace is active again, managing its certificates", "namespace", ns)
+			cm.terminatingNamespaces.Delete(ns)
+			if _, ok := cm.listers()[key]; !ok && sets.NewString(cm.namespaces...).Has(ns) {
+				cm.updateListers(func(listerMap map[clusterNamespace]*certListers, informers v1helpers.KubeInformersForNamespaces) {
+					listerMap[key] = newListers(informers, ns)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// namespaceTerminatingError is the error of the API server for a create in a namespace being deleted
+func namespaceTerminatingError(resource, name, namespace string) error {
+	err := errors.NewForbidden(schema.GroupResource{Resource: resource}, name,
+		fmt.Errorf("unable to create new content in namespace %s because it is being terminated", namespace))
+	err.ErrStatus.Details.Causes = append(err.ErrStatus.Details.Causes, metav1.StatusCause{
+		Type:    corev1.NamespaceTerminatingCause,
+		Message: fmt.Sprintf("namespace %s is being terminated", namespace),
+		Field:   "metadata.namespace",
+	})
+	return err
+}
+
+var _ = Describe("terminating namespace tests", func() {
+	const (
+		namespace   = "maroonedpods"
+		terminating = "terminating"
+	)
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		// whether the API refuses the creates in the terminating namespace
+		refuse bool
+	)
+
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		// first, the definitions after it are still synced
+		return append([]cert.CertificateDefinition{{
+			SignerSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: terminating, Name: "other-signer"}},
+			SignerConfig:        certs[0].SignerConfig,
+			CertBundleConfigmap: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: terminating, Name: "other-bundle"}},
+			TargetSecret:        &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: terminating, Name: "other-target"}},
+			TargetConfig:        certs[0].TargetConfig,
+			TargetService:       &[]string{"other"}[0],
+		}}, certs...)
+	}
+
+	terminatingCreates := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "create" && action.GetNamespace() == terminating {
+				count++
+			}
+		}
+		return count
+	}
+
+	terminatingEvents := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if create.GetObject().(*corev1.Event).Reason == "NamespaceTerminating" {
+					count++
+				}
+			}
+		}
+		return count
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: terminating},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+		})
+		refuse = true
+		client.PrependReactor("create", "*", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if !refuse || action.GetNamespace() != terminating {
+				return false, nil, nil
+			}
+			name := action.(testingclient.CreateAction).GetObject().(metav1.Object).GetName()
+			return true, nil, namespaceTerminatingError(action.GetResource().Resource, name, terminating)
+		})
+		addApplyReactor(client)
+		allowAccessReviews(client)
+		cm = newCertManager(client, nil, namespace, terminating)
+		cm.extClient = extfake.NewSimpleClientset()
+		cm.client = crfake.NewClientBuilder().Build()
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should skip the definitions of a terminating namespace", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		_, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(terminatingEvents()).To(Equal(1))
+		Expect(cm.terminatingNamespaces.Has(terminating)).To(BeTrue())
+
+		// no more attempts while it is terminating
+		creates := terminatingCreates()
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(terminatingCreates()).To(Equal(creates))
+		Expect(terminatingEvents()).To(Equal(1))
+	})
+
+	It("should drop the listers of the namespace once it is gone", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(cm.listerMap).To(HaveKey(clusterNamespace{namespace: terminating}))
+
+		Expect(client.CoreV1().Namespaces().Delete(context.TODO(), terminating, metav1.DeleteOptions{})).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(cm.listerMap).ToNot(HaveKey(clusterNamespace{namespace: terminating}))
+		Expect(cm.listerMap).To(HaveKey(clusterNamespace{namespace: namespace}))
+	})
+
+	It("should manage a recreated namespace again", func() {
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+		Expect(client.CoreV1().Namespaces().Delete(context.TODO(), terminating, metav1.DeleteOptions{})).To(Succeed())
+		Expect(cm.Sync(context.TODO(), newCerts())).To(Succeed())
+
+		refuse = false
+		_, err := client.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: terminating},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		}, metav1.CreateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() error {
+			return cm.Sync(context.TODO(), newCerts())
+		}, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+		Expect(cm.terminatingNamespaces.Has(terminating)).To(BeFalse())
+		Expect(cm.listerMap).To(HaveKey(clusterNamespace{namespace: terminating}))
+		_, err = client.CoreV1().Secrets(terminating).Get(context.TODO(), "other-target", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should still fail for other errors", func() {
+		client.PrependReactor("create", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			if action.GetNamespace() == terminating {
+				return true, nil, errors.NewInternalError(fmt.Errorf("etcd is down"))
+			}
+			return false, nil, nil
+		})
+		Expect(cm.Sync(context.TODO(), newCerts())).To(MatchError(ContainSubstring("etcd is down")))
+		Expect(cm.terminatingNamespaces.Has(terminating)).To(BeFalse())
+	})
+})
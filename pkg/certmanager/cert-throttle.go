@@ -0,0 +1,53 @@
+package certmanager
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultMinSyncInterval is how long after a successful sync the syncs of the same definitions are skipped
+// either way, so the events of the objects the sync wrote or short lifetimes don't make it sync back to back
+const defaultMinSyncInterval = 10 * time.Second
+
+// minSyncInterval parses the minimum sync interval of the value of the env variable, 0 disables it
+func minSyncInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultMinSyncInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("the minimum sync interval %s is negative", value)
+	}
+	return interval, nil
+}
+
+// throttled tells whether the sync of the definitions of the hash can be skipped because the last
+// successful sync of the same definitions started less than the minimum interval ago, even if their
+// objects changed or a certificate is due. Changed definitions, forced rotations and the syncs after a
+// failed one aren't throttled. The refresh hint is shortened to the rest of the interval when the
+// skipped sync had something to do, so the requeue doesn't wait for the next refresh.
+func (cm *certManager) throttled(hash string) bool {
+	if cm.minSyncInterval <= 0 || hash == "" || len(cm.forcedRotations) > 0 {
+		return false
+	}
+
+	cm.debounceLock.Lock()
+	defer cm.debounceLock.Unlock()
+	last := cm.lastSync
+	if last == nil || last.hash != hash {
+		return false
+	}
+	elapsed := cm.clock.Now().Sub(last.at)
+	remaining := cm.minSyncInterval - elapsed
+	if remaining <= 0 {
+		return false
+	}
+	pending := last.events != cm.objectEvents.Load() || elapsed >= cm.nextRefresh
+	if pending && remaining < cm.nextRefresh {
+		cm.nextRefresh = remaining
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// tracerName is the instrumentation name of the default tracer
+const tracerName = "maroonedpods.io/maroonedpods/pkg/certmanager"
+
+// names of the spans of a sync
+const (
+	spanSync             = "CertManager.Sync"
+	spanDefinition       = "CertManager.SyncDefinition"
+	spanEnsureSigner     = "CertManager.EnsureSigner"
+	spanEnsureCertBundle = "CertManager.EnsureCertBundle"
+	spanEnsureTarget     = "CertManager.EnsureTarget"
+	spanPropagateBundle  = "CertManager.PropagateBundle"
+)
+
+// attributes of the spans of a sync
+const (
+	attrDefinitions = attribute.Key("maroonedpods.certs.definitions")
+	attrDebounced   = attribute.Key("maroonedpods.certs.debounced")
+	attrThrottled   = attribute.Key("maroonedpods.certs.throttled")
+	attrSubset      = attribute.Key("maroonedpods.certs.subset")
+	attrNamespace   = attribute.Key("k8s.namespace.name")
+	attrSecret      = attribute.Key("maroonedpods.certs.secret")
+	attrConfigMap   = attribute.Key("maroonedpods.certs.configmap")
+	attrRotated     = attribute.Key("maroonedpods.certs.rotated")
+)
+
+// WithTracer traces the syncs of the cert manager with the tracer, they aren't traced by default
+func WithTracer(cm CertManager, tracer trace.Tracer) (CertManager, error) {
+	traced, ok := cm.(*certManager)
+	if !ok {
+		return nil, fmt.Errorf("the cert manager %T can't be traced", cm)
+	}
+	traced.tracer = tracer
+	return traced, nil
+}
+
+// noopTracer is the default tracer, it doesn't record anything
+func noopTracer() trace.Tracer {
+	return trace.NewNoopTracerProvider().Tracer(tracerName)
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startDefinitionSpan starts the span of the sync of the definition and returns its context, the spans
+// of the steps started with it are its children until the returned function ends it with the outcome
+// of the definition
+func (cm *certManager) startDefinitionSpan(ctx context.Context, cd mpcerts.CertificateDefinition) (context.Context, func(err error)) {
+	var attributes []attribute.KeyValue
+	if secret := cd.TargetSecret; secret != nil {
+		attributes = secretAttributes(secret.Namespace, secret.Name)
+	} else if secret := cd.SignerSecret; secret != nil {
+		attributes = secretAttributes(secret.Namespace, secret.Name)
+	}
+	ctx, span := cm.tracer.Start(ctx, spanDefinition, trace.WithAttributes(attributes...))
+	rotations := cm.rotationCount
+	return ctx, func(err error) {
+		span.SetAttributes(attrRotated.Bool(cm.rotationCount > rotations))
+		endSpan(span, err)
+	}
+}
+
+// traceStep runs a step of the sync of a definition in a child span of the span of ctx
+func (cm *certManager) traceStep(ctx context.Context, name string, step func(ctx context.Context) error, attributes ...attribute.KeyValue) error {
+	ctx, span := cm.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	rotations := cm.rotationCount
+	err := step(ctx)
+	span.SetAttributes(attrRotated.Bool(cm.rotationCount > rotations))
+	endSpan(span, err)
+	return err
+}
+
+// secretAttributes returns the attributes of the namespace and name of the secret
+func secretAttributes(namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{attrNamespace.String(namespace), attrSecret.String(name)}
+}
+
+// configMapAttributes returns the attributes of the namespace and name of the configmap
+func configMapAttributes(namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{attrNamespace.String(namespace), attrConfigMap.String(name)}
+}
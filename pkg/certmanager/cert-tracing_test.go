@@ -0,0 +1,191 @@
+package certmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// spanAttributes returns the values of the attributes of the span by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]interface{} {
+	attributes := map[attribute.Key]interface{}{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value.AsInterface()
+	}
+	return attributes
+}
+
+// spanErrors returns the messages of the errors recorded on the span
+func spanErrors(span sdktrace.ReadOnlySpan) []string {
+	var errs []string
+	for _, event := range span.Events() {
+		for _, kv := range event.Attributes {
+			if kv.Key == semconv.ExceptionMessageKey {
+				errs = append(errs, kv.Value.AsString())
+			}
+		}
+	}
+	return errs
+}
+
+// isChildOf tells whether the parent of the span is the other span
+func isChildOf(span, parent sdktrace.ReadOnlySpan) bool {
+	return span.Parent().SpanID() == parent.SpanContext().SpanID()
+}
+
+var _ = Describe("cert sync tracing tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		spans  *tracetest.SpanRecorder
+		certs  []cert.CertificateDefinition
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		spans = tracetest.NewSpanRecorder()
+		_, err := WithTracer(cm, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer(tracerName))
+		Expect(err).ToNot(HaveOccurred())
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// the ended spans of the name, among the spans ended after the first skip ones
+	named := func(name string, skip int) []sdktrace.ReadOnlySpan {
+		var result []sdktrace.ReadOnlySpan
+		for _, span := range spans.Ended()[skip:] {
+			if span.Name() == name {
+				result = append(result, span)
+			}
+		}
+		return result
+	}
+
+	It("should not trace by default", func() {
+		_, span := newCertManagerForTest(fake.NewSimpleClientset(), namespace).(*certManager).tracer.Start(context.Background(), spanSync)
+		Expect(span.IsRecording()).To(BeFalse())
+		Expect(span.SpanContext().IsValid()).To(BeFalse())
+	})
+
+	It("should refuse to trace another cert manager", func() {
+		_, err := WithTracer(struct{ CertManager }{cm}, trace.NewNoopTracerProvider().Tracer(tracerName))
+		Expect(err).To(MatchError(ContainSubstring("can't be traced")))
+	})
+
+	It("should trace the steps of every definition", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		syncs := named(spanSync, 0)
+		Expect(syncs).To(HaveLen(1))
+		Expect(syncs[0].Parent().IsValid()).To(BeFalse())
+		Expect(spanAttributes(syncs[0])).To(HaveKeyWithValue(attrDefinitions, int64(len(certs))))
+
+		definitions := named(spanDefinition, 0)
+		Expect(definitions).To(HaveLen(len(certs)))
+		for _, span := range definitions {
+			Expect(isChildOf(span, syncs[0])).To(BeTrue())
+			Expect(spanAttributes(span)).To(HaveKeyWithValue(attrRotated, true))
+		}
+
+		signers := named(spanEnsureSigner, 0)
+		Expect(signers).To(HaveLen(len(certs)))
+		Expect(isChildOf(signers[0], definitions[0])).To(BeTrue())
+		Expect(spanAttributes(signers[0])).To(Equal(map[attribute.Key]interface{}{
+			attrNamespace: certs[0].SignerSecret.Namespace,
+			attrSecret:    certs[0].SignerSecret.Name,
+			attrRotated:   true,
+		}))
+		for _, name := range []string{spanEnsureCertBundle, spanEnsureTarget, spanPropagateBundle} {
+			Expect(named(name, 0)).ToNot(BeEmpty(), name)
+			for _, span := range named(name, 0) {
+				Expect(definitions).To(ContainElement(Satisfy(func(definition sdktrace.ReadOnlySpan) bool {
+					return isChildOf(span, definition)
+				})), name)
+			}
+		}
+		Expect(spanAttributes(named(spanEnsureCertBundle, 0)[0])).To(HaveKeyWithValue(attrConfigMap, certs[0].CertBundleConfigmap.Name))
+
+		Expect(spans.Ended()).To(HaveLen(len(spans.Started())))
+		for _, span := range spans.Ended() {
+			Expect(span.Status().Code).To(Equal(codes.Unset), span.Name())
+			Expect(spanErrors(span)).To(BeEmpty(), span.Name())
+		}
+	})
+
+	It("should not report rotations of up to date certificates", func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		for _, cd := range certs {
+			for _, c := range managedCertsOf(cd) {
+				secret, err := client.CoreV1().Secrets(c.secret.Namespace).Get(context.TODO(), c.secret.Name, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+		}
+		before := len(spans.Ended())
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		Expect(spans.Ended()[before:]).ToNot(BeEmpty())
+		for _, span := range spans.Ended()[before:] {
+			if span.Name() != spanSync {
+				Expect(spanAttributes(span)).To(HaveKeyWithValue(attrRotated, false), span.Name())
+			}
+		}
+	})
+
+	It("should record the errors on the spans", func() {
+		client.PrependReactor("create", "secrets", func(action testingclient.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("admission webhook denied the request")
+		})
+
+		Expect(cm.Sync(context.TODO(), certs)).ToNot(Succeed())
+
+		Expect(spans.Ended()).To(HaveLen(len(spans.Started())))
+		for _, name := range []string{spanSync, spanDefinition, spanEnsureSigner} {
+			failed := named(name, 0)
+			Expect(failed).To(HaveLen(1), name)
+			Expect(failed[0].Status().Code).To(Equal(codes.Error), name)
+			Expect(spanErrors(failed[0])).To(ConsistOf(ContainSubstring("admission webhook denied the request")), name)
+		}
+	})
+
+	It("should mark a debounced sync", func() {
+		cm.syncDebounce = defaultSyncDebounce
+		// until the informers delivered the writes of the syncs
+		var synced []sdktrace.ReadOnlySpan
+		Eventually(func() []sdktrace.ReadOnlySpan {
+			before := len(spans.Ended())
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			synced = spans.Ended()[before:]
+			return synced
+		}, 10*time.Second, 200*time.Millisecond).Should(HaveLen(1))
+		Expect(synced[0].Name()).To(Equal(spanSync))
+		Expect(spanAttributes(synced[0])).To(HaveKeyWithValue(attrDebounced, true))
+	})
+})
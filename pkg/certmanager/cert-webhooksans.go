@@ -0,0 +1,142 @@
+package certmanager
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"net/url"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// ErrWebhookCertMismatch is wrapped by WebhookCertMismatchError
+var ErrWebhookCertMismatch = goerrors.New("the serving certificate doesn't cover the webhook")
+
+// WebhookCertMismatchError is returned when the target of a definition doesn't cover the host the
+// clientConfig of a webhook it backs calls
+type WebhookCertMismatchError struct {
+	// namespace/name of the target secret
+	Secret string
+	// the MutatingWebhookConfiguration and the webhook in it
+	Configuration string
+	Webhook       string
+	// the service name.namespace.svc or the host of the URL of the clientConfig
+	Host string
+}
+
+func (e *WebhookCertMismatchError) Error() string {
+	return fmt.Sprintf("the certificate in secret %s doesn't cover host %s of webhook %s of MutatingWebhookConfiguration %s",
+		e.Secret, e.Host, e.Webhook, e.Configuration)
+}
+
+func (e *WebhookCertMismatchError) Unwrap() error {
+	return ErrWebhookCertMismatch
+}
+
+// clientConfigHost returns the host the API server calls the webhook at, empty when the clientConfig
+// has neither a service nor a URL
+func clientConfigHost(clientConfig admissionregistrationv1.WebhookClientConfig) (string, error) {
+	if service := clientConfig.Service; service != nil {
+		return fmt.Sprintf("%s.%s.svc", service.Name, service.Namespace), nil
+	}
+	if clientConfig.URL == nil {
+		return "", nil
+	}
+	u, err := url.Parse(*clientConfig.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook URL %q: %w", *clientConfig.URL, err)
+	}
+	return u.Hostname(), nil
+}
+
+// webhookHosts returns the sorted hosts the webhooks of the configurations of the definition are called at
+func (cm *certManager) webhookHosts(cd mpcerts.CertificateDefinition) ([]string, error) {
+	hosts := sets.NewString()
+	for _, name := range cd.MutatingWebhookConfigurations {
+		config, err := cm.kubeClient(cd.ConsumerCluster).AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, webhook := range config.Webhooks {
+			host, err := clientConfigHost(webhook.ClientConfig)
+			if err != nil {
+				return nil, err
+			}
+			hosts.Insert(host)
+		}
+	}
+	hosts.Delete("")
+	return hosts.List(), nil
+}
+
+// verifyWebhookCerts checks that the target of every definition with webhook configurations covers the
+// hosts their clientConfigs call. A definition with CorrectWebhookSANs was issued for them already.
+func (cm *certManager) verifyWebhookCerts(certs []mpcerts.CertificateDefinition) error {
+	var errs []error
+	for _, cd := range certs {
+		if cd.TargetSecret == nil || len(cd.MutatingWebhookConfigurations) == 0 || cd.Validate() != nil ||
+			cm.inTerminatingNamespace(cd) || cm.inAbsentNamespace(cd) {
+			continue
+		}
+		if err := cm.verifyWebhookCert(cd); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (cm *certManager) verifyWebhookCert(cd mpcerts.CertificateDefinition) error {
+	key := cd.TargetSecret.Namespace + "/" + cd.TargetSecret.Name
+	// read from the API, the listers may not have seen the writes of the sync yet
+	target, err := cm.k8sClient.CoreV1().Secrets(cd.TargetSecret.Namespace).Get(context.TODO(), cd.TargetSecret.Name, metav1.GetOptions{})
+	// not issued yet by cert-manager.io or provided yet by the user
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	parsed, err := cm.parseCerts(target, corev1.TLSCertKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse the certificate in secret %s: %w", key, err)
+	}
+
+	var errs []error
+	for _, name := range cd.MutatingWebhookConfigurations {
+		config, err := cm.kubeClient(cd.ConsumerCluster).AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), name, metav1.GetOptions{})
+		// the webhook is only created once the controller is ready
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, webhook := range config.Webhooks {
+			host, err := clientConfigHost(webhook.ClientConfig)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if host == "" || parsed.certs[0].VerifyHostname(host) == nil {
+				continue
+			}
+			mismatch := &WebhookCertMismatchError{Secret: key, Configuration: name, Webhook: webhook.Name, Host: host}
+			log.Info("The serving certificate doesn't cover the webhook", "secret", key, "mutatingWebhookConfiguration", name, "webhook", webhook.Name, "host", host)
+			cm.eventRecorder.Warningf("WebhookCertificateMismatch", "The certificate in secret %s doesn't cover host %s of webhook %s of MutatingWebhookConfiguration %s",
+				key, host, webhook.Name, name)
+			errs = append(errs, mismatch)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,161 @@
+package certmanager
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/utils/pointer"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+)
+
+var _ = Describe("webhook serving certificate tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client *fake.Clientset
+		cm     *certManager
+		cancel context.CancelFunc
+		certs  []cert.CertificateDefinition
+	)
+
+	serviceConfig := func(name string) admissionregistrationv1.WebhookClientConfig {
+		return admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{Namespace: namespace, Name: name, Path: pointer.String("/mutate")},
+		}
+	}
+
+	urlConfig := func(url string) admissionregistrationv1.WebhookClientConfig {
+		return admissionregistrationv1.WebhookClientConfig{URL: pointer.String(url)}
+	}
+
+	start := func(clientConfig admissionregistrationv1.WebhookClientConfig) {
+		client = fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods.maroonedpods.io", ClientConfig: clientConfig}},
+		})
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	}
+
+	// points the webhook at the client config, as a reconfiguration of the webhook would
+	reconfigure := func(clientConfig admissionregistrationv1.WebhookClientConfig) {
+		webhooks := client.AdmissionregistrationV1().MutatingWebhookConfigurations()
+		config, err := webhooks.Get(context.TODO(), cluster.MutatingWebhookConfigurationName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		config.Webhooks[0].ClientConfig = clientConfig
+		_, err = webhooks.Update(context.TODO(), config, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	getTarget := func() *corev1.Secret {
+		secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		return secret
+	}
+
+	// syncs and waits for the lister to see the target
+	sync := func() {
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+		waitForSecretInLister(cm, getTarget())
+	}
+
+	targetDNSNames := func() []string {
+		secret := getTarget()
+		parsed, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return parsed[0].DNSNames
+	}
+
+	events := func(reason string) []string {
+		var messages []string
+		for _, action := range client.Actions() {
+			if create, ok := action.(testingclient.CreateAction); ok && action.GetResource().Resource == "events" {
+				if event := create.GetObject().(*corev1.Event); event.Reason == reason {
+					messages = append(messages, event.Message)
+				}
+			}
+		}
+		return messages
+	}
+
+	BeforeEach(func() {
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should accept a service the target is issued for", func() {
+		start(serviceConfig(cert.ServerServiceName))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+	})
+
+	It("should report a service the target isn't issued for", func() {
+		start(serviceConfig("renamed"))
+
+		err := cm.Sync(context.TODO(), certs)
+		Expect(err).To(MatchError(ErrWebhookCertMismatch))
+		var mismatch *WebhookCertMismatchError
+		Expect(errors.As(err, &mismatch)).To(BeTrue())
+		Expect(*mismatch).To(Equal(WebhookCertMismatchError{
+			Secret:        namespace + "/" + cert.ServerCertSecretName,
+			Configuration: cluster.MutatingWebhookConfigurationName,
+			Webhook:       "pods.maroonedpods.io",
+			Host:          "renamed." + namespace + ".svc",
+		}))
+		// the certificates are still issued
+		Expect(targetDNSNames()).ToNot(ContainElement("renamed." + namespace + ".svc"))
+
+		Eventually(func() []string {
+			return events("WebhookCertificateMismatch")
+		}).Should(ContainElement(And(
+			ContainSubstring(namespace+"/"+cert.ServerCertSecretName),
+			ContainSubstring(cluster.MutatingWebhookConfigurationName),
+		)))
+	})
+
+	It("should check the host of a URL", func() {
+		start(urlConfig("https://" + cert.ServerServiceName + "." + namespace + ".svc:8443/mutate"))
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		reconfigure(urlConfig("https://webhook.example.com/mutate"))
+		err := cm.Sync(context.TODO(), certs)
+		var mismatch *WebhookCertMismatchError
+		Expect(errors.As(err, &mismatch)).To(BeTrue())
+		Expect(mismatch.Host).To(Equal("webhook.example.com"))
+	})
+
+	It("should re-issue the target with the hosts of the webhook when asked to correct them", func() {
+		certs[0].CorrectWebhookSANs = true
+		withoutWebhooks := certs[0]
+		withoutWebhooks.MutatingWebhookConfigurations = nil
+		Expect(withoutWebhooks.Validate()).To(MatchError(cert.ErrInvalidDefinition))
+
+		start(serviceConfig(cert.ServerServiceName))
+		sync()
+		issued := targetDNSNames()
+
+		reconfigure(serviceConfig("renamed"))
+		sync()
+		Expect(targetDNSNames()).To(ConsistOf(append(issued, "renamed."+namespace+".svc")))
+
+		reconfigure(urlConfig("https://webhook.example.com/mutate"))
+		sync()
+		Expect(targetDNSNames()).To(ContainElement("webhook.example.com"))
+		Expect(targetDNSNames()).ToNot(ContainElement("renamed." + namespace + ".svc"))
+	})
+})
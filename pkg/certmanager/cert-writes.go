@@ -0,0 +1,22 @@
+package certmanager
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// secretChanged compares what the certificate manager writes to a secret, so no-op updates can be
+// skipped. The metadata maintained by the API server is left out and nil maps equal empty ones.
+func secretChanged(current, updated *corev1.Secret) bool {
+	return !equality.Semantic.DeepEqual(current.Labels, updated.Labels) ||
+		!equality.Semantic.DeepEqual(current.Annotations, updated.Annotations) ||
+		!equality.Semantic.DeepEqual(current.Data, updated.Data)
+}
+
+// configMapChanged is the secretChanged of configmaps
+func configMapChanged(current, updated *corev1.ConfigMap) bool {
+	return !equality.Semantic.DeepEqual(current.Labels, updated.Labels) ||
+		!equality.Semantic.DeepEqual(current.Annotations, updated.Annotations) ||
+		!equality.Semantic.DeepEqual(current.Data, updated.Data) ||
+		!equality.Semantic.DeepEqual(current.BinaryData, updated.BinaryData)
+}
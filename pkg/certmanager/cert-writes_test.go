@@ -0,0 +1,147 @@
+package certmanager
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("converged sync tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client    *fake.Clientset
+		extClient *extfake.Clientset
+		cm        *certManager
+		cancel    context.CancelFunc
+	)
+
+	// every output of a definition turned on
+	newCerts := func() []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].OutputFormats = []cert.OutputFormat{cert.OutputFormatPKCS12, cert.OutputFormatCombinedPEM}
+		certs[0].CertKeyName = "server.crt"
+		certs[0].KeyKeyName = "server.key"
+		certs[0].BundleOutputFormats = []cert.OutputFormat{cert.OutputFormatPKCS12}
+		certs[0].BundleAdditionalKey = "ca.crt"
+		certs[0].BundleCopies = []types.NamespacedName{{Namespace: "consumer", Name: "maroonedpods-ca"}}
+		certs[0].MutatingWebhookConfigurations = []string{cluster.MutatingWebhookConfigurationName}
+		certs[0].ConversionCRDs = []string{util.MaroonedPodsCRDName}
+		return certs
+	}
+
+	waitForListers := func(certs []cert.CertificateDefinition) {
+		for _, cd := range certs {
+			for _, c := range managedCertsOf(cd) {
+				secret, err := client.CoreV1().Secrets(c.secret.Namespace).Get(context.TODO(), c.secret.Name, metav1.GetOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				waitForSecretInLister(cm, secret)
+			}
+			if cd.CertBundleConfigmap == nil {
+				continue
+			}
+			expected, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() bool {
+				configMap, err := cm.listerMap[clusterNamespace{namespace: namespace}].configMapLister.ConfigMaps(namespace).Get(expected.Name)
+				return err == nil && equality.Semantic.DeepEqual(configMap.Data, expected.Data) &&
+					equality.Semantic.DeepEqual(configMap.BinaryData, expected.BinaryData) &&
+					equality.Semantic.DeepEqual(configMap.Annotations, expected.Annotations)
+			}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+		}
+	}
+
+	writes := func(actions []testingclient.Action) []string {
+		var result []string
+		for _, action := range actions {
+			switch action.GetVerb() {
+			case "update", "patch":
+				result = append(result, action.GetVerb()+" "+action.GetResource().Resource+" "+action.GetNamespace())
+			}
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "first.maroonedpods.io"}},
+		})
+		extClient = extfake.NewSimpleClientset(&extv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: util.MaroonedPodsCRDName},
+			Spec: extv1.CustomResourceDefinitionSpec{
+				Conversion: &extv1.CustomResourceConversion{
+					Strategy: extv1.WebhookConverter,
+					Webhook: &extv1.WebhookConversion{
+						ClientConfig:             &extv1.WebhookClientConfig{},
+						ConversionReviewVersions: []string{"v1"},
+					},
+				},
+			},
+		})
+		cm = newCertManagerForTest(client, namespace).(*certManager)
+		cm.extClient = extClient
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(cm.Start(ctx)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// syncs until the fake cluster and the listers caught up
+	converge := func(certs []cert.CertificateDefinition) {
+		for i := 0; i < 2; i++ {
+			Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+			waitForListers(certs)
+		}
+	}
+
+	expectNoWrites := func(certs []cert.CertificateDefinition) {
+		client.ClearActions()
+		extClient.ClearActions()
+
+		Expect(cm.Sync(context.TODO(), certs)).To(Succeed())
+
+		Expect(writes(client.Actions())).To(BeEmpty())
+		Expect(writes(extClient.Actions())).To(BeEmpty())
+	}
+
+	It("should not write anything when nothing changed", func() {
+		converge(newCerts())
+
+		expectNoWrites(newCerts())
+	})
+
+	It("should not write anything without the optional outputs", func() {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		converge(certs)
+
+		expectNoWrites(certs)
+	})
+
+	It("should not write anything once the optional outputs are cleaned up", func() {
+		converge(newCerts())
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		converge(certs)
+
+		expectNoWrites(certs)
+	})
+})
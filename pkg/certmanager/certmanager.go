@@ -0,0 +1,42 @@
+// Package certmanager issues and rotates the certificates of certificate definitions, the signers, the
+// targets they sign and the CA bundles their consumers trust, for operators embedding the certificate
+// management of MaroonedPods. It runs without a controller-runtime manager:
+//
+//	mgr, err := certmanager.NewStandaloneCertManager(client, namespace, certmanager.CertManagerOptions{})
+//	...
+//	err = mgr.Start(ctx)
+//	...
+//	err = mgr.Sync(ctx, definitions)
+//
+// Sync is called again on every reconcile, it only writes what changed and rotates the certificates
+// entering their refresh window, NextRefreshIn tells when to call it next.
+package certmanager
+
+import (
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+type (
+	// CertificateDefinition is a signer, the target it signs and the bundle of its CAs
+	CertificateDefinition = cert.CertificateDefinition
+	// CertificateConfig is the lifetime and the refresh of a certificate
+	CertificateConfig = cert.CertificateConfig
+	// IssuerReference requests the targets of a definition from a cert-manager.io issuer
+	IssuerReference = cert.IssuerReference
+	// ExtendedKeyUsages selects the extended key usages of a target
+	ExtendedKeyUsages = cert.ExtendedKeyUsages
+	// Cluster is the cluster an object of a definition lives in
+	Cluster = cert.Cluster
+)
+
+const (
+	// ExtendedKeyUsagesServer issues certificates for TLS servers
+	ExtendedKeyUsagesServer = cert.ExtendedKeyUsagesServer
+	// ExtendedKeyUsagesClient issues certificates for TLS clients
+	ExtendedKeyUsagesClient = cert.ExtendedKeyUsagesClient
+	// ExtendedKeyUsagesBoth issues certificates usable by both ends of mutual TLS
+	ExtendedKeyUsagesBoth = cert.ExtendedKeyUsagesBoth
+)
+
+// ErrInvalidDefinition is wrapped by the errors of the validation of a definition
+var ErrInvalidDefinition = cert.ErrInvalidDefinition
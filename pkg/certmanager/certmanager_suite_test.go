@@ -0,0 +1,13 @@
+package certmanager_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CertManager Suite")
+}
@@ -0,0 +1,130 @@
+package certmanager_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+)
+
+const namespace = "example"
+
+// allowAccessReviews answers the permission checks of the manager, the fake doesn't
+func allowAccessReviews(client *fake.Clientset) {
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action testingclient.Action) (bool, runtime.Object, error) {
+		review := action.(testingclient.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+}
+
+// newDefinition returns a serving certificate of the service signed by a CA of its own
+func newDefinition(service string) certmanager.CertificateDefinition {
+	return certmanager.CertificateDefinition{
+		SignerSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service + "-signer"},
+			Type:       corev1.SecretTypeTLS,
+		},
+		SignerConfig: certmanager.CertificateConfig{Lifetime: 48 * time.Hour, Refresh: 24 * time.Hour},
+		CertBundleConfigmap: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service + "-ca-bundle"},
+		},
+		TargetSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service + "-cert"},
+			Type:       corev1.SecretTypeTLS,
+		},
+		TargetConfig:  certmanager.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour},
+		TargetService: &service,
+	}
+}
+
+var _ = Describe("standalone cert manager", func() {
+	var client *fake.Clientset
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		allowAccessReviews(client)
+	})
+
+	start := func(opts certmanager.CertManagerOptions) certmanager.StandaloneCertManager {
+		mgr, err := certmanager.NewStandaloneCertManager(client, namespace, opts)
+		Expect(err).ToNot(HaveOccurred())
+		ctx, stop := context.WithCancel(context.Background())
+		DeferCleanup(stop)
+		Expect(mgr.Start(ctx)).To(Succeed())
+		return mgr
+	}
+
+	It("should issue the certificates of the definitions without a controller-runtime manager", func() {
+		mgr := start(certmanager.CertManagerOptions{})
+		Expect(mgr.Sync(context.TODO(), []certmanager.CertificateDefinition{newDefinition("api")})).To(Succeed())
+
+		target, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), "api-cert", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		certs, err := crypto.CertsFromPEM(target.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(certs[0].DNSNames).To(ContainElement("api." + namespace + ".svc"))
+
+		bundle, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "api-ca-bundle", metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bundle.Data).To(HaveKey("ca-bundle.crt"))
+
+		status := mgr.SyncStatus()
+		Expect(status.LastSuccessfulSyncTime).ToNot(BeNil())
+		Expect(mgr.NextRefreshIn()).To(BeNumerically(">", 0))
+	})
+
+	It("should refuse to sync before it is started", func() {
+		mgr, err := certmanager.NewStandaloneCertManager(client, namespace, certmanager.CertManagerOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mgr.Sync(context.TODO(), []certmanager.CertificateDefinition{newDefinition("api")})).To(MatchError(certmanager.ErrNotStarted))
+	})
+
+	It("should return the exported errors", func() {
+		mgr := start(certmanager.CertManagerOptions{})
+
+		invalid := newDefinition("api")
+		invalid.TargetService = nil
+		Expect(mgr.Sync(context.TODO(), []certmanager.CertificateDefinition{invalid})).To(MatchError(certmanager.ErrInvalidDefinition))
+
+		conflicting := newDefinition("api")
+		conflicting.TargetSecret = conflicting.TargetSecret.DeepCopy()
+		conflicting.TargetSecret.Name = "other-cert"
+		conflicting.SignerConfig.Lifetime *= 2
+		err := mgr.Sync(context.TODO(), []certmanager.CertificateDefinition{newDefinition("api"), conflicting})
+		var conflict *certmanager.ConflictingDefinitionsError
+		Expect(errors.As(err, &conflict)).To(BeTrue())
+		Expect(conflict.Secret).To(Equal(namespace + "/api-signer"))
+	})
+
+	It("should consider the kinds of a missing client unavailable", func() {
+		mgr := start(certmanager.CertManagerOptions{})
+		definition := newDefinition("api")
+		definition.Issuer = &certmanager.IssuerReference{Name: "issuer", Kind: "Issuer"}
+
+		err := mgr.Sync(context.TODO(), []certmanager.CertificateDefinition{definition})
+		var unavailable *certmanager.CertManagerUnavailableError
+		Expect(errors.As(err, &unavailable)).To(BeTrue())
+	})
+
+	It("should validate the options", func() {
+		_, err := certmanager.NewStandaloneCertManager(client, "", certmanager.CertManagerOptions{})
+		Expect(err).To(HaveOccurred())
+		_, err = certmanager.NewStandaloneCertManager(client, namespace, certmanager.CertManagerOptions{SyncDebounce: -time.Second})
+		Expect(err).To(HaveOccurred())
+		_, err = certmanager.NewStandaloneCertManager(client, namespace, certmanager.CertManagerOptions{RotationJitter: 101})
+		Expect(err).To(HaveOccurred())
+	})
+})
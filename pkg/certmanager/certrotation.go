@@ -0,0 +1,1218 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"github.com/openshift/library-go/pkg/operator/v1helpers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listerscorev1 "k8s.io/client-go/listers/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+
+	"os"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	annCertConfig = mpcerts.CertConfigAnnotation
+)
+
+var log = logf.Log.WithName("cert-manager")
+
+// CertManager is the client interface to the certificate manager/refresher
+type CertManager interface {
+	// Sync issues the certificates of the definitions. It stops between the steps once ctx or the
+	// context of Start is done and returns an error wrapping context.Canceled. The order of the
+	// definitions doesn't matter and a sync of converged definitions writes nothing, two definitions
+	// managing a secret differently fail it with a ConflictingDefinitionsError.
+	Sync(ctx context.Context, certs []mpcerts.CertificateDefinition) error
+	// SyncSubset syncs the definitions of the last Sync the selector matches like Sync, the objects of
+	// the other definitions are neither read nor written. It fails with ErrNoFullSync before a Sync.
+	SyncSubset(ctx context.Context, selector CertSelector) error
+	// Cleanup deletes the certificates managed by the operator
+	Cleanup() error
+	// NextRefreshIn returns how long until the nearest certificate is refreshed, as of the last sync
+	NextRefreshIn() time.Duration
+	// NextRotations returns the projected rotation time of every certificate of the last sync
+	NextRotations(ctx context.Context) (map[types.NamespacedName]time.Time, error)
+	// Preserve keeps the certificates managed by the operator for the next installation
+	Preserve() error
+	// PruneOrphans deletes the preserved certificates the definitions don't use anymore
+	PruneOrphans(certs []mpcerts.CertificateDefinition, preserve bool) error
+	// ForceRotate rotates the certificates of the definition now
+	ForceRotate(cd mpcerts.CertificateDefinition) error
+	// ListManagedCertificates returns the state of every object of the last sync
+	ListManagedCertificates(ctx context.Context) ([]ManagedCert, error)
+	// SyncStatus returns the outcome of the last sync
+	SyncStatus() CertSyncStatus
+	// RunCanary checks the signers of the definitions can still issue certificates, at most once per interval
+	RunCanary(certs []mpcerts.CertificateDefinition, interval time.Duration) error
+}
+
+// ErrNotStarted is returned by Sync until Start synced the informer caches, and again once the context of
+// the last Start is done
+var ErrNotStarted = goerrors.New("the cert manager is not started")
+
+// ErrNamespaceNotSynced is returned for a managed namespace whose informer caches are not synced yet, e.g.
+// while the informers restart
+var ErrNamespaceNotSynced = goerrors.New("the informer caches of the namespace are not synced")
+
+type certListers struct {
+	secretLister listerscorev1.SecretLister
+	// nil until a definition with a bundle in the namespace is synced, see startConfigMapLister
+	configMapLister listerscorev1.ConfigMapLister
+	// nil until a definition with a target service in the namespace is synced, see startServiceLister
+	serviceLister listerscorev1.ServiceLister
+}
+
+// issuanceBackend issues the signer and target certificates of a definition and returns
+// the CA bundle consumers of the target have to trust, nil if there is none yet
+type issuanceBackend interface {
+	issue(ctx context.Context, cd mpcerts.CertificateDefinition) ([]*x509.Certificate, error)
+}
+
+type certManager struct {
+	namespaces []string
+	// serializes the Starts
+	startLock sync.Mutex
+	// serializes Sync, SyncSubset and ForceRotate, they share the state of the sync
+	syncLock sync.Mutex
+	// guards listerMap, informers and startedCtx
+	listersLock sync.RWMutex
+	// replaced by Start and updateListers, read it with listers
+	listerMap map[clusterNamespace]*certListers
+	// context of the last successful Start, the informers stop with it
+	startedCtx context.Context
+	// nil unless the bundles or consumers of some definitions are in a guest cluster
+	guest *guestClient
+
+	k8sClient kubernetes.Interface
+	// used for the conversion webhooks of the CRDs
+	extClient apiextensionsclient.Interface
+	// used for the cert-manager.io resources
+	client        client.Client
+	informers     v1helpers.KubeInformersForNamespaces
+	eventRecorder events.Recorder
+
+	// error of the last failed rotation attempt by namespace/name of the certificate secret
+	rotationFailures map[string]error
+	// number of secrets of a previous operator version or installation adopted in the current sync
+	adopted int
+	// reason of the next rotation by namespace/name of the certificate secret
+	rotationReasons map[string]string
+	// reason by namespace/name of the certificate secrets ForceRotate or a signer recovery asked to rotate
+	forcedRotations map[string]string
+	// number of consecutive syncs the key pair of a signer was corrupted by namespace/name of the secret
+	signerCorruptions map[string]int
+	// number of consecutive syncs the broken chain of a definition was healed by namespace/name of its target
+	chainHealings map[string]int
+	// namespaces the API refused to create objects in because they are being deleted
+	terminatingNamespaces sets.String
+	// namespaces the API refused to create objects in because they don't exist, their definitions are
+	// suspended until they are recreated
+	absentNamespaces sets.String
+	// until when the targets wait for the consumers to pick up a new CA by namespace/name of the target
+	caSettles map[string]time.Time
+	// last corrupted cert config annotation warned about by namespace/name of the secret
+	corruptedCertConfigs map[string]string
+	// last warning about a paused certificate due for rotation by namespace/name of the secret
+	pausedWarnings map[string]pausedWarning
+	// outcome of the last canary run, nil until it ran
+	lastCanary *canaryResult
+	// certificates parsed from the secrets and configmaps by version
+	parseCache *certParseCache
+	// how long the outcome of a successful sync is reused, 0 disables the debounce
+	syncDebounce time.Duration
+	// how long after a successful sync the syncs of the same definitions are skipped either way, 0 disables it
+	minSyncInterval time.Duration
+	// the retries of the transient API errors, the budget of a Sync for them is in its context
+	transientRetry wait.Backoff
+	// percentage of their refresh the rotations are spread over either way, 0 disables the jitter
+	rotationJitter int
+	// guards lastSync
+	debounceLock sync.Mutex
+	// what the last successful sync was based on, nil if it has to run
+	lastSync *debounceState
+	// number of informer events of the objects of the definitions of the last sync
+	objectEvents atomic.Uint64
+	// sets.String of the watchedKeysOf the definitions of the last sync
+	watchedKeys atomic.Value
+	// problems of the last validation of a provided certificate by namespace/name of the secret, empty if it was valid
+	externalProblems map[string]string
+	// guards certs, syncResults, syncStatus, history and consumerDiscovery, read by the debug endpoint while syncing
+	statusLock sync.RWMutex
+	// error of the last sync by kind/namespace/name of the signer, target and bundle, nil if it succeeded
+	syncResults map[string]error
+	// why the sync of the signer, target and bundle is suspended by kind/namespace/name
+	suspensions map[string]string
+	syncStatus  CertSyncStatus
+	// recent syncs by historyKey of the definitions
+	history map[string]*CertSyncHistory
+	// persists the history for support bundles, nil to keep it in memory only
+	historyWriter *certHistoryWriter
+	// publishes the state of the certificates without key material, nil to not publish it
+	stateWriter *certStateWriter
+	// records the CAs generated by the signers, nil to not record them
+	caAuditWriter *caAuditWriter
+	// workloads referencing the objects of the definitions asking for it
+	consumerDiscovery consumerDiscovery
+
+	clock clock.PassiveClock
+	// time until the nearest certificate enters its refresh window, as of the last sync
+	nextRefresh time.Duration
+	// definitions of the last sync
+	certs []mpcerts.CertificateDefinition
+
+	// traces the syncs, a no-op tracer unless one is injected with WithTracer
+	tracer trace.Tracer
+	// number of rotations reported, tells the spans whether their step rotated a certificate
+	rotationCount int
+	// where the private keys live, in the secrets unless a store is injected with WithCertStore
+	certStore CertStore
+
+	// guards preflight
+	preflightLock sync.Mutex
+	// outcome of the last permission check by namespace, see refreshPreflight
+	preflight map[clusterNamespace]preflightResult
+}
+
+type serializedCertConfig struct {
+	Lifetime string `json:"lifetime,omitempty"`
+	Refresh  string `json:"refresh,omitempty"`
+	// part of the config so changing it re-issues the certificate
+	Backdate string `json:"backdate,omitempty"`
+	// part of the config so changing them re-issues the target
+	ExtendedKeyUsages string   `json:"extendedKeyUsages,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+}
+
+// newSerializedCertConfig serializes the resolved refresh, a RefreshPercent equivalent to the refresh
+// doesn't count as a change
+func newSerializedCertConfig(certConfig mpcerts.CertificateConfig) *serializedCertConfig {
+	scc := &serializedCertConfig{
+		Lifetime: mpcerts.FormatDuration(certConfig.Lifetime),
+		Refresh:  mpcerts.FormatDuration(certConfig.Refresh),
+	}
+	// the annotation of a certificate that isn't backdated is unchanged
+	if certConfig.Backdate > 0 {
+		scc.Backdate = mpcerts.FormatDuration(certConfig.Backdate)
+	}
+	return scc
+}
+
+// targetCertConfig is the config of the target of the definition, which also re-issues it on a change
+// of the extended key usages and the groups
+func targetCertConfig(cd mpcerts.CertificateDefinition) *serializedCertConfig {
+	scc := newSerializedCertConfig(cd.TargetConfig)
+	scc.ExtendedKeyUsages = string(cd.ExtendedKeyUsages)
+	scc.Groups = cd.TargetGroups
+	return scc
+}
+
+// canonicalCertConfig returns the annotation with canonical durations, so an equivalent config
+// written with another spelling or field order doesn't count as a change. It fails for an
+// annotation that isn't a cert config, e.g. after a hand edit, an empty one is returned as is.
+func canonicalCertConfig(annotation string) (string, error) {
+	if annotation == "" {
+		return "", nil
+	}
+	scc := &serializedCertConfig{}
+	if err := json.Unmarshal([]byte(annotation), scc); err != nil {
+		return "", err
+	}
+	var durations []time.Duration
+	for _, d := range []*string{&scc.Lifetime, &scc.Refresh} {
+		if *d == "" {
+			return "", fmt.Errorf("lifetime and refresh are required")
+		}
+		parsed, err := mpcerts.ParseDuration(*d)
+		if err != nil {
+			return "", err
+		}
+		if parsed <= 0 {
+			return "", fmt.Errorf("duration %q is not positive", *d)
+		}
+		*d = mpcerts.FormatDuration(parsed)
+		durations = append(durations, parsed)
+	}
+	if durations[1] > durations[0] {
+		return "", fmt.Errorf("refresh %s is after the lifetime %s", scc.Refresh, scc.Lifetime)
+	}
+	if scc.Backdate != "" {
+		backdate, err := mpcerts.ParseDuration(scc.Backdate)
+		if err != nil {
+			return "", err
+		}
+		scc.Backdate = ""
+		if backdate > 0 {
+			scc.Backdate = mpcerts.FormatDuration(backdate)
+		}
+	}
+	configBytes, err := json.Marshal(scc)
+	if err != nil {
+		return "", err
+	}
+	return string(configBytes), nil
+}
+
+// warnCorruptedCertConfig reports that the cert config annotation of the secret is overwritten,
+// once per corrupted value
+func (cm *certManager) warnCorruptedCertConfig(secret *corev1.Secret, err error) {
+	key := secret.Namespace + "/" + secret.Name
+	annotation := secret.Annotations[annCertConfig]
+	if warned, ok := cm.corruptedCertConfigs[key]; ok && warned == annotation {
+		return
+	}
+	if cm.corruptedCertConfigs == nil {
+		cm.corruptedCertConfigs = make(map[string]string)
+	}
+	cm.corruptedCertConfigs[key] = annotation
+	log.Info("Repairing corrupted cert config annotation", "secret", secret.Name, "namespace", secret.Namespace, "error", err.Error())
+	cm.eventRecorder.Warningf("CertConfigRepaired", "The %s annotation of secret %s is invalid, overwriting it without rotating the certificate: %v", annCertConfig, key, err)
+}
+
+// NewCertManager creates a new certificate manager/refresher, the manager starts it
+func NewCertManager(mgr manager.Manager, installNamespace string, additionalNamespaces ...string) (CertManager, error) {
+	k8sClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	extClient, err := apiextensionsclient.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	debounce, err := syncDebounce(os.Getenv(util.CertSyncDebounceEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", util.CertSyncDebounceEnv, err)
+	}
+
+	jitter, err := rotationJitter(os.Getenv(util.CertRotationJitterEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", util.CertRotationJitterEnv, err)
+	}
+
+	interval, err := minSyncInterval(os.Getenv(util.CertMinSyncIntervalEnv))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", util.CertMinSyncIntervalEnv, err)
+	}
+
+	cm, err := NewStandaloneCertManager(k8sClient, installNamespace, CertManagerOptions{
+		AdditionalNamespaces: additionalNamespaces,
+		ExtClient:            extClient,
+		Client:               mgr.GetClient(),
+		CRReader:             mgr.GetAPIReader(),
+		SyncDebounce:         debounce,
+		RotationJitter:       jitter,
+		MinSyncInterval:      interval,
+		PersistHistory:       true,
+		PublishCertState:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// so we can start caches
+	if err = mgr.Add(cm); err != nil {
+		return nil, err
+	}
+
+	return cm, nil
+}
+
+// newCertManager creates the cert manager, crReader is used to report the events on the MaroonedPods CR
+// when the operator has neither a pod nor a Deployment to report them on
+func newCertManager(client kubernetes.Interface, crReader client.Reader, installNamespace string, additionalNamespaces ...string) *certManager {
+	namespaces := append(additionalNamespaces, installNamespace)
+	informers := v1helpers.NewKubeInformersForNamespaces(client, namespaces...)
+
+	controllerRef := eventReference(context.TODO(), client, crReader, installNamespace)
+	eventRecorder := events.NewRecorder(client.CoreV1().Events(installNamespace), installNamespace, controllerRef)
+
+	return &certManager{
+		namespaces:     namespaces,
+		k8sClient:      client,
+		informers:      informers,
+		eventRecorder:  eventRecorder,
+		parseCache:     newCertParseCache(),
+		clock:          clock.RealClock{},
+		tracer:         noopTracer(),
+		certStore:      secretCertStore{},
+		transientRetry: defaultTransientRetry,
+	}
+}
+
+func (cm *certManager) Start(ctx context.Context) error {
+	// the manager starts it again with a new context when the operator regains the leadership,
+	// a Sync of the previous term may still be running
+	cm.startLock.Lock()
+	defer cm.startLock.Unlock()
+
+	cm.listersLock.Lock()
+	if cm.startedCtx != nil && cm.startedCtx != ctx {
+		// the informers stop with the context of the previous Start and the factories don't run them again
+		log.Info("Restarting the informers of the cert manager")
+		cm.informers = v1helpers.NewKubeInformersForNamespaces(cm.k8sClient, cm.namespaces...)
+		if cm.guest != nil {
+			cm.guest.informers = v1helpers.NewKubeInformersForNamespaces(cm.guest.k8sClient, cm.guest.namespaces...)
+		}
+		cm.listerMap = nil
+		cm.startedCtx = nil
+		cm.resetDebounce()
+	}
+	listerMap := make(map[clusterNamespace]*certListers, len(cm.listerMap))
+	for key, listers := range cm.listerMap {
+		listerMap[key] = listers
+	}
+	informers := cm.informers
+	cm.listersLock.Unlock()
+
+	if err := startListers(ctx, informers, mpcerts.ManagementCluster, cm.namespaces, listerMap, cm.informerHandler()); err != nil {
+		return err
+	}
+	if err := cm.startGuest(ctx, listerMap); err != nil {
+		return err
+	}
+	// the permissions may have changed while the operator didn't hold the leadership
+	cm.resetPreflight()
+	cm.refreshPreflight(nil)
+
+	cm.listersLock.Lock()
+	defer cm.listersLock.Unlock()
+	cm.listerMap = listerMap
+	cm.startedCtx = ctx
+	return nil
+}
+
+// started reports whether the caches of the last Start synced and its context isn't done
+func (cm *certManager) started() bool {
+	cm.listersLock.RLock()
+	defer cm.listersLock.RUnlock()
+	return cm.startedCtx != nil && cm.startedCtx.Err() == nil
+}
+
+// checkAborted returns the error of the context of the last Start wrapped once it is done, or
+// context.Canceled if another Start is restarting the informers, so that a Sync stops between its steps
+func (cm *certManager) checkAborted() error {
+	cm.listersLock.RLock()
+	ctx := cm.startedCtx
+	cm.listersLock.RUnlock()
+	if ctx == nil {
+		return fmt.Errorf("certificate sync aborted: %w", context.Canceled)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("certificate sync aborted: %w", err)
+	}
+	return nil
+}
+
+// listers returns the listers by cluster and namespace. The map is replaced, never modified, so it can
+// be read without the lock.
+func (cm *certManager) listers() map[clusterNamespace]*certListers {
+	cm.listersLock.RLock()
+	defer cm.listersLock.RUnlock()
+	return cm.listerMap
+}
+
+// listersFor returns the listers of the namespace, ErrNamespaceNotSynced for a managed namespace
+// without listers yet
+func (cm *certManager) listersFor(key clusterNamespace) (*certListers, error) {
+	if listers, ok := cm.listers()[key]; ok {
+		return listers, nil
+	}
+	for _, managed := range cm.clusterNamespaces() {
+		if managed == key {
+			return nil, fmt.Errorf("namespace %s: %w", key.namespace, ErrNamespaceNotSynced)
+		}
+	}
+	return nil, fmt.Errorf("no lister for namespace %s", key.namespace)
+}
+
+// updateListers replaces the listers with a copy modified by update
+func (cm *certManager) updateListers(update func(listerMap map[clusterNamespace]*certListers, informers v1helpers.KubeInformersForNamespaces)) {
+	cm.listersLock.Lock()
+	defer cm.listersLock.Unlock()
+	listerMap := make(map[clusterNamespace]*certListers, len(cm.listerMap))
+	for key, listers := range cm.listerMap {
+		listerMap[key] = listers
+	}
+	update(listerMap, cm.informers)
+	cm.listerMap = listerMap
+}
+
+// startListers starts the secret informers of the namespaces through the factory and adds their listers
+// to listerMap once they synced. The namespaces that already have listers are skipped and the factory
+// only starts the informers it didn't start yet, so calling it again doesn't add watches. The handler
+// is added to the informers it starts.
+func startListers(ctx context.Context, informers v1helpers.KubeInformersForNamespaces, cluster mpcerts.Cluster, namespaces []string, listerMap map[clusterNamespace]*certListers, handler toolscache.ResourceEventHandler) error {
+	var pending []string
+	var synced []toolscache.InformerSynced
+	for _, ns := range namespaces {
+		if _, ok := listerMap[clusterNamespace{cluster: cluster, namespace: ns}]; ok {
+			continue
+		}
+		pending = append(pending, ns)
+		// requested before starting the factory, it only starts the requested informers
+		informer := informers.InformersFor(ns).Core().V1().Secrets().Informer()
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	informers.Start(ctx.Done())
+	if !toolscache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("could not sync informer cache")
+	}
+
+	for _, ns := range pending {
+		listerMap[clusterNamespace{cluster: cluster, namespace: ns}] = newListers(informers, ns)
+	}
+	return nil
+}
+
+func newListers(informers v1helpers.KubeInformersForNamespaces, ns string) *certListers {
+	return &certListers{
+		secretLister: informers.InformersFor(ns).Core().V1().Secrets().Lister(),
+	}
+}
+
+// startConfigMapLister starts the configmap informer of the bundle namespace of the definition unless it
+// runs already. ConfigMaps are only watched in the namespaces with bundles, most managed namespaces
+// only host target secrets and their configmaps would be cached for nothing.
+func (cm *certManager) startConfigMapLister(cd mpcerts.CertificateDefinition) error {
+	if cd.CertBundleConfigmap == nil {
+		return nil
+	}
+	key := clusterNamespace{cluster: cd.BundleCluster, namespace: cd.CertBundleConfigmap.Namespace}
+	return cm.startLister(key, "configmap", cm.informerHandler(), func(listers *certListers) bool {
+		return listers.configMapLister != nil
+	}, func(factory informers.SharedInformerFactory, listers *certListers) toolscache.SharedIndexInformer {
+		listers.configMapLister = factory.Core().V1().ConfigMaps().Lister()
+		return factory.Core().V1().ConfigMaps().Informer()
+	})
+}
+
+// startServiceLister starts the service informer of the target namespace of a serving certificate unless it
+// runs already. The services only matter to the warning of a missing target service, their events don't
+// count as changes of the certificate objects.
+func (cm *certManager) startServiceLister(cd mpcerts.CertificateDefinition) error {
+	if cd.TargetService == nil {
+		return nil
+	}
+	key := clusterNamespace{namespace: cd.TargetSecret.Namespace}
+	return cm.startLister(key, "service", nil, func(listers *certListers) bool {
+		return listers.serviceLister != nil
+	}, func(factory informers.SharedInformerFactory, listers *certListers) toolscache.SharedIndexInformer {
+		listers.serviceLister = factory.Core().V1().Services().Lister()
+		return factory.Core().V1().Services().Informer()
+	})
+}
+
+// startLister starts the informer of the namespace of key that add sets the lister of, unless started tells
+// it runs already, and replaces the listers of the namespace by a copy with the lister once it synced
+func (cm *certManager) startLister(key clusterNamespace, resource string, handler toolscache.ResourceEventHandler,
+	started func(listers *certListers) bool, add func(factory informers.SharedInformerFactory, listers *certListers) toolscache.SharedIndexInformer) error {
+	listers, err := cm.listersFor(key)
+	if err != nil {
+		return err
+	}
+	if started(listers) {
+		return nil
+	}
+
+	cm.listersLock.RLock()
+	ctx, namespaceInformers := cm.startedCtx, cm.informers
+	if key.cluster == mpcerts.GuestCluster {
+		namespaceInformers = cm.guest.informers
+	}
+	cm.listersLock.RUnlock()
+	if ctx == nil {
+		return cm.checkAborted()
+	}
+
+	factory := namespaceInformers.InformersFor(key.namespace)
+	if factory == nil {
+		return fmt.Errorf("no informers for namespace %s", key.namespace)
+	}
+	updated := *listers
+	// requested before starting the factory, it only starts the requested informers
+	informer := add(factory, &updated)
+	if handler != nil {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return err
+		}
+	}
+	factory.Start(ctx.Done())
+	if !toolscache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("could not sync the %s informer cache of namespace %s: %w", resource, key.namespace, ctx.Err())
+	}
+	log.Info("Started the "+resource+" informer", "namespace", key.namespace, "cluster", key.cluster)
+
+	replaced := false
+	cm.updateListers(func(listerMap map[clusterNamespace]*certListers, _ v1helpers.KubeInformersForNamespaces) {
+		// a restart or the termination of the namespace replaced the listers meanwhile
+		if listerMap[key] != listers {
+			return
+		}
+		listerMap[key] = &updated
+		replaced = true
+	})
+	if !replaced {
+		return fmt.Errorf("the listers of namespace %s changed while starting its %s informer", key.namespace, resource)
+	}
+	return nil
+}
+
+func (cm *certManager) Sync(ctx context.Context, certs []mpcerts.CertificateDefinition) (err error) {
+	if !cm.started() {
+		return ErrNotStarted
+	}
+	cm.syncLock.Lock()
+	defer cm.syncLock.Unlock()
+
+	ctx, span := cm.tracer.Start(ctx, spanSync, trace.WithAttributes(attrDefinitions.Int(len(certs))))
+	defer func() { endSpan(span, err) }()
+	ctx, endRetryBudget := withRetryBudget(ctx)
+	defer endRetryBudget()
+
+	certs, err = normalizeDefinitions(certs)
+	if err != nil {
+		return err
+	}
+
+	hash, hashErr := definitionsHash(certs)
+	if hashErr != nil {
+		log.Error(hashErr, "Failed to hash the definitions, the sync isn't debounced")
+	}
+	if cm.throttled(hash) {
+		log.V(1).Info("Skipping the sync, the last one of the definitions is too recent", "minSyncInterval", cm.minSyncInterval)
+		span.SetAttributes(attrThrottled.Bool(true))
+		return nil
+	}
+	skip, state := cm.debounced(hash)
+	if skip {
+		log.V(1).Info("Skipping the sync, the definitions and their objects didn't change since the last one")
+		span.SetAttributes(attrDebounced.Bool(true))
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		cm.recordDebounce(certs, state, err)
+		cm.reportAdoptions()
+		cm.nextRefresh = cm.nextRefreshIn(certs)
+		cm.recordSyncStatus(certs, err)
+		cm.persistHistory()
+		// only for the gauge, the reasons are reported by the sync
+		_, _ = cm.NextRotations(context.TODO())
+		cm.publishCertState()
+		observeSync(start, err)
+	}()
+
+	cm.refreshTerminatingNamespaces()
+	cm.refreshAbsentNamespaces()
+	cm.refreshPreflight(certs)
+	cm.discoverConsumers(certs)
+
+	errs, err := cm.syncDefinitions(ctx, certs)
+	if err != nil {
+		return err
+	}
+
+	if err := cm.pruneClusterTrustBundles(certs); err != nil {
+		errs = append(errs, err)
+	}
+
+	// a target left behind by a partially failed sync still verifies against the older CAs of the
+	// bundle, library-go only re-issues it once they age out
+	if err := cm.verifyChains(ctx, certs); err != nil {
+		errs = append(errs, err)
+	}
+	// the clientConfig of a webhook may call another service than the target was issued for
+	if err := cm.verifyWebhookCerts(certs); err != nil {
+		errs = append(errs, err)
+	}
+
+	return cm.checkStuckRotations(certs, utilerrors.NewAggregate(errs))
+}
+
+// syncDefinitions issues the certificates of the definitions and propagates their bundles. It returns
+// the errors of the definitions the sync kept going after, and the error that stopped it.
+func (cm *certManager) syncDefinitions(ctx context.Context, certs []mpcerts.CertificateDefinition) ([]error, error) {
+	var errs []error
+	for _, cd := range certs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := cm.checkAborted(); err != nil {
+			return nil, err
+		}
+		ctx, endDefinition := cm.startDefinitionSpan(ctx, cd)
+		rotations := cm.rotationCount
+		// records the outcome of the definition and ends its span
+		done := func(err error) {
+			cm.recordSync(cd, err, cm.rotationCount > rotations)
+			endDefinition(err)
+		}
+		// keep going, the other definitions may be valid
+		if err := cd.Validate(); err != nil {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+		if err := checkFIPSCompliance(cd); err != nil {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+		if err := cm.checkClusters(cd); err != nil {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+		if err := cm.checkAPIServices(cd); err != nil {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+		if err := cm.checkPreflight(cd); err != nil {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+
+		if ns := cm.absentNamespaceOfDefinition(cd); ns != "" {
+			cm.recordSuspension(cd, ns)
+			endDefinition(nil)
+			continue
+		}
+		if cm.inTerminatingNamespace(cd) {
+			endDefinition(nil)
+			continue
+		}
+		// keep going, the other definitions may have their bundles elsewhere
+		if err := cm.startConfigMapLister(cd); err != nil {
+			done(err)
+			if abortErr := cm.checkAborted(); abortErr != nil {
+				return nil, abortErr
+			}
+			// the namespace is not ready, not misconfigured
+			if goerrors.Is(err, ErrNamespaceNotSynced) {
+				return nil, err
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		if cd.Issuer == nil {
+			if err := (&certManagerBackend{cm: cm}).release(cd); err != nil {
+				done(err)
+				return nil, err
+			}
+		}
+
+		bundle, err := cm.backendFor(cd).issue(ctx, cd)
+		// keep going, the namespace is about to be gone with the objects of the definition
+		if cm.skipTerminatingNamespace(cd, err) {
+			done(nil)
+			continue
+		}
+		// keep going, the namespace was deleted and its definitions are suspended until it is recreated
+		if cm.skipAbsentNamespace(cd, err) {
+			endDefinition(nil)
+			continue
+		}
+		// not a failed rotation, the next sync completes the definition
+		if goerrors.Is(err, context.Canceled) || goerrors.Is(err, ErrNamespaceNotSynced) {
+			done(err)
+			return nil, err
+		}
+		cm.recordRotation(cd, err)
+		// keep going, the bundle failed to propagate and the next sync publishes the CA again
+		var publicationErr *caPublicationError
+		if goerrors.As(err, &publicationErr) {
+			done(err)
+			errs = append(errs, err)
+			continue
+		}
+		if err != nil {
+			done(err)
+			return nil, cm.checkStuckRotations(certs, err)
+		}
+		cm.clearRotationReasons(cd)
+		if cm.rotationCount > rotations {
+			cm.reportRotationConsumers(cd)
+		}
+
+		// the next sync propagates the bundle the target was issued with
+		if err := cm.checkAborted(); err != nil {
+			done(err)
+			return nil, err
+		}
+
+		// keep going, the other definitions don't depend on the bundle consumers
+		var attributes []attribute.KeyValue
+		if bundleConfigMap := cd.CertBundleConfigmap; bundleConfigMap != nil {
+			attributes = configMapAttributes(bundleConfigMap.Namespace, bundleConfigMap.Name)
+		}
+		err = cm.traceStep(ctx, spanPropagateBundle, func(ctx context.Context) error {
+			return cm.propagateBundle(ctx, cd, bundle)
+		}, attributes...)
+		done(err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs, nil
+}
+
+func (cm *certManager) backendFor(cd mpcerts.CertificateDefinition) issuanceBackend {
+	if cd.External {
+		return &externalBackend{cm: cm}
+	}
+	if cd.Issuer != nil {
+		return &certManagerBackend{cm: cm}
+	}
+	return cm
+}
+
+// issue rotates the certificates of the definition with the built-in signer
+func (cm *certManager) issue(ctx context.Context, cd mpcerts.CertificateDefinition) ([]*x509.Certificate, error) {
+	var ca *crypto.CA
+	err := cm.traceStep(ctx, spanEnsureSigner, func(ctx context.Context) (err error) {
+		ca, err = cm.ensureSigner(ctx, cd)
+		return err
+	}, secretAttributes(cd.SignerSecret.Namespace, cd.SignerSecret.Name)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cd.CertBundleConfigmap == nil {
+		return nil, nil
+	}
+
+	// a rotated signer is safe without its bundle, the next sync adds it before issuing a target with it
+	if err := cm.checkAborted(); err != nil {
+		return nil, err
+	}
+	var bundle []*x509.Certificate
+	err = cm.traceStep(ctx, spanEnsureCertBundle, func(ctx context.Context) (err error) {
+		bundle, err = cm.ensureCertBundle(ctx, cd, ca)
+		return err
+	}, configMapAttributes(cd.CertBundleConfigmap.Namespace, cd.CertBundleConfigmap.Name)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if cd.TargetSecret == nil {
+		return bundle, nil
+	}
+
+	if err := cm.checkAborted(); err != nil {
+		return nil, err
+	}
+
+	// the verifiers trust the CA before the target presents a certificate issued by it
+	ready, publishErr := cm.publishCA(ctx, cd, ca, bundle)
+	if !ready {
+		return bundle, publishErr
+	}
+
+	if err := cm.traceStep(ctx, spanEnsureTarget, func(ctx context.Context) error {
+		return cm.ensureTarget(ctx, cd, ca, bundle)
+	}, secretAttributes(cd.TargetSecret.Namespace, cd.TargetSecret.Name)...); err != nil {
+		return nil, err
+	}
+
+	return bundle, publishErr
+}
+
+func (cm *certManager) ensureSigner(ctx context.Context, cd mpcerts.CertificateDefinition) (*crypto.CA, error) {
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.SignerSecret.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	lister := listers.secretLister
+	secret, err := lister.Secrets(cd.SignerSecret.Namespace).Get(cd.SignerSecret.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		secret, err = cm.createSecret(ctx, cd.SignerSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if isRotationPaused(secret) {
+		return cm.pausedSigner(cd, secret)
+	}
+
+	if secret, err = cm.ensureSecretType(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	if secret, err = cm.ensureSecretLabels(ctx, secret, cd.SignerSecret); err != nil {
+		return nil, err
+	}
+
+	if secret, err = cm.recoverCorruptedSigner(cd, secret); err != nil {
+		return nil, err
+	}
+
+	// the target was signed with the key of the signer
+	if cm.forceFIPSReissue(cd, secret) && cd.TargetSecret != nil {
+		cm.forceRotation(cd.TargetSecret, rotationReasonFIPS)
+	}
+
+	if secret, err = cm.ensureCertConfig(ctx, secret, newSerializedCertConfig(cd.SignerConfig)); err != nil {
+		return nil, err
+	}
+
+	// library-go signs with the key of the secret
+	if secret, err = cm.withStoredKeyPair(signerRef(cd), secret); err != nil {
+		return nil, err
+	}
+
+	sr := certrotation.RotatedSigningCASecret{
+		Name:          secret.Name,
+		Namespace:     secret.Namespace,
+		Validity:      cd.SignerConfig.Lifetime,
+		Refresh:       cm.jittered(cd.SignerSecret, cd.SignerConfig).Refresh,
+		Lister:        &updatedSecretLister{SecretLister: lister, secret: secret},
+		Client:        cm.rotationRecordingClient(backdatingClient(cm.keyStoreClient(signerRef(cd), cm.coreClient(mpcerts.ManagementCluster)), cd.SignerConfig.Backdate, nil)),
+		EventRecorder: cm.eventRecorder,
+	}
+
+	ca, err := sr.EnsureSigningCertKeyPair(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca, nil
+}
+
+// updatedSecretLister serves the secret the operator just wrote, the informer may not have seen
+// the update yet and the rotation would be based on the stale copy
+type updatedSecretLister struct {
+	listerscorev1.SecretLister
+	secret *corev1.Secret
+}
+
+func (l *updatedSecretLister) Secrets(namespace string) listerscorev1.SecretNamespaceLister {
+	nsLister := &updatedSecretNamespaceLister{SecretNamespaceLister: l.SecretLister.Secrets(namespace)}
+	if l.secret.Namespace == namespace {
+		nsLister.secret = l.secret
+	}
+	return nsLister
+}
+
+type updatedSecretNamespaceLister struct {
+	listerscorev1.SecretNamespaceLister
+	secret *corev1.Secret
+}
+
+func (l *updatedSecretNamespaceLister) Get(name string) (*corev1.Secret, error) {
+	if l.secret != nil && l.secret.Name == name {
+		return l.secret, nil
+	}
+	return l.SecretNamespaceLister.Get(name)
+}
+
+// createSecret creates the secret with the labels of the definition, the cleanup finds it by them
+func (cm *certManager) createSecret(ctx context.Context, template *corev1.Secret) (*corev1.Secret, error) {
+	// the key pair of a secret lost in its type migration is kept
+	if restored, err := cm.restoreMigratedSecret(ctx, template); err != nil || restored != nil {
+		return restored, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   template.Name,
+			Labels: template.Labels,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: newTLSSecretData(),
+	}
+
+	return cm.coreClient(mpcerts.ManagementCluster).Secrets(template.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+}
+
+// createConfigMap creates the configmap in the cluster with the labels of the definition, an existing
+// one is left as is
+func (cm *certManager) createConfigMap(ctx context.Context, cluster mpcerts.Cluster, template *corev1.ConfigMap) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   template.Name,
+			Labels: template.Labels,
+		},
+	}
+
+	_, err := cm.coreClient(cluster).ConfigMaps(template.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (cm *certManager) ensureCertConfig(ctx context.Context, secret *corev1.Secret, scc *serializedCertConfig) (*corev1.Secret, error) {
+	configBytes, err := json.Marshal(scc)
+	if err != nil {
+		return nil, err
+	}
+
+	configString := string(configBytes)
+	currentConfig, corrupted := secret.Annotations[annCertConfig], false
+	if currentConfig != configString {
+		if currentConfig, err = canonicalCertConfig(currentConfig); err != nil {
+			corrupted = true
+			cm.warnCorruptedCertConfig(secret, err)
+		}
+	}
+	forcedReason := cm.takeForcedRotation(secret)
+	forced := forcedReason != ""
+	if !forced && !corrupted && currentConfig == configString && !hasLegacyAnnotations(secret) && !isPreserved(secret) {
+		return secret, nil
+	}
+
+	secretCpy := secret.DeepCopy()
+
+	if secretCpy.Annotations == nil {
+		secretCpy.Annotations = make(map[string]string)
+	}
+
+	adopted := adoptPreservedSecret(secretCpy, configString)
+	adopted = adoptLegacySecret(secretCpy, configString) || adopted
+	if adopted {
+		cm.setRotationReason(secret, rotationReasonAdopted)
+	}
+
+	// a corrupted previous config is overwritten, it doesn't tell whether the config changed
+	previousConfig, err := canonicalCertConfig(secretCpy.Annotations[annCertConfig])
+	if changed := err == nil && previousConfig != configString; changed || forced {
+		// force refresh, the validity annotations belong to library-go so they are patched rather than applied
+		if _, ok := secretCpy.Annotations[certrotation.CertificateNotAfterAnnotation]; ok {
+			if secret, err = cm.expireCertificate(ctx, secret); err != nil {
+				return nil, err
+			}
+			if forced {
+				cm.setRotationReason(secret, forcedReason)
+			} else {
+				cm.setRotationReason(secret, rotationReasonConfigChange)
+			}
+		}
+	}
+	secretCpy.Annotations[annCertConfig] = configString
+
+	if secret, err = cm.applySecret(ctx, secret, secretCpy); err != nil {
+		return nil, err
+	}
+
+	if adopted {
+		cm.adopted++
+	}
+
+	return secret, nil
+}
+
+// expireCertificate moves the NotAfter annotation of the secret to now, so library-go rotates it
+func (cm *certManager) expireCertificate(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				certrotation.CertificateNotAfterAnnotation: time.Now().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cm.coreClient(mpcerts.ManagementCluster).Secrets(secret.Namespace).Patch(ctx, secret.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: certFieldManager})
+}
+
+func (cm *certManager) ensureCertBundle(ctx context.Context, cd mpcerts.CertificateDefinition, ca *crypto.CA) ([]*x509.Certificate, error) {
+	configMap := cd.CertBundleConfigmap
+	listers, err := cm.listersFor(clusterNamespace{cluster: cd.BundleCluster, namespace: configMap.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	lister := listers.configMapLister
+	// library-go creates the bundle without labels
+	if _, err := lister.ConfigMaps(configMap.Namespace).Get(configMap.Name); errors.IsNotFound(err) {
+		if err := cm.createConfigMap(ctx, cd.BundleCluster, configMap); err != nil {
+			return nil, err
+		}
+	}
+	br := certrotation.CABundleConfigMap{
+		Name:          configMap.Name,
+		Namespace:     configMap.Namespace,
+		Lister:        lister,
+		Client:        cm.coreClient(cd.BundleCluster),
+		EventRecorder: cm.recorder(cd.BundleCluster),
+	}
+
+	if _, err := br.EnsureConfigMapCABundle(ctx, ca); err != nil {
+		return nil, err
+	}
+
+	certs, err := cm.ensureCAInBundle(ctx, cd.BundleCluster, configMap.Namespace, configMap.Name, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	if certs, err = cm.enforceMaxBundleCAs(cd, ca, certs); err != nil {
+		return nil, err
+	}
+
+	if certs, err = cm.syncKubeRootCA(cd, certs); err != nil {
+		return nil, err
+	}
+
+	// after library-go, it writes back the labels of the lister copy
+	if err := cm.adoptPreservedBundle(cd.BundleCluster, configMap.Namespace, configMap.Name); err != nil {
+		return nil, err
+	}
+
+	if err := cm.ensureConfigMapLabels(ctx, cd.BundleCluster, configMap); err != nil {
+		return nil, err
+	}
+
+	if err := cm.ensureTruststore(ctx, cd); err != nil {
+		return nil, err
+	}
+
+	if err := cm.syncTrustBundle(cd, certs); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+func (cm *certManager) ensureTarget(ctx context.Context, cd mpcerts.CertificateDefinition, ca *crypto.CA, bundle []*x509.Certificate) error {
+	if err := cm.checkTargetService(cd); err != nil {
+		return err
+	}
+
+	listers, err := cm.listersFor(clusterNamespace{namespace: cd.SignerSecret.Namespace})
+	if err != nil {
+		return err
+	}
+	lister := listers.secretLister
+	secret, err := lister.Secrets(cd.TargetSecret.Namespace).Get(cd.TargetSecret.Name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		secret, err = cm.createSecret(ctx, cd.TargetSecret)
+		if err != nil {
+			return err
+		}
+	} else if isRotationPaused(secret) || cm.signerPaused(cd) {
+		// the target would be re-issued by the rotation of the signer
+		cm.warnPausedRotation(secret, cd.TargetConfig)
+		return nil
+	}
+
+	if secret, err = cm.ensureSecretType(ctx, secret); err != nil {
+		return err
+	}
+
+	if secret, err = cm.ensureSecretLabels(ctx, secret, cd.TargetSecret); err != nil {
+		return err
+	}
+
+	cm.forceFIPSReissue(cd, secret)
+
+	if secret, err = cm.ensureCertConfig(ctx, secret, targetCertConfig(cd)); err != nil {
+		return err
+	}
+
+	var targetCreator certrotation.TargetCertCreator
+	if cd.TargetService != nil {
+		// a change of the discovered hosts re-issues the target
+		hostnames, err := cm.servingHostnames(cd, secret.Namespace)
+		if err != nil {
+			return err
+		}
+		targetCreator = &certrotation.ServingRotation{
+			Hostnames: func() []string {
+				return hostnames
+			},
+			CertificateExtensionFn: []crypto.CertificateExtensionFunc{
+				setExtKeyUsages(cd.ExtendedKeyUsages),
+			},
+		}
+	} else {
+		if cd.TargetUser == nil {
+			return fmt.Errorf("%w: target secret %s/%s has neither a target service nor a target user", mpcerts.ErrInvalidDefinition, cd.TargetSecret.Namespace, cd.TargetSecret.Name)
+		}
+		targetCreator = &certrotation.ClientRotation{
+			UserInfo: &user.DefaultInfo{Name: *cd.TargetUser, Groups: cd.TargetGroups},
+		}
+		// the client rotation has no extension point
+		if cd.ExtendedKeyUsages != "" && cd.ExtendedKeyUsages != mpcerts.ExtendedKeyUsagesClient {
+			targetCreator = &extKeyUsagesRotation{
+				TargetCertCreator: targetCreator,
+				extKeyUsages:      cd.ExtendedKeyUsages,
+			}
+		}
+	}
+
+	if secret, err = cm.withStoredKeyPair(targetRef(cd), secret); err != nil {
+		return err
+	}
+
+	// the store takes the key out before the output formats and the split key see it
+	tr := certrotation.RotatedSelfSignedCertKeySecret{
+		Name:          secret.Name,
+		Namespace:     secret.Namespace,
+		Validity:      cd.TargetConfig.Lifetime,
+		Refresh:       cm.jittered(cd.TargetSecret, cd.TargetConfig).Refresh,
+		CertCreator:   targetCreator,
+		Lister:        &updatedSecretLister{SecretLister: lister, secret: secret},
+		Client:        cm.rotationRecordingClient(backdatingClient(cm.keyStoreClient(targetRef(cd), cm.targetSecretsClient(cd)), cd.TargetConfig.Backdate, ca)),
+		EventRecorder: cm.eventRecorder,
+	}
+
+	if err := tr.EnsureTargetCertKeyPair(ctx, ca, bundle); err != nil {
+		return err
+	}
+
+	if err := cm.ensureDerivedKeys(ctx, cd); err != nil {
+		return err
+	}
+
+	return cm.ensureSplitKey(ctx, cd)
+}
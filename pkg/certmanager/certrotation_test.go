@@ -0,0 +1,324 @@
+package certmanager
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+func newCertManagerForTest(client kubernetes.Interface, namespace string) CertManager {
+	addApplyReactor(client)
+	allowAccessReviews(client)
+	cm := newCertManager(client, nil, namespace)
+	cm.extClient = extfake.NewSimpleClientset()
+	cm.client = crfake.NewClientBuilder().Build()
+	return cm
+}
+
+func toSerializedCertConfig(l, r time.Duration) string {
+	scc := &serializedCertConfig{
+		Lifetime: l.String(),
+		Refresh:  r.String(),
+	}
+
+	bs, err := json.Marshal(scc)
+	Expect(err).ToNot(HaveOccurred())
+	return string(bs)
+}
+
+func getCertNotBefore(client kubernetes.Interface, namespace, name string) time.Time {
+	s, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	Expect(err).ToNot(HaveOccurred())
+	val, ok := s.Annotations[certrotation.CertificateNotBeforeAnnotation]
+	Expect(ok).To(BeTrue())
+	t, err := time.Parse(time.RFC3339, val)
+	Expect(err).ToNot(HaveOccurred())
+	return t
+}
+
+func getCertConfigAnno(client kubernetes.Interface, namespace, name string) string {
+	s, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	Expect(err).ToNot(HaveOccurred())
+	val, ok := s.Annotations[annCertConfig]
+	Expect(ok).To(BeTrue())
+	return val
+}
+
+// waitForSecretInLister waits until the informer of the cert manager caught up with the secret,
+// the fake client doesn't set resource versions so the content is compared
+func waitForSecretInLister(cm CertManager, expected *corev1.Secret) {
+	Eventually(func() bool {
+		secret, err := cm.(*certManager).listerMap[clusterNamespace{namespace: expected.Namespace}].secretLister.Secrets(expected.Namespace).Get(expected.Name)
+		if err != nil {
+			return false
+		}
+		return equality.Semantic.DeepEqual(secret.Annotations, expected.Annotations) &&
+			equality.Semantic.DeepEqual(secret.Data, expected.Data)
+	}, 5*time.Second, 100*time.Millisecond).Should(BeTrue())
+}
+
+func checkSecret(client kubernetes.Interface, namespace, name string, exists bool) {
+	s, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if !exists {
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		return
+	}
+	Expect(err).ToNot(HaveOccurred())
+	Expect(s.Data["tls.crt"]).ShouldNot(BeEmpty())
+	Expect(s.Data["tls.crt"]).ShouldNot(BeEmpty())
+}
+
+func checkConfigMap(client kubernetes.Interface, namespace, name string, exists bool) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if !exists {
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		return
+	}
+	Expect(cm.Data["ca-bundle.crt"]).ShouldNot(BeEmpty())
+}
+
+func checkCerts(client kubernetes.Interface, namespace string, exists bool) {
+	checkSecret(client, namespace, "maroonedpods-server", exists)
+	checkConfigMap(client, namespace, "maroonedpods-server-signer-bundle", exists)
+	checkSecret(client, namespace, util.SecretResourceName, exists)
+}
+
+var _ = Describe("Cert rotation tests", func() {
+	const namespace = "maroonedpods"
+
+	pt := func(d time.Duration) *time.Duration {
+		return &d
+	}
+
+	Context("with clean slate", func() {
+		It("should create everything", func() {
+			client := fake.NewSimpleClientset()
+			cm := newCertManagerForTest(client, namespace)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+			checkCerts(client, namespace, false)
+
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			err := cm.Sync(context.TODO(), certs)
+			Expect(err).ToNot(HaveOccurred())
+
+			checkCerts(client, namespace, true)
+
+			certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			err = cm.Sync(context.TODO(), certs)
+			Expect(err).ToNot(HaveOccurred())
+
+			checkCerts(client, namespace, true)
+
+			cancel()
+		})
+
+		It("should update certs", func() {
+			client := fake.NewSimpleClientset()
+			cm := newCertManagerForTest(client, namespace)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			err := cm.Sync(context.TODO(), certs)
+			Expect(err).ToNot(HaveOccurred())
+
+			apiCA := getCertNotBefore(client, namespace, "maroonedpods-server")
+			apiServer := getCertNotBefore(client, namespace, util.SecretResourceName)
+
+			n := time.Now()
+
+			args := &cert.FactoryArgs{
+				Namespace:         namespace,
+				SignerDuration:    pt(50 * time.Hour),
+				SignerRenewBefore: pt(25 * time.Hour),
+				TargetDuration:    pt(26 * time.Hour),
+				TargetRenewBefore: pt(13 * time.Hour),
+			}
+
+			certs = cert.CreateCertificateDefinitions(args)
+			err = cm.Sync(context.TODO(), certs)
+			Expect(err).ToNot(HaveOccurred())
+
+			apiCA2 := getCertNotBefore(client, namespace, "maroonedpods-server")
+			apiServer2 := getCertNotBefore(client, namespace, util.SecretResourceName)
+
+			Expect(apiCA2.After(n))
+			Expect(apiServer2.After(n))
+
+			Expect(apiCA2.After(apiCA))
+			Expect(apiServer2.After(apiServer))
+
+			apiCAConfig2 := getCertConfigAnno(client, namespace, "maroonedpods-server")
+			apiServerConfig2 := getCertConfigAnno(client, namespace, util.SecretResourceName)
+
+			scc := toSerializedCertConfig(50*time.Hour, 25*time.Hour)
+			scc2 := toSerializedCertConfig(26*time.Hour, 13*time.Hour)
+
+			Expect(apiCAConfig2).To(Equal(scc))
+			Expect(apiServerConfig2).To(Equal(scc2))
+
+		})
+	})
+
+	Context("with a client target", func() {
+		const controllersGroup = "system:maroonedpods:controllers"
+
+		var (
+			client *fake.Clientset
+			cm     CertManager
+			cancel context.CancelFunc
+		)
+
+		newClientCerts := func(groups ...string) []cert.CertificateDefinition {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			certs[0].TargetService = nil
+			certs[0].TargetUser = &[]string{"maroonedpods-controller"}[0]
+			certs[0].TargetGroups = groups
+			return certs
+		}
+
+		getLeaf := func() *x509.Certificate {
+			s, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			certs, err := crypto.CertsFromPEM(s.Data["tls.crt"])
+			Expect(err).ToNot(HaveOccurred())
+			return certs[0]
+		}
+
+		// authenticate maps a verified client certificate to the user the API server sees
+		authenticate := func(leaf *x509.Certificate) user.Info {
+			cm, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "maroonedpods-server-signer-bundle", metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			roots := x509.NewCertPool()
+			Expect(roots.AppendCertsFromPEM([]byte(cm.Data["ca-bundle.crt"]))).To(BeTrue())
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+			Expect(err).ToNot(HaveOccurred())
+			return &user.DefaultInfo{Name: leaf.Subject.CommonName, Groups: leaf.Subject.Organization}
+		}
+
+		bound := func(u user.Info, binding *rbacv1.ClusterRoleBinding) bool {
+			for _, subject := range binding.Subjects {
+				switch subject.Kind {
+				case rbacv1.UserKind:
+					if subject.Name == u.GetName() {
+						return true
+					}
+				case rbacv1.GroupKind:
+					for _, group := range u.GetGroups() {
+						if subject.Name == group {
+							return true
+						}
+					}
+				}
+			}
+			return false
+		}
+
+		binding := &rbacv1.ClusterRoleBinding{
+			Subjects: []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: controllersGroup}},
+		}
+
+		BeforeEach(func() {
+			client = fake.NewSimpleClientset()
+			cm = newCertManagerForTest(client, namespace)
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should issue certificates without groups by default", func() {
+			Expect(cm.Sync(context.TODO(), newClientCerts())).To(Succeed())
+
+			leaf := getLeaf()
+			Expect(leaf.Subject.CommonName).To(Equal("maroonedpods-controller"))
+			Expect(leaf.Subject.Organization).To(BeEmpty())
+			Expect(getCertConfigAnno(client, namespace, util.SecretResourceName)).To(Equal(toSerializedCertConfig(24*time.Hour, 12*time.Hour)))
+			Expect(bound(authenticate(leaf), binding)).To(BeFalse())
+		})
+
+		It("should write the groups into the organization", func() {
+			Expect(cm.Sync(context.TODO(), newClientCerts(controllersGroup, "system:authenticated"))).To(Succeed())
+
+			leaf := getLeaf()
+			Expect(leaf.Subject.Organization).To(ConsistOf(controllersGroup, "system:authenticated"))
+			Expect(bound(authenticate(leaf), binding)).To(BeTrue())
+		})
+
+		It("should re-issue the certificate when the groups change", func() {
+			Expect(cm.Sync(context.TODO(), newClientCerts("system:authenticated"))).To(Succeed())
+			s, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			waitForSecretInLister(cm, s)
+
+			Expect(cm.Sync(context.TODO(), newClientCerts(controllersGroup))).To(Succeed())
+
+			Expect(getLeaf().Subject.Organization).To(ConsistOf(controllersGroup))
+		})
+	})
+
+	Context("with invalid definitions", func() {
+		It("should reject a target without a service or a user", func() {
+			client := fake.NewSimpleClientset()
+			cm := newCertManagerForTest(client, namespace)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(cm.(*certManager).Start(ctx)).To(Succeed())
+
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			certs[0].TargetService = nil
+			certs[0].TargetUser = nil
+
+			Expect(certs[0].Validate()).To(MatchError(cert.ErrInvalidDefinition))
+
+			err := cm.Sync(context.TODO(), certs)
+			Expect(err).To(MatchError(cert.ErrInvalidDefinition))
+			Expect(err.Error()).To(ContainSubstring(namespace + "/" + util.SecretResourceName))
+
+			_, err = client.CoreV1().Secrets(namespace).Get(context.TODO(), util.SecretResourceName, metav1.GetOptions{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("should reject a target with both a service and a user", func() {
+			certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+			certs[0].TargetUser = &[]string{"maroonedpods-controller"}[0]
+
+			Expect(certs[0].Validate()).To(MatchError(cert.ErrInvalidDefinition))
+		})
+
+		It("should accept the default definitions", func() {
+			for _, cd := range cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}) {
+				Expect(cd.Validate()).To(Succeed())
+			}
+		})
+	})
+})
@@ -0,0 +1,62 @@
+package certmanager_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+)
+
+func ExampleNewStandaloneCertManager() {
+	// any kubernetes.Interface, e.g. kubernetes.NewForConfig of the config of the operator
+	client := fake.NewSimpleClientset()
+	allowAccessReviews(client)
+
+	mgr, err := certmanager.NewStandaloneCertManager(client, "example", certmanager.CertManagerOptions{})
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := mgr.Start(ctx); err != nil {
+		panic(err)
+	}
+
+	service := "api"
+	definitions := []certmanager.CertificateDefinition{{
+		SignerSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "example", Name: "api-signer"},
+			Type:       corev1.SecretTypeTLS,
+		},
+		SignerConfig: certmanager.CertificateConfig{Lifetime: 48 * time.Hour, Refresh: 24 * time.Hour},
+		CertBundleConfigmap: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "example", Name: "api-ca-bundle"},
+		},
+		TargetSecret: &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "example", Name: "api-cert"},
+			Type:       corev1.SecretTypeTLS,
+		},
+		TargetConfig:  certmanager.CertificateConfig{Lifetime: 24 * time.Hour, Refresh: 12 * time.Hour},
+		TargetService: &service,
+	}}
+
+	// on every reconcile of the embedding operator, and again after NextRefreshIn
+	if err := mgr.Sync(ctx, definitions); err != nil {
+		panic(err)
+	}
+
+	target, err := client.CoreV1().Secrets("example").Get(ctx, "api-cert", metav1.GetOptions{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("issued:", len(target.Data[corev1.TLSCertKey]) > 0)
+	fmt.Println("next refresh within a day:", mgr.NextRefreshIn() <= 24*time.Hour)
+	// Output:
+	// issued: true
+	// next refresh within a day: true
+}
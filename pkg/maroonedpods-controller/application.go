@@ -22,6 +22,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/emicklei/go-restful/v3"
+	"github.com/prometheus/client_golang/prometheus"
 	"io/ioutil"
 	k8sv1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +40,8 @@ import (
 	"maroonedpods.io/maroonedpods/pkg/client"
 	"maroonedpods.io/maroonedpods/pkg/informers"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/certwatcher"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
 	golog "log"
 	"net/http"
 	"os"
@@ -58,6 +61,8 @@ type MaroonedPodsControllerApp struct {
 	readyChan                    chan bool
 	enqueueAllGateControllerChan chan struct{}
 	leaderElector                *leaderelection.LeaderElector
+	// the feature gates the operator enabled, the operator rolls the pods when they change
+	featureGates featuregate.Gates
 }
 
 func Execute() {
@@ -88,6 +93,12 @@ func Execute() {
 	}
 	app.host = host
 
+	app.featureGates, err = featuregate.FromEnv()
+	if err != nil {
+		golog.Fatalf("invalid feature gates: %v", err)
+	}
+	klog.Infof("Enabled feature gates: %v", app.featureGates.List())
+
 	app.maroonedpodsCli, err = client.GetMaroonedPodsClient()
 	app.podInformer = informers.GetPodInformer(app.maroonedpodsCli)
 	app.maroonedpodsInformer = informers.GetMaroonedPodsInformer(app.maroonedpodsCli)
@@ -152,6 +163,23 @@ func (mca *MaroonedPodsControllerApp) Run(stop <-chan struct{}) {
 
 	tlsConfig := util.SetupTLS(secretCertManager)
 
+	// the metrics have a certificate of their own, rotated without a restart
+	metricsCert := certwatcher.NewFromInformers(secretInformer, nil, certwatcher.Options{
+		Namespace:  mca.maroonedpodsNs,
+		SecretName: util.ControllerMetricsCertSecretName,
+	})
+	go func() {
+		if err := metricsCert.Start(mca.ctx); err != nil {
+			golog.Fatal(err)
+		}
+	}()
+	go func() {
+		metricsServer := certwatcher.NewMetricsServer(fmt.Sprintf("%s:%d", util.DefaultHost, util.ControllerMetricsPort), metricsCert, prometheus.DefaultGatherer)
+		if err := metricsServer.Start(mca.ctx); err != nil {
+			golog.Fatal(err)
+		}
+	}()
+
 	go func() {
 		server := http.Server{
 			Addr:      fmt.Sprintf("%s:%s", util.DefaultHost, strconv.Itoa(util.DefaultPort)),
@@ -0,0 +1,53 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+const (
+	// certsFinalizerName keeps the MaroonedPods CR until the certificates are cleaned up
+	certsFinalizerName = "operator.maroonedpods.io/certs"
+)
+
+// reconcileCertsFinalizer adds the certificates finalizer to the CR, or cleans up the certificates
+// of a deleted CR and removes the finalizer once they are gone
+func (r *ReconcileMaroonedPods) reconcileCertsFinalizer(mp *v1alpha1.MaroonedPods, logger logr.Logger) error {
+	if mp.DeletionTimestamp == nil {
+		if controllerutil.ContainsFinalizer(mp, certsFinalizerName) {
+			return nil
+		}
+		controllerutil.AddFinalizer(mp, certsFinalizerName)
+		return r.client.Update(context.TODO(), mp)
+	}
+
+	if !controllerutil.ContainsFinalizer(mp, certsFinalizerName) {
+		return nil
+	}
+
+	if preserveCertsOnUninstall(mp) {
+		logger.Info("Preserving the certificates of the deleted MaroonedPods CR")
+		if err := r.certManager.Preserve(); err != nil {
+			r.recorder.Event(mp, corev1.EventTypeWarning, "CertPreserveFailed", err.Error())
+			return err
+		}
+	} else if err := r.certManager.Cleanup(); err != nil {
+		r.recorder.Event(mp, corev1.EventTypeWarning, "CertCleanupFailed", err.Error())
+		return err
+	}
+
+	controllerutil.RemoveFinalizer(mp, certsFinalizerName)
+	return r.client.Update(context.TODO(), mp)
+}
+
+func preserveCertsOnUninstall(mp *v1alpha1.MaroonedPods) bool {
+	if mp.Spec.CertConfig == nil || mp.Spec.CertConfig.PreserveOnUninstall == nil {
+		return false
+	}
+	return *mp.Spec.CertConfig.PreserveOnUninstall
+}
@@ -0,0 +1,199 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	extfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// labelPreserved marks the certificates kept by the uninstall
+const labelPreserved = "operator.maroonedpods.io/preserved"
+
+// newCertManagerForTest creates a cert manager of the namespace, the access reviews it runs before
+// syncing are allowed
+func newCertManagerForTest(client *fake.Clientset, namespace string) certmanager.StandaloneCertManager {
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action testingclient.Action) (bool, runtime.Object, error) {
+		review := action.(testingclient.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		review.Status.Allowed = true
+		return true, review, nil
+	})
+	cm, err := certmanager.NewStandaloneCertManager(client, namespace, certmanager.CertManagerOptions{
+		ExtClient: extfake.NewSimpleClientset(),
+		Client:    crfake.NewClientBuilder().Build(),
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return cm
+}
+
+var _ = Describe("certificate finalizer tests", func() {
+	const (
+		namespace  = "maroonedpods"
+		signerName = "maroonedpods-server"
+		bundleName = "maroonedpods-server-signer-bundle"
+	)
+
+	var (
+		k8sClient *fake.Clientset
+		cm        certmanager.CertManager
+		cancel    context.CancelFunc
+	)
+
+	exists := func(resource, ns, name string) bool {
+		var err error
+		switch resource {
+		case "secrets":
+			_, err = k8sClient.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		case "configmaps":
+			_, err = k8sClient.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).ToNot(HaveOccurred())
+		return true
+	}
+
+	BeforeEach(func() {
+		k8sClient = fake.NewSimpleClientset()
+		standalone := newCertManagerForTest(k8sClient, namespace)
+		cm = standalone
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		Expect(standalone.Start(ctx)).To(Succeed())
+		Expect(cm.Sync(context.TODO(), cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace}))).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	var (
+		crClient client.Client
+		recorder *record.FakeRecorder
+		r        *ReconcileMaroonedPods
+	)
+
+	getCR := func() *v1alpha1.MaroonedPods {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return mp
+	}
+
+	reconcileFinalizer := func() error {
+		return r.reconcileCertsFinalizer(getCR(), log)
+	}
+
+	deleteCR := func() {
+		Expect(crClient.Delete(context.TODO(), getCR())).To(Succeed())
+	}
+
+	newReconciler := func(mp *v1alpha1.MaroonedPods, certManager certmanager.CertManager) {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(mp).Build()
+		recorder = record.NewFakeRecorder(10)
+		r = &ReconcileMaroonedPods{
+			client:      crClient,
+			recorder:    recorder,
+			certManager: certManager,
+		}
+	}
+
+	newCR := func() *v1alpha1.MaroonedPods {
+		return &v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "maroonedpods",
+				// the one of the operator sdk, keeps the CR around after the certificates are cleaned up
+				Finalizers: []string{finalizerName},
+			},
+		}
+	}
+
+	It("should add the finalizer to the CR", func() {
+		newReconciler(newCR(), cm)
+
+		Expect(reconcileFinalizer()).To(Succeed())
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName, certsFinalizerName))
+
+		// only once
+		Expect(reconcileFinalizer()).To(Succeed())
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName, certsFinalizerName))
+	})
+
+	It("should clean up the certificates before removing the finalizer", func() {
+		newReconciler(newCR(), cm)
+		Expect(reconcileFinalizer()).To(Succeed())
+		deleteCR()
+
+		Expect(reconcileFinalizer()).To(Succeed())
+
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName))
+		Expect(exists("secrets", namespace, signerName)).To(BeFalse())
+		Expect(exists("secrets", namespace, util.SecretResourceName)).To(BeFalse())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeFalse())
+	})
+
+	It("should keep the finalizer until the cleanup succeeds", func() {
+		failures := 1
+		k8sClient.PrependReactor("delete", "secrets", func(testingclient.Action) (bool, runtime.Object, error) {
+			if failures == 0 {
+				return false, nil, nil
+			}
+			failures--
+			return true, nil, fmt.Errorf("etcdserver: request timed out")
+		})
+		newReconciler(newCR(), cm)
+		Expect(reconcileFinalizer()).To(Succeed())
+		deleteCR()
+
+		Expect(reconcileFinalizer()).ToNot(Succeed())
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName, certsFinalizerName))
+		Expect(recorder.Events).To(Receive(ContainSubstring("CertCleanupFailed")))
+
+		Expect(reconcileFinalizer()).To(Succeed())
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName))
+		Expect(exists("secrets", namespace, signerName)).To(BeFalse())
+	})
+
+	It("should remove the finalizer without deleting anything when preserving the certificates", func() {
+		mp := newCR()
+		preserve := true
+		mp.Spec.CertConfig = &v1alpha1.MaroonedPodsCertConfig{PreserveOnUninstall: &preserve}
+		newReconciler(mp, cm)
+		Expect(reconcileFinalizer()).To(Succeed())
+		deleteCR()
+		k8sClient.ClearActions()
+
+		Expect(reconcileFinalizer()).To(Succeed())
+
+		Expect(getCR().Finalizers).To(ConsistOf(finalizerName))
+		for _, action := range k8sClient.Actions() {
+			Expect(action.GetVerb()).ToNot(Equal("delete"))
+		}
+		Expect(exists("secrets", namespace, signerName)).To(BeTrue())
+		Expect(exists("configmaps", namespace, bundleName)).To(BeTrue())
+		signer, err := k8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), signerName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(signer.Labels).To(HaveKey(labelPreserved))
+	})
+})
@@ -0,0 +1,160 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// syncingCertManager fails the syncs with err, the canaries with canaryErr and succeeds the rest of the certificate sync
+type syncingCertManager struct {
+	failingSyncCertManager
+	canaryErr error
+}
+
+func (m *syncingCertManager) PruneOrphans(_ []cert.CertificateDefinition, _ bool) error {
+	return nil
+}
+
+func (m *syncingCertManager) RunCanary(_ []cert.CertificateDefinition, _ time.Duration) error {
+	return m.canaryErr
+}
+
+var _ = Describe("certificate condition tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient    client.Client
+		certManager *syncingCertManager
+		r           *ReconcileMaroonedPods
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+		}).Build()
+		certManager = &syncingCertManager{}
+		r = &ReconcileMaroonedPods{client: crClient, recorder: record.NewFakeRecorder(10), namespace: namespace, certManager: certManager}
+	})
+
+	// runs the certificate sync of the reconcile on a fresh copy of the CR, as the sdk does
+	syncCerts := func() error {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return r.sync(mp, log)
+	}
+
+	persistedCondition := func(conditionType conditions.ConditionType) *conditions.Condition {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return conditions.FindStatusCondition(mp.Status.Conditions, conditionType)
+	}
+
+	DescribeTable("should persist the degraded certificates until a successful sync", func(syncErr error, reason string) {
+		certManager.err = syncErr
+		Expect(syncCerts()).To(MatchError(syncErr))
+		condition := persistedCondition(conditionCertificatesDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(reason))
+
+		certManager.err = nil
+		Expect(syncCerts()).To(Succeed())
+		condition = persistedCondition(conditionCertificatesDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("CertificatesSynced"))
+	},
+		Entry("without cert-manager.io", &certmanager.CertManagerUnavailableError{GVK: schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Issuer"}}, "CertManagerUnavailable"),
+		Entry("with an invalid definition", fmt.Errorf("certificate %s: %w", cert.ServerCertSecretName, cert.ErrInvalidDefinition), "InvalidCertificateDefinition"),
+		Entry("with a non FIPS compliant definition", fmt.Errorf("certificate %s: %w", cert.ServerCertSecretName, certmanager.ErrFIPSNonCompliant), "FIPSNonCompliant"),
+		Entry("with missing permissions", fmt.Errorf("%w: create secrets", certmanager.ErrPreflightFailed), "MissingPermissions"),
+		Entry("with a webhook certificate mismatch", fmt.Errorf("%w: maroonedpods-server.maroonedpods.svc", certmanager.ErrWebhookCertMismatch), "WebhookCertificateMismatch"),
+	)
+
+	It("should not update the status of an unchanged condition", func() {
+		certManager.err = fmt.Errorf("%w: create secrets", certmanager.ErrPreflightFailed)
+		Expect(syncCerts()).To(HaveOccurred())
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		resourceVersion := mp.ResourceVersion
+
+		Expect(syncCerts()).To(HaveOccurred())
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		Expect(mp.ResourceVersion).To(Equal(resourceVersion))
+	})
+
+	It("should not add the condition on a successful sync", func() {
+		Expect(syncCerts()).To(Succeed())
+		Expect(persistedCondition(conditionCertificatesDegraded)).To(BeNil())
+	})
+
+	setCanaryInterval := func(interval *metav1.Duration) {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		mp.Spec.CertConfig = &v1alpha1.MaroonedPodsCertConfig{CanaryInterval: interval}
+		Expect(crClient.Update(context.TODO(), mp)).To(Succeed())
+	}
+
+	It("should persist the canary failure until it recovers", func() {
+		setCanaryInterval(&metav1.Duration{Duration: time.Hour})
+		Expect(syncCerts()).To(Succeed())
+		Expect(persistedCondition(conditionCertCanaryDegraded)).To(BeNil())
+
+		certManager.canaryErr = errors.New("the signer key is unusable")
+		Expect(syncCerts()).To(Succeed())
+		condition := persistedCondition(conditionCertCanaryDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("CertCanaryFailed"))
+		Expect(condition.Message).To(Equal("the signer key is unusable"))
+
+		certManager.canaryErr = nil
+		Expect(syncCerts()).To(Succeed())
+		condition = persistedCondition(conditionCertCanaryDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("CertCanaryPassed"))
+	})
+
+	It("should remove the canary condition when the canary is disabled", func() {
+		setCanaryInterval(&metav1.Duration{Duration: time.Hour})
+		certManager.canaryErr = errors.New("the signer key is unusable")
+		Expect(syncCerts()).To(Succeed())
+		Expect(persistedCondition(conditionCertCanaryDegraded)).ToNot(BeNil())
+
+		setCanaryInterval(nil)
+		Expect(syncCerts()).To(Succeed())
+		Expect(persistedCondition(conditionCertCanaryDegraded)).To(BeNil())
+	})
+
+	It("should degrade the phase", func() {
+		for _, conditionType := range []conditions.ConditionType{conditionCertificatesDegraded, conditionCertCanaryDegraded} {
+			mp := &v1alpha1.MaroonedPods{}
+			conditions.SetStatusCondition(&mp.Status.Conditions, conditions.Condition{Type: conditionType, Status: corev1.ConditionTrue})
+			Expect(deploymentPhase(mp)).To(Equal(v1alpha1.MaroonedPodsPhaseDegraded), "condition %s", conditionType)
+		}
+	})
+})
@@ -0,0 +1,80 @@
+package maroonedpods_operator
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+)
+
+const (
+	// certDebugPath is served on the metrics listener when enabled by util.DebugCertsEnv
+	certDebugPath = "/debug/certs"
+
+	privateKeyMarker = "PRIVATE KEY"
+)
+
+// certDebugStatus is the body of the debug endpoint
+type certDebugStatus struct {
+	certmanager.CertSyncStatus `json:",inline"`
+	Certificates               []certmanager.ManagedCert `json:"certificates"`
+	// why some of the certificates couldn't be inspected
+	ListError string `json:"listError,omitempty"`
+}
+
+// certDebugHandler dumps the state of the managed certificates as JSON, it never serves key material
+type certDebugHandler struct {
+	cm certmanager.CertManager
+}
+
+func newCertDebugHandler(cm certmanager.CertManager) http.Handler {
+	return &certDebugHandler{cm: cm}
+}
+
+// certDebugEnabled returns whether the env toggle enables the endpoint, off by default
+func certDebugEnabled(value string) bool {
+	enabled, err := strconv.ParseBool(value)
+	return err == nil && enabled
+}
+
+func (h *certDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "the endpoint is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := certDebugStatus{CertSyncStatus: h.cm.SyncStatus()}
+	if status.LastSuccessfulSyncTime == nil {
+		http.Error(w, "the certificates were not synced successfully yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	certs, err := h.cm.ListManagedCertificates(r.Context())
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		status.ListError = err.Error()
+	}
+	status.Certificates = certs
+
+	body, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the status only carries certificates, an error message quoting a secret must not leak it
+	if strings.Contains(string(body), privateKeyMarker) {
+		log.Error(nil, "Refusing to serve certificate status containing key material")
+		http.Error(w, "the certificate status contains key material", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		log.Error(err, "Failed to write the certificate status")
+	}
+}
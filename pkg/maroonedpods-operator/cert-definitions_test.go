@@ -0,0 +1,215 @@
+package maroonedpods_operator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// goldenDefinition pins what an install gets out of a definition, the objects and their names, the
+// identity of the certificate and its lifetimes
+type goldenDefinition struct {
+	Signer                        string   `json:"signer,omitempty"`
+	SignerLifetime                string   `json:"signerLifetime,omitempty"`
+	SignerRefresh                 string   `json:"signerRefresh,omitempty"`
+	Bundle                        string   `json:"bundle,omitempty"`
+	BundleReplicaNamespaces       []string `json:"bundleReplicaNamespaces,omitempty"`
+	Target                        string   `json:"target,omitempty"`
+	TargetLifetime                string   `json:"targetLifetime,omitempty"`
+	TargetRefresh                 string   `json:"targetRefresh,omitempty"`
+	TargetService                 string   `json:"targetService,omitempty"`
+	TargetExtraSANs               []string `json:"targetExtraSANs,omitempty"`
+	TargetUser                    string   `json:"targetUser,omitempty"`
+	ExtendedKeyUsages             string   `json:"extendedKeyUsages,omitempty"`
+	RolloutDeployments            []string `json:"rolloutDeployments,omitempty"`
+	MutatingWebhookConfigurations []string `json:"mutatingWebhookConfigurations,omitempty"`
+	ConversionCRDs                []string `json:"conversionCRDs,omitempty"`
+}
+
+func toGolden(defs []cert.CertificateDefinition) []goldenDefinition {
+	var golden []goldenDefinition
+	for _, cd := range defs {
+		g := goldenDefinition{
+			BundleReplicaNamespaces:       cd.BundleReplicaNamespaces,
+			TargetExtraSANs:               cd.TargetExtraSANs,
+			ExtendedKeyUsages:             string(cd.ExtendedKeyUsages),
+			RolloutDeployments:            cd.RolloutDeployments,
+			MutatingWebhookConfigurations: cd.MutatingWebhookConfigurations,
+			ConversionCRDs:                cd.ConversionCRDs,
+		}
+		if cd.SignerSecret != nil {
+			g.Signer = cd.SignerSecret.Namespace + "/" + cd.SignerSecret.Name
+			g.SignerLifetime = cd.SignerConfig.Lifetime.String()
+			g.SignerRefresh = cd.SignerConfig.Refresh.String()
+		}
+		if cd.CertBundleConfigmap != nil {
+			g.Bundle = cd.CertBundleConfigmap.Namespace + "/" + cd.CertBundleConfigmap.Name
+		}
+		if cd.TargetSecret != nil {
+			g.Target = cd.TargetSecret.Namespace + "/" + cd.TargetSecret.Name
+			g.TargetLifetime = cd.TargetConfig.Lifetime.String()
+			g.TargetRefresh = cd.TargetConfig.Refresh.String()
+		}
+		if cd.TargetService != nil {
+			g.TargetService = *cd.TargetService
+		}
+		if cd.TargetUser != nil {
+			g.TargetUser = *cd.TargetUser
+		}
+		golden = append(golden, g)
+	}
+	return golden
+}
+
+var _ = Describe("certificate definition factory tests", func() {
+	const namespace = "maroonedpods"
+
+	// UPDATE_GOLDEN=true rewrites the golden files, review the diff, a renamed object is orphaned in
+	// existing installs
+	DescribeTable("should generate the golden definitions", func(file string, opts ...cert.DefinitionOption) {
+		defs, err := cert.NewDefinitionFactory(namespace, opts...)
+		Expect(err).ToNot(HaveOccurred())
+		actual := toGolden(defs)
+
+		path := filepath.Join("testdata", "definitions", file)
+		if os.Getenv("UPDATE_GOLDEN") == "true" {
+			data, err := json.MarshalIndent(actual, "", "  ")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.WriteFile(path, append(data, '\n'), 0644)).To(Succeed())
+		}
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		var expected []goldenDefinition
+		Expect(json.Unmarshal(data, &expected)).To(Succeed())
+		Expect(actual).To(Equal(expected))
+	},
+		Entry("defaults", "defaults.json"),
+		Entry("metrics", "metrics.json", cert.WithMetricsCerts()),
+		Entry("all options", "options.json",
+			cert.WithCertConfig(&v1alpha1.MaroonedPodsCertConfig{
+				CA: &v1alpha1.CertConfig{
+					Duration:    durationPtr("168h"),
+					RenewBefore: durationPtr("48h"),
+				},
+				Server: &v1alpha1.CertConfig{
+					Duration:    durationPtr("36h"),
+					RenewBefore: durationPtr("12h"),
+				},
+				BundleReplicaNamespaces: []string{"workloads"},
+			}),
+			cert.WithExtraSANs("maroonedpods.example.com"),
+			cert.WithAdditionalNamespaces("workloads", "monitoring"),
+			cert.WithControllerClientCert(),
+		),
+		Entry("target overrides", "overrides.json",
+			cert.WithCertConfig(&v1alpha1.MaroonedPodsCertConfig{
+				Server: &v1alpha1.CertConfig{
+					Duration:    durationPtr("36h"),
+					RenewBefore: durationPtr("12h"),
+				},
+				TargetOverrides: map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+					v1alpha1.CertTargetControllerClient: {
+						Duration:    durationPtr("6h"),
+						RenewBefore: durationPtr("2h"),
+					},
+					// on top of the server duration
+					v1alpha1.CertTargetMetrics: {
+						RenewBeforePercent: &[]int32{50}[0],
+					},
+				},
+			}),
+			cert.WithControllerClientCert(),
+			cert.WithMetricsCerts(),
+		),
+	)
+
+	It("should keep the definitions of the certConfig of the webhook and the factory in line", func() {
+		config := &v1alpha1.MaroonedPodsCertConfig{
+			Server: &v1alpha1.CertConfig{Duration: durationPtr("36h")},
+		}
+		fromConfig, err := cert.DefinitionsFromCertConfig(namespace, config)
+		Expect(err).ToNot(HaveOccurred())
+		fromFactory, err := cert.NewDefinitionFactory(namespace, cert.WithCertConfig(config), cert.WithControllerClientCert(), cert.WithMetricsCerts())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fromFactory).To(Equal(fromConfig))
+	})
+
+	It("should reject an invalid certConfig", func() {
+		_, err := cert.NewDefinitionFactory(namespace, cert.WithCertConfig(&v1alpha1.MaroonedPodsCertConfig{
+			Server: &v1alpha1.CertConfig{Duration: durationPtr("12h"), RenewBefore: durationPtr("24h")},
+		}))
+		Expect(err).To(MatchError(ContainSubstring("certConfig.server")))
+	})
+
+	It("should reject an invalid additional namespace", func() {
+		_, err := cert.NewDefinitionFactory(namespace, cert.WithAdditionalNamespaces("Not_A_Namespace"))
+		Expect(err).To(MatchError(cert.ErrInvalidDefinition))
+	})
+})
+
+var _ = Describe("certificate definitions of the CR tests", func() {
+	const namespace = "maroonedpods"
+
+	newCR := func(config *v1alpha1.MaroonedPodsCertConfig) *v1alpha1.MaroonedPods {
+		return &v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+			Spec:       v1alpha1.MaroonedPodsSpec{CertConfig: config},
+		}
+	}
+
+	targetConfigs := func(mp *v1alpha1.MaroonedPods) map[string]cert.CertificateConfig {
+		defs, err := certificateDefinitionsOf(namespace, mp)
+		Expect(err).ToNot(HaveOccurred())
+		configs := map[string]cert.CertificateConfig{}
+		for _, cd := range defs {
+			if cd.TargetSecret != nil {
+				configs[cd.TargetSecret.Name] = cd.TargetConfig
+			}
+		}
+		return configs
+	}
+
+	It("should issue the controller client certificate with the lifetime of its override", func() {
+		defaults := targetConfigs(newCR(nil))
+		Expect(defaults).To(HaveKey(cert.ControllerClientCertSecretName))
+
+		configs := targetConfigs(newCR(&v1alpha1.MaroonedPodsCertConfig{
+			TargetOverrides: map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+				v1alpha1.CertTargetControllerClient: {Duration: durationPtr("6h"), RenewBefore: durationPtr("2h")},
+			},
+		}))
+		Expect(configs[cert.ControllerClientCertSecretName]).To(Equal(cert.CertificateConfig{Lifetime: 6 * time.Hour, Refresh: 4 * time.Hour}))
+		// only the overridden target changes
+		delete(configs, cert.ControllerClientCertSecretName)
+		delete(defaults, cert.ControllerClientCertSecretName)
+		Expect(configs).To(Equal(defaults))
+	})
+
+	It("should reject a controller client override the operator can't issue, like the webhook", func() {
+		config := &v1alpha1.MaroonedPodsCertConfig{
+			TargetOverrides: map[v1alpha1.CertTarget]v1alpha1.CertConfig{
+				v1alpha1.CertTargetControllerClient: {Duration: durationPtr("6h")},
+			},
+		}
+		_, err := certificateDefinitionsOf(namespace, newCR(config))
+		Expect(err).To(MatchError(ContainSubstring("certConfig.targetOverrides.controller-client: the duration 6h0m0s doesn't leave time to renew")))
+		_, webhookErr := cert.DefinitionsFromCertConfig(namespace, config)
+		Expect(webhookErr).To(MatchError(err.Error()))
+	})
+})
+
+func durationPtr(d string) *metav1.Duration {
+	duration, err := time.ParseDuration(d)
+	Expect(err).ToNot(HaveOccurred())
+	return &metav1.Duration{Duration: duration}
+}
@@ -0,0 +1,38 @@
+package maroonedpods_operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// watchExternalCerts reconciles the CR on changes of the provided certificate secrets, they are
+// written by the user and may miss the labels the watches of the sdk select on
+func (r *ReconcileMaroonedPods) watchExternalCerts() error {
+	return r.controller.Watch(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(
+		func(obj client.Object) []reconcile.Request {
+			if obj.GetNamespace() != r.namespace {
+				return nil
+			}
+			cr, err := util.GetActiveMaroonedPods(r.client)
+			if err != nil || cr == nil {
+				return nil
+			}
+			certs, err := r.getCertificateDefinitions(cr)
+			if err != nil {
+				return nil
+			}
+			for _, cd := range certs {
+				if cd.External && cd.TargetSecret != nil && cd.TargetSecret.Name == obj.GetName() {
+					return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: cr.Name}}}
+				}
+			}
+			return nil
+		},
+	))
+}
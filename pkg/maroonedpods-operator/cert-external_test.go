@@ -0,0 +1,91 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("external certificate condition tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient crclient.Client
+		r        *ReconcileMaroonedPods
+	)
+
+	newCerts := func(external bool) []cert.CertificateDefinition {
+		certs := cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		certs[0].External = external
+		return certs
+	}
+
+	sanMismatch := &certmanager.ExternalCertificateError{
+		Secret: types.NamespacedName{Namespace: namespace, Name: util.SecretResourceName},
+		Problems: []certmanager.ExternalCertificateProblem{{
+			Check:   certmanager.ExternalCheckSAN,
+			Message: "the SANs of the certificate don't cover maroonedpods-server",
+		}},
+	}
+
+	// updates the condition like the reconcile does after the sync and returns the persisted condition
+	reconcileCerts := func(certs []cert.CertificateDefinition, syncErr error) *conditions.Condition {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		Expect(r.updateCertRotationDegraded(mp, certs, syncErr)).To(Succeed())
+
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return conditions.FindStatusCondition(mp.Status.Conditions, conditionCertRotationDegraded)
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+		}).Build()
+		r = &ReconcileMaroonedPods{client: crClient, recorder: record.NewFakeRecorder(10)}
+	})
+
+	It("should follow the provided certificate from valid to broken to valid", func() {
+		condition := reconcileCerts(newCerts(true), nil)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+
+		condition = reconcileCerts(newCerts(true), sanMismatch)
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("ExternalCertificateInvalid"))
+		Expect(condition.Message).To(ContainSubstring("the SANs of the certificate don't cover maroonedpods-server"))
+
+		condition = reconcileCerts(newCerts(true), nil)
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("ExternalCertificatesValid"))
+	})
+
+	It("should keep the condition when the sync didn't get to validate the certificates", func() {
+		reconcileCerts(newCerts(true), sanMismatch)
+		condition := reconcileCerts(newCerts(true), certmanager.ErrNotStarted)
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("ExternalCertificateInvalid"))
+	})
+
+	It("should remove the condition once no certificate is provided", func() {
+		Expect(reconcileCerts(newCerts(true), sanMismatch)).ToNot(BeNil())
+		Expect(reconcileCerts(newCerts(false), nil)).To(BeNil())
+	})
+})
@@ -0,0 +1,34 @@
+package maroonedpods_operator
+
+import (
+	"os"
+	"strings"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var (
+	// fipsEnabledPath and fipsEnv are the indicators of a host running in FIPS mode
+	fipsEnabledPath = "/proc/sys/crypto/fips_enabled"
+	fipsEnv         = "GOLANG_FIPS"
+)
+
+// fipsEnabled resolves the FIPS mode of the CR, Auto follows the host
+func fipsEnabled(mode v1alpha1.CertFIPSMode) bool {
+	switch mode {
+	case v1alpha1.CertFIPSModeEnabled:
+		return true
+	case v1alpha1.CertFIPSModeDisabled:
+		return false
+	}
+	return hostFIPSEnabled()
+}
+
+// hostFIPSEnabled tells whether the kernel or the Go runtime of the operator run in FIPS mode
+func hostFIPSEnabled() bool {
+	if os.Getenv(fipsEnv) == "1" {
+		return true
+	}
+	data, err := os.ReadFile(fipsEnabledPath)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
@@ -0,0 +1,45 @@
+package maroonedpods_operator
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("FIPS mode", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		previous := fipsEnabledPath
+		fipsEnabledPath = filepath.Join(dir, "fips_enabled")
+		DeferCleanup(func() {
+			fipsEnabledPath = previous
+		})
+	})
+
+	It("should follow the host in Auto", func() {
+		Expect(fipsEnabled(v1alpha1.CertFIPSModeAuto)).To(BeFalse())
+		Expect(fipsEnabled("")).To(BeFalse())
+
+		Expect(os.WriteFile(fipsEnabledPath, []byte("1\n"), 0644)).To(Succeed())
+		Expect(fipsEnabled(v1alpha1.CertFIPSModeAuto)).To(BeTrue())
+		Expect(fipsEnabled("")).To(BeTrue())
+		Expect(fipsEnabled(v1alpha1.CertFIPSModeDisabled)).To(BeFalse())
+	})
+
+	It("should detect the FIPS Go runtime", func() {
+		Expect(os.Setenv(fipsEnv, "1")).To(Succeed())
+		DeferCleanup(os.Unsetenv, fipsEnv)
+		Expect(fipsEnabled(v1alpha1.CertFIPSModeAuto)).To(BeTrue())
+	})
+
+	It("should be enabled explicitly", func() {
+		Expect(os.WriteFile(fipsEnabledPath, []byte("0\n"), 0644)).To(Succeed())
+		Expect(fipsEnabled(v1alpha1.CertFIPSModeEnabled)).To(BeTrue())
+	})
+})
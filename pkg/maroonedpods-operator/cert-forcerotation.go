@@ -0,0 +1,79 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// annForceCertRotation on the CR rotates every certificate once per distinct value, e.g. a timestamp
+const annForceCertRotation = "operator.maroonedpods.io/force-cert-rotation"
+
+// forceCertRotation rotates the certificates for the token of the annotation. The progress is kept
+// in the status after every definition, so a failed or interrupted rotation is resumed without
+// rotating the definitions already done for the token.
+func (r *ReconcileMaroonedPods) forceCertRotation(mp *v1alpha1.MaroonedPods, certs []mpcerts.CertificateDefinition, logger logr.Logger) error {
+	token := mp.Annotations[annForceCertRotation]
+	if token == "" {
+		return nil
+	}
+
+	status := mp.Status.ForcedCertRotation
+	if status != nil && status.Token == token && status.Completed {
+		return nil
+	}
+	if status == nil || status.Token != token {
+		status = &v1alpha1.ForcedCertRotationStatus{Token: token}
+		logger.Info("Forcing the rotation of the certificates", "token", token)
+		r.recorder.Event(mp, corev1.EventTypeNormal, "ForcedCertRotationStarted", fmt.Sprintf("Rotating all certificates for %s %q", annForceCertRotation, token))
+		if err := r.updateForcedCertRotation(mp, status); err != nil {
+			return err
+		}
+	}
+
+	rotated := sets.NewString(status.Rotated...)
+	for _, cd := range certs {
+		name := cd.Name()
+		if rotated.Has(name) {
+			continue
+		}
+		// rotated by cert-manager.io, it is not ours to force
+		if cd.Issuer != nil {
+			logger.Info("Skipping the forced rotation of certificates issued by cert-manager.io", "certificate", name)
+			continue
+		}
+		if cd.External {
+			logger.Info("Skipping the forced rotation of provided certificates", "certificate", name)
+			continue
+		}
+
+		if err := r.certManager.ForceRotate(cd); err != nil {
+			r.recorder.Event(mp, corev1.EventTypeWarning, "ForcedCertRotationFailed", fmt.Sprintf("Failed to rotate %s for %q, retrying: %v", name, token, err))
+			return err
+		}
+		status.Rotated = append(status.Rotated, name)
+		rotated.Insert(name)
+		if err := r.updateForcedCertRotation(mp, status); err != nil {
+			return err
+		}
+	}
+
+	status.Completed = true
+	if err := r.updateForcedCertRotation(mp, status); err != nil {
+		return err
+	}
+	logger.Info("Forced the rotation of the certificates", "token", token)
+	r.recorder.Event(mp, corev1.EventTypeNormal, "ForcedCertRotationCompleted", fmt.Sprintf("Rotated %d certificates for %q", len(status.Rotated), token))
+	return nil
+}
+
+func (r *ReconcileMaroonedPods) updateForcedCertRotation(mp *v1alpha1.MaroonedPods, status *v1alpha1.ForcedCertRotationStatus) error {
+	mp.Status.ForcedCertRotation = status
+	return r.client.Status().Update(context.TODO(), mp)
+}
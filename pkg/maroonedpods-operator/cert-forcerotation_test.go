@@ -0,0 +1,171 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// forceRotatingCertManager records the forced rotations and fails the ones of failing
+type forceRotatingCertManager struct {
+	certmanager.CertManager
+	rotated []string
+	failing map[string]bool
+}
+
+func (m *forceRotatingCertManager) ForceRotate(cd cert.CertificateDefinition) error {
+	if m.failing[cd.Name()] {
+		return fmt.Errorf("signing %s failed", cd.Name())
+	}
+	m.rotated = append(m.rotated, cd.Name())
+	return nil
+}
+
+var _ = Describe("forced certificate rotation tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient client.Client
+		recorder *record.FakeRecorder
+		cm       *forceRotatingCertManager
+		r        *ReconcileMaroonedPods
+		certs    []cert.CertificateDefinition
+	)
+
+	newDefinition := func(name string) cert.CertificateDefinition {
+		return cert.CertificateDefinition{
+			SignerSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name + "-signer"}},
+			TargetSecret: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}},
+		}
+	}
+
+	getCR := func() *v1alpha1.MaroonedPods {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return mp
+	}
+
+	setToken := func(token string) {
+		mp := getCR()
+		mp.Annotations = map[string]string{annForceCertRotation: token}
+		Expect(crClient.Update(context.TODO(), mp)).To(Succeed())
+	}
+
+	// a restarted operator has a fresh cert manager and reads the progress from the CR
+	restart := func() {
+		cm = &forceRotatingCertManager{failing: map[string]bool{}}
+		recorder = record.NewFakeRecorder(20)
+		r = &ReconcileMaroonedPods{client: crClient, recorder: recorder, certManager: cm}
+	}
+
+	forceRotation := func() error {
+		return r.forceCertRotation(getCR(), certs, log)
+	}
+
+	events := func() []string {
+		var reasons []string
+		for len(recorder.Events) > 0 {
+			reasons = append(reasons, <-recorder.Events)
+		}
+		return reasons
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+		}).Build()
+		certs = []cert.CertificateDefinition{newDefinition("a"), newDefinition("b"), newDefinition("c")}
+		restart()
+	})
+
+	It("should not rotate without the annotation", func() {
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(BeEmpty())
+		Expect(getCR().Status.ForcedCertRotation).To(BeNil())
+	})
+
+	It("should rotate every certificate once per token", func() {
+		setToken("2026-10-14T10:00:00Z")
+
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a", "maroonedpods/b", "maroonedpods/c"}))
+		status := getCR().Status.ForcedCertRotation
+		Expect(status.Token).To(Equal("2026-10-14T10:00:00Z"))
+		Expect(status.Completed).To(BeTrue())
+		reasons := events()
+		Expect(reasons).To(HaveLen(2))
+		Expect(reasons[0]).To(ContainSubstring("ForcedCertRotationStarted"))
+		Expect(reasons[1]).To(ContainSubstring("ForcedCertRotationCompleted"))
+
+		// the next reconciles see the handled token
+		Expect(forceRotation()).To(Succeed())
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(HaveLen(3))
+		Expect(events()).To(BeEmpty())
+
+		setToken("incident-42")
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(HaveLen(6))
+		Expect(getCR().Status.ForcedCertRotation.Token).To(Equal("incident-42"))
+	})
+
+	It("should retry a partial failure without rotating the rotated certificates again", func() {
+		setToken("incident-42")
+		cm.failing["maroonedpods/b"] = true
+
+		Expect(forceRotation()).ToNot(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a"}))
+		status := getCR().Status.ForcedCertRotation
+		Expect(status.Rotated).To(Equal([]string{"maroonedpods/a"}))
+		Expect(status.Completed).To(BeFalse())
+		Expect(events()).To(ContainElement(ContainSubstring("ForcedCertRotationFailed")))
+
+		Expect(forceRotation()).ToNot(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a"}))
+
+		delete(cm.failing, "maroonedpods/b")
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a", "maroonedpods/b", "maroonedpods/c"}))
+		Expect(getCR().Status.ForcedCertRotation.Completed).To(BeTrue())
+	})
+
+	It("should resume the rotation after an operator restart", func() {
+		setToken("incident-42")
+		cm.failing["maroonedpods/c"] = true
+		Expect(forceRotation()).ToNot(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a", "maroonedpods/b"}))
+
+		restart()
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/c"}))
+		// the rotation is still the started one
+		Expect(events()).ToNot(ContainElement(ContainSubstring("ForcedCertRotationStarted")))
+		Expect(getCR().Status.ForcedCertRotation.Rotated).To(Equal([]string{"maroonedpods/a", "maroonedpods/b", "maroonedpods/c"}))
+	})
+
+	It("should skip the certificates of cert-manager.io issuers", func() {
+		certs[1].SignerSecret = nil
+		certs[1].Issuer = &cert.IssuerReference{Name: "corporate-ca"}
+		setToken("incident-42")
+
+		Expect(forceRotation()).To(Succeed())
+		Expect(cm.rotated).To(Equal([]string{"maroonedpods/a", "maroonedpods/c"}))
+		Expect(getCR().Status.ForcedCertRotation.Completed).To(BeTrue())
+	})
+})
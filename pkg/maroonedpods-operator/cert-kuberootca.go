@@ -0,0 +1,30 @@
+package maroonedpods_operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// watchKubeRootCA reconciles the CR on changes of kube-root-ca.crt in the install namespace, so a
+// rotated cluster root CA reaches the bundles merging it
+func (r *ReconcileMaroonedPods) watchKubeRootCA() error {
+	return r.controller.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(
+		func(obj client.Object) []reconcile.Request {
+			if obj.GetName() != mpcerts.KubeRootCAConfigMapName || obj.GetNamespace() != r.namespace {
+				return nil
+			}
+			cr, err := util.GetActiveMaroonedPods(r.client)
+			if err != nil || cr == nil || cr.Spec.CertConfig == nil || !cr.Spec.CertConfig.IncludeKubeRootCA {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: cr.Name}}}
+		},
+	))
+}
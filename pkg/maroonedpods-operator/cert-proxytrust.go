@@ -0,0 +1,37 @@
+package maroonedpods_operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+// watchProxyTrust reconciles the CR on changes of the source of the proxy CAs in the install
+// namespace, so an updated or removed proxy CA reaches the trust bundle
+func (r *ReconcileMaroonedPods) watchProxyTrust() error {
+	return r.controller.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(
+		func(obj client.Object) []reconcile.Request {
+			if obj.GetNamespace() != r.namespace {
+				return nil
+			}
+			cr, err := util.GetActiveMaroonedPods(r.client)
+			if err != nil || cr == nil || cr.Spec.CertConfig == nil || cr.Spec.CertConfig.ProxyTrust == nil {
+				return nil
+			}
+			sourceName := cr.Spec.CertConfig.ProxyTrust.ConfigMapName
+			if sourceName == "" {
+				sourceName = mpcerts.ProxyTrustedCAConfigMapName
+			}
+			if obj.GetName() != sourceName {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: cr.Name}}}
+		},
+	))
+}
@@ -0,0 +1,114 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	mpcluster "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// certReadyzCheckName is the name of the readiness check of the operator
+	certReadyzCheckName = "certificates"
+	// requeue of a reconcile that deferred the webhook configurations
+	webhooksDeferredRequeue = 5 * time.Second
+)
+
+// certReadiness tells whether the server has a serving certificate the apiserver can trust. Until
+// then the operator is not ready and the webhook configurations are not created.
+type certReadiness struct {
+	client     client.Reader
+	namespace  string
+	syncStatus func() certmanager.CertSyncStatus
+	clock      clock.PassiveClock
+	// a certificate issued before was synced by a previous operator, e.g. before an upgrade,
+	// this one may be waiting for the leadership
+	started time.Time
+}
+
+func newCertReadiness(c client.Reader, namespace string, cm certmanager.CertManager) *certReadiness {
+	return &certReadiness{
+		client:     c,
+		namespace:  namespace,
+		syncStatus: cm.SyncStatus,
+		clock:      clock.RealClock{},
+		started:    time.Now(),
+	}
+}
+
+// check returns nil once the serving secret of the server holds a certificate valid now, which a
+// sync of this operator succeeded with or which predates it
+func (c *certReadiness) check() error {
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: c.namespace, Name: util.SecretResourceName}
+	if err := c.client.Get(context.TODO(), key, secret); err != nil {
+		return fmt.Errorf("serving certificate %s not available: %w", util.SecretResourceName, err)
+	}
+	certs, err := crypto.CertsFromPEM(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return fmt.Errorf("serving certificate %s can't be parsed: %w", util.SecretResourceName, err)
+	}
+
+	now := c.clock.Now()
+	if now.Before(certs[0].NotBefore) || !now.Before(certs[0].NotAfter) {
+		return fmt.Errorf("serving certificate %s is only valid from %s to %s", util.SecretResourceName,
+			certs[0].NotBefore.Format(time.RFC3339), certs[0].NotAfter.Format(time.RFC3339))
+	}
+	if c.syncStatus().LastSuccessfulSyncTime == nil && !certs[0].NotBefore.Before(c.started) {
+		return fmt.Errorf("waiting for the initial certificate sync")
+	}
+	return nil
+}
+
+// readyz is the readiness check of the operator
+func (c *certReadiness) readyz(_ *http.Request) error {
+	return c.check()
+}
+
+// createDynamicResources returns the webhook configurations, none on a fresh install until the
+// server can serve them. Configurations that exist are kept up to date whatever the certificate.
+func (r *ReconcileMaroonedPods) createDynamicResources() ([]client.Object, error) {
+	r.webhooksDeferred = false
+	if r.certReadiness != nil {
+		if notReady := r.certReadiness.check(); notReady != nil {
+			exist, err := r.webhookConfigurationsExist()
+			if err != nil {
+				return nil, err
+			}
+			if !exist {
+				log.Info("Deferring the webhook configurations", "reason", notReady.Error())
+				r.webhooksDeferred = true
+				return nil, nil
+			}
+		}
+	}
+	return mpcluster.CreateAllDynamicResources(r.clusterArgs)
+}
+
+func (r *ReconcileMaroonedPods) webhookConfigurationsExist() (bool, error) {
+	configurations := map[string]client.Object{
+		mpcluster.MutatingWebhookConfigurationName:   &admissionregistrationv1.MutatingWebhookConfiguration{},
+		mpcluster.ValidatingWebhookConfigurationName: &admissionregistrationv1.ValidatingWebhookConfiguration{},
+	}
+	for name, obj := range configurations {
+		err := r.client.Get(context.TODO(), client.ObjectKey{Name: name}, obj)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	return false, nil
+}
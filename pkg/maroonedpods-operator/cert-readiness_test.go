@@ -0,0 +1,133 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	mpcluster "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("certificate readiness tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient   client.Client
+		r          *ReconcileMaroonedPods
+		readiness  *certReadiness
+		syncStatus certmanager.CertSyncStatus
+	)
+
+	createServingSecret := func() {
+		config, err := crypto.MakeSelfSignedCAConfigForDuration(util.MaroonedPodsServerResourceName, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		certPEM, keyPEM, err := config.GetPEMBytes()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(crClient.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.SecretResourceName},
+			Type:       corev1.SecretTypeTLS,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		})).To(Succeed())
+	}
+
+	synced := func() {
+		syncStatus.LastSuccessfulSyncTime = &metav1.Time{Time: time.Now()}
+	}
+
+	webhookConfigurations := func() []string {
+		resources, err := r.createDynamicResources()
+		Expect(err).ToNot(HaveOccurred())
+		var names []string
+		for _, resource := range resources {
+			switch resource.(type) {
+			case *admissionregistrationv1.MutatingWebhookConfiguration, *admissionregistrationv1.ValidatingWebhookConfiguration:
+				names = append(names, resource.GetName())
+			}
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+		}).Build()
+
+		syncStatus = certmanager.CertSyncStatus{}
+		readiness = &certReadiness{
+			client:     crClient,
+			namespace:  namespace,
+			syncStatus: func() certmanager.CertSyncStatus { return syncStatus },
+			clock:      clock.RealClock{},
+			// the certificates created by the tests are issued after the operator started
+			started: time.Now().Add(-time.Minute),
+		}
+		r = &ReconcileMaroonedPods{
+			client:        crClient,
+			namespace:     namespace,
+			clusterArgs:   &mpcluster.FactoryArgs{Namespace: namespace, Client: crClient, Logger: log},
+			certReadiness: readiness,
+		}
+	})
+
+	It("should defer the webhook configurations of a fresh install until the initial sync", func() {
+		Expect(readiness.readyz(nil)).To(MatchError(ContainSubstring("not available")))
+		Expect(webhookConfigurations()).To(BeEmpty())
+		Expect(r.webhooksDeferred).To(BeTrue())
+
+		// issued by a sync that didn't complete yet
+		createServingSecret()
+		Expect(readiness.readyz(nil)).To(MatchError(ContainSubstring("waiting for the initial certificate sync")))
+		Expect(webhookConfigurations()).To(BeEmpty())
+
+		synced()
+		Expect(readiness.readyz(nil)).To(Succeed())
+		Expect(webhookConfigurations()).To(ConsistOf(mpcluster.MutatingWebhookConfigurationName, mpcluster.ValidatingWebhookConfigurationName))
+		Expect(r.webhooksDeferred).To(BeFalse())
+	})
+
+	It("should not hold an upgrade with an existing certificate", func() {
+		createServingSecret()
+		// the new operator waits for the leadership of the previous one to sync
+		readiness.started = time.Now().Add(time.Minute)
+
+		Expect(readiness.readyz(nil)).To(Succeed())
+		Expect(webhookConfigurations()).To(ConsistOf(mpcluster.MutatingWebhookConfigurationName, mpcluster.ValidatingWebhookConfigurationName))
+	})
+
+	It("should keep the existing webhook configurations up to date without a serving certificate", func() {
+		Expect(crClient.Create(context.TODO(), &admissionregistrationv1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: mpcluster.ValidatingWebhookConfigurationName},
+		})).To(Succeed())
+
+		Expect(readiness.readyz(nil)).ToNot(Succeed())
+		Expect(webhookConfigurations()).To(ContainElement(mpcluster.ValidatingWebhookConfigurationName))
+		Expect(r.webhooksDeferred).To(BeFalse())
+	})
+
+	It("should not be ready with an expired certificate", func() {
+		createServingSecret()
+		synced()
+		readiness.clock = clocktesting.NewFakePassiveClock(time.Now().Add(2 * time.Hour))
+
+		Expect(readiness.readyz(nil)).To(MatchError(ContainSubstring("is only valid from")))
+	})
+})
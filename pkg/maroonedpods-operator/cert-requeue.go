@@ -0,0 +1,16 @@
+package maroonedpods_operator
+
+import (
+	"time"
+)
+
+// certRequeueAfter clamps the refresh hint of the certificate manager to the poll and resync intervals
+func certRequeueAfter(nextRefreshIn time.Duration) time.Duration {
+	if nextRefreshIn < certPollInterval {
+		return certPollInterval
+	}
+	if nextRefreshIn > certResyncInterval {
+		return certResyncInterval
+	}
+	return nextRefreshIn
+}
@@ -0,0 +1,125 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// failingSyncCertManager fails every sync with err
+type failingSyncCertManager struct {
+	certmanager.CertManager
+	err error
+}
+
+func (m *failingSyncCertManager) Sync(_ context.Context, _ []cert.CertificateDefinition) error {
+	return m.err
+}
+
+func (m *failingSyncCertManager) NextRefreshIn() time.Duration {
+	return time.Duration(math.MaxInt64)
+}
+
+var _ = Describe("certificate requeue tests", func() {
+	It("should clamp the requeue to the poll and resync intervals", func() {
+		Expect(certRequeueAfter(0)).To(Equal(certPollInterval))
+		Expect(certRequeueAfter(30 * time.Second)).To(Equal(certPollInterval))
+		Expect(certRequeueAfter(30 * time.Minute)).To(Equal(30 * time.Minute))
+		Expect(certRequeueAfter(24 * time.Hour)).To(Equal(certResyncInterval))
+		Expect(certRequeueAfter(time.Duration(math.MaxInt64))).To(Equal(certResyncInterval))
+	})
+})
+
+var _ = Describe("not ready cert manager requeue tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient client.Client
+		recorder *record.FakeRecorder
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		mp := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+		conditions.SetStatusCondition(&mp.Status.Conditions, conditions.Condition{
+			Type:   conditionCertRotationDegraded,
+			Status: corev1.ConditionTrue,
+			Reason: "ExternalCertificateInvalid",
+		})
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(mp).Build()
+		recorder = record.NewFakeRecorder(10)
+	})
+
+	newReconciler := func(syncErr error) *ReconcileMaroonedPods {
+		return &ReconcileMaroonedPods{client: crClient, recorder: recorder, namespace: namespace, certManager: &failingSyncCertManager{err: syncErr}}
+	}
+
+	// runs the certificate sync of the reconcile
+	syncCerts := func(r *ReconcileMaroonedPods) error {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return r.sync(mp, log)
+	}
+
+	persistedConditions := func() []conditions.Condition {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, mp)).To(Succeed())
+		return mp.Status.Conditions
+	}
+
+	DescribeTable("should requeue shortly without flipping the conditions", func(syncErr error) {
+		before := persistedConditions()
+		r := newReconciler(syncErr)
+
+		err := syncCerts(r)
+		Expect(certManagerNotReady(err)).To(BeTrue())
+		res, err := r.requeueResult(reconcile.Result{}, err)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res).To(Equal(reconcile.Result{RequeueAfter: certNotReadyRequeue}))
+		Expect(persistedConditions()).To(Equal(before))
+		Expect(recorder.Events).To(BeEmpty())
+	},
+		Entry("before the start", certmanager.ErrNotStarted),
+		Entry("with an unsynced namespace", fmt.Errorf("namespace %s: %w", namespace, certmanager.ErrNamespaceNotSynced)),
+		Entry("with an unsynced namespace among other errors", &certmanager.CertRotationStuckError{
+			Certificates: []string{namespace + "/maroonedpods-server"},
+			Err:          utilerrors.NewAggregate([]error{fmt.Errorf("namespace %s: %w", namespace, certmanager.ErrNamespaceNotSynced)}),
+		}),
+	)
+
+	It("should return the other failures for the backoff", func() {
+		failure := errors.New("admission webhook denied the request")
+		r := newReconciler(failure)
+
+		err := syncCerts(r)
+		Expect(certManagerNotReady(err)).To(BeFalse())
+		res, err := r.requeueResult(reconcile.Result{}, err)
+		Expect(err).To(MatchError(failure))
+		Expect(res).To(Equal(reconcile.Result{}))
+		// the condition is removed as usual, no certificate is provided
+		Expect(conditions.FindStatusCondition(persistedConditions(), conditionCertRotationDegraded)).To(BeNil())
+	})
+})
@@ -0,0 +1,123 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+const (
+	// annCertHash is stamped on the pod template of deployments mounting managed certificates,
+	// changing it triggers a rolling restart so the pods pick up rotated certificates
+	annCertHash = "operator.maroonedpods.io/certHash"
+
+	certHashLength = 16
+)
+
+// rolloutOnCertRotation stamps a hash of the mounted target certificates on the pod template
+// of every deployment listed in the definitions, restarting them when a certificate rotates
+func rolloutOnCertRotation(c client.Client, certs []mpcerts.CertificateDefinition, logger logr.Logger) error {
+	secretsByDeployment := map[client.ObjectKey][]client.ObjectKey{}
+	for _, cd := range certs {
+		if cd.TargetSecret == nil {
+			continue
+		}
+
+		secretKey := client.ObjectKeyFromObject(cd.TargetSecret)
+		for _, name := range cd.RolloutDeployments {
+			deploymentKey := client.ObjectKey{Namespace: cd.TargetSecret.Namespace, Name: name}
+			secretsByDeployment[deploymentKey] = append(secretsByDeployment[deploymentKey], secretKey)
+		}
+	}
+
+	for deploymentKey, secretKeys := range secretsByDeployment {
+		if err := rolloutDeployment(c, deploymentKey, secretKeys, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rolloutDeployment(c client.Client, deploymentKey client.ObjectKey, secretKeys []client.ObjectKey, logger logr.Logger) error {
+	hash, err := getCertHash(c, secretKeys)
+	if err != nil || hash == "" {
+		return err
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(context.TODO(), deploymentKey, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if deployment.Spec.Template.Annotations[annCertHash] == hash {
+		return nil
+	}
+
+	if isDeploymentRolling(deployment) {
+		logger.V(1).Info("Deployment is rolling, postponing certificate rollout", "deployment", deploymentKey)
+		return nil
+	}
+
+	patch := client.MergeFrom(deployment.DeepCopy())
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[annCertHash] = hash
+
+	logger.Info("Certificate changed, rolling out deployment", "deployment", deploymentKey, "hash", hash)
+	return c.Patch(context.TODO(), deployment, patch)
+}
+
+// getCertHash returns a short hash of the certificates in the given secrets or an empty string
+// if any of them is not issued yet
+func getCertHash(c client.Client, secretKeys []client.ObjectKey) (string, error) {
+	sort.Slice(secretKeys, func(i, j int) bool {
+		return secretKeys[i].String() < secretKeys[j].String()
+	})
+
+	h := sha256.New()
+	for _, key := range secretKeys {
+		secret := &corev1.Secret{}
+		if err := c.Get(context.TODO(), key, secret); err != nil {
+			if errors.IsNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+
+		crt := secret.Data[corev1.TLSCertKey]
+		if len(crt) == 0 {
+			return "", nil
+		}
+
+		h.Write([]byte(key.String()))
+		h.Write(crt)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:certHashLength], nil
+}
+
+func isDeploymentRolling(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	status := deployment.Status
+	return status.ObservedGeneration < deployment.Generation ||
+		status.UpdatedReplicas < replicas ||
+		status.Replicas > status.UpdatedReplicas
+}
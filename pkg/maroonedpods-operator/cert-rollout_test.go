@@ -0,0 +1,130 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("Cert rollout tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		c     client.Client
+		certs []cert.CertificateDefinition
+	)
+
+	newDeployment := func(name string) *appsv1.Deployment {
+		replicas := int32(1)
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  namespace,
+				Name:       name,
+				Generation: 1,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+			},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: 1,
+				Replicas:           1,
+				UpdatedReplicas:    1,
+			},
+		}
+	}
+
+	getDeployment := func(name string) *appsv1.Deployment {
+		d := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, d)).To(Succeed())
+		return d
+	}
+
+	rotate := func(crt string) {
+		s := &corev1.Secret{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: util.SecretResourceName}, s)).To(Succeed())
+		s.Data = map[string][]byte{corev1.TLSCertKey: []byte(crt)}
+		Expect(c.Update(context.TODO(), s)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      util.SecretResourceName,
+			},
+			Data: map[string][]byte{corev1.TLSCertKey: []byte("first")},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			secret,
+			newDeployment(util.MaroonedPodsServerResourceName),
+			newDeployment(util.ControllerResourceName),
+		).Build()
+	})
+
+	It("should change the template annotation exactly once per rotation", func() {
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		before := getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(before.Spec.Template.Annotations).To(HaveKey(annCertHash))
+
+		rotate("second")
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		after := getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(after.Spec.Template.Annotations[annCertHash]).ToNot(Equal(before.Spec.Template.Annotations[annCertHash]))
+
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		again := getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(again.ResourceVersion).To(Equal(after.ResourceVersion))
+		Expect(again.Spec.Template.Annotations[annCertHash]).To(Equal(after.Spec.Template.Annotations[annCertHash]))
+	})
+
+	It("should restart the controller mounting the serving cert too", func() {
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		before := getDeployment(util.ControllerResourceName)
+
+		rotate("second")
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		after := getDeployment(util.ControllerResourceName)
+		Expect(after.Spec.Template.Annotations[annCertHash]).ToNot(Equal(before.Spec.Template.Annotations[annCertHash]))
+	})
+
+	It("should not stamp a deployment that is already rolling", func() {
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		d := getDeployment(util.MaroonedPodsServerResourceName)
+		hash := d.Spec.Template.Annotations[annCertHash]
+		d.Status.UpdatedReplicas = 0
+		d.Status.Replicas = 2
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+
+		rotate("second")
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		d = getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(d.Spec.Template.Annotations[annCertHash]).To(Equal(hash))
+
+		d.Status.UpdatedReplicas = 1
+		d.Status.Replicas = 1
+		Expect(c.Update(context.TODO(), d)).To(Succeed())
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		d = getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(d.Spec.Template.Annotations[annCertHash]).ToNot(Equal(hash))
+	})
+
+	It("should skip deployments whose certificate is not issued yet", func() {
+		rotate("")
+		Expect(rolloutOnCertRotation(c, certs, logf.Log)).To(Succeed())
+		d := getDeployment(util.MaroonedPodsServerResourceName)
+		Expect(d.Spec.Template.Annotations).ToNot(HaveKey(annCertHash))
+	})
+})
@@ -0,0 +1,249 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	goerrors "errors"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// annServingCertSecretName asks the service-ca operator to issue a serving certificate for the service
+	annServingCertSecretName = "service.beta.openshift.io/serving-cert-secret-name"
+	// annInjectCABundle asks the service-ca operator to inject its CA into the configmap
+	annInjectCABundle = "service.beta.openshift.io/inject-cabundle"
+	// annOriginatingService is set by the service-ca operator on the secrets it issues
+	annOriginatingService = "service.beta.openshift.io/originating-service-name"
+
+	// serviceCABundleKey is the configmap key the service-ca operator injects its CA into
+	serviceCABundleKey = mpcerts.ServiceCABundleKey
+	// selfManagedBundleKey is the configmap key the self managed signer publishes its CA bundle into
+	selfManagedBundleKey = mpcerts.CABundleKey
+)
+
+var (
+	serviceCAGVK = schema.GroupVersionKind{Group: "operator.openshift.io", Version: "v1", Kind: "ServiceCA"}
+
+	errServiceCAUnavailable = goerrors.New("service-ca cert management requested but the service-ca operator is not available, falling back to self managed certificates")
+)
+
+// useServiceCA reports whether the serving certificates should be issued by service-ca,
+// returns errServiceCAUnavailable if it was requested but the cluster doesn't run service-ca
+func useServiceCA(mapper meta.RESTMapper, requested bool) (bool, error) {
+	if !requested {
+		return false, nil
+	}
+
+	available, err := util.IsKindAvailable(mapper, serviceCAGVK)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		return false, errServiceCAUnavailable
+	}
+
+	return true, nil
+}
+
+// syncCertManagementMode hands the serving certificates over to service-ca or takes them back,
+// returns the definitions the operator still has to manage itself
+func syncCertManagementMode(c client.Client, certs []mpcerts.CertificateDefinition, serviceCA bool, logger logr.Logger) ([]mpcerts.CertificateDefinition, error) {
+	serving, others := splitServiceCACerts(certs)
+	if serviceCA {
+		return others, syncServiceCA(c, serving, others, logger)
+	}
+	return certs, revertServiceCA(c, serving, logger)
+}
+
+// splitServiceCACerts returns the serving certificate definitions service-ca is able to issue
+// and the remaining ones that have to be managed by the operator. The metrics keep their own CA,
+// the ServiceMonitor reads it from the self managed bundle.
+func splitServiceCACerts(certs []mpcerts.CertificateDefinition) (serving, others []mpcerts.CertificateDefinition) {
+	for _, cd := range certs {
+		if cd.TargetService != nil && cd.TargetSecret != nil &&
+			(cd.CertBundleConfigmap == nil || cd.CertBundleConfigmap.Name != mpcerts.MetricsCABundleConfigMapName) {
+			serving = append(serving, cd)
+		} else {
+			others = append(others, cd)
+		}
+	}
+	return serving, others
+}
+
+// syncServiceCA hands the serving certificates over to the service-ca operator, removing whatever
+// the self managed rotation left behind. Signers and bundles the selfManaged definitions still use,
+// like the signer of the controller client certificate, are kept.
+func syncServiceCA(c client.Client, certs, selfManaged []mpcerts.CertificateDefinition, logger logr.Logger) error {
+	signers, bundles := sets.NewString(), sets.NewString()
+	for _, cd := range selfManaged {
+		if cd.SignerSecret != nil {
+			signers.Insert(cd.SignerSecret.Name)
+		}
+		if cd.CertBundleConfigmap != nil {
+			bundles.Insert(cd.CertBundleConfigmap.Name)
+		}
+	}
+
+	for _, cd := range certs {
+		if err := setServiceAnnotation(c, cd, cd.TargetSecret.Name); err != nil {
+			return err
+		}
+
+		if err := deleteSecretIf(c, cd.TargetSecret, func(s *corev1.Secret) bool {
+			return s.Annotations[annOriginatingService] == ""
+		}, logger); err != nil {
+			return err
+		}
+
+		if cd.SignerSecret != nil && !signers.Has(cd.SignerSecret.Name) {
+			if err := deleteSecretIf(c, cd.SignerSecret, func(*corev1.Secret) bool { return true }, logger); err != nil {
+				return err
+			}
+		}
+
+		if cd.CertBundleConfigmap != nil {
+			if err := updateBundleConfigMap(c, cd.CertBundleConfigmap, true, bundles.Has(cd.CertBundleConfigmap.Name)); err != nil {
+				return err
+			}
+		}
+
+		if err := waitForServiceCASecret(c, cd.TargetSecret, logger); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revertServiceCA takes the serving certificates back from the service-ca operator, so the self
+// managed rotation can issue them again
+func revertServiceCA(c client.Client, certs []mpcerts.CertificateDefinition, logger logr.Logger) error {
+	for _, cd := range certs {
+		if err := setServiceAnnotation(c, cd, ""); err != nil {
+			return err
+		}
+
+		if err := deleteSecretIf(c, cd.TargetSecret, func(s *corev1.Secret) bool {
+			return s.Annotations[annOriginatingService] != ""
+		}, logger); err != nil {
+			return err
+		}
+
+		if cd.CertBundleConfigmap != nil {
+			if err := updateBundleConfigMap(c, cd.CertBundleConfigmap, false, true); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// setServiceAnnotation points the serving-cert annotation of the target service at secretName,
+// an empty name removes the annotation
+func setServiceAnnotation(c client.Client, cd mpcerts.CertificateDefinition, secretName string) error {
+	service := &corev1.Service{}
+	key := client.ObjectKey{Namespace: cd.TargetSecret.Namespace, Name: *cd.TargetService}
+	if err := c.Get(context.TODO(), key, service); err != nil {
+		if errors.IsNotFound(err) && secretName == "" {
+			return nil
+		}
+		return err
+	}
+
+	current, exists := service.Annotations[annServingCertSecretName]
+	if secretName == "" {
+		if !exists {
+			return nil
+		}
+		delete(service.Annotations, annServingCertSecretName)
+	} else {
+		if current == secretName {
+			return nil
+		}
+		if service.Annotations == nil {
+			service.Annotations = map[string]string{}
+		}
+		service.Annotations[annServingCertSecretName] = secretName
+	}
+
+	return c.Update(context.TODO(), service)
+}
+
+func deleteSecretIf(c client.Client, obj *corev1.Secret, cond func(*corev1.Secret) bool, logger logr.Logger) error {
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if !cond(secret) {
+		return nil
+	}
+
+	logger.Info("Deleting certificate secret left behind by the previous cert management mode", "secret", client.ObjectKeyFromObject(secret))
+	if err := c.Delete(context.TODO(), secret); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// updateBundleConfigMap switches the bundle configmap between the injected service-ca bundle and
+// the self managed one, dropping the bundle of the mode being left. keepSelfManaged keeps the self
+// managed bundle next to the injected one while self managed certificates still publish into it.
+func updateBundleConfigMap(c client.Client, obj *corev1.ConfigMap, serviceCA, keepSelfManaged bool) error {
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), cm); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	cpy := cm.DeepCopy()
+	if serviceCA {
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations[annInjectCABundle] = "true"
+		if !keepSelfManaged {
+			delete(cm.Data, selfManagedBundleKey)
+		}
+	} else {
+		delete(cm.Annotations, annInjectCABundle)
+		delete(cm.Data, serviceCABundleKey)
+	}
+
+	if equality.Semantic.DeepEqual(cpy.Annotations, cm.Annotations) && equality.Semantic.DeepEqual(cpy.Data, cm.Data) {
+		return nil
+	}
+
+	return c.Update(context.TODO(), cm)
+}
+
+// waitForServiceCASecret returns nil once the service-ca operator issued the target secret,
+// until then the next periodic sync checks again
+func waitForServiceCASecret(c client.Client, obj *corev1.Secret, logger logr.Logger) error {
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), secret); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("Waiting for service-ca to issue the serving certificate", "secret", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+var _ = Describe("Service CA cert management tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		c     client.Client
+		certs []cert.CertificateDefinition
+		cd    cert.CertificateDefinition
+	)
+
+	newService := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        *cd.TargetService,
+				Annotations: annotations,
+			},
+		}
+	}
+
+	newSecret := func(name string, annotations map[string]string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        name,
+				Annotations: annotations,
+			},
+			Data: map[string][]byte{corev1.TLSCertKey: []byte("crt")},
+		}
+	}
+
+	newBundle := func(annotations, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        cd.CertBundleConfigmap.Name,
+				Annotations: annotations,
+			},
+			Data: data,
+		}
+	}
+
+	getService := func() *corev1.Service {
+		s := &corev1.Service{}
+		Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: *cd.TargetService}, s)).To(Succeed())
+		return s
+	}
+
+	getBundle := func() *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cd.CertBundleConfigmap), cm)).To(Succeed())
+		return cm
+	}
+
+	expectNoSecret := func(obj *corev1.Secret) {
+		err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), &corev1.Secret{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	}
+
+	BeforeEach(func() {
+		certs = cert.CreateCertificateDefinitions(&cert.FactoryArgs{Namespace: namespace})
+		Expect(certs).To(HaveLen(1))
+		cd = certs[0]
+	})
+
+	Context("service-ca detection", func() {
+		newMapper := func(withServiceCA bool) meta.RESTMapper {
+			gv := schema.GroupVersion{Group: "operator.openshift.io", Version: "v1"}
+			mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{gv})
+			if withServiceCA {
+				mapper.Add(gv.WithKind("ServiceCA"), meta.RESTScopeRoot)
+			}
+			return mapper
+		}
+
+		It("should not use service-ca unless requested", func() {
+			serviceCA, err := useServiceCA(newMapper(true), false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serviceCA).To(BeFalse())
+		})
+
+		It("should use service-ca when requested and available", func() {
+			serviceCA, err := useServiceCA(newMapper(true), true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serviceCA).To(BeTrue())
+		})
+
+		It("should report unavailable service-ca", func() {
+			serviceCA, err := useServiceCA(newMapper(false), true)
+			Expect(err).To(Equal(errServiceCAUnavailable))
+			Expect(serviceCA).To(BeFalse())
+		})
+	})
+
+	It("should hand serving certs over to service-ca", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService(nil),
+			newSecret(cd.SignerSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newSecret(cd.TargetSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newBundle(nil, map[string]string{selfManagedBundleKey: "ca"}),
+		).Build()
+
+		managed, err := syncCertManagementMode(c, certs, true, logf.Log)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(managed).To(BeEmpty())
+
+		Expect(getService().Annotations).To(HaveKeyWithValue(annServingCertSecretName, cd.TargetSecret.Name))
+		expectNoSecret(cd.SignerSecret)
+		expectNoSecret(cd.TargetSecret)
+		bundle := getBundle()
+		Expect(bundle.Annotations).To(HaveKeyWithValue(annInjectCABundle, "true"))
+		Expect(bundle.Data).ToNot(HaveKey(selfManagedBundleKey))
+	})
+
+	It("should keep the signer and the bundle the self managed certs still use", func() {
+		mixed, err := cert.NewDefinitionFactory(namespace, cert.WithControllerClientCert())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mixed).To(HaveLen(2))
+		clientCert := mixed[1]
+		Expect(clientCert.SignerSecret.Name).To(Equal(cd.SignerSecret.Name))
+		Expect(clientCert.CertBundleConfigmap.Name).To(Equal(cd.CertBundleConfigmap.Name))
+
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService(nil),
+			newSecret(cd.SignerSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newSecret(cd.TargetSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newSecret(clientCert.TargetSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newBundle(nil, map[string]string{selfManagedBundleKey: "ca"}),
+		).Build()
+
+		for i := 0; i < 2; i++ {
+			managed, err := syncCertManagementMode(c, mixed, true, logf.Log)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(managed).To(Equal([]cert.CertificateDefinition{clientCert}))
+		}
+
+		Expect(getService().Annotations).To(HaveKeyWithValue(annServingCertSecretName, cd.TargetSecret.Name))
+		expectNoSecret(cd.TargetSecret)
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cd.SignerSecret), &corev1.Secret{})).To(Succeed())
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(clientCert.TargetSecret), &corev1.Secret{})).To(Succeed())
+		bundle := getBundle()
+		Expect(bundle.Annotations).To(HaveKeyWithValue(annInjectCABundle, "true"))
+		Expect(bundle.Data).To(HaveKeyWithValue(selfManagedBundleKey, "ca"))
+	})
+
+	It("should keep the secret issued by service-ca", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService(map[string]string{annServingCertSecretName: cd.TargetSecret.Name}),
+			newSecret(cd.TargetSecret.Name, map[string]string{annOriginatingService: *cd.TargetService}),
+			newBundle(map[string]string{annInjectCABundle: "true"}, map[string]string{serviceCABundleKey: "ca"}),
+		).Build()
+
+		_, err := syncCertManagementMode(c, certs, true, logf.Log)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cd.TargetSecret), &corev1.Secret{})).To(Succeed())
+		Expect(getBundle().Data).To(HaveKeyWithValue(serviceCABundleKey, "ca"))
+	})
+
+	It("should take serving certs back from service-ca", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService(map[string]string{annServingCertSecretName: cd.TargetSecret.Name, "other": "value"}),
+			newSecret(cd.TargetSecret.Name, map[string]string{annOriginatingService: *cd.TargetService}),
+			newBundle(map[string]string{annInjectCABundle: "true"}, map[string]string{serviceCABundleKey: "ca"}),
+		).Build()
+
+		managed, err := syncCertManagementMode(c, certs, false, logf.Log)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(managed).To(Equal(certs))
+
+		service := getService()
+		Expect(service.Annotations).ToNot(HaveKey(annServingCertSecretName))
+		Expect(service.Annotations).To(HaveKeyWithValue("other", "value"))
+		expectNoSecret(cd.TargetSecret)
+		bundle := getBundle()
+		Expect(bundle.Annotations).ToNot(HaveKey(annInjectCABundle))
+		Expect(bundle.Data).ToNot(HaveKey(serviceCABundleKey))
+	})
+
+	It("should leave self managed certs alone", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			newService(nil),
+			newSecret(cd.SignerSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newSecret(cd.TargetSecret.Name, map[string]string{cert.CertConfigAnnotation: "{}"}),
+			newBundle(nil, map[string]string{selfManagedBundleKey: "ca"}),
+		).Build()
+		before := getBundle()
+
+		_, err := syncCertManagementMode(c, certs, false, logf.Log)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cd.SignerSecret), &corev1.Secret{})).To(Succeed())
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(cd.TargetSecret), &corev1.Secret{})).To(Succeed())
+		Expect(getBundle().ResourceVersion).To(Equal(before.ResourceVersion))
+	})
+})
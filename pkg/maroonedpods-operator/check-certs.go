@@ -0,0 +1,204 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// CheckCertsCommand is the subcommand of the operator binary auditing the certificates
+const CheckCertsCommand = "check-certs"
+
+// RunCheckCerts audits the certificates of the install in a cluster or in a directory of dumped objects
+// and prints the report. It returns the exit code: 1 if a check failed or the audit couldn't run, 2 for
+// invalid arguments.
+func RunCheckCerts(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(CheckCertsCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("output", "table", "format of the report, json or table")
+	kubeconfig := flags.String("kubeconfig", "", "kubeconfig of the cluster, the in-cluster config or $KUBECONFIG by default")
+	dir := flags.String("dir", "", "directory of dumped YAML or JSON objects, e.g. a must-gather, audited instead of a cluster")
+	namespace := flags.String("namespace", util.GetNamespace(), "install namespace of MaroonedPods")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "json" && *output != "table" {
+		fmt.Fprintf(stderr, "unknown output %q, json or table\n", *output)
+		return 2
+	}
+
+	audit, err := auditCerts(context.TODO(), *dir, *kubeconfig, *namespace, time.Now())
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CheckCertsCommand, err)
+		return 1
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(audit)
+	} else {
+		err = audit.WriteTable(stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", CheckCertsCommand, err)
+		return 1
+	}
+
+	if audit.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func auditCerts(ctx context.Context, dir, kubeconfig, namespace string, now time.Time) (*certmanager.CertAudit, error) {
+	s, err := checkCertsScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	var reader client.Reader
+	if dir != "" {
+		reader, err = readDump(dir, s)
+	} else {
+		reader, err = clusterReader(kubeconfig, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mp, err := activeMaroonedPods(ctx, reader)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := certificateDefinitionsOf(namespace, mp)
+	if err != nil {
+		return nil, err
+	}
+	return certmanager.AuditCertificates(ctx, reader, certs, now)
+}
+
+// checkCertsScheme has the kinds check-certs reads
+func checkCertsScheme() (*runtime.Scheme, error) {
+	s := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, extv1.AddToScheme, v1alpha1.AddToScheme} {
+		if err := addToScheme(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func clusterReader(kubeconfig string, s *runtime.Scheme) (client.Reader, error) {
+	cfg, err := config.GetConfig()
+	if kubeconfig != "" {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: s})
+}
+
+// readDump loads the objects of the YAML and JSON files under the directory, lists included, into a
+// reader. The objects of kinds check-certs doesn't read are skipped.
+func readDump(dir string, s *runtime.Scheme) (client.Reader, error) {
+	var objects []client.Object
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+		for {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if len(raw) == 0 || string(raw) == "null" {
+				continue
+			}
+			decoded, err := runtime.Decode(unstructured.UnstructuredJSONScheme, raw)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			items := []unstructured.Unstructured{}
+			switch o := decoded.(type) {
+			case *unstructured.UnstructuredList:
+				items = o.Items
+			case *unstructured.Unstructured:
+				items = append(items, *o)
+			}
+			for i := range items {
+				typed, err := s.New(items[i].GroupVersionKind())
+				if err != nil {
+					continue
+				}
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(items[i].Object, typed); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				if object, ok := typed.(client.Object); ok {
+					objects = append(objects, object)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crfake.NewClientBuilder().WithScheme(s).WithObjects(objects...).Build(), nil
+}
+
+// activeMaroonedPods returns the CR the certificates are issued for, nil without one
+func activeMaroonedPods(ctx context.Context, reader client.Reader) (*v1alpha1.MaroonedPods, error) {
+	crs := &v1alpha1.MaroonedPodsList{}
+	if err := reader.List(ctx, crs); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for i := range crs.Items {
+		if crs.Items[i].Status.Phase != sdkapi.PhaseError {
+			return &crs.Items[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,239 @@
+package maroonedpods_operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/library-go/pkg/crypto"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert/certtest"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+)
+
+var _ = Describe("check-certs tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		client  *fake.Clientset
+		dir     string
+		cd      cert.CertificateDefinition
+		ca      *crypto.CA
+		webhook *admissionregistrationv1.MutatingWebhookConfiguration
+	)
+
+	encodeCAs := func(cas ...*crypto.CA) []byte {
+		var certs []*x509.Certificate
+		for _, ca := range cas {
+			certs = append(certs, ca.Config.Certs...)
+		}
+		pem, err := crypto.EncodeCertificates(certs...)
+		Expect(err).ToNot(HaveOccurred())
+		return pem
+	}
+
+	writeTarget := func(notBefore, notAfter time.Time) {
+		target, err := certtest.NewServingCert(ca, []string{cert.ServerServiceName + "." + namespace + ".svc"}, notBefore, notAfter)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteTarget(context.TODO(), client, cd, target)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	writeFile := func(path string, object interface{}) {
+		data, err := yaml.Marshal(object)
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, path)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, data, 0644)).To(Succeed())
+	}
+
+	// dumps the objects in the layout of a must-gather, the namespaced ones as lists
+	dump := func() {
+		secrets, err := client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		secrets.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "SecretList"}
+		for i := range secrets.Items {
+			secrets.Items[i].TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"}
+		}
+		writeFile("namespaces/"+namespace+"/core/secrets.yaml", secrets)
+
+		configMaps, err := client.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		configMaps.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMapList"}
+		for i := range configMaps.Items {
+			configMaps.Items[i].TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}
+		}
+		writeFile("namespaces/"+namespace+"/core/configmaps.yaml", configMaps)
+
+		webhook.TypeMeta = metav1.TypeMeta{APIVersion: "admissionregistration.k8s.io/v1", Kind: "MutatingWebhookConfiguration"}
+		writeFile("cluster-scoped-resources/admissionregistration.k8s.io/mutatingwebhookconfigurations/"+webhook.Name+".yaml", webhook)
+	}
+
+	run := func(args ...string) (int, string) {
+		dump()
+		var stdout, stderr bytes.Buffer
+		code := RunCheckCerts(append([]string{"--dir", dir, "--namespace", namespace}, args...), &stdout, &stderr)
+		return code, stdout.String()
+	}
+
+	runJSON := func() (int, *certmanager.CertAudit) {
+		code, out := run("--output", "json")
+		audit := &certmanager.CertAudit{}
+		Expect(json.Unmarshal([]byte(out), audit)).To(Succeed())
+		return code, audit
+	}
+
+	checkOf := func(audit *certmanager.CertAudit, kind, name string) certmanager.CertCheck {
+		for _, check := range audit.Checks {
+			if check.Ref.Kind == kind && check.Ref.Name == name {
+				return check
+			}
+		}
+		Fail("no check of " + kind + "/" + name)
+		return certmanager.CertCheck{}
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		dir = GinkgoT().TempDir()
+		certs, err := certificateDefinitionsOf(namespace, nil)
+		Expect(err).ToNot(HaveOccurred())
+		// the server, the controller client and the metrics of the operator and the controller
+		Expect(certs).To(HaveLen(4))
+		cd = certs[0]
+
+		now := time.Now()
+		ca, err = certtest.NewCA("maroonedpods-server-signer", now.Add(-2*time.Hour), now.Add(46*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteSigner(context.TODO(), client, cd, ca)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteBundle(context.TODO(), client, cd, ca)
+		Expect(err).ToNot(HaveOccurred())
+		writeTarget(now.Add(-time.Hour), now.Add(23*time.Hour))
+		// the controller client shares the signer and the bundle of the server
+		clientCert, err := certtest.NewServingCert(ca, []string{*certs[1].TargetUser}, now.Add(-time.Hour), now.Add(23*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteTarget(context.TODO(), client, certs[1], clientCert)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the metrics definitions share their signer
+		metricsCA, err := certtest.NewCA(cert.MetricsSignerSecretName, now.Add(-2*time.Hour), now.Add(46*time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteSigner(context.TODO(), client, certs[2], metricsCA)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteBundle(context.TODO(), client, certs[2], metricsCA)
+		Expect(err).ToNot(HaveOccurred())
+		for _, metrics := range certs[2:] {
+			target, err := certtest.NewServingCert(metricsCA, []string{*metrics.TargetService + "." + namespace + ".svc"}, now.Add(-time.Hour), now.Add(23*time.Hour))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = certtest.WriteTarget(context.TODO(), client, metrics, target)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		webhook = &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: cluster.MutatingWebhookConfigurationName},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name:         "pods.maroonedpods.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: encodeCAs(ca)},
+			}},
+		}
+	})
+
+	It("should pass a healthy install", func() {
+		code, audit := runJSON()
+
+		Expect(code).To(Equal(0))
+		Expect(audit.Failed()).To(BeFalse())
+		Expect(audit.Checks).To(HaveLen(13))
+		target := checkOf(audit, "Secret", cert.ServerCertSecretName)
+		Expect(target.Role).To(Equal(certmanager.ManagedCertRoleTarget))
+		Expect(target.IssuerCN).To(Equal("maroonedpods-server-signer"))
+		Expect(target.ChainsToBundle).To(Equal(&[]bool{true}[0]))
+		Expect(checkOf(audit, "MutatingWebhookConfiguration", cluster.MutatingWebhookConfigurationName).Role).To(Equal(certmanager.ManagedCertRoleConsumer))
+	})
+
+	It("should fail an expired certificate", func() {
+		writeTarget(time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour))
+
+		code, audit := runJSON()
+
+		Expect(code).To(Equal(1))
+		target := checkOf(audit, "Secret", cert.ServerCertSecretName)
+		Expect(target.Problems).To(ConsistOf(ContainSubstring("expired at")))
+		// as of its issuance
+		Expect(target.ChainsToBundle).To(Equal(&[]bool{true}[0]))
+		Expect(checkOf(audit, "Secret", cert.ServerSignerSecretName).Problems).To(BeEmpty())
+	})
+
+	It("should fail a caBundle that doesn't match the bundle", func() {
+		other, err := certtest.NewCA("other", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		webhook.Webhooks[0].ClientConfig.CABundle = encodeCAs(other)
+
+		code, audit := runJSON()
+
+		Expect(code).To(Equal(1))
+		Expect(checkOf(audit, "MutatingWebhookConfiguration", cluster.MutatingWebhookConfigurationName).Problems).To(
+			ConsistOf(ContainSubstring("doesn't match the bundle")))
+		Expect(checkOf(audit, "Secret", cert.ServerCertSecretName).Problems).To(BeEmpty())
+	})
+
+	It("should report a bundle without the signer", func() {
+		other, err := certtest.NewCA("other", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = certtest.WriteBundle(context.TODO(), client, cd, other)
+		Expect(err).ToNot(HaveOccurred())
+		webhook.Webhooks[0].ClientConfig.CABundle = encodeCAs(other)
+
+		code, audit := runJSON()
+
+		Expect(code).To(Equal(1))
+		target := checkOf(audit, "Secret", cert.ServerCertSecretName)
+		Expect(target.ChainsToBundle).To(Equal(&[]bool{false}[0]))
+
+		Expect(target.Problems).To(ConsistOf("the CA bundle doesn't contain the current signer"))
+	})
+
+	It("should fail a config annotation that doesn't match the definition", func() {
+		target, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), cert.ServerCertSecretName, metav1.GetOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		target.Annotations[cert.CertConfigAnnotation] = `{"lifetime":"1h","refresh":"30m"}`
+		_, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), target, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		code, audit := runJSON()
+
+		Expect(code).To(Equal(1))
+		Expect(checkOf(audit, "Secret", cert.ServerCertSecretName).Problems).To(ConsistOf(ContainSubstring("doesn't match the definition")))
+	})
+
+	It("should print a table", func() {
+		writeTarget(time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour))
+
+		code, out := run()
+
+		Expect(code).To(Equal(1))
+		Expect(out).To(HavePrefix("OBJECT"))
+		Expect(out).To(ContainSubstring("Secret/" + namespace + "/" + cert.ServerCertSecretName))
+		Expect(out).To(ContainSubstring("expired at"))
+		Expect(out).To(ContainSubstring("MutatingWebhookConfiguration/" + cluster.MutatingWebhookConfigurationName))
+	})
+
+	It("should reject an unknown output", func() {
+		code, _ := run("--output", "xml")
+		Expect(code).To(Equal(2))
+	})
+})
@@ -0,0 +1,34 @@
+package maroonedpods_operator
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// validateComponentResources rejects the components whose limits are lower than their requests,
+// the pods would be refused by the apiserver and the deployments never roll
+func validateComponentResources(resources *mpv1.ComponentResources) error {
+	if resources == nil {
+		return nil
+	}
+	if err := validateResourceRequirements("controller", resources.Controller); err != nil {
+		return err
+	}
+	return validateResourceRequirements("server", resources.Server)
+}
+
+func validateResourceRequirements(component string, requirements *corev1.ResourceRequirements) error {
+	if requirements == nil {
+		return nil
+	}
+	for name, request := range requirements.Requests {
+		limit, ok := requirements.Limits[name]
+		if ok && limit.Cmp(request) < 0 {
+			return fmt.Errorf("the %s limit of the %s, %s, is lower than its request, %s", name, component, limit.String(), request.String())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("component resources tests", func() {
+	const namespace = "maroonedpods"
+
+	requirements := func(request, limit string) *corev1.ResourceRequirements {
+		return &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(request)},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(limit)},
+		}
+	}
+
+	deployment := func(resources *mpv1.ComponentResources, name string) *appsv1.Deployment {
+		args := &mpnamespaced.FactoryArgs{Namespace: namespace}
+		if resources != nil {
+			args.ControllerResources = resources.Controller
+			args.ServerResources = resources.Server
+		}
+		objects, err := mpnamespaced.CreateAllResources(args)
+		Expect(err).ToNot(HaveOccurred())
+		for _, object := range objects {
+			if d, ok := object.(*appsv1.Deployment); ok && d.Name == name {
+				Expect(sdk.SetLastAppliedConfiguration(d, LastAppliedConfigAnnotation)).To(Succeed())
+				return d
+			}
+		}
+		Fail("no deployment " + name)
+		return nil
+	}
+
+	containerResources := func(d *appsv1.Deployment) corev1.ResourceRequirements {
+		return d.Spec.Template.Spec.Containers[0].Resources
+	}
+
+	expectResources := func(actual, expected corev1.ResourceRequirements) {
+		Expect(equality.Semantic.DeepEqual(actual, expected)).To(BeTrue(), "expected %v, got %v", expected, actual)
+	}
+
+	reconcile := func(desired, current *appsv1.Deployment) *appsv1.Deployment {
+		merged, err := sdk.MergeObject(desired, current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		return merged.(*appsv1.Deployment)
+	}
+
+	It("should render today's manifests without resources", func() {
+		for _, name := range []string{util.ControllerResourceName, util.MaroonedPodsServerResourceName} {
+			Expect(deployment(&mpv1.ComponentResources{}, name)).To(Equal(deployment(nil, name)))
+		}
+	})
+
+	It("should render the resources of each component on its own deployment", func() {
+		server := requirements("100Mi", "200Mi")
+		resources := &mpv1.ComponentResources{Server: server}
+
+		expectResources(containerResources(deployment(resources, util.MaroonedPodsServerResourceName)), *server)
+		expectResources(containerResources(deployment(resources, util.ControllerResourceName)), containerResources(deployment(nil, util.ControllerResourceName)))
+	})
+
+	It("should apply the resources set, updated and unset in the CR", func() {
+		current := deployment(nil, util.MaroonedPodsServerResourceName)
+		defaults := containerResources(current)
+
+		set := requirements("100Mi", "200Mi")
+		current = reconcile(deployment(&mpv1.ComponentResources{Server: set}, util.MaroonedPodsServerResourceName), current)
+		expectResources(containerResources(current), *set)
+
+		updated := requirements("200Mi", "400Mi")
+		current = reconcile(deployment(&mpv1.ComponentResources{Server: updated}, util.MaroonedPodsServerResourceName), current)
+		expectResources(containerResources(current), *updated)
+
+		current = reconcile(deployment(nil, util.MaroonedPodsServerResourceName), current)
+		expectResources(containerResources(current), defaults)
+	})
+
+	It("should revert manual edits of the resources", func() {
+		desired := deployment(&mpv1.ComponentResources{Controller: requirements("100Mi", "200Mi")}, util.ControllerResourceName)
+		current := desired.DeepCopy()
+		current.Spec.Template.Spec.Containers[0].Resources = *requirements("1Gi", "2Gi")
+		current.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU] = resource.MustParse("1")
+
+		current = reconcile(desired, current)
+		expectResources(containerResources(current), containerResources(desired))
+	})
+
+	It("should reject limits lower than the requests", func() {
+		Expect(validateComponentResources(nil)).To(Succeed())
+		Expect(validateComponentResources(&mpv1.ComponentResources{Server: requirements("100Mi", "100Mi")})).To(Succeed())
+
+		err := validateComponentResources(&mpv1.ComponentResources{Controller: requirements("200Mi", "100Mi")})
+		Expect(err).To(MatchError(ContainSubstring("memory limit of the controller")))
+		Expect(validateComponentResources(&mpv1.ComponentResources{Server: requirements("200Mi", "100Mi")})).ToNot(Succeed())
+	})
+
+	It("should accept limits without requests", func() {
+		Expect(validateComponentResources(&mpv1.ComponentResources{Server: &corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		}})).To(Succeed())
+	})
+
+	It("should persist the degraded CR with invalid resources", func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(mpv1.AddToScheme(s)).To(Succeed())
+		cr := &mpv1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+			Spec:       mpv1.MaroonedPodsSpec{Resources: &mpv1.ComponentResources{Controller: requirements("200Mi", "100Mi")}},
+		}
+		r := &ReconcileMaroonedPods{
+			client:    crfake.NewClientBuilder().WithScheme(s).WithObjects(cr).Build(),
+			scheme:    s,
+			recorder:  record.NewFakeRecorder(10),
+			namespace: namespace,
+		}
+
+		_, err := r.GetAllResources(cr)
+		Expect(err).To(MatchError(ContainSubstring("memory limit of the controller")))
+
+		// the sdk doesn't update the status when the resources can't be generated
+		persisted := &mpv1.MaroonedPods{}
+		Expect(r.client.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, persisted)).To(Succeed())
+		condition := conditions.FindStatusCondition(persisted.Status.Conditions, conditions.ConditionDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("InvalidResources"))
+	})
+})
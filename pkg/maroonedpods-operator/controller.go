@@ -7,7 +7,10 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/tools/record"
+	"os"
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
 	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/maroonedpods-api/pkg/apis/core/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -15,6 +18,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/kelseyhightower/envconfig"
 	mpcluster "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
 	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
@@ -22,6 +26,7 @@ import (
 	sdkr "kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/reconciler"
 
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -35,7 +40,12 @@ const (
 	// LastAppliedConfigAnnotation is the annotation that holds the last resource state which we put on resources under our governance
 	LastAppliedConfigAnnotation = "operator.maroonedpods.io/lastAppliedConfiguration"
 
-	certPollInterval = 1 * time.Minute
+	// bounds of the requeue after a successful reconcile, within them it is the time until
+	// the nearest certificate refresh
+	certPollInterval   = 1 * time.Minute
+	certResyncInterval = 1 * time.Hour
+	// requeue of a reconcile that found the cert manager not ready, e.g. before its caches synced
+	certNotReadyRequeue = 2 * time.Second
 )
 
 var (
@@ -83,19 +93,25 @@ func newReconciler(mgr manager.Manager) (*ReconcileMaroonedPods, error) {
 		return nil, err
 	}
 
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
 	recorder := mgr.GetEventRecorderFor("operator-controller")
 
 	r := &ReconcileMaroonedPods{
-		client:         restClient,
-		uncachedClient: uncachedClient,
-		scheme:         scheme,
-		recorder:       recorder,
-		namespace:      namespace,
-		clusterArgs:    clusterArgs,
-		namespacedArgs: &namespacedArgs,
+		client:          restClient,
+		uncachedClient:  uncachedClient,
+		discoveryClient: discoveryClient,
+		scheme:          scheme,
+		recorder:        recorder,
+		namespace:       namespace,
+		clusterArgs:     clusterArgs,
+		namespacedArgs:  &namespacedArgs,
 	}
 	callbackDispatcher := callbacks.NewCallbackDispatcher(log, restClient, uncachedClient, scheme, namespace)
-	r.reconciler = sdkr.NewReconciler(r, log, restClient, callbackDispatcher, scheme, createVersionLabel, updateVersionLabel, LastAppliedConfigAnnotation, certPollInterval, finalizerName, true, recorder)
+	r.reconciler = sdkr.NewReconciler(r, log, restClient, callbackDispatcher, scheme, createVersionLabel, updateVersionLabel, LastAppliedConfigAnnotation, certResyncInterval, finalizerName, true, recorder)
 
 	r.registerHooks()
 
@@ -111,17 +127,24 @@ type ReconcileMaroonedPods struct {
 	client client.Client
 
 	// use this for getting any resources not in the install namespace or cluster scope
-	uncachedClient client.Client
-	scheme         *runtime.Scheme
-	recorder       record.EventRecorder
-	controller     controller.Controller
+	uncachedClient  client.Client
+	// used to detect optional APIs, e.g. monitoring.coreos.com
+	discoveryClient discovery.DiscoveryInterface
+	scheme          *runtime.Scheme
+	recorder        record.EventRecorder
+	controller      controller.Controller
 
 	namespace      string
 	clusterArgs    *mpcluster.FactoryArgs
 	namespacedArgs *mpnamespaced.FactoryArgs
 
-	certManager CertManager
+	certManager certmanager.CertManager
 	reconciler  *sdkr.Reconciler
+
+	// gates the readiness and the webhook configurations on the serving certificate
+	certReadiness *certReadiness
+	// set when the last GetAllResources left the webhook configurations out
+	webhooksDeferred bool
 }
 
 // SetController sets the controller dependency
@@ -151,13 +174,77 @@ func (r *ReconcileMaroonedPods) Reconcile(_ context.Context, request reconcile.R
 		return reconcile.Result{}, err
 	}
 
-	res, err := r.reconciler.Reconcile(request, operatorVersion, reqLogger)
-	if err != nil {
+	if err := r.reconcileOperatorResources(cr, reqLogger); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var res reconcile.Result
+	err = observePhase(phaseResources, func() (err error) {
+		res, err = r.reconciler.Reconcile(request, operatorVersion, reqLogger)
+		return err
+	})
+	// startup ordering rather than a failure
+	notReady := certManagerNotReady(err)
+	switch {
+	case notReady:
+		reqLogger.Info("The cert manager is not ready, requeueing", "reason", err.Error())
+	case err != nil:
 		reqLogger.Error(err, "failed to reconcile")
 	}
+	statusErr := observePhase(phaseStatus, func() error {
+		return r.updateStatusSummary(cr, err == nil)
+	})
+	if statusErr != nil {
+		reqLogger.Error(statusErr, "Failed to update the MaroonedPods status")
+		if err == nil || notReady {
+			return reconcile.Result{}, statusErr
+		}
+	}
+	return r.requeueResult(res, err)
+}
+
+// requeueResult adjusts the requeue of the sdk reconcile
+func (r *ReconcileMaroonedPods) requeueResult(res reconcile.Result, err error) (reconcile.Result, error) {
+	// retried soon instead of with the backoff of the errors
+	if certManagerNotReady(err) {
+		return reconcile.Result{RequeueAfter: certNotReadyRequeue}, nil
+	}
+	// the sdk requeues a successful reconcile after the resync interval
+	if err == nil && res.RequeueAfter == certResyncInterval {
+		res.RequeueAfter = certRequeueAfter(r.certManager.NextRefreshIn())
+	}
+	// the certificates are synced after the resources, the webhook configurations come with the next reconcile
+	if err == nil && r.webhooksDeferred && (res.RequeueAfter == 0 || res.RequeueAfter > webhooksDeferredRequeue) {
+		res.RequeueAfter = webhooksDeferredRequeue
+	}
 	return res, err
 }
 
+// reconcileOperatorResources reconciles what the sdk doesn't manage, before the sdk reconcile
+func (r *ReconcileMaroonedPods) reconcileOperatorResources(cr *v1alpha1.MaroonedPods, reqLogger logr.Logger) error {
+	if err := observePhase(phaseCertsFinalizer, func() error { return r.reconcileCertsFinalizer(cr, reqLogger) }); err != nil {
+		reqLogger.Error(err, "Failed to reconcile the certificates finalizer")
+		return err
+	}
+
+	if cr.DeletionTimestamp != nil {
+		return nil
+	}
+	if err := observePhase(phaseNetworkPolicies, func() error { return r.reconcileNetworkPolicies(cr) }); err != nil {
+		reqLogger.Error(err, "Failed to reconcile the NetworkPolicies")
+		return err
+	}
+	if err := observePhase(phasePodDisruptionBudget, func() error { return r.reconcileServerPodDisruptionBudget(cr) }); err != nil {
+		reqLogger.Error(err, "Failed to reconcile the server PodDisruptionBudget")
+		return err
+	}
+	if err := observePhase(phaseStaleResources, func() error { return r.deleteStaleResources(cr) }); err != nil {
+		reqLogger.Error(err, "Failed to delete the stale resources")
+		return err
+	}
+	return nil
+}
+
 func (r *ReconcileMaroonedPods) add(mgr manager.Manager) error {
 	// Create a new controller
 	c, err := controller.New("maroonedpods-operator-controller", mgr, controller.Options{Reconciler: r})
@@ -171,12 +258,30 @@ func (r *ReconcileMaroonedPods) add(mgr manager.Manager) error {
 		return err
 	}
 
-	cm, err := NewCertManager(mgr, r.namespace)
+	if err = r.watchClusterAPIServer(); err != nil {
+		return err
+	}
+
+	cm, err := certmanager.NewCertManager(mgr, r.namespace)
 	if err != nil {
 		return err
 	}
 
 	r.certManager = cm
+	r.certReadiness = newCertReadiness(mgr.GetAPIReader(), r.namespace, cm)
+	if err := mgr.AddReadyzCheck(certReadyzCheckName, r.certReadiness.readyz); err != nil {
+		return err
+	}
+
+	metricsServer, err := addMetricsServer(mgr, r.namespace)
+	if err != nil {
+		return err
+	}
+
+	if certDebugEnabled(os.Getenv(util.DebugCertsEnv)) {
+		log.Info("Serving the certificate status", "path", certDebugPath)
+		metricsServer.Handle(certDebugPath, newCertDebugHandler(cm))
+	}
 
 	return nil
 }
@@ -216,30 +321,43 @@ func (r *ReconcileMaroonedPods) getConfigMap() (*corev1.ConfigMap, error) {
 	return cm, nil
 }
 
-func (r *ReconcileMaroonedPods) getCertificateDefinitions(mp *v1alpha1.MaroonedPods) []mpcerts.CertificateDefinition {
-	args := &mpcerts.FactoryArgs{Namespace: r.namespace}
+func (r *ReconcileMaroonedPods) getCertificateDefinitions(mp *v1alpha1.MaroonedPods) ([]mpcerts.CertificateDefinition, error) {
+	return certificateDefinitionsOf(r.namespace, mp)
+}
 
-	if mp != nil && mp.Spec.CertConfig != nil {
-		if mp.Spec.CertConfig.CA != nil {
-			if mp.Spec.CertConfig.CA.Duration != nil {
-				args.SignerDuration = &mp.Spec.CertConfig.CA.Duration.Duration
-			}
+// certificateDefinitionsOf returns the definitions the operator issues for the CR, the defaults without a CR
+func certificateDefinitionsOf(namespace string, mp *v1alpha1.MaroonedPods) ([]mpcerts.CertificateDefinition, error) {
+	var config *v1alpha1.MaroonedPodsCertConfig
+	var featureGates []string
+	if mp != nil {
+		config = mp.Spec.CertConfig
+		featureGates = mp.Spec.FeatureGates
+	}
+	defs, err := mpcerts.DefinitionsFromCertConfig(namespace, config)
+	if err != nil {
+		return nil, err
+	}
 
-			if mp.Spec.CertConfig.CA.RenewBefore != nil {
-				args.SignerRenewBefore = &mp.Spec.CertConfig.CA.RenewBefore.Duration
-			}
+	gates, err := featuregate.New(featureGates)
+	if err != nil {
+		return nil, err
+	}
+	external := mp != nil && mp.Spec.CertManagement == v1alpha1.CertManagementExternal
+	var fipsMode v1alpha1.CertFIPSMode
+	if config != nil {
+		fipsMode = config.FIPSMode
+	}
+	fips := fipsEnabled(fipsMode)
+	for i := range defs {
+		defs[i].FIPS = fips
+		if defs[i].TargetService != nil && gates.Enabled(featuregate.StrictTargetService) {
+			defs[i].StrictTargetService = true
 		}
-
-		if mp.Spec.CertConfig.Server != nil {
-			if mp.Spec.CertConfig.Server.Duration != nil {
-				args.TargetDuration = &mp.Spec.CertConfig.Server.Duration.Duration
-			}
-
-			if mp.Spec.CertConfig.Server.RenewBefore != nil {
-				args.TargetRenewBefore = &mp.Spec.CertConfig.Server.RenewBefore.Duration
-			}
+		defs[i].DiscoverConsumers = gates.Enabled(featuregate.CertConsumerDiscovery)
+		// the metrics have a CA of their own
+		if defs[i].TargetService != nil && *defs[i].TargetService == mpcerts.ServerServiceName && external {
+			defs[i].External = true
 		}
 	}
-
-	return mpcerts.CreateCertificateDefinitions(args)
+	return defs, nil
 }
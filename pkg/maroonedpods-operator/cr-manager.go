@@ -2,7 +2,10 @@ package maroonedpods_operator
 
 import (
 	"context"
+	"fmt"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
 
 	mpcluster "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
 	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
@@ -14,10 +17,13 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	schedulingv1 "k8s.io/api/scheduling/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
 )
 
 // Status provides MaroonedPods status sub-resource
@@ -60,57 +66,144 @@ func (r *ReconcileMaroonedPods) getNamespacedArgs(cr *mpv1.MaroonedPods) *mpname
 		if cr.Spec.ImagePullPolicy != "" {
 			result.PullPolicy = string(cr.Spec.ImagePullPolicy)
 		}
-		if cr.Spec.PriorityClass != nil && string(*cr.Spec.PriorityClass) != "" {
-			result.PriorityClassName = string(*cr.Spec.PriorityClass)
-		} else {
-			result.PriorityClassName = util.MaroonedPodsPriorityClass
+		if len(cr.Spec.ImagePullSecrets) > 0 {
+			result.ImagePullSecrets = append([]corev1.LocalObjectReference(nil), cr.Spec.ImagePullSecrets...)
+		}
+		// a missing class of the CR fails GetAllResources before the args are built
+		result.PriorityClassName, _ = r.priorityClassName(cr)
+		// the workload placement is for the pods MaroonedPods creates, the deployments are infra
+		result.InfraNodePlacement = cr.Spec.Infra.DeepCopy()
+		if cr.Spec.Resources != nil {
+			result.ControllerResources = cr.Spec.Resources.Controller
+			result.ServerResources = cr.Spec.Resources.Server
 		}
-		// Verify the priority class name exists.
-		priorityClass := &schedulingv1.PriorityClass{}
-		if err := r.client.Get(context.TODO(), types.NamespacedName{Name: result.PriorityClassName}, priorityClass); err != nil {
-			// Any error we cannot determine if priority class exists.
-			result.PriorityClassName = ""
+		result.ServerReplicas = cr.Spec.ServerReplicas
+		// unknown gates fail GetAllResources before the args are built
+		result.FeatureGates, _ = featuregate.New(cr.Spec.FeatureGates)
+		result.MonitoringAvailable = r.monitoringAvailable()
+		if cr.Spec.Monitoring != nil {
+			result.ServiceMonitorLabels = cr.Spec.Monitoring.ServiceMonitorLabels
 		}
-		result.InfraNodePlacement = &cr.Spec.Infra
+		// without service-ca the certificates are self managed
+		result.ServiceCA, _ = useServiceCA(r.client.RESTMapper(), cr.Spec.CertManagement == mpv1.CertManagementServiceCA)
+		result.ProxyTrust = cr.Spec.CertConfig != nil && cr.Spec.CertConfig.ProxyTrust != nil
 	}
 
 	return &result
 }
 
+// priorityClassName returns the PriorityClass of the components: the one of the CR, which must exist,
+// else the default one when it exists, else none
+func (r *ReconcileMaroonedPods) priorityClassName(cr *mpv1.MaroonedPods) (string, error) {
+	name := util.MaroonedPodsPriorityClass
+	requested := cr.Spec.PriorityClass != nil && string(*cr.Spec.PriorityClass) != ""
+	if requested {
+		name = string(*cr.Spec.PriorityClass)
+	}
+
+	priorityClass := &schedulingv1.PriorityClass{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: name}, priorityClass)
+	switch {
+	case err == nil:
+		return name, nil
+	case !requested:
+		// the components run without a priority when the default class can't be found
+		return "", nil
+	case errors.IsNotFound(err):
+		return "", fmt.Errorf("the PriorityClass %s of the MaroonedPods CR does not exist, the pods can't be created with it", name)
+	default:
+		return "", err
+	}
+}
+
+// markFailedHealing degrades the CR and persists its conditions right away when they changed, the sdk
+// doesn't update the status when the resources can't be generated
+func (r *ReconcileMaroonedPods) markFailedHealing(cr *mpv1.MaroonedPods, reason, message string) {
+	before := conditions.FindStatusCondition(cr.Status.Conditions, conditions.ConditionDegraded)
+	if before != nil {
+		before = before.DeepCopy()
+	}
+	sdk.MarkCrFailedHealing(cr, r.Status(cr), reason, message, r.recorder)
+	if before != nil && before.Status == corev1.ConditionTrue && before.Reason == reason && before.Message == message {
+		return
+	}
+	if err := r.client.Status().Update(context.TODO(), cr); err != nil {
+		log.Error(err, "Failed to update the conditions", "reason", reason)
+	}
+}
+
 // GetAllResources provides slice of resources MaroonedPods depends on
 func (r *ReconcileMaroonedPods) GetAllResources(crObject client.Object) ([]client.Object, error) {
 	cr := crObject.(*mpv1.MaroonedPods)
 	var resources []client.Object
 
+	if err := featuregate.Validate(cr.Spec.FeatureGates); err != nil {
+		r.markFailedHealing(cr, "UnknownFeatureGate", err.Error())
+		return nil, err
+	}
+	if err := validateComponentResources(cr.Spec.Resources); err != nil {
+		r.markFailedHealing(cr, "InvalidResources", err.Error())
+		return nil, err
+	}
+	if _, err := r.priorityClassName(cr); err != nil {
+		r.markFailedHealing(cr, "PriorityClassNotFound", err.Error())
+		return nil, err
+	}
+
 	if sdk.DeployClusterResources() {
 		crs, err := mpcluster.CreateAllStaticResources(r.clusterArgs)
 		if err != nil {
-			sdk.MarkCrFailedHealing(cr, r.Status(cr), "CreateResources", "Unable to create all resources", r.recorder)
+			r.markFailedHealing(cr, "CreateResources", "Unable to create all resources")
 			return nil, err
 		}
 
 		resources = append(resources, crs...)
 	}
 
-	nsrs, err := mpnamespaced.CreateAllResources(r.getNamespacedArgs(cr))
+	namespacedArgs := r.getNamespacedArgs(cr)
+	profile, err := tlsSecurityProfile(r.client, cr)
+	if err != nil {
+		return nil, err
+	}
+	tlsProfile, err := tlsprofile.Spec(profile)
+	if err != nil {
+		r.markFailedHealing(cr, "InvalidTLSSecurityProfile", err.Error())
+		return nil, err
+	}
+	namespacedArgs.TLSProfile = tlsProfile
+
+	nsrs, err := mpnamespaced.CreateAllResources(namespacedArgs)
 	if err != nil {
-		sdk.MarkCrFailedHealing(cr, r.Status(cr), "CreateNamespaceResources", "Unable to create all namespaced resources", r.recorder)
+		r.markFailedHealing(cr, "CreateNamespaceResources", "Unable to create all namespaced resources")
 		return nil, err
 	}
 
 	resources = append(resources, nsrs...)
 
-	drs, err := mpcluster.CreateAllDynamicResources(r.clusterArgs)
+	drs, err := r.createDynamicResources()
 	if err != nil {
-		sdk.MarkCrFailedHealing(cr, r.Status(cr), "CreateDynamicResources", "Unable to create all dynamic resources", r.recorder)
+		r.markFailedHealing(cr, "CreateDynamicResources", "Unable to create all dynamic resources")
 		return nil, err
 	}
 
 	resources = append(resources, drs...)
 
-	certs := r.getCertificateDefinitions(cr)
+	// serving secrets are created by service-ca and there is no signer when it is in use
+	serviceCA, err := useServiceCA(r.client.RESTMapper(), cr.Spec.CertManagement == mpv1.CertManagementServiceCA)
+	if err != nil && err != errServiceCAUnavailable {
+		return nil, err
+	}
+
+	certs, err := r.getCertificateDefinitions(cr)
+	if err != nil {
+		r.markFailedHealing(cr, "InvalidCertConfig", err.Error())
+		return nil, err
+	}
 	for _, cert := range certs {
-		if cert.SignerSecret != nil {
+		servedByServiceCA := serviceCA && cert.TargetService != nil
+
+		// the built-in signer is not used with service-ca, a cert-manager issuer or external certificates
+		if cert.SignerSecret != nil && !servedByServiceCA && cert.Issuer == nil && !cert.External {
 			resources = append(resources, cert.SignerSecret)
 		}
 
@@ -118,7 +211,7 @@ func (r *ReconcileMaroonedPods) GetAllResources(crObject client.Object) ([]clien
 			resources = append(resources, cert.CertBundleConfigmap)
 		}
 
-		if cert.TargetSecret != nil {
+		if cert.TargetSecret != nil && !servedByServiceCA {
 			resources = append(resources, cert.TargetSecret)
 		}
 	}
@@ -0,0 +1,138 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("feature gate tests", func() {
+	const namespace = "maroonedpods"
+
+	var r *ReconcileMaroonedPods
+
+	newCR := func(gates ...string) *mpv1.MaroonedPods {
+		return &mpv1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+			Spec:       mpv1.MaroonedPodsSpec{FeatureGates: gates},
+		}
+	}
+
+	deployments := func(cr *mpv1.MaroonedPods) map[string]*appsv1.Deployment {
+		resources, err := mpnamespaced.CreateAllResources(r.getNamespacedArgs(cr))
+		Expect(err).ToNot(HaveOccurred())
+		result := map[string]*appsv1.Deployment{}
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok {
+				Expect(sdk.SetLastAppliedConfiguration(deployment, LastAppliedConfigAnnotation)).To(Succeed())
+				result[deployment.Name] = deployment
+			}
+		}
+		Expect(result).To(HaveLen(2))
+		return result
+	}
+
+	gatesEnv := func(deployment *appsv1.Deployment) *corev1.EnvVar {
+		for _, env := range deployment.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == featuregate.Env {
+				return &env
+			}
+		}
+		return nil
+	}
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(mpv1.AddToScheme(s)).To(Succeed())
+		r = &ReconcileMaroonedPods{
+			client:          crfake.NewClientBuilder().WithScheme(s).WithObjects(newCR()).Build(),
+			discoveryClient: &discoveryfake.FakeDiscovery{Fake: &testingclient.Fake{}},
+			scheme:          s,
+			recorder:        record.NewFakeRecorder(10),
+			namespace:       namespace,
+			namespacedArgs:  &mpnamespaced.FactoryArgs{Namespace: namespace},
+		}
+	})
+
+	It("should propagate the enabled gates to the controller and the server", func() {
+		for name, deployment := range deployments(newCR(featuregate.StrictTargetService)) {
+			env := gatesEnv(deployment)
+			Expect(env).ToNot(BeNil(), "deployment %s", name)
+			Expect(env.Value).To(Equal(featuregate.StrictTargetService))
+		}
+	})
+
+	It("should render today's manifests without gates", func() {
+		for _, deployment := range deployments(newCR()) {
+			Expect(gatesEnv(deployment)).To(BeNil())
+		}
+	})
+
+	It("should roll the components when a gate is flipped", func() {
+		current := deployments(newCR())[util.MaroonedPodsServerResourceName]
+
+		merged, err := sdk.MergeObject(deployments(newCR(featuregate.StrictTargetService))[util.MaroonedPodsServerResourceName], current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		current = merged.(*appsv1.Deployment)
+		Expect(gatesEnv(current)).ToNot(BeNil())
+
+		merged, err = sdk.MergeObject(deployments(newCR())[util.MaroonedPodsServerResourceName], current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gatesEnv(merged.(*appsv1.Deployment))).To(BeNil())
+	})
+
+	It("should make the webhook Service required with StrictTargetService", func() {
+		certs, err := r.getCertificateDefinitions(newCR())
+		Expect(err).ToNot(HaveOccurred())
+		for _, cd := range certs {
+			Expect(cd.StrictTargetService).To(BeFalse())
+		}
+
+		certs, err = r.getCertificateDefinitions(newCR(featuregate.StrictTargetService))
+		Expect(err).ToNot(HaveOccurred())
+		for _, cd := range certs {
+			Expect(cd.StrictTargetService).To(Equal(cd.TargetService != nil))
+		}
+	})
+
+	It("should discover the consumers of the certificates with CertConsumerDiscovery", func() {
+		certs, err := r.getCertificateDefinitions(newCR(featuregate.CertConsumerDiscovery))
+		Expect(err).ToNot(HaveOccurred())
+		for _, cd := range certs {
+			Expect(cd.DiscoverConsumers).To(BeTrue())
+		}
+	})
+
+	It("should degrade the CR with an unknown gate", func() {
+		cr := newCR("Teleport")
+
+		_, err := r.GetAllResources(cr)
+		Expect(err).To(MatchError(ContainSubstring(`unknown feature gate "Teleport"`)))
+
+		persisted := &mpv1.MaroonedPods{}
+		Expect(r.client.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, persisted)).To(Succeed())
+		condition := conditions.FindStatusCondition(persisted.Status.Conditions, conditions.ConditionDegraded)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Reason).To(Equal("UnknownFeatureGate"))
+	})
+})
@@ -0,0 +1,84 @@
+package maroonedpods_operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("image pull secrets tests", func() {
+	const namespace = "maroonedpods"
+
+	pullSecrets := []corev1.LocalObjectReference{{Name: "registry-a"}, {Name: "registry-b"}}
+
+	workloads := func(cr *mpv1.MaroonedPods) map[string]*appsv1.Deployment {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		r := &ReconcileMaroonedPods{
+			client:          crfake.NewClientBuilder().WithScheme(s).Build(),
+			discoveryClient: &discoveryfake.FakeDiscovery{Fake: &testingclient.Fake{}},
+			scheme:          s,
+			namespace:       namespace,
+			namespacedArgs:  &mpnamespaced.FactoryArgs{Namespace: namespace},
+		}
+		resources, err := mpnamespaced.CreateAllResources(r.getNamespacedArgs(cr))
+		Expect(err).ToNot(HaveOccurred())
+		deployments := map[string]*appsv1.Deployment{}
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok {
+				Expect(sdk.SetLastAppliedConfiguration(deployment, LastAppliedConfigAnnotation)).To(Succeed())
+				deployments[deployment.Name] = deployment
+			}
+		}
+		Expect(deployments).To(HaveLen(2))
+		return deployments
+	}
+
+	It("should render the pull secrets of the CR on every workload", func() {
+		for name, deployment := range workloads(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{ImagePullSecrets: pullSecrets}}) {
+			Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(Equal(pullSecrets), "deployment %s", name)
+		}
+	})
+
+	It("should render no pull secrets without any in the CR", func() {
+		for name, deployment := range workloads(&mpv1.MaroonedPods{}) {
+			Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(BeEmpty(), "deployment %s", name)
+		}
+	})
+
+	It("should reconcile the pull secrets added and removed in the CR", func() {
+		current := workloads(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{ImagePullSecrets: pullSecrets[:1]}})
+
+		for name, desired := range workloads(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{ImagePullSecrets: pullSecrets}}) {
+			merged, err := sdk.MergeObject(desired, current[name], LastAppliedConfigAnnotation)
+			Expect(err).ToNot(HaveOccurred())
+			current[name] = merged.(*appsv1.Deployment)
+			Expect(current[name].Spec.Template.Spec.ImagePullSecrets).To(Equal(pullSecrets), "deployment %s", name)
+		}
+
+		for name, desired := range workloads(&mpv1.MaroonedPods{}) {
+			merged, err := sdk.MergeObject(desired, current[name], LastAppliedConfigAnnotation)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged.(*appsv1.Deployment).Spec.Template.Spec.ImagePullSecrets).To(BeEmpty(), "deployment %s", name)
+		}
+	})
+
+	It("should not share the pull secrets of the CR", func() {
+		cr := &mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry-a"}}}}
+		for _, deployment := range workloads(cr) {
+			deployment.Spec.Template.Spec.ImagePullSecrets[0].Name = "edited"
+		}
+		Expect(cr.Spec.ImagePullSecrets[0].Name).To(Equal("registry-a"))
+	})
+})
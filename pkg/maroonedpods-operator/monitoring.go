@@ -0,0 +1,39 @@
+package maroonedpods_operator
+
+import (
+	promv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+// isMonitoringAvailable checks whether the cluster serves the monitoring.coreos.com/v1 PrometheusRules
+// and ServiceMonitors
+func isMonitoringAvailable(dc discovery.DiscoveryInterface) (bool, error) {
+	resources, err := dc.ServerResourcesForGroupVersion(promv1.SchemeGroupVersion.String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	kinds := map[string]bool{}
+	for _, resource := range resources.APIResources {
+		kinds[resource.Kind] = true
+	}
+	return kinds[promv1.PrometheusRuleKind] && kinds[promv1.ServiceMonitorsKind], nil
+}
+
+// monitoringAvailable returns whether the monitoring resources can be created, they are
+// skipped when the prometheus-operator is not installed
+func (r *ReconcileMaroonedPods) monitoringAvailable() bool {
+	available, err := isMonitoringAvailable(r.discoveryClient)
+	if err != nil {
+		log.Error(err, "Unable to discover the monitoring.coreos.com API, skipping the monitoring resources")
+		return false
+	}
+	if !available {
+		// the usual case without the prometheus-operator, logged on every reconcile
+		log.V(1).Info("The monitoring.coreos.com API is not available, skipping the monitoring resources")
+	}
+	return available
+}
@@ -0,0 +1,313 @@
+package maroonedpods_operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	promv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("monitoring tests", func() {
+	const namespace = "maroonedpods"
+
+	newDiscovery := func(resources ...*metav1.APIResourceList) *discoveryfake.FakeDiscovery {
+		return &discoveryfake.FakeDiscovery{Fake: &testingclient.Fake{Resources: resources}}
+	}
+
+	monitoringResources := &metav1.APIResourceList{
+		GroupVersion: promv1.SchemeGroupVersion.String(),
+		APIResources: []metav1.APIResource{
+			{Name: "servicemonitors", Kind: promv1.ServiceMonitorsKind, Namespaced: true},
+			{Name: "prometheusrules", Kind: promv1.PrometheusRuleKind, Namespaced: true},
+		},
+	}
+
+	findRule := func(resources []client.Object) *promv1.PrometheusRule {
+		for _, resource := range resources {
+			if rule, ok := resource.(*promv1.PrometheusRule); ok {
+				return rule
+			}
+		}
+		return nil
+	}
+
+	findServiceMonitor := func(resources []client.Object) *promv1.ServiceMonitor {
+		for _, resource := range resources {
+			if monitor, ok := resource.(*promv1.ServiceMonitor); ok {
+				return monitor
+			}
+		}
+		return nil
+	}
+
+	scrapedServices := func(resources []client.Object) map[string]*corev1.Service {
+		services := map[string]*corev1.Service{}
+		for _, resource := range resources {
+			if service, ok := resource.(*corev1.Service); ok && service.Labels[util.PrometheusLabelKey] == util.PrometheusLabelValue {
+				services[service.Name] = service
+			}
+		}
+		return services
+	}
+
+	// namespacedArgs are the args of the CR the way the reconcile builds them, discovering the monitoring API
+	namespacedArgs := func(cr *mpv1.MaroonedPods, discovered ...*metav1.APIResourceList) *mpnamespaced.FactoryArgs {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		r := &ReconcileMaroonedPods{
+			client:          crfake.NewClientBuilder().WithScheme(s).Build(),
+			discoveryClient: newDiscovery(discovered...),
+			scheme:          s,
+			namespace:       namespace,
+			namespacedArgs:  &mpnamespaced.FactoryArgs{Namespace: namespace},
+		}
+		return r.getNamespacedArgs(cr)
+	}
+
+	// reconcileResources renders the resources of the CR the way the reconcile does
+	reconcileResources := func(cr *mpv1.MaroonedPods, discovered ...*metav1.APIResourceList) []client.Object {
+		resources, err := mpnamespaced.CreateAllResources(namespacedArgs(cr, discovered...))
+		Expect(err).ToNot(HaveOccurred())
+		return resources
+	}
+
+	newCR := func(serviceMonitorLabels map[string]string) *mpv1.MaroonedPods {
+		cr := &mpv1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+		if serviceMonitorLabels != nil {
+			cr.Spec.Monitoring = &mpv1.MonitoringConfig{ServiceMonitorLabels: serviceMonitorLabels}
+		}
+		return cr
+	}
+
+	createResources := func(available bool) []client.Object {
+		resources, err := mpnamespaced.CreateAllResources(&mpnamespaced.FactoryArgs{
+			Namespace:           namespace,
+			MonitoringAvailable: available,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return resources
+	}
+
+	It("should detect the monitoring API", func() {
+		available, err := isMonitoringAvailable(newDiscovery(monitoringResources))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(available).To(BeTrue())
+	})
+
+	It("should not detect the monitoring API when monitoring.coreos.com is absent", func() {
+		available, err := isMonitoringAvailable(newDiscovery(&metav1.APIResourceList{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment", Namespaced: true}},
+		}))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(available).To(BeFalse())
+	})
+
+	It("should not detect the monitoring API when only some of the kinds are served", func() {
+		for _, resource := range monitoringResources.APIResources {
+			available, err := isMonitoringAvailable(newDiscovery(&metav1.APIResourceList{
+				GroupVersion: promv1.SchemeGroupVersion.String(),
+				APIResources: []metav1.APIResource{resource},
+			}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(available).To(BeFalse(), "only %s", resource.Kind)
+		}
+	})
+
+	It("should create the certificate alerts when monitoring is available", func() {
+		rule := findRule(createResources(true))
+		Expect(rule).ToNot(BeNil())
+		Expect(rule.Name).To(Equal(mpnamespaced.PrometheusRuleName))
+		Expect(rule.Namespace).To(Equal(namespace))
+		Expect(rule.Kind).To(Equal(promv1.PrometheusRuleKind))
+
+		var alerts []string
+		for _, group := range rule.Spec.Groups {
+			for _, r := range group.Rules {
+				Expect(r.Expr.String()).ToNot(BeEmpty())
+				Expect(r.Labels).To(HaveKey("severity"))
+				alerts = append(alerts, r.Alert)
+			}
+		}
+		Expect(alerts).To(ConsistOf("MaroonedPodsCertExpiringSoon", "MaroonedPodsCertRotationStuck", "MaroonedPodsCertSyncErrors"))
+	})
+
+	It("should not create the certificate alerts when monitoring is not available", func() {
+		Expect(findRule(createResources(false))).To(BeNil())
+	})
+
+	It("should scrape the operator, the controller and the server when the monitoring API is served", func() {
+		resources := reconcileResources(newCR(map[string]string{"release": "prometheus"}), monitoringResources)
+
+		monitor := findServiceMonitor(resources)
+		Expect(monitor).ToNot(BeNil())
+		Expect(monitor.Name).To(Equal(mpnamespaced.ServiceMonitorName))
+		Expect(monitor.Namespace).To(Equal(namespace))
+		Expect(monitor.Labels).To(HaveKeyWithValue("release", "prometheus"))
+		Expect(monitor.Labels).To(HaveKeyWithValue(util.AppKubernetesManagedByLabel, "maroonedpods-operator"))
+		Expect(monitor.Spec.NamespaceSelector.MatchNames).To(ConsistOf(namespace))
+
+		services := scrapedServices(resources)
+		Expect(services).To(HaveLen(3))
+		Expect(services).To(HaveKey(mpnamespaced.OperatorMetricsServiceName))
+		Expect(services).To(HaveKey(mpnamespaced.ControllerMetricsServiceName))
+		Expect(services).To(HaveKey(util.MaroonedPodsServerResourceName))
+
+		ports := map[string]bool{}
+		for _, endpoint := range monitor.Spec.Endpoints {
+			Expect(endpoint.Path).To(Equal(util.MetricsPath))
+			ports[endpoint.Port] = true
+		}
+		Expect(monitor.Spec.Selector.MatchLabels).To(Equal(map[string]string{util.PrometheusLabelKey: util.PrometheusLabelValue}))
+		for name, service := range services {
+			Expect(service.Spec.Ports).To(HaveLen(1))
+			Expect(ports).To(HaveKey(service.Spec.Ports[0].Name), "service %s", name)
+		}
+	})
+
+	It("should not create the ServiceMonitor when the monitoring API is absent", func() {
+		resources := reconcileResources(newCR(map[string]string{"release": "prometheus"}))
+
+		Expect(findServiceMonitor(resources)).To(BeNil())
+		Expect(findRule(resources)).To(BeNil())
+		// the metrics certificates are issued for the Services
+		services := scrapedServices(resources)
+		Expect(services).To(HaveLen(3))
+		Expect(services).To(HaveKey(mpnamespaced.OperatorMetricsServiceName))
+		Expect(services).To(HaveKey(mpnamespaced.ControllerMetricsServiceName))
+	})
+
+	DescribeTable("should verify the serving certificates of the scraped Services", func(serviceCA bool, serverBundleKey string) {
+		cr := newCR(map[string]string{"release": "prometheus"})
+		args := namespacedArgs(cr, monitoringResources)
+		args.ServiceCA = serviceCA
+		resources, err := mpnamespaced.CreateAllResources(args)
+		Expect(err).ToNot(HaveOccurred())
+		monitor := findServiceMonitor(resources)
+		Expect(monitor).ToNot(BeNil())
+
+		bundles := map[string]string{
+			mpnamespaced.OperatorMetricsServiceName:   cert.MetricsCABundleConfigMapName,
+			mpnamespaced.ControllerMetricsServiceName: cert.MetricsCABundleConfigMapName,
+			util.MaroonedPodsServerResourceName:       cert.CABundleConfigMapName,
+		}
+		services := scrapedServices(resources)
+		Expect(monitor.Spec.Endpoints).To(HaveLen(len(services)))
+		for name, service := range services {
+			var endpoint *promv1.Endpoint
+			for i := range monitor.Spec.Endpoints {
+				if monitor.Spec.Endpoints[i].Port == service.Spec.Ports[0].Name {
+					endpoint = &monitor.Spec.Endpoints[i]
+				}
+			}
+			Expect(endpoint).ToNot(BeNil(), "service %s", name)
+			Expect(endpoint.Scheme).To(Equal("https"))
+			Expect(endpoint.TLSConfig).ToNot(BeNil())
+			Expect(endpoint.TLSConfig.InsecureSkipVerify).To(BeFalse())
+			Expect(endpoint.TLSConfig.ServerName).To(Equal(name + "." + namespace + ".svc"))
+			Expect(endpoint.TLSConfig.CA.ConfigMap).ToNot(BeNil())
+			Expect(endpoint.TLSConfig.CA.ConfigMap.Name).To(Equal(bundles[name]))
+			if name == util.MaroonedPodsServerResourceName {
+				Expect(endpoint.TLSConfig.CA.ConfigMap.Key).To(Equal(serverBundleKey))
+			} else {
+				Expect(endpoint.TLSConfig.CA.ConfigMap.Key).To(Equal(cert.CABundleKey))
+			}
+		}
+	},
+		Entry("self managed", false, cert.CABundleKey),
+		Entry("with service-ca", true, cert.ServiceCABundleKey),
+	)
+
+	It("should issue the metrics certificates for the scraped Services", func() {
+		certs, err := certificateDefinitionsOf(namespace, newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		issued := map[string]string{}
+		for _, cd := range certs {
+			if cd.CertBundleConfigmap.Name == cert.MetricsCABundleConfigMapName {
+				issued[*cd.TargetService] = cd.TargetSecret.Name
+			}
+		}
+		Expect(issued).To(Equal(map[string]string{
+			mpnamespaced.OperatorMetricsServiceName:   util.OperatorMetricsCertSecretName,
+			mpnamespaced.ControllerMetricsServiceName: util.ControllerMetricsCertSecretName,
+		}))
+	})
+
+	It("should mount the metrics certificate into the controller and expose its port", func() {
+		var controller *appsv1.Deployment
+		for _, resource := range reconcileResources(newCR(nil), monitoringResources) {
+			if deployment, ok := resource.(*appsv1.Deployment); ok && deployment.Name == util.ControllerResourceName {
+				controller = deployment
+			}
+		}
+		Expect(controller).ToNot(BeNil())
+
+		var volume *corev1.Volume
+		for i, v := range controller.Spec.Template.Spec.Volumes {
+			if v.Secret != nil && v.Secret.SecretName == util.ControllerMetricsCertSecretName {
+				volume = &controller.Spec.Template.Spec.Volumes[i]
+			}
+		}
+		Expect(volume).ToNot(BeNil())
+		Expect(*volume.Secret.Optional).To(BeTrue())
+
+		container := controller.Spec.Template.Spec.Containers[0]
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: volume.Name, MountPath: cert.MetricsCertDir, ReadOnly: true}))
+
+		service := scrapedServices(reconcileResources(newCR(nil), monitoringResources))[mpnamespaced.ControllerMetricsServiceName]
+		Expect(service).ToNot(BeNil())
+		var port *corev1.ContainerPort
+		for i, p := range container.Ports {
+			if p.Name == service.Spec.Ports[0].TargetPort.String() {
+				port = &container.Ports[i]
+			}
+		}
+		Expect(port).ToNot(BeNil())
+		Expect(port.ContainerPort).To(BeEquivalentTo(util.ControllerMetricsPort))
+	})
+
+	It("should repair a modified ServiceMonitor", func() {
+		desired := findServiceMonitor(reconcileResources(newCR(map[string]string{"release": "prometheus"}), monitoringResources))
+		Expect(sdk.SetLastAppliedConfiguration(desired, LastAppliedConfigAnnotation)).To(Succeed())
+
+		current := desired.DeepCopy()
+		delete(current.Labels, "release")
+		current.Spec.Endpoints = current.Spec.Endpoints[:1]
+		current.Spec.Selector.MatchLabels = map[string]string{"app": "other"}
+
+		merged, err := sdk.MergeObject(desired, current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		repaired := merged.(*promv1.ServiceMonitor)
+		Expect(repaired.Labels).To(HaveKeyWithValue("release", "prometheus"))
+		Expect(repaired.Spec.Endpoints).To(Equal(desired.Spec.Endpoints))
+		Expect(repaired.Spec.Selector).To(Equal(desired.Spec.Selector))
+	})
+
+	It("should follow the ServiceMonitor labels of the CR", func() {
+		current := findServiceMonitor(reconcileResources(newCR(map[string]string{"release": "prometheus"}), monitoringResources))
+		Expect(sdk.SetLastAppliedConfiguration(current, LastAppliedConfigAnnotation)).To(Succeed())
+
+		desired := findServiceMonitor(reconcileResources(newCR(map[string]string{"prometheus": "cluster"}), monitoringResources))
+		Expect(sdk.SetLastAppliedConfiguration(desired, LastAppliedConfigAnnotation)).To(Succeed())
+
+		merged, err := sdk.MergeObject(desired, current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(merged.GetLabels()).To(HaveKeyWithValue("prometheus", "cluster"))
+		Expect(merged.GetLabels()).ToNot(HaveKey("release"))
+	})
+})
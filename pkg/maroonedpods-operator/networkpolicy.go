@@ -0,0 +1,81 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// reconcileNetworkPolicies creates the NetworkPolicies enabled by the CR, repairs the edited ones and
+// deletes them once they are disabled. Policies of the same name the CR doesn't control are left alone.
+func (r *ReconcileMaroonedPods) reconcileNetworkPolicies(mp *v1alpha1.MaroonedPods) error {
+	desired := map[string]*networkingv1.NetworkPolicy{}
+	for _, policy := range mpnamespaced.CreateNetworkPolicies(&mpnamespaced.FactoryArgs{Namespace: r.namespace, NetworkPolicy: mp.Spec.NetworkPolicy}) {
+		desired[policy.Name] = policy
+	}
+
+	for _, name := range mpnamespaced.NetworkPolicyNames() {
+		current := &networkingv1.NetworkPolicy{}
+		err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: r.namespace, Name: name}, current)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		found := err == nil
+		policy, enabled := desired[name]
+
+		switch {
+		case !enabled && found:
+			if !metav1.IsControlledBy(current, mp) {
+				continue
+			}
+			log.Info("Deleting disabled NetworkPolicy", "name", name)
+			if err := r.client.Delete(context.TODO(), current); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		case enabled && !found:
+			if err := controllerutil.SetControllerReference(mp, policy, r.scheme); err != nil {
+				return err
+			}
+			log.Info("Creating NetworkPolicy", "name", name)
+			if err := r.client.Create(context.TODO(), policy); err != nil {
+				return err
+			}
+		case enabled && found:
+			if !metav1.IsControlledBy(current, mp) || networkPolicyConverged(current, policy) {
+				continue
+			}
+			updated := current.DeepCopy()
+			updated.Spec = policy.Spec
+			if updated.Labels == nil {
+				updated.Labels = map[string]string{}
+			}
+			for key, value := range policy.Labels {
+				updated.Labels[key] = value
+			}
+			log.Info("Repairing NetworkPolicy", "name", name)
+			if err := r.client.Update(context.TODO(), updated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// networkPolicyConverged tells if the policy has the spec and the labels of the desired one,
+// labels added by others are kept
+func networkPolicyConverged(current, desired *networkingv1.NetworkPolicy) bool {
+	for key, value := range desired.Labels {
+		if current.Labels[key] != value {
+			return false
+		}
+	}
+	return equality.Semantic.DeepEqual(current.Spec, desired.Spec)
+}
@@ -0,0 +1,141 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("NetworkPolicy tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient client.Client
+		r        *ReconcileMaroonedPods
+	)
+
+	newCR := func(config *v1alpha1.NetworkPolicyConfig) *v1alpha1.MaroonedPods {
+		return &v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods", UID: "cr-uid"},
+			Spec:       v1alpha1.MaroonedPodsSpec{NetworkPolicy: config},
+		}
+	}
+
+	getPolicy := func(name string) (*networkingv1.NetworkPolicy, error) {
+		policy := &networkingv1.NetworkPolicy{}
+		err := crClient.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, policy)
+		return policy, err
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).Build()
+		r = &ReconcileMaroonedPods{client: crClient, scheme: scheme, namespace: namespace}
+	})
+
+	It("should create no NetworkPolicy unless enabled", func() {
+		Expect(r.reconcileNetworkPolicies(newCR(nil))).To(Succeed())
+		Expect(r.reconcileNetworkPolicies(newCR(&v1alpha1.NetworkPolicyConfig{}))).To(Succeed())
+
+		for _, name := range mpnamespaced.NetworkPolicyNames() {
+			_, err := getPolicy(name)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("should allow the ingress to the webhook port from any source when enabled", func() {
+		mp := newCR(&v1alpha1.NetworkPolicyConfig{Enabled: true})
+		Expect(r.reconcileNetworkPolicies(mp)).To(Succeed())
+
+		policy, err := getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metav1.IsControlledBy(policy, mp)).To(BeTrue())
+		Expect(policy.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress))
+		Expect(policy.Spec.Ingress).To(HaveLen(1))
+		Expect(policy.Spec.Ingress[0].From).To(BeEmpty())
+		Expect(policy.Spec.Ingress[0].Ports).To(HaveLen(1))
+		Expect(policy.Spec.Ingress[0].Ports[0].Port.IntValue()).To(Equal(8443))
+
+		policy, err = getPolicy(mpnamespaced.ControllerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeEgress))
+	})
+
+	It("should restrict the ingress to the configured sources", func() {
+		selector := &metav1.LabelSelector{MatchLabels: map[string]string{"name": "apiserver"}}
+		mp := newCR(&v1alpha1.NetworkPolicyConfig{
+			Enabled:                  true,
+			IngressCIDRs:             []string{"10.0.0.0/16"},
+			IngressNamespaceSelector: selector,
+		})
+		Expect(r.reconcileNetworkPolicies(mp)).To(Succeed())
+
+		policy, err := getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Spec.Ingress[0].From).To(ConsistOf(
+			networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.0/16"}},
+			networkingv1.NetworkPolicyPeer{NamespaceSelector: selector},
+		))
+	})
+
+	It("should delete the NetworkPolicies once disabled", func() {
+		Expect(r.reconcileNetworkPolicies(newCR(&v1alpha1.NetworkPolicyConfig{Enabled: true}))).To(Succeed())
+
+		Expect(r.reconcileNetworkPolicies(newCR(&v1alpha1.NetworkPolicyConfig{Enabled: false}))).To(Succeed())
+
+		for _, name := range mpnamespaced.NetworkPolicyNames() {
+			_, err := getPolicy(name)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("should repair a manually edited NetworkPolicy", func() {
+		mp := newCR(&v1alpha1.NetworkPolicyConfig{Enabled: true})
+		Expect(r.reconcileNetworkPolicies(mp)).To(Succeed())
+		expected, err := getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+
+		edited := expected.DeepCopy()
+		edited.Spec.Ingress = nil
+		edited.Labels["team"] = "network"
+		Expect(crClient.Update(context.TODO(), edited)).To(Succeed())
+
+		Expect(r.reconcileNetworkPolicies(mp)).To(Succeed())
+
+		policy, err := getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Spec).To(Equal(expected.Spec))
+		Expect(policy.Labels).To(HaveKeyWithValue("team", "network"))
+	})
+
+	It("should leave a NetworkPolicy it doesn't control alone", func() {
+		foreign := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: mpnamespaced.ServerNetworkPolicyName},
+		}
+		Expect(crClient.Create(context.TODO(), foreign)).To(Succeed())
+
+		Expect(r.reconcileNetworkPolicies(newCR(&v1alpha1.NetworkPolicyConfig{Enabled: true}))).To(Succeed())
+		policy, err := getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Spec.Ingress).To(BeEmpty())
+
+		Expect(r.reconcileNetworkPolicies(newCR(nil))).To(Succeed())
+		_, err = getPolicy(mpnamespaced.ServerNetworkPolicyName)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,31 @@
+package maroonedpods_operator
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/certwatcher"
+)
+
+// addMetricsServer serves the metrics of the manager over TLS with the rotated certificate of the operator
+// metrics definition, in place of the plain http listener of controller-runtime. Until the first sync issued
+// the certificate the handshakes fail.
+func addMetricsServer(mgr manager.Manager, namespace string) (*certwatcher.MetricsServer, error) {
+	k8sClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	watcher := certwatcher.New(k8sClient, certwatcher.Options{Namespace: namespace, SecretName: util.OperatorMetricsCertSecretName})
+	if err := mgr.Add(watcher); err != nil {
+		return nil, err
+	}
+	server := certwatcher.NewMetricsServer(fmt.Sprintf(":%d", util.OperatorMetricsPort), watcher, metrics.Registry)
+	if err := mgr.Add(server); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
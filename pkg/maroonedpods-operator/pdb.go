@@ -0,0 +1,54 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// reconcileServerPodDisruptionBudget creates the PodDisruptionBudget of the server while it has several
+// replicas and deletes it once it has a single one. A budget of the same name the CR doesn't control is left alone.
+func (r *ReconcileMaroonedPods) reconcileServerPodDisruptionBudget(mp *v1alpha1.MaroonedPods) error {
+	desired := mpnamespaced.CreateServerPodDisruptionBudget(&mpnamespaced.FactoryArgs{Namespace: r.namespace, ServerReplicas: mp.Spec.ServerReplicas})
+
+	current := &policyv1.PodDisruptionBudget{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: r.namespace, Name: mpnamespaced.ServerPodDisruptionBudgetName}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	switch {
+	case desired == nil && found:
+		if !metav1.IsControlledBy(current, mp) {
+			return nil
+		}
+		log.Info("Deleting the server PodDisruptionBudget, the server has a single replica")
+		if err := r.client.Delete(context.TODO(), current); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	case desired != nil && !found:
+		if err := controllerutil.SetControllerReference(mp, desired, r.scheme); err != nil {
+			return err
+		}
+		log.Info("Creating the server PodDisruptionBudget")
+		return r.client.Create(context.TODO(), desired)
+	case desired != nil && found:
+		if !metav1.IsControlledBy(current, mp) || equality.Semantic.DeepEqual(current.Spec, desired.Spec) {
+			return nil
+		}
+		updated := current.DeepCopy()
+		updated.Spec = desired.Spec
+		log.Info("Repairing the server PodDisruptionBudget")
+		return r.client.Update(context.TODO(), updated)
+	}
+	return nil
+}
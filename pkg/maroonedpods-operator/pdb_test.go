@@ -0,0 +1,153 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("server high availability tests", func() {
+	const namespace = "maroonedpods"
+
+	var (
+		crClient client.Client
+		r        *ReconcileMaroonedPods
+	)
+
+	newCR := func(replicas *int32) *v1alpha1.MaroonedPods {
+		return &v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods", UID: "cr-uid"},
+			Spec:       v1alpha1.MaroonedPodsSpec{ServerReplicas: replicas},
+		}
+	}
+
+	getBudget := func() (*policyv1.PodDisruptionBudget, error) {
+		pdb := &policyv1.PodDisruptionBudget{}
+		err := crClient.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: mpnamespaced.ServerPodDisruptionBudgetName}, pdb)
+		return pdb, err
+	}
+
+	serverDeployment := func(replicas *int32, placement *sdkapi.NodePlacement) *appsv1.Deployment {
+		resources, err := mpnamespaced.CreateResourceGroup("maroonedpodsServer", &mpnamespaced.FactoryArgs{
+			Namespace:          namespace,
+			ServerReplicas:     replicas,
+			InfraNodePlacement: placement,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok {
+				return deployment
+			}
+		}
+		Fail("no server deployment")
+		return nil
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).Build()
+		r = &ReconcileMaroonedPods{client: crClient, scheme: scheme, namespace: namespace}
+	})
+
+	It("should keep a server replica available with the default replicas", func() {
+		mp := newCR(nil)
+		Expect(r.reconcileServerPodDisruptionBudget(mp)).To(Succeed())
+
+		pdb, err := getBudget()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metav1.IsControlledBy(pdb, mp)).To(BeTrue())
+		Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(1))
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{util.MaroonedPodsLabel: util.MaroonedPodsServerResourceName}))
+		Expect(*serverDeployment(nil, nil).Spec.Replicas).To(Equal(mpnamespaced.DefaultServerReplicas))
+	})
+
+	It("should remove the PodDisruptionBudget when scaled back to a single replica", func() {
+		Expect(r.reconcileServerPodDisruptionBudget(newCR(pointer.Int32(3)))).To(Succeed())
+		_, err := getBudget()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(r.reconcileServerPodDisruptionBudget(newCR(pointer.Int32(1)))).To(Succeed())
+		_, err = getBudget()
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should repair an edited PodDisruptionBudget", func() {
+		mp := newCR(nil)
+		Expect(r.reconcileServerPodDisruptionBudget(mp)).To(Succeed())
+		pdb, err := getBudget()
+		Expect(err).ToNot(HaveOccurred())
+		pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+		Expect(crClient.Update(context.TODO(), pdb)).To(Succeed())
+
+		Expect(r.reconcileServerPodDisruptionBudget(mp)).To(Succeed())
+		pdb, err = getBudget()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{util.MaroonedPodsLabel: util.MaroonedPodsServerResourceName}))
+	})
+
+	It("should leave a PodDisruptionBudget it doesn't control alone", func() {
+		Expect(crClient.Create(context.TODO(), &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: mpnamespaced.ServerPodDisruptionBudgetName},
+		})).To(Succeed())
+
+		Expect(r.reconcileServerPodDisruptionBudget(newCR(pointer.Int32(1)))).To(Succeed())
+		_, err := getBudget()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should spread the replicas across the nodes", func() {
+		empty := &sdkapi.NodePlacement{}
+		deployment := serverDeployment(pointer.Int32(3), empty)
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+		terms := deployment.Spec.Template.Spec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		Expect(terms).To(HaveLen(1))
+		Expect(terms[0].PodAffinityTerm.TopologyKey).To(Equal("kubernetes.io/hostname"))
+
+		Expect(serverDeployment(pointer.Int32(1), empty).Spec.Template.Spec.Affinity).To(BeNil())
+	})
+
+	It("should keep the affinity of the placement", func() {
+		placement := &sdkapi.NodePlacement{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}}
+		Expect(serverDeployment(pointer.Int32(3), placement).Spec.Template.Spec.Affinity).To(Equal(placement.Affinity))
+	})
+
+	It("should consider the server ready only once every replica is", func() {
+		deployment := serverDeployment(pointer.Int32(3), nil)
+		deployment.Status = appsv1.DeploymentStatus{Replicas: 3, ReadyReplicas: 2, UpdatedReplicas: 3}
+		Expect(sdk.CheckDeploymentReady(deployment)).To(BeFalse())
+
+		deployment.Status.ReadyReplicas = 3
+		Expect(sdk.CheckDeploymentReady(deployment)).To(BeTrue())
+	})
+
+	It("should postpone the certificate rollout until every replica is updated", func() {
+		deployment := serverDeployment(pointer.Int32(3), nil)
+		deployment.Generation = 2
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 2}
+		Expect(isDeploymentRolling(deployment)).To(BeTrue())
+
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3}
+		Expect(isDeploymentRolling(deployment)).To(BeFalse())
+	})
+})
@@ -0,0 +1,127 @@
+package maroonedpods_operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("node placement tests", func() {
+	const namespace = "maroonedpods"
+
+	infra := sdkapi.NodePlacement{
+		NodeSelector: map[string]string{"node-role.kubernetes.io/infra": ""},
+		Tolerations: []corev1.Toleration{{
+			Key:      "node-role.kubernetes.io/infra",
+			Operator: corev1.TolerationOpExists,
+			Effect:   corev1.TaintEffectNoSchedule,
+		}},
+		Affinity: &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+					Weight: 1,
+					Preference: corev1.NodeSelectorTerm{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      "zone",
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"a"},
+						}},
+					},
+				}},
+			},
+		},
+	}
+	workloads := sdkapi.NodePlacement{
+		NodeSelector: map[string]string{"node-role.kubernetes.io/worker": ""},
+	}
+
+	newReconciler := func() *ReconcileMaroonedPods {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		return &ReconcileMaroonedPods{
+			client:          crfake.NewClientBuilder().WithScheme(s).Build(),
+			discoveryClient: &discoveryfake.FakeDiscovery{Fake: &testingclient.Fake{}},
+			scheme:          s,
+			namespace:       namespace,
+			namespacedArgs:  &mpnamespaced.FactoryArgs{Namespace: namespace, Verbosity: "1", PullPolicy: string(corev1.PullIfNotPresent)},
+		}
+	}
+
+	deploymentsFor := func(cr *mpv1.MaroonedPods) map[string]*appsv1.Deployment {
+		resources, err := mpnamespaced.CreateAllResources(newReconciler().getNamespacedArgs(cr))
+		Expect(err).ToNot(HaveOccurred())
+		deployments := map[string]*appsv1.Deployment{}
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok {
+				deployments[deployment.Name] = deployment
+			}
+		}
+		return deployments
+	}
+
+	It("should place the controller and the server on the infra nodes", func() {
+		deployments := deploymentsFor(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{Infra: infra, Workloads: workloads}})
+		Expect(deployments).To(HaveLen(2))
+
+		for _, name := range []string{util.ControllerResourceName, util.MaroonedPodsServerResourceName} {
+			Expect(deployments).To(HaveKey(name))
+			podSpec := deployments[name].Spec.Template.Spec
+			Expect(podSpec.NodeSelector).To(Equal(infra.NodeSelector), "deployment %s", name)
+			Expect(podSpec.Tolerations).To(Equal(infra.Tolerations), "deployment %s", name)
+			Expect(podSpec.Affinity).To(Equal(infra.Affinity), "deployment %s", name)
+		}
+	})
+
+	It("should leave the deployments unconstrained without a placement", func() {
+		deployments := deploymentsFor(&mpv1.MaroonedPods{})
+		for name, deployment := range deployments {
+			podSpec := deployment.Spec.Template.Spec
+			Expect(podSpec.NodeSelector).To(BeEmpty(), "deployment %s", name)
+			Expect(podSpec.Tolerations).To(BeEmpty(), "deployment %s", name)
+		}
+		Expect(deployments[util.ControllerResourceName].Spec.Template.Spec.Affinity).To(BeNil())
+		// only spread across the nodes
+		serverAffinity := deployments[util.MaroonedPodsServerResourceName].Spec.Template.Spec.Affinity
+		Expect(serverAffinity.NodeAffinity).To(BeNil())
+		Expect(serverAffinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(HaveLen(1))
+	})
+
+	It("should not alias the placement of the CR", func() {
+		cr := &mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{Infra: *infra.DeepCopy()}}
+		deployments := deploymentsFor(cr)
+
+		deployments[util.ControllerResourceName].Spec.Template.Spec.NodeSelector["edited"] = "true"
+		Expect(cr.Spec.Infra.NodeSelector).ToNot(HaveKey("edited"))
+	})
+
+	It("should patch the pod template of an existing deployment when the placement changes", func() {
+		desired := deploymentsFor(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{Infra: infra}})[util.ControllerResourceName]
+		Expect(sdk.SetLastAppliedConfiguration(desired, LastAppliedConfigAnnotation)).To(Succeed())
+		current := desired.DeepCopy()
+
+		updated := deploymentsFor(&mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{
+			Infra: sdkapi.NodePlacement{NodeSelector: map[string]string{"node-role.kubernetes.io/control-plane": ""}},
+		}})[util.ControllerResourceName]
+		Expect(sdk.SetLastAppliedConfiguration(updated, LastAppliedConfigAnnotation)).To(Succeed())
+
+		merged, err := sdk.MergeObject(updated, current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		podSpec := merged.(*appsv1.Deployment).Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(Equal(map[string]string{"node-role.kubernetes.io/control-plane": ""}))
+		Expect(podSpec.Tolerations).To(BeEmpty())
+		Expect(podSpec.Affinity).To(BeNil())
+	})
+})
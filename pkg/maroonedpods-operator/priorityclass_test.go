@@ -0,0 +1,127 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	testingclient "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mpnamespaced "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/namespaced"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("PriorityClass tests", func() {
+	const namespace = "maroonedpods"
+
+	newReconciler := func(objs ...client.Object) *ReconcileMaroonedPods {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(mpv1.AddToScheme(s)).To(Succeed())
+		return &ReconcileMaroonedPods{
+			client:          crfake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+			discoveryClient: &discoveryfake.FakeDiscovery{Fake: &testingclient.Fake{}},
+			scheme:          s,
+			recorder:        record.NewFakeRecorder(10),
+			namespace:       namespace,
+			namespacedArgs:  &mpnamespaced.FactoryArgs{Namespace: namespace},
+		}
+	}
+
+	newPriorityClass := func(name string) *schedulingv1.PriorityClass {
+		return &schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: name}, Value: 1000}
+	}
+
+	newCR := func(priorityClass string) *mpv1.MaroonedPods {
+		cr := &mpv1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+		if priorityClass != "" {
+			pc := mpv1.MaroonedPodsPriorityClass(priorityClass)
+			cr.Spec.PriorityClass = &pc
+		}
+		return cr
+	}
+
+	deployments := func(r *ReconcileMaroonedPods, cr *mpv1.MaroonedPods) []*appsv1.Deployment {
+		resources, err := mpnamespaced.CreateAllResources(r.getNamespacedArgs(cr))
+		Expect(err).ToNot(HaveOccurred())
+		var result []*appsv1.Deployment
+		for _, resource := range resources {
+			if deployment, ok := resource.(*appsv1.Deployment); ok {
+				result = append(result, deployment)
+			}
+		}
+		Expect(result).To(HaveLen(2))
+		return result
+	}
+
+	It("should propagate the PriorityClass of the CR to the components", func() {
+		r := newReconciler(newPriorityClass("infra-critical"))
+
+		for _, deployment := range deployments(r, newCR("infra-critical")) {
+			Expect(deployment.Spec.Template.Spec.PriorityClassName).To(Equal("infra-critical"), "deployment %s", deployment.Name)
+		}
+	})
+
+	It("should use the default PriorityClass only when it exists", func() {
+		for _, deployment := range deployments(newReconciler(), newCR("")) {
+			Expect(deployment.Spec.Template.Spec.PriorityClassName).To(BeEmpty())
+		}
+		for _, deployment := range deployments(newReconciler(newPriorityClass(util.MaroonedPodsPriorityClass)), newCR("")) {
+			Expect(deployment.Spec.Template.Spec.PriorityClassName).To(Equal(util.MaroonedPodsPriorityClass))
+		}
+	})
+
+	It("should roll the pod template when the PriorityClass changes", func() {
+		r := newReconciler(newPriorityClass("infra-critical"), newPriorityClass("infra-high"))
+		current := deployments(r, newCR("infra-critical"))[0]
+		Expect(sdk.SetLastAppliedConfiguration(current, LastAppliedConfigAnnotation)).To(Succeed())
+
+		var desired *appsv1.Deployment
+		for _, deployment := range deployments(r, newCR("infra-high")) {
+			if deployment.Name == current.Name {
+				desired = deployment
+			}
+		}
+		Expect(sdk.SetLastAppliedConfiguration(desired, LastAppliedConfigAnnotation)).To(Succeed())
+
+		merged, err := sdk.MergeObject(desired, current, LastAppliedConfigAnnotation)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(merged.(*appsv1.Deployment).Spec.Template.Spec.PriorityClassName).To(Equal("infra-high"))
+	})
+
+	// the sdk doesn't update the status when the resources can't be generated
+	persistedCondition := func(r *ReconcileMaroonedPods) *conditions.Condition {
+		cr := &mpv1.MaroonedPods{}
+		Expect(r.client.Get(context.TODO(), types.NamespacedName{Name: "maroonedpods"}, cr)).To(Succeed())
+		return conditions.FindStatusCondition(cr.Status.Conditions, conditions.ConditionDegraded)
+	}
+
+	It("should degrade the CR when its PriorityClass doesn't exist", func() {
+		cr := newCR("missing")
+		r := newReconciler(cr)
+
+		_, err := r.GetAllResources(cr)
+		Expect(err).To(MatchError(ContainSubstring("PriorityClass missing")))
+
+		condition := persistedCondition(r)
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("PriorityClassNotFound"))
+		Expect(condition.Message).To(ContainSubstring("does not exist"))
+	})
+})
@@ -0,0 +1,38 @@
+package maroonedpods_operator
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// the phases of the reconcile, a fixed set to keep the cardinality of the histogram bounded
+const (
+	phaseCertsFinalizer      = "certs_finalizer"
+	phaseNetworkPolicies     = "network_policies"
+	phasePodDisruptionBudget = "pod_disruption_budget"
+	phaseStaleResources      = "stale_resources"
+	// the sdk reconcile of the resources, it includes the certificate sync
+	phaseResources = "resources"
+	phaseStatus    = "status"
+)
+
+var reconcilePhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "maroonedpods_operator_reconcile_phase_duration_seconds",
+	Help:    "Duration of the phases of the reconcile of the MaroonedPods CR, failed or not",
+	Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+}, []string{"phase"})
+
+func init() {
+	metrics.Registry.MustRegister(reconcilePhaseDuration)
+}
+
+// observePhase runs a phase of the reconcile and observes its duration
+func observePhase(phase string, run func() error) error {
+	start := time.Now()
+	defer func() {
+		reconcilePhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	}()
+	return run()
+}
@@ -0,0 +1,76 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	crclient "sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("reconcile metrics tests", func() {
+	const namespace = "maroonedpods"
+
+	histogramCount := func(observer prometheus.Observer) uint64 {
+		var m dto.Metric
+		ExpectWithOffset(1, observer.(prometheus.Metric).Write(&m)).To(Succeed())
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	It("should observe the phases of the operator resources", func() {
+		mp := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		r := &ReconcileMaroonedPods{
+			client:    crfake.NewClientBuilder().WithScheme(scheme).WithObjects(mp).Build(),
+			scheme:    scheme,
+			recorder:  record.NewFakeRecorder(10),
+			namespace: namespace,
+		}
+		Expect(r.client.Get(context.TODO(), crclient.ObjectKeyFromObject(mp), mp)).To(Succeed())
+
+		phases := []string{phaseCertsFinalizer, phaseNetworkPolicies, phasePodDisruptionBudget, phaseStaleResources}
+		before := map[string]uint64{}
+		for _, phase := range phases {
+			before[phase] = histogramCount(reconcilePhaseDuration.WithLabelValues(phase))
+		}
+
+		Expect(r.reconcileOperatorResources(mp, log)).To(Succeed())
+
+		for _, phase := range phases {
+			Expect(histogramCount(reconcilePhaseDuration.WithLabelValues(phase))).To(Equal(before[phase]+1), "phase %s", phase)
+		}
+	})
+
+	It("should observe a failed phase and stop the reconcile there", func() {
+		mp := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		// the CR isn't there, adding the finalizer fails
+		r := &ReconcileMaroonedPods{
+			client:    crfake.NewClientBuilder().WithScheme(scheme).Build(),
+			scheme:    scheme,
+			namespace: namespace,
+		}
+
+		finalizer := histogramCount(reconcilePhaseDuration.WithLabelValues(phaseCertsFinalizer))
+		policies := histogramCount(reconcilePhaseDuration.WithLabelValues(phaseNetworkPolicies))
+
+		Expect(r.reconcileOperatorResources(mp, log)).ToNot(Succeed())
+
+		Expect(histogramCount(reconcilePhaseDuration.WithLabelValues(phaseCertsFinalizer))).To(Equal(finalizer + 1))
+		Expect(histogramCount(reconcilePhaseDuration.WithLabelValues(phaseNetworkPolicies))).To(Equal(policies))
+	})
+})
@@ -1,8 +1,11 @@
-package maroonpods_operator
+package maroonedpods_operator
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
+	"maroonedpods.io/maroonedpods/pkg/certmanager"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	"time"
 
@@ -10,14 +13,30 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/go-logr/logr"
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	// conditionCertRotationDegraded is true while a provided certificate fails its validation
+	conditionCertRotationDegraded conditions.ConditionType = "CertRotationDegraded"
+	// conditionCertificatesDegraded is true while the certificates can't be synced, with the reason of the last failure
+	conditionCertificatesDegraded conditions.ConditionType = "CertificatesDegraded"
+	// conditionCertCanaryDegraded is true while the signing canary fails
+	conditionCertCanaryDegraded conditions.ConditionType = "CertCanaryDegraded"
+)
+
 // watch registers MaroonedPods-specific watches
 func (r *ReconcileMaroonedPods) watch() error {
-	if err := r.reconciler.WatchResourceTypes(&corev1.ConfigMap{}, &corev1.Secret{}); err != nil {
+	// the NetworkPolicies and the PodDisruptionBudget aren't resources of the sdk, edits are repaired on the reconcile they trigger.
+	// The webhook configurations may be deferred when the sdk registers the watches of its resources.
+	if err := r.reconciler.WatchResourceTypes(&corev1.ConfigMap{}, &corev1.Secret{}, &networkingv1.NetworkPolicy{}, &policyv1.PodDisruptionBudget{},
+		&admissionregistrationv1.MutatingWebhookConfiguration{}, &admissionregistrationv1.ValidatingWebhookConfiguration{}); err != nil {
 		return err
 	}
 
@@ -25,6 +44,18 @@ func (r *ReconcileMaroonedPods) watch() error {
 		return err
 	}
 
+	if err := r.watchKubeRootCA(); err != nil {
+		return err
+	}
+
+	if err := r.watchProxyTrust(); err != nil {
+		return err
+	}
+
+	if err := r.watchExternalCerts(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -67,7 +98,190 @@ func (r *ReconcileMaroonedPods) sync(cr client.Object, logger logr.Logger) error
 	if mp.DeletionTimestamp != nil {
 		return nil
 	}
-	return r.certManager.Sync(r.getCertificateDefinitions(mp))
+	certs, err := r.getCertificateDefinitions(mp)
+	if err != nil {
+		r.markCertsDegraded(mp, "InvalidCertConfig", err, logger)
+		return err
+	}
+	serviceCA, modeErr := useServiceCA(r.client.RESTMapper(), mp.Spec.CertManagement == v1alpha1.CertManagementServiceCA)
+	if modeErr != nil && modeErr != errServiceCAUnavailable {
+		return modeErr
+	}
+	managed, err := syncCertManagementMode(r.client, certs, serviceCA, logger)
+	if err != nil {
+		return err
+	}
+	err = r.certManager.Sync(context.TODO(), managed)
+	// the conditions are kept, the reconcile is requeued shortly
+	if certManagerNotReady(err) {
+		return err
+	}
+	if conditionErr := r.updateCertRotationDegraded(mp, managed, err); conditionErr != nil {
+		logger.Error(conditionErr, "Failed to update the CertRotationDegraded condition")
+	}
+	if err != nil {
+		// the operator is shutting down or lost the leadership, the next sync completes the certificates
+		if goerrors.Is(err, context.Canceled) {
+			logger.Info("The certificate sync was aborted", "reason", err.Error())
+			return err
+		}
+		if reason, cause := certsDegradedReason(err); reason != "" {
+			r.markCertsDegraded(mp, reason, cause, logger)
+		}
+		var stuckErr *certmanager.CertRotationStuckError
+		if goerrors.As(err, &stuckErr) {
+			r.recorder.Event(mp, corev1.EventTypeWarning, "CertRotationStuck", stuckErr.Error())
+		}
+		return err
+	}
+	if err := r.forceCertRotation(mp, managed, logger); err != nil {
+		return err
+	}
+	if err := r.certManager.PruneOrphans(certs, preserveCertsOnUninstall(mp)); err != nil {
+		return err
+	}
+	if rolloutOnRotationEnabled(mp) {
+		if err := rolloutOnCertRotation(r.client, certs, logger); err != nil {
+			return err
+		}
+	}
+	r.runCertCanary(mp, managed, logger)
+	if modeErr != nil {
+		r.markCertsDegraded(mp, "ServiceCAUnavailable", modeErr, logger)
+		return modeErr
+	}
+	r.clearCertsDegraded(mp, logger)
+	return nil
+}
+
+// certsDegradedReason returns the reason of the CertificatesDegraded condition of a failed sync and the
+// error of its message, an empty reason when the failure doesn't degrade the certificates
+func certsDegradedReason(err error) (string, error) {
+	var unavailableErr *certmanager.CertManagerUnavailableError
+	var externalErr *certmanager.ExternalCertificateError
+	switch {
+	case goerrors.Is(err, certmanager.ErrWebhookCertMismatch):
+		return "WebhookCertificateMismatch", err
+	case goerrors.Is(err, certmanager.ErrPreflightFailed):
+		return "MissingPermissions", err
+	case goerrors.Is(err, certmanager.ErrFIPSNonCompliant):
+		return "FIPSNonCompliant", err
+	case goerrors.Is(err, mpcerts.ErrInvalidDefinition):
+		return "InvalidCertificateDefinition", err
+	case goerrors.As(err, &externalErr):
+		return "ExternalCertificateInvalid", externalErr
+	case goerrors.As(err, &unavailableErr):
+		return "CertManagerUnavailable", err
+	}
+	return "", err
+}
+
+// certManagerNotReady tells whether the sync failed because the cert manager didn't sync its caches yet
+func certManagerNotReady(err error) bool {
+	return goerrors.Is(err, certmanager.ErrNotStarted) || goerrors.Is(err, certmanager.ErrNamespaceNotSynced)
+}
+
+// runCertCanary runs the signing canary if it is enabled. A failed canary degrades the CR but doesn't
+// fail the reconcile, the certificates are in place and the cert manager already emitted an event.
+// The condition is removed when the canary is disabled.
+func (r *ReconcileMaroonedPods) runCertCanary(mp *v1alpha1.MaroonedPods, certs []mpcerts.CertificateDefinition, logger logr.Logger) {
+	if mp.Spec.CertConfig == nil || mp.Spec.CertConfig.CanaryInterval == nil || mp.Spec.CertConfig.CanaryInterval.Duration <= 0 {
+		if conditions.FindStatusCondition(mp.Status.Conditions, conditionCertCanaryDegraded) == nil {
+			return
+		}
+		conditions.RemoveStatusCondition(&mp.Status.Conditions, conditionCertCanaryDegraded)
+		if err := r.client.Status().Update(context.TODO(), mp); err != nil {
+			logger.Error(err, "Failed to remove the condition", "condition", conditionCertCanaryDegraded)
+		}
+		return
+	}
+	if err := r.certManager.RunCanary(certs, mp.Spec.CertConfig.CanaryInterval.Duration); err != nil {
+		logger.Info("The certificate canary failed", "reason", err.Error())
+		r.saveCondition(mp, conditionCertCanaryDegraded, corev1.ConditionTrue, "CertCanaryFailed", err.Error(), logger)
+		return
+	}
+	if conditions.FindStatusCondition(mp.Status.Conditions, conditionCertCanaryDegraded) != nil {
+		r.saveCondition(mp, conditionCertCanaryDegraded, corev1.ConditionFalse, "CertCanaryPassed", "The signers can issue certificates", logger)
+	}
+}
+
+// updateCertRotationDegraded flips the CertRotationDegraded condition on the validation of the provided
+// certificates by the sync and persists a change right away, the sdk doesn't update the status of a failed
+// reconcile. The condition is removed when no certificate is provided.
+func (r *ReconcileMaroonedPods) updateCertRotationDegraded(mp *v1alpha1.MaroonedPods, certs []mpcerts.CertificateDefinition, syncErr error) error {
+	external := false
+	for _, cd := range certs {
+		external = external || cd.External
+	}
+
+	current := conditions.FindStatusCondition(mp.Status.Conditions, conditionCertRotationDegraded)
+	var externalErr *certmanager.ExternalCertificateError
+	switch {
+	case !external:
+		if current == nil {
+			return nil
+		}
+		conditions.RemoveStatusCondition(&mp.Status.Conditions, conditionCertRotationDegraded)
+	case goerrors.As(syncErr, &externalErr):
+		if !setConditionChanged(mp, conditionCertRotationDegraded, corev1.ConditionTrue, "ExternalCertificateInvalid", externalErr.Error()) {
+			return nil
+		}
+	// the sync didn't get to validate the certificates
+	case syncErr != nil:
+		return nil
+	default:
+		if !setConditionChanged(mp, conditionCertRotationDegraded, corev1.ConditionFalse, "ExternalCertificatesValid", "The provided certificates are valid") {
+			return nil
+		}
+	}
+	return r.client.Status().Update(context.TODO(), mp)
+}
+
+// setConditionChanged sets the condition and returns whether its status, reason or message changed
+func setConditionChanged(mp *v1alpha1.MaroonedPods, conditionType conditions.ConditionType, status corev1.ConditionStatus, reason, message string) bool {
+	current := conditions.FindStatusCondition(mp.Status.Conditions, conditionType)
+	if current != nil && current.Status == status && current.Reason == reason && current.Message == message {
+		return false
+	}
+	conditions.SetStatusCondition(&mp.Status.Conditions, conditions.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	return true
+}
+
+// markCertsDegraded sets the CertificatesDegraded condition and persists it right away, the sdk doesn't
+// update the status of a failed reconcile. It is kept until the certificates can be synced.
+func (r *ReconcileMaroonedPods) markCertsDegraded(mp *v1alpha1.MaroonedPods, reason string, err error, logger logr.Logger) {
+	r.recorder.Event(mp, corev1.EventTypeWarning, reason, err.Error())
+	r.saveCondition(mp, conditionCertificatesDegraded, corev1.ConditionTrue, reason, err.Error(), logger)
+}
+
+// clearCertsDegraded flips the CertificatesDegraded condition back once the certificates are synced
+func (r *ReconcileMaroonedPods) clearCertsDegraded(mp *v1alpha1.MaroonedPods, logger logr.Logger) {
+	if !conditions.IsStatusConditionTrue(mp.Status.Conditions, conditionCertificatesDegraded) {
+		return
+	}
+	r.saveCondition(mp, conditionCertificatesDegraded, corev1.ConditionFalse, "CertificatesSynced", "The certificates are synced", logger)
+}
+
+// saveCondition sets the condition and updates the status if it changed
+func (r *ReconcileMaroonedPods) saveCondition(mp *v1alpha1.MaroonedPods, conditionType conditions.ConditionType, status corev1.ConditionStatus, reason, message string, logger logr.Logger) {
+	if !setConditionChanged(mp, conditionType, status, reason, message) {
+		return
+	}
+	if err := r.client.Status().Update(context.TODO(), mp); err != nil {
+		logger.Error(err, "Failed to update the condition", "condition", conditionType)
+	}
+}
+
+func rolloutOnRotationEnabled(mp *v1alpha1.MaroonedPods) bool {
+	if mp.Spec.CertConfig == nil || mp.Spec.CertConfig.RolloutOnRotation == nil {
+		return true
+	}
+	return *mp.Spec.CertConfig.RolloutOnRotation
 }
 
 func (r *ReconcileMaroonedPods) configMapOwnerDeleted(cm *corev1.ConfigMap) (bool, error) {
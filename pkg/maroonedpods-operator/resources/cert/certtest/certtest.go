@@ -0,0 +1,263 @@
+// Package certtest fabricates, expires and corrupts the certificates of the cert manager in a cluster,
+// for the tests of the rotation paths. The objects are written in the layout the cert manager writes them.
+package certtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/openshift/library-go/pkg/crypto"
+	"github.com/openshift/library-go/pkg/operator/certrotation"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// NewCA returns a self-signed CA valid from notBefore to notAfter, which can be in the past
+func NewCA(commonName string, notBefore, notAfter time.Time) (*crypto.CA, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	config, err := newCert(template, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &crypto.CA{Config: config, SerialGenerator: &crypto.RandomSerialGenerator{}}, nil
+}
+
+// NewServingCert returns a serving certificate of the hostnames issued by the CA, valid from notBefore
+// to notAfter, which can be outside of the validity of the CA
+func NewServingCert(ca *crypto.CA, hostnames []string, notBefore, notAfter time.Time) (*crypto.TLSCertificateConfig, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: hostnames[0]},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
+	}
+	return newCert(template, ca)
+}
+
+// newCert signs the template with a new key by the CA, self-signed if it is nil
+func newCert(template *x509.Certificate, ca *crypto.CA) (*crypto.TLSCertificateConfig, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, err
+	}
+
+	parent, parentKey := template, interface{}(key)
+	if ca != nil {
+		parent, parentKey = ca.Config.Certs[0], ca.Config.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &crypto.TLSCertificateConfig{Certs: []*x509.Certificate{cert}, Key: key}, nil
+}
+
+// WriteSigner writes the CA into the signer secret of the definition, the next sync uses it as is
+// unless it is due for rotation
+func WriteSigner(ctx context.Context, client kubernetes.Interface, cd mpcerts.CertificateDefinition, ca *crypto.CA) (*corev1.Secret, error) {
+	if cd.SignerSecret == nil {
+		return nil, fmt.Errorf("the definition has no signer secret")
+	}
+	return writeKeyPair(ctx, client, cd.SignerSecret, ca.Config, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+}
+
+// WriteTarget writes the certificate into the target secret of the definition, also under the
+// CertKeyName and KeyKeyName of the definition
+func WriteTarget(ctx context.Context, client kubernetes.Interface, cd mpcerts.CertificateDefinition, cert *crypto.TLSCertificateConfig) (*corev1.Secret, error) {
+	if cd.TargetSecret == nil {
+		return nil, fmt.Errorf("the definition has no target secret")
+	}
+	certKey, keyKey := cd.TargetFiles()
+	return writeKeyPair(ctx, client, cd.TargetSecret, cert, certKey, keyKey)
+}
+
+// WriteProvided writes the certificate and the CA into the target secret of the definition as a user
+// providing external certificates does, without the annotations of the cert manager
+func WriteProvided(ctx context.Context, client kubernetes.Interface, cd mpcerts.CertificateDefinition, cert *crypto.TLSCertificateConfig, ca *crypto.CA) (*corev1.Secret, error) {
+	if cd.TargetSecret == nil {
+		return nil, fmt.Errorf("the definition has no target secret")
+	}
+	certPEM, keyPEM, err := cert.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := crypto.EncodeCertificates(ca.Config.Certs...)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: cd.TargetSecret.Namespace, Name: cd.TargetSecret.Name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+			"ca.crt":                caPEM,
+		},
+	}
+	secrets := client.CoreV1().Secrets(secret.Namespace)
+	current, err := secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return secrets.Create(ctx, secret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	current.Data = secret.Data
+	return secrets.Update(ctx, current, metav1.UpdateOptions{})
+}
+
+// WriteBundle replaces the CA bundle of the definition with the CAs
+func WriteBundle(ctx context.Context, client kubernetes.Interface, cd mpcerts.CertificateDefinition, cas ...*crypto.CA) (*corev1.ConfigMap, error) {
+	if cd.CertBundleConfigmap == nil {
+		return nil, fmt.Errorf("the definition has no bundle configmap")
+	}
+	var certs []*x509.Certificate
+	for _, ca := range cas {
+		certs = append(certs, ca.Config.Certs...)
+	}
+	bundle, err := crypto.EncodeCertificates(certs...)
+	if err != nil {
+		return nil, err
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(cd.CertBundleConfigmap.Namespace)
+	configMap, err := configMaps.Get(ctx, cd.CertBundleConfigmap.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = cd.CertBundleConfigmap.DeepCopy()
+		configMap.Data = map[string]string{mpcerts.CABundleKey: string(bundle)}
+		return configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[mpcerts.CABundleKey] = string(bundle)
+	return configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+}
+
+// writeKeyPair writes the key pair and its validity and issuer annotations into the secret of the
+// template, the other data and annotations of an existing secret are kept
+func writeKeyPair(ctx context.Context, client kubernetes.Interface, template *corev1.Secret, config *crypto.TLSCertificateConfig, certKey, keyKey string) (*corev1.Secret, error) {
+	certPEM, keyPEM, err := config.GetPEMBytes()
+	if err != nil {
+		return nil, err
+	}
+	setKeyPair := func(secret *corev1.Secret) {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		for _, key := range []string{corev1.TLSCertKey, certKey} {
+			secret.Data[key] = certPEM
+		}
+		for _, key := range []string{corev1.TLSPrivateKeyKey, keyKey} {
+			secret.Data[key] = keyPEM
+		}
+		cert := config.Certs[0]
+		secret.Annotations[certrotation.CertificateNotBeforeAnnotation] = cert.NotBefore.Format(time.RFC3339)
+		secret.Annotations[certrotation.CertificateNotAfterAnnotation] = cert.NotAfter.Format(time.RFC3339)
+		secret.Annotations[certrotation.CertificateIssuer] = cert.Issuer.CommonName
+	}
+
+	secrets := client.CoreV1().Secrets(template.Namespace)
+	secret, err := secrets.Get(ctx, template.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		secret = template.DeepCopy()
+		secret.Type = corev1.SecretTypeTLS
+		setKeyPair(secret)
+		return secrets.Create(ctx, secret, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	setKeyPair(secret)
+	return secrets.Update(ctx, secret, metav1.UpdateOptions{})
+}
+
+// CorruptKey truncates the key of the secret, it doesn't parse anymore and the cert manager reports
+// the secret as corrupted
+func CorruptKey(ctx context.Context, client kubernetes.Interface, secret types.NamespacedName) (*corev1.Secret, error) {
+	return updateSecret(ctx, client, secret, func(secret *corev1.Secret) error {
+		key := secret.Data[corev1.TLSPrivateKeyKey]
+		if len(key) == 0 {
+			return fmt.Errorf("secret %s/%s has no key", secret.Namespace, secret.Name)
+		}
+		secret.Data[corev1.TLSPrivateKeyKey] = key[:len(key)/2]
+		return nil
+	})
+}
+
+// SetValidity rewrites the validity annotations of the secret the rotation is decided on, the
+// certificate is left as it is
+func SetValidity(ctx context.Context, client kubernetes.Interface, secret types.NamespacedName, notBefore, notAfter time.Time) (*corev1.Secret, error) {
+	return updateSecret(ctx, client, secret, func(secret *corev1.Secret) error {
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[certrotation.CertificateNotBeforeAnnotation] = notBefore.UTC().Format(time.RFC3339)
+		secret.Annotations[certrotation.CertificateNotAfterAnnotation] = notAfter.UTC().Format(time.RFC3339)
+		return nil
+	})
+}
+
+// IntoRefreshWindow rewrites the validity annotations of the secret as if its certificate of the
+// config was issued a minute over its refresh ago. The next sync rotates a signer, a target is only
+// rotated once its signer is valid for 10% of the target refresh, see WriteSigner for an older one.
+func IntoRefreshWindow(ctx context.Context, client kubernetes.Interface, secret types.NamespacedName, config mpcerts.CertificateConfig) (*corev1.Secret, error) {
+	notBefore := time.Now().Add(-config.Refresh - time.Minute)
+	return SetValidity(ctx, client, secret, notBefore, notBefore.Add(config.Lifetime))
+}
+
+func updateSecret(ctx context.Context, client kubernetes.Interface, name types.NamespacedName, mutate func(*corev1.Secret) error) (*corev1.Secret, error) {
+	secrets := client.CoreV1().Secrets(name.Namespace)
+	secret, err := secrets.Get(ctx, name.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err := mutate(secret); err != nil {
+		return nil, err
+	}
+	return secrets.Update(ctx, secret, metav1.UpdateOptions{})
+}
@@ -0,0 +1,212 @@
+package cert
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// ParseCertDuration returns a duration of the certConfig of the CR, nil if it isn't set
+func ParseCertDuration(field string, d *metav1.Duration) (*time.Duration, error) {
+	if d == nil {
+		return nil, nil
+	}
+	if d.Duration <= 0 {
+		return nil, fmt.Errorf("invalid certConfig.%s: %q is not positive", field, FormatDuration(d.Duration))
+	}
+	parsed := d.Duration
+	return &parsed, nil
+}
+
+// parseRenewBeforePercent returns the refresh percentage of the renewBeforePercent of the CertConfig,
+// nil if it isn't set
+func parseRenewBeforePercent(field string, config *v1alpha1.CertConfig) (*int, error) {
+	if config.RenewBeforePercent == nil {
+		return nil, nil
+	}
+	if config.RenewBefore != nil {
+		return nil, fmt.Errorf("invalid certConfig.%s: renewBefore and renewBeforePercent are mutually exclusive", field)
+	}
+	percent := int(*config.RenewBeforePercent)
+	if percent < 1 || percent > 99 {
+		return nil, fmt.Errorf("invalid certConfig.%s.renewBeforePercent: %d is not between 1 and 99", field, percent)
+	}
+	refreshPercent := 100 - percent
+	return &refreshPercent, nil
+}
+
+// parseBackdate parses a backdate of the certConfig of the CR, nil if it isn't set
+func parseBackdate(field string, d *metav1.Duration) (*time.Duration, error) {
+	backdate, err := ParseCertDuration(field, d)
+	if err != nil || backdate == nil {
+		return backdate, err
+	}
+	if *backdate > MaxBackdate {
+		return nil, fmt.Errorf("invalid certConfig.%s: %q is longer than %s", field, FormatDuration(*backdate), FormatDuration(MaxBackdate))
+	}
+	return backdate, nil
+}
+
+// ArgsFromCertConfig returns the factory args of the certConfig of the CR
+func ArgsFromCertConfig(namespace string, config *v1alpha1.MaroonedPodsCertConfig) (*FactoryArgs, error) {
+	args := &FactoryArgs{Namespace: namespace}
+	if config == nil {
+		return args, nil
+	}
+
+	var err error
+	if config.CA != nil {
+		if args.SignerDuration, err = ParseCertDuration("ca.duration", config.CA.Duration); err != nil {
+			return nil, err
+		}
+		if args.SignerRenewBefore, err = ParseCertDuration("ca.renewBefore", config.CA.RenewBefore); err != nil {
+			return nil, err
+		}
+		if args.SignerRefreshPercent, err = parseRenewBeforePercent("ca", config.CA); err != nil {
+			return nil, err
+		}
+		if args.SignerBackdate, err = parseBackdate("ca.backdate", config.CA.Backdate); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Server != nil {
+		if args.TargetDuration, err = ParseCertDuration("server.duration", config.Server.Duration); err != nil {
+			return nil, err
+		}
+		if args.TargetRenewBefore, err = ParseCertDuration("server.renewBefore", config.Server.RenewBefore); err != nil {
+			return nil, err
+		}
+		if args.TargetRefreshPercent, err = parseRenewBeforePercent("server", config.Server); err != nil {
+			return nil, err
+		}
+		if args.TargetBackdate, err = parseBackdate("server.backdate", config.Server.Backdate); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.TargetOverrides, err = parseTargetOverrides(config); err != nil {
+		return nil, err
+	}
+
+	args.BundleReplicaNamespaces = config.BundleReplicaNamespaces
+	args.BundleReplicaNamespaceSelector = config.BundleReplicaNamespaceSelector
+	args.IncludeKubeRootCA = config.IncludeKubeRootCA
+	if config.ProxyTrust != nil {
+		args.ProxyTrust = &ProxyTrust{ConfigMapName: config.ProxyTrust.ConfigMapName}
+	}
+
+	if issuer := config.Issuer; issuer != nil {
+		args.Issuer = &IssuerReference{
+			Name:  issuer.Name,
+			Kind:  issuer.Kind,
+			Group: issuer.Group,
+		}
+	}
+	return args, nil
+}
+
+// parseTargetOverrides parses the targetOverrides of the certConfig, each merged with the server configuration
+func parseTargetOverrides(config *v1alpha1.MaroonedPodsCertConfig) (map[v1alpha1.CertTarget]TargetOverride, error) {
+	if len(config.TargetOverrides) == 0 {
+		return nil, nil
+	}
+	targets := make([]string, 0, len(config.TargetOverrides))
+	for target := range config.TargetOverrides {
+		targets = append(targets, string(target))
+	}
+	// the first invalid target is reported, in a stable order
+	sort.Strings(targets)
+
+	overrides := make(map[v1alpha1.CertTarget]TargetOverride, len(targets))
+	for _, t := range targets {
+		target := v1alpha1.CertTarget(t)
+		field := "targetOverrides." + t
+		switch target {
+		case v1alpha1.CertTargetServer, v1alpha1.CertTargetControllerClient, v1alpha1.CertTargetMetrics:
+		default:
+			return nil, fmt.Errorf("invalid certConfig.%s: unknown target, expected %s, %s or %s", field,
+				v1alpha1.CertTargetServer, v1alpha1.CertTargetControllerClient, v1alpha1.CertTargetMetrics)
+		}
+		merged := mergeCertConfig(config.Server, config.TargetOverrides[target])
+
+		var override TargetOverride
+		var err error
+		if override.Duration, err = ParseCertDuration(field+".duration", merged.Duration); err != nil {
+			return nil, err
+		}
+		if override.RenewBefore, err = ParseCertDuration(field+".renewBefore", merged.RenewBefore); err != nil {
+			return nil, err
+		}
+		if override.RefreshPercent, err = parseRenewBeforePercent(field, merged); err != nil {
+			return nil, err
+		}
+		if override.Backdate, err = parseBackdate(field+".backdate", merged.Backdate); err != nil {
+			return nil, err
+		}
+		if override.Duration != nil && override.RenewBefore != nil && *override.RenewBefore >= *override.Duration {
+			return nil, fmt.Errorf("invalid certConfig.%s: renewBefore has to be shorter than the duration (%s)", field, FormatDuration(*override.Duration))
+		}
+		overrides[target] = override
+	}
+	return overrides, nil
+}
+
+// mergeCertConfig returns the server configuration with the fields the override sets replaced,
+// renewBefore and renewBeforePercent are replaced together as they are exclusive
+func mergeCertConfig(server *v1alpha1.CertConfig, override v1alpha1.CertConfig) *v1alpha1.CertConfig {
+	merged := &v1alpha1.CertConfig{}
+	if server != nil {
+		*merged = *server
+	}
+	if override.Duration != nil {
+		merged.Duration = override.Duration
+	}
+	if override.RenewBefore != nil || override.RenewBeforePercent != nil {
+		merged.RenewBefore = override.RenewBefore
+		merged.RenewBeforePercent = override.RenewBeforePercent
+	}
+	if override.Backdate != nil {
+		merged.Backdate = override.Backdate
+	}
+	return merged
+}
+
+// DefinitionsFromCertConfig creates the certificate definitions the operator issues for the certConfig of
+// the CR, the validating webhook of the CR uses it, what the webhook admits the operator can issue
+func DefinitionsFromCertConfig(namespace string, config *v1alpha1.MaroonedPodsCertConfig) ([]CertificateDefinition, error) {
+	return NewDefinitionFactory(namespace, WithCertConfig(config), WithControllerClientCert(), WithMetricsCerts())
+}
+
+// validateConfigurable checks the lifetimes the certConfig resulted in, the renewBefore is subtracted
+// from the duration, possibly the default one
+func validateConfigurable(cd *CertificateDefinition, args *FactoryArgs) error {
+	// the overrides also apply to the definitions that aren't configurable otherwise
+	if target := certTargetOf(cd); target != "" {
+		if _, ok := args.TargetOverrides[target]; ok {
+			config := cd.TargetConfig
+			if config.Refresh <= 0 {
+				return fmt.Errorf("invalid certConfig.targetOverrides.%s: renewBefore has to be shorter than the duration (%s)", target, FormatDuration(config.Lifetime))
+			}
+			// a duration shorter than the default refresh would let the certificate expire
+			if config.Refresh >= config.Lifetime {
+				return fmt.Errorf("invalid certConfig.targetOverrides.%s: the duration %s doesn't leave time to renew after %s, set renewBefore", target, FormatDuration(config.Lifetime), FormatDuration(config.Refresh))
+			}
+		}
+	}
+	if !cd.Configurable {
+		return nil
+	}
+	// the CA configuration is ignored with an issuer
+	if cd.SignerSecret != nil && cd.Issuer == nil && cd.SignerConfig.Refresh <= 0 {
+		return fmt.Errorf("invalid certConfig.ca: renewBefore has to be shorter than the duration (%s)", FormatDuration(cd.SignerConfig.Lifetime))
+	}
+	if cd.TargetSecret != nil && cd.TargetConfig.Refresh <= 0 {
+		return fmt.Errorf("invalid certConfig.server: renewBefore has to be shorter than the duration (%s)", FormatDuration(cd.TargetConfig.Lifetime))
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package cert
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// The well-known names of the standard definitions, renaming one orphans the objects of existing installs
+const (
+	// ServerSignerSecretName is the secret of the CA signing the server and controller client certificates
+	ServerSignerSecretName = "maroonedpods-server"
+	// CABundleConfigMapName is the configmap the CA bundle is published in
+	CABundleConfigMapName = util.SignerBundleResourceName
+	// ServerCertSecretName is the secret of the serving certificate of the server
+	ServerCertSecretName = util.SecretResourceName
+	// ServerServiceName is the service the serving certificate is issued for
+	ServerServiceName = cluster.MaroonedPodsServerServiceName
+	// ControllerClientCertSecretName is the secret of the client certificate of the controller
+	ControllerClientCertSecretName = "maroonedpods-controller-client-cert"
+	// ControllerClientUserName is the common name of the client certificate of the controller
+	ControllerClientUserName = util.ControllerResourceName
+	// MetricsSignerSecretName is the secret of the CA signing the serving certificates of the metrics listeners
+	MetricsSignerSecretName = "maroonedpods-metrics-signer"
+	// MetricsCABundleConfigMapName is the configmap the ServiceMonitor reads the CA of the metrics listeners from
+	MetricsCABundleConfigMapName = "maroonedpods-metrics-signer-bundle"
+	// OperatorMetricsCertSecretName is the secret of the serving certificate of the metrics of the operator
+	OperatorMetricsCertSecretName = util.OperatorMetricsCertSecretName
+	// ControllerMetricsCertSecretName is the secret of the serving certificate of the metrics of the controller
+	ControllerMetricsCertSecretName = util.ControllerMetricsCertSecretName
+	// TrustBundleConfigMapName is the configmap combining the CA bundle with the CAs of the cluster-wide proxy
+	TrustBundleConfigMapName = "maroonedpods-trust-bundle"
+	// ProxyTrustedCAConfigMapName is the configmap OpenShift injects the CAs of the cluster-wide proxy into
+	ProxyTrustedCAConfigMapName = "maroonedpods-trusted-ca-bundle"
+)
+
+// CertConfigAnnotation records on the signer and target secrets the configuration their certificate was
+// issued with, a change re-issues the certificate
+const CertConfigAnnotation = "operator.maroonedpods.io/certConfig"
+
+// AllowUnmanageAnnotation set to "true" on a managed secret lets users remove its managed-by label or its
+// CertConfigAnnotation, the webhook of the server denies it otherwise
+const AllowUnmanageAnnotation = "operator.maroonedpods.io/allow-unmanage"
+
+// InjectTrustedCABundleLabel requests the injection of the OpenShift trusted CA bundle into a configmap
+const InjectTrustedCABundleLabel = "config.openshift.io/inject-trusted-cabundle"
+
+// TrustBundleDir is where the deployments mount the trust bundle, the Go clients load it through SSL_CERT_DIR
+const TrustBundleDir = "/etc/maroonedpods/trust"
+
+const trustBundleVolumeName = "trust-bundle"
+
+// MetricsCertDir is where the deployments mount the target secrets of the metrics certificates
+const MetricsCertDir = "/etc/metrics/tls"
+
+const metricsCertVolumeName = "metrics-cert"
+
+// MetricsCertVolume returns the volume of the target secret of a metrics certificate and its mount. The
+// secret is optional, the operator issues it once the pods run and they load it from the API anyway.
+func MetricsCertVolume(secretName string) (corev1.Volume, corev1.VolumeMount) {
+	defaultMode := corev1.SecretVolumeSourceDefaultMode
+	volume := corev1.Volume{
+		Name: metricsCertVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretName,
+				DefaultMode: &defaultMode,
+				Optional:    &[]bool{true}[0],
+			},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      metricsCertVolumeName,
+		MountPath: MetricsCertDir,
+		ReadOnly:  true,
+	}
+	return volume, mount
+}
+
+// TrustBundleVolume returns the volume of the trust bundle, its mount and the environment pointing the
+// TLS clients of the container to it in addition to the system CAs. The configmap is optional, the
+// operator creates it once the pods run.
+func TrustBundleVolume() (corev1.Volume, corev1.VolumeMount, corev1.EnvVar) {
+	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
+	volume := corev1.Volume{
+		Name: trustBundleVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: TrustBundleConfigMapName},
+				Items:                []corev1.KeyToPath{{Key: CABundleKey, Path: CABundleKey}},
+				DefaultMode:          &defaultMode,
+				Optional:             &[]bool{true}[0],
+			},
+		},
+	}
+	mount := corev1.VolumeMount{
+		Name:      trustBundleVolumeName,
+		MountPath: TrustBundleDir,
+		ReadOnly:  true,
+	}
+	return volume, mount, corev1.EnvVar{Name: "SSL_CERT_DIR", Value: TrustBundleDir}
+}
+
+// DefinitionOption customizes the definitions of NewDefinitionFactory
+type DefinitionOption func(*definitionOptions)
+
+type definitionOptions struct {
+	certConfig           *v1alpha1.MaroonedPodsCertConfig
+	extraSANs            []string
+	additionalNamespaces []string
+	controllerClientCert bool
+	metricsCerts         bool
+}
+
+// WithCertConfig applies the certConfig of the CR, e.g. its lifetimes
+func WithCertConfig(config *v1alpha1.MaroonedPodsCertConfig) DefinitionOption {
+	return func(o *definitionOptions) {
+		o.certConfig = config
+	}
+}
+
+// WithExtraSANs adds SANs to the serving certificate of the server, e.g. an external hostname
+func WithExtraSANs(sans ...string) DefinitionOption {
+	return func(o *definitionOptions) {
+		o.extraSANs = append(o.extraSANs, sans...)
+	}
+}
+
+// WithAdditionalNamespaces replicates the CA bundle into the namespaces, in addition to the
+// bundle replica namespaces of the certConfig
+func WithAdditionalNamespaces(namespaces ...string) DefinitionOption {
+	return func(o *definitionOptions) {
+		o.additionalNamespaces = append(o.additionalNamespaces, namespaces...)
+	}
+}
+
+// WithControllerClientCert adds the client certificate of the controller, signed by the server signer
+func WithControllerClientCert() DefinitionOption {
+	return func(o *definitionOptions) {
+		o.controllerClientCert = true
+	}
+}
+
+// WithMetricsCerts adds the serving certificates of the metrics of the operator and the controller, signed
+// by a CA of their own whatever the certManagement
+func WithMetricsCerts() DefinitionOption {
+	return func(o *definitionOptions) {
+		o.metricsCerts = true
+	}
+}
+
+// NewDefinitionFactory returns the standard certificate definitions of an install in the namespace:
+// the server serving certificate with the CA and its bundle, and with WithControllerClientCert the
+// client certificate of the controller, with WithMetricsCerts the serving certificates of the metrics.
+// The definitions are validated.
+func NewDefinitionFactory(installNamespace string, opts ...DefinitionOption) ([]CertificateDefinition, error) {
+	o := &definitionOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	args, err := ArgsFromCertConfig(installNamespace, o.certConfig)
+	if err != nil {
+		return nil, err
+	}
+	args.BundleReplicaNamespaces = appendMissing(args.BundleReplicaNamespaces, o.additionalNamespaces...)
+
+	defs := createCertificateDefinitions()
+	if o.controllerClientCert {
+		defs = append(defs, createControllerClientCertificateDefinition())
+	}
+	if o.metricsCerts {
+		defs = append(defs, createMetricsCertificateDefinitions()...)
+	}
+	defs = applyFactoryArgs(defs, args)
+
+	for i := range defs {
+		def := &defs[i]
+		if def.TargetService != nil && *def.TargetService == ServerServiceName && len(o.extraSANs) > 0 {
+			def.TargetExtraSANs = appendMissing(nil, o.extraSANs...)
+		}
+		if err := validateConfigurable(def, args); err != nil {
+			return nil, err
+		}
+		if err := def.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return defs, nil
+}
+
+func createControllerClientCertificateDefinition() CertificateDefinition {
+	return CertificateDefinition{
+		Configurable: true,
+		SignerSecret: createSecret(ServerSignerSecretName),
+		SignerConfig: CertificateConfig{
+			Lifetime: 48 * time.Hour,
+			Refresh:  24 * time.Hour,
+		},
+		CertBundleConfigmap: createConfigMap(CABundleConfigMapName),
+		TargetSecret:        createSecret(ControllerClientCertSecretName),
+		TargetConfig: CertificateConfig{
+			Lifetime: 24 * time.Hour,
+			Refresh:  12 * time.Hour,
+		},
+		TargetUser:        &[]string{ControllerClientUserName}[0],
+		ExtendedKeyUsages: ExtendedKeyUsagesClient,
+		RolloutDeployments: []string{
+			util.ControllerResourceName,
+		},
+	}
+}
+
+// createMetricsCertificateDefinitions returns the serving certificates of the metrics listeners, they
+// load the rotated certificates without a rollout
+func createMetricsCertificateDefinitions() []CertificateDefinition {
+	metricsCert := func(secretName, serviceName string) CertificateDefinition {
+		return CertificateDefinition{
+			SignerSecret: createSecret(MetricsSignerSecretName),
+			SignerConfig: CertificateConfig{
+				Lifetime: 48 * time.Hour,
+				Refresh:  24 * time.Hour,
+			},
+			CertBundleConfigmap: createConfigMap(MetricsCABundleConfigMapName),
+			TargetSecret:        createSecret(secretName),
+			TargetConfig: CertificateConfig{
+				Lifetime: 24 * time.Hour,
+				Refresh:  12 * time.Hour,
+			},
+			TargetService: &serviceName,
+		}
+	}
+	return []CertificateDefinition{
+		metricsCert(OperatorMetricsCertSecretName, util.OperatorMetricsServiceName),
+		metricsCert(ControllerMetricsCertSecretName, util.ControllerMetricsServiceName),
+	}
+}
+
+// certTargetOf returns the target of the certConfig overrides the definition issues, empty for the others
+func certTargetOf(cd *CertificateDefinition) v1alpha1.CertTarget {
+	if cd.TargetSecret == nil {
+		return ""
+	}
+	switch cd.TargetSecret.Name {
+	case ServerCertSecretName:
+		return v1alpha1.CertTargetServer
+	case ControllerClientCertSecretName:
+		return v1alpha1.CertTargetControllerClient
+	case OperatorMetricsCertSecretName, ControllerMetricsCertSecretName:
+		return v1alpha1.CertTargetMetrics
+	}
+	return ""
+}
+
+// appendMissing appends the values the slice doesn't have yet, into a copy
+func appendMissing(slice []string, values ...string) []string {
+	if len(values) == 0 {
+		return slice
+	}
+	result := append([]string{}, slice...)
+	for _, value := range values {
+		found := false
+		for _, v := range result {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package cert
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// Day is the d unit of ParseDuration
+	Day = 24 * time.Hour
+	// Year is the y unit of ParseDuration, calendar years are not taken into account
+	Year = 365 * Day
+)
+
+var durationComponent = regexp.MustCompile(`^([0-9]*(?:\.[0-9]*)?)([a-zµμ]+)`)
+
+// ParseDuration parses a duration in Go syntax, e.g. 8760h, which may also use the d (days) and
+// y (365-day years) units, e.g. 365d, 1y or 1y12h
+func ParseDuration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	var total time.Duration
+	for rest := s; rest != ""; {
+		match := durationComponent.FindStringSubmatch(rest)
+		if match == nil || match[1] == "" || match[1] == "." {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		rest = rest[len(match[0]):]
+
+		var component time.Duration
+		switch match[2] {
+		case "d", "y":
+			value, err := strconv.ParseFloat(match[1], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			unit := Day
+			if match[2] == "y" {
+				unit = Year
+			}
+			if value*float64(unit) > math.MaxInt64 {
+				return 0, fmt.Errorf("duration %q is out of range", s)
+			}
+			component = time.Duration(value * float64(unit))
+		default:
+			d, err := time.ParseDuration(match[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			component = d
+		}
+
+		if total > math.MaxInt64-component {
+			return 0, fmt.Errorf("duration %q is out of range", s)
+		}
+		total += component
+	}
+	return total, nil
+}
+
+// FormatDuration returns the canonical representation of a duration, equivalent spellings like
+// 24h and 1d have the same one
+func FormatDuration(d time.Duration) string {
+	return d.String()
+}
@@ -3,8 +3,10 @@ package cert
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	"time"
 )
 
@@ -15,16 +17,118 @@ type FactoryArgs struct {
 	SignerDuration *time.Duration
 	// Duration to subtract from cert NotAfter value
 	SignerRenewBefore *time.Duration
+	// renew at the percentage of the lifetime, exclusive with SignerRenewBefore
+	SignerRefreshPercent *int
+	// shift of the NotBefore into the past
+	SignerBackdate *time.Duration
 
 	TargetDuration *time.Duration
 	// Duration to subtract from cert NotAfter value
 	TargetRenewBefore *time.Duration
+	// renew at the percentage of the lifetime, exclusive with TargetRenewBefore
+	TargetRefreshPercent *int
+	// shift of the NotBefore into the past
+	TargetBackdate *time.Duration
+	// applied to the targets of the component instead of the Target args, merged with them
+	TargetOverrides map[v1alpha1.CertTarget]TargetOverride
+
+	// cert-manager.io issuer to request the certificates from instead of the built-in signer
+	Issuer *IssuerReference
+
+	// namespaces the CA bundle of the configurable definitions is replicated into
+	BundleReplicaNamespaces        []string
+	BundleReplicaNamespaceSelector *metav1.LabelSelector
+	// merge the cluster root CA into the CA bundle of the configurable definitions
+	IncludeKubeRootCA bool
+	// combine the CA bundle of the configurable definitions with the CAs of the cluster-wide proxy
+	ProxyTrust *ProxyTrust
+}
+
+// TargetOverride is the configuration of the targets of a component, the unset fields keep the defaults
+type TargetOverride struct {
+	Duration       *time.Duration
+	RenewBefore    *time.Duration
+	RefreshPercent *int
+	Backdate       *time.Duration
+}
+
+func (o TargetOverride) apply(c *CertificateConfig) {
+	if o.Duration != nil {
+		c.Lifetime = *o.Duration
+	}
+	if o.RenewBefore != nil {
+		// convert to time from cert NotBefore
+		c.Refresh = c.Lifetime - *o.RenewBefore
+		c.RefreshPercent = 0
+	}
+	if o.RefreshPercent != nil {
+		c.Refresh = 0
+		c.RefreshPercent = *o.RefreshPercent
+	}
+	if o.Backdate != nil {
+		c.Backdate = *o.Backdate
+	}
+}
+
+// ProxyTrust selects the configmap with the CAs of the cluster-wide proxy
+type ProxyTrust struct {
+	// ConfigMapName is a configmap of the bundle namespace, empty for the OpenShift injection
+	ConfigMapName string
+}
+
+// TrustBundle combines the CA bundle of a definition with the CAs of the cluster-wide proxy
+type TrustBundle struct {
+	// ConfigMap is the combined trust bundle, in the namespace of the CA bundle
+	ConfigMap *corev1.ConfigMap
+	// Source is the configmap of the namespace of the CA bundle with the CAs of the proxy under CABundleKey
+	Source string
+	// InjectSource creates the source labeled for the injection of the OpenShift trusted CA bundle
+	InjectSource bool
+}
+
+// IssuerReference references a cert-manager.io Issuer or ClusterIssuer
+type IssuerReference struct {
+	Name  string
+	Kind  string
+	Group string
 }
 
 // CertificateConfig contains cert configuration data
 type CertificateConfig struct {
 	Lifetime time.Duration
 	Refresh  time.Duration
+	// RefreshPercent (1-99) of the Lifetime is the Refresh, it is resolved when the definitions are
+	// created and is mutually exclusive with a different Refresh
+	RefreshPercent int
+	// Backdate (0-MaxBackdate) moves the NotBefore of the certificate into the past, so clients with
+	// a clock behind the operator accept it, the NotAfter and the refresh are unchanged
+	Backdate time.Duration
+}
+
+// MaxBackdate is the longest Backdate of a CertificateConfig
+const MaxBackdate = time.Hour
+
+const (
+	// MinRefresh is the shortest Refresh of a CertificateConfig, a shorter one rotates the certificate
+	// with about every sync
+	MinRefresh = time.Minute
+	// MinLifetime is the shortest Lifetime of a CertificateConfig, library-go refreshes at 80% of it at
+	// the latest, which leaves the operator at least a MinRefresh to rotate before the expiry
+	MinLifetime = 5 * MinRefresh
+)
+
+// ResolveRefresh sets the Refresh of a RefreshPercent, truncated to the second as the validity of a
+// certificate is
+func (c *CertificateConfig) ResolveRefresh() {
+	if c.RefreshPercent == 0 || c.Refresh != 0 {
+		return
+	}
+	c.Refresh = c.percentRefresh()
+}
+
+func (c *CertificateConfig) percentRefresh() time.Duration {
+	// in seconds, the nanoseconds of long lifetimes overflow
+	return time.Duration(int64(c.Lifetime/time.Second)*int64(c.RefreshPercent)/100) * time.Second
 }
 
 // CertificateDefinition contains the data required to create/manage certtificate chains
@@ -46,13 +150,235 @@ type CertificateDefinition struct {
 	// only one of the following should be set
 	// contains target key/cert for server
 	TargetService *string
+	// additional SANs of the serving certificate of the TargetService
+	TargetExtraSANs []string
+	// hosts of the routes and ingresses, in the target secret namespace, added to the SANs of the
+	// serving certificate of the TargetService. They are looked up on every sync and a change re-issues
+	// the target. Without the route API the routes are looked up as ingresses.
+	DiscoverRouteHosts   *HostDiscovery
+	DiscoverIngressHosts *HostDiscovery
 	// contains target user name
 	TargetUser *string
+	// groups of the target user, written into the organization of the certificate
+	TargetGroups []string
+	// extended key usages of the target, defaults to server for a TargetService and
+	// client for a TargetUser
+	ExtendedKeyUsages ExtendedKeyUsages
+	// fail the sync instead of warning when the TargetService does not exist
+	StrictTargetService bool
+	// additional data keys of the target secret the cert and the key are mirrored into,
+	// e.g. server.crt/server.key, tls.crt/tls.key are always written
+	CertKeyName string
+	KeyKeyName  string
+	// SplitKeySecret, in the target secret namespace, receives the key of the target together with
+	// its certificate, the target secret keeps tls.crt and an empty tls.key. Readers of the target
+	// secret don't get to see the key.
+	SplitKeySecret *corev1.Secret
+
+	// deployments (in the target secret namespace) that mount the target secret
+	// and have to be restarted when it rotates
+	RolloutDeployments []string
+	// DiscoverConsumers finds the workloads referencing the signer, target and bundle, they are
+	// listed with the managed certificates and named in an event when the target rotates
+	DiscoverConsumers bool
+
+	// when set the target is issued by cert-manager.io and the signer is not used
+	Issuer *IssuerReference
+	// PrivateKey requests the key of the target from the cert-manager.io Issuer, RSA 2048 by default.
+	// The built-in signer always issues RSA 2048 keys with SHA-256 signatures.
+	PrivateKey *PrivateKeyParameters
+	// FIPS refuses to issue with parameters that aren't FIPS-approved and re-issues the certificates
+	// that were issued with such parameters
+	FIPS bool
+	// External targets are provided by the user with the CA issuing them in ca.crt, the operator
+	// validates them and publishes the CA, the signer is not used
+	External bool
+
+	// clusters of the bundle and of its consumers in a hosted control plane topology, the management
+	// cluster by default. The signer and target secrets are always in the management cluster, with
+	// the components holding the keys.
+	BundleCluster   Cluster
+	ConsumerCluster Cluster
+
+	// MutatingWebhookConfigurations whose webhooks get the CA bundle as caBundle
+	MutatingWebhookConfigurations []string
+	// CorrectWebhookSANs adds the hosts the clientConfigs of the MutatingWebhookConfigurations call to
+	// the SANs of the serving certificate of the TargetService, a mismatch is only reported without it
+	CorrectWebhookSANs bool
+	// CustomResourceDefinitions whose conversion webhook gets the CA bundle as caBundle
+	ConversionCRDs []string
+	// APIServices of aggregated API servers that get the CA bundle as caBundle, they are in the
+	// management cluster
+	APIServices []string
+
+	// BundleAdditionalKey publishes the CA bundle under one more data key of the bundle configmap,
+	// e.g. service-ca.crt for consumers of the inject-cabundle annotation
+	BundleAdditionalKey string
+	// BundleCopies are configmaps, possibly in other namespaces, the CA bundle is copied into
+	BundleCopies []types.NamespacedName
+	// BundleReplicaNamespaces get a copy of the bundle configmap under its name, e.g. the workload
+	// namespaces calling the server, which can't read the configmaps of the install namespace
+	BundleReplicaNamespaces []string
+	// BundleReplicaNamespaceSelector selects more replica namespaces, it is evaluated on every sync
+	// and the copies of the namespaces it doesn't select anymore are removed
+	BundleReplicaNamespaceSelector *metav1.LabelSelector
+	// PublishClusterTrustBundle also publishes the still valid CAs of the bundle as the ClusterTrustBundle
+	// <signer namespace>.<signer name>, pods can mount it with a projected volume. It is skipped on
+	// clusters without the certificates.k8s.io ClusterTrustBundle API.
+	PublishClusterTrustBundle bool
+	// IncludeKubeRootCA merges the cluster root CA of kube-root-ca.crt in the namespace of the bundle
+	// into the bundle, for consumers also calling the Kubernetes API. The merged CAs don't count
+	// against MaxBundleCAs.
+	IncludeKubeRootCA bool
+	// TrustBundle combines the CA bundle with the CAs of the cluster-wide proxy into another configmap
+	// for the outbound calls of the components, the CA bundle itself is left as is
+	TrustBundle *TrustBundle
+	// CASettleDelay is how long the target keeps its certificate after a new CA of the signer was
+	// published into the bundle and its propagation targets, e.g. for the pods mounting the bundle to
+	// pick it up, before it is issued by the new CA. The target is issued after the publication anyway.
+	CASettleDelay time.Duration
+	// MaxBundleCAs caps the number of CAs kept in the bundle, the oldest are dropped first,
+	// except the current signer and the CAs of unexpired targets. 0 means unlimited.
+	MaxBundleCAs int
+
+	// additional encodings of the target key/cert written into the target secret
+	OutputFormats []OutputFormat
+	// key of a secret in the target secret namespace holding the password of the pkcs12 keystore,
+	// a password is generated once per target secret when not set
+	KeystorePasswordSecret *corev1.SecretKeySelector
+	// append the chain after the leaf in tls-combined.pem
+	CombinedPEMWithChain bool
+	// EmitKubeconfig writes a kubeconfig authenticating as the TargetUser under the kubeconfig key of
+	// the target secret, it is regenerated when the key pair, the CA or the server change
+	EmitKubeconfig *KubeconfigOptions
+	// additional encodings of the CA bundle written into the bundle configmap
+	BundleOutputFormats []OutputFormat
+}
+
+// PrivateKeyAlgorithm is the algorithm of the key cert-manager.io generates for a target
+type PrivateKeyAlgorithm string
+
+const (
+	// PrivateKeyAlgorithmRSA generates RSA keys, 2048 bits by default
+	PrivateKeyAlgorithmRSA PrivateKeyAlgorithm = "RSA"
+	// PrivateKeyAlgorithmECDSA generates ECDSA keys, on P-256 by default
+	PrivateKeyAlgorithmECDSA PrivateKeyAlgorithm = "ECDSA"
+	// PrivateKeyAlgorithmEd25519 generates Ed25519 keys, they have no size
+	PrivateKeyAlgorithmEd25519 PrivateKeyAlgorithm = "Ed25519"
+)
+
+// PrivateKeyParameters are the privateKey of a cert-manager.io Certificate
+type PrivateKeyParameters struct {
+	Algorithm PrivateKeyAlgorithm
+	// bits of an RSA key, of the curve of an ECDSA key, the cert-manager.io default when 0
+	Size int
+}
+
+// KubeconfigOptions configures the kubeconfig of a client certificate
+type KubeconfigOptions struct {
+	// Server is the https URL of the API server
+	Server string
+	// CAConfigMap, in the target secret namespace, holds the CA of the server, the CA bundle of the
+	// definition by default
+	CAConfigMap *corev1.ConfigMapKeySelector
+}
+
+// HostDiscovery selects the routes or ingresses whose hosts are discovered, by name or by labels
+type HostDiscovery struct {
+	Name     string
+	Selector *metav1.LabelSelector
+}
+
+// Cluster is the cluster an object of a definition lives in
+type Cluster string
+
+const (
+	// ManagementCluster is the cluster the operator runs in
+	ManagementCluster Cluster = ""
+	// GuestCluster is the hosted cluster of a hosted control plane topology
+	GuestCluster Cluster = "guest"
+)
+
+// ExtendedKeyUsages selects the extended key usages of a target certificate
+type ExtendedKeyUsages string
+
+const (
+	// ExtendedKeyUsagesServer issues certificates for TLS servers
+	ExtendedKeyUsagesServer ExtendedKeyUsages = "server"
+	// ExtendedKeyUsagesClient issues certificates for TLS clients
+	ExtendedKeyUsagesClient ExtendedKeyUsages = "client"
+	// ExtendedKeyUsagesBoth issues certificates usable by both ends of mutual TLS
+	ExtendedKeyUsagesBoth ExtendedKeyUsages = "both"
+)
+
+// OutputFormat is an encoding of the target key/cert in addition to tls.crt/tls.key
+type OutputFormat string
+
+const (
+	// OutputFormatPKCS12 writes keystore.p12 with the key and the chain and keystore-password into
+	// the target secret, or truststore.p12 with every CA of the bundle into the bundle configmap
+	OutputFormatPKCS12 OutputFormat = "pkcs12"
+	// OutputFormatCombinedPEM writes tls-combined.pem with the key followed by the leaf into the target secret
+	OutputFormatCombinedPEM OutputFormat = "combined-pem"
+)
+
+// HasOutputFormat returns whether the format is requested for the target
+func (cd *CertificateDefinition) HasOutputFormat(format OutputFormat) bool {
+	return hasOutputFormat(cd.OutputFormats, format)
+}
+
+// HasBundleOutputFormat returns whether the format is requested for the CA bundle
+func (cd *CertificateDefinition) HasBundleOutputFormat(format OutputFormat) bool {
+	return hasOutputFormat(cd.BundleOutputFormats, format)
+}
+
+func hasOutputFormat(formats []OutputFormat, format OutputFormat) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// CABundleKey is the key of the bundle configmap the built-in signer publishes its CA bundle into
+const CABundleKey = "ca-bundle.crt"
+
+// ServiceCABundleKey is the key of the bundle configmap the service-ca operator injects its CA into
+const ServiceCABundleKey = "service-ca.crt"
+
+// KubeRootCAConfigMapName is the configmap kube-controller-manager publishes the cluster root CA in,
+// in every namespace
+const KubeRootCAConfigMapName = "kube-root-ca.crt"
+
+// ServerCertDir is where the server Deployment mounts the target secret of the server certificate
+const ServerCertDir = "/etc/admission-webhook/tls"
+
+// ServerCertificateDefinition returns the definition of the serving certificate of the server, the
+// volumes of the deployments mounting its target secret are rendered from it
+func ServerCertificateDefinition() CertificateDefinition {
+	return createCertificateDefinitions()[0]
+}
+
+// TargetFiles returns the keys of the target secret holding the cert and the key, the file names
+// they have in a volume of the secret
+func (cd *CertificateDefinition) TargetFiles() (string, string) {
+	certFile, keyFile := corev1.TLSCertKey, corev1.TLSPrivateKeyKey
+	if cd.CertKeyName != "" {
+		certFile = cd.CertKeyName
+	}
+	if cd.KeyKeyName != "" {
+		keyFile = cd.KeyKeyName
+	}
+	return certFile, keyFile
 }
 
 // CreateCertificateDefinitions creates certificate definitions
 func CreateCertificateDefinitions(args *FactoryArgs) []CertificateDefinition {
-	defs := createCertificateDefinitions()
+	return applyFactoryArgs(createCertificateDefinitions(), args)
+}
+
+func applyFactoryArgs(defs []CertificateDefinition, args *FactoryArgs) []CertificateDefinition {
 	for i := range defs {
 		def := &defs[i]
 
@@ -68,7 +394,20 @@ func CreateCertificateDefinitions(args *FactoryArgs) []CertificateDefinition {
 			addNamespace(args.Namespace, def.TargetSecret)
 		}
 
+		if def.SplitKeySecret != nil {
+			addNamespace(args.Namespace, def.SplitKeySecret)
+		}
+
+		def.Issuer = args.Issuer
+
 		if def.Configurable {
+			if def.CertBundleConfigmap != nil {
+				def.BundleReplicaNamespaces = args.BundleReplicaNamespaces
+				def.BundleReplicaNamespaceSelector = args.BundleReplicaNamespaceSelector
+				def.IncludeKubeRootCA = args.IncludeKubeRootCA
+				def.TrustBundle = newTrustBundle(def.CertBundleConfigmap.Namespace, args.ProxyTrust)
+			}
+
 			if args.SignerDuration != nil {
 				def.SignerConfig.Lifetime = *args.SignerDuration
 			}
@@ -76,6 +415,16 @@ func CreateCertificateDefinitions(args *FactoryArgs) []CertificateDefinition {
 			if args.SignerRenewBefore != nil {
 				// convert to time from cert NotBefore
 				def.SignerConfig.Refresh = def.SignerConfig.Lifetime - *args.SignerRenewBefore
+				def.SignerConfig.RefreshPercent = 0
+			}
+
+			if args.SignerRefreshPercent != nil {
+				def.SignerConfig.Refresh = 0
+				def.SignerConfig.RefreshPercent = *args.SignerRefreshPercent
+			}
+
+			if args.SignerBackdate != nil {
+				def.SignerConfig.Backdate = *args.SignerBackdate
 			}
 
 			if args.TargetDuration != nil {
@@ -85,8 +434,25 @@ func CreateCertificateDefinitions(args *FactoryArgs) []CertificateDefinition {
 			if args.TargetRenewBefore != nil {
 				// convert to time from cert NotBefore
 				def.TargetConfig.Refresh = def.TargetConfig.Lifetime - *args.TargetRenewBefore
+				def.TargetConfig.RefreshPercent = 0
+			}
+
+			if args.TargetRefreshPercent != nil {
+				def.TargetConfig.Refresh = 0
+				def.TargetConfig.RefreshPercent = *args.TargetRefreshPercent
+			}
+
+			if args.TargetBackdate != nil {
+				def.TargetConfig.Backdate = *args.TargetBackdate
 			}
 		}
+
+		if override, ok := args.TargetOverrides[certTargetOf(def)]; ok && def.TargetSecret != nil {
+			override.apply(&def.TargetConfig)
+		}
+
+		def.SignerConfig.ResolveRefresh()
+		def.TargetConfig.ResolveRefresh()
 	}
 
 	return defs
@@ -102,18 +468,28 @@ func createCertificateDefinitions() []CertificateDefinition {
 	return []CertificateDefinition{
 		{
 			Configurable: true,
-			SignerSecret: createSecret("maroonedpods-server"),
+			SignerSecret: createSecret(ServerSignerSecretName),
 			SignerConfig: CertificateConfig{
 				Lifetime: 48 * time.Hour,
 				Refresh:  24 * time.Hour,
 			},
-			CertBundleConfigmap: createConfigMap("maroonedpods-server-signer-bundle"),
-			TargetSecret:        createSecret(util.SecretResourceName),
+			CertBundleConfigmap: createConfigMap(CABundleConfigMapName),
+			TargetSecret:        createSecret(ServerCertSecretName),
 			TargetConfig: CertificateConfig{
 				Lifetime: 24 * time.Hour,
 				Refresh:  12 * time.Hour,
 			},
-			TargetService: &[]string{cluster.MaroonedPodsServerServiceName}[0],
+			TargetService: &[]string{ServerServiceName}[0],
+			RolloutDeployments: []string{
+				util.MaroonedPodsServerResourceName,
+				util.ControllerResourceName,
+			},
+			MutatingWebhookConfigurations: []string{
+				cluster.MutatingWebhookConfigurationName,
+			},
+			ConversionCRDs: []string{
+				util.MaroonedPodsCRDName,
+			},
 		},
 	}
 }
@@ -124,7 +500,30 @@ func createSecret(name string) *corev1.Secret {
 			Name:   name,
 			Labels: util.ResourceBuilder.WithCommonLabels(nil),
 		},
+		Type: corev1.SecretTypeTLS,
+		// required by the API server for the type
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       {},
+			corev1.TLSPrivateKeyKey: {},
+		},
+	}
+}
+
+// newTrustBundle returns the trust bundle of the proxy CAs, nil without them
+func newTrustBundle(namespace string, proxyTrust *ProxyTrust) *TrustBundle {
+	if proxyTrust == nil {
+		return nil
+	}
+	trustBundle := &TrustBundle{
+		ConfigMap: createConfigMap(TrustBundleConfigMapName),
+		Source:    proxyTrust.ConfigMapName,
+	}
+	trustBundle.ConfigMap.Namespace = namespace
+	if trustBundle.Source == "" {
+		trustBundle.Source = ProxyTrustedCAConfigMapName
+		trustBundle.InjectSource = true
 	}
+	return trustBundle
 }
 
 func createConfigMap(name string) *corev1.ConfigMap {
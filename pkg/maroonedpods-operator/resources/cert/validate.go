@@ -0,0 +1,320 @@
+package cert
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrInvalidDefinition is returned for certificate definitions that cannot be issued
+var ErrInvalidDefinition = errors.New("invalid certificate definition")
+
+// Validate checks the definition can be issued
+func (cd *CertificateDefinition) Validate() error {
+	if cd.TargetSecret != nil {
+		if cd.TargetService == nil && cd.TargetUser == nil {
+			return cd.invalid("one of TargetService and TargetUser is required with a TargetSecret")
+		}
+		if cd.TargetService != nil && cd.TargetUser != nil {
+			return cd.invalid("only one of TargetService and TargetUser can be set")
+		}
+	}
+
+	if err := cd.validateSplitKeySecret(); err != nil {
+		return err
+	}
+
+	if err := cd.validateKubeconfig(); err != nil {
+		return err
+	}
+
+	if err := cd.validateHostDiscovery("DiscoverRouteHosts", cd.DiscoverRouteHosts); err != nil {
+		return err
+	}
+	if err := cd.validateHostDiscovery("DiscoverIngressHosts", cd.DiscoverIngressHosts); err != nil {
+		return err
+	}
+
+	if err := cd.validateCorrectWebhookSANs(); err != nil {
+		return err
+	}
+
+	switch cd.ExtendedKeyUsages {
+	case "", ExtendedKeyUsagesServer, ExtendedKeyUsagesClient, ExtendedKeyUsagesBoth:
+	default:
+		return cd.invalid(fmt.Sprintf("unknown extended key usages %q", cd.ExtendedKeyUsages))
+	}
+
+	if err := cd.validateRefreshPercent("signer", cd.SignerConfig); err != nil {
+		return err
+	}
+	if err := cd.validateRefreshPercent("target", cd.TargetConfig); err != nil {
+		return err
+	}
+
+	if err := cd.validateRefreshWindow("signer", cd.SignerConfig); err != nil {
+		return err
+	}
+	if err := cd.validateRefreshWindow("target", cd.TargetConfig); err != nil {
+		return err
+	}
+
+	if err := cd.validateBackdate("signer", cd.SignerConfig); err != nil {
+		return err
+	}
+	if err := cd.validateBackdate("target", cd.TargetConfig); err != nil {
+		return err
+	}
+
+	if err := cd.validateBundleReplicas(); err != nil {
+		return err
+	}
+
+	if cd.PublishClusterTrustBundle {
+		switch {
+		case cd.CertBundleConfigmap == nil:
+			return cd.invalid("PublishClusterTrustBundle requires a CertBundleConfigmap")
+		case cd.BundleCluster != ManagementCluster:
+			return cd.invalid("PublishClusterTrustBundle can't be used with a BundleCluster, it is published in the management cluster")
+		}
+	}
+
+	if err := cd.validateTrustBundle(); err != nil {
+		return err
+	}
+
+	if len(cd.APIServices) > 0 && cd.ConsumerCluster != ManagementCluster {
+		return cd.invalid("APIServices can't be used with a ConsumerCluster, they are updated in the management cluster")
+	}
+
+	if cd.MaxBundleCAs < 0 {
+		return cd.invalid("MaxBundleCAs can't be negative")
+	}
+	if cd.CASettleDelay < 0 {
+		return cd.invalid("CASettleDelay can't be negative")
+	}
+
+	for _, c := range []Cluster{cd.BundleCluster, cd.ConsumerCluster} {
+		switch c {
+		case ManagementCluster, GuestCluster:
+		default:
+			return cd.invalid(fmt.Sprintf("unknown cluster %q", c))
+		}
+	}
+	if cd.External && cd.Issuer != nil {
+		return cd.invalid("External can't be used with an Issuer")
+	}
+	if cd.BundleCluster != ManagementCluster && cd.Issuer != nil {
+		return cd.invalid("BundleCluster can't be used with an Issuer, cert-manager.io writes the bundle in the management cluster")
+	}
+
+	return cd.validatePrivateKey()
+}
+
+func (cd *CertificateDefinition) validatePrivateKey() error {
+	if cd.PrivateKey == nil {
+		return nil
+	}
+	if cd.Issuer == nil {
+		return cd.invalid("PrivateKey requires an Issuer, the built-in signer always issues RSA 2048 keys")
+	}
+	switch cd.PrivateKey.Algorithm {
+	case PrivateKeyAlgorithmRSA, PrivateKeyAlgorithmECDSA, PrivateKeyAlgorithmEd25519:
+	default:
+		return cd.invalid(fmt.Sprintf("unknown private key algorithm %q", cd.PrivateKey.Algorithm))
+	}
+	if cd.PrivateKey.Size < 0 {
+		return cd.invalid("PrivateKey size can't be negative")
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateSplitKeySecret() error {
+	if cd.SplitKeySecret == nil {
+		return nil
+	}
+	switch {
+	case cd.TargetSecret == nil:
+		return cd.invalid("SplitKeySecret requires a TargetSecret")
+	case cd.SplitKeySecret.Namespace != cd.TargetSecret.Namespace:
+		return cd.invalid("SplitKeySecret has to be in the namespace of the TargetSecret")
+	case cd.SplitKeySecret.Name == cd.TargetSecret.Name:
+		return cd.invalid("SplitKeySecret can't be the TargetSecret")
+	case cd.Issuer != nil:
+		return cd.invalid("SplitKeySecret can't be used with an Issuer, cert-manager.io writes the target secret")
+	case cd.KeyKeyName != "" && cd.KeyKeyName != corev1.TLSPrivateKeyKey:
+		return cd.invalid("KeyKeyName would copy the key into the TargetSecret")
+	case cd.HasOutputFormat(OutputFormatPKCS12), cd.HasOutputFormat(OutputFormatCombinedPEM):
+		return cd.invalid("the output formats would copy the key into the TargetSecret")
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateKubeconfig() error {
+	if cd.EmitKubeconfig == nil {
+		return nil
+	}
+	switch {
+	case cd.TargetUser == nil:
+		return cd.invalid("EmitKubeconfig requires a TargetUser")
+	case cd.Issuer != nil:
+		return cd.invalid("EmitKubeconfig can't be used with an Issuer")
+	case cd.External:
+		return cd.invalid("EmitKubeconfig can't be used with an External target")
+	case cd.SplitKeySecret != nil:
+		return cd.invalid("EmitKubeconfig would copy the key into the TargetSecret")
+	case cd.EmitKubeconfig.CAConfigMap == nil && cd.CertBundleConfigmap == nil:
+		return cd.invalid("EmitKubeconfig requires a CAConfigMap without a CertBundleConfigmap")
+	}
+	server, err := url.Parse(cd.EmitKubeconfig.Server)
+	if err != nil || server.Scheme != "https" || server.Host == "" {
+		return cd.invalid(fmt.Sprintf("EmitKubeconfig server %q is not an https URL", cd.EmitKubeconfig.Server))
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateCorrectWebhookSANs() error {
+	if !cd.CorrectWebhookSANs {
+		return nil
+	}
+	switch {
+	case cd.TargetService == nil:
+		return cd.invalid("CorrectWebhookSANs requires a TargetService")
+	case cd.Issuer != nil:
+		return cd.invalid("CorrectWebhookSANs can't be used with an Issuer")
+	case cd.External:
+		return cd.invalid("CorrectWebhookSANs can't be used with an External target")
+	case len(cd.MutatingWebhookConfigurations) == 0:
+		return cd.invalid("CorrectWebhookSANs requires MutatingWebhookConfigurations")
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateHostDiscovery(field string, discovery *HostDiscovery) error {
+	if discovery == nil {
+		return nil
+	}
+	switch {
+	case cd.TargetService == nil:
+		return cd.invalid(field + " requires a TargetService")
+	case cd.Issuer != nil:
+		return cd.invalid(field + " can't be used with an Issuer")
+	case cd.External:
+		return cd.invalid(field + " can't be used with an External target")
+	case (discovery.Name == "") == (discovery.Selector == nil):
+		return cd.invalid(field + " needs one of Name and Selector")
+	}
+	if discovery.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(discovery.Selector); err != nil {
+			return cd.invalid(fmt.Sprintf("invalid %s selector: %v", field, err))
+		}
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateRefreshPercent(config string, c CertificateConfig) error {
+	if c.RefreshPercent == 0 {
+		return nil
+	}
+	if c.RefreshPercent < 1 || c.RefreshPercent > 99 {
+		return cd.invalid(fmt.Sprintf("%s RefreshPercent %d is not between 1 and 99", config, c.RefreshPercent))
+	}
+	if c.Refresh == 0 {
+		return cd.invalid(fmt.Sprintf("%s RefreshPercent is not resolved, see ResolveRefresh", config))
+	}
+	if c.Refresh != c.percentRefresh() {
+		return cd.invalid(fmt.Sprintf("%s Refresh and RefreshPercent are mutually exclusive", config))
+	}
+	return nil
+}
+
+// validateRefreshWindow rejects the configs library-go would rotate with about every sync, a Refresh that
+// isn't positive or is too short, e.g. a renewBefore longer than the Lifetime or a small percentage of a
+// short one. A config without a Lifetime isn't used.
+func (cd *CertificateDefinition) validateRefreshWindow(config string, c CertificateConfig) error {
+	if c.Lifetime == 0 {
+		return nil
+	}
+	if c.Lifetime < MinLifetime {
+		return cd.invalid(fmt.Sprintf("%s Lifetime %s is shorter than %s", config, FormatDuration(c.Lifetime), FormatDuration(MinLifetime)))
+	}
+	if c.Refresh <= 0 {
+		return cd.invalid(fmt.Sprintf("%s refresh window is larger than the Lifetime %s", config, FormatDuration(c.Lifetime)))
+	}
+	if c.Refresh < MinRefresh {
+		return cd.invalid(fmt.Sprintf("%s Refresh %s is shorter than %s, the certificate would rotate continuously", config, FormatDuration(c.Refresh), FormatDuration(MinRefresh)))
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateBackdate(config string, c CertificateConfig) error {
+	if c.Backdate < 0 || c.Backdate > MaxBackdate {
+		return cd.invalid(fmt.Sprintf("%s Backdate %s is not between 0 and %s", config, FormatDuration(c.Backdate), FormatDuration(MaxBackdate)))
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateTrustBundle() error {
+	if cd.TrustBundle == nil {
+		return nil
+	}
+	switch {
+	case cd.CertBundleConfigmap == nil:
+		return cd.invalid("the TrustBundle requires a CertBundleConfigmap")
+	case cd.TrustBundle.ConfigMap == nil:
+		return cd.invalid("the TrustBundle requires a ConfigMap")
+	case cd.TrustBundle.ConfigMap.Namespace != cd.CertBundleConfigmap.Namespace:
+		return cd.invalid("the TrustBundle has to be in the namespace of the CertBundleConfigmap")
+	}
+	if errs := validation.NameIsDNSSubdomain(cd.TrustBundle.Source, false); len(errs) > 0 {
+		return cd.invalid(fmt.Sprintf("invalid trust bundle source %q: %s", cd.TrustBundle.Source, strings.Join(errs, ", ")))
+	}
+	for _, name := range []string{cd.CertBundleConfigmap.Name, cd.TrustBundle.ConfigMap.Name} {
+		if cd.TrustBundle.Source == name {
+			return cd.invalid(fmt.Sprintf("the trust bundle source can't be the configmap %s", name))
+		}
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) validateBundleReplicas() error {
+	if len(cd.BundleReplicaNamespaces) == 0 && cd.BundleReplicaNamespaceSelector == nil {
+		return nil
+	}
+	if cd.CertBundleConfigmap == nil {
+		return cd.invalid("the bundle replicas require a CertBundleConfigmap")
+	}
+	for _, namespace := range cd.BundleReplicaNamespaces {
+		if errs := validation.ValidateNamespaceName(namespace, false); len(errs) > 0 {
+			return cd.invalid(fmt.Sprintf("invalid bundle replica namespace %q: %s", namespace, strings.Join(errs, ", ")))
+		}
+	}
+	if cd.BundleReplicaNamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(cd.BundleReplicaNamespaceSelector); err != nil {
+			return cd.invalid(fmt.Sprintf("invalid bundle replica namespace selector: %v", err))
+		}
+	}
+	return nil
+}
+
+func (cd *CertificateDefinition) invalid(reason string) error {
+	return fmt.Errorf("%w %s: %s", ErrInvalidDefinition, cd.Name(), reason)
+}
+
+// Name identifies the definition by its target, or its signer if there is no target
+func (cd *CertificateDefinition) Name() string {
+	switch {
+	case cd.TargetSecret != nil:
+		return cd.TargetSecret.Namespace + "/" + cd.TargetSecret.Name
+	case cd.SignerSecret != nil:
+		return cd.SignerSecret.Namespace + "/" + cd.SignerSecret.Name
+	case cd.CertBundleConfigmap != nil:
+		return cd.CertBundleConfigmap.Namespace + "/" + cd.CertBundleConfigmap.Name
+	}
+	return "<unnamed>"
+}
@@ -7,15 +7,15 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	mpserver "maroonedpods.io/maroonedpods/pkg/maroonedpods-server"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
 	mpServerResourceName               = "maroonedpods-server"
 	MutatingWebhookConfigurationName   = "maroonedpods-mutator"
-	validatingWebhookConfigurationName = "maroonedpods-validator"
+	ValidatingWebhookConfigurationName = "maroonedpods-validator"
 	MaroonedPodsServerServiceName      = mpServerResourceName
 )
 
@@ -87,11 +87,14 @@ func createGatingMutatingWebhook(namespace string, c client.Client, l logr.Logge
 		includeHooks = false
 	}
 
-	path := mpserver.ServePath
+	path := util.WebhookServePath
 	defaultServicePort := int32(443)
 	namespacedScope := admissionregistrationv1.NamespacedScope
+	clusterScope := admissionregistrationv1.ClusterScope
 	exactPolicy := admissionregistrationv1.Equivalent
 	failurePolicy := admissionregistrationv1.Fail
+	// the operator updates the CR too, it must not be locked out while the server is unavailable
+	ignorePolicy := admissionregistrationv1.Ignore
 	sideEffect := admissionregistrationv1.SideEffectClassNone
 
 	hooks := []admissionregistrationv1.MutatingWebhook{}
@@ -124,6 +127,34 @@ func createGatingMutatingWebhook(namespace string, c client.Client, l logr.Logge
 					},
 				},
 			},
+			{
+				// normalizes the durations of the certConfig in the d and y units to Go syntax
+				Name:                    "maroonedpods.defaulter",
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
+				FailurePolicy:           &ignorePolicy,
+				SideEffects:             &sideEffect,
+				MatchPolicy:             &exactPolicy,
+				Rules: []admissionregistrationv1.RuleWithOperations{{
+					Operations: []admissionregistrationv1.OperationType{
+						admissionregistrationv1.Create,
+						admissionregistrationv1.Update,
+					},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{mpv1.SchemeGroupVersion.Group},
+						APIVersions: []string{"*"},
+						Scope:       &clusterScope,
+						Resources:   []string{"mps"},
+					},
+				}},
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Namespace: namespace,
+						Name:      MaroonedPodsServerServiceName,
+						Path:      &path,
+						Port:      &defaultServicePort,
+					},
+				},
+			},
 		}
 	}
 
@@ -168,11 +199,14 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 	if err != nil || controllerDeployment == nil || controllerDeployment.Status.ReadyReplicas < 1 {
 		includeHooks = false
 	}
-	path := mpserver.ServePath
+	path := util.WebhookServePath
 	defaultServicePort := int32(443)
 	namespacedScope := admissionregistrationv1.NamespacedScope
+	clusterScope := admissionregistrationv1.ClusterScope
 	exactPolicy := admissionregistrationv1.Equivalent
 	failurePolicy := admissionregistrationv1.Fail
+	// the operator updates the CR too, it must not be locked out while the server is unavailable
+	ignorePolicy := admissionregistrationv1.Ignore
 	sideEffect := admissionregistrationv1.SideEffectClassNone
 	hooks := []admissionregistrationv1.ValidatingWebhook{}
 	if includeHooks {
@@ -180,7 +214,7 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 			{
 				Name:                    "maroonedpods.validator",
 				AdmissionReviewVersions: []string{"v1", "v1beta1"},
-				FailurePolicy:           &failurePolicy,
+				FailurePolicy:           &ignorePolicy,
 				SideEffects:             &sideEffect,
 				MatchPolicy:             &exactPolicy,
 				Rules: []admissionregistrationv1.RuleWithOperations{
@@ -190,10 +224,10 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 							admissionregistrationv1.Update,
 						},
 						Rule: admissionregistrationv1.Rule{
-							APIGroups:   []string{"*"},
+							APIGroups:   []string{mpv1.SchemeGroupVersion.Group},
 							APIVersions: []string{"*"},
-							Scope:       &namespacedScope,
-							Resources:   []string{"maroonedpods"},
+							Scope:       &clusterScope,
+							Resources:   []string{"mps"},
 						},
 					},
 				},
@@ -228,6 +262,45 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 					},
 				},
 
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service: &admissionregistrationv1.ServiceReference{
+						Namespace: namespace,
+						Name:      MaroonedPodsServerServiceName,
+						Path:      &path,
+						Port:      &defaultServicePort,
+					},
+				},
+			},
+			{
+				// warns about the manual edits of the certificate secrets, the operator rotating them must
+				// not be blocked while the server is unavailable
+				Name:                    "managed.secret.validator",
+				AdmissionReviewVersions: []string{"v1", "v1beta1"},
+				FailurePolicy:           &ignorePolicy,
+				SideEffects:             &sideEffect,
+				MatchPolicy:             &exactPolicy,
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{corev1.LabelMetadataName: namespace},
+				},
+				ObjectSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						util.AppKubernetesManagedByLabel: util.ResourceBuilder.WithCommonLabels(nil)[util.AppKubernetesManagedByLabel],
+					},
+				},
+				Rules: []admissionregistrationv1.RuleWithOperations{
+					{
+						Operations: []admissionregistrationv1.OperationType{
+							admissionregistrationv1.Update,
+						},
+						Rule: admissionregistrationv1.Rule{
+							APIGroups:   []string{""},
+							APIVersions: []string{"v1"},
+							Scope:       &namespacedScope,
+							Resources:   []string{"secrets"},
+						},
+					},
+				},
+
 				ClientConfig: admissionregistrationv1.WebhookClientConfig{
 					Service: &admissionregistrationv1.ServiceReference{
 						Namespace: namespace,
@@ -246,7 +319,7 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 			Kind:       "ValidatingWebhookConfiguration",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: validatingWebhookConfigurationName,
+			Name: ValidatingWebhookConfigurationName,
 			Labels: map[string]string{
 				util.MaroonedPodsLabel: MaroonedPodsServerServiceName,
 			},
@@ -268,7 +341,7 @@ func createGatingValidatingWebhook(namespace string, c client.Client, l logr.Log
 
 func getAPIServerCABundle(namespace string, c client.Client, l logr.Logger) []byte {
 	cm := &corev1.ConfigMap{}
-	key := client.ObjectKey{Namespace: namespace, Name: "maroonedpods-server-signer-bundle"}
+	key := client.ObjectKey{Namespace: namespace, Name: util.SignerBundleResourceName}
 	if err := c.Get(context.TODO(), key, cm); err != nil {
 		l.Error(err, "error getting gater ca bundle")
 		return nil
@@ -276,6 +349,10 @@ func getAPIServerCABundle(namespace string, c client.Client, l logr.Logger) []by
 	if cert, ok := cm.Data["ca-bundle.crt"]; ok {
 		return []byte(cert)
 	}
+	// injected by service-ca when it issues the serving certificates
+	if cert, ok := cm.Data["service-ca.crt"]; ok {
+		return []byte(cert)
+	}
 	l.V(2).Info("CA bundle missing")
 	return nil
 }
@@ -8,7 +8,11 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	utils2 "maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -18,7 +22,7 @@ func createMaroonedPodsControllerResources(args *FactoryArgs) []client.Object {
 		createMaroonedPodsControllerServiceAccount(),
 		createControllerRoleBinding(),
 		createControllerRole(),
-		createMaroonedPodsControllerDeployment(args.ControllerImage, args.Verbosity, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.InfraNodePlacement),
+		withTrustBundle(createMaroonedPodsControllerDeployment(args.ControllerImage, args.Verbosity, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.InfraNodePlacement, args.TLSProfile, args.ControllerResources, args.FeatureGates), args.ProxyTrust),
 	}
 }
 func createControllerRoleBinding() *rbacv1.RoleBinding {
@@ -92,7 +96,7 @@ func createMaroonedPodsControllerServiceAccount() *corev1.ServiceAccount {
 	return utils2.ResourceBuilder.CreateServiceAccount(utils2.ControllerResourceName)
 }
 
-func createMaroonedPodsControllerDeployment(image, verbosity, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, infraNodePlacement *sdkapi.NodePlacement) *appsv1.Deployment {
+func createMaroonedPodsControllerDeployment(image, verbosity, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, infraNodePlacement *sdkapi.NodePlacement, tlsProfile *v1alpha1.TLSProfileSpec, resources *corev1.ResourceRequirements, featureGates featuregate.Gates) *appsv1.Deployment {
 	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
 	deployment := utils2.CreateDeployment(utils2.ControllerResourceName, utils2.MaroonedPodsLabel, utils2.ControllerResourceName, utils2.ControllerResourceName, imagePullSecrets, 2, infraNodePlacement)
 	if priorityClassName != "" {
@@ -127,6 +131,9 @@ func createMaroonedPodsControllerDeployment(image, verbosity, pullPolicy string,
 			},
 		},
 	}
+	// a profile change rolls the pods, the listeners read it at start
+	container.Env = append(container.Env, tlsprofile.EnvVars(tlsProfile)...)
+	container.Env = append(container.Env, featuregate.EnvVars(featureGates)...)
 	container.ReadinessProbe = &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
@@ -147,27 +154,35 @@ func createMaroonedPodsControllerDeployment(image, verbosity, pullPolicy string,
 			corev1.ResourceMemory: resource.MustParse("150Mi"),
 		},
 	}
+	if resources != nil {
+		container.Resources = *resources.DeepCopy()
+	}
+	metricsVolume, metricsMount := mpcerts.MetricsCertVolume(mpcerts.ControllerMetricsCertSecretName)
+	container.VolumeMounts = append(container.VolumeMounts, metricsMount)
 	deployment.Spec.Template.Spec.Containers = []corev1.Container{container}
+	serverCert := mpcerts.ServerCertificateDefinition()
+	certFile, keyFile := serverCert.TargetFiles()
 	deployment.Spec.Template.Spec.Volumes = []corev1.Volume{
 		{
 			Name: "server-cert",
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					SecretName: utils2.SecretResourceName,
+					SecretName: serverCert.TargetSecret.Name,
 					Items: []corev1.KeyToPath{
 						{
-							Key:  "tls.crt",
-							Path: "tls.crt",
+							Key:  certFile,
+							Path: certFile,
 						},
 						{
-							Key:  "tls.key",
-							Path: "tls.key",
+							Key:  keyFile,
+							Path: keyFile,
 						},
 					},
 					DefaultMode: &defaultMode,
 				},
 			},
 		},
+		metricsVolume,
 	}
 	if infraNodePlacement == nil {
 		deployment.Spec.Template.Spec.Affinity = &corev1.Affinity{
@@ -194,5 +209,10 @@ func createMaroonedPodsControllerPorts() []corev1.ContainerPort {
 			ContainerPort: 8443,
 			Protocol:      "TCP",
 		},
+		{
+			Name:          controllerMetricsPortName,
+			ContainerPort: utils2.ControllerMetricsPort,
+			Protocol:      "TCP",
+		},
 	}
 }
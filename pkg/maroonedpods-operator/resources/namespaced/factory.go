@@ -2,11 +2,16 @@ package namespaced
 
 import (
 	"fmt"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 	utils "kubevirt.io/controller-lifecycle-operator-sdk/pkg/sdk/resources"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 )
 
 // FactoryArgs contains the required parameters to generate all namespaced resources
@@ -21,6 +26,26 @@ type FactoryArgs struct {
 	PriorityClassName       string
 	Namespace               string
 	InfraNodePlacement      *sdkapi.NodePlacement
+	// set when the monitoring.coreos.com API is served by the cluster
+	MonitoringAvailable bool
+	// the labels of the CR the Prometheus selects the ServiceMonitor with
+	ServiceMonitorLabels map[string]string
+	// set when service-ca issues the serving certificate of the server, the ServiceMonitor reads its CA
+	ServiceCA bool
+	// the TLS version and ciphers of the CR, nil keeps the defaults of the listeners
+	TLSProfile *v1alpha1.TLSProfileSpec
+	// the NetworkPolicy configuration of the CR, nil or disabled creates none
+	NetworkPolicy *v1alpha1.NetworkPolicyConfig
+	// the resources of the controller and the server containers, nil keeps the default requests
+	ControllerResources *corev1.ResourceRequirements
+	ServerResources     *corev1.ResourceRequirements
+	// the replica count of the server, nil keeps DefaultServerReplicas
+	ServerReplicas *int32
+	// the feature gates of the CR, rendered on the controller and the server
+	FeatureGates featuregate.Gates
+	// set when the certConfig of the CR combines the CA bundle with the CAs of the cluster-wide proxy,
+	// the controller and the server mount the trust bundle
+	ProxyTrust bool
 }
 
 type factoryFunc func(*FactoryArgs) []client.Object
@@ -33,6 +58,7 @@ type namespaceHaver interface {
 var factoryFunctions = map[string]factoryFunc{
 	"maroonedpodsServer":  createMaroonedPodsServerResources,
 	"controller": createMaroonedPodsControllerResources,
+	"prometheus": createPrometheusResources,
 }
 
 // CreateAllResources creates all namespaced resources
@@ -62,6 +88,21 @@ func CreateResourceGroup(group string, args *FactoryArgs) ([]client.Object, erro
 	return resources, nil
 }
 
+// withTrustBundle mounts the trust bundle into the containers of the deployment when requested
+func withTrustBundle(deployment *appsv1.Deployment, proxyTrust bool) *appsv1.Deployment {
+	if !proxyTrust {
+		return deployment
+	}
+	volume, mount, env := mpcerts.TrustBundleVolume()
+	spec := &deployment.Spec.Template.Spec
+	spec.Volumes = append(spec.Volumes, volume)
+	for i := range spec.Containers {
+		spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, mount)
+		spec.Containers[i].Env = append(spec.Containers[i].Env, env)
+	}
+	return deployment
+}
+
 func assignNamspaceIfMissing(resource client.Object, namespace string) {
 	obj, ok := resource.(namespaceHaver)
 	if !ok {
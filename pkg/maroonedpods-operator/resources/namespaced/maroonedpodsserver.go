@@ -4,10 +4,15 @@ import (
 	"fmt"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	utils2 "maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -15,13 +20,54 @@ import (
 	sdkapi "kubevirt.io/controller-lifecycle-operator-sdk/api"
 )
 
+const (
+	// DefaultServerReplicas is the replica count of the server when the CR sets none
+	DefaultServerReplicas int32 = 2
+	// ServerPodDisruptionBudgetName is the name of the PodDisruptionBudget of the server
+	ServerPodDisruptionBudgetName = "maroonedpods-server"
+)
+
 func createMaroonedPodsServerResources(args *FactoryArgs) []client.Object {
 	return []client.Object{
 		createMaroonedPodsServerRole(),
 		createMaroonedPodsServerRoleBinding(),
 		createMaroonedPodsServerServiceAccount(),
 		createMaroonedPodsServerService(),
-		createMaroonedPodsServerDeployment(args.MaroonedPodsServerImage, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.Verbosity, args.InfraNodePlacement),
+		withTrustBundle(createMaroonedPodsServerDeployment(args.MaroonedPodsServerImage, args.PullPolicy, args.ImagePullSecrets, args.PriorityClassName, args.Verbosity, args.InfraNodePlacement, args.TLSProfile, args.ServerResources, ServerReplicas(args), args.FeatureGates), args.ProxyTrust),
+	}
+}
+
+// ServerReplicas returns the replica count of the server, DefaultServerReplicas unless set
+func ServerReplicas(args *FactoryArgs) int32 {
+	if args.ServerReplicas != nil {
+		return *args.ServerReplicas
+	}
+	return DefaultServerReplicas
+}
+
+// CreateServerPodDisruptionBudget creates the PodDisruptionBudget keeping a server replica available
+// during voluntary disruptions, none when there is a single replica
+func CreateServerPodDisruptionBudget(args *FactoryArgs) *policyv1.PodDisruptionBudget {
+	if ServerReplicas(args) < 2 {
+		return nil
+	}
+	minAvailable := intstr.FromInt(1)
+	return &policyv1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: policyv1.SchemeGroupVersion.String(),
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServerPodDisruptionBudgetName,
+			Namespace: args.Namespace,
+			Labels:    utils2.ResourceBuilder.WithCommonLabels(nil),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{utils2.MaroonedPodsLabel: utils2.MaroonedPodsServerResourceName},
+			},
+		},
 	}
 }
 
@@ -30,10 +76,14 @@ func createMaroonedPodsServerServiceAccount() *corev1.ServiceAccount {
 }
 
 func createMaroonedPodsServerService() *corev1.Service {
-	service := utils2.ResourceBuilder.CreateService("maroonedpods-server", utils2.MaroonedPodsLabel, utils2.MaroonedPodsServerResourceName, nil)
+	// the server metrics are scraped through the webhook port
+	service := utils2.ResourceBuilder.CreateService("maroonedpods-server", utils2.MaroonedPodsLabel, utils2.MaroonedPodsServerResourceName, map[string]string{
+		utils2.PrometheusLabelKey: utils2.PrometheusLabelValue,
+	})
 	service.Spec.Type = corev1.ServiceTypeNodePort
 	service.Spec.Ports = []corev1.ServicePort{
 		{
+			Name: httpsMetricsPortName,
 			Port: 443,
 			TargetPort: intstr.IntOrString{
 				Type:   intstr.Int,
@@ -45,9 +95,9 @@ func createMaroonedPodsServerService() *corev1.Service {
 	return service
 }
 
-func createMaroonedPodsServerDeployment(image, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, verbosity string, infraNodePlacement *sdkapi.NodePlacement) *appsv1.Deployment {
+func createMaroonedPodsServerDeployment(image, pullPolicy string, imagePullSecrets []corev1.LocalObjectReference, priorityClassName string, verbosity string, infraNodePlacement *sdkapi.NodePlacement, tlsProfile *v1alpha1.TLSProfileSpec, resources *corev1.ResourceRequirements, replicas int32, featureGates featuregate.Gates) *appsv1.Deployment {
 	defaultMode := corev1.ConfigMapVolumeSourceDefaultMode
-	deployment := utils2.CreateDeployment(utils2.MaroonedPodsServerResourceName, utils2.MaroonedPodsLabel, utils2.MaroonedPodsServerResourceName, utils2.MaroonedPodsServerResourceName, imagePullSecrets, 2, infraNodePlacement)
+	deployment := utils2.CreateDeployment(utils2.MaroonedPodsServerResourceName, utils2.MaroonedPodsLabel, utils2.MaroonedPodsServerResourceName, utils2.MaroonedPodsServerResourceName, imagePullSecrets, replicas, infraNodePlacement)
 	if priorityClassName != "" {
 		deployment.Spec.Template.Spec.PriorityClassName = priorityClassName
 	}
@@ -85,10 +135,14 @@ func createMaroonedPodsServerDeployment(image, pullPolicy string, imagePullSecre
 			Value: "true",
 		},
 	}
+	// a profile change rolls the pods, the listeners read it at start
+	container.Env = append(container.Env, tlsprofile.EnvVars(tlsProfile)...)
+	container.Env = append(container.Env, featuregate.EnvVars(featureGates)...)
+	// fails on a served certificate that is expired, about to expire or not signed by the current CA bundle
 	container.ReadinessProbe = &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
-				Path: "/healthz",
+				Path: "/readyz",
 				Port: intstr.IntOrString{
 					Type:   intstr.Int,
 					IntVal: 8443,
@@ -108,10 +162,16 @@ func createMaroonedPodsServerDeployment(image, pullPolicy string, imagePullSecre
 			corev1.ResourceMemory: resource.MustParse("50Mi"),
 		},
 	}
+	if resources != nil {
+		container.Resources = *resources.DeepCopy()
+	}
+	// the secret and the files are the ones the cert manager writes for the server definition
+	serverCert := mpcerts.ServerCertificateDefinition()
+	certFile, keyFile := serverCert.TargetFiles()
 	container.VolumeMounts = []corev1.VolumeMount{
 		{
 			Name:      "tls",
-			MountPath: "/etc/admission-webhook/tls",
+			MountPath: mpcerts.ServerCertDir,
 			ReadOnly:  true,
 		},
 	}
@@ -122,13 +182,24 @@ func createMaroonedPodsServerDeployment(image, pullPolicy string, imagePullSecre
 			Name: "tls",
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					SecretName:  utils2.SecretResourceName,
+					SecretName: serverCert.TargetSecret.Name,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  certFile,
+							Path: certFile,
+						},
+						{
+							Key:  keyFile,
+							Path: keyFile,
+						},
+					},
 					DefaultMode: &defaultMode,
 				},
 			},
 		},
 	}
-	if infraNodePlacement == nil {
+	// the replicas are spread across the nodes unless the placement has an affinity of its own
+	if infraNodePlacement == nil || (replicas > 1 && infraNodePlacement.Affinity == nil) {
 		deployment.Spec.Template.Spec.Affinity = &corev1.Affinity{
 			PodAntiAffinity: &corev1.PodAntiAffinity{
 				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
@@ -168,6 +239,7 @@ func createMaroonedPodsServerRole() *rbacv1.Role {
 			},
 			Resources: []string{
 				"secrets",
+				"configmaps",
 			},
 			Verbs: []string{
 				"get",
@@ -0,0 +1,99 @@
+package namespaced
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utils2 "maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// ServerNetworkPolicyName is the name of the NetworkPolicy allowing the ingress to the webhook server
+	ServerNetworkPolicyName = "maroonedpods-server"
+	// ControllerNetworkPolicyName is the name of the NetworkPolicy allowing the egress of the controller
+	ControllerNetworkPolicyName = "maroonedpods-controller"
+
+	webhookPort = 8443
+)
+
+// NetworkPolicyNames returns the names of the NetworkPolicies the operator manages
+func NetworkPolicyNames() []string {
+	return []string{ServerNetworkPolicyName, ControllerNetworkPolicyName}
+}
+
+// CreateNetworkPolicies creates the NetworkPolicies of the components, none unless they are enabled
+func CreateNetworkPolicies(args *FactoryArgs) []*networkingv1.NetworkPolicy {
+	if args.NetworkPolicy == nil || !args.NetworkPolicy.Enabled {
+		return nil
+	}
+	policies := []*networkingv1.NetworkPolicy{
+		createServerNetworkPolicy(args),
+		createControllerNetworkPolicy(),
+	}
+	for _, policy := range policies {
+		policy.Namespace = args.Namespace
+	}
+	return policies
+}
+
+func newNetworkPolicy(name, podName string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: networkingv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: utils2.ResourceBuilder.WithCommonLabels(nil),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{utils2.MaroonedPodsLabel: podName},
+			},
+		},
+	}
+}
+
+func createServerNetworkPolicy(args *FactoryArgs) *networkingv1.NetworkPolicy {
+	policy := newNetworkPolicy(ServerNetworkPolicyName, utils2.MaroonedPodsServerResourceName)
+	policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+
+	rule := networkingv1.NetworkPolicyIngressRule{
+		Ports: []networkingv1.NetworkPolicyPort{tcpPort(webhookPort)},
+	}
+	// no peer allows any source
+	for _, cidr := range args.NetworkPolicy.IngressCIDRs {
+		rule.From = append(rule.From, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	if selector := args.NetworkPolicy.IngressNamespaceSelector; selector != nil {
+		rule.From = append(rule.From, networkingv1.NetworkPolicyPeer{NamespaceSelector: selector.DeepCopy()})
+	}
+	policy.Spec.Ingress = []networkingv1.NetworkPolicyIngressRule{rule}
+	return policy
+}
+
+// createControllerNetworkPolicy allows the controller to reach the apiserver, whose address isn't
+// known up front, on the usual ports and to resolve names
+func createControllerNetworkPolicy() *networkingv1.NetworkPolicy {
+	policy := newNetworkPolicy(ControllerNetworkPolicyName, utils2.ControllerResourceName)
+	policy.Spec.PolicyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}
+
+	udp := corev1.ProtocolUDP
+	dns := intstr.FromInt(53)
+	policy.Spec.Egress = []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(443), tcpPort(6443)},
+		},
+		{
+			Ports: []networkingv1.NetworkPolicyPort{tcpPort(53), {Protocol: &udp, Port: &dns}},
+		},
+	}
+	return policy
+}
+
+func tcpPort(port int) networkingv1.NetworkPolicyPort {
+	tcp := corev1.ProtocolTCP
+	p := intstr.FromInt(port)
+	return networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &p}
+}
@@ -0,0 +1,223 @@
+package namespaced
+
+import (
+	promv1 "github.com/coreos/prometheus-operator/pkg/apis/monitoring/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	utils2 "maroonedpods.io/maroonedpods/pkg/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PrometheusRuleName is the name of the PrometheusRule holding the MaroonedPods alerts
+	PrometheusRuleName = "prometheus-maroonedpods-rules"
+	// ServiceMonitorName is the name of the ServiceMonitor scraping the MaroonedPods components
+	ServiceMonitorName = "service-monitor-maroonedpods"
+	// OperatorMetricsServiceName and ControllerMetricsServiceName are the names of the Services in front of
+	// the metrics of the operator and the controller, the server is scraped through its own Service
+	OperatorMetricsServiceName   = utils2.OperatorMetricsServiceName
+	ControllerMetricsServiceName = utils2.ControllerMetricsServiceName
+
+	// the ports the ServiceMonitor scrapes, each with the CA and the name of its serving certificate
+	metricsPortName           = "metrics"
+	controllerMetricsPortName = "https-metrics"
+	httpsMetricsPortName      = "https"
+
+	// the role letting the Prometheus of OpenShift cluster monitoring discover the targets in the namespace
+	monitoringRoleName          = "maroonedpods-monitoring"
+	clusterMonitoringNamespace  = "openshift-monitoring"
+	clusterMonitoringPrometheus = "prometheus-k8s"
+
+	certExpiringSoonThreshold = "7 * 24 * 3600"
+)
+
+func createPrometheusResources(args *FactoryArgs) []client.Object {
+	// the metrics certificates are issued for the Services, they exist without monitoring too
+	resources := []client.Object{
+		createOperatorMetricsService(),
+		createControllerMetricsService(),
+	}
+	if !args.MonitoringAvailable {
+		return resources
+	}
+	return append(resources,
+		createPrometheusRule(args.Namespace),
+		createServiceMonitor(args.Namespace, args.ServiceMonitorLabels, args.ServiceCA),
+		createMonitoringRole(),
+		createMonitoringRoleBinding(),
+	)
+}
+
+// metricsTLSConfig verifies the serving certificate of the service against the CA bundle of the configmap
+func metricsTLSConfig(namespace, service, bundleConfigMap, bundleKey string) *promv1.TLSConfig {
+	return &promv1.TLSConfig{
+		CA: promv1.SecretOrConfigMap{
+			ConfigMap: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: bundleConfigMap},
+				Key:                  bundleKey,
+			},
+		},
+		ServerName: service + "." + namespace + ".svc",
+	}
+}
+
+func createServiceMonitor(namespace string, selectorLabels map[string]string, serviceCA bool) *promv1.ServiceMonitor {
+	labels := map[string]string{}
+	for k, v := range selectorLabels {
+		labels[k] = v
+	}
+	labels[utils2.PrometheusLabelKey] = utils2.PrometheusLabelValue
+
+	// service-ca injects its CA into the bundle of the server under another key
+	serverBundleKey := mpcerts.CABundleKey
+	if serviceCA {
+		serverBundleKey = mpcerts.ServiceCABundleKey
+	}
+	return &promv1.ServiceMonitor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       promv1.ServiceMonitorsKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ServiceMonitorName,
+			Namespace: namespace,
+			Labels:    utils2.ResourceBuilder.WithCommonLabels(labels),
+		},
+		Spec: promv1.ServiceMonitorSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{utils2.PrometheusLabelKey: utils2.PrometheusLabelValue},
+			},
+			NamespaceSelector: promv1.NamespaceSelector{
+				MatchNames: []string{namespace},
+			},
+			Endpoints: []promv1.Endpoint{
+				{
+					Port:      metricsPortName,
+					Path:      utils2.MetricsPath,
+					Scheme:    "https",
+					TLSConfig: metricsTLSConfig(namespace, OperatorMetricsServiceName, mpcerts.MetricsCABundleConfigMapName, mpcerts.CABundleKey),
+				},
+				{
+					Port:      controllerMetricsPortName,
+					Path:      utils2.MetricsPath,
+					Scheme:    "https",
+					TLSConfig: metricsTLSConfig(namespace, ControllerMetricsServiceName, mpcerts.MetricsCABundleConfigMapName, mpcerts.CABundleKey),
+				},
+				{
+					Port:      httpsMetricsPortName,
+					Path:      utils2.MetricsPath,
+					Scheme:    "https",
+					TLSConfig: metricsTLSConfig(namespace, mpcerts.ServerServiceName, mpcerts.CABundleConfigMapName, serverBundleKey),
+				},
+			},
+		},
+	}
+}
+
+func createOperatorMetricsService() *corev1.Service {
+	service := utils2.ResourceBuilder.CreateService(OperatorMetricsServiceName, "name", "maroonedpods-operator", map[string]string{
+		utils2.PrometheusLabelKey: utils2.PrometheusLabelValue,
+	})
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name:       metricsPortName,
+			Port:       utils2.OperatorMetricsPort,
+			TargetPort: intstr.FromString(metricsPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
+func createControllerMetricsService() *corev1.Service {
+	service := utils2.ResourceBuilder.CreateService(ControllerMetricsServiceName, utils2.MaroonedPodsLabel, utils2.ControllerResourceName, map[string]string{
+		utils2.PrometheusLabelKey: utils2.PrometheusLabelValue,
+	})
+	service.Spec.Ports = []corev1.ServicePort{
+		{
+			Name:       controllerMetricsPortName,
+			Port:       utils2.ControllerMetricsPort,
+			TargetPort: intstr.FromString(controllerMetricsPortName),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+	return service
+}
+
+func createMonitoringRole() *rbacv1.Role {
+	return utils2.ResourceBuilder.CreateRole(monitoringRoleName, []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"services", "endpoints", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+	})
+}
+
+func createMonitoringRoleBinding() *rbacv1.RoleBinding {
+	return utils2.ResourceBuilder.CreateRoleBinding(monitoringRoleName, monitoringRoleName, clusterMonitoringPrometheus, clusterMonitoringNamespace)
+}
+
+func createPrometheusRule(namespace string) *promv1.PrometheusRule {
+	return &promv1.PrometheusRule{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: promv1.SchemeGroupVersion.String(),
+			Kind:       promv1.PrometheusRuleKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      PrometheusRuleName,
+			Namespace: namespace,
+			Labels: utils2.ResourceBuilder.WithCommonLabels(map[string]string{
+				utils2.PrometheusLabelKey: utils2.PrometheusLabelValue,
+			}),
+		},
+		Spec: promv1.PrometheusRuleSpec{
+			Groups: []promv1.RuleGroup{
+				{
+					Name: "maroonedpods.certificates.rules",
+					Rules: []promv1.Rule{
+						{
+							Alert: "MaroonedPodsCertExpiringSoon",
+							Expr:  intstr.FromString("maroonedpods_certificate_expiration_timestamp_seconds - time() < " + certExpiringSoonThreshold),
+							For:   "1h",
+							Annotations: map[string]string{
+								"summary":     "MaroonedPods certificate expires within 7 days",
+								"description": "The certificate in secret {{ $labels.namespace }}/{{ $labels.secret }} expires in less than 7 days.",
+							},
+							Labels: map[string]string{
+								"severity": "warning",
+							},
+						},
+						{
+							Alert: "MaroonedPodsCertRotationStuck",
+							Expr:  intstr.FromString("maroonedpods_certificate_rotation_stuck == 1"),
+							For:   "10m",
+							Annotations: map[string]string{
+								"summary":     "MaroonedPods certificate rotation keeps failing",
+								"description": "The certificate in secret {{ $labels.namespace }}/{{ $labels.secret }} is due for rotation but the rotation keeps failing.",
+							},
+							Labels: map[string]string{
+								"severity": "critical",
+							},
+						},
+						{
+							Alert: "MaroonedPodsCertSyncErrors",
+							Expr:  intstr.FromString("increase(maroonedpods_certificate_sync_errors_total[15m]) > 0"),
+							For:   "15m",
+							Annotations: map[string]string{
+								"summary":     "MaroonedPods certificates fail to sync",
+								"description": "The MaroonedPods operator failed to sync its certificates in the last 15 minutes.",
+							},
+							Labels: map[string]string{
+								"severity": "warning",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -16,7 +16,9 @@ import (
 	rbacv1 "k8s.io/api/rbac/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	"maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cluster"
 )
 
@@ -59,6 +61,7 @@ func getClusterPolicyRules() []rbacv1.PolicyRule {
 				"watch",
 				"delete",
 				"update",
+				"patch",
 			},
 		},
 		{
@@ -100,6 +103,7 @@ func getClusterPolicyRules() []rbacv1.PolicyRule {
 			},
 			Verbs: []string{
 				"update",
+				"patch",
 				"list",
 				"watch",
 				"create",
@@ -107,6 +111,20 @@ func getClusterPolicyRules() []rbacv1.PolicyRule {
 				"delete",
 			},
 		},
+		{
+			APIGroups: []string{
+				"apiregistration.k8s.io",
+			},
+			Resources: []string{
+				"apiservices",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"patch",
+			},
+		},
 		{
 			APIGroups: []string{
 				"scheduling.k8s.io",
@@ -120,6 +138,62 @@ func getClusterPolicyRules() []rbacv1.PolicyRule {
 				"watch",
 			},
 		},
+		{
+			APIGroups: []string{
+				"config.openshift.io",
+			},
+			Resources: []string{
+				"apiservers",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+			},
+		},
+		{
+			APIGroups: []string{
+				"certificates.k8s.io",
+			},
+			Resources: []string{
+				"clustertrustbundles",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"delete",
+				"update",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"namespaces",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+			},
+		},
+		{
+			APIGroups: []string{
+				"",
+			},
+			Resources: []string{
+				"configmaps",
+			},
+			Verbs: []string{
+				"get",
+				"create",
+				"update",
+				"patch",
+				"delete",
+			},
+		},
 	}
 	rules = append(rules, cluster.GetClusterRolePolicyRules()...)
 	return rules
@@ -160,6 +234,7 @@ func getNamespacedPolicyRules() []rbacv1.PolicyRule {
 				"watch",
 				"delete",
 				"update",
+				"patch",
 			},
 		},
 		{
@@ -194,6 +269,7 @@ func getNamespacedPolicyRules() []rbacv1.PolicyRule {
 				"watch",
 				"delete",
 				"update",
+				"patch",
 			},
 		},
 		{
@@ -214,6 +290,78 @@ func getNamespacedPolicyRules() []rbacv1.PolicyRule {
 				"patch",
 			},
 		},
+		{
+			APIGroups: []string{
+				"networking.k8s.io",
+			},
+			Resources: []string{
+				"networkpolicies",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"delete",
+				"update",
+			},
+		},
+		{
+			APIGroups: []string{
+				"networking.k8s.io",
+			},
+			Resources: []string{
+				"ingresses",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+			},
+		},
+		{
+			APIGroups: []string{
+				"route.openshift.io",
+			},
+			Resources: []string{
+				"routes",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+			},
+		},
+		{
+			APIGroups: []string{
+				"policy",
+			},
+			Resources: []string{
+				"poddisruptionbudgets",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"delete",
+				"update",
+			},
+		},
+		{
+			APIGroups: []string{
+				"cert-manager.io",
+			},
+			Resources: []string{
+				"certificates",
+			},
+			Verbs: []string{
+				"get",
+				"list",
+				"watch",
+				"create",
+				"delete",
+				"update",
+			},
+		},
 		{
 			APIGroups: []string{
 				"coordination.k8s.io",
@@ -350,6 +498,20 @@ func createOperatorDeployment(operatorVersion, namespace, deployClusterResources
 		},
 	}
 	container.Env = createOperatorEnvVar(operatorVersion, deployClusterResources, controllerImage, webhookServerImage, verbosity, pullPolicy)
+	metricsVolume, metricsMount := mpcerts.MetricsCertVolume(mpcerts.OperatorMetricsCertSecretName)
+	container.VolumeMounts = []corev1.VolumeMount{metricsMount}
+	deployment.Spec.Template.Spec.Volumes = []corev1.Volume{metricsVolume}
+	// not ready until the server has a serving certificate
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Port: intstr.FromInt(utils2.OperatorHealthProbePort),
+				Path: "/readyz",
+			},
+		},
+		InitialDelaySeconds: 5,
+		PeriodSeconds:       10,
+	}
 	deployment.Spec.Template.Spec.Containers = []corev1.Container{container}
 	return deployment
 }
@@ -358,7 +520,7 @@ func createPrometheusPorts() []corev1.ContainerPort {
 	return []corev1.ContainerPort{
 		{
 			Name:          "metrics",
-			ContainerPort: 8080,
+			ContainerPort: utils2.OperatorMetricsPort,
 			Protocol:      "TCP",
 		},
 	}
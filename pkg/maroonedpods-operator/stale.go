@@ -0,0 +1,63 @@
+package maroonedpods_operator
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// operatorManagedBy is the managed-by label value of the objects the operator creates
+const operatorManagedBy = "maroonedpods-operator"
+
+// staleResource is an object a previous release created that the current one doesn't manage anymore
+type staleResource struct {
+	newObject func() client.Object
+	// namespaced objects are looked up in the operator namespace
+	namespaced bool
+	name       string
+}
+
+// staleResources lists the objects of previous releases, a rename adds the old name here. They
+// are deleted as long as they carry the managed-by label of the operator.
+var staleResources = []staleResource{
+	// renamed with the maroonpods rename
+	{newObject: func() client.Object { return &corev1.Service{} }, namespaced: true, name: "maroonpods-server"},
+	{newObject: func() client.Object { return &corev1.ConfigMap{} }, namespaced: true, name: "maroonpods-server-signer-bundle"},
+}
+
+// deleteStaleResources deletes the objects of previous releases that are still around, an object of
+// the same name the operator didn't create is left alone
+func (r *ReconcileMaroonedPods) deleteStaleResources(mp *v1alpha1.MaroonedPods) error {
+	for _, stale := range staleResources {
+		key := types.NamespacedName{Name: stale.name}
+		if stale.namespaced {
+			key.Namespace = r.namespace
+		}
+
+		obj := stale.newObject()
+		if err := r.client.Get(context.TODO(), key, obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if obj.GetLabels()[util.AppKubernetesManagedByLabel] != operatorManagedBy {
+			continue
+		}
+
+		kind := fmt.Sprintf("%T", obj)
+		log.Info("Deleting stale resource", "type", kind, "namespace", key.Namespace, "name", key.Name)
+		if err := r.client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		r.recorder.Event(mp, corev1.EventTypeNormal, "StaleResourceDeleted", fmt.Sprintf("Deleted %s %s left behind by a previous version", kind, key))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("stale resources tests", func() {
+	const namespace = "maroonedpods"
+
+	managed := map[string]string{util.AppKubernetesManagedByLabel: operatorManagedBy}
+	mp := &v1alpha1.MaroonedPods{ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"}}
+
+	var recorder *record.FakeRecorder
+
+	newReconciler := func(objs ...client.Object) *ReconcileMaroonedPods {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		recorder = record.NewFakeRecorder(10)
+		return &ReconcileMaroonedPods{
+			client:    crfake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+			scheme:    s,
+			recorder:  recorder,
+			namespace: namespace,
+		}
+	}
+
+	exists := func(r *ReconcileMaroonedPods, obj client.Object) bool {
+		err := r.client.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj)
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).ToNot(HaveOccurred())
+		return true
+	}
+
+	It("should delete the labeled objects of previous versions", func() {
+		staleService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "maroonpods-server", Labels: managed}}
+		staleBundle := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "maroonpods-server-signer-bundle", Labels: managed}}
+		current := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.MaroonedPodsServerResourceName, Labels: managed}}
+		otherNamespace := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "maroonpods-server", Labels: managed}}
+		r := newReconciler(staleService, staleBundle, current, otherNamespace)
+
+		Expect(r.deleteStaleResources(mp)).To(Succeed())
+
+		Expect(exists(r, staleService)).To(BeFalse())
+		Expect(exists(r, staleBundle)).To(BeFalse())
+		Expect(exists(r, current)).To(BeTrue())
+		Expect(exists(r, otherNamespace)).To(BeTrue())
+		Expect(recorder.Events).To(HaveLen(2))
+		Expect(<-recorder.Events).To(ContainSubstring("StaleResourceDeleted"))
+	})
+
+	It("should leave an object of a stale name it didn't create alone", func() {
+		decoy := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "maroonpods-server"}}
+		foreign := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "maroonpods-server-signer-bundle",
+			Labels:    map[string]string{util.AppKubernetesManagedByLabel: "helm"},
+		}}
+		r := newReconciler(decoy, foreign)
+
+		Expect(r.deleteStaleResources(mp)).To(Succeed())
+
+		Expect(exists(r, decoy)).To(BeTrue())
+		Expect(exists(r, foreign)).To(BeTrue())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("should do nothing without stale objects", func() {
+		r := newReconciler()
+		Expect(r.deleteStaleResources(mp)).To(Succeed())
+		Expect(recorder.Events).To(BeEmpty())
+	})
+})
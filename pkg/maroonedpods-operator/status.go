@@ -0,0 +1,57 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// updateStatusSummary sets the phase derived from the conditions the reconcile left, and the generation
+// and the feature gates of the reconciled CR if the reconcile succeeded. The CR is read again, the sdk
+// updates the status on its own copy.
+func (r *ReconcileMaroonedPods) updateStatusSummary(reconciled *v1alpha1.MaroonedPods, succeeded bool) error {
+	mp := &v1alpha1.MaroonedPods{}
+	if err := r.client.Get(context.TODO(), client.ObjectKeyFromObject(reconciled), mp); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	status := mp.Status.DeepCopy()
+	status.DeploymentPhase = deploymentPhase(mp)
+	// a newer generation may have been reconciled since the CR was read
+	if succeeded && reconciled.Generation > status.ObservedGeneration {
+		status.ObservedGeneration = reconciled.Generation
+		// the reconcile fails on unknown gates
+		gates, _ := featuregate.New(reconciled.Spec.FeatureGates)
+		status.FeatureGates = gates.List()
+	}
+	if equality.Semantic.DeepEqual(*status, mp.Status) {
+		return nil
+	}
+
+	mp.Status = *status
+	return r.client.Status().Update(context.TODO(), mp)
+}
+
+func deploymentPhase(mp *v1alpha1.MaroonedPods) v1alpha1.MaroonedPodsPhase {
+	switch {
+	case mp.DeletionTimestamp != nil:
+		return v1alpha1.MaroonedPodsPhaseDeleting
+	case conditions.IsStatusConditionTrue(mp.Status.Conditions, conditions.ConditionDegraded),
+		conditions.IsStatusConditionTrue(mp.Status.Conditions, conditionCertificatesDegraded),
+		conditions.IsStatusConditionTrue(mp.Status.Conditions, conditionCertCanaryDegraded):
+		return v1alpha1.MaroonedPodsPhaseDegraded
+	case conditions.IsStatusConditionTrue(mp.Status.Conditions, conditions.ConditionAvailable) &&
+		!conditions.IsStatusConditionTrue(mp.Status.Conditions, conditions.ConditionProgressing):
+		return v1alpha1.MaroonedPodsPhaseDeployed
+	}
+	return v1alpha1.MaroonedPodsPhaseDeploying
+}
@@ -0,0 +1,142 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	conditions "github.com/openshift/custom-resource-status/conditions/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("status summary tests", func() {
+	key := client.ObjectKey{Name: "maroonedpods"}
+
+	var (
+		crClient client.Client
+		r        *ReconcileMaroonedPods
+	)
+
+	get := func() *v1alpha1.MaroonedPods {
+		mp := &v1alpha1.MaroonedPods{}
+		Expect(crClient.Get(context.TODO(), key, mp)).To(Succeed())
+		return mp
+	}
+
+	// setConditions stands in for the sdk reconcile, which updates the conditions on its own copy
+	setConditions := func(available, progressing, degraded corev1.ConditionStatus) {
+		mp := get()
+		for conditionType, status := range map[conditions.ConditionType]corev1.ConditionStatus{
+			conditions.ConditionAvailable:   available,
+			conditions.ConditionProgressing: progressing,
+			conditions.ConditionDegraded:    degraded,
+		} {
+			conditions.SetStatusCondition(&mp.Status.Conditions, conditions.Condition{Type: conditionType, Status: status})
+		}
+		Expect(crClient.Status().Update(context.TODO(), mp)).To(Succeed())
+	}
+
+	changeSpec := func() int64 {
+		mp := get()
+		mp.Generation++
+		mp.Spec.ServerReplicas = &[]int32{int32(mp.Generation)}[0]
+		Expect(crClient.Update(context.TODO(), mp)).To(Succeed())
+		return mp.Generation
+	}
+
+	summarize := func(generation int64, succeeded bool) error {
+		reconciled := get()
+		reconciled.Generation = generation
+		return r.updateStatusSummary(reconciled, succeeded)
+	}
+
+	expectStatus := func(phase v1alpha1.MaroonedPodsPhase, observedGeneration int64) {
+		mp := get()
+		ExpectWithOffset(1, mp.Status.DeploymentPhase).To(Equal(phase))
+		ExpectWithOffset(1, mp.Status.ObservedGeneration).To(Equal(observedGeneration))
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		crClient = crfake.NewClientBuilder().WithScheme(scheme).WithObjects(&v1alpha1.MaroonedPods{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Generation: 1},
+		}).Build()
+		r = &ReconcileMaroonedPods{client: crClient, scheme: scheme}
+	})
+
+	It("should follow a deployment, a failed spec change and the recovery", func() {
+		setConditions(corev1.ConditionFalse, corev1.ConditionTrue, corev1.ConditionFalse)
+		Expect(summarize(1, true)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDeploying, 1)
+
+		setConditions(corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionFalse)
+		Expect(summarize(1, true)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDeployed, 1)
+
+		// e.g. the certificates failed to sync while the deployments are fine
+		generation := changeSpec()
+		setConditions(corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionTrue)
+		Expect(summarize(generation, false)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDegraded, 1)
+
+		setConditions(corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionFalse)
+		Expect(summarize(generation, true)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDeployed, generation)
+	})
+
+	It("should report the feature gates of a successful reconcile", func() {
+		mp := get()
+		mp.Generation = 2
+		mp.Spec.FeatureGates = []string{featuregate.StrictTargetService}
+		Expect(crClient.Update(context.TODO(), mp)).To(Succeed())
+
+		Expect(summarize(2, false)).To(Succeed())
+		Expect(get().Status.FeatureGates).To(BeEmpty())
+
+		Expect(summarize(2, true)).To(Succeed())
+		Expect(get().Status.FeatureGates).To(Equal([]string{featuregate.StrictTargetService}))
+	})
+
+	It("should not update an unchanged status", func() {
+		setConditions(corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionFalse)
+		Expect(summarize(1, true)).To(Succeed())
+		resourceVersion := get().ResourceVersion
+
+		Expect(summarize(1, true)).To(Succeed())
+		Expect(get().ResourceVersion).To(Equal(resourceVersion))
+	})
+
+	It("should not go back to the generation of a stale reconcile", func() {
+		generation := changeSpec()
+		Expect(summarize(generation, true)).To(Succeed())
+		Expect(summarize(generation-1, true)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDeploying, generation)
+	})
+
+	It("should report the deletion", func() {
+		mp := get()
+		mp.Finalizers = []string{"test"}
+		Expect(crClient.Update(context.TODO(), mp)).To(Succeed())
+		Expect(crClient.Delete(context.TODO(), mp)).To(Succeed())
+
+		Expect(summarize(1, false)).To(Succeed())
+		expectStatus(v1alpha1.MaroonedPodsPhaseDeleting, 0)
+	})
+
+	It("should ignore a deleted CR", func() {
+		reconciled := get()
+		Expect(crClient.Delete(context.TODO(), reconciled)).To(Succeed())
+		Expect(r.updateStatusSummary(reconciled, true)).To(Succeed())
+	})
+})
@@ -0,0 +1,102 @@
+package maroonedpods_operator
+
+import (
+	"context"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+// clusterAPIServerName is the name of the singleton OpenShift APIServer config holding the cluster TLS policy
+const clusterAPIServerName = "cluster"
+
+var apiServerGVK = configv1.GroupVersion.WithKind("APIServer")
+
+// tlsSecurityProfile returns the profile the listeners serve: the one of the CR, else the one of the
+// OpenShift apiservers/cluster, else nil for the built-in default
+func tlsSecurityProfile(c client.Client, cr *mpv1.MaroonedPods) (*mpv1.TLSSecurityProfile, error) {
+	if cr.Spec.TLSSecurityProfile != nil {
+		return cr.Spec.TLSSecurityProfile, nil
+	}
+	return clusterTLSSecurityProfile(c)
+}
+
+// clusterTLSSecurityProfile returns the profile of apiservers/cluster, nil on clusters without the
+// config.openshift.io API or without a profile set
+func clusterTLSSecurityProfile(c client.Client) (*mpv1.TLSSecurityProfile, error) {
+	available, err := util.IsKindAvailable(c.RESTMapper(), apiServerGVK)
+	if err != nil || !available {
+		return nil, err
+	}
+
+	apiServer := &configv1.APIServer{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: clusterAPIServerName}, apiServer); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return convertTLSSecurityProfile(apiServer.Spec.TLSSecurityProfile), nil
+}
+
+func convertTLSSecurityProfile(in *configv1.TLSSecurityProfile) *mpv1.TLSSecurityProfile {
+	if in == nil {
+		return nil
+	}
+	out := &mpv1.TLSSecurityProfile{Type: mpv1.TLSProfileType(in.Type)}
+	switch in.Type {
+	case configv1.TLSProfileOldType:
+		out.Old = &mpv1.OldTLSProfile{}
+	case configv1.TLSProfileIntermediateType:
+		out.Intermediate = &mpv1.IntermediateTLSProfile{}
+	case configv1.TLSProfileModernType:
+		out.Modern = &mpv1.ModernTLSProfile{}
+	case configv1.TLSProfileCustomType:
+		if in.Custom != nil {
+			out.Custom = &mpv1.CustomTLSProfile{
+				TLSProfileSpec: mpv1.TLSProfileSpec{
+					Ciphers:       append([]string(nil), in.Custom.Ciphers...),
+					MinTLSVersion: mpv1.TLSProtocolVersion(in.Custom.MinTLSVersion),
+				},
+			}
+		}
+	}
+	return out
+}
+
+// watchClusterAPIServer reconciles the CR on changes of apiservers/cluster, so a cluster TLS policy
+// update reaches the listeners without an operator restart
+func (r *ReconcileMaroonedPods) watchClusterAPIServer() error {
+	available, err := util.IsKindAvailable(r.client.RESTMapper(), apiServerGVK)
+	if err != nil || !available {
+		return err
+	}
+
+	return r.controller.Watch(&source.Kind{Type: &configv1.APIServer{}}, handler.EnqueueRequestsFromMapFunc(
+		func(obj client.Object) []reconcile.Request {
+			if obj.GetName() != clusterAPIServerName {
+				return nil
+			}
+			cr, err := util.GetActiveMaroonedPods(r.client)
+			if err != nil || cr == nil {
+				return nil
+			}
+			return []reconcile.Request{
+				{
+					NamespacedName: types.NamespacedName{
+						Namespace: "",
+						Name:      cr.Name,
+					},
+				},
+			}
+		},
+	))
+}
@@ -0,0 +1,103 @@
+package maroonedpods_operator
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
+	mpv1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("TLS security profile tests", func() {
+	newClient := func(withOpenShift bool, objs ...client.Object) client.Client {
+		s := runtime.NewScheme()
+		Expect(configv1.AddToScheme(s)).To(Succeed())
+		mapper := meta.NewDefaultRESTMapper(nil)
+		if withOpenShift {
+			mapper.Add(apiServerGVK, meta.RESTScopeRoot)
+		}
+		return crfake.NewClientBuilder().WithScheme(s).WithRESTMapper(mapper).WithObjects(objs...).Build()
+	}
+
+	newAPIServer := func(profile *configv1.TLSSecurityProfile) *configv1.APIServer {
+		return &configv1.APIServer{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterAPIServerName},
+			Spec:       configv1.APIServerSpec{TLSSecurityProfile: profile},
+		}
+	}
+
+	newCR := func(profile *mpv1.TLSSecurityProfile) *mpv1.MaroonedPods {
+		return &mpv1.MaroonedPods{Spec: mpv1.MaroonedPodsSpec{TLSSecurityProfile: profile}}
+	}
+
+	modern := &configv1.TLSSecurityProfile{Type: configv1.TLSProfileModernType, Modern: &configv1.ModernTLSProfile{}}
+
+	It("should prefer the profile of the CR over the cluster one", func() {
+		old := &mpv1.TLSSecurityProfile{Type: mpv1.TLSProfileOldType}
+		c := newClient(true, newAPIServer(modern))
+
+		profile, err := tlsSecurityProfile(c, newCR(old))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile).To(Equal(old))
+	})
+
+	It("should inherit the cluster profile when the CR has none", func() {
+		c := newClient(true, newAPIServer(modern))
+
+		profile, err := tlsSecurityProfile(c, newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile.Type).To(Equal(mpv1.TLSProfileModernType))
+
+		spec, err := tlsprofile.Spec(profile)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.MinTLSVersion).To(Equal(mpv1.VersionTLS13))
+	})
+
+	It("should inherit a custom cluster profile", func() {
+		c := newClient(true, newAPIServer(&configv1.TLSSecurityProfile{
+			Type: configv1.TLSProfileCustomType,
+			Custom: &configv1.CustomTLSProfile{
+				TLSProfileSpec: configv1.TLSProfileSpec{
+					Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+					MinTLSVersion: configv1.VersionTLS11,
+				},
+			},
+		}))
+
+		profile, err := tlsSecurityProfile(c, newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile.Custom).ToNot(BeNil())
+		Expect(profile.Custom.Ciphers).To(Equal([]string{"ECDHE-RSA-AES128-GCM-SHA256"}))
+		Expect(profile.Custom.MinTLSVersion).To(Equal(mpv1.VersionTLS11))
+	})
+
+	It("should keep the default when the cluster sets no profile", func() {
+		c := newClient(true, newAPIServer(nil))
+
+		profile, err := tlsSecurityProfile(c, newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile).To(BeNil())
+	})
+
+	It("should keep the default when apiservers/cluster doesn't exist", func() {
+		profile, err := tlsSecurityProfile(newClient(true), newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile).To(BeNil())
+	})
+
+	It("should keep the default without the OpenShift config API", func() {
+		// the object would be served by the fake client, the missing mapping alone must skip it
+		c := newClient(false, newAPIServer(modern))
+
+		profile, err := tlsSecurityProfile(c, newCR(nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(profile).To(BeNil())
+	})
+})
@@ -0,0 +1,95 @@
+package maroonedpods_server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	readyzPath = "/readyz"
+	// DefaultCertExpiryThreshold is how long before its expiry the served certificate fails the readiness
+	DefaultCertExpiryThreshold = time.Hour
+)
+
+// CertSource is where the TLS listener gets its certificate from, satisfied by the CertWatcher
+type CertSource interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	CAPool() (*x509.CertPool, error)
+}
+
+// CertHealthHandler fails when the certificate the listener serves is expired, about to expire or
+// doesn't chain to the current CA bundle, so a pod that missed a reload stops receiving requests
+type CertHealthHandler struct {
+	source    CertSource
+	threshold time.Duration
+	now       func() time.Time
+}
+
+// NewCertHealthHandler returns a handler checking the certificate of the source, a threshold of 0
+// defaults to DefaultCertExpiryThreshold
+func NewCertHealthHandler(source CertSource, threshold time.Duration) *CertHealthHandler {
+	if threshold == 0 {
+		threshold = DefaultCertExpiryThreshold
+	}
+	return &CertHealthHandler{source: source, threshold: threshold, now: time.Now}
+}
+
+func (h *CertHealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.check(); err != nil {
+		klog.Errorf("Certificate health check failed: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if _, err := io.WriteString(w, "OK"); err != nil {
+		klog.Errorf("CertHealthHandler: failed to send response; %v", err)
+	}
+}
+
+func (h *CertHealthHandler) check() error {
+	crt, err := h.source.GetCertificate(nil)
+	if err != nil {
+		return err
+	}
+	leaf := crt.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(crt.Certificate[0]); err != nil {
+			return fmt.Errorf("failed to parse the served certificate: %v", err)
+		}
+	}
+
+	now := h.now()
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("the served certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if now.Add(h.threshold).After(leaf.NotAfter) {
+		return fmt.Errorf("the served certificate expires at %s, within %s", leaf.NotAfter.UTC().Format(time.RFC3339), h.threshold)
+	}
+
+	roots, err := h.source.CAPool()
+	if err != nil {
+		return err
+	}
+	intermediates := x509.NewCertPool()
+	for _, der := range crt.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("failed to parse the served chain: %v", err)
+		}
+		intermediates.AddCert(c)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("the served certificate doesn't chain to the CA bundle: %v", err)
+	}
+	return nil
+}
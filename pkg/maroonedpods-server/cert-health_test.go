@@ -0,0 +1,194 @@
+package maroonedpods_server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple"
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/certwatcher"
+)
+
+// fakeCertSource serves whatever the test loaded into it
+type fakeCertSource struct {
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+func (f *fakeCertSource) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if f.cert == nil {
+		return nil, errors.New("no certificate")
+	}
+	return f.cert, nil
+}
+
+func (f *fakeCertSource) CAPool() (*x509.CertPool, error) {
+	if f.pool == nil {
+		return nil, errors.New("no CA bundle")
+	}
+	return f.pool, nil
+}
+
+var _ = Describe("certificate health", func() {
+	var (
+		ca     *triple.KeyPair
+		source *fakeCertSource
+	)
+
+	newKeyPair := func(ca *triple.KeyPair, duration time.Duration) *triple.KeyPair {
+		keyPair, err := triple.NewServerKeyPair(ca, "maroonedpods-server", "maroonedpods-server", "maroonedpods", "cluster.local", nil, nil, duration)
+		Expect(err).ToNot(HaveOccurred())
+		return keyPair
+	}
+
+	newCert := func(ca *triple.KeyPair, duration time.Duration) *tls.Certificate {
+		keyPair := newKeyPair(ca, duration)
+		crt, err := tls.X509KeyPair(cert.EncodeCertPEM(keyPair.Cert), cert.EncodePrivateKeyPEM(keyPair.Key))
+		Expect(err).ToNot(HaveOccurred())
+		crt.Leaf = keyPair.Cert
+		return &crt
+	}
+
+	newPool := func(cas ...*triple.KeyPair) *x509.CertPool {
+		pool := x509.NewCertPool()
+		for _, ca := range cas {
+			pool.AddCert(ca.Cert)
+		}
+		return pool
+	}
+
+	probe := func(handler http.Handler) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, readyzPath, nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	status := func(handler http.Handler) int {
+		code, _ := probe(handler)
+		return code
+	}
+
+	BeforeEach(func() {
+		var err error
+		ca, err = triple.NewCA("maroonedpods-server-signer", 24*time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		source = &fakeCertSource{cert: newCert(ca, 12*time.Hour), pool: newPool(ca)}
+	})
+
+	It("should succeed on a valid certificate", func() {
+		code, body := probe(NewCertHealthHandler(source, 0))
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("OK"))
+	})
+
+	It("should fail when the loaded certificate is flipped to an expired one", func() {
+		handler := NewCertHealthHandler(source, 0)
+		Expect(status(handler)).To(Equal(http.StatusOK))
+
+		source.cert = newCert(ca, -time.Minute)
+
+		code, body := probe(handler)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(ContainSubstring("expired"))
+	})
+
+	It("should fail when the certificate expires within the threshold", func() {
+		source.cert = newCert(ca, 30*time.Minute)
+
+		code, body := probe(NewCertHealthHandler(source, 0))
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(ContainSubstring("within 1h0m0s"))
+
+		// a lower threshold accepts it
+		code, _ = probe(NewCertHealthHandler(source, 10*time.Minute))
+		Expect(code).To(Equal(http.StatusOK))
+	})
+
+	It("should fail once the clock reaches the threshold", func() {
+		handler := NewCertHealthHandler(source, time.Hour)
+		Expect(status(handler)).To(Equal(http.StatusOK))
+
+		handler.now = func() time.Time { return source.cert.Leaf.NotAfter.Add(-59 * time.Minute) }
+
+		Expect(status(handler)).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should fail when the certificate doesn't chain to the CA bundle", func() {
+		other, err := triple.NewCA("maroonedpods-server-signer", 24*time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		source.pool = newPool(other)
+
+		code, body := probe(NewCertHealthHandler(source, 0))
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(ContainSubstring("doesn't chain to the CA bundle"))
+
+		// the bundle of a rotation carries both CAs
+		source.pool = newPool(other, ca)
+		Expect(status(NewCertHealthHandler(source, 0))).To(Equal(http.StatusOK))
+	})
+
+	It("should fail without a certificate or a CA bundle", func() {
+		source.pool = nil
+		Expect(status(NewCertHealthHandler(source, 0))).To(Equal(http.StatusServiceUnavailable))
+
+		source.cert = nil
+		Expect(status(NewCertHealthHandler(source, 0))).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("should check the certificate the CertWatcher serves", func() {
+		const namespace = "maroonedpods"
+		keyPair := newKeyPair(ca, 12*time.Hour)
+		client := fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.SecretResourceName},
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       cert.EncodeCertPEM(keyPair.Cert),
+					corev1.TLSPrivateKeyKey: cert.EncodePrivateKeyPEM(keyPair.Key),
+				},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.SignerBundleResourceName},
+				Data:       map[string]string{"ca-bundle.crt": string(cert.EncodeCertPEM(ca.Cert))},
+			},
+		)
+		watcher := certwatcher.New(client, certwatcher.Options{
+			Namespace:           namespace,
+			SecretName:          util.SecretResourceName,
+			BundleConfigMapName: util.SignerBundleResourceName,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			defer GinkgoRecover()
+			Expect(watcher.Start(ctx)).To(Succeed())
+		}()
+		handler := NewCertHealthHandler(watcher, 0)
+
+		Eventually(status).WithArguments(handler).Should(Equal(http.StatusOK))
+
+		// the bundle moves on to a CA that didn't sign the served certificate
+		other, err := triple.NewCA("maroonedpods-server-signer", 24*time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: util.SignerBundleResourceName, ResourceVersion: "2"},
+			Data:       map[string]string{"ca-bundle.crt": string(cert.EncodeCertPEM(other.Cert))},
+		}, metav1.UpdateOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(status).WithArguments(handler).Should(Equal(http.StatusServiceUnavailable))
+	})
+})
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+)
+
+// certDurationFields are the fields of a CertConfig holding a metav1.Duration
+var certDurationFields = []string{"duration", "renewBefore", "backdate"}
+
+type jsonPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// normalizeCertDurations rewrites the durations of the certConfig of the raw MaroonedPods that use the d
+// or y units to Go syntax, the only one metav1.Duration parses. It returns the normalized object and the
+// JSON patch making the same changes, no patch if every duration was in Go syntax already.
+func normalizeCertDurations(raw []byte) ([]byte, []byte, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, nil, err
+	}
+	spec, _ := obj["spec"].(map[string]interface{})
+	certConfig, _ := spec["certConfig"].(map[string]interface{})
+	if certConfig == nil {
+		return raw, nil, nil
+	}
+
+	var patch []jsonPatchOperation
+	normalize := func(field, path string, config interface{}) error {
+		stanza, _ := config.(map[string]interface{})
+		for _, name := range certDurationFields {
+			value, ok := stanza[name].(string)
+			if !ok {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err == nil {
+				continue
+			}
+			d, err := mpcerts.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid certConfig.%s.%s: %w", field, name, err)
+			}
+			stanza[name] = mpcerts.FormatDuration(d)
+			patch = append(patch, jsonPatchOperation{Op: "replace", Path: path + "/" + name, Value: mpcerts.FormatDuration(d)})
+		}
+		return nil
+	}
+
+	for _, field := range []string{"ca", "server"} {
+		if err := normalize(field, "/spec/certConfig/"+field, certConfig[field]); err != nil {
+			return nil, nil, err
+		}
+	}
+	overrides, _ := certConfig["targetOverrides"].(map[string]interface{})
+	targets := make([]string, 0, len(overrides))
+	for target := range overrides {
+		targets = append(targets, target)
+	}
+	// the first invalid target is reported, in a stable order
+	sort.Strings(targets)
+	pointer := strings.NewReplacer("~", "~0", "/", "~1")
+	for _, target := range targets {
+		path := "/spec/certConfig/targetOverrides/" + pointer.Replace(target)
+		if err := normalize("targetOverrides."+target, path, overrides[target]); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(patch) == 0 {
+		return raw, nil, nil
+	}
+	normalized, err := json.Marshal(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, nil, err
+	}
+	return normalized, patchBytes, nil
+}
@@ -7,10 +7,14 @@ import (
 	"fmt"
 	admissionv1 "k8s.io/api/admission/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
 	"maroonedpods.io/maroonedpods/pkg/util"
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
 	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 	"net/http"
 	"strings"
@@ -21,6 +25,7 @@ const (
 	validPodUpdate                = "Pod update did not remove MaroonedPodsGate"
 	maroonedpodsControllerPodUpdate        = "MaroonedPods controller has permission to remove gate from pods"
 	invalidPodUpdate              = "Only MaroonedPods controller has permission to remove " + util.MaroonedPodsGate + " gate from pods"
+	validMaroonedPods             = "MaroonedPods configuration is valid"
 )
 
 type Handler struct {
@@ -45,6 +50,10 @@ func (v Handler) Handle() (*admissionv1.AdmissionReview, error) {
 	switch v.request.Kind.Kind {
 	case "Pod":
 		return v.validatePodUpdate()
+	case "MaroonedPods":
+		return v.validateMaroonedPods()
+	case "Secret":
+		return v.validateManagedSecretUpdate()
 	}
 	return nil, fmt.Errorf("MaroonedPods webhook doesn't recongnize request: %+v", v.request)
 }
@@ -128,6 +137,54 @@ func (v Handler) validatePodUpdate() (*admissionv1.AdmissionReview, error) {
 
 }
 
+// validateMaroonedPods rejects the certConfig, tlsSecurityProfile and featureGates the operator would fail to apply, with
+// the validation the operator runs. An update is only checked for the stanzas it changes, so a CR that
+// predates the validation can still be edited. The durations of the certConfig in the d and y units are
+// normalized to Go syntax, called as the mutating webhook the response patches the CR accordingly.
+func (v Handler) validateMaroonedPods() (*admissionv1.AdmissionReview, error) {
+	raw, patch, err := normalizeCertDurations(v.request.Object.Raw)
+	if err != nil {
+		return reviewResponse(v.request.UID, false, http.StatusUnprocessableEntity, err.Error()), nil
+	}
+	mp := v1alpha1.MaroonedPods{}
+	if err := json.Unmarshal(raw, &mp); err != nil {
+		return nil, err
+	}
+
+	var oldMP *v1alpha1.MaroonedPods
+	if v.request.Operation == admissionv1.Update {
+		oldMP = &v1alpha1.MaroonedPods{}
+		if err := json.Unmarshal(v.request.OldObject.Raw, oldMP); err != nil {
+			return nil, err
+		}
+	}
+
+	if oldMP == nil || !equality.Semantic.DeepEqual(mp.Spec.CertConfig, oldMP.Spec.CertConfig) {
+		if _, err := mpcerts.DefinitionsFromCertConfig(v.maroonedpodsNS, mp.Spec.CertConfig); err != nil {
+			return reviewResponse(v.request.UID, false, http.StatusUnprocessableEntity, err.Error()), nil
+		}
+	}
+
+	if oldMP == nil || !equality.Semantic.DeepEqual(mp.Spec.TLSSecurityProfile, oldMP.Spec.TLSSecurityProfile) {
+		if _, err := tlsprofile.Spec(mp.Spec.TLSSecurityProfile); err != nil {
+			return reviewResponse(v.request.UID, false, http.StatusUnprocessableEntity,
+				fmt.Sprintf("invalid tlsSecurityProfile: %v", err)), nil
+		}
+	}
+
+	if oldMP == nil || !equality.Semantic.DeepEqual(mp.Spec.FeatureGates, oldMP.Spec.FeatureGates) {
+		if err := featuregate.Validate(mp.Spec.FeatureGates); err != nil {
+			return reviewResponse(v.request.UID, false, http.StatusUnprocessableEntity,
+				fmt.Sprintf("invalid featureGates: %v", err)), nil
+		}
+	}
+
+	if patch != nil {
+		return reviewResponseWithPatch(v.request.UID, true, http.StatusAccepted, validMaroonedPods, patch), nil
+	}
+	return reviewResponse(v.request.UID, true, http.StatusAccepted, validMaroonedPods), nil
+}
+
 func hasMaroonedPodsGate(psgs []v1.PodSchedulingGate) bool {
 	if psgs == nil {
 		return false
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const (
+	// ManagedSecretWarning is returned to the users editing a certificate secret of the operator
+	ManagedSecretWarning = "this secret is managed by MaroonedPods and manual changes will be overwritten; " +
+		"use certManagement: external if you need to supply your own certs"
+	validSecretUpdate    = "Secret is not managed by MaroonedPods"
+	managedSecretUpdate  = "Secret update keeps the MaroonedPods management"
+	operatorSecretUpdate = "MaroonedPods operator manages the secret"
+)
+
+// managedByValue is the managed-by label of the objects of the operator
+var managedByValue = util.ResourceBuilder.WithCommonLabels(nil)[util.AppKubernetesManagedByLabel]
+
+// validateManagedSecretUpdate admits the edits of the certificate secrets of the operator with a warning that
+// they will be overwritten, and denies the edits removing them from the management unless the secret is
+// annotated with AllowUnmanageAnnotation. The operator itself is never restricted.
+func (v Handler) validateManagedSecretUpdate() (*admissionv1.AdmissionReview, error) {
+	if isMaroonedPodsOperatorServiceAccount(v.request.UserInfo.Username, v.maroonedpodsNS) {
+		return reviewResponse(v.request.UID, true, http.StatusAccepted, operatorSecretUpdate), nil
+	}
+
+	oldSecret := v1.Secret{}
+	if err := json.Unmarshal(v.request.OldObject.Raw, &oldSecret); err != nil {
+		return nil, err
+	}
+	if !isManagedCertSecret(&oldSecret) {
+		return reviewResponse(v.request.UID, true, http.StatusAccepted, validSecretUpdate), nil
+	}
+
+	secret := v1.Secret{}
+	if err := json.Unmarshal(v.request.Object.Raw, &secret); err != nil {
+		return nil, err
+	}
+	if !isManagedCertSecret(&secret) && secret.Annotations[mpcerts.AllowUnmanageAnnotation] != "true" {
+		return reviewResponse(v.request.UID, false, http.StatusForbidden,
+			fmt.Sprintf("the %s label and the %s annotation of a secret managed by MaroonedPods can't be removed, "+
+				"unless it is annotated with %s=true", util.AppKubernetesManagedByLabel, mpcerts.CertConfigAnnotation,
+				mpcerts.AllowUnmanageAnnotation)), nil
+	}
+
+	response := reviewResponse(v.request.UID, true, http.StatusAccepted, managedSecretUpdate)
+	response.Response.Warnings = []string{ManagedSecretWarning}
+	return response, nil
+}
+
+// isManagedCertSecret tells if the certificate manager of the operator issues the secret
+func isManagedCertSecret(secret *v1.Secret) bool {
+	if secret.Labels[util.AppKubernetesManagedByLabel] != managedByValue {
+		return false
+	}
+	_, ok := secret.Annotations[mpcerts.CertConfigAnnotation]
+	return ok
+}
+
+func isMaroonedPodsOperatorServiceAccount(serviceAccount string, maroonedpodsNS string) bool {
+	return serviceAccount == fmt.Sprintf("system:serviceaccount:%s:%s", maroonedpodsNS, util.OperatorServiceAccountName)
+}
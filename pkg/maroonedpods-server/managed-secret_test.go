@@ -0,0 +1,135 @@
+package maroonedpods_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	mpcerts "maroonedpods.io/maroonedpods/pkg/maroonedpods-operator/resources/cert"
+	"maroonedpods.io/maroonedpods/pkg/maroonedpods-server/handler"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("managed secret validation", func() {
+	const (
+		namespace = "maroonedpods"
+		user      = "kube:admin"
+		operator  = "system:serviceaccount:" + namespace + ":" + util.OperatorServiceAccountName
+	)
+
+	newSecret := func() *corev1.Secret {
+		return &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        mpcerts.ServerCertSecretName,
+				Labels:      util.ResourceBuilder.WithCommonLabels(nil),
+				Annotations: map[string]string{mpcerts.CertConfigAnnotation: `{"lifetime":"24h0m0s","refresh":"12h0m0s"}`},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+		}
+	}
+
+	review := func(username string, secret, oldSecret *corev1.Secret) *admissionv1.AdmissionResponse {
+		raw := func(obj *corev1.Secret) runtime.RawExtension {
+			b, err := json.Marshal(obj)
+			Expect(err).ToNot(HaveOccurred())
+			return runtime.RawExtension{Raw: b}
+		}
+		body, err := json.Marshal(&admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{
+				UID:       "request-uid",
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+				Operation: admissionv1.Update,
+				UserInfo:  authenticationv1.UserInfo{Username: username},
+				Object:    raw(secret),
+				OldObject: raw(oldSecret),
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, "/serve-path", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		NewMaroonedPodsServerHandler(namespace, fake.NewSimpleClientset()).ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+
+		out := &admissionv1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed())
+		Expect(out.Response.UID).To(BeEquivalentTo("request-uid"))
+		return out.Response
+	}
+
+	It("should warn about a manual edit", func() {
+		edited := newSecret()
+		edited.Data[corev1.TLSCertKey] = []byte("my own cert")
+
+		response := review(user, edited, newSecret())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(Equal([]string{handler.ManagedSecretWarning}))
+	})
+
+	DescribeTable("should deny removing the management", func(unmanage func(*corev1.Secret)) {
+		edited := newSecret()
+		unmanage(edited)
+
+		response := review(user, edited, newSecret())
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Code).To(BeEquivalentTo(http.StatusForbidden))
+		Expect(response.Result.Message).To(ContainSubstring(mpcerts.AllowUnmanageAnnotation))
+	},
+		Entry("label", func(secret *corev1.Secret) {
+			delete(secret.Labels, util.AppKubernetesManagedByLabel)
+		}),
+		Entry("annotation", func(secret *corev1.Secret) {
+			delete(secret.Annotations, mpcerts.CertConfigAnnotation)
+		}),
+	)
+
+	It("should allow removing the management with the override annotation", func() {
+		edited := newSecret()
+		delete(edited.Labels, util.AppKubernetesManagedByLabel)
+		edited.Annotations[mpcerts.AllowUnmanageAnnotation] = "true"
+
+		response := review(user, edited, newSecret())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(ConsistOf(handler.ManagedSecretWarning))
+	})
+
+	It("should not restrict the operator", func() {
+		edited := newSecret()
+		edited.Data[corev1.TLSCertKey] = []byte("rotated cert")
+		delete(edited.Annotations, mpcerts.CertConfigAnnotation)
+
+		response := review(operator, edited, newSecret())
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(BeEmpty())
+
+		// the operator of another install is a user
+		Expect(review("system:serviceaccount:other:"+util.OperatorServiceAccountName, edited, newSecret()).Allowed).To(BeFalse())
+	})
+
+	It("should ignore the secrets the operator doesn't manage", func() {
+		secret := newSecret()
+		delete(secret.Annotations, mpcerts.CertConfigAnnotation)
+		edited := secret.DeepCopy()
+		edited.Data[corev1.TLSCertKey] = []byte("my own cert")
+
+		response := review(user, edited, secret)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Warnings).To(BeEmpty())
+	})
+})
@@ -0,0 +1,179 @@
+package maroonedpods_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/util/featuregate"
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("MaroonedPods validation", func() {
+	const namespace = "maroonedpods"
+
+	duration := func(d string) *metav1.Duration {
+		parsed, err := time.ParseDuration(d)
+		Expect(err).ToNot(HaveOccurred())
+		return &metav1.Duration{Duration: parsed}
+	}
+
+	newCR := func(certConfig *v1alpha1.MaroonedPodsCertConfig, profile *v1alpha1.TLSSecurityProfile) *v1alpha1.MaroonedPods {
+		return &v1alpha1.MaroonedPods{
+			TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "MaroonedPods"},
+			ObjectMeta: metav1.ObjectMeta{Name: "maroonedpods"},
+			Spec: v1alpha1.MaroonedPodsSpec{
+				CertConfig:         certConfig,
+				TLSSecurityProfile: profile,
+			},
+		}
+	}
+
+	raw := func(obj *v1alpha1.MaroonedPods) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		b, err := json.Marshal(obj)
+		Expect(err).ToNot(HaveOccurred())
+		return runtime.RawExtension{Raw: b}
+	}
+
+	reviewRaw := func(operation admissionv1.Operation, object, oldObject runtime.RawExtension) *admissionv1.AdmissionResponse {
+		body, err := json.Marshal(&admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{
+				UID:       "request-uid",
+				Kind:      metav1.GroupVersionKind{Group: "maroonedpods.io", Version: "v1alpha1", Kind: "MaroonedPods"},
+				Operation: operation,
+				Object:    object,
+				OldObject: oldObject,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest(http.MethodPost, "/serve-path", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		NewMaroonedPodsServerHandler(namespace, fake.NewSimpleClientset()).ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+
+		out := &admissionv1.AdmissionReview{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed())
+		Expect(out.Response.UID).To(BeEquivalentTo("request-uid"))
+		return out.Response
+	}
+
+	review := func(operation admissionv1.Operation, mp, oldMP *v1alpha1.MaroonedPods) *admissionv1.AdmissionResponse {
+		return reviewRaw(operation, raw(mp), raw(oldMP))
+	}
+
+	// the certConfig of a CR as the user wrote it, the API types only hold durations in Go syntax
+	rawCR := func(certConfig string) runtime.RawExtension {
+		return runtime.RawExtension{Raw: []byte(`{"apiVersion":"maroonedpods.io/v1alpha1","kind":"MaroonedPods",` +
+			`"metadata":{"name":"maroonedpods"},"spec":{"certConfig":` + certConfig + `}}`)}
+	}
+
+	It("should admit a valid configuration", func() {
+		response := review(admissionv1.Create, newCR(&v1alpha1.MaroonedPodsCertConfig{
+			CA:     &v1alpha1.CertConfig{Duration: duration("8760h"), RenewBefore: duration("720h")},
+			Server: &v1alpha1.CertConfig{Duration: duration("24h"), RenewBefore: duration("12h")},
+		}, &v1alpha1.TLSSecurityProfile{Type: v1alpha1.TLSProfileIntermediateType}), nil)
+		Expect(response.Allowed).To(BeTrue())
+		Expect(response.Patch).To(BeEmpty())
+
+		Expect(review(admissionv1.Create, newCR(nil, nil), nil).Allowed).To(BeTrue())
+	})
+
+	It("should normalize the durations in days and years to Go syntax", func() {
+		response := reviewRaw(admissionv1.Create, rawCR(`{"ca":{"duration":"1y","renewBefore":"30d"},`+
+			`"server":{"duration":"24h","renewBefore":"0.5d"},"targetOverrides":{"metrics":{"duration":"2d"}}}`), runtime.RawExtension{})
+		Expect(response.Allowed).To(BeTrue())
+		Expect(*response.PatchType).To(Equal(admissionv1.PatchTypeJSONPatch))
+
+		var patch []map[string]string
+		Expect(json.Unmarshal(response.Patch, &patch)).To(Succeed())
+		Expect(patch).To(Equal([]map[string]string{
+			{"op": "replace", "path": "/spec/certConfig/ca/duration", "value": "8760h0m0s"},
+			{"op": "replace", "path": "/spec/certConfig/ca/renewBefore", "value": "720h0m0s"},
+			{"op": "replace", "path": "/spec/certConfig/server/renewBefore", "value": "12h0m0s"},
+			{"op": "replace", "path": "/spec/certConfig/targetOverrides/metrics/duration", "value": "48h0m0s"},
+		}))
+	})
+
+	It("should validate the normalized durations", func() {
+		response := reviewRaw(admissionv1.Create, rawCR(`{"server":{"duration":"12h","renewBefore":"1d"}}`), runtime.RawExtension{})
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring("invalid certConfig.server: renewBefore has to be shorter than the duration"))
+
+		response = reviewRaw(admissionv1.Create, rawCR(`{"ca":{"duration":"a year"}}`), runtime.RawExtension{})
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Code).To(BeEquivalentTo(http.StatusUnprocessableEntity))
+		Expect(response.Result.Message).To(ContainSubstring(`invalid certConfig.ca.duration: invalid duration "a year"`))
+	})
+
+	DescribeTable("should reject", func(certConfig *v1alpha1.MaroonedPodsCertConfig, profile *v1alpha1.TLSSecurityProfile, message string) {
+		response := review(admissionv1.Create, newCR(certConfig, profile), nil)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Code).To(BeEquivalentTo(http.StatusUnprocessableEntity))
+		Expect(response.Result.Message).To(ContainSubstring(message))
+	},
+		Entry("a duration that is not positive",
+			&v1alpha1.MaroonedPodsCertConfig{Server: &v1alpha1.CertConfig{RenewBefore: duration("-1h")}}, nil,
+			"invalid certConfig.server.renewBefore"),
+		Entry("a server renewBefore longer than its duration",
+			&v1alpha1.MaroonedPodsCertConfig{Server: &v1alpha1.CertConfig{Duration: duration("12h"), RenewBefore: duration("24h")}}, nil,
+			"invalid certConfig.server: renewBefore has to be shorter than the duration"),
+		Entry("a CA renewBefore longer than the default duration",
+			&v1alpha1.MaroonedPodsCertConfig{CA: &v1alpha1.CertConfig{RenewBefore: duration("48h")}}, nil,
+			"invalid certConfig.ca: renewBefore has to be shorter than the duration (48h0m0s)"),
+		Entry("a Custom TLS security profile without its settings",
+			nil, &v1alpha1.TLSSecurityProfile{Type: v1alpha1.TLSProfileCustomType},
+			"invalid tlsSecurityProfile: the Custom TLS security profile requires the custom settings"),
+		Entry("an unknown TLS security profile type",
+			nil, &v1alpha1.TLSSecurityProfile{Type: "Paranoid"},
+			`invalid tlsSecurityProfile: unknown TLS security profile type "Paranoid"`),
+	)
+
+	It("should reject an unknown feature gate", func() {
+		mp := newCR(nil, nil)
+		mp.Spec.FeatureGates = []string{featuregate.StrictTargetService, "Teleport"}
+		response := review(admissionv1.Create, mp, nil)
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring(`invalid featureGates: unknown feature gate "Teleport"`))
+
+		mp.Spec.FeatureGates = []string{featuregate.StrictTargetService}
+		Expect(review(admissionv1.Create, mp, nil).Allowed).To(BeTrue())
+	})
+
+	It("should admit an update that doesn't touch the invalid stanzas", func() {
+		legacy := newCR(&v1alpha1.MaroonedPodsCertConfig{
+			Server: &v1alpha1.CertConfig{Duration: duration("12h"), RenewBefore: duration("24h")},
+		}, &v1alpha1.TLSSecurityProfile{Type: v1alpha1.TLSProfileCustomType})
+		updated := legacy.DeepCopy()
+		updated.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"gated": "true"}}
+
+		Expect(review(admissionv1.Update, updated, legacy).Allowed).To(BeTrue())
+	})
+
+	It("should reject an update that changes a stanza to an invalid one", func() {
+		legacy := newCR(&v1alpha1.MaroonedPodsCertConfig{
+			Server: &v1alpha1.CertConfig{Duration: duration("12h"), RenewBefore: duration("24h")},
+		}, nil)
+		updated := legacy.DeepCopy()
+		updated.Spec.CertConfig.Server.RenewBefore = duration("48h")
+		Expect(review(admissionv1.Update, updated, legacy).Allowed).To(BeFalse())
+
+		updated.Spec.CertConfig.Server.RenewBefore = duration("1h")
+		Expect(review(admissionv1.Update, updated, legacy).Allowed).To(BeTrue())
+	})
+})
@@ -2,18 +2,19 @@ package maroonedpods_server
 
 import (
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
 	"io"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/certificate"
 	"k8s.io/klog/v2"
 	"maroonedpods.io/maroonedpods/pkg/util"
 	"net/http"
+	"time"
 )
 
 const (
 	healthzPath = "/healthz"
-	ServePath   = "/serve-path"
+	ServePath   = util.WebhookServePath
 )
 
 // Server is the public interface to the upload proxy
@@ -23,25 +24,28 @@ type Server interface {
 }
 
 type MaroonedPodsServer struct {
-	bindAddress       string
-	bindPort          uint
-	secretCertManager certificate.Manager
-	handler           http.Handler
-	maroonedpodsNS             string
+	bindAddress         string
+	bindPort            uint
+	certSource          CertSource
+	certExpiryThreshold time.Duration
+	handler             http.Handler
+	maroonedpodsNS      string
 }
 
 // MaroonedPodsServer returns an initialized uploadProxyApp
 func MaroonedPodsServer(maroonedpodsNS string,
 	bindAddress string,
 	bindPort uint,
-	secretCertManager certificate.Manager,
+	certSource CertSource,
+	certExpiryThreshold time.Duration,
 	maroonedpodsCli kubernetes.Interface,
 ) (Server, error) {
 	app := &MaroonedPodsServer{
-		secretCertManager: secretCertManager,
-		bindAddress:       bindAddress,
-		bindPort:          bindPort,
-		maroonedpodsNS:             maroonedpodsNS,
+		certSource:          certSource,
+		certExpiryThreshold: certExpiryThreshold,
+		bindAddress:         bindAddress,
+		bindPort:            bindPort,
+		maroonedpodsNS:      maroonedpodsNS,
 	}
 	app.initHandler(maroonedpodsCli)
 
@@ -55,7 +59,9 @@ func (app *MaroonedPodsServer) ServeHTTP(w http.ResponseWriter, r *http.Request)
 func (app *MaroonedPodsServer) initHandler(maroonedpodsCli kubernetes.Interface) {
 	mux := http.NewServeMux()
 	mux.HandleFunc(healthzPath, app.handleHealthzRequest)
+	mux.Handle(readyzPath, NewCertHealthHandler(app.certSource, app.certExpiryThreshold))
 	mux.Handle(ServePath, NewMaroonedPodsServerHandler(app.maroonedpodsNS, maroonedpodsCli))
+	mux.Handle(util.MetricsPath, promhttp.Handler())
 	app.handler = cors.AllowAll().Handler(mux)
 
 }
@@ -74,7 +80,7 @@ func (app *MaroonedPodsServer) Start() error {
 func (app *MaroonedPodsServer) startTLS() error {
 	var serveFunc func() error
 	bindAddr := fmt.Sprintf("%s:%d", app.bindAddress, app.bindPort)
-	tlsConfig := util.SetupTLS(app.secretCertManager)
+	tlsConfig := util.SetupTLSWithCertificateGetter(app.certSource.GetCertificate)
 	server := &http.Server{
 		Addr:      bindAddr,
 		Handler:   app.handler,
@@ -0,0 +1,13 @@
+package maroonedpods_server_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMaroonedPodsServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "MaroonedPodsServer Suite")
+}
@@ -0,0 +1,307 @@
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
+
+	"maroonedpods.io/maroonedpods/pkg/log"
+)
+
+const (
+	defaultBundleKey    = "ca-bundle.crt"
+	defaultResyncPeriod = 10 * time.Minute
+)
+
+// Options names the secret and the CA bundle configmap a CertWatcher serves the material of
+type Options struct {
+	// Namespace of the secret
+	Namespace string
+	// SecretName is the name of the secret holding the certificate and its key
+	SecretName string
+	// CertKey defaults to tls.crt
+	CertKey string
+	// KeyKey defaults to tls.key
+	KeyKey string
+
+	// BundleNamespace defaults to Namespace
+	BundleNamespace string
+	// BundleConfigMapName is the name of the configmap holding the CA bundle, no CA pool is served if empty
+	BundleConfigMapName string
+	// BundleKey defaults to ca-bundle.crt
+	BundleKey string
+
+	// ResyncPeriod of the informers created by New
+	ResyncPeriod time.Duration
+}
+
+// CertWatcher serves the certificate of a secret and the CA pool of a bundle configmap to tls.Configs,
+// swapping in the rotated material as soon as the informers see it. Material that doesn't parse or is
+// expired is rejected and the last good material is kept.
+type CertWatcher struct {
+	opts Options
+
+	secretInformer    cache.SharedIndexInformer
+	configMapInformer cache.SharedIndexInformer
+	// whether the informers were created by New and are run by Start
+	ownInformers bool
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+	// the resource version of the last secret loaded or rejected, resyncs don't parse it again
+	secretVersion string
+	secretErr     error
+	caPool        *x509.CertPool
+	bundleVersion string
+	bundleErr     error
+}
+
+// New returns a CertWatcher with its own informers, watching only the secret and the configmap of the options
+func New(client kubernetes.Interface, opts Options) *CertWatcher {
+	opts = withDefaults(opts)
+	w := &CertWatcher{opts: opts, ownInformers: true}
+	w.secretInformer = coreinformers.NewFilteredSecretInformer(client, opts.Namespace, opts.ResyncPeriod, cache.Indexers{},
+		func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.SecretName).String()
+		})
+	if opts.BundleConfigMapName != "" {
+		w.configMapInformer = coreinformers.NewFilteredConfigMapInformer(client, opts.BundleNamespace, opts.ResyncPeriod, cache.Indexers{},
+			func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("metadata.name", opts.BundleConfigMapName).String()
+			})
+	}
+	return w
+}
+
+// NewFromInformers returns a CertWatcher sharing the secret and configmap informers of the caller, who runs them.
+// The configmap informer may be nil if the options name no bundle configmap.
+func NewFromInformers(secretInformer, configMapInformer cache.SharedIndexInformer, opts Options) *CertWatcher {
+	return &CertWatcher{
+		opts:              withDefaults(opts),
+		secretInformer:    secretInformer,
+		configMapInformer: configMapInformer,
+	}
+}
+
+func withDefaults(opts Options) Options {
+	if opts.CertKey == "" {
+		opts.CertKey = corev1.TLSCertKey
+	}
+	if opts.KeyKey == "" {
+		opts.KeyKey = corev1.TLSPrivateKeyKey
+	}
+	if opts.BundleNamespace == "" {
+		opts.BundleNamespace = opts.Namespace
+	}
+	if opts.BundleKey == "" {
+		opts.BundleKey = defaultBundleKey
+	}
+	if opts.ResyncPeriod == 0 {
+		opts.ResyncPeriod = defaultResyncPeriod
+	}
+	return opts
+}
+
+// Start watches the secret and the configmap until the context is done, it implements manager.Runnable.
+// An absent secret doesn't fail the start, the watcher just isn't ready until it appears.
+func (w *CertWatcher) Start(ctx context.Context) error {
+	if w.opts.BundleConfigMapName != "" && w.configMapInformer == nil {
+		return fmt.Errorf("no configmap informer for bundle configmap %s/%s", w.opts.BundleNamespace, w.opts.BundleConfigMapName)
+	}
+
+	informers := []cache.SharedIndexInformer{w.secretInformer}
+	if _, err := w.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { w.onSecret(obj) },
+		UpdateFunc: func(_, obj interface{}) { w.onSecret(obj) },
+		DeleteFunc: func(obj interface{}) { w.onDelete(obj) },
+	}); err != nil {
+		return err
+	}
+	if w.configMapInformer != nil {
+		informers = append(informers, w.configMapInformer)
+		if _, err := w.configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { w.onConfigMap(obj) },
+			UpdateFunc: func(_, obj interface{}) { w.onConfigMap(obj) },
+			DeleteFunc: func(obj interface{}) { w.onDelete(obj) },
+		}); err != nil {
+			return err
+		}
+	}
+
+	var synced []cache.InformerSynced
+	for _, informer := range informers {
+		if w.ownInformers {
+			go informer.Run(ctx.Done())
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("could not sync the informers of secret %s/%s", w.opts.Namespace, w.opts.SecretName)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// NeedLeaderElection returns false, every replica serves its certificate
+func (w *CertWatcher) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *CertWatcher) onSecret(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || secret.Namespace != w.opts.Namespace || secret.Name != w.opts.SecretName {
+		return
+	}
+
+	w.lock.RLock()
+	seen := secret.ResourceVersion != "" && secret.ResourceVersion == w.secretVersion
+	w.lock.RUnlock()
+	if seen {
+		return
+	}
+
+	crt, err := parseKeyPair(secret.Data[w.opts.CertKey], secret.Data[w.opts.KeyKey])
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.secretVersion = secret.ResourceVersion
+	if err != nil {
+		w.secretErr = err
+		log.DefaultLogger().Reason(err).Errorf("Rejected the certificate of secret %s/%s, keeping the current one", secret.Namespace, secret.Name)
+		return
+	}
+	w.cert = crt
+	w.secretErr = nil
+	log.DefaultLogger().Infof("Loaded certificate with common name '%s' from secret %s/%s", crt.Leaf.Subject.CommonName, secret.Namespace, secret.Name)
+}
+
+func (w *CertWatcher) onConfigMap(obj interface{}) {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok || configMap.Namespace != w.opts.BundleNamespace || configMap.Name != w.opts.BundleConfigMapName {
+		return
+	}
+
+	w.lock.RLock()
+	seen := configMap.ResourceVersion != "" && configMap.ResourceVersion == w.bundleVersion
+	w.lock.RUnlock()
+	if seen {
+		return
+	}
+
+	pool, err := parseBundle([]byte(configMap.Data[w.opts.BundleKey]))
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.bundleVersion = configMap.ResourceVersion
+	if err != nil {
+		w.bundleErr = err
+		log.DefaultLogger().Reason(err).Errorf("Rejected the CA bundle of configmap %s/%s, keeping the current one", configMap.Namespace, configMap.Name)
+		return
+	}
+	w.caPool = pool
+	w.bundleErr = nil
+	log.DefaultLogger().Infof("Loaded CA bundle from configmap %s/%s", configMap.Namespace, configMap.Name)
+}
+
+// onDelete keeps the material, a deleted secret is recreated by the operator
+func (w *CertWatcher) onDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if object, ok := obj.(metav1.Object); ok {
+		log.DefaultLogger().Warningf("%s/%s was deleted, keeping the loaded material", object.GetNamespace(), object.GetName())
+	}
+}
+
+// parseKeyPair validates the pair and returns it with the parsed leaf
+func parseKeyPair(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	crt, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key pair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(crt.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid leaf certificate: %v", err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("the certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	crt.Leaf = leaf
+	return &crt, nil
+}
+
+func parseBundle(bundlePEM []byte) (*x509.CertPool, error) {
+	certs, err := certutil.ParseCertsPEM(bundlePEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// GetCertificate serves the current certificate, for tls.Config.GetCertificate
+func (w *CertWatcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return w.current()
+}
+
+// GetClientCertificate serves the current certificate, for tls.Config.GetClientCertificate
+func (w *CertWatcher) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return w.current()
+}
+
+func (w *CertWatcher) current() (*tls.Certificate, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.cert == nil {
+		return nil, w.notLoaded("certificate of secret", w.opts.Namespace, w.opts.SecretName, w.secretErr)
+	}
+	return w.cert, nil
+}
+
+// CAPool returns the pool of the CAs in the bundle configmap, the pool must not be modified
+func (w *CertWatcher) CAPool() (*x509.CertPool, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if w.caPool == nil {
+		return nil, w.notLoaded("CA bundle of configmap", w.opts.BundleNamespace, w.opts.BundleConfigMapName, w.bundleErr)
+	}
+	return w.caPool, nil
+}
+
+// ReadyzCheck fails until the certificate, and the CA bundle if any, are loaded, it is a healthz.Checker
+func (w *CertWatcher) ReadyzCheck(_ *http.Request) error {
+	if _, err := w.current(); err != nil {
+		return err
+	}
+	if w.opts.BundleConfigMapName == "" {
+		return nil
+	}
+	_, err := w.CAPool()
+	return err
+}
+
+func (w *CertWatcher) notLoaded(what, namespace, name string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s %s/%s not loaded: %v", what, namespace, name, err)
+	}
+	return fmt.Errorf("%s %s/%s not loaded yet", what, namespace, name)
+}
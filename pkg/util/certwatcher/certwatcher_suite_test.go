@@ -0,0 +1,13 @@
+package certwatcher_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCertWatcher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CertWatcher Suite")
+}
@@ -0,0 +1,336 @@
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple"
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple/cert"
+)
+
+type pemPair struct {
+	cert, key []byte
+}
+
+var _ = Describe("CertWatcher", func() {
+	const (
+		namespace  = "maroonedpods"
+		secretName = "maroonedpods-server-cert"
+		bundleName = "maroonedpods-server-signer-bundle"
+	)
+
+	var (
+		client  *fake.Clientset
+		ca      *triple.KeyPair
+		cancel  context.CancelFunc
+		version int
+	)
+
+	newKeyPair := func(ca *triple.KeyPair, commonName string, duration time.Duration) pemPair {
+		keyPair, err := triple.NewServerKeyPair(ca, commonName, "maroonedpods-server", namespace, "cluster.local", nil, nil, duration)
+		Expect(err).ToNot(HaveOccurred())
+		return pemPair{cert: cert.EncodeCertPEM(keyPair.Cert), key: cert.EncodePrivateKeyPEM(keyPair.Key)}
+	}
+
+	// the fake clientset doesn't bump resource versions
+	nextVersion := func() string {
+		version++
+		return strconv.Itoa(version)
+	}
+
+	writeSecret := func(name string, pair pemPair) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, ResourceVersion: nextVersion()},
+			Data:       map[string][]byte{corev1.TLSCertKey: pair.cert, corev1.TLSPrivateKeyKey: pair.key},
+		}
+		_, err := client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			_, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+		}
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	writeBundle := func(bundle []byte) {
+		configMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: bundleName, ResourceVersion: nextVersion()},
+			Data:       map[string]string{"ca-bundle.crt": string(bundle)},
+		}
+		_, err := client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		if err != nil {
+			_, err = client.CoreV1().ConfigMaps(namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+		}
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	start := func(w *CertWatcher) chan error {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- w.Start(ctx)
+		}()
+		return done
+	}
+
+	readyz := func(w *CertWatcher) error {
+		return w.ReadyzCheck(nil)
+	}
+
+	commonName := func(w *CertWatcher) string {
+		crt, err := w.GetCertificate(nil)
+		if err != nil {
+			return ""
+		}
+		return crt.Leaf.Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		var err error
+		ca, err = triple.NewCA("maroonedpods-server-signer", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		cancel = func() {}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	Context("certificate", func() {
+		var w *CertWatcher
+
+		BeforeEach(func() {
+			w = New(client, Options{Namespace: namespace, SecretName: secretName})
+		})
+
+		It("should not be ready while the secret is absent", func() {
+			start(w)
+
+			Consistently(readyz, time.Second).WithArguments(w).Should(MatchError(ContainSubstring("not loaded yet")))
+			_, err := w.GetCertificate(nil)
+			Expect(err).To(HaveOccurred())
+			_, err = w.GetClientCertificate(nil)
+			Expect(err).To(HaveOccurred())
+
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+
+			Eventually(readyz).WithArguments(w).Should(Succeed())
+			Expect(commonName(w)).To(Equal("first"))
+			crt, err := w.GetClientCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(crt.Leaf.Subject.CommonName).To(Equal("first"))
+		})
+
+		It("should swap in the rotated certificate", func() {
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+			start(w)
+			Eventually(commonName).WithArguments(w).Should(Equal("first"))
+
+			writeSecret(secretName, newKeyPair(ca, "second", time.Hour))
+
+			Eventually(commonName).WithArguments(w).Should(Equal("second"))
+		})
+
+		DescribeTable("should keep the working certificate on a corrupt update", func(corrupt func() pemPair) {
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+			start(w)
+			Eventually(commonName).WithArguments(w).Should(Equal("first"))
+
+			writeSecret(secretName, corrupt())
+
+			Eventually(func() error {
+				w.lock.RLock()
+				defer w.lock.RUnlock()
+				return w.secretErr
+			}).Should(HaveOccurred())
+			Consistently(commonName, time.Second).WithArguments(w).Should(Equal("first"))
+			Expect(w.ReadyzCheck(nil)).To(Succeed())
+
+			// and still picks up the next good one
+			writeSecret(secretName, newKeyPair(ca, "second", time.Hour))
+			Eventually(commonName).WithArguments(w).Should(Equal("second"))
+		},
+			Entry("garbage", func() pemPair {
+				return pemPair{cert: []byte("not a certificate"), key: []byte("not a key")}
+			}),
+			Entry("empty", func() pemPair {
+				return pemPair{}
+			}),
+			Entry("truncated certificate", func() pemPair {
+				pair := newKeyPair(ca, "truncated", time.Hour)
+				return pemPair{cert: pair.cert[:len(pair.cert)/2], key: pair.key}
+			}),
+			Entry("key of another certificate", func() pemPair {
+				return pemPair{cert: newKeyPair(ca, "mismatched", time.Hour).cert, key: newKeyPair(ca, "other", time.Hour).key}
+			}),
+			Entry("expired certificate", func() pemPair {
+				return newKeyPair(ca, "expired", -time.Minute)
+			}),
+		)
+
+		It("should not be ready if the secret is corrupt at startup", func() {
+			writeSecret(secretName, pemPair{cert: []byte("not a certificate"), key: []byte("not a key")})
+			start(w)
+
+			Eventually(readyz).WithArguments(w).Should(MatchError(ContainSubstring("invalid key pair")))
+		})
+
+		It("should keep the certificate when the secret is deleted", func() {
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+			start(w)
+			Eventually(commonName).WithArguments(w).Should(Equal("first"))
+
+			Expect(client.CoreV1().Secrets(namespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})).To(Succeed())
+
+			Consistently(commonName, time.Second).WithArguments(w).Should(Equal("first"))
+		})
+
+		It("should ignore other secrets", func() {
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+			start(w)
+			Eventually(commonName).WithArguments(w).Should(Equal("first"))
+
+			writeSecret("other", newKeyPair(ca, "other", time.Hour))
+
+			Consistently(commonName, time.Second).WithArguments(w).Should(Equal("first"))
+		})
+
+		It("should return from Start when the context is done", func() {
+			done := start(w)
+			cancel()
+
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("should not need the leader election", func() {
+			Expect(w.NeedLeaderElection()).To(BeFalse())
+		})
+	})
+
+	Context("CA pool", func() {
+		var w *CertWatcher
+
+		verify := func(certPEM []byte) error {
+			pool, err := w.CAPool()
+			if err != nil {
+				return err
+			}
+			certs, err := cert.ParseCertsPEM(certPEM)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = certs[0].Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+			return err
+		}
+
+		BeforeEach(func() {
+			w = New(client, Options{Namespace: namespace, SecretName: secretName, BundleConfigMapName: bundleName})
+			writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+		})
+
+		It("should not be ready until the bundle is loaded", func() {
+			start(w)
+			Eventually(commonName).WithArguments(w).Should(Equal("first"))
+			Expect(w.ReadyzCheck(nil)).To(MatchError(ContainSubstring("CA bundle")))
+
+			writeBundle(cert.EncodeCertPEM(ca.Cert))
+
+			Eventually(readyz).WithArguments(w).Should(Succeed())
+		})
+
+		It("should swap in the rotated bundle and keep it on a corrupt update", func() {
+			writeBundle(cert.EncodeCertPEM(ca.Cert))
+			start(w)
+			Eventually(readyz).WithArguments(w).Should(Succeed())
+			certPEM := newKeyPair(ca, "first", time.Hour).cert
+			Expect(verify(certPEM)).To(Succeed())
+
+			next, err := triple.NewCA("maroonedpods-server-signer", time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			nextPEM := newKeyPair(next, "second", time.Hour).cert
+			writeBundle(append(cert.EncodeCertPEM(next.Cert), cert.EncodeCertPEM(ca.Cert)...))
+			Eventually(verify).WithArguments(nextPEM).Should(Succeed())
+
+			writeBundle([]byte("not a bundle"))
+			Consistently(verify, time.Second).WithArguments(nextPEM).Should(Succeed())
+			Expect(w.ReadyzCheck(nil)).To(Succeed())
+
+			writeBundle(cert.EncodeCertPEM(next.Cert))
+			Eventually(verify).WithArguments(certPEM).ShouldNot(Succeed())
+			Expect(verify(nextPEM)).To(Succeed())
+		})
+
+		It("should serve a mutual TLS handshake", func() {
+			writeBundle(cert.EncodeCertPEM(ca.Cert))
+			clientKeyPair, err := triple.NewClientKeyPair(ca, "client", nil, time.Hour)
+			Expect(err).ToNot(HaveOccurred())
+			writeSecret("client-cert", pemPair{cert: cert.EncodeCertPEM(clientKeyPair.Cert), key: cert.EncodePrivateKeyPEM(clientKeyPair.Key)})
+			clientWatcher := New(client, Options{Namespace: namespace, SecretName: "client-cert", BundleConfigMapName: bundleName})
+			start(w)
+			serverCancel := cancel
+			start(clientWatcher)
+			defer serverCancel()
+			Eventually(readyz).WithArguments(w).Should(Succeed())
+			Eventually(readyz).WithArguments(clientWatcher).Should(Succeed())
+
+			serverPool, err := w.CAPool()
+			Expect(err).ToNot(HaveOccurred())
+			clientPool, err := clientWatcher.CAPool()
+			Expect(err).ToNot(HaveOccurred())
+
+			serverConn, clientConn := net.Pipe()
+			server := tls.Server(serverConn, &tls.Config{
+				GetCertificate: w.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      serverPool,
+			})
+			tlsClient := tls.Client(clientConn, &tls.Config{
+				GetClientCertificate: clientWatcher.GetClientCertificate,
+				RootCAs:              clientPool,
+				ServerName:           "maroonedpods-server." + namespace + ".svc",
+			})
+			defer server.Close()
+			defer tlsClient.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				serverErr <- server.Handshake()
+			}()
+			Expect(tlsClient.Handshake()).To(Succeed())
+			Expect(<-serverErr).To(Succeed())
+			Expect(server.ConnectionState().PeerCertificates[0].Subject.CommonName).To(Equal("client"))
+		})
+	})
+
+	It("should share the informers of the caller", func() {
+		secretInformer := coreinformers.NewSecretInformer(client, namespace, 0, cache.Indexers{})
+		w := NewFromInformers(secretInformer, nil, Options{Namespace: namespace, SecretName: secretName})
+		writeSecret(secretName, newKeyPair(ca, "first", time.Hour))
+		start(w)
+		Consistently(readyz, 500*time.Millisecond).WithArguments(w).ShouldNot(Succeed())
+
+		informerCtx, informerCancel := context.WithCancel(context.Background())
+		defer informerCancel()
+		go secretInformer.Run(informerCtx.Done())
+
+		Eventually(commonName).WithArguments(w).Should(Equal("first"))
+	})
+
+	It("should refuse to start without the informer of its bundle configmap", func() {
+		secretInformer := coreinformers.NewSecretInformer(client, namespace, 0, cache.Indexers{})
+		w := NewFromInformers(secretInformer, nil, Options{Namespace: namespace, SecretName: secretName, BundleConfigMapName: bundleName})
+
+		Expect(w.Start(context.Background())).To(MatchError(ContainSubstring("no configmap informer")))
+	})
+})
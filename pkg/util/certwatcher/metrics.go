@@ -0,0 +1,71 @@
+package certwatcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+const metricsReadHeaderTimeout = 32 * time.Second
+
+// MetricsServer serves the metrics of a gatherer over TLS with the certificate of a CertWatcher, a rotated
+// certificate is served from the next handshake on. It implements manager.Runnable.
+type MetricsServer struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// NewMetricsServer returns a MetricsServer listening on the address, with the TLS profile of the environment
+func NewMetricsServer(addr string, w *CertWatcher, gatherer prometheus.Gatherer) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle(util.MetricsPath, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	return &MetricsServer{
+		mux: mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			TLSConfig:         util.SetupTLSWithCertificateGetter(w.GetCertificate),
+			ReadHeaderTimeout: metricsReadHeaderTimeout,
+		},
+	}
+}
+
+// Handle serves an additional handler next to the metrics, before the server starts
+func (s *MetricsServer) Handle(path string, handler http.Handler) {
+	s.mux.Handle(path, handler)
+}
+
+// Start listens on the address and serves until the context is done
+func (s *MetricsServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves on the listener until the context is done
+func (s *MetricsServer) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	}()
+	if err := s.server.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false, every replica serves its metrics
+func (s *MetricsServer) NeedLeaderElection() bool {
+	return false
+}
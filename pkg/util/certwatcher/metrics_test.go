@@ -0,0 +1,143 @@
+package certwatcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple"
+	"maroonedpods.io/maroonedpods/pkg/certificates/triple/cert"
+	"maroonedpods.io/maroonedpods/pkg/util"
+)
+
+var _ = Describe("MetricsServer", func() {
+	const (
+		namespace  = "maroonedpods"
+		service    = "maroonedpods-operator-metrics"
+		secretName = "maroonedpods-operator-metrics-cert"
+	)
+
+	var (
+		client   *fake.Clientset
+		ca       *triple.KeyPair
+		registry *prometheus.Registry
+		watcher  *CertWatcher
+		addr     string
+		cancel   context.CancelFunc
+	)
+
+	writeSecret := func(commonName string) {
+		keyPair, err := triple.NewServerKeyPair(ca, commonName, service, namespace, "cluster.local", nil, nil, time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: secretName, ResourceVersion: commonName},
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       cert.EncodeCertPEM(keyPair.Cert),
+				corev1.TLSPrivateKeyKey: cert.EncodePrivateKeyPEM(keyPair.Key),
+			},
+		}
+		_, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		if err != nil {
+			_, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+		}
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	// scrape verifies the listener the way the ServiceMonitor does, against the CA and the name of the Service
+	scrape := func() (string, string, error) {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.Cert)
+		httpClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: service + "." + namespace + ".svc"},
+			DisableKeepAlives: true,
+		}}
+		resp, err := httpClient.Get("https://" + addr + util.MetricsPath)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", "", err
+		}
+		return resp.TLS.PeerCertificates[0].Subject.CommonName, string(body), nil
+	}
+
+	servedCommonName := func() string {
+		commonName, _, err := scrape()
+		if err != nil {
+			return ""
+		}
+		return commonName
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		var err error
+		ca, err = triple.NewCA("maroonedpods-metrics-signer", time.Hour)
+		Expect(err).ToNot(HaveOccurred())
+
+		registry = prometheus.NewRegistry()
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "maroonedpods_test_gauge", Help: "a test gauge"})
+		gauge.Set(42)
+		Expect(registry.Register(gauge)).To(Succeed())
+
+		watcher = New(client, Options{Namespace: namespace, SecretName: secretName})
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		addr = listener.Addr().String()
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			_ = watcher.Start(ctx)
+		}()
+		go func() {
+			defer GinkgoRecover()
+			Expect(NewMetricsServer(addr, watcher, registry).Serve(ctx, listener)).To(Succeed())
+		}()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should fail the handshake until the certificate is loaded", func() {
+		_, _, err := scrape()
+		Expect(err).To(HaveOccurred())
+
+		writeSecret("first")
+
+		Eventually(servedCommonName).Should(Equal("first"))
+	})
+
+	It("should serve the metrics over a verified connection", func() {
+		writeSecret("first")
+		Eventually(servedCommonName).Should(Equal("first"))
+
+		_, body, err := scrape()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(ContainSubstring("maroonedpods_test_gauge 42"))
+	})
+
+	It("should serve the rotated certificate without a restart", func() {
+		writeSecret("first")
+		Eventually(servedCommonName).Should(Equal("first"))
+
+		writeSecret("second")
+
+		Eventually(servedCommonName).Should(Equal("second"))
+	})
+})
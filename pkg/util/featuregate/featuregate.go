@@ -0,0 +1,101 @@
+package featuregate
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Env passes the comma separated enabled gates to the components
+	Env = "FEATURE_GATES"
+
+	// StrictTargetService fails the certificate sync when the Service of a serving certificate doesn't
+	// exist, instead of warning
+	StrictTargetService = "StrictTargetService"
+
+	// CertConsumerDiscovery finds the workloads mounting the certificate secrets and bundles, it needs
+	// the operator to list the deployments, daemonsets, statefulsets and pods of their namespaces
+	CertConsumerDiscovery = "CertConsumerDiscovery"
+)
+
+// known lists the gates, every gate is disabled unless it is listed in the CR
+var known = map[string]bool{
+	StrictTargetService:   true,
+	CertConsumerDiscovery: true,
+}
+
+// Gates are the enabled feature gates
+type Gates map[string]bool
+
+// New returns the gates enabled by the names, an unknown name is an error
+func New(names []string) (Gates, error) {
+	gates := Gates{}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown feature gate %q, the known gates are %s", name, strings.Join(Known(), ", "))
+		}
+		gates[name] = true
+	}
+	return gates, nil
+}
+
+// Validate checks every name is a known gate
+func Validate(names []string) error {
+	_, err := New(names)
+	return err
+}
+
+// Known returns the names of the known gates, sorted
+func Known() []string {
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled returns whether the gate is enabled
+func (g Gates) Enabled(name string) bool {
+	return g[name]
+}
+
+// List returns the names of the enabled gates sorted, nil if none is
+func (g Gates) List() []string {
+	var names []string
+	for name, enabled := range g {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvVars renders the gates for FromEnv, nil if none is enabled. The list is sorted, the pod template
+// only changes, and the pods roll, when the enabled gates do.
+func EnvVars(g Gates) []corev1.EnvVar {
+	names := g.List()
+	if len(names) == 0 {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  Env,
+			Value: strings.Join(names, ","),
+		},
+	}
+}
+
+// FromEnv returns the gates the operator enabled for the component
+func FromEnv() (Gates, error) {
+	value := os.Getenv(Env)
+	if value == "" {
+		return Gates{}, nil
+	}
+	return New(strings.Split(value, ","))
+}
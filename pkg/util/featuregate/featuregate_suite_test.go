@@ -0,0 +1,13 @@
+package featuregate_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFeatureGate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FeatureGate Suite")
+}
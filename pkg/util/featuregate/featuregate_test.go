@@ -0,0 +1,47 @@
+package featuregate
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("feature gates", func() {
+	It("should disable every gate by default", func() {
+		gates, err := New(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gates.Enabled(StrictTargetService)).To(BeFalse())
+		Expect(gates.List()).To(BeNil())
+		Expect(EnvVars(gates)).To(BeNil())
+	})
+
+	It("should enable the listed gates", func() {
+		gates, err := New([]string{StrictTargetService, StrictTargetService})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gates.Enabled(StrictTargetService)).To(BeTrue())
+		Expect(gates.List()).To(Equal([]string{StrictTargetService}))
+	})
+
+	It("should reject an unknown gate", func() {
+		err := Validate([]string{StrictTargetService, "strictTargetService"})
+		Expect(err).To(MatchError(ContainSubstring(`unknown feature gate "strictTargetService"`)))
+		Expect(err).To(MatchError(ContainSubstring(StrictTargetService)))
+	})
+
+	It("should pass the gates through the environment", func() {
+		gates, err := New([]string{StrictTargetService})
+		Expect(err).ToNot(HaveOccurred())
+		for _, env := range EnvVars(gates) {
+			GinkgoT().Setenv(env.Name, env.Value)
+		}
+
+		fromEnv, err := FromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fromEnv).To(Equal(gates))
+	})
+
+	It("should enable nothing without the environment", func() {
+		gates, err := FromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gates.List()).To(BeEmpty())
+	})
+})
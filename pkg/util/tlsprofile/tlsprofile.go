@@ -0,0 +1,146 @@
+package tlsprofile
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+
+	configv1 "github.com/openshift/api/config/v1"
+	"github.com/openshift/library-go/pkg/crypto"
+	corev1 "k8s.io/api/core/v1"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+const (
+	// MinVersionEnv passes the minimal TLS version of the profile to the listeners, e.g. VersionTLS12
+	MinVersionEnv = "TLS_MIN_VERSION"
+	// CiphersEnv passes the comma separated ciphers of the profile to the listeners
+	CiphersEnv = "TLS_CIPHERS"
+)
+
+// the TLS 1.3 ciphers can't be configured in Go, they are always enabled for TLS 1.3
+var tls13Ciphers = map[string]bool{
+	"TLS_AES_128_GCM_SHA256":       true,
+	"TLS_AES_256_GCM_SHA384":       true,
+	"TLS_CHACHA20_POLY1305_SHA256": true,
+}
+
+// Spec returns the version and ciphers of the profile, nil if the profile is nil and the listeners keep
+// their defaults. The predefined profiles are limited to the ciphers Go supports, a Custom profile with a
+// cipher Go doesn't support is invalid.
+func Spec(profile *v1alpha1.TLSSecurityProfile) (*v1alpha1.TLSProfileSpec, error) {
+	if profile == nil {
+		return nil, nil
+	}
+
+	var spec v1alpha1.TLSProfileSpec
+	switch profile.Type {
+	case v1alpha1.TLSProfileOldType, v1alpha1.TLSProfileIntermediateType, v1alpha1.TLSProfileModernType:
+		predefined := configv1.TLSProfiles[configv1.TLSProfileType(profile.Type)]
+		spec.MinTLSVersion = v1alpha1.TLSProtocolVersion(predefined.MinTLSVersion)
+		for _, cipher := range predefined.Ciphers {
+			if _, err := cipherSuite(cipher); err == nil || tls13Ciphers[cipher] {
+				spec.Ciphers = append(spec.Ciphers, cipher)
+			}
+		}
+	case v1alpha1.TLSProfileCustomType:
+		if profile.Custom == nil {
+			return nil, fmt.Errorf("the Custom TLS security profile requires the custom settings")
+		}
+		spec.MinTLSVersion = profile.Custom.MinTLSVersion
+		spec.Ciphers = append([]string(nil), profile.Custom.Ciphers...)
+	default:
+		return nil, fmt.Errorf("unknown TLS security profile type %q", profile.Type)
+	}
+
+	if _, _, err := Parse(spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate checks the profile is one the listeners can serve
+func Validate(profile *v1alpha1.TLSSecurityProfile) error {
+	_, err := Spec(profile)
+	return err
+}
+
+// Parse translates the spec into the MinVersion and CipherSuites of a tls.Config
+func Parse(spec v1alpha1.TLSProfileSpec) (uint16, []uint16, error) {
+	if spec.MinTLSVersion == "" {
+		return 0, nil, fmt.Errorf("the TLS security profile requires a minimal TLS version")
+	}
+	minVersion, err := crypto.TLSVersion(string(spec.MinTLSVersion))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var cipherSuites []uint16
+	tls13 := false
+	for _, cipher := range spec.Ciphers {
+		if tls13Ciphers[cipher] {
+			tls13 = true
+			continue
+		}
+		id, err := cipherSuite(cipher)
+		if err != nil {
+			return 0, nil, err
+		}
+		cipherSuites = append(cipherSuites, id)
+	}
+
+	// no cipher would mean the Go defaults rather than none
+	if len(cipherSuites) == 0 && (minVersion < tls.VersionTLS13 || !tls13) {
+		return 0, nil, fmt.Errorf("the TLS security profile has no cipher for %s", spec.MinTLSVersion)
+	}
+	if minVersion == tls.VersionTLS13 {
+		cipherSuites = nil
+	}
+	return minVersion, cipherSuites, nil
+}
+
+// cipherSuite returns the Go id of a TLS 1.2 or earlier cipher in OpenSSL or IANA notation
+func cipherSuite(name string) (uint16, error) {
+	ianaName := name
+	if names := crypto.OpenSSLToIANACipherSuites([]string{name}); len(names) == 1 {
+		ianaName = names[0]
+	}
+	id, err := crypto.CipherSuite(ianaName)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported cipher %q", name)
+	}
+	return id, nil
+}
+
+// EnvVars renders the spec for FromEnv, nil for a nil spec
+func EnvVars(spec *v1alpha1.TLSProfileSpec) []corev1.EnvVar {
+	if spec == nil {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name:  MinVersionEnv,
+			Value: string(spec.MinTLSVersion),
+		},
+		{
+			Name:  CiphersEnv,
+			Value: strings.Join(spec.Ciphers, ","),
+		},
+	}
+}
+
+// FromEnv returns the MinVersion and CipherSuites the operator configured, TLS 1.2 with the Go default
+// ciphers if it configured none
+func FromEnv() (uint16, []uint16, error) {
+	minVersion, ok := os.LookupEnv(MinVersionEnv)
+	if !ok {
+		return tls.VersionTLS12, nil, nil
+	}
+	spec := v1alpha1.TLSProfileSpec{MinTLSVersion: v1alpha1.TLSProtocolVersion(minVersion)}
+	if ciphers := os.Getenv(CiphersEnv); ciphers != "" {
+		spec.Ciphers = strings.Split(ciphers, ",")
+	}
+	return Parse(spec)
+}
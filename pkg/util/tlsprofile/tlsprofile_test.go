@@ -0,0 +1,153 @@
+package tlsprofile
+
+import (
+	"crypto/tls"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	configv1 "github.com/openshift/api/config/v1"
+
+	"maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
+)
+
+var _ = Describe("TLS security profiles", func() {
+	custom := func(minVersion v1alpha1.TLSProtocolVersion, ciphers ...string) *v1alpha1.TLSSecurityProfile {
+		return &v1alpha1.TLSSecurityProfile{
+			Type: v1alpha1.TLSProfileCustomType,
+			Custom: &v1alpha1.CustomTLSProfile{
+				TLSProfileSpec: v1alpha1.TLSProfileSpec{MinTLSVersion: minVersion, Ciphers: ciphers},
+			},
+		}
+	}
+
+	It("should keep the defaults without a profile", func() {
+		spec, err := Spec(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec).To(BeNil())
+		Expect(EnvVars(spec)).To(BeEmpty())
+	})
+
+	DescribeTable("should map every TLS version", func(version v1alpha1.TLSProtocolVersion, expected uint16) {
+		minVersion, _, err := Parse(v1alpha1.TLSProfileSpec{
+			MinTLSVersion: version,
+			Ciphers:       []string{"ECDHE-RSA-AES128-GCM-SHA256", "TLS_AES_128_GCM_SHA256"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(minVersion).To(Equal(expected))
+	},
+		Entry("1.0", v1alpha1.VersionTLS10, uint16(tls.VersionTLS10)),
+		Entry("1.1", v1alpha1.VersionTLS11, uint16(tls.VersionTLS11)),
+		Entry("1.2", v1alpha1.VersionTLS12, uint16(tls.VersionTLS12)),
+		Entry("1.3", v1alpha1.VersionTLS13, uint16(tls.VersionTLS13)),
+	)
+
+	DescribeTable("should map the predefined profiles", func(profileType v1alpha1.TLSProfileType, expectedVersion uint16) {
+		spec, err := Spec(&v1alpha1.TLSSecurityProfile{Type: profileType})
+		Expect(err).ToNot(HaveOccurred())
+		minVersion, cipherSuites, err := Parse(*spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(minVersion).To(Equal(expectedVersion))
+
+		supported := map[uint16]bool{}
+		for _, suite := range tls.CipherSuites() {
+			supported[suite.ID] = true
+		}
+		for _, suite := range tls.InsecureCipherSuites() {
+			supported[suite.ID] = true
+		}
+		for _, id := range cipherSuites {
+			Expect(supported).To(HaveKey(id))
+		}
+
+		// every cipher of the profile Go supports is kept, in its order
+		var expected []string
+		for _, cipher := range configv1.TLSProfiles[configv1.TLSProfileType(profileType)].Ciphers {
+			if _, err := cipherSuite(cipher); err == nil || tls13Ciphers[cipher] {
+				expected = append(expected, cipher)
+			}
+		}
+		Expect(spec.Ciphers).To(Equal(expected))
+		if expectedVersion == tls.VersionTLS13 {
+			Expect(cipherSuites).To(BeNil())
+		} else {
+			Expect(cipherSuites).ToNot(BeEmpty())
+		}
+	},
+		Entry("Old", v1alpha1.TLSProfileOldType, uint16(tls.VersionTLS10)),
+		Entry("Intermediate", v1alpha1.TLSProfileIntermediateType, uint16(tls.VersionTLS12)),
+		Entry("Modern", v1alpha1.TLSProfileModernType, uint16(tls.VersionTLS13)),
+	)
+
+	It("should map every cipher name of the predefined profiles Go knows", func() {
+		for profileType, profile := range configv1.TLSProfiles {
+			for _, cipher := range profile.Ciphers {
+				if tls13Ciphers[cipher] {
+					continue
+				}
+				id, err := cipherSuite(cipher)
+				if err != nil {
+					continue
+				}
+				Expect(tls.CipherSuiteName(id)).ToNot(HavePrefix("0x"), "%s of %s", cipher, profileType)
+			}
+		}
+		id, err := cipherSuite("ECDHE-ECDSA-AES128-GCM-SHA256")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(Equal(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256))
+	})
+
+	It("should accept IANA cipher names", func() {
+		_, cipherSuites, err := Parse(v1alpha1.TLSProfileSpec{
+			MinTLSVersion: v1alpha1.VersionTLS12,
+			Ciphers:       []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", "ECDHE-RSA-CHACHA20-POLY1305"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cipherSuites).To(Equal([]uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		}))
+	})
+
+	DescribeTable("should reject an invalid profile", func(profile *v1alpha1.TLSSecurityProfile, message string) {
+		err := Validate(profile)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(message))
+	},
+		Entry("unknown type", &v1alpha1.TLSSecurityProfile{Type: "Paranoid"}, "unknown TLS security profile type"),
+		Entry("custom without settings", &v1alpha1.TLSSecurityProfile{Type: v1alpha1.TLSProfileCustomType}, "requires the custom settings"),
+		Entry("no version", custom("", "ECDHE-RSA-AES128-GCM-SHA256"), "requires a minimal TLS version"),
+		Entry("unknown version", custom("VersionTLS14", "ECDHE-RSA-AES128-GCM-SHA256"), "VersionTLS14"),
+		Entry("unknown cipher", custom(v1alpha1.VersionTLS12, "ECDHE-RSA-AES128-GCM-SHA256", "NOT-A-CIPHER"), `unsupported cipher "NOT-A-CIPHER"`),
+		Entry("cipher Go doesn't support", custom(v1alpha1.VersionTLS12, "DHE-RSA-AES128-GCM-SHA256"), `unsupported cipher "DHE-RSA-AES128-GCM-SHA256"`),
+		Entry("no cipher", custom(v1alpha1.VersionTLS12), "has no cipher"),
+		Entry("only TLS 1.3 ciphers below TLS 1.3", custom(v1alpha1.VersionTLS12, "TLS_AES_128_GCM_SHA256"), "has no cipher"),
+	)
+
+	It("should accept only TLS 1.3 ciphers for TLS 1.3", func() {
+		Expect(Validate(custom(v1alpha1.VersionTLS13, "TLS_AES_256_GCM_SHA384"))).To(Succeed())
+	})
+
+	It("should pass the profile through the environment", func() {
+		spec, err := Spec(custom(v1alpha1.VersionTLS11, "ECDHE-RSA-AES128-GCM-SHA256", "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"))
+		Expect(err).ToNot(HaveOccurred())
+		for _, env := range EnvVars(spec) {
+			GinkgoT().Setenv(env.Name, env.Value)
+		}
+
+		minVersion, cipherSuites, err := FromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(minVersion).To(Equal(uint16(tls.VersionTLS11)))
+		Expect(cipherSuites).To(Equal([]uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		}))
+	})
+
+	It("should default to TLS 1.2 without the environment", func() {
+		minVersion, cipherSuites, err := FromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(minVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(cipherSuites).To(BeNil())
+	})
+})
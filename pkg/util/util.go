@@ -7,8 +7,10 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/util/certificate"
 	"k8s.io/klog/v2"
 	api "k8s.io/kubernetes/pkg/apis/core"
@@ -22,6 +24,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"strings"
 
+	"maroonedpods.io/maroonedpods/pkg/util/tlsprofile"
 	mpv1alpha1 "maroonedpods.io/maroonedpods/staging/src/maroonedpods.io/api/pkg/apis/core/v1alpha1"
 )
 
@@ -69,14 +72,51 @@ const (
 	InstallerVersionLabel = "INSTALLER_VERSION_LABEL"
 	// TlsLabel provides a constant to capture our env variable "TLS"
 	TlsLabel = "TLS"
+	// CertExpiryThresholdEnv provides a constant to capture our env variable "CERT_EXPIRY_THRESHOLD", how long
+	// before its expiry the served certificate fails the readiness of the server
+	CertExpiryThresholdEnv = "CERT_EXPIRY_THRESHOLD"
+	// DebugCertsEnv provides a constant to capture our env variable "DEBUG_CERTS_ENDPOINT", when true the operator
+	// serves the status of the managed certificates on /debug/certs of its metrics listener
+	DebugCertsEnv = "DEBUG_CERTS_ENDPOINT"
+	// CertSyncDebounceEnv provides a constant to capture our env variable "CERT_SYNC_DEBOUNCE", how long the operator
+	// skips the certificate syncs of unchanged definitions and objects after a successful one, 0 disables it
+	CertSyncDebounceEnv = "CERT_SYNC_DEBOUNCE"
+	// CertRotationJitterEnv provides a constant to capture our env variable "CERT_ROTATION_JITTER", the percentage of
+	// their refresh the certificate rotations are spread over either way, 10 by default, 0 disables it
+	CertRotationJitterEnv = "CERT_ROTATION_JITTER"
+	// CertMinSyncIntervalEnv provides a constant to capture our env variable "CERT_MIN_SYNC_INTERVAL", how long after
+	// a successful certificate sync the operator skips the syncs of the same definitions, 0 disables it
+	CertMinSyncIntervalEnv = "CERT_MIN_SYNC_INTERVAL"
 	// ConfigMapName is the name of the maroonedpods configmap that own maroonedpods resources
 	ConfigMapName                                            = "maroonedpods-config"
 	OperatorServiceAccountName                               = "maroonedpods-operator"
 	MaroonedPodsGate                                         = "MaroonedPodsGate"
 	ControllerResourceName                                   = ControllerPodName
 	SecretResourceName                                       = "maroonedpods-server-cert"
+	// SignerBundleResourceName is the name of the configmap holding the CA bundle of the server certificate
+	SignerBundleResourceName                                 = "maroonedpods-server-signer-bundle"
 	MaroonedPodsServerResourceName                           = "maroonedpods-server"
 	ControllerClusterRoleName                                = ControllerPodName
+	// MaroonedPodsCRDName is the name of the MaroonedPods CustomResourceDefinition
+	MaroonedPodsCRDName = "mps.maroonedpods.io"
+	// WebhookServePath is the path the maroonedpods-server serves the admission webhooks on
+	WebhookServePath = "/serve-path"
+	// MetricsPath is the path the components serve their prometheus metrics on
+	MetricsPath = "/metrics"
+	// OperatorHealthProbePort is the port the operator serves /readyz and /healthz on
+	OperatorHealthProbePort = 8081
+	// OperatorMetricsPort and ControllerMetricsPort are the ports the operator and the controller serve their
+	// metrics on, over TLS with the certificates of the metrics definitions
+	OperatorMetricsPort   = 8080
+	ControllerMetricsPort = 8444
+	// OperatorMetricsServiceName and ControllerMetricsServiceName are the Services in front of the metrics of the
+	// operator and the controller, the metrics certificates are issued for them
+	OperatorMetricsServiceName   = "maroonedpods-operator-metrics"
+	ControllerMetricsServiceName = "maroonedpods-controller-metrics"
+	// OperatorMetricsCertSecretName and ControllerMetricsCertSecretName are the secrets of the serving certificates
+	// of the metrics listeners
+	OperatorMetricsCertSecretName   = "maroonedpods-operator-metrics-cert"
+	ControllerMetricsCertSecretName = "maroonedpods-controller-metrics-cert"
 )
 
 var commonLabels = map[string]string{
@@ -242,6 +282,17 @@ func GetNamespace() string {
 	return getNamespace("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 }
 
+// IsKindAvailable checks whether the API server serves the given kind
+func IsKindAvailable(mapper meta.RESTMapper, gvk schema.GroupVersionKind) (bool, error) {
+	if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 // TLSVersion converts from human-readable TLS version (for example "1.1")
 // to the values accepted by tls.Config (for example 0x301).
 func TLSVersion(version v1.TLSProtocolVersion) uint16 {
@@ -282,26 +333,32 @@ func CipherSuiteIds(names []string) []uint16 {
 }
 
 func SetupTLS(certManager certificate.Manager) *tls.Config {
+	return SetupTLSWithCertificateGetter(func(info *tls.ClientHelloInfo) (certificate *tls.Certificate, err error) {
+		cert := certManager.Current()
+		if cert == nil {
+			return nil, fmt.Errorf(noSrvCertMessage)
+		}
+		return cert, nil
+	})
+}
+
+// SetupTLSWithCertificateGetter is SetupTLS for certificate sources that aren't a certificate.Manager, e.g. a CertWatcher
+// The MinVersion and CipherSuites come from the TLS security profile the operator renders into the environment.
+func SetupTLSWithCertificateGetter(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) *tls.Config {
+	minTLSVersion, ciphers, err := tlsprofile.FromEnv()
+	if err != nil {
+		klog.Fatalf("Invalid TLS security profile: %v", err)
+	}
 	tlsConfig := &tls.Config{
-		GetCertificate: func(info *tls.ClientHelloInfo) (certificate *tls.Certificate, err error) {
-			cert := certManager.Current()
-			if cert == nil {
-				return nil, fmt.Errorf(noSrvCertMessage)
-			}
-			return cert, nil
-		},
+		CipherSuites:   ciphers,
+		MinVersion:     minTLSVersion,
+		GetCertificate: getCertificate,
 		GetConfigForClient: func(hi *tls.ClientHelloInfo) (*tls.Config, error) {
-			crt := certManager.Current()
-			if crt == nil {
+			crt, err := getCertificate(hi)
+			if err != nil {
 				klog.Error(noSrvCertMessage)
 				return nil, fmt.Errorf(noSrvCertMessage)
 			}
-			tlsConfig := &v1.TLSConfiguration{ //maybe we will want to add config in MaroonedPods CR in the future
-				MinTLSVersion: v1.VersionTLS12,
-				Ciphers:       nil,
-			}
-			ciphers := CipherSuiteIds(tlsConfig.Ciphers)
-			minTLSVersion := TLSVersion(tlsConfig.MinTLSVersion)
 			config := &tls.Config{
 				CipherSuites: ciphers,
 				MinVersion:   minTLSVersion,
@@ -46,16 +46,46 @@ type MaroonedPods struct {
 	Status MaroonedPodsStatus `json:"status"`
 }
 
-// CertConfig contains the tunables for TLS certificates
+// CertConfig contains the tunables for TLS certificates. The durations are in Go syntax, e.g. 8760h,
+// the admission webhook of the CR also accepts the d (days) and y (365-day years) units, e.g. 365d or
+// 1y, and stores them in Go syntax.
 type CertConfig struct {
 	// The requested 'duration' (i.e. lifetime) of the Certificate.
+	// +kubebuilder:validation:Pattern=`^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
 	Duration *metav1.Duration `json:"duration,omitempty"`
 
 	// The amount of time before the currently issued certificate's `notAfter`
 	// time that we will begin to attempt to renew the certificate.
+	// +kubebuilder:validation:Pattern=`^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
 	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// RenewBeforePercent renews the certificate when the percentage of its lifetime
+	// is left, e.g. 20 renews at 80% of the lifetime. Mutually exclusive with renewBefore.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=99
+	// +optional
+	RenewBeforePercent *int32 `json:"renewBeforePercent,omitempty"`
+
+	// Backdate moves the 'notBefore' of the certificate into the past, so clients
+	// whose clock is behind accept it. At most 1h, the 'notAfter' is unchanged.
+	// +kubebuilder:validation:Pattern=`^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+	// +optional
+	Backdate *metav1.Duration `json:"backdate,omitempty"`
 }
 
+// CertTarget names the certificates of TargetOverrides
+// +kubebuilder:validation:Enum=server;controller-client;metrics
+type CertTarget string
+
+const (
+	// CertTargetServer is the serving certificate of the server
+	CertTargetServer CertTarget = "server"
+	// CertTargetControllerClient is the client certificate of the controller
+	CertTargetControllerClient CertTarget = "controller-client"
+	// CertTargetMetrics are the serving certificates of the metrics of the operator and the controller
+	CertTargetMetrics CertTarget = "metrics"
+)
+
 // MaroonedPodsCertConfig has the CertConfigs for MaroonedPods
 type MaroonedPodsCertConfig struct {
 	// CA configuration
@@ -65,6 +95,101 @@ type MaroonedPodsCertConfig struct {
 	// Server configuration
 	// Certs are rotated and discarded
 	Server *CertConfig `json:"server,omitempty"`
+
+	// TargetOverrides configure single certificates on top of the Server configuration, the fields
+	// an override sets replace those of Server, renewBefore and renewBeforePercent together. The
+	// targets are server, the serving certificate of the server, controller-client, the client
+	// certificate of the controller, and metrics, the serving certificates of the metrics.
+	// +optional
+	TargetOverrides map[CertTarget]CertConfig `json:"targetOverrides,omitempty"`
+
+	// RolloutOnRotation restarts the deployments mounting a rotated certificate
+	// so they pick up the new material. Defaults to true, disable it for
+	// components that reload their certificates on their own.
+	// +optional
+	RolloutOnRotation *bool `json:"rolloutOnRotation,omitempty"`
+
+	// Issuer requests the certificates from a cert-manager.io Issuer or ClusterIssuer
+	// instead of the built-in signer. The CA configuration is ignored in that case,
+	// the Server one is passed on to cert-manager.
+	// +optional
+	Issuer *CertIssuerReference `json:"issuer,omitempty"`
+
+	// PreserveOnUninstall keeps the certificate secrets and CA bundles when the MaroonedPods CR
+	// is deleted, by default they are deleted together with the installation. The kept objects
+	// are labeled as preserved and adopted by the next installation, which keeps the CA instead
+	// of issuing a new one. Preserved objects no installation adopts are kept as long as this
+	// is set, and deleted once it is not.
+	// +optional
+	PreserveOnUninstall *bool `json:"preserveOnUninstall,omitempty"`
+
+	// BundleReplicaNamespaces get a copy of the CA bundle configmap, e.g. the workload namespaces
+	// calling the server directly. The copies are kept up to date and removed from the namespaces
+	// dropped from the list.
+	// +optional
+	BundleReplicaNamespaces []string `json:"bundleReplicaNamespaces,omitempty"`
+
+	// BundleReplicaNamespaceSelector selects more namespaces getting a copy of the CA bundle
+	// configmap, it is evaluated on every reconcile.
+	// +optional
+	BundleReplicaNamespaceSelector *metav1.LabelSelector `json:"bundleReplicaNamespaceSelector,omitempty"`
+
+	// IncludeKubeRootCA merges the cluster root CA of kube-root-ca.crt into the CA bundle, for
+	// clients of the server that also call the Kubernetes API and want a single trust bundle.
+	// +optional
+	IncludeKubeRootCA bool `json:"includeKubeRootCA,omitempty"`
+
+	// CanaryInterval is how often a short-lived certificate is issued from each built-in signer
+	// and verified against the CA bundle, so a signer that can't issue anymore is detected before
+	// the certificates expire. The canary is disabled when unset.
+	// +optional
+	CanaryInterval *metav1.Duration `json:"canaryInterval,omitempty"`
+
+	// FIPSMode restricts the certificates to FIPS-approved keys and signatures, certificates issued
+	// before with other parameters are re-issued. Auto, the default, enables it on hosts running in
+	// FIPS mode.
+	// +kubebuilder:validation:Enum=Auto;Enabled;Disabled
+	// +optional
+	FIPSMode CertFIPSMode `json:"fipsMode,omitempty"`
+
+	// ProxyTrust combines the CA bundle with the CAs of the cluster-wide proxy into a trust bundle
+	// the controller and the server mount, so their outbound calls through a TLS-intercepting proxy
+	// verify. The trust bundle follows both sources and is removed when this is unset.
+	// +optional
+	ProxyTrust *CertProxyTrust `json:"proxyTrust,omitempty"`
+}
+
+// CertProxyTrust selects where the CAs of the cluster-wide proxy are read from
+type CertProxyTrust struct {
+	// ConfigMapName is a configmap of the install namespace with the CAs under ca-bundle.crt. When
+	// empty, the operator creates one OpenShift injects its trusted CA bundle into.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+}
+
+// CertFIPSMode tells whether the certificates are restricted to FIPS-approved parameters
+type CertFIPSMode string
+
+const (
+	// CertFIPSModeAuto follows the FIPS mode of the host of the operator
+	CertFIPSModeAuto CertFIPSMode = "Auto"
+	// CertFIPSModeEnabled always restricts the certificates to FIPS-approved parameters
+	CertFIPSModeEnabled CertFIPSMode = "Enabled"
+	// CertFIPSModeDisabled never restricts the certificates
+	CertFIPSModeDisabled CertFIPSMode = "Disabled"
+)
+
+// CertIssuerReference references a cert-manager.io issuer
+type CertIssuerReference struct {
+	// Name of the issuer
+	Name string `json:"name"`
+	// Kind of the issuer, Issuer (in the MaroonedPods namespace) or ClusterIssuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Group of the issuer, defaults to cert-manager.io
+	// +optional
+	Group string `json:"group,omitempty"`
 }
 
 // MaroonedPodsSpec defines our specification for the MaroonedPods installation
@@ -72,20 +197,177 @@ type MaroonedPodsSpec struct {
 	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
 	// PullPolicy describes a policy for if/when to pull a container image
 	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty" valid:"required"`
+	// ImagePullSecrets are the secrets the MaroonedPods components pull their images with,
+	// the operator pulls with its own
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
 	// Rules on which nodes MaroonedPods infrastructure pods will be scheduled
 	Infra sdkapi.NodePlacement `json:"infra,omitempty"`
 	// Restrict on which nodes MaroonedPods workload pods will be scheduled
 	Workloads sdkapi.NodePlacement `json:"workload,omitempty"`
 	// certificate configuration
 	CertConfig *MaroonedPodsCertConfig `json:"certConfig,omitempty"`
-	// PriorityClass of the MaroonedPods control plane
+	// CertManagement selects who issues the serving certificates, defaults to selfManaged
+	// +kubebuilder:validation:Enum=selfManaged;serviceCA;external
+	// +optional
+	CertManagement CertManagementMode `json:"certManagement,omitempty"`
+	// PriorityClass of the MaroonedPods control plane, kubevirt-cluster-critical when it exists by default.
+	// The CR is degraded while the class set here doesn't exist.
 	PriorityClass *MaroonedPodsPriorityClass `json:"priorityClass,omitempty"`
 	// namespaces where pods should be gated before scheduling
 	// Default to the empty LabelSelector, which matches everything.
 	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// TLSSecurityProfile restricts the TLS versions and ciphers of the MaroonedPods listeners.
+	// When unset the profile of the OpenShift APIServer config is used if there is one,
+	// otherwise TLS 1.2+ with the Go default ciphers
+	// +optional
+	TLSSecurityProfile *TLSSecurityProfile `json:"tlsSecurityProfile,omitempty"`
+	// NetworkPolicy creates NetworkPolicies allowing the traffic of the MaroonedPods components
+	// in the install namespace, for clusters denying it by default
+	// +optional
+	NetworkPolicy *NetworkPolicyConfig `json:"networkPolicy,omitempty"`
+	// Resources sets the compute resources of the MaroonedPods components
+	// +optional
+	Resources *ComponentResources `json:"resources,omitempty"`
+	// ServerReplicas is the replica count of the webhook server, 2 by default. With two replicas or
+	// more they are spread across the nodes and a PodDisruptionBudget keeps one of them available.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ServerReplicas *int32 `json:"serverReplicas,omitempty"`
+	// FeatureGates enables experimental behaviors, every gate is disabled unless it is listed.
+	// Unknown gates are rejected.
+	// +listType=set
+	// +optional
+	FeatureGates []string `json:"featureGates,omitempty"`
+	// Monitoring configures the monitoring resources, created when the cluster serves the
+	// monitoring.coreos.com/v1 API of the prometheus-operator
+	// +optional
+	Monitoring *MonitoringConfig `json:"monitoring,omitempty"`
 }
 
+// MonitoringConfig configures the ServiceMonitor scraping the operator, the controller and the server
+type MonitoringConfig struct {
+	// ServiceMonitorLabels are added to the ServiceMonitor for the serviceMonitorSelector of the
+	// Prometheus to pick it up, e.g. release: prometheus with kube-prometheus-stack. OpenShift
+	// cluster monitoring instead scrapes the namespaces labeled openshift.io/cluster-monitoring=true.
+	// +optional
+	ServiceMonitorLabels map[string]string `json:"serviceMonitorLabels,omitempty"`
+}
+
+// ComponentResources has the compute resources of each MaroonedPods component, a component
+// without any keeps its default requests. Limits can't be lower than the requests.
+type ComponentResources struct {
+	// Controller is the resources of the controller container
+	// +optional
+	Controller *corev1.ResourceRequirements `json:"controller,omitempty"`
+	// Server is the resources of the webhook server container
+	// +optional
+	Server *corev1.ResourceRequirements `json:"server,omitempty"`
+}
+
+// NetworkPolicyConfig configures the NetworkPolicies of the MaroonedPods components
+type NetworkPolicyConfig struct {
+	// Enabled creates a policy allowing the ingress to the webhook port of the server and one
+	// allowing the egress of the controller to the apiserver and DNS. They are deleted when disabled.
+	Enabled bool `json:"enabled"`
+	// IngressCIDRs are the sources allowed to reach the webhook server, any source when neither
+	// they nor the IngressNamespaceSelector are set. The apiserver usually runs on the host
+	// network, its addresses have to be included.
+	// +optional
+	IngressCIDRs []string `json:"ingressCIDRs,omitempty"`
+	// IngressNamespaceSelector selects the namespaces whose pods are allowed to reach the webhook server
+	// +optional
+	IngressNamespaceSelector *metav1.LabelSelector `json:"ingressNamespaceSelector,omitempty"`
+}
+
+// TLSSecurityProfile defines the TLS settings of the listeners, modeled on the OpenShift
+// config.openshift.io/v1 TLSSecurityProfile
+type TLSSecurityProfile struct {
+	// Type is one of the predefined Old, Intermediate and Modern profiles of
+	// https://wiki.mozilla.org/Security/Server_Side_TLS, or Custom
+	// +kubebuilder:validation:Enum=Old;Intermediate;Modern;Custom
+	Type TLSProfileType `json:"type"`
+	// Old is the profile for clients that can't be upgraded, TLS 1.0+
+	// +optional
+	Old *OldTLSProfile `json:"old,omitempty"`
+	// Intermediate is the recommended profile, TLS 1.2+
+	// +optional
+	Intermediate *IntermediateTLSProfile `json:"intermediate,omitempty"`
+	// Modern is the profile for clients that support TLS 1.3 only
+	// +optional
+	Modern *ModernTLSProfile `json:"modern,omitempty"`
+	// Custom sets the minimal version and the ciphers, required with the Custom type
+	// +optional
+	Custom *CustomTLSProfile `json:"custom,omitempty"`
+}
+
+// TLSProfileType is the type of a TLSSecurityProfile
+type TLSProfileType string
+
+const (
+	// TLSProfileOldType is the Old profile
+	TLSProfileOldType TLSProfileType = "Old"
+	// TLSProfileIntermediateType is the Intermediate profile
+	TLSProfileIntermediateType TLSProfileType = "Intermediate"
+	// TLSProfileModernType is the Modern profile
+	TLSProfileModernType TLSProfileType = "Modern"
+	// TLSProfileCustomType is a profile with user-defined parameters
+	TLSProfileCustomType TLSProfileType = "Custom"
+)
+
+// OldTLSProfile is the Old profile, it has no parameters
+type OldTLSProfile struct{}
+
+// IntermediateTLSProfile is the Intermediate profile, it has no parameters
+type IntermediateTLSProfile struct{}
+
+// ModernTLSProfile is the Modern profile, it has no parameters
+type ModernTLSProfile struct{}
+
+// CustomTLSProfile is a profile with user-defined parameters
+type CustomTLSProfile struct {
+	TLSProfileSpec `json:",inline"`
+}
+
+// TLSProfileSpec is the minimal version and the ciphers of a profile
+type TLSProfileSpec struct {
+	// Ciphers negotiated during the TLS handshake, in OpenSSL or IANA notation,
+	// e.g. ECDHE-RSA-AES128-GCM-SHA256. The TLS 1.3 ciphers are not configurable,
+	// they are accepted and always enabled.
+	Ciphers []string `json:"ciphers"`
+	// MinTLSVersion is the minimal version of the TLS protocol negotiated during the TLS handshake
+	MinTLSVersion TLSProtocolVersion `json:"minTLSVersion"`
+}
+
+// TLSProtocolVersion is a version of the TLS protocol
+// +kubebuilder:validation:Enum=VersionTLS10;VersionTLS11;VersionTLS12;VersionTLS13
+type TLSProtocolVersion string
+
 const (
+	// VersionTLS10 is version 1.0 of the TLS protocol
+	VersionTLS10 TLSProtocolVersion = "VersionTLS10"
+	// VersionTLS11 is version 1.1 of the TLS protocol
+	VersionTLS11 TLSProtocolVersion = "VersionTLS11"
+	// VersionTLS12 is version 1.2 of the TLS protocol
+	VersionTLS12 TLSProtocolVersion = "VersionTLS12"
+	// VersionTLS13 is version 1.3 of the TLS protocol
+	VersionTLS13 TLSProtocolVersion = "VersionTLS13"
+)
+
+// CertManagementMode defines who issues the MaroonedPods serving certificates
+type CertManagementMode string
+
+const (
+	// CertManagementSelfManaged lets the operator run its own signer and rotate the certificates
+	CertManagementSelfManaged CertManagementMode = "selfManaged"
+	// CertManagementServiceCA lets the OpenShift service-ca operator issue the serving certificates,
+	// client certificates keep being issued by the operator
+	CertManagementServiceCA CertManagementMode = "serviceCA"
+	// CertManagementExternal uses the serving certificates the user provides in the certificate
+	// secrets, with tls.crt, tls.key and the ca.crt of the issuing CA. The operator never issues
+	// them, it validates them and publishes their CA.
+	CertManagementExternal CertManagementMode = "external"
+)
 
 // MaroonedPodsPriorityClass defines the priority class of the MaroonedPods control plane.
 type MaroonedPodsPriorityClass string
@@ -93,9 +375,48 @@ type MaroonedPodsPriorityClass string
 // MaroonedPodsPhase is the current phase of the MaroonedPods deployment
 type MaroonedPodsPhase string
 
+const (
+	// MaroonedPodsPhaseDeploying is set until the components are available
+	MaroonedPodsPhaseDeploying MaroonedPodsPhase = "Deploying"
+	// MaroonedPodsPhaseDeployed is set once the components are available and nothing is in progress
+	MaroonedPodsPhaseDeployed MaroonedPodsPhase = "Deployed"
+	// MaroonedPodsPhaseDegraded is set while the Degraded condition is
+	MaroonedPodsPhaseDegraded MaroonedPodsPhase = "Degraded"
+	// MaroonedPodsPhaseDeleting is set once the CR is being deleted
+	MaroonedPodsPhaseDeleting MaroonedPodsPhase = "Deleting"
+)
+
 // MaroonedPodsStatus defines the status of the installation
 type MaroonedPodsStatus struct {
 	sdkapi.Status `json:",inline"`
+	// ObservedGeneration is the generation of the spec the last successful reconcile applied,
+	// it is not updated by a reconcile that failed in part
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// DeploymentPhase summarizes the conditions, the phase of the inlined status is the
+	// install and upgrade progress of the operator
+	// +optional
+	DeploymentPhase MaroonedPodsPhase `json:"deploymentPhase,omitempty"`
+	// FeatureGates are the gates enabled on the components
+	// +optional
+	FeatureGates []string `json:"featureGates,omitempty"`
+	// ForcedCertRotation is the progress of the rotation requested by the
+	// operator.maroonedpods.io/force-cert-rotation annotation
+	// +optional
+	ForcedCertRotation *ForcedCertRotationStatus `json:"forcedCertRotation,omitempty"`
+}
+
+// ForcedCertRotationStatus tracks a forced rotation of all certificates, it is done once per annotation value
+type ForcedCertRotationStatus struct {
+	// Token is the annotation value the rotation was requested with
+	Token string `json:"token"`
+	// Rotated lists the certificates already rotated for the token, they are not rotated again when
+	// the rotation of the others is retried
+	// +optional
+	Rotated []string `json:"rotated,omitempty"`
+	// Completed is set once every certificate was rotated for the token
+	// +optional
+	Completed bool `json:"completed,omitempty"`
 }
 
 // MaroonedPodsList provides the needed parameters to do request a list of MaroonedPods from the system
@@ -107,4 +428,3 @@ type MaroonedPodsList struct {
 	// Items provides a list of MaroonedPods
 	Items []MaroonedPods `json:"items"`
 }
-